@@ -48,6 +48,7 @@ func main() {
 	colors.PrintEndpoint("POST", "/api/v1/users", "Create new user")
 	colors.PrintEndpoint("GET", "/api/v1/devices", "List all devices")
 	colors.PrintEndpoint("POST", "/api/v1/devices", "Register new device")
+	colors.PrintEndpoint("GET", "/api/v1/devices/sim/:sim_no", "Find device by SIM number")
 	colors.PrintEndpoint("GET", "/api/v1/vehicles", "List all vehicles")
 	colors.PrintEndpoint("POST", "/api/v1/vehicles", "Register new vehicle")
 	colors.PrintInfo("Server timezone: %s (UTC+%d)", config.GetTimezoneString(), config.GetTimezoneOffset())
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"luna_iot_server/config"
@@ -9,6 +10,9 @@ import (
 	"luna_iot_server/internal/tcp"
 	"luna_iot_server/pkg/colors"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -20,6 +24,7 @@ func main() {
 	// Parse command line flags
 	disableGPSValidation := flag.Bool("disable-gps-validation", false, "Disable GPS validation for testing")
 	disableGPSSmoothing := flag.Bool("disable-gps-smoothing", false, "Disable GPS smoothing for testing")
+	gpsSmoothingWeight := flag.Float64("gps-smoothing-weight", 0, "Weight of the new GPS fix when smoothing, in (0,1] (default from GPS_SMOOTHING_WEIGHT or 0.95)")
 	flag.Parse()
 
 	// Load environment variables from .env file
@@ -27,6 +32,12 @@ func main() {
 		colors.PrintWarning("No .env file found, using system environment variables")
 	}
 
+	// Fall back to the environment when the flag is not given
+	smoothingWeight := *gpsSmoothingWeight
+	if smoothingWeight == 0 {
+		smoothingWeight = config.GetTCPConfig().SmoothingWeight
+	}
+
 	// Initialize timezone configuration
 	colors.PrintInfo("Initializing timezone configuration...")
 	if err := config.InitializeTimezone(); err != nil {
@@ -51,8 +62,15 @@ func main() {
 		port = "5000"
 	}
 
+	// Optional multi-port setup, e.g. TCP_LISTENERS=5000:gt06,5001:gt06
+	tcpListeners := os.Getenv("TCP_LISTENERS")
+
 	// Use the enhanced TCP server from internal/tcp package
-	colors.PrintServer("📡", "Starting Enhanced GT06 TCP Server on port %s", port)
+	if tcpListeners != "" {
+		colors.PrintServer("📡", "Starting Enhanced TCP Server on listeners %s", tcpListeners)
+	} else {
+		colors.PrintServer("📡", "Starting Enhanced GT06 TCP Server on port %s", port)
+	}
 	colors.PrintConnection("📶", "Features: GPS validation, device timeout monitoring, enhanced WebSocket broadcasting")
 	colors.PrintData("💾", "Database connectivity enabled - GPS data will be saved")
 	colors.PrintControl("Oil/Electricity control system enabled - Ready for commands")
@@ -72,13 +90,45 @@ func main() {
 	}
 
 	// Create and start the enhanced TCP server
-	tcpServer := tcp.NewServerWithController(port, controlController)
+	var tcpServer *tcp.Server
+	if tcpListeners != "" {
+		listenerConfigs, err := tcp.ParseListenerConfigs(tcpListeners)
+		if err != nil {
+			colors.PrintError("Invalid TCP_LISTENERS configuration: %v", err)
+			log.Fatalf("Invalid TCP_LISTENERS configuration: %v", err)
+		}
+		tcpServer = tcp.NewServerWithListeners(listenerConfigs, controlController)
+	} else {
+		tcpServer = tcp.NewServerWithController(port, controlController)
+	}
 
 	// Configure GPS processing based on flags
-	tcpServer.ConfigureGPSProcessing(!*disableGPSValidation, !*disableGPSSmoothing)
+	if err := tcpServer.ConfigureGPSProcessing(!*disableGPSValidation, !*disableGPSSmoothing, smoothingWeight); err != nil {
+		colors.PrintError("Invalid GPS processing configuration: %v", err)
+		log.Fatalf("Invalid GPS processing configuration: %v", err)
+	}
+
+	errorChan := make(chan error, 1)
+	go func() {
+		errorChan <- tcpServer.Start()
+	}()
+
+	// Stop cleanly on SIGINT/SIGTERM so open device connections are closed properly
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
-	if err := tcpServer.Start(); err != nil {
-		colors.PrintError("Failed to start TCP server: %v", err)
-		log.Fatalf("Failed to start TCP server: %v", err)
+	select {
+	case err := <-errorChan:
+		if err != nil {
+			colors.PrintError("Failed to start TCP server: %v", err)
+			log.Fatalf("Failed to start TCP server: %v", err)
+		}
+	case <-quit:
+		colors.PrintInfo("Shutting down TCP server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := tcpServer.Stop(ctx); err != nil {
+			colors.PrintWarning("TCP server did not stop cleanly: %v", err)
+		}
 	}
 }
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"luna_iot_server/config"
+	server "luna_iot_server/internal/http"
+	"luna_iot_server/internal/http/middleware"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+	"luna_iot_server/pkg/jwt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testSecret = "test-secret"
+
+func main() {
+	colors.PrintHeader("JWT ACCESS TOKEN TESTING")
+
+	testValidToken()
+	testExpiredToken()
+	testTamperedToken()
+	testLegacyTokenDetection()
+	testSessionAccessToken()
+	testRevokedSession()
+	testRefreshTokenHashing()
+	testRequireRole()
+	testLoginLockout()
+	testLoginRateLimit()
+	testWebSocketOrigin()
+	testRequestID()
+}
+
+// testValidToken signs and parses a token and checks the claims round-trip
+func testValidToken() {
+	colors.PrintSubHeader("Valid Token")
+
+	claims := jwt.NewClaims(42, 1, time.Hour)
+	claims.Phone = "9800000000"
+
+	token, err := jwt.Sign(claims, testSecret)
+	if !check("token signed", err == nil) {
+		return
+	}
+	check("token looks like a JWT", jwt.LooksLikeJWT(token))
+
+	parsed, err := jwt.Parse(token, testSecret)
+	if !check("token verified", err == nil) {
+		return
+	}
+	check("user ID preserved", parsed.UserID == 42)
+	check("role preserved", parsed.Role == 1)
+	check("phone preserved", parsed.Phone == "9800000000")
+}
+
+// testExpiredToken checks that a token past its expiry is rejected
+func testExpiredToken() {
+	colors.PrintSubHeader("Expired Token")
+
+	claims := jwt.NewClaims(42, 1, -time.Minute)
+	token, err := jwt.Sign(claims, testSecret)
+	if !check("token signed", err == nil) {
+		return
+	}
+
+	_, err = jwt.Parse(token, testSecret)
+	check("expired token rejected", err == jwt.ErrExpired)
+}
+
+// testTamperedToken checks that altered payloads and foreign secrets are rejected
+func testTamperedToken() {
+	colors.PrintSubHeader("Tampered Token")
+
+	token, err := jwt.Sign(jwt.NewClaims(42, 1, time.Hour), testSecret)
+	if !check("token signed", err == nil) {
+		return
+	}
+
+	// Promote the user to admin (role 0) without re-signing
+	parts := strings.Split(token, ".")
+	forged := jwt.NewClaims(42, 0, time.Hour)
+	forgedToken, _ := jwt.Sign(forged, "attacker-secret")
+	parts[1] = strings.Split(forgedToken, ".")[1]
+	_, err = jwt.Parse(strings.Join(parts, "."), testSecret)
+	check("modified payload rejected", err == jwt.ErrInvalidSignature)
+
+	_, err = jwt.Parse(forgedToken, testSecret)
+	check("token signed with another secret rejected", err == jwt.ErrInvalidSignature)
+
+	// An unsigned "alg: none" header must never be accepted
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	_, err = jwt.Parse(noneHeader+"."+parts[1]+".", testSecret)
+	check("alg none rejected", err != nil)
+
+	_, err = jwt.Parse("not-a-token", testSecret)
+	check("malformed token rejected", err == jwt.ErrMalformed)
+}
+
+// testLegacyTokenDetection checks that legacy hex tokens are routed to the database lookup
+func testLegacyTokenDetection() {
+	colors.PrintSubHeader("Legacy Token Detection")
+
+	legacy := strings.Repeat("ab", 32)
+	check("hex token not treated as JWT", !jwt.LooksLikeJWT(legacy))
+}
+
+// testSessionAccessToken checks that issued access tokens are short-lived and bound to their session
+func testSessionAccessToken() {
+	colors.PrintSubHeader("Session Access Token")
+
+	os.Setenv("JWT_SECRET", testSecret)
+	os.Setenv("JWT_ACCESS_TTL_MINUTES", "15")
+
+	user := &models.User{ID: 7, Role: models.UserRoleClient, Phone: "9800000000"}
+	token, err := middleware.IssueAccessToken(user, "session-active")
+	if !check("access token issued", err == nil && token != "") {
+		return
+	}
+
+	claims, err := jwt.Parse(token, testSecret)
+	if !check("access token verified", err == nil) {
+		return
+	}
+	check("session ID embedded", claims.SessionID == "session-active")
+	check("expires within 15 minutes", claims.ExpiresAt-claims.IssuedAt == int64((15*time.Minute).Seconds()))
+
+	authenticated, err := middleware.AuthenticateToken(token)
+	check("accepted without database lookup", err == nil && authenticated.ID == 7)
+}
+
+// testRevokedSession checks that access tokens of a revoked session are rejected before they expire
+func testRevokedSession() {
+	colors.PrintSubHeader("Revoked Session")
+
+	os.Setenv("JWT_SECRET", testSecret)
+
+	user := &models.User{ID: 7, Role: models.UserRoleClient}
+	token, err := middleware.IssueAccessToken(user, "session-revoked")
+	if !check("access token issued", err == nil) {
+		return
+	}
+
+	_, err = middleware.AuthenticateToken(token)
+	check("accepted before revocation", err == nil)
+
+	services.MarkSessionRevoked("session-revoked", time.Now().Add(15*time.Minute))
+	check("session reported revoked", services.IsSessionRevoked("session-revoked"))
+
+	_, err = middleware.AuthenticateToken(token)
+	check("rejected after revocation", err == middleware.ErrInvalidToken)
+
+	other, _ := middleware.IssueAccessToken(user, "session-other")
+	_, err = middleware.AuthenticateToken(other)
+	check("other sessions unaffected", err == nil)
+
+	services.MarkSessionRevoked("session-lapsed", time.Now().Add(-time.Second))
+	check("lapsed revocation entries ignored", !services.IsSessionRevoked("session-lapsed"))
+}
+
+// testRefreshTokenHashing checks that refresh tokens are stored in hashed form
+func testRefreshTokenHashing() {
+	colors.PrintSubHeader("Refresh Token Hashing")
+
+	refreshToken := strings.Repeat("cd", 32)
+	hash := services.HashRefreshToken(refreshToken)
+	check("hash is 64 hex characters", len(hash) == 64)
+	check("hash differs from token", hash != refreshToken)
+	check("hash is deterministic", hash == services.HashRefreshToken(refreshToken))
+	check("rotated token hashes differently", hash != services.HashRefreshToken(strings.Repeat("ef", 32)))
+}
+
+// testRequireRole checks that role-restricted routes block other roles and unauthenticated requests
+func testRequireRole() {
+	colors.PrintSubHeader("Role Enforcement")
+
+	gin.SetMode(gin.ReleaseMode)
+
+	check("admin passes", roleStatus(&models.User{ID: 1, Role: models.UserRoleAdmin}) == http.StatusOK)
+	check("client blocked with 403", roleStatus(&models.User{ID: 2, Role: models.UserRoleClient}) == http.StatusForbidden)
+	check("unauthenticated blocked with 401", roleStatus(nil) == http.StatusUnauthorized)
+}
+
+// roleStatus runs an admin-only route as the given user and returns the response status
+func roleStatus(user *models.User) int {
+	router := gin.New()
+	router.DELETE("/gps/:id", func(c *gin.Context) {
+		if user != nil {
+			c.Set("user", user)
+		}
+		c.Next()
+	}, middleware.RequireRole(models.UserRoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/gps/1", nil))
+	return recorder.Code
+}
+
+// testLoginLockout simulates repeated failed logins and checks lockout and backoff
+func testLoginLockout() {
+	colors.PrintSubHeader("Login Lockout")
+
+	tracker := services.NewLoginAttemptTracker(config.LoginLimits{
+		MaxFailuresPerIdentifier: 3,
+		MaxFailuresPerIP:         100,
+		FailureWindow:            time.Minute,
+		LockoutBase:              100 * time.Millisecond,
+		LockoutMax:               time.Second,
+	})
+
+	const ip, phone = "10.0.0.1", "9800000000"
+	for i := 0; i < 3; i++ {
+		if _, allowed := tracker.Allow(ip, phone); !allowed {
+			check("attempts before the limit allowed", false)
+			return
+		}
+		tracker.RecordFailure(ip, phone)
+	}
+
+	retryAfter, allowed := tracker.Allow(ip, phone)
+	check("locked after 3 failures", !allowed)
+	check("first lockout uses base duration", retryAfter > 0 && retryAfter <= 100*time.Millisecond)
+
+	_, allowed = tracker.Allow(ip, "9811111111")
+	check("other phone numbers unaffected", allowed)
+
+	time.Sleep(110 * time.Millisecond)
+	_, allowed = tracker.Allow(ip, phone)
+	check("unlocked after lockout expires", allowed)
+
+	for i := 0; i < 3; i++ {
+		tracker.RecordFailure(ip, phone)
+	}
+	retryAfter, allowed = tracker.Allow(ip, phone)
+	check("second lockout doubles the backoff", !allowed && retryAfter > 100*time.Millisecond && retryAfter <= 200*time.Millisecond)
+
+	time.Sleep(210 * time.Millisecond)
+	tracker.RecordSuccess(phone)
+	tracker.RecordFailure(ip, phone)
+	_, allowed = tracker.Allow(ip, phone)
+	check("successful login clears failures", allowed)
+
+	ipTracker := services.NewLoginAttemptTracker(config.LoginLimits{
+		MaxFailuresPerIdentifier: 100,
+		MaxFailuresPerIP:         2,
+		FailureWindow:            time.Minute,
+		LockoutBase:              time.Minute,
+		LockoutMax:               time.Hour,
+	})
+	ipTracker.RecordFailure(ip, "9800000001")
+	ipTracker.RecordFailure(ip, "9800000002")
+	_, allowed = ipTracker.Allow(ip, "9800000003")
+	check("IP locked after failures across phone numbers", !allowed)
+	_, allowed = ipTracker.Allow("10.0.0.2", "9800000003")
+	check("other IPs unaffected", allowed)
+}
+
+// testLoginRateLimit checks the per-IP request limit and the Retry-After duration
+func testLoginRateLimit() {
+	colors.PrintSubHeader("Login Rate Limit")
+
+	tracker := services.NewLoginAttemptTracker(config.LoginLimits{
+		MaxFailuresPerIdentifier: 100,
+		MaxFailuresPerIP:         100,
+		MaxRequestsPerMinute:     2,
+		FailureWindow:            time.Minute,
+		LockoutBase:              time.Minute,
+		LockoutMax:               time.Hour,
+	})
+
+	_, first := tracker.Allow("10.0.0.1", "9800000000")
+	_, second := tracker.Allow("10.0.0.1", "9800000001")
+	retryAfter, third := tracker.Allow("10.0.0.1", "9800000002")
+	check("requests within the limit allowed", first && second)
+	check("request over the limit rejected", !third)
+	check("retry after ends with the minute window", retryAfter > 59*time.Second && retryAfter <= time.Minute)
+}
+
+// testWebSocketOrigin checks the WS_ALLOWED_ORIGINS allow-list on WebSocket upgrades
+func testWebSocketOrigin() {
+	colors.PrintSubHeader("WebSocket Origin Allow-List")
+
+	upgradeFrom := func(origin string) bool {
+		req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return server.CheckWebSocketOrigin(req)
+	}
+
+	os.Unsetenv("WS_ALLOWED_ORIGINS")
+	check("any origin allowed without an allow-list", upgradeFrom("https://evil.example.net"))
+
+	os.Setenv("WS_ALLOWED_ORIGINS", "https://app.example.com, https://admin.example.com/")
+	defer os.Unsetenv("WS_ALLOWED_ORIGINS")
+	check("listed origin allowed", upgradeFrom("https://app.example.com"))
+	check("listed origin matched despite case and trailing slash", upgradeFrom("https://ADMIN.example.com"))
+	check("unlisted origin rejected", !upgradeFrom("https://evil.example.net"))
+	check("origin on another port rejected", !upgradeFrom("https://app.example.com:8443"))
+	check("request without an Origin header allowed", upgradeFrom(""))
+}
+
+// testRequestID checks that the X-Request-ID header round-trips and tags request log lines
+func testRequestID() {
+	colors.PrintSubHeader("Request ID")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.RequestIDMiddleware())
+	router.GET("/ping", func(c *gin.Context) {
+		middleware.RequestLogger(c).PrintInfo("handling ping")
+		c.Status(http.StatusOK)
+	})
+
+	send := func(requestID string) (string, string) {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if requestID != "" {
+			req.Header.Set(middleware.RequestIDHeader, requestID)
+		}
+		recorder := httptest.NewRecorder()
+		output := captureStdout(func() { router.ServeHTTP(recorder, req) })
+		return recorder.Header().Get(middleware.RequestIDHeader), output
+	}
+
+	echoed, output := send("report-1234")
+	check("client request ID echoed in the response", echoed == "report-1234")
+	check("client request ID appears in the request's log line",
+		strings.Contains(output, "[req report-1234]") && strings.Contains(output, "handling ping"))
+
+	generated, output := send("")
+	check("request ID generated when none is sent", len(generated) == 32)
+	check("generated request ID appears in the request's log line", generated != "" && strings.Contains(output, "[req "+generated+"]"))
+
+	replaced, _ := send("bad id\r\nforged line")
+	check("unsafe request ID replaced", replaced != "" && !strings.Contains(replaced, " "))
+}
+
+// captureStdout returns what fn prints to standard output
+func captureStdout(fn func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return ""
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	fn()
+	os.Stdout = stdout
+	writer.Close()
+
+	output, _ := io.ReadAll(reader)
+	reader.Close()
+	return string(output)
+}
+
+// check prints a pass/fail line for a single assertion and returns the result
+func check(desc string, ok bool) bool {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+	return ok
+}
@@ -0,0 +1,786 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/internal/tcp"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	offlineIMEI  = "0999000000000012"
+	offlineSimNo = "9800000012"
+)
+
+// Device that connects over TCP and then drops its link in the disconnect tests
+const (
+	droppedIMEI  = "0999000000000014"
+	droppedSimNo = "9800000014"
+)
+
+// loginDecoder turns "LOGIN <imei>" into a login packet and anything else into a
+// heartbeat, both needing a one-byte acknowledgement
+type loginDecoder struct{}
+
+func (loginDecoder) AddData(data []byte) ([]*protocol.DecodedPacket, error) {
+	if imei, found := strings.CutPrefix(string(data), "LOGIN "); found {
+		return []*protocol.DecodedPacket{{ProtocolName: "LOGIN", TerminalID: imei, NeedsResponse: true}}, nil
+	}
+	return []*protocol.DecodedPacket{{ProtocolName: "HEARTBEAT", NeedsResponse: true}}, nil
+}
+
+func (loginDecoder) GenerateResponse(serialNumber uint16, protocolNumber byte) []byte {
+	return []byte{0x01}
+}
+
+// Run with the race detector so unguarded map access is reported:
+//
+//	go run -race ./cmd/test-control
+func main() {
+	if err := config.InitializeTimezone(); err != nil {
+		colors.PrintError("Failed to initialize timezone: %v", err)
+		return
+	}
+
+	colors.PrintHeader("DEVICE CONTROL TESTING")
+
+	testConcurrentRegistry()
+	testDisconnectUnregisters()
+	testDisconnectFallsBackToSMS()
+	testSMSCommandText()
+	testSMSFallback()
+	testSMSFallbackHandler()
+	testCommandAvailability()
+	testCommandConfirmation()
+	testCommandConfirmationRecord()
+	testOilCommandCooldown()
+	testAuditResult()
+	testCommandBuilder()
+	testCommandReplyMatching()
+	testCommandRoundTrip()
+
+	colors.PrintSuccess("Device control testing completed!")
+}
+
+// testConcurrentRegistry registers and unregisters devices from several goroutines, as the
+// TCP server does per connection, while other goroutines read the registry like HTTP handlers
+func testConcurrentRegistry() {
+	colors.PrintSubHeader("Concurrent Register And Read")
+
+	controller := controllers.NewControlController()
+	const writers, devicesPerWriter = 8, 25
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// Readers keep querying until the writers are done
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					controller.IsConnected(deviceIMEI(0, 0))
+					controller.GetActiveConnection(deviceIMEI(1, 1))
+				}
+			}
+		}()
+	}
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for d := 0; d < devicesPerWriter; d++ {
+				client, server := net.Pipe()
+				controller.RegisterConnection(deviceIMEI(writer, d), server)
+				client.Close()
+				server.Close()
+			}
+			// Every odd device disconnects again
+			for d := 1; d < devicesPerWriter; d += 2 {
+				controller.UnregisterConnection(deviceIMEI(writer, d))
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	connected := 0
+	for w := 0; w < writers; w++ {
+		for d := 0; d < devicesPerWriter; d++ {
+			if controller.IsConnected(deviceIMEI(w, d)) {
+				connected++
+			}
+		}
+	}
+	check("Registered devices kept after concurrent access", connected == writers*((devicesPerWriter+1)/2))
+	check("Unregistered device removed", !controller.IsConnected(deviceIMEI(0, 1)))
+	check("Registered device found", controller.IsConnected(deviceIMEI(0, 0)))
+}
+
+// testDisconnectUnregisters logs a device in to a TCP server and checks that its connection
+// leaves the registry when the device drops it, but not when an older connection closes
+// after the device reconnected. No database is needed: the registration lookup fails
+// against an unreachable server and the default policy still serves the device.
+func testDisconnectUnregisters() {
+	colors.PrintSubHeader("Registry Follows Device Disconnects")
+
+	restoreDB, err := useUnreachableDB()
+	if !check("Offline database handle created", err == nil) {
+		return
+	}
+	defer restoreDB()
+
+	controller := controllers.NewControlController()
+	address, stop, err := startLoginServer(controller)
+	if !check("TCP server started", err == nil) {
+		return
+	}
+	defer stop()
+
+	first, err := loginDevice(address, droppedIMEI)
+	if !check("Device logged in", err == nil) {
+		return
+	}
+	check("Logged-in device is connected", controller.IsConnected(droppedIMEI))
+
+	second, err := loginDevice(address, droppedIMEI)
+	if !check("Device logged in again on a new connection", err == nil) {
+		first.Close()
+		return
+	}
+	first.Close()
+	time.Sleep(200 * time.Millisecond)
+	check("Closing the old connection keeps the new one registered", controller.IsConnected(droppedIMEI))
+
+	second.Close()
+	check("Device no longer connected once it drops its link", waitFor(func() bool { return !controller.IsConnected(droppedIMEI) }))
+	_, found := controller.GetActiveConnection(droppedIMEI)
+	check("No connection left to write commands to", !found)
+}
+
+// testDisconnectFallsBackToSMS connects a device in the scratch database named by
+// TEST_DATABASE_DSN, drops its link and checks that an oil cut then goes by SMS
+func testDisconnectFallsBackToSMS() {
+	colors.PrintSubHeader("SMS Fallback After Disconnect Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the disconnect fallback test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.DeviceModel{}, &models.Device{}, &models.ControlCommand{}, &models.AuditLog{}); err != nil {
+		colors.PrintError("FAIL: migrate device tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Where("target_id = ?", droppedIMEI).Delete(&models.AuditLog{})
+		conn.Where("imei = ?", droppedIMEI).Delete(&models.ControlCommand{})
+		conn.Where("imei = ?", droppedIMEI).Delete(&models.Device{})
+	}
+	cleanup()
+	defer cleanup()
+	device := models.Device{IMEI: droppedIMEI, SimNo: droppedSimNo, SimOperator: models.SimOperatorNcell, Protocol: models.ProtocolGT06}
+	if err := conn.Create(&device).Error; err != nil {
+		colors.PrintError("FAIL: create test device: %v", err)
+		return
+	}
+
+	controller := controllers.NewControlController()
+	sender := &stubSMSSender{}
+	controller.SetSMSCommandSender(sender)
+	address, stop, err := startLoginServer(controller)
+	if !check("TCP server started", err == nil) {
+		return
+	}
+	defer stop()
+
+	deviceConn, err := loginDevice(address, droppedIMEI)
+	if !check("Device logged in over TCP", err == nil && controller.IsConnected(droppedIMEI)) {
+		return
+	}
+	deviceConn.Close()
+	check("Device disconnected", waitFor(func() bool { return !controller.IsConnected(droppedIMEI) }))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	admin := &models.User{ID: 4242, Name: "Audit Admin", Role: models.UserRoleAdmin}
+	router.POST("/control/quick-cut-imei/:imei", func(c *gin.Context) { c.Set("user", admin) }, controller.QuickCutOil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/control/quick-cut-imei/"+droppedIMEI, nil))
+	var response controllers.ControlResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	check("Oil cut for the dropped device sent by SMS", recorder.Code == http.StatusAccepted && response.Channel == "sms")
+	check("SMS went to the device's SIM", len(sender.simNos) == 1 && sender.simNos[0] == droppedSimNo)
+}
+
+// useUnreachableDB points the database at a server that refuses connections, so lookups fail
+// quickly instead of panicking on a nil handle; the returned func restores the previous one
+func useUnreachableDB() (restore func(), err error) {
+	unreachable, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1 user=none dbname=none sslmode=disable connect_timeout=1"}),
+		&gorm.Config{DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, err
+	}
+	previousDB := db.DB
+	db.DB = unreachable
+	return func() { db.DB = previousDB }, nil
+}
+
+// startLoginServer runs a TCP server speaking the login test protocol on a free port
+func startLoginServer(controller *controllers.ControlController) (address string, stop func(), err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	tcp.RegisterDecoderFactory("test-login", func() tcp.PacketDecoder { return loginDecoder{} })
+	listenerConfigs, err := tcp.ParseListenerConfigs(port + ":test-login")
+	if err != nil {
+		return "", nil, err
+	}
+	server := tcp.NewServerWithListeners(listenerConfigs, controller)
+	go server.Start()
+
+	stop = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}
+	return "127.0.0.1:" + port, stop, nil
+}
+
+// loginDevice connects to the server, logs in as imei and waits for the acknowledgement
+func loginDevice(address, imei string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	for i := 0; i < 20; i++ {
+		if conn, err = net.DialTimeout("tcp", address, time.Second); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn.Write([]byte("LOGIN " + imei))
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	return conn, nil
+}
+
+// waitFor polls condition for up to two seconds
+func waitFor(condition func() bool) bool {
+	for i := 0; i < 40; i++ {
+		if condition() {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return condition()
+}
+
+// stubSMSSender records the commands it is asked to send instead of sending them
+type stubSMSSender struct {
+	simNos   []string
+	commands []string
+	err      error
+}
+
+// SendCommand records the command
+func (s *stubSMSSender) SendCommand(simNo, command string) error {
+	s.simNos = append(s.simNos, simNo)
+	s.commands = append(s.commands, command)
+	return s.err
+}
+
+// testSMSCommandText checks the text message form of the control commands
+func testSMSCommandText() {
+	colors.PrintSubHeader("SMS Command Text")
+
+	check("Oil cut carries the password", protocol.SMSCommand(protocol.CmdCutOil, "000000") == "DYD,000000#")
+	check("Location request carries the password", protocol.SMSCommand(protocol.CmdLocation, "123456") == "DWXX,123456#")
+	check("Empty password sends the command unchanged", protocol.SMSCommand(protocol.CmdConnectOil, "") == "HFYD#")
+}
+
+// testSMSFallback checks that a command to a device without a TCP connection goes to the SMS sender
+func testSMSFallback() {
+	colors.PrintSubHeader("SMS Fallback For Disconnected Device")
+
+	controller := controllers.NewControlController()
+	controller.SetSMSCommandSender(nil)
+	device := &models.Device{IMEI: offlineIMEI, SimNo: offlineSimNo}
+
+	_, err := controller.SendCommandBySMS(device, protocol.CmdCutOil)
+	check("Fallback unavailable without a sender", errors.Is(err, controllers.ErrSMSFallbackUnavailable))
+
+	sender := &stubSMSSender{}
+	controller.SetSMSCommandSender(sender)
+	check("Device has no TCP connection", !controller.IsConnected(offlineIMEI))
+
+	response, err := controller.SendCommandBySMS(device, protocol.CmdCutOil)
+	check("Command routed to the SMS sender", err == nil && len(sender.commands) == 1 && sender.commands[0] == protocol.CmdCutOil)
+	check("SMS sent to the device's SIM", len(sender.simNos) == 1 && sender.simNos[0] == offlineSimNo)
+	check("Response reports the command as sent", response != nil && response.Success && response.DeviceIMEI == offlineIMEI)
+
+	_, err = controller.SendCommandBySMS(&models.Device{IMEI: offlineIMEI}, protocol.CmdLocation)
+	check("Device without a SIM number cannot use the fallback", errors.Is(err, controllers.ErrSMSFallbackUnavailable) && len(sender.commands) == 1)
+
+	sender.err = errors.New("gateway down")
+	_, err = controller.SendCommandBySMS(device, protocol.CmdLocation)
+	check("Gateway errors are returned", err != nil && !errors.Is(err, controllers.ErrSMSFallbackUnavailable))
+}
+
+// testSMSFallbackHandler sends an oil cut through the HTTP handler for a device in the scratch
+// database named by TEST_DATABASE_DSN and checks that it is answered by the SMS fallback
+func testSMSFallbackHandler() {
+	colors.PrintSubHeader("SMS Fallback Through Handler Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the handler fallback test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.DeviceModel{}, &models.Device{}, &models.ControlCommand{}, &models.AuditLog{}); err != nil {
+		colors.PrintError("FAIL: migrate device tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Where("target_id = ?", offlineIMEI).Delete(&models.AuditLog{})
+		conn.Where("imei = ?", offlineIMEI).Delete(&models.ControlCommand{})
+		conn.Where("imei = ?", offlineIMEI).Delete(&models.Device{})
+	}
+	cleanup()
+	defer cleanup()
+	device := models.Device{IMEI: offlineIMEI, SimNo: offlineSimNo, SimOperator: models.SimOperatorNcell, Protocol: models.ProtocolGT06}
+	if err := conn.Create(&device).Error; err != nil {
+		colors.PrintError("FAIL: create test device: %v", err)
+		return
+	}
+
+	controller := controllers.NewControlController()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	admin := &models.User{ID: 4242, Name: "Audit Admin", Role: models.UserRoleAdmin}
+	router.POST("/control/quick-cut-imei/:imei", func(c *gin.Context) { c.Set("user", admin) }, controller.QuickCutOil)
+
+	request := func() (int, controllers.ControlResponse) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/control/quick-cut-imei/"+offlineIMEI, nil))
+		var response controllers.ControlResponse
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response
+	}
+
+	controller.SetSMSCommandSender(nil)
+	code, _ := request()
+	check("Disconnected device unavailable without the fallback", code == http.StatusServiceUnavailable)
+
+	sender := &stubSMSSender{}
+	controller.SetSMSCommandSender(sender)
+	code, response := request()
+	check("Oil cut accepted by SMS", code == http.StatusAccepted && response.Channel == "sms")
+
+	code, _ = request()
+	check("Repeated oil cut rejected during the cooldown", code == http.StatusTooManyRequests && len(sender.commands) == 1)
+	check("SMS stub received the oil cut for the device's SIM", len(sender.commands) == 1 &&
+		sender.commands[0] == protocol.CmdCutOil && sender.simNos[0] == offlineSimNo)
+
+	var recorded models.ControlCommand
+	err = conn.Where("imei = ?", offlineIMEI).First(&recorded).Error
+	check("SMS command recorded as pending", err == nil && recorded.Channel == "sms" && recorded.Status == models.ControlCommandPending)
+
+	var audits []models.AuditLog
+	err = conn.Where("action = ? AND target_id = ?", models.AuditActionOilCut, offlineIMEI).Order("id").Find(&audits).Error
+	check("Every oil cut attempt audited", err == nil && len(audits) == 3)
+	if len(audits) == 3 {
+		check("Accepted oil cut audited as success with its actor", audits[1].Result == models.AuditResultSuccess &&
+			audits[1].ActorID != nil && *audits[1].ActorID == admin.ID && audits[1].ActorRole == admin.Role.String())
+		check("Unavailable and cooled-down oil cuts audited as failed and rejected",
+			audits[0].Result == models.AuditResultFailed && audits[2].Result == models.AuditResultRejected)
+	}
+}
+
+// testCommandAvailability checks the availability reported for connected and disconnected devices
+func testCommandAvailability() {
+	colors.PrintSubHeader("Command Availability")
+
+	controller := controllers.NewControlController()
+	controller.SetSMSCommandSender(nil)
+	device := &models.Device{IMEI: offlineIMEI, SimNo: offlineSimNo}
+	lastSeen := time.Now().Add(-10 * time.Minute)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	controller.RegisterConnection(offlineIMEI, server)
+	availability := controller.GetCommandAvailability(device, &lastSeen)
+	check("Connected device can receive commands over TCP", availability.TCPConnected &&
+		availability.CanSendCommand && availability.Channel == "tcp")
+	check("Connected since is reported", availability.ConnectedSince != nil && time.Since(*availability.ConnectedSince) < time.Minute)
+	check("Last seen is passed through", availability.LastSeen != nil && availability.LastSeen.Equal(lastSeen))
+
+	controller.UnregisterConnection(offlineIMEI)
+	server.Close()
+	availability = controller.GetCommandAvailability(device, nil)
+	check("Disconnected device cannot receive commands without the fallback", !availability.TCPConnected &&
+		!availability.CanSendCommand && availability.Channel == "" && availability.ConnectedSince == nil)
+	check("SMS fallback reported as not configured", !availability.SMSFallback)
+
+	controller.SetSMSCommandSender(&stubSMSSender{})
+	availability = controller.GetCommandAvailability(device, nil)
+	check("Disconnected device reachable by SMS when configured", availability.SMSFallback &&
+		availability.CanSendCommand && availability.Channel == "sms")
+
+	availability = controller.GetCommandAvailability(&models.Device{IMEI: offlineIMEI}, nil)
+	check("Device without a SIM number is not reachable by SMS", !availability.SMSFallback && !availability.CanSendCommand)
+
+	// A device that drops its TCP link is no longer reported as reachable over TCP
+	restoreDB, err := useUnreachableDB()
+	if !check("Offline database handle created", err == nil) {
+		return
+	}
+	defer restoreDB()
+	tcpController := controllers.NewControlController()
+	tcpController.SetSMSCommandSender(&stubSMSSender{})
+	address, stop, err := startLoginServer(tcpController)
+	if !check("TCP server started", err == nil) {
+		return
+	}
+	defer stop()
+
+	droppedDevice := &models.Device{IMEI: droppedIMEI, SimNo: droppedSimNo}
+	deviceConn, err := loginDevice(address, droppedIMEI)
+	if !check("Device logged in over TCP", err == nil) {
+		return
+	}
+	availability = tcpController.GetCommandAvailability(droppedDevice, nil)
+	check("Logged-in device reachable over TCP", availability.TCPConnected && availability.Channel == "tcp")
+
+	deviceConn.Close()
+	check("Device disconnected", waitFor(func() bool { return !tcpController.IsConnected(droppedIMEI) }))
+	availability = tcpController.GetCommandAvailability(droppedDevice, nil)
+	check("Disconnected device reported reachable by SMS, not TCP", !availability.TCPConnected &&
+		availability.ConnectedSince == nil && availability.CanSendCommand && availability.Channel == "sms")
+}
+
+// testCommandConfirmation simulates commands followed by status packets and checks the outcome
+func testCommandConfirmation() {
+	colors.PrintSubHeader("Command Confirmation From Status Packets")
+
+	sentAt := time.Now()
+	cut := &models.ControlCommand{Command: protocol.CmdCutOil, ExpectedOilElectricity: services.ExpectedOilElectricity(protocol.CmdCutOil),
+		Status: models.ControlCommandPending, SentAt: sentAt}
+	check("Oil cut expects DISCONNECTED", cut.ExpectedOilElectricity == "DISCONNECTED")
+	check("Oil connect expects CONNECTED", services.ExpectedOilElectricity(protocol.CmdConnectOil) == "CONNECTED")
+	check("Location request is not tracked", services.ExpectedOilElectricity(protocol.CmdLocation) == "")
+
+	_, decided := services.EvaluateControlCommand(cut, "CONNECTED", sentAt.Add(-time.Second))
+	check("Status packet received before the command is ignored", !decided)
+	_, decided = services.EvaluateControlCommand(cut, "", sentAt.Add(time.Minute))
+	check("Status packet without oil/electricity state is ignored", !decided)
+
+	status, decided := services.EvaluateControlCommand(cut, "DISCONNECTED", sentAt.Add(time.Minute))
+	check("Matching status packet confirms the cut", decided && status == models.ControlCommandConfirmed)
+	status, decided = services.EvaluateControlCommand(cut, "CONNECTED", sentAt.Add(time.Minute))
+	check("Unchanged state fails the cut", decided && status == models.ControlCommandFailed)
+}
+
+// testCommandConfirmationRecord records an oil cut in the scratch database named by
+// TEST_DATABASE_DSN, sends the confirming status packet and checks the record and user notification
+func testCommandConfirmationRecord() {
+	colors.PrintSubHeader("Command Confirmation Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the confirmation test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.Vehicle{}, &models.ControlCommand{}); err != nil {
+		colors.PrintError("FAIL: migrate control command table: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Where("imei = ?", offlineIMEI).Delete(&models.ControlCommand{})
+	}
+	cleanup()
+	defer cleanup()
+
+	var notified []*services.InAppNotification
+	services.SetInAppNotifier(func(userID uint, notification *services.InAppNotification) {
+		if userID == 42 {
+			notified = append(notified, notification)
+		}
+	})
+	defer services.SetInAppNotifier(nil)
+
+	requestedBy := uint(42)
+	first, _ := services.RecordControlCommand(offlineIMEI, protocol.CmdConnectOil, "tcp", &requestedBy)
+	cut, err := services.RecordControlCommand(offlineIMEI, protocol.CmdCutOil, "tcp", &requestedBy)
+	if err != nil || first == nil || cut == nil {
+		colors.PrintError("FAIL: record control commands: %v", err)
+		return
+	}
+
+	services.ConfirmControlCommands(offlineIMEI, "DISCONNECTED", time.Now())
+
+	var stored models.ControlCommand
+	conn.First(&stored, cut.ID)
+	check("Cut confirmed by the status packet", stored.Status == models.ControlCommandConfirmed &&
+		stored.ObservedOilElectricity == "DISCONNECTED" && stored.ResolvedAt != nil)
+	conn.First(&stored, first.ID)
+	check("Earlier pending command superseded", stored.Status == models.ControlCommandSuperseded)
+	check("User notified of the confirmation", len(notified) == 1 && notified[0].Type == "control_command" &&
+		notified[0].Data["status"] == models.ControlCommandConfirmed)
+}
+
+// testOilCommandCooldown checks that a second oil command sent right after the first is rejected
+func testOilCommandCooldown() {
+	colors.PrintSubHeader("Oil Command Cooldown")
+
+	controller := controllers.NewControlController()
+	controller.SetCommandCooldown(200 * time.Millisecond)
+
+	check("First oil cut accepted", controller.ReserveOilCommand(offlineIMEI, protocol.CmdCutOil) == nil)
+	repeated := controller.ReserveOilCommand(offlineIMEI, protocol.CmdCutOil)
+	check("Repeated oil cut rejected", repeated != nil && !repeated.Conflicting && repeated.Previous == protocol.CmdCutOil)
+	check("Rejection says when to retry", repeated != nil && repeated.RetryAfter > 0 && repeated.RetryAfterSeconds() == 1)
+	conflicting := controller.ReserveOilCommand(offlineIMEI, protocol.CmdConnectOil)
+	check("Conflicting connect right after a cut rejected", conflicting != nil && conflicting.Conflicting)
+
+	check("Other devices are not affected", controller.ReserveOilCommand(deviceIMEI(9, 9), protocol.CmdConnectOil) == nil)
+	check("Location requests are not limited", controller.ReserveOilCommand(offlineIMEI, protocol.CmdLocation) == nil &&
+		controller.ReserveOilCommand(offlineIMEI, protocol.CmdLocation) == nil)
+
+	time.Sleep(250 * time.Millisecond)
+	check("Connect accepted after the cooldown", controller.ReserveOilCommand(offlineIMEI, protocol.CmdConnectOil) == nil)
+
+	controller.SetCommandCooldown(0)
+	check("Zero cooldown disables the limit", controller.ReserveOilCommand(offlineIMEI, protocol.CmdConnectOil) == nil)
+}
+
+// deviceIMEI builds a 16-digit IMEI for a writer's device
+func deviceIMEI(writer, device int) string {
+	return fmt.Sprintf("55%07d%07d", writer, device)
+}
+
+// testAuditResult checks how response statuses map to audit results
+func testAuditResult() {
+	colors.PrintSubHeader("Audit Results")
+
+	check("2xx audited as success", services.AuditResultForStatus(http.StatusAccepted) == models.AuditResultSuccess)
+	check("403 audited as rejected", services.AuditResultForStatus(http.StatusForbidden) == models.AuditResultRejected)
+	check("429 audited as rejected", services.AuditResultForStatus(http.StatusTooManyRequests) == models.AuditResultRejected)
+	check("5xx audited as failed", services.AuditResultForStatus(http.StatusBadGateway) == models.AuditResultFailed)
+}
+
+// testCommandBuilder checks the 0x80 frames built for server commands, their serial numbers
+// and the server flag each command is given
+func testCommandBuilder() {
+	colors.PrintSubHeader("Command Frames")
+
+	builder := protocol.NewCommandBuilder()
+	frame, flag, err := builder.Build(protocol.CmdCutOil)
+	check("Command built", err == nil)
+
+	// 7878 | length | 80 | command length | server flag | DYD# | language | serial | CRC | 0D0A
+	want := fmt.Sprintf("7878108008%08X44594423", flag) + "00020001"
+	got := fmt.Sprintf("%X", frame)
+	check(fmt.Sprintf("Frame layout %s", got), len(frame) == 21 && got[:len(want)] == want && got[len(got)-4:] == "0D0A")
+
+	frame, second, _ := builder.Build(protocol.CmdLocation)
+	check("Next command takes the next serial", len(frame) > 6 && frame[len(frame)-6] == 0 && frame[len(frame)-5] == 2)
+	check("Next command has its own server flag", second != flag)
+	check("Both commands pending", builder.PendingCount() == 2)
+
+	_, _, err = builder.Build(strings.Repeat("X", protocol.MaxCommandContent+1))
+	check("Command too long for one frame rejected", errors.Is(err, protocol.ErrCommandTooLong))
+	check("Rejected command not left pending", builder.PendingCount() == 2)
+}
+
+// commandReplyFrame builds a device's 0x15 answer to a server command. The serial is the
+// device's own packet serial; the flag is the server flag echoed from the command.
+func commandReplyFrame(serial uint16, flag uint32, content string) []byte {
+	body := []byte{byte(4 + len(content))}
+	body = binary.BigEndian.AppendUint32(body, flag)
+	body = append(body, content...)
+	body = append(body, 0x00, 0x02) // English
+
+	frame := []byte{0x78, 0x78, byte(1 + len(body) + 2 + 2), protocol.ProtocolTerminal}
+	frame = append(frame, body...)
+	frame = append(frame, byte(serial>>8), byte(serial), 0x00, 0x00, 0x0D, 0x0A)
+	return frame
+}
+
+// decodeReply decodes a single reply frame
+func decodeReply(frame []byte) *protocol.DecodedPacket {
+	packets, err := protocol.NewGT06Decoder().AddData(frame)
+	if err != nil || len(packets) != 1 {
+		return nil
+	}
+	return packets[0]
+}
+
+// testCommandReplyMatching checks that decoded replies are matched to their command by the
+// echoed server flag, whatever serial the device numbers them with
+func testCommandReplyMatching() {
+	colors.PrintSubHeader("Command Reply Matching")
+
+	reply := decodeReply(commandReplyFrame(0x0102, 0x01020304, "DYD=Success!"))
+	check("Reply decoded", reply != nil && reply.ProtocolName == "STRING_INFO")
+	if reply == nil {
+		return
+	}
+	check("Reply content decoded", reply.CommandReply == "DYD=Success!")
+	check("Full reply serial decoded", reply.SerialNumber == 0x0102)
+	check("Server flag decoded", reply.ServerFlag != nil && *reply.ServerFlag == 0x01020304)
+
+	builder := protocol.NewCommandBuilder()
+	_, cutFlag, _ := builder.Build(protocol.CmdCutOil)
+	_, locationFlag, _ := builder.Build(protocol.CmdLocation)
+
+	// Answers arrive out of order, numbered with the device's own serials
+	matched, ok := builder.MatchReply(decodeReply(commandReplyFrame(0x0040, locationFlag, "Lat:N27.7")))
+	check("Location reply matched to the location command", ok && matched.Command == protocol.CmdLocation &&
+		matched.Content == "Lat:N27.7" && matched.Flag == locationFlag)
+	matched, ok = builder.MatchReply(decodeReply(commandReplyFrame(0x0041, cutFlag, "DYD=Success!")))
+	check("Cut reply matched to the cut command", ok && matched.Command == protocol.CmdCutOil)
+
+	// Replies that arrive before anyone waits are kept for the waiter
+	waited, err := builder.WaitForReply(cutFlag, 50*time.Millisecond)
+	check("Reply matched before waiting is returned", err == nil && waited.Content == "DYD=Success!")
+	builder.WaitForReply(locationFlag, 50*time.Millisecond)
+
+	_, ok = builder.MatchReply(decodeReply(commandReplyFrame(0x0042, cutFlag, "DYD=Success!")))
+	check("Repeated reply not matched twice", !ok)
+	_, ok = builder.MatchReply(decodeReply(commandReplyFrame(0x0043, cutFlag+100, "DYD=Success!")))
+	check("Reply with an unknown server flag not matched", !ok)
+
+	_, otherFlag, _ := builder.Build(protocol.CmdConnectOil)
+	_, earlierFlag, _ := protocol.NewCommandBuilder().Build(protocol.CmdConnectOil)
+	if earlierFlag != otherFlag {
+		_, ok = builder.MatchReply(decodeReply(commandReplyFrame(1, earlierFlag, "HFYD=Success!")))
+		check("Reply to another connection's command not matched", !ok)
+	}
+
+	gpsPacket := &protocol.DecodedPacket{Protocol: 0x12, ServerFlag: &otherFlag}
+	_, ok = builder.MatchReply(gpsPacket)
+	check("Non-reply packet not matched", !ok)
+
+	start := time.Now()
+	_, err = builder.WaitForReply(otherFlag, 50*time.Millisecond)
+	check("Unanswered command times out", errors.Is(err, protocol.ErrCommandReplyTimeout) && time.Since(start) < time.Second)
+	_, ok = builder.MatchReply(decodeReply(commandReplyFrame(0x0044, otherFlag, "HFYD=Success!")))
+	check("Late reply after the timeout not matched", !ok)
+	check("No commands left pending", builder.PendingCount() == 0)
+
+	controller := controllers.NewControlController()
+	check("Reply from an unregistered device not delivered", !controller.DeliverCommandReply(offlineIMEI, reply))
+}
+
+// testCommandRoundTrip sends a cut-oil command over a pipe to a fake device whose reply is
+// passed back the way the TCP reader does, after an unrelated stale reply
+func testCommandRoundTrip() {
+	colors.PrintSubHeader("Command Round Trip")
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	builder := protocol.NewCommandBuilder()
+	builder.Build(protocol.CmdLocation) // Serial 1 is taken by an earlier command
+	tracker := protocol.NewGPSTrackerController(server, "0999000000000013", builder)
+
+	received := make(chan []byte, 1)
+	go func() {
+		buffer := make([]byte, 64)
+		n, err := client.Read(buffer)
+		if err != nil {
+			received <- nil
+			return
+		}
+		frame := buffer[:n]
+		received <- frame
+		flag := binary.BigEndian.Uint32(frame[5:9])
+		serial := uint16(frame[len(frame)-6])<<8 | uint16(frame[len(frame)-5])
+		// The stale reply carries the command's serial but not its flag
+		builder.MatchReply(decodeReply(commandReplyFrame(serial, flag+5, "DYD=Fail!")))
+		builder.MatchReply(decodeReply(commandReplyFrame(0x0200, flag, "DYD=Success!")))
+	}()
+
+	response, err := tracker.CutOilAndElectricity()
+	frame := <-received
+	check("Command written to the connection", len(frame) > 6 && frame[3] == protocol.ProtocolServer)
+	check("Command sent with serial 2", len(frame) > 6 && frame[len(frame)-6] == 0 && frame[len(frame)-5] == 2)
+	check("Reply matched by server flag, stale reply ignored", err == nil && response.Success && response.Response == "DYD=Success!")
+}
+
+// check prints a PASS or FAIL line for one expectation and returns the result
+func check(desc string, ok bool) bool {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+	return ok
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func main() {
+	colors.PrintHeader("DATABASE CONFIGURATION TESTING")
+
+	testPoolConfig()
+	testReadReplicaRouting()
+	testGPSDataIndexes()
+	testReplayDeduplication()
+
+	colors.PrintSuccess("Database configuration testing completed!")
+}
+
+// testPoolConfig checks that pool settings are read from the environment and applied.
+// The connection is never pinged, so no database server is needed.
+func testPoolConfig() {
+	colors.PrintSubHeader("Connection Pool")
+
+	defaults := config.GetDatabaseConfig()
+	check("Default max open connections is 25", defaults.MaxOpenConns == 25)
+	check("Default max connection lifetime is 30m", defaults.ConnMaxLifetime == 30*time.Minute)
+
+	os.Setenv("DB_MAX_OPEN_CONNS", "7")
+	os.Setenv("DB_MAX_IDLE_CONNS", "3")
+	os.Setenv("DB_CONN_MAX_LIFETIME", "5m")
+	dbConfig := config.GetDatabaseConfig()
+	check("DB_MAX_OPEN_CONNS read", dbConfig.MaxOpenConns == 7)
+	check("DB_MAX_IDLE_CONNS read", dbConfig.MaxIdleConns == 3)
+	check("DB_CONN_MAX_LIFETIME read", dbConfig.ConnMaxLifetime == 5*time.Minute)
+
+	os.Setenv("DB_CONN_MAX_LIFETIME", "soon")
+	check("Invalid lifetime falls back to default", config.GetDatabaseConfig().ConnMaxLifetime == 30*time.Minute)
+
+	conn, err := openUnpinged(dbConfig.GetDSN())
+	if err != nil {
+		colors.PrintError("FAIL: open connection pool: %v", err)
+		return
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		colors.PrintError("FAIL: access connection pool: %v", err)
+		return
+	}
+	defer sqlDB.Close()
+
+	db.ApplyPoolConfig(sqlDB, dbConfig)
+	stats := db.NewPoolStats(sqlDB.Stats())
+	check("Max open connections applied to the pool", stats.MaxOpen == 7)
+	check("Pool starts without open connections", stats.Open == 0 && stats.InUse == 0)
+}
+
+// testReadReplicaRouting checks that read-only queries go to the replica only when one is configured
+func testReadReplicaRouting() {
+	colors.PrintSubHeader("Read Replica Routing")
+
+	primary, err := openUnpinged("host=primary.invalid dbname=luna_iot")
+	if err != nil {
+		colors.PrintError("FAIL: open primary handle: %v", err)
+		return
+	}
+	replica, err := openUnpinged("host=replica.invalid dbname=luna_iot")
+	if err != nil {
+		colors.PrintError("FAIL: open replica handle: %v", err)
+		return
+	}
+
+	db.DB = primary
+	db.ReadDB = nil
+	check("Without a replica reads use the primary", db.GetReadDB() == primary)
+
+	db.ReadDB = replica
+	check("With a replica reads use the replica", db.GetReadDB() == replica)
+	check("With a replica writes still use the primary", db.GetDB() == primary)
+
+	db.DB = nil
+	db.ReadDB = nil
+
+	os.Setenv("DB_READ_DSN", "host=replica.invalid dbname=luna_iot")
+	check("DB_READ_DSN read", config.GetDatabaseConfig().ReadDSN == "host=replica.invalid dbname=luna_iot")
+}
+
+// testGPSDataIndexes runs the migrations against a scratch database named by
+// TEST_DATABASE_DSN and checks that the latest-row lookups use the new indexes
+func testGPSDataIndexes() {
+	colors.PrintSubHeader("GPS Data Indexes")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the index test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	defer func() { db.DB = nil }()
+
+	if err := db.RunMigrations(); err != nil {
+		colors.PrintError("FAIL: run migrations: %v", err)
+		return
+	}
+
+	for _, name := range []string{"idx_gps_data_imei_timestamp", "idx_gps_data_imei_timestamp_location"} {
+		var count int64
+		conn.Raw("SELECT COUNT(*) FROM pg_indexes WHERE tablename = 'gps_data' AND indexname = ?", name).Scan(&count)
+		check("Index "+name+" exists after migration", count == 1)
+	}
+
+	lookups := []struct {
+		desc  string
+		index string
+		query string
+	}{
+		{
+			desc:  "Latest row lookup uses the (imei, timestamp) index",
+			index: "idx_gps_data_imei_timestamp",
+			query: "SELECT * FROM gps_data WHERE imei = '0999000000000001' ORDER BY timestamp DESC LIMIT 1",
+		},
+		{
+			desc:  "Latest location lookup uses the partial location index",
+			index: "idx_gps_data_imei_timestamp_location",
+			query: "SELECT * FROM gps_data WHERE imei = '0999000000000001' AND latitude IS NOT NULL AND longitude IS NOT NULL ORDER BY timestamp DESC LIMIT 1",
+		},
+	}
+	for _, lookup := range lookups {
+		var plan []string
+		// The test table is tiny, so rule out sequential scans to see which index the planner picks
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SET LOCAL enable_seqscan = off").Error; err != nil {
+				return err
+			}
+			return tx.Raw("EXPLAIN " + lookup.query).Scan(&plan).Error
+		})
+		check(lookup.desc, err == nil && strings.Contains(strings.Join(plan, "\n"), "using "+lookup.index+" "))
+	}
+}
+
+// replayIMEI is the device whose frames the replay deduplication test saves
+const replayIMEI = "0999000000000041"
+
+// testReplayDeduplication saves the same frame twice against a scratch database named by
+// TEST_DATABASE_DSN and checks that the replay is ignored and only one row is stored
+func testReplayDeduplication() {
+	colors.PrintSubHeader("GPS Replay Deduplication")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the replay deduplication test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	defer func() { db.DB = nil }()
+
+	if err := db.RunMigrations(); err != nil {
+		colors.PrintError("FAIL: run migrations: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Where("imei = ?", replayIMEI).Delete(&models.DrivingEvent{})
+		conn.Unscoped().Where("imei = ?", replayIMEI).Delete(&models.GPSData{})
+	}
+	cleanup()
+	defer cleanup()
+
+	lat, lng, speed := 27.7172, 85.3240, 40
+	frame := func(protocolName string) *models.GPSData {
+		return &models.GPSData{
+			IMEI:         replayIMEI,
+			Timestamp:    time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC),
+			ProtocolName: protocolName,
+			Latitude:     &lat,
+			Longitude:    &lng,
+			Speed:        &speed,
+			Ignition:     "ON",
+		}
+	}
+	countRows := func() int64 {
+		var count int64
+		conn.Model(&models.GPSData{}).Where("imei = ?", replayIMEI).Count(&count)
+		return count
+	}
+
+	store := services.DatabaseIngestionStore(config.GetDrivingEventConfig())
+	inserted, err := store.Save(frame("GPS_LBS"))
+	check("First frame inserted", err == nil && inserted)
+	inserted, err = store.Save(frame("GPS_LBS"))
+	check("Replayed frame ignored without an error", err == nil && !inserted)
+	check("Only one row stored for the replayed frame", countRows() == 1)
+
+	inserted, err = store.Save(frame("STATUS_INFO"))
+	check("Frame with another protocol at the same time inserted", err == nil && inserted)
+	check("Frames of different protocols both stored", countRows() == 2)
+}
+
+// openUnpinged creates a gorm handle without connecting to the server
+func openUnpinged(dsn string) (*gorm.DB, error) {
+	return gorm.Open(postgres.New(postgres.Config{DSN: dsn}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Default.LogMode(logger.Silent),
+	})
+}
+
+// check prints a PASS or FAIL line for one expectation
+func check(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"luna_iot_server/internal/db"
+	lunahttp "luna_iot_server/internal/http"
+	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const imei = "0123456789012345"
+
+// loginFrame is a standard 0x7878 login frame for the watched device
+const loginFrame = "78780D01" + "0123456789012345" + "0001" + "0000" + "0D0A"
+
+// statusFrame is a standard 0x13 status frame: terminal info 46 | voltage 04 | GSM 03 | alarm/language 0102
+const statusFrame = "78780A13" + "46" + "04" + "03" + "0102" + "0001" + "0000" + "0D0A"
+
+func main() {
+	colors.PrintHeader("PACKET DEBUG STREAM TESTING")
+
+	testRegistry()
+	testWebSocketStream()
+	testRedecodeRawPacket()
+	testRedecodeRecent()
+
+	colors.PrintSuccess("Packet debug stream testing completed!")
+}
+
+// testRegistry checks subscription bookkeeping without a network connection
+func testRegistry() {
+	colors.PrintSubHeader("Subscriber Registry")
+
+	stream := lunahttp.NewPacketDebugStream()
+	check("no subscribers initially", !stream.HasSubscribers(imei))
+
+	// Publishing with nobody watching must be a no-op
+	stream.Publish(imei, "test", map[string]string{"protocolName": "LOGIN"})
+
+	subscriber := stream.Subscribe(imei)
+	check("subscriber registered", stream.HasSubscribers(imei))
+	check("other devices unaffected", !stream.HasSubscribers("9999999999999999"))
+
+	stream.Publish("9999999999999999", "test", map[string]string{"protocolName": "LOGIN"})
+	select {
+	case <-subscriber.Messages():
+		check("packets of other devices not delivered", false)
+	default:
+		check("packets of other devices not delivered", true)
+	}
+
+	// A subscriber that never reads loses packets instead of blocking the TCP server
+	for i := 0; i < 100; i++ {
+		stream.Publish(imei, "test", map[string]int{"n": i})
+	}
+	check("full buffer drops packets without blocking", subscriber.Dropped() > 0)
+
+	stream.Unsubscribe(subscriber)
+	check("subscriber removed", !stream.HasSubscribers(imei))
+	stream.Unsubscribe(subscriber)
+	check("unsubscribing twice is harmless", !stream.HasSubscribers(imei))
+}
+
+// testWebSocketStream subscribes over a real WebSocket and receives a decoded packet
+func testWebSocketStream() {
+	colors.PrintSubHeader("WebSocket Stream")
+
+	stream := lunahttp.NewPacketDebugStream()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Authentication is covered by HandleDebugWebSocket; this serves the stream directly
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		lunahttp.ServeDebugStream(conn, stream, r.URL.Query().Get("imei"))
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/debug?imei=" + imei
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !check("connected to debug stream", err == nil) {
+		colors.PrintError("Dial failed: %v", err)
+		return
+	}
+
+	if !check("subscribed after connecting", waitFor(func() bool { return stream.HasSubscribers(imei) })) {
+		conn.Close()
+		return
+	}
+
+	frame, _ := hex.DecodeString(loginFrame)
+	packets, err := protocol.NewGT06Decoder().AddData(frame)
+	if !check("decoded a login packet", err == nil && len(packets) == 1) {
+		conn.Close()
+		return
+	}
+	stream.Publish(imei, "192.0.2.10:5000", packets[0])
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if check("received a message", err == nil) {
+		var received struct {
+			Type string `json:"type"`
+			Data struct {
+				IMEI       string                 `json:"imei"`
+				RemoteAddr string                 `json:"remote_addr"`
+				Packet     protocol.DecodedPacket `json:"packet"`
+			} `json:"data"`
+		}
+		err := json.Unmarshal(message, &received)
+		check("message is a debug packet", err == nil && received.Type == "debug_packet")
+		check("message names the device", received.Data.IMEI == imei && received.Data.RemoteAddr == "192.0.2.10:5000")
+		check("decoded packet delivered", received.Data.Packet.ProtocolName == "LOGIN" && received.Data.Packet.TerminalID == imei)
+	}
+
+	conn.Close()
+	check("unsubscribed after disconnecting", waitFor(func() bool { return !stream.HasSubscribers(imei) }))
+}
+
+// testRedecodeRawPacket re-decodes stored hex frames, good and corrupt
+func testRedecodeRawPacket() {
+	colors.PrintSubHeader("Re-decode Stored Frame")
+
+	packets, err := services.RedecodeRawPacket(loginFrame)
+	check("stored login frame re-decoded", err == nil && len(packets) == 1 && packets[0].TerminalID == imei)
+
+	_, err = services.RedecodeRawPacket("7878ZZ")
+	check("non-hex stored frame reported as an error", err != nil)
+
+	packets, err = services.RedecodeRawPacket("78780D01")
+	check("truncated stored frame decodes to nothing", err == nil && len(packets) == 0)
+}
+
+// testRedecodeRecent seeds raw packets for a device in the scratch database named by
+// TEST_DATABASE_DSN and re-decodes them through the admin endpoint
+func testRedecodeRecent() {
+	colors.PrintSubHeader("Re-decode Recent Packets Endpoint")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the re-decode endpoint test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.DeviceModel{}, &models.Device{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate device tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Where("imei = ?", imei).Delete(&models.GPSData{})
+		conn.Where("imei = ?", imei).Delete(&models.Device{})
+	}
+	cleanup()
+	defer cleanup()
+
+	if err := conn.Create(&models.Device{IMEI: imei, SimNo: "9800000099", SimOperator: models.SimOperatorNcell, Protocol: models.ProtocolGT06}).Error; err != nil {
+		colors.PrintError("FAIL: create test device: %v", err)
+		return
+	}
+	now := time.Now()
+	for i, raw := range []string{loginFrame, "", statusFrame, loginFrame} {
+		row := models.GPSData{IMEI: imei, Timestamp: now.Add(time.Duration(i) * time.Second), ProtocolName: "SEEDED", RawPacket: raw}
+		if err := conn.Create(&row).Error; err != nil {
+			colors.PrintError("FAIL: seed raw packet: %v", err)
+			return
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/admin/devices/:imei/decode-recent", controllers.NewMaintenanceController().RedecodeRecentPackets)
+
+	request := func(path string) (int, []services.RedecodedPacket) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		var response struct {
+			Data []services.RedecodedPacket `json:"data"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response.Data
+	}
+
+	code, results := request("/admin/devices/" + imei + "/decode-recent?n=2")
+	check("last 2 raw packets returned", code == http.StatusOK && len(results) == 2)
+	if len(results) == 2 {
+		check("newest packet first", results[0].RawPacket == loginFrame && results[1].RawPacket == statusFrame)
+		check("login frame re-decoded", len(results[0].Decoded) == 1 && results[0].Decoded[0].ProtocolName == "LOGIN")
+		check("status frame re-decoded", len(results[1].Decoded) == 1 && results[1].Decoded[0].OilElectricity != "")
+	}
+
+	code, results = request("/admin/devices/" + imei + "/decode-recent")
+	check("rows without a raw packet skipped", code == http.StatusOK && len(results) == 3)
+
+	code, _ = request("/admin/devices/" + imei + "/decode-recent?n=0")
+	check("n below 1 rejected", code == http.StatusBadRequest)
+
+	code, _ = request("/admin/devices/9999999999999999/decode-recent")
+	check("unknown device not found", code == http.StatusNotFound)
+}
+
+// waitFor polls the condition for up to two seconds
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return condition()
+}
+
+// check prints a PASS or FAIL line for one expectation and returns the result
+func check(desc string, ok bool) bool {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+	return ok
+}
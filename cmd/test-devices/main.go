@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/internal/tcp"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testIMEI  = "0999000000000011"
+	testSimNo = "9800000011"
+	testICCID = "8997701000000000011"
+
+	// Registered by the unregistered device connection test; 0999000000000013 never is
+	policyIMEI = "0999000000000012"
+)
+
+func main() {
+	if err := config.InitializeTimezone(); err != nil {
+		colors.PrintError("Failed to initialize timezone: %v", err)
+		return
+	}
+
+	colors.PrintHeader("DEVICE SIM TESTING")
+
+	testSimValidation()
+	testSimLookup()
+	testUnregisteredDevicePolicy()
+	testUnregisteredDeviceConnections()
+
+	colors.PrintSuccess("Device SIM testing completed!")
+}
+
+// testSimValidation checks which SIM numbers and ICCIDs are accepted
+func testSimValidation() {
+	colors.PrintSubHeader("SIM Number And ICCID Validation")
+
+	for _, simNo := range []string{"9801234567", "+9779801234567", "014412345"} {
+		check("SIM number "+quote(simNo)+" accepted", models.IsValidSimNumber(simNo))
+	}
+	for _, simNo := range []string{"", "980123", "98012345678901234", "98O1234567", "+", "977+9801234567"} {
+		check("SIM number "+quote(simNo)+" rejected", !models.IsValidSimNumber(simNo))
+	}
+	check("Spaces and dashes stripped from SIM number", models.NormalizeSimNumber(" +977 980-123-4567 ") == "+9779801234567")
+
+	for _, iccid := range []string{"", "897701000000000001", "8997701000000000011", "89977010000000000112"} {
+		check("ICCID "+quote(iccid)+" accepted", models.IsValidICCID(iccid))
+	}
+	for _, iccid := range []string{"1997701000000000011", "89977010000", "899770100000000001123", "8997701000000000O11"} {
+		check("ICCID "+quote(iccid)+" rejected", !models.IsValidICCID(iccid))
+	}
+	check("Spaces stripped from ICCID", models.NormalizeICCID("8997 7010 0000 0000 011") == testICCID)
+}
+
+// testSimLookup creates, updates and looks up a device by SIM number in the scratch
+// database named by TEST_DATABASE_DSN
+func testSimLookup() {
+	colors.PrintSubHeader("SIM Lookup Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the SIM lookup test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.DeviceModel{}, &models.Device{}); err != nil {
+		colors.PrintError("FAIL: migrate device tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Where("imei = ? OR sim_no = ?", testIMEI, testSimNo).Delete(&models.Device{})
+	}
+	cleanup()
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	deviceController := controllers.NewDeviceController()
+	router := gin.New()
+	router.POST("/devices", deviceController.CreateDevice)
+	router.PUT("/devices/:id", deviceController.UpdateDevice)
+	router.GET("/devices/sim/:sim_no", deviceController.GetDeviceBySIM)
+
+	send := func(method, path, body string) (int, models.Device) {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(recorder, request)
+		var response struct {
+			Data models.Device `json:"data"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response.Data
+	}
+
+	code, _ := send(http.MethodPost, "/devices",
+		`{"imei":"`+testIMEI+`","sim_no":"98-0000","sim_operator":"Ncell"}`)
+	check("Create with an invalid SIM number rejected", code == http.StatusBadRequest)
+
+	code, _ = send(http.MethodPost, "/devices",
+		`{"imei":"`+testIMEI+`","sim_no":"`+testSimNo+`","sim_operator":"Ncell","iccid":"12345"}`)
+	check("Create with an invalid ICCID rejected", code == http.StatusBadRequest)
+
+	code, created := send(http.MethodPost, "/devices",
+		`{"imei":"`+testIMEI+`","sim_no":"980 000 0011","sim_operator":"Ncell","iccid":"8997 7010 0000 0000 011"}`)
+	check("Device created with SIM and ICCID", code == http.StatusCreated)
+	check("SIM number and ICCID stored normalized", created.SimNo == testSimNo && created.ICCID == testICCID)
+
+	code, found := send(http.MethodGet, "/devices/sim/"+testSimNo, "")
+	check("Device found by SIM number", code == http.StatusOK && found.IMEI == testIMEI)
+
+	code, _ = send(http.MethodGet, "/devices/sim/9800000012", "")
+	check("Unknown SIM number not found", code == http.StatusNotFound)
+
+	code, _ = send(http.MethodGet, "/devices/sim/not-a-number", "")
+	check("Malformed SIM number rejected", code == http.StatusBadRequest)
+
+	devicePath := "/devices/" + strconv.FormatUint(uint64(created.ID), 10)
+	code, _ = send(http.MethodPut, devicePath, `{"sim_no":"12"}`)
+	check("Update with an invalid SIM number rejected", code == http.StatusBadRequest)
+
+	code, _ = send(http.MethodPut, devicePath, `{"sim_no":"+977 9800000012"}`)
+	check("SIM number updated", code == http.StatusOK)
+	code, found = send(http.MethodGet, "/devices/sim/+9779800000012", "")
+	check("Device found by its new SIM number", code == http.StatusOK && found.IMEI == testIMEI)
+}
+
+// testUnregisteredDevicePolicy checks how each policy treats a device that logs in
+func testUnregisteredDevicePolicy() {
+	colors.PrintSubHeader("Unregistered Device Policy")
+
+	check("Lenient by default", config.GetTCPConfig().UnregisteredDevicePolicy == config.UnregisteredDevicePolicyAccept)
+	os.Setenv("UNREGISTERED_DEVICE_POLICY", "Reject")
+	check("Policy read from env", config.GetTCPConfig().UnregisteredDevicePolicy == config.UnregisteredDevicePolicyReject)
+	os.Setenv("UNREGISTERED_DEVICE_POLICY", "drop")
+	check("Unknown policy falls back to accept", config.GetTCPConfig().UnregisteredDevicePolicy == config.UnregisteredDevicePolicyAccept)
+	os.Unsetenv("UNREGISTERED_DEVICE_POLICY")
+
+	cases := []struct {
+		policy     string
+		registered bool
+		serving    bool
+		keepOpen   bool
+	}{
+		{config.UnregisteredDevicePolicyAccept, false, true, true},
+		{config.UnregisteredDevicePolicyIgnore, false, false, true},
+		{config.UnregisteredDevicePolicyReject, false, false, false},
+		{config.UnregisteredDevicePolicyIgnore, true, true, true},
+		{config.UnregisteredDevicePolicyReject, true, true, true},
+	}
+	for _, tc := range cases {
+		serving, keepOpen := tcp.LoginResponse(tc.policy, tc.registered)
+		check("Policy "+tc.policy+" registered="+strconv.FormatBool(tc.registered)+": served="+
+			strconv.FormatBool(tc.serving)+" kept open="+strconv.FormatBool(tc.keepOpen),
+			serving == tc.serving && keepOpen == tc.keepOpen)
+	}
+}
+
+// loginDecoder turns "LOGIN <imei>" into a login packet and anything else into a
+// heartbeat, both needing a one-byte acknowledgement
+type loginDecoder struct{}
+
+func (loginDecoder) AddData(data []byte) ([]*protocol.DecodedPacket, error) {
+	text := string(data)
+	if imei, found := strings.CutPrefix(text, "LOGIN "); found {
+		return []*protocol.DecodedPacket{{ProtocolName: "LOGIN", TerminalID: imei, NeedsResponse: true}}, nil
+	}
+	return []*protocol.DecodedPacket{{ProtocolName: "HEARTBEAT", NeedsResponse: true}}, nil
+}
+
+func (loginDecoder) GenerateResponse(serialNumber uint16, protocolNumber byte) []byte {
+	return []byte{0x01}
+}
+
+// testUnregisteredDeviceConnections logs a registered and an unregistered device in to a
+// TCP server under the lenient and strict policies, against the scratch database named by
+// TEST_DATABASE_DSN
+func testUnregisteredDeviceConnections() {
+	colors.PrintSubHeader("Unregistered Device Connections")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the unregistered device connection test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.DeviceModel{}, &models.Device{}); err != nil {
+		colors.PrintError("FAIL: migrate device tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Where("imei = ?", policyIMEI).Delete(&models.Device{})
+	}
+	cleanup()
+	defer cleanup()
+	if err := conn.Create(&models.Device{IMEI: policyIMEI, SimNo: "9800000020", SimOperator: models.SimOperatorNcell}).Error; err != nil {
+		colors.PrintError("FAIL: create registered device: %v", err)
+		return
+	}
+
+	tcp.RegisterDecoderFactory("test-login", func() tcp.PacketDecoder { return loginDecoder{} })
+
+	// login connects a device, logs it in and sends a heartbeat, reporting which of the
+	// two were acknowledged and whether the server closed the connection
+	login := func(policy, imei string) (loginAcked, heartbeatAcked, closed bool) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return false, false, false
+		}
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		listener.Close()
+
+		os.Setenv("UNREGISTERED_DEVICE_POLICY", policy)
+		listenerConfigs, _ := tcp.ParseListenerConfigs(port + ":test-login")
+		server := tcp.NewServerWithListeners(listenerConfigs, controllers.NewControlController())
+		os.Unsetenv("UNREGISTERED_DEVICE_POLICY")
+		go server.Start()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Stop(ctx)
+		}()
+
+		var device net.Conn
+		for i := 0; i < 20; i++ {
+			if device, err = net.DialTimeout("tcp", "127.0.0.1:"+port, time.Second); err == nil {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if err != nil {
+			return false, false, false
+		}
+		defer device.Close()
+
+		// read waits briefly for an acknowledgement; a timeout means none was sent
+		read := func() (acked, closed bool) {
+			device.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+			_, err := device.Read(make([]byte, 1))
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return false, false
+			}
+			return err == nil, err != nil
+		}
+
+		device.Write([]byte("LOGIN " + imei))
+		loginAcked, closed = read()
+		if closed {
+			return loginAcked, false, true
+		}
+		device.Write([]byte("PING"))
+		heartbeatAcked, closed = read()
+		return loginAcked, heartbeatAcked, closed
+	}
+
+	const unregisteredIMEI = "0999000000000013"
+
+	loginAcked, heartbeatAcked, closed := login(config.UnregisteredDevicePolicyAccept, unregisteredIMEI)
+	check("Lenient: unregistered device acknowledged and kept", loginAcked && heartbeatAcked && !closed)
+
+	loginAcked, heartbeatAcked, closed = login(config.UnregisteredDevicePolicyIgnore, unregisteredIMEI)
+	check("Ignore: unregistered device gets no acknowledgements", !loginAcked && !heartbeatAcked && !closed)
+
+	loginAcked, _, closed = login(config.UnregisteredDevicePolicyReject, unregisteredIMEI)
+	check("Strict: unregistered device disconnected at login", !loginAcked && closed)
+
+	loginAcked, heartbeatAcked, closed = login(config.UnregisteredDevicePolicyReject, policyIMEI)
+	check("Strict: registered device still served", loginAcked && heartbeatAcked && !closed)
+}
+
+// quote wraps a value in quotes for test descriptions
+func quote(value string) string {
+	return `"` + value + `"`
+}
+
+// check prints a PASS or FAIL line for one expectation
+func check(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"math"
+	"os"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testIMEI = "0999000000000002"
+
+// safetyIMEI is the vehicle used by the driver safety test in the scratch database
+const safetyIMEI = "0999000000000003"
+
+func main() {
+	if err := config.InitializeTimezone(); err != nil {
+		colors.PrintError("Failed to initialize timezone: %v", err)
+		return
+	}
+
+	colors.PrintHeader("DRIVER ASSIGNMENT TESTING")
+
+	testTripAttribution()
+	testDriverFilter()
+	testAssignDriver()
+	testHarshDrivingDetection()
+	testDriverSafety()
+
+	colors.PrintSuccess("Driver assignment testing completed!")
+}
+
+// testTripAttribution checks which driver a trip is credited to
+func testTripAttribution() {
+	colors.PrintSubHeader("Trip Attribution")
+
+	day := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	shiftChange := day.Add(12 * time.Hour)
+	assignments := []models.VehicleDriverAssignment{
+		{DriverID: 1, StartTime: day.Add(6 * time.Hour), EndTime: &shiftChange, Driver: models.Driver{ID: 1, Name: "Morning"}},
+		{DriverID: 2, StartTime: shiftChange, Driver: models.Driver{ID: 2, Name: "Evening"}},
+	}
+
+	trip := services.AttributeTrip(assignments, day.Add(8*time.Hour), day.Add(9*time.Hour))
+	check("Trip inside a shift goes to that driver", trip != nil && trip.Driver.Name == "Morning")
+
+	trip = services.AttributeTrip(assignments, day.Add(11*time.Hour), day.Add(14*time.Hour))
+	check("Trip across a shift change goes to the driver with most of it", trip != nil && trip.Driver.Name == "Evening")
+
+	trip = services.AttributeTrip(assignments, day.Add(20*time.Hour), day.Add(20*time.Hour))
+	check("Single-point trip goes to the driver assigned then", trip != nil && trip.Driver.Name == "Evening")
+
+	trip = services.AttributeTrip(assignments, day.Add(2*time.Hour), day.Add(3*time.Hour))
+	check("Trip with no driver assigned is unattributed", trip == nil)
+}
+
+// testDriverFilter checks that a driver filter keeps only the rows from their shifts
+func testDriverFilter() {
+	colors.PrintSubHeader("Driver Filter")
+
+	day := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	shiftChange := day.Add(12 * time.Hour)
+	assignments := []models.VehicleDriverAssignment{
+		{DriverID: 1, StartTime: day.Add(6 * time.Hour), EndTime: &shiftChange},
+		{DriverID: 2, StartTime: shiftChange},
+	}
+
+	var gpsData []models.GPSData
+	for hour := 0; hour < 24; hour += 2 {
+		gpsData = append(gpsData, models.GPSData{Timestamp: day.Add(time.Duration(hour) * time.Hour)})
+	}
+
+	morning := services.FilterByDriver(gpsData, assignments, 1)
+	check("Morning driver gets rows from 06:00 up to the 12:00 change", len(morning) == 3 &&
+		morning[0].Timestamp.Hour() == 6 && morning[2].Timestamp.Hour() == 10)
+
+	evening := services.FilterByDriver(gpsData, assignments, 2)
+	check("Evening driver gets rows from 12:00 on", len(evening) == 6 && evening[0].Timestamp.Hour() == 12)
+}
+
+// testAssignDriver assigns drivers in a scratch database named by TEST_DATABASE_DSN and
+// checks that a new assignment ends the previous one and a trip is attributed to it
+func testAssignDriver() {
+	colors.PrintSubHeader("Assign Driver Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the assignment test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.Vehicle{}, &models.Driver{}, &models.VehicleDriverAssignment{}); err != nil {
+		colors.PrintError("FAIL: migrate driver tables: %v", err)
+		return
+	}
+
+	vehicle := models.Vehicle{IMEI: testIMEI, RegNo: "TEST-DRIVER-1", Name: "Driver test", VehicleType: models.VehicleTypeCar}
+	conn.Where("imei = ?", testIMEI).Delete(&models.Vehicle{})
+	if err := conn.Create(&vehicle).Error; err != nil {
+		colors.PrintError("FAIL: create test vehicle: %v", err)
+		return
+	}
+	first := models.Driver{Name: "First driver"}
+	second := models.Driver{Name: "Second driver"}
+	conn.Create(&first)
+	conn.Create(&second)
+	defer func() {
+		conn.Where("vehicle_id = ?", testIMEI).Delete(&models.VehicleDriverAssignment{})
+		conn.Delete(&models.Driver{}, []uint{first.ID, second.ID})
+		conn.Where("imei = ?", testIMEI).Delete(&models.Vehicle{})
+	}()
+
+	start := time.Now().Add(-4 * time.Hour).Truncate(time.Second)
+	change := start.Add(2 * time.Hour)
+	if _, err := services.AssignDriver(testIMEI, first.ID, 0, start); err != nil {
+		colors.PrintError("FAIL: assign first driver: %v", err)
+		return
+	}
+	if _, err := services.AssignDriver(testIMEI, second.ID, 0, change); err != nil {
+		colors.PrintError("FAIL: assign second driver: %v", err)
+		return
+	}
+
+	current, _ := services.GetDriverAssignments(second.ID, false)
+	check("Second driver is the current driver", len(current) == 1 && current[0].VehicleID == testIMEI)
+	ended, _ := services.GetDriverAssignments(first.ID, false)
+	check("First driver's assignment ended at the change", len(ended) == 0)
+
+	assignments, err := services.GetVehicleAssignments([]string{testIMEI}, start, time.Now())
+	if err != nil {
+		colors.PrintError("FAIL: load assignments: %v", err)
+		return
+	}
+	trip := services.AttributeTrip(assignments[testIMEI], start.Add(30*time.Minute), start.Add(90*time.Minute))
+	check("Trip during the first shift is attributed to the first driver", trip != nil && trip.DriverID == first.ID)
+
+	if _, err := services.UnassignDriver(testIMEI, time.Now()); err != nil {
+		colors.PrintError("FAIL: unassign driver: %v", err)
+		return
+	}
+	_, err = services.UnassignDriver(testIMEI, time.Now())
+	check("Unassigning twice reports no driver assigned", err == services.ErrNoDriverAssigned)
+}
+
+// testHarshDrivingDetection feeds speed sequences through the detector
+func testHarshDrivingDetection() {
+	colors.PrintSubHeader("Harsh Driving Detection")
+
+	cfg := &config.DrivingEventConfig{HarshBrakingKmh: 12, HarshAccelerationKmh: 12, Window: 3 * time.Second}
+	start := time.Now().Truncate(time.Second)
+	lat, lng := 27.7172, 85.3240
+	fix := func(offset time.Duration, speed int) *models.GPSData {
+		return &models.GPSData{IMEI: safetyIMEI, Timestamp: start.Add(offset), Speed: &speed, Latitude: &lat, Longitude: &lng}
+	}
+
+	// Cruising at 50 km/h, then a sharp stop from 48 to 20 km/h in 2 seconds
+	sequence := []*models.GPSData{fix(0, 50), fix(time.Second, 48), fix(3*time.Second, 20), fix(4*time.Second, 15)}
+	var events []*models.DrivingEvent
+	for i := 1; i < len(sequence); i++ {
+		if event := services.DetectDrivingEvent(sequence[i-1], sequence[i], cfg); event != nil {
+			events = append(events, event)
+		}
+	}
+	check("Sharp deceleration gives one event", len(events) == 1)
+	if len(events) == 1 {
+		event := events[0]
+		check("Event is harsh braking", event.Type == models.DrivingEventHarshBraking)
+		check("Event spans 48 to 20 km/h in 2 s", event.StartSpeed == 48 && event.EndSpeed == 20 && event.Seconds == 2)
+		check("Deceleration is about -3.9 m/s²", math.Abs(event.Acceleration-(-28.0/3.6/2)) < 0.001)
+		check("Event is placed at the later fix", event.Timestamp.Equal(sequence[2].Timestamp) && event.Latitude != nil)
+	}
+
+	check("Same drop over 10 s is not harsh", services.DetectDrivingEvent(fix(0, 48), fix(10*time.Second, 20), cfg) == nil)
+	check("Drop of exactly the threshold is not harsh", services.DetectDrivingEvent(fix(0, 32), fix(time.Second, 20), cfg) == nil)
+
+	launch := services.DetectDrivingEvent(fix(0, 0), fix(2*time.Second, 25), cfg)
+	check("Rapid speed-up is harsh acceleration", launch != nil && launch.Type == models.DrivingEventHarshAcceleration && launch.Acceleration > 0)
+
+	disabled := &config.DrivingEventConfig{HarshBrakingKmh: 0, HarshAccelerationKmh: 12, Window: 3 * time.Second}
+	check("Zero threshold disables braking events", services.DetectDrivingEvent(fix(0, 60), fix(time.Second, 10), disabled) == nil)
+
+	statusOnly := fix(time.Second, 0)
+	statusOnly.Latitude, statusOnly.Longitude = nil, nil
+	stop := services.DetectDrivingEvent(fix(0, 30), statusOnly, cfg)
+	check("Stop without coordinates takes the previous position", stop != nil && stop.Latitude != nil && *stop.Latitude == lat)
+}
+
+// testDriverSafety ingests a drive with a harsh stop in a scratch database named by
+// TEST_DATABASE_DSN and checks the event is stored once and counted for its driver
+func testDriverSafety() {
+	colors.PrintSubHeader("Driver Safety Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the driver safety test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.Vehicle{}, &models.Driver{}, &models.VehicleDriverAssignment{},
+		&models.GPSData{}, &models.DrivingEvent{}); err != nil {
+		colors.PrintError("FAIL: migrate driver safety tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Where("imei = ?", safetyIMEI).Delete(&models.DrivingEvent{})
+		conn.Where("imei = ?", safetyIMEI).Delete(&models.GPSData{})
+		conn.Where("vehicle_id = ?", safetyIMEI).Delete(&models.VehicleDriverAssignment{})
+		conn.Where("imei = ?", safetyIMEI).Delete(&models.Vehicle{})
+	}
+	cleanup()
+	defer cleanup()
+
+	vehicle := models.Vehicle{IMEI: safetyIMEI, RegNo: "TEST-DRIVER-2", Name: "Safety test", VehicleType: models.VehicleTypeCar}
+	if err := conn.Create(&vehicle).Error; err != nil {
+		colors.PrintError("FAIL: create test vehicle: %v", err)
+		return
+	}
+	driver := models.Driver{Name: "Safety driver"}
+	conn.Create(&driver)
+	defer conn.Delete(&driver)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if _, err := services.AssignDriver(safetyIMEI, driver.ID, 0, start); err != nil {
+		colors.PrintError("FAIL: assign driver: %v", err)
+		return
+	}
+
+	// About 1.1 km north at 50 km/h, then a stop from 50 to 10 km/h in 2 seconds
+	cfg := &config.DrivingEventConfig{HarshBrakingKmh: 12, HarshAccelerationKmh: 12, Window: 3 * time.Second}
+	speeds := []int{50, 50, 50, 10}
+	offsets := []time.Duration{10 * time.Minute, 10*time.Minute + 40*time.Second, 10*time.Minute + 80*time.Second, 10*time.Minute + 82*time.Second}
+	var recorded []*models.DrivingEvent
+	for i := range speeds {
+		lat, lng, speed := 27.7000+float64(i)*0.0033, 85.3240, speeds[i]
+		row := models.GPSData{IMEI: safetyIMEI, Timestamp: start.Add(offsets[i]), Latitude: &lat, Longitude: &lng,
+			Speed: &speed, Ignition: "ON"}
+		if err := conn.Create(&row).Error; err != nil {
+			colors.PrintError("FAIL: create test GPS data: %v", err)
+			return
+		}
+		event, err := services.RecordDrivingEvent(&row, cfg)
+		if err != nil {
+			colors.PrintError("FAIL: record driving event: %v", err)
+			return
+		}
+		if event != nil {
+			recorded = append(recorded, event)
+		}
+		if i == len(speeds)-1 {
+			replayed, _ := services.RecordDrivingEvent(&row, cfg)
+			check("Replayed frame does not store the event twice", replayed == nil)
+		}
+	}
+	check("Harsh stop recorded during ingestion", len(recorded) == 1 && recorded[0].Type == models.DrivingEventHarshBraking)
+
+	events, err := services.GetDrivingEvents(safetyIMEI, start, time.Now(), "")
+	check("Vehicle lists one driving event", err == nil && len(events) == 1)
+
+	summary, err := services.GetDriverSafetySummary(driver.ID, start, time.Now(), config.DefaultMovingSpeedKmh)
+	if err != nil {
+		colors.PrintError("FAIL: summarize driver safety: %v", err)
+		return
+	}
+	check("Driver is credited one harsh braking", summary.HarshBraking == 1 && summary.HarshAcceleration == 0)
+	check("Driver drove about 1.1 km", summary.DistanceKm > 1 && summary.DistanceKm < 1.2)
+	check("Rate is about 90 events per 100 km", summary.EventsPer100Km > 80 && summary.EventsPer100Km < 100)
+}
+
+// check prints a PASS or FAIL line for one expectation
+func check(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countingResolver answers every lookup with the same address and counts the lookups
+type countingResolver struct {
+	lookups int
+	err     error
+}
+
+func (r *countingResolver) ReverseGeocode(lat, lng float64) (string, error) {
+	r.lookups++
+	if r.err != nil {
+		return "", r.err
+	}
+	return "Durbar Marg, Kathmandu", nil
+}
+
+func main() {
+	colors.PrintHeader("REVERSE GEOCODING TESTING")
+
+	testCacheHits()
+	testCacheExpiry()
+	testCacheSize()
+	testNoBackend()
+
+	colors.PrintSuccess("Reverse geocoding testing completed!")
+}
+
+// testCacheHits checks that points rounding to the same coordinate are resolved once
+func testCacheHits() {
+	colors.PrintSubHeader("Cache Hits")
+
+	backend := &countingResolver{}
+	resolver := services.NewCachingAddressResolver(backend, 4, time.Hour, 100)
+
+	address, err := resolver.ReverseGeocode(27.71720, 85.32400)
+	check("First lookup resolved by the backend", err == nil && address == "Durbar Marg, Kathmandu" && backend.lookups == 1)
+	address, err = resolver.ReverseGeocode(27.71720, 85.32400)
+	check("Same point served from the cache", err == nil && address == "Durbar Marg, Kathmandu" && backend.lookups == 1)
+	resolver.ReverseGeocode(27.717204, 85.324003)
+	check("Point rounding to the same coordinate served from the cache", backend.lookups == 1)
+	resolver.ReverseGeocode(27.7180, 85.3240)
+	check("Point 90 m away resolved by the backend", backend.lookups == 2)
+
+	failing := &countingResolver{err: errors.New("geocoder down")}
+	resolver = services.NewCachingAddressResolver(failing, 4, time.Hour, 100)
+	resolver.ReverseGeocode(27.7172, 85.3240)
+	_, err = resolver.ReverseGeocode(27.7172, 85.3240)
+	check("Failed lookups are not cached", err != nil && failing.lookups == 2)
+}
+
+// testCacheExpiry checks that an address is resolved again once its TTL has passed
+func testCacheExpiry() {
+	colors.PrintSubHeader("Cache Expiry")
+
+	backend := &countingResolver{}
+	resolver := services.NewCachingAddressResolver(backend, 4, 50*time.Millisecond, 100)
+
+	resolver.ReverseGeocode(27.7172, 85.3240)
+	resolver.ReverseGeocode(27.7172, 85.3240)
+	check("Cached within the TTL", backend.lookups == 1)
+
+	time.Sleep(60 * time.Millisecond)
+	resolver.ReverseGeocode(27.7172, 85.3240)
+	check("Resolved again after the TTL", backend.lookups == 2)
+	resolver.ReverseGeocode(27.7172, 85.3240)
+	check("Fresh address cached again", backend.lookups == 2)
+}
+
+// testCacheSize checks that the least recently used address is dropped when the cache is full
+func testCacheSize() {
+	colors.PrintSubHeader("Cache Size")
+
+	backend := &countingResolver{}
+	resolver := services.NewCachingAddressResolver(backend, 4, time.Hour, 2)
+
+	resolver.ReverseGeocode(27.7001, 85.3001)
+	resolver.ReverseGeocode(27.7002, 85.3002)
+	resolver.ReverseGeocode(27.7001, 85.3001) // Most recently used again
+	resolver.ReverseGeocode(27.7003, 85.3003) // Drops the second point
+	check("Three points resolved by the backend", backend.lookups == 3)
+
+	resolver.ReverseGeocode(27.7001, 85.3001)
+	check("Recently used point kept", backend.lookups == 3)
+	resolver.ReverseGeocode(27.7002, 85.3002)
+	check("Least recently used point dropped", backend.lookups == 4)
+}
+
+// testNoBackend checks that without GEOCODER_PROVIDER lookups report geocoding as disabled
+// and the endpoint answers 503 instead of failing
+func testNoBackend() {
+	colors.PrintSubHeader("No Backend")
+
+	os.Unsetenv("GEOCODER_PROVIDER")
+	_, err := services.GetAddressResolver().ReverseGeocode(27.7172, 85.3240)
+	check("Lookup reports geocoding disabled", errors.Is(err, services.ErrGeocoderDisabled))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/geo/reverse", controllers.NewGeoController().ReverseGeocode)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/geo/reverse?lat=27.7172&lng=85.3240", nil))
+	check("Endpoint answers 503 without a backend", recorder.Code == http.StatusServiceUnavailable)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/geo/reverse?lat=95&lng=85.3240", nil))
+	check("Invalid latitude rejected", recorder.Code == http.StatusBadRequest)
+}
+
+// check prints a PASS or FAIL line for one expectation
+func check(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+}
@@ -1,10 +1,29 @@
 package main
 
 import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/http/controllers"
 	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/internal/services"
 	"luna_iot_server/pkg/colors"
+	"luna_iot_server/pkg/utils"
 	"math"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func main() {
@@ -64,20 +83,30 @@ func main() {
 		colors.PrintInfo("  Point %d: %.6f, %.6f", i+1, coord.lat, coord.lng)
 	}
 
-	// Simulate smoothing
-	colors.PrintInfo("Smoothed coordinates (70%% new + 30%% previous):")
-	prevLat, prevLng := originalCoords[0].lat, originalCoords[0].lng
-	colors.PrintInfo("  Point 1: %.6f, %.6f (original)", prevLat, prevLng)
+	// Simulate smoothing at several weights; a lower weight should pull points further toward the previous fix
+	for _, weight := range []float64{0.95, 0.7, 0.5} {
+		colors.PrintInfo("Smoothed coordinates (%.0f%% new + %.0f%% previous):", weight*100, (1-weight)*100)
+		prevLat, prevLng := originalCoords[0].lat, originalCoords[0].lng
+		colors.PrintInfo("  Point 1: %.6f, %.6f (original)", prevLat, prevLng)
 
-	for i := 1; i < len(originalCoords); i++ {
-		currLat, currLng := originalCoords[i].lat, originalCoords[i].lng
-		smoothedLat := 0.7*currLat + 0.3*prevLat
-		smoothedLng := 0.7*currLng + 0.3*prevLng
+		for i := 1; i < len(originalCoords); i++ {
+			currLat, currLng := originalCoords[i].lat, originalCoords[i].lng
+			smoothedLat := utils.SmoothCoordinate(weight, currLat, prevLat)
+			smoothedLng := utils.SmoothCoordinate(weight, currLng, prevLng)
 
-		colors.PrintInfo("  Point %d: %.6f, %.6f -> %.6f, %.6f",
-			i+1, currLat, currLng, smoothedLat, smoothedLng)
+			colors.PrintInfo("  Point %d: %.6f, %.6f -> %.6f, %.6f",
+				i+1, currLat, currLng, smoothedLat, smoothedLng)
 
-		prevLat, prevLng = smoothedLat, smoothedLng
+			prevLat, prevLng = smoothedLat, smoothedLng
+		}
+	}
+
+	strong := utils.SmoothCoordinate(0.5, 27.7175, 27.7172)
+	light := utils.SmoothCoordinate(0.95, 27.7175, 27.7172)
+	if strong != light {
+		colors.PrintSuccess("Smoothing weight changes output: 0.5 -> %.6f, 0.95 -> %.6f", strong, light)
+	} else {
+		colors.PrintError("Smoothing weight had no effect on output")
 	}
 
 	// Test distance calculation
@@ -141,9 +170,1304 @@ func main() {
 		}
 	}
 
+	// Test elevation statistics on a hilly track with a missing altitude reading
+	colors.PrintSubHeader("Elevation Statistics Test")
+
+	track := []*int{intPtr(1400), intPtr(1450), nil, intPtr(1420), intPtr(1500), intPtr(1480)}
+	elevation := utils.CalculateElevationStats(track)
+	colors.PrintInfo("Track altitudes: 1400, 1450, (none), 1420, 1500, 1480")
+	colors.PrintInfo("  Elevation gain: %d m (expected 130)", elevation.Gain)
+	colors.PrintInfo("  Elevation loss: %d m (expected 50)", elevation.Loss)
+	if elevation.Min != nil && elevation.Max != nil {
+		colors.PrintInfo("  Min/Max altitude: %d/%d m (expected 1400/1500)", *elevation.Min, *elevation.Max)
+	}
+
+	// Test speed cross-check: device reports 0 km/h while positions imply about 40 km/h
+	colors.PrintSubHeader("Speed Cross-Check Test")
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	// 0.2 km north in 18 seconds is 40 km/h
+	impliedSpeed, ok := utils.ImpliedSpeedKmh(27.7172, 85.3240, start, 27.7172+0.2/111.195, 85.3240, start.Add(18*time.Second))
+	colors.PrintInfo("Implied speed: %.1f km/h (expected ~40), usable=%v", impliedSpeed, ok)
+	if ok && utils.SpeedsDisagree(0, impliedSpeed) {
+		colors.PrintSuccess("Reported 0 km/h flagged, computed speed would be used")
+	} else {
+		colors.PrintError("Reported 0 km/h was not flagged")
+	}
+	if !utils.SpeedsDisagree(38, impliedSpeed) {
+		colors.PrintSuccess("Reported 38 km/h accepted as consistent")
+	} else {
+		colors.PrintError("Reported 38 km/h wrongly flagged")
+	}
+
+	// Test nearest-vehicle ranking around Kathmandu (27.7172, 85.3240)
+	colors.PrintSubHeader("Nearest Vehicles Test")
+
+	now := time.Now()
+	// One degree of latitude is about 111.195 km
+	locations := []models.GPSData{
+		gpsAt("far", 27.7172+20/111.195, 85.3240, now.Add(-5*time.Minute)),   // 20 km north
+		gpsAt("near", 27.7172+1/111.195, 85.3240, now.Add(-2*time.Minute)),   // 1 km north
+		gpsAt("middle", 27.7172-5/111.195, 85.3240, now.Add(-1*time.Minute)), // 5 km south
+		gpsAt("stale", 27.7172, 85.3240, now.Add(-3*time.Hour)),              // On the spot, but no recent fix
+		gpsAt("nofix", 0, 0, now), // No valid coordinates
+	}
+	ranked := services.RankByDistance(27.7172, 85.3240, locations, now.Add(-time.Hour), 10)
+	var order []string
+	for _, vehicle := range ranked {
+		order = append(order, vehicle.IMEI)
+		colors.PrintInfo("  %s: %.2f km", vehicle.IMEI, vehicle.DistanceKm)
+	}
+	if len(ranked) == 3 && ranked[0].IMEI == "near" && ranked[1].IMEI == "middle" && ranked[2].IMEI == "far" {
+		colors.PrintSuccess("Vehicles ordered nearest first: %v", order)
+	} else {
+		colors.PrintError("Unexpected nearest-vehicle order: %v (expected [near middle far])", order)
+	}
+	if len(ranked) == 3 && math.Abs(ranked[1].DistanceKm-5) < 0.01 {
+		colors.PrintSuccess("Distance to the 5 km vehicle computed correctly")
+	} else {
+		colors.PrintError("Distance to the 5 km vehicle is wrong")
+	}
+	if limited := services.RankByDistance(27.7172, 85.3240, locations, now.Add(-time.Hour), 2); len(limited) == 2 && limited[1].IMEI == "middle" {
+		colors.PrintSuccess("Limit keeps only the nearest vehicles")
+	} else {
+		colors.PrintError("Limit not applied to nearest vehicles")
+	}
+
+	// Test engine-hours accumulation over an ignition-on interval
+	colors.PrintSubHeader("Engine Hours Test")
+
+	engineStart := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	state := services.EngineHoursState{Hours: 100}
+	samples := []struct {
+		ignition string
+		offset   time.Duration
+	}{
+		{"OFF", 0},
+		{"ON", 10 * time.Minute},  // Engine starts
+		{"ON", 20 * time.Minute},  // +10 min
+		{"", 25 * time.Minute},    // No ignition state, ignored
+		{"ON", 30 * time.Minute},  // +10 min
+		{"ON", 25 * time.Minute},  // Replayed older frame, ignored
+		{"OFF", 40 * time.Minute}, // +10 min, engine stops
+		{"OFF", 90 * time.Minute}, // Engine off, nothing added
+	}
+	for _, sample := range samples {
+		state = services.AccumulateEngineHours(state, sample.ignition, engineStart.Add(sample.offset), services.EngineHoursMaxGap)
+	}
+	if math.Abs(state.Hours-100.5) < 1e-9 && !state.EngineOn {
+		colors.PrintSuccess("30 minutes of running added: %.2f h (expected 100.50)", state.Hours)
+	} else {
+		colors.PrintError("Wrong engine hours: %.4f h, engine on=%v (expected 100.50, off)", state.Hours, state.EngineOn)
+	}
+
+	// A device silent for 3 hours with the ignition on is credited at most the max gap
+	state = services.EngineHoursState{}
+	state = services.AccumulateEngineHours(state, "ON", engineStart, services.EngineHoursMaxGap)
+	state = services.AccumulateEngineHours(state, "ON", engineStart.Add(3*time.Hour), services.EngineHoursMaxGap)
+	if math.Abs(state.Hours-services.EngineHoursMaxGap.Hours()) < 1e-9 {
+		colors.PrintSuccess("Reporting gap capped at %v", services.EngineHoursMaxGap)
+	} else {
+		colors.PrintError("Reporting gap not capped: %.4f h", state.Hours)
+	}
+
+	// Test the playback timeline with status packets interleaved between location fixes
+	colors.PrintSubHeader("Timeline Test")
+
+	trackStart := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	previousFix := gpsAt("timeline", 27.7000, 85.3000, trackStart.Add(-time.Minute))
+	rows := []models.GPSData{
+		{IMEI: "timeline", Timestamp: trackStart, Ignition: "ON"},                                            // Status only, before any fix in range
+		gpsAt("timeline", 27.7172, 85.3240, trackStart.Add(10*time.Second)),                                  // Fix
+		{IMEI: "timeline", Timestamp: trackStart.Add(10*time.Second + 400*time.Millisecond), Ignition: "ON"}, // Status in the same second
+		{IMEI: "timeline", Timestamp: trackStart.Add(20 * time.Second), Ignition: "ON", Charger: "CONNECTED"},
+		gpsAt("timeline", 0, 0, trackStart.Add(25*time.Second)), // 0,0 is not a fix
+		gpsAt("timeline", 27.7180, 85.3250, trackStart.Add(30*time.Second)),
+		{IMEI: "timeline", Timestamp: trackStart.Add(40 * time.Second), Ignition: "OFF"},
+	}
+	timeline := services.BuildTimeline(rows, &previousFix)
+	if len(timeline) == 6 {
+		colors.PrintSuccess("Packets in the same second merged: %d points from %d rows", len(timeline), len(rows))
+	} else {
+		colors.PrintError("Wrong timeline length: %d (expected 6)", len(timeline))
+	}
+	if len(timeline) == 6 {
+		first, merged, status, zero, fix, last := timeline[0], timeline[1], timeline[2], timeline[3], timeline[4], timeline[5]
+		if first.Interpolated && *first.Latitude == 27.7000 && first.LocationTimestamp.Equal(previousFix.Timestamp) {
+			colors.PrintSuccess("First status point carries the fix from before the range")
+		} else {
+			colors.PrintError("First status point did not carry the previous fix")
+		}
+		if !merged.Interpolated && *merged.Latitude == 27.7172 && merged.Ignition == "ON" {
+			colors.PrintSuccess("Status and fix in the same second combined into one point")
+		} else {
+			colors.PrintError("Same-second status and fix not combined")
+		}
+		if status.Interpolated && *status.Latitude == 27.7172 && status.Charger == "CONNECTED" && zero.Interpolated && *zero.Latitude == 27.7172 {
+			colors.PrintSuccess("Status-only and 0,0 points carry the last valid fix")
+		} else {
+			colors.PrintError("Status-only or 0,0 point did not carry the last valid fix")
+		}
+		if !fix.Interpolated && *fix.Latitude == 27.7180 && last.Interpolated && *last.Latitude == 27.7180 && last.Ignition == "OFF" {
+			colors.PrintSuccess("Forward fill follows the newest fix")
+		} else {
+			colors.PrintError("Forward fill did not follow the newest fix")
+		}
+	}
+	if noFix := services.BuildTimeline(rows[:1], nil); len(noFix) == 1 && noFix[0].Latitude == nil && !noFix[0].Interpolated {
+		colors.PrintSuccess("Points before any known fix have no coordinates")
+	} else {
+		colors.PrintError("Point without any known fix was given coordinates")
+	}
+
+	// Test map clustering of a fleet spread over Nepal
+	colors.PrintSubHeader("Vehicle Clustering Test")
+
+	fleet := []models.GPSData{
+		gpsAt("ktm-1", 27.7172, 85.3240, now), // Kathmandu, three vehicles within a few hundred meters
+		gpsAt("ktm-2", 27.7180, 85.3250, now),
+		gpsAt("ktm-3", 27.7165, 85.3235, now),
+		gpsAt("pokhara", 28.2096, 83.9856, now),
+		gpsAt("biratnagar", 26.4525, 87.2718, now),
+		gpsAt("nofix", 0, 0, now), // No valid coordinates, never shown
+	}
+	clusterCases := []struct {
+		desc     string
+		zoom     int
+		box      services.BoundingBox
+		clusters []int // Expected vehicle count of each cluster
+		vehicles int
+	}{
+		{"Country view groups the central and western vehicles", 5, services.WorldBoundingBox, []int{4}, 1},
+		{"City view keeps only the Kathmandu vehicles together", 10, services.WorldBoundingBox, []int{3}, 2},
+		{"Street view returns every vehicle individually", services.ClusterMaxZoom, services.WorldBoundingBox, nil, 5},
+		{"Bounding box leaves out vehicles outside the view", 10, services.BoundingBox{MinLat: 27, MinLng: 83, MaxLat: 29, MaxLng: 86}, []int{3}, 1},
+	}
+	for _, tc := range clusterCases {
+		clusters, vehicles := services.ClusterLocations(fleet, tc.zoom, tc.box)
+		var counts []int
+		for _, cluster := range clusters {
+			counts = append(counts, cluster.Count)
+		}
+		if fmt.Sprint(counts) == fmt.Sprint(tc.clusters) && len(vehicles) == tc.vehicles {
+			colors.PrintSuccess("%s: clusters %v, %d individual", tc.desc, counts, len(vehicles))
+		} else {
+			colors.PrintError("%s: got clusters %v and %d individual (expected %v and %d)", tc.desc, counts, len(vehicles), tc.clusters, tc.vehicles)
+		}
+	}
+	if clusters, _ := services.ClusterLocations(fleet[:3], 10, services.WorldBoundingBox); len(clusters) == 1 &&
+		math.Abs(clusters[0].Latitude-27.7172333) < 1e-6 && math.Abs(clusters[0].Longitude-85.3241667) < 1e-6 {
+		colors.PrintSuccess("Cluster placed at the centroid of its vehicles")
+	} else {
+		colors.PrintError("Cluster centroid is wrong: %+v", clusters)
+	}
+	if box, err := services.ParseBoundingBox("80.0,26.3,88.2,30.5"); err == nil && box.MinLng == 80.0 && box.MaxLat == 30.5 {
+		colors.PrintSuccess("Bounding box parsed in minLng,minLat,maxLng,maxLat order")
+	} else {
+		colors.PrintError("Bounding box parsed wrongly: %+v, %v", box, err)
+	}
+	if _, err := services.ParseBoundingBox("88.2,26.3,80.0,30.5"); err != nil {
+		colors.PrintSuccess("Inverted bounding box rejected")
+	} else {
+		colors.PrintError("Inverted bounding box accepted")
+	}
+
+	// Test which fixes keep their coordinates under each GPS_FILTER_MODE
+	colors.PrintSubHeader("GPS Filter Mode Test")
+
+	filterCases := []struct {
+		mode     string
+		ignition string
+		speed    int
+		keep     bool
+	}{
+		{config.GPSFilterModeAll, "OFF", 0, true},
+		{config.GPSFilterModeAll, "ON", 0, true},
+		{config.GPSFilterModeIgnitionOn, "OFF", 40, false},
+		{config.GPSFilterModeIgnitionOn, "ON", 0, true},
+		{config.GPSFilterModeIgnitionOn, "", 0, true}, // Unknown ignition is not treated as off
+		{config.GPSFilterModeMoving, "OFF", 40, false},
+		{config.GPSFilterModeMoving, "ON", 4, false},
+		{config.GPSFilterModeMoving, "ON", 5, true}, // At MOVING_SPEED_KMH is moving
+		{config.GPSFilterModeMoving, "ON", 6, true},
+	}
+	for _, tc := range filterCases {
+		keep, reason := services.KeepGPSLocation(tc.mode, tc.ignition, tc.speed, config.DefaultMovingSpeedKmh)
+		if keep == tc.keep {
+			colors.PrintSuccess("mode=%s ignition=%q speed=%d: keep=%v %s", tc.mode, tc.ignition, tc.speed, keep, reason)
+		} else {
+			colors.PrintError("mode=%s ignition=%q speed=%d: keep=%v (expected %v)", tc.mode, tc.ignition, tc.speed, keep, tc.keep)
+		}
+	}
+	if config.IsValidGPSFilterMode("moving") && !config.IsValidGPSFilterMode("sometimes") {
+		colors.PrintSuccess("Unknown filter modes are rejected")
+	} else {
+		colors.PrintError("Filter mode validation is wrong")
+	}
+
+	// Test the arrival estimate for a moving and a stopped vehicle
+	colors.PrintSubHeader("ETA Test")
+
+	etaNow := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
+	destLat, destLng := 27.6710, 85.4298 // Bhaktapur
+	moving := gpsAt("ETA0000000000001", 27.7172, 85.3240, etaNow)
+	moving.Speed = intPtr(40)
+	var recentFixes []models.GPSData
+	for i, speed := range []int{30, 40, 50} {
+		fix := gpsAt("ETA0000000000001", 27.7172, 85.3240, etaNow.Add(time.Duration(i-3)*time.Minute))
+		fix.Speed = intPtr(speed)
+		recentFixes = append(recentFixes, fix)
+	}
+
+	movingETA := services.EstimateETA(moving, recentFixes, models.VehicleTypeTruck, destLat, destLng, etaNow)
+	expectedSeconds := int64(math.Round(utils.CalculateDistance(27.7172, 85.3240, destLat, destLng) / 40 * 3600))
+	if movingETA.SpeedSource == services.ETASpeedRecentAverage && movingETA.SpeedKmh == 40 &&
+		movingETA.ETASeconds == expectedSeconds && movingETA.IsEstimate {
+		colors.PrintSuccess("Moving vehicle: %.3f km at recent average %.0f km/h, ETA %ds", movingETA.DistanceKm, movingETA.SpeedKmh, movingETA.ETASeconds)
+	} else {
+		colors.PrintError("Moving vehicle ETA wrong: %+v (expected %ds at 40 km/h)", movingETA, expectedSeconds)
+	}
+	if movingETA.ArrivalTime.Equal(etaNow.Add(time.Duration(expectedSeconds) * time.Second)) {
+		colors.PrintSuccess("Arrival time is now plus the ETA")
+	} else {
+		colors.PrintError("Arrival time wrong: %v", movingETA.ArrivalTime)
+	}
+
+	// A stopped vehicle falls back to its type's typical speed, not its earlier speed
+	stopped := moving
+	stopped.Speed = intPtr(0)
+	stoppedETA := services.EstimateETA(stopped, recentFixes, models.VehicleTypeTruck, destLat, destLng, etaNow)
+	if stoppedETA.SpeedSource == services.ETASpeedTypical && stoppedETA.SpeedKmh == services.TypicalSpeedKmh[models.VehicleTypeTruck] &&
+		stoppedETA.ETASeconds > movingETA.ETASeconds {
+		colors.PrintSuccess("Stopped truck: typical %.0f km/h, ETA %ds", stoppedETA.SpeedKmh, stoppedETA.ETASeconds)
+	} else {
+		colors.PrintError("Stopped vehicle ETA wrong: %+v", stoppedETA)
+	}
+
+	arrived := services.EstimateETA(stopped, nil, models.VehicleTypeCar, 27.7172, 85.3240, etaNow)
+	if arrived.DistanceKm == 0 && arrived.ETASeconds == 0 {
+		colors.PrintSuccess("Vehicle at the destination has an ETA of 0")
+	} else {
+		colors.PrintError("Vehicle at the destination ETA wrong: %+v", arrived)
+	}
+
+	// Test route simplification: a near-straight segment collapses to its endpoints
+	colors.PrintSubHeader("Route Simplification Test")
+
+	// About 1 km east along a street with up to 3 m of sideways jitter
+	straight := []utils.Point{{Lat: 27.7172, Lng: 85.3240}}
+	for i, offset := range []float64{2, -3, 1, -2, 3, 0, -1, 2} {
+		straight = append(straight, utils.Point{Lat: 27.7172 + offset/111195, Lng: 85.3240 + float64(i+1)*0.001})
+	}
+	straight = append(straight, utils.Point{Lat: 27.7172, Lng: 85.3240 + 0.009})
+
+	kept := utils.SimplifyPath(straight, 5)
+	if len(kept) == 2 && kept[0] == 0 && kept[1] == len(straight)-1 {
+		colors.PrintSuccess("Near-straight segment: %d points simplified to the 2 endpoints at 5 m", len(straight))
+	} else {
+		colors.PrintError("Near-straight segment kept %v at 5 m (expected [0 %d])", kept, len(straight)-1)
+	}
+	if kept := utils.SimplifyPath(straight, 1); len(kept) > 2 {
+		colors.PrintSuccess("Tighter 1 m tolerance keeps %d points", len(kept))
+	} else {
+		colors.PrintError("1 m tolerance should keep the jitter, kept %v", kept)
+	}
+
+	// A right-angle turn keeps its corner
+	corner := []utils.Point{{Lat: 27.7172, Lng: 85.3240}, {Lat: 27.7172, Lng: 85.3290}, {Lat: 27.7172, Lng: 85.3340},
+		{Lat: 27.7222, Lng: 85.3340}, {Lat: 27.7272, Lng: 85.3340}}
+	if kept := utils.SimplifyPath(corner, 5); len(kept) == 3 && kept[1] == 2 {
+		colors.PrintSuccess("Right-angle turn keeps start, corner and end")
+	} else {
+		colors.PrintError("Right-angle turn simplified to %v (expected [0 2 4])", kept)
+	}
+
+	// Test trip counting: a trip starts on movement and ends when the ignition turns off
+	colors.PrintSubHeader("Trip Count Test")
+
+	tripStart := time.Date(2024, 6, 15, 8, 0, 0, 0, time.UTC)
+	tripFix := func(minute, speed int, ignition string) models.GPSData {
+		fix := gpsAt("TRIP000000000001", 27.7172, 85.3240, tripStart.Add(time.Duration(minute)*time.Minute))
+		fix.Speed = intPtr(speed)
+		fix.Ignition = ignition
+		return fix
+	}
+	day := []models.GPSData{
+		tripFix(0, 0, "ON"),  // Warming up, not a trip yet
+		tripFix(1, 30, "ON"), // Trip 1
+		tripFix(2, 0, "ON"),  // Traffic light, same trip
+		tripFix(3, 25, "ON"),
+		tripFix(4, 0, "OFF"),
+		tripFix(5, 0, "ON"), // Ignition on but never moved
+		tripFix(6, 0, "OFF"),
+		tripFix(7, 40, "ON"), // Trip 2
+	}
+	if trips := services.CountTrips(day, config.DefaultMovingSpeedKmh); trips == 2 {
+		colors.PrintSuccess("Day with a traffic light stop and an idle start has 2 trips")
+	} else {
+		colors.PrintError("Trip count is %d (expected 2)", trips)
+	}
+	if services.CountTrips(nil, config.DefaultMovingSpeedKmh) == 0 {
+		colors.PrintSuccess("No data has no trips")
+	} else {
+		colors.PrintError("No data should have no trips")
+	}
+
+	// Test that a status row is saved even when the notification check fails
+	colors.PrintSubHeader("Notification Failure Test")
+
+	statusRow := models.GPSData{IMEI: "STATUS0000000001", Ignition: "ON", Timestamp: tripStart}
+	var saved []models.GPSData
+	save := func(data *models.GPSData) (bool, error) {
+		saved = append(saved, *data)
+		return true, nil
+	}
+	failingNotify := func(*models.GPSData) error {
+		return errors.New("notification service unavailable")
+	}
+	inserted, err := services.NotifyThenSave(&statusRow, failingNotify, save)
+	if inserted && err == nil && len(saved) == 1 && saved[0].IMEI == statusRow.IMEI {
+		colors.PrintSuccess("Status row saved although the notification check failed")
+	} else {
+		colors.PrintError("Status row lost after a notification failure: inserted=%v err=%v saved=%d", inserted, err, len(saved))
+	}
+	if inserted, _ := services.NotifyThenSave(&statusRow, nil, save); inserted && len(saved) == 2 {
+		colors.PrintSuccess("Status row saved without a notification service")
+	} else {
+		colors.PrintError("Status row not saved without a notification service")
+	}
+
+	// Test that a status row without coordinates is saved at the last known location
+	colors.PrintSubHeader("Status Location Inheritance Test")
+
+	lastFix := gpsAt("STATUS0000000001", 27.7172, 85.3240, tripStart)
+	lastFix.Speed = intPtr(35)
+	lastFix.Course = intPtr(90)
+	ingestStatus := func(statusData models.GPSData, filtered, registered bool, previous *models.GPSData) []models.GPSData {
+		var statusSaved []models.GPSData
+		service := services.NewIngestionServiceWithStore(nil, services.IngestionStore{
+			IsDeviceRegistered: func(imei string) bool { return registered },
+			LastLocatedGPS:     func(imei string) *models.GPSData { return previous },
+			VehicleType:        func(imei string) string { return "" },
+			Save: func(gpsData *models.GPSData) (bool, error) {
+				statusSaved = append(statusSaved, *gpsData)
+				return true, nil
+			},
+		})
+		if _, err := service.IngestStatus(&statusData, filtered); err != nil {
+			colors.PrintError("Status row ingestion failed: %v", err)
+		}
+		return statusSaved
+	}
+
+	statusSaved := ingestStatus(models.GPSData{IMEI: "STATUS0000000001", Ignition: "ON", Timestamp: tripStart.Add(time.Minute)}, false, true, &lastFix)
+	if len(statusSaved) == 1 && statusSaved[0].Latitude != nil && *statusSaved[0].Latitude == 27.7172 &&
+		statusSaved[0].Longitude != nil && *statusSaved[0].Longitude == 85.3240 &&
+		statusSaved[0].Speed != nil && *statusSaved[0].Speed == 35 && statusSaved[0].Course != nil && *statusSaved[0].Course == 90 {
+		colors.PrintSuccess("Coordinate-less status row saved with the previous location, speed and course")
+	} else {
+		colors.PrintError("Status row did not inherit the previous location: %+v", statusSaved)
+	}
+
+	statusSaved = ingestStatus(models.GPSData{IMEI: "STATUS0000000001", Ignition: "OFF", Timestamp: tripStart.Add(time.Minute)}, true, true, &lastFix)
+	if len(statusSaved) == 1 && statusSaved[0].Latitude != nil && *statusSaved[0].Latitude == 27.7172 &&
+		statusSaved[0].Speed == nil && statusSaved[0].Course == nil {
+		colors.PrintSuccess("Filtered status row saved at the previous location without its movement")
+	} else {
+		colors.PrintError("Filtered status row did not keep the previous location alone: %+v", statusSaved)
+	}
+
+	statusSaved = ingestStatus(models.GPSData{IMEI: "STATUS0000000001", Speed: intPtr(12)}, false, true, &lastFix)
+	if len(statusSaved) == 1 && statusSaved[0].Latitude != nil && *statusSaved[0].Speed == 12 {
+		colors.PrintSuccess("Status row keeps its own speed")
+	} else {
+		colors.PrintError("Status row speed overwritten: %+v", statusSaved)
+	}
+
+	statusSaved = ingestStatus(models.GPSData{IMEI: "STATUS0000000002"}, false, true, nil)
+	if len(statusSaved) == 1 && statusSaved[0].Latitude == nil {
+		colors.PrintSuccess("Status row from a device never located saved without coordinates")
+	} else {
+		colors.PrintError("Status row without a previous fix not saved unchanged: %+v", statusSaved)
+	}
+
+	statusSaved = ingestStatus(models.GPSData{IMEI: "STATUS0000000003"}, false, false, &lastFix)
+	if len(statusSaved) == 0 {
+		colors.PrintSuccess("Status row from an unregistered device not saved")
+	} else {
+		colors.PrintError("Status row from an unregistered device saved")
+	}
+
+	located := gpsAt("STATUS0000000001", 28.2096, 83.9856, tripStart)
+	services.InheritLocation(&located, &lastFix, true)
+	if *located.Latitude == 28.2096 && located.Speed == nil {
+		colors.PrintSuccess("Rows with coordinates are left unchanged")
+	} else {
+		colors.PrintError("Location inheritance changed a row it should not have")
+	}
+
+	// Test reporting coverage over minute buckets
+	colors.PrintSubHeader("Coverage Test")
+
+	coverageStart := time.Date(2024, 6, 15, 8, 0, 0, 0, time.UTC)
+	coverageEnd := coverageStart.Add(10 * time.Minute)
+	var reports []time.Time
+	for minute := 0; minute < 10; minute += 2 {
+		// Every other minute, sometimes twice in the same minute
+		reports = append(reports, coverageStart.Add(time.Duration(minute)*time.Minute+10*time.Second))
+		if minute == 4 {
+			reports = append(reports, coverageStart.Add(time.Duration(minute)*time.Minute+50*time.Second))
+		}
+	}
+	reports = append(reports, coverageEnd, coverageStart.Add(-time.Second)) // Outside [from, to)
+
+	coverage := services.CalculateCoverage(reports, coverageStart, coverageEnd, time.Minute)
+	if coverage.TotalBuckets == 10 && coverage.ReportedBuckets == 5 && coverage.CoveragePercent == 50 {
+		colors.PrintSuccess("Device reporting in half the buckets has 50%% coverage")
+	} else {
+		colors.PrintError("Expected 5 of 10 buckets (50%%), got %d of %d (%.2f%%)", coverage.ReportedBuckets, coverage.TotalBuckets, coverage.CoveragePercent)
+	}
+	if len(coverage.Gaps) == 5 && coverage.Gaps[0].From.Equal(coverageStart.Add(time.Minute)) &&
+		coverage.Gaps[0].To.Equal(coverageStart.Add(2*time.Minute)) && coverage.Gaps[0].MissedBuckets == 1 {
+		colors.PrintSuccess("Each missed minute listed as a gap")
+	} else {
+		colors.PrintError("Unexpected gaps: %+v", coverage.Gaps)
+	}
+
+	// Reported for the first half only, over a period that ends mid-bucket
+	coverage = services.CalculateCoverage(reports[:3], coverageStart, coverageEnd.Add(30*time.Second), time.Minute)
+	if coverage.TotalBuckets == 11 && coverage.ReportedBuckets == 3 && len(coverage.Gaps) == 3 {
+		lastGap := coverage.Gaps[2]
+		if lastGap.MissedBuckets == 6 && lastGap.From.Equal(coverageStart.Add(5*time.Minute)) && lastGap.To.Equal(coverageEnd.Add(30*time.Second)) {
+			colors.PrintSuccess("Consecutive missed buckets merged into one gap ending at the period end")
+		} else {
+			colors.PrintError("Trailing gap not merged: %+v", lastGap)
+		}
+	} else {
+		colors.PrintError("Expected 3 of 11 buckets in 3 gaps, got %d of %d in %d", coverage.ReportedBuckets, coverage.TotalBuckets, len(coverage.Gaps))
+	}
+
+	empty := services.CalculateCoverage(nil, coverageStart, coverageEnd, time.Minute)
+	if empty.CoveragePercent == 0 && len(empty.Gaps) == 1 && empty.Gaps[0].MissedBuckets == 10 {
+		colors.PrintSuccess("Silent device has 0%% coverage and one gap over the whole period")
+	} else {
+		colors.PrintError("Silent device coverage wrong: %+v", empty)
+	}
+
+	// GPX export of a small track
+	colors.PrintSubHeader("GPX Export Test")
+
+	kathmandu := time.FixedZone("NPT", 5*3600+45*60)
+	exportStart := time.Date(2024, 3, 1, 8, 0, 0, 0, kathmandu)
+	exportTrack := []models.GPSData{
+		gpsAt("123456789012345", 27.7172, 85.3240, exportStart),
+		gpsAt("123456789012345", 27.7180, 85.3255, exportStart.Add(30*time.Second)),
+		gpsAt("123456789012345", 27.7191, 85.3270, exportStart.Add(time.Minute)),
+	}
+	exportTrack[0].Altitude = intPtr(1340)
+	exportTrack[2].Altitude = intPtr(1352)
+
+	gpx, err := services.RouteGPX("Bus 1 (BA 1 PA 1234)", exportTrack, exportStart.Add(time.Hour))
+	var parsed struct {
+		XMLName xml.Name `xml:"http://www.topografix.com/GPX/1/1 gpx"`
+		Version string   `xml:"version,attr"`
+		Creator string   `xml:"creator,attr"`
+		Track   struct {
+			Name     string `xml:"name"`
+			Segments []struct {
+				Points []struct {
+					Lat       float64 `xml:"lat,attr"`
+					Lon       float64 `xml:"lon,attr"`
+					Elevation *int    `xml:"ele"`
+					Time      string  `xml:"time"`
+				} `xml:"trkpt"`
+			} `xml:"trkseg"`
+		} `xml:"trk"`
+	}
+	if err != nil {
+		colors.PrintError("Failed to build GPX: %v", err)
+	} else if err := xml.Unmarshal(gpx, &parsed); err != nil {
+		colors.PrintError("GPX is not well-formed XML: %v", err)
+	} else if !strings.HasPrefix(string(gpx), "<?xml") || parsed.Version != "1.1" || parsed.Creator == "" {
+		colors.PrintError("GPX root is missing the XML header, version 1.1 or creator")
+	} else if len(parsed.Track.Segments) != 1 || len(parsed.Track.Segments[0].Points) != 3 {
+		colors.PrintError("Expected one track segment with 3 points, got %+v", parsed.Track.Segments)
+	} else {
+		colors.PrintSuccess("GPX 1.1 document in the GPX namespace with one track of 3 points")
+		points := parsed.Track.Segments[0].Points
+		if points[0].Lat == 27.7172 && points[0].Lon == 85.3240 && parsed.Track.Name == "Bus 1 (BA 1 PA 1234)" {
+			colors.PrintSuccess("Track points carry their coordinates and the track its name")
+		} else {
+			colors.PrintError("Track point or name wrong: %+v %q", points[0], parsed.Track.Name)
+		}
+		if points[0].Time == "2024-03-01T02:15:00Z" && points[2].Time == "2024-03-01T02:16:00Z" {
+			colors.PrintSuccess("Point times are written in UTC")
+		} else {
+			colors.PrintError("Point times not in UTC: %s, %s", points[0].Time, points[2].Time)
+		}
+		if points[0].Elevation != nil && *points[0].Elevation == 1340 && points[1].Elevation == nil {
+			colors.PrintSuccess("Elevation is written only where the altitude is known")
+		} else {
+			colors.PrintError("Elevation wrong: %v, %v", points[0].Elevation, points[1].Elevation)
+		}
+		elevation := strings.Index(string(gpx), "<ele>1340</ele>")
+		if elevation >= 0 && elevation < strings.Index(string(gpx), "<time>2024-03-01T02:15:00Z</time>") {
+			colors.PrintSuccess("Elevation precedes time in each point, as the GPX schema orders them")
+		} else {
+			colors.PrintError("Track point elements out of schema order")
+		}
+	}
+
+	emptyGPX, err := services.RouteGPX("Idle", nil, exportStart)
+	if err == nil && xml.Unmarshal(emptyGPX, new(struct{})) == nil && strings.Contains(string(emptyGPX), "<trkseg></trkseg>") {
+		colors.PrintSuccess("Route without fixes exports an empty track segment")
+	} else {
+		colors.PrintError("Empty route GPX wrong: %v\n%s", err, emptyGPX)
+	}
+
+	// KML export with a stop along the track
+	colors.PrintSubHeader("KML Export Test")
+
+	kmlTrack := make([]models.GPSData, 0, 7)
+	for i, fix := range []struct {
+		minute int
+		speed  int
+	}{{0, 30}, {1, 0}, {3, 2}, {8, 0}, {9, 25}, {10, 0}, {11, 20}} {
+		point := gpsAt("123456789012345", 27.7172+float64(i)*0.001, 85.3240+float64(i)*0.001, exportStart.Add(time.Duration(fix.minute)*time.Minute))
+		point.Speed = intPtr(fix.speed)
+		kmlTrack = append(kmlTrack, point)
+	}
+
+	stops := services.FindRouteStops(kmlTrack, config.DefaultMovingSpeedKmh, services.MinRouteStopDuration)
+	if len(stops) == 1 && stops[0].Start.Equal(kmlTrack[1].Timestamp) && stops[0].End.Equal(kmlTrack[4].Timestamp) &&
+		stops[0].Latitude == *kmlTrack[1].Latitude {
+		colors.PrintSuccess("8-minute pause is a stop ending at the next moving fix; 1-minute pause is not")
+	} else {
+		colors.PrintError("Expected one stop from minute 1 to 9, got %+v", stops)
+	}
+
+	kml, err := services.RouteKML("Bus 1 (BA 1 PA 1234)", kmlTrack, stops)
+	var parsedKML struct {
+		XMLName  xml.Name `xml:"http://www.opengis.net/kml/2.2 kml"`
+		Document struct {
+			Placemarks []struct {
+				Name       string `xml:"name"`
+				StyleURL   string `xml:"styleUrl"`
+				LineString *struct {
+					Coordinates string `xml:"coordinates"`
+				} `xml:"LineString"`
+				Point *struct {
+					Coordinates string `xml:"coordinates"`
+				} `xml:"Point"`
+			} `xml:"Placemark"`
+		} `xml:"Document"`
+	}
+	if err != nil {
+		colors.PrintError("Failed to build KML: %v", err)
+	} else if err := xml.Unmarshal(kml, &parsedKML); err != nil {
+		colors.PrintError("KML is not well-formed XML in the KML namespace: %v", err)
+	} else if placemarks := parsedKML.Document.Placemarks; len(placemarks) != 2 || placemarks[0].LineString == nil || placemarks[1].Point == nil {
+		colors.PrintError("Expected a track LineString and one stop Point, got %+v", placemarks)
+	} else {
+		if coordinates := strings.Fields(placemarks[0].LineString.Coordinates); len(coordinates) == len(kmlTrack) &&
+			coordinates[0] == "85.324,27.7172" && placemarks[0].StyleURL == "#track" {
+			colors.PrintSuccess("Styled LineString has one longitude,latitude tuple per fix")
+		} else {
+			colors.PrintError("LineString coordinates wrong: %q", placemarks[0].LineString.Coordinates)
+		}
+		if placemarks[1].Name == "Stop 1" && placemarks[1].StyleURL == "#stop" && placemarks[1].Point.Coordinates == "85.325,27.7182" {
+			colors.PrintSuccess("Stop placemark sits where the vehicle came to rest")
+		} else {
+			colors.PrintError("Stop placemark wrong: %+v", placemarks[1])
+		}
+	}
+
+	// GeoJSON output for routes and latest positions
+	colors.PrintSubHeader("GeoJSON Output Test")
+
+	type geoJSONDocument struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Type     string `json:"type"`
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	decodeGeoJSON := func(collection services.GeoJSONFeatureCollection) (geoJSONDocument, error) {
+		var document geoJSONDocument
+		body, err := json.Marshal(collection)
+		if err == nil {
+			err = json.Unmarshal(body, &document)
+		}
+		return document, err
+	}
+
+	routeFeature := services.RouteFeature(exportTrack, map[string]interface{}{"imei": "123456789012345"})
+	routeDocument, err := decodeGeoJSON(services.NewFeatureCollection([]services.GeoJSONFeature{routeFeature}))
+	var lineCoordinates [][]float64
+	if err != nil || routeDocument.Type != "FeatureCollection" || len(routeDocument.Features) != 1 {
+		colors.PrintError("Route is not a FeatureCollection with one feature: %v %+v", err, routeDocument)
+	} else if feature := routeDocument.Features[0]; feature.Type != "Feature" || feature.Geometry.Type != "LineString" ||
+		json.Unmarshal(feature.Geometry.Coordinates, &lineCoordinates) != nil || len(lineCoordinates) != len(exportTrack) {
+		colors.PrintError("Route feature is not a LineString with %d positions: %+v", len(exportTrack), feature)
+	} else {
+		colors.PrintSuccess("Route is a FeatureCollection holding one LineString with a position per fix")
+		if lineCoordinates[0][0] == 85.3240 && lineCoordinates[0][1] == 27.7172 {
+			colors.PrintSuccess("Positions are longitude first, as GeoJSON requires")
+		} else {
+			colors.PrintError("First position is not [longitude, latitude]: %v", lineCoordinates[0])
+		}
+		timestamps, _ := feature.Properties["timestamps"].([]interface{})
+		speeds, _ := feature.Properties["speeds"].([]interface{})
+		if len(timestamps) == len(exportTrack) && len(speeds) == len(exportTrack) && feature.Properties["imei"] == "123456789012345" {
+			colors.PrintSuccess("Timestamps and speeds line up with the positions, alongside the given properties")
+		} else {
+			colors.PrintError("Route properties wrong: %+v", feature.Properties)
+		}
+	}
+
+	latestFix := kmlTrack[4]
+	position, hasPosition := services.PositionFeature(&latestFix, map[string]interface{}{"name": "Bus 1"})
+	_, noPosition := services.PositionFeature(&models.GPSData{IMEI: "123456789012345", Timestamp: exportStart}, nil)
+	positionDocument, err := decodeGeoJSON(services.NewFeatureCollection([]services.GeoJSONFeature{position}))
+	var pointCoordinates []float64
+	if !hasPosition || noPosition || err != nil || len(positionDocument.Features) != 1 {
+		colors.PrintError("Only fixes with coordinates should become points: located=%v unlocated=%v err=%v", hasPosition, noPosition, err)
+	} else if feature := positionDocument.Features[0]; feature.Geometry.Type != "Point" ||
+		json.Unmarshal(feature.Geometry.Coordinates, &pointCoordinates) != nil || len(pointCoordinates) != 2 ||
+		pointCoordinates[0] != *latestFix.Longitude || pointCoordinates[1] != *latestFix.Latitude {
+		colors.PrintError("Position is not a Point at the fix: %+v", feature)
+	} else if feature.Properties["speed"] != float64(25) || feature.Properties["timestamp"] != config.FormatTimestamp(latestFix.Timestamp) ||
+		feature.Properties["name"] != "Bus 1" {
+		colors.PrintError("Position properties wrong: %+v", feature.Properties)
+	} else {
+		colors.PrintSuccess("Latest position is a Point carrying its speed, timestamp and vehicle name")
+	}
+
+	if body, err := json.Marshal(services.NewFeatureCollection(nil)); err == nil && string(body) == `{"type":"FeatureCollection","features":[]}` {
+		colors.PrintSuccess("Empty result is a FeatureCollection with an empty features list")
+	} else {
+		colors.PrintError("Empty FeatureCollection wrong: %s", body)
+	}
+
+	// Heatmap cells: two places about 1 km apart, with a status-only row while parked
+	colors.PrintSubHeader("Heatmap Test")
+
+	heatmapFixes := []models.GPSData{
+		gpsAt("123456789012345", 27.7172, 85.3240, exportStart),
+		gpsAt("123456789012345", 27.7173, 85.3240, exportStart.Add(time.Minute)),
+		{IMEI: "123456789012345", Timestamp: exportStart.Add(2 * time.Minute)},
+		gpsAt("123456789012345", 27.7272, 85.3240, exportStart.Add(5*time.Minute)),
+		gpsAt("123456789012345", 27.7171, 85.3240, exportStart.Add(6*time.Minute)),
+		gpsAt("123456789012345", 27.7272, 85.3241, exportStart.Add(3*time.Hour)),
+	}
+
+	byPoints := services.BuildHeatmap(heatmapFixes, 200, services.HeatmapWeightPoints, services.HeatmapMaxGap)
+	if len(byPoints) == 2 && byPoints[0].Points == 3 && byPoints[0].Weight == 3 && byPoints[1].Weight == 2 {
+		colors.PrintSuccess("Fixes in the same 200 m cell add up; status-only rows are not points")
+	} else {
+		colors.PrintError("Expected cells weighing 3 and 2 points, got %+v", byPoints)
+	}
+	if len(byPoints) == 2 && math.Abs(byPoints[0].Latitude-27.7172) < 1e-9 && math.Abs(byPoints[1].Longitude-85.32405) < 1e-9 {
+		colors.PrintSuccess("Cells are placed at the centroid of their fixes")
+	} else {
+		colors.PrintError("Cell centroids wrong: %+v", byPoints)
+	}
+
+	byTime := services.BuildHeatmap(heatmapFixes, 200, services.HeatmapWeightTime, services.HeatmapMaxGap)
+	// First place: 60 s + 60 s + 180 s parked without a fix + 900 s capped silence
+	if len(byTime) == 2 && byTime[0].Weight == 1200 && byTime[1].Weight == 60 {
+		colors.PrintSuccess("Time weights credit parked time and cap silences at the max gap")
+	} else {
+		colors.PrintError("Expected 1200 s and 60 s, got %+v", byTime)
+	}
+
+	coarse := services.BuildHeatmap(heatmapFixes, 5000, services.HeatmapWeightPoints, services.HeatmapMaxGap)
+	if len(coarse) == 1 && coarse[0].Points == 5 {
+		colors.PrintSuccess("A 5 km grid puts both places in one cell")
+	} else {
+		colors.PrintError("Expected one 5 km cell, got %+v", coarse)
+	}
+
+	if cells := services.BuildHeatmap(heatmapFixes[2:3], 200, services.HeatmapWeightTime, services.HeatmapMaxGap); len(cells) == 0 {
+		colors.PrintSuccess("No positioned fixes gives an empty heatmap")
+	} else {
+		colors.PrintError("Expected no cells, got %+v", cells)
+	}
+
+	// Distance travelled ignores jitter while parked
+	colors.PrintSubHeader("Stationary Jitter Test")
+
+	// An hour parked: each fix wanders up to ~3 m from the parking spot
+	var parked []models.GPSData
+	var rawParkedKm float64
+	for i := 0; i < 60; i++ {
+		offset := float64(i%5-2) * 0.00001 // about 1.5 m per step
+		point := gpsAt("123456789012345", 27.7172+offset, 85.3240-offset, exportStart.Add(time.Duration(i)*time.Minute))
+		point.Speed = intPtr(0)
+		point.Ignition = "OFF"
+		if i > 0 {
+			rawParkedKm += calculateDistance(*parked[i-1].Latitude, *parked[i-1].Longitude, *point.Latitude, *point.Longitude)
+		}
+		parked = append(parked, point)
+	}
+	if parkedKm := services.TravelDistanceKm(parked, config.DefaultMovingSpeedKmh); parkedKm == 0 && rawParkedKm > 0.1 {
+		colors.PrintSuccess("Parked jitter adds 0 km instead of the raw %.2f km", rawParkedKm)
+	} else {
+		colors.PrintError("Parked jitter counted %.3f km (raw %.3f km)", parkedKm, rawParkedKm)
+	}
+
+	// A drive of 10 hops of about 111 m, then a crawl of 5 m hops above the moving threshold
+	var drive []models.GPSData
+	for i := 0; i <= 10; i++ {
+		point := gpsAt("123456789012345", 27.7172+float64(i)*0.001, 85.3240, exportStart.Add(time.Duration(i)*10*time.Second))
+		point.Speed = intPtr(40)
+		drive = append(drive, point)
+	}
+	expectedDriveKm := calculateDistance(27.7172, 85.3240, 27.7272, 85.3240)
+	if driveKm := services.TravelDistanceKm(drive, config.DefaultMovingSpeedKmh); math.Abs(driveKm-expectedDriveKm) < 0.001 {
+		colors.PrintSuccess("A real drive keeps its full %.2f km", driveKm)
+	} else {
+		colors.PrintError("Drive counted %.3f km, expected %.3f km", driveKm, expectedDriveKm)
+	}
+
+	crawlFrom, crawlTo := gpsAt("123456789012345", 27.7172, 85.3240, exportStart), gpsAt("123456789012345", 27.71725, 85.3240, exportStart.Add(time.Second))
+	crawlFrom.Speed, crawlTo.Speed = intPtr(0), intPtr(8)
+	if crawl := services.SegmentDistanceKm(&crawlFrom, &crawlTo, config.DefaultMovingSpeedKmh); crawl > 0.005 {
+		colors.PrintSuccess("A short hop counts when the vehicle is above the moving threshold")
+	} else {
+		colors.PrintError("Short moving hop dropped: %.4f km", crawl)
+	}
+
+	jumpFrom, jumpTo := gpsAt("123456789012345", 27.7172, 85.3240, exportStart), gpsAt("123456789012345", 27.7177, 85.3240, exportStart.Add(time.Minute))
+	jumpFrom.Speed, jumpTo.Speed = intPtr(0), intPtr(0)
+	if hop := services.SegmentDistanceKm(&jumpFrom, &jumpTo, config.DefaultMovingSpeedKmh); hop > 0.05 {
+		colors.PrintSuccess("A hop of over 10 m counts even at a reported speed of 0")
+	} else {
+		colors.PrintError("Long stationary hop dropped: %.4f km", hop)
+	}
+
+	// Position jumps are judged by the speed they imply, not by distance alone
+	colors.PrintSubHeader("Position Jump Filter Test")
+
+	// One degree of latitude is about 111.195 km
+	jumpStart := gpsAt("123456789012345", 27.7172, 85.3240, exportStart)
+	jumpCases := []struct {
+		desc    string
+		km      float64
+		elapsed time.Duration
+		jump    bool
+	}{
+		{"60 km highway stretch between fixes an hour apart", 60, time.Hour, false},
+		{"40 km teleport in 2 seconds", 40, 2 * time.Second, true},
+		{"5 km in 1 minute (300 km/h)", 5, time.Minute, true},
+		{"1 km in 1 minute (60 km/h)", 1, time.Minute, false},
+		{"100 m drift between fixes in the same second", 0.1, 0, false},
+		{"40 km teleport in a buffered fix 2 seconds older", 40, -2 * time.Second, true},
+	}
+	for _, tc := range jumpCases {
+		implied, jump := services.IsGPSJump(&jumpStart, 27.7172+tc.km/111.195, 85.3240, exportStart.Add(tc.elapsed), 200)
+		if jump == tc.jump {
+			colors.PrintSuccess("%s: implied %.0f km/h, rejected=%v", tc.desc, implied, jump)
+		} else {
+			colors.PrintError("%s: implied %.0f km/h, rejected=%v (expected %v)", tc.desc, implied, jump, tc.jump)
+		}
+	}
+	if _, jump := services.IsGPSJump(&jumpStart, 28.0, 85.3240, exportStart.Add(2*time.Second), 0); !jump {
+		colors.PrintSuccess("A max speed of 0 accepts every fix")
+	} else {
+		colors.PrintError("Jump rejected without a max speed")
+	}
+	if config.GetTCPConfig().JumpFilter {
+		colors.PrintSuccess("Jump filter is on by default")
+	} else {
+		colors.PrintError("Jump filter is off by default")
+	}
+
+	testIngestionService()
+	testMinSatellites()
+	testPlausibleSpeed()
+	testGPSInjection()
+	testGPSBackfill()
+
 	colors.PrintSuccess("GPS coordinate testing completed!")
 }
 
+// ingestIMEI is the device of the ingestion service test, which needs no database
+const ingestIMEI = "0999000000000031"
+
+// testIngestionService feeds decoded packets to the ingestion service with an in-memory
+// store, without a device connection or database, and checks which fixes are saved
+func testIngestionService() {
+	colors.PrintSubHeader("Ingestion Service Test")
+
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	previousAt := func(lat, lng float64, ago time.Duration) *models.GPSData {
+		previous := gpsAt(ingestIMEI, lat, lng, start.Add(-ago))
+		previous.Speed = intPtr(40)
+		return &previous
+	}
+	packetAt := func(lat, lng float64, speed, satellites byte, ignition string) *protocol.DecodedPacket {
+		return &protocol.DecodedPacket{
+			Timestamp:    start,
+			ProtocolName: "GPS_LBS",
+			Latitude:     &lat,
+			Longitude:    &lng,
+			Speed:        &speed,
+			Satellites:   &satellites,
+			Ignition:     ignition,
+		}
+	}
+	noFix := packetAt(27.7172, 85.3240, 40, 9, "ON")
+	noFix.Latitude, noFix.Longitude = nil, nil
+
+	const (
+		savedLocated = "located"
+		savedStatus  = "status only"
+		notSaved     = "nothing"
+	)
+	cases := []struct {
+		desc        string
+		packet      *protocol.DecodedPacket
+		previous    *models.GPSData
+		unknown     bool   // Device not registered
+		vehicleType string // Type of the device's vehicle
+		want        string
+	}{
+		{"Moving fix", packetAt(27.7172, 85.3240, 40, 9, "ON"), nil, false, "", savedLocated},
+		{"Moving fix 1 km on from the previous", packetAt(27.7262, 85.3240, 60, 9, "ON"), previousAt(27.7172, 85.3240, time.Minute), false, "car", savedLocated},
+		{"Fix with the ignition off", packetAt(27.7172, 85.3240, 0, 9, "OFF"), nil, false, "", savedStatus},
+		{"Stationary fix", packetAt(27.7172, 85.3240, 0, 9, "ON"), nil, false, "", savedStatus},
+		{"Fix from an unregistered device", packetAt(27.7172, 85.3240, 40, 9, "ON"), nil, true, "", notSaved},
+		{"Fix without coordinates", noFix, nil, false, "", notSaved},
+		{"Fix outside the region", packetAt(40.7128, -74.0060, 40, 9, "ON"), nil, false, "", notSaved},
+		{"Fix without satellites", packetAt(27.7172, 85.3240, 40, 0, "ON"), nil, false, "", notSaved},
+		{"Bike at 180 km/h", packetAt(27.7172, 85.3240, 180, 9, "ON"), nil, false, "bike", notSaved},
+		{"Fix on the previous position", packetAt(27.7172, 85.3240, 40, 9, "ON"), previousAt(27.7172, 85.3240, 10*time.Second), false, "", notSaved},
+		{"40 km jump in 2 seconds", packetAt(28.0769, 85.3240, 40, 9, "ON"), previousAt(27.7172, 85.3240, 2*time.Second), false, "car", notSaved},
+	}
+
+	for _, tc := range cases {
+		var saved []models.GPSData
+		store := services.IngestionStore{
+			IsDeviceRegistered: func(imei string) bool { return !tc.unknown },
+			LastLocatedGPS:     func(imei string) *models.GPSData { return tc.previous },
+			VehicleType:        func(imei string) string { return tc.vehicleType },
+			Save: func(gpsData *models.GPSData) (bool, error) {
+				saved = append(saved, *gpsData)
+				return true, nil
+			},
+		}
+		err := services.NewIngestionServiceWithStore(nil, store).ProcessGPS(tc.packet, ingestIMEI)
+
+		got := notSaved
+		if len(saved) == 1 && saved[0].Latitude != nil {
+			got = savedLocated
+		} else if len(saved) == 1 {
+			got = savedStatus
+		}
+		if err == nil && got == tc.want {
+			colors.PrintSuccess("%s: %s saved", tc.desc, got)
+		} else {
+			colors.PrintError("%s: %s saved, err=%v (expected %s)", tc.desc, got, err, tc.want)
+		}
+		if tc.previous != nil && got == savedLocated {
+			if saved[0].DistanceFromPrev != nil && *saved[0].DistanceFromPrev > 0.9 {
+				colors.PrintSuccess("%s: distance from the previous fix recorded (%.2f km)", tc.desc, *saved[0].DistanceFromPrev)
+			} else {
+				colors.PrintError("%s: distance from the previous fix missing", tc.desc)
+			}
+		}
+	}
+
+	// A status-only row keeps no speed, so it carries no speed source either
+	var statusOnly []models.GPSData
+	services.NewIngestionServiceWithStore(nil, services.IngestionStore{
+		IsDeviceRegistered: func(imei string) bool { return true },
+		LastLocatedGPS:     func(imei string) *models.GPSData { return nil },
+		VehicleType:        func(imei string) string { return "" },
+		Save: func(gpsData *models.GPSData) (bool, error) {
+			statusOnly = append(statusOnly, *gpsData)
+			return true, nil
+		},
+	}).ProcessGPS(packetAt(27.7172, 85.3240, 3, 9, "OFF"), ingestIMEI)
+	if len(statusOnly) == 1 && statusOnly[0].Latitude == nil && statusOnly[0].Speed == nil && statusOnly[0].SpeedSource == "" {
+		colors.PrintSuccess("Filtered fix saved without a speed or speed source")
+	} else {
+		colors.PrintError("Filtered fix saved with a speed: %+v", statusOnly)
+	}
+
+	// Saved rows are broadcast, with whether they kept their location
+	broadcasts := make(chan bool, 1)
+	services.SetGPSBroadcaster(func(gpsData *models.GPSData, located bool) { broadcasts <- located })
+	service := services.NewIngestionServiceWithStore(nil, services.IngestionStore{
+		IsDeviceRegistered: func(imei string) bool { return true },
+		LastLocatedGPS:     func(imei string) *models.GPSData { return nil },
+		VehicleType:        func(imei string) string { return "" },
+		Save:               func(gpsData *models.GPSData) (bool, error) { return true, nil },
+	})
+	service.ProcessGPS(packetAt(27.7172, 85.3240, 40, 9, "ON"), ingestIMEI)
+	select {
+	case located := <-broadcasts:
+		if located {
+			colors.PrintSuccess("Saved fix broadcast as a full GPS update")
+		} else {
+			colors.PrintError("Saved fix broadcast as a status update")
+		}
+	case <-time.After(time.Second):
+		colors.PrintError("Saved fix not broadcast")
+	}
+	services.SetGPSBroadcaster(nil)
+
+	// A failed save is the one outcome reported as an error
+	failing := services.NewIngestionServiceWithStore(nil, services.IngestionStore{
+		IsDeviceRegistered: func(imei string) bool { return true },
+		LastLocatedGPS:     func(imei string) *models.GPSData { return nil },
+		VehicleType:        func(imei string) string { return "" },
+		Save:               func(gpsData *models.GPSData) (bool, error) { return false, errors.New("database unavailable") },
+	})
+	if err := failing.ProcessGPS(packetAt(27.7172, 85.3240, 40, 9, "ON"), ingestIMEI); err != nil {
+		colors.PrintSuccess("Failed save reported: %v", err)
+	} else {
+		colors.PrintError("Failed save not reported")
+	}
+}
+
+// testMinSatellites checks fixes with satellite counts below, at and above the configured
+// minimum, for positioned fixes and for fixes the device reports as not positioned
+func testMinSatellites() {
+	colors.PrintSubHeader("Minimum Satellites Test")
+
+	previous, wasSet := os.LookupEnv("GPS_MIN_SATELLITES")
+	os.Setenv("GPS_MIN_SATELLITES", "4")
+	configured := config.GetTCPConfig().MinSatellites
+	if wasSet {
+		os.Setenv("GPS_MIN_SATELLITES", previous)
+	} else {
+		os.Unsetenv("GPS_MIN_SATELLITES")
+	}
+	if configured == 4 {
+		colors.PrintSuccess("GPS_MIN_SATELLITES=4 configures a minimum of 4")
+	} else {
+		colors.PrintError("GPS_MIN_SATELLITES=4 configured a minimum of %d", configured)
+	}
+
+	var saved int
+	service := services.NewIngestionServiceWithStore(nil, services.IngestionStore{
+		IsDeviceRegistered: func(imei string) bool { return true },
+		LastLocatedGPS:     func(imei string) *models.GPSData { return nil },
+		VehicleType:        func(imei string) string { return "" },
+		Save: func(gpsData *models.GPSData) (bool, error) {
+			saved++
+			return true, nil
+		},
+	})
+	service.SetMinSatellites(4)
+
+	cases := []struct {
+		satellites byte
+		positioned bool
+		accepted   bool
+	}{
+		{3, true, false},
+		{4, true, true},
+		{5, true, true},
+		// Not positioned needs one satellite more than the minimum
+		{4, false, false},
+		{5, false, true},
+		{6, false, true},
+	}
+	for _, tc := range cases {
+		lat, lng, speed, satellites, positioned := 27.7172, 85.3240, byte(40), tc.satellites, tc.positioned
+		packet := &protocol.DecodedPacket{
+			Timestamp:     time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC),
+			ProtocolName:  "GPS_LBS",
+			Latitude:      &lat,
+			Longitude:     &lng,
+			Speed:         &speed,
+			Satellites:    &satellites,
+			GPSPositioned: &positioned,
+			Ignition:      "ON",
+		}
+
+		saved = 0
+		err := service.ProcessGPS(packet, ingestIMEI)
+		accepted := err == nil && saved == 1
+		if accepted == tc.accepted {
+			colors.PrintSuccess("%d satellites (positioned=%v) with a minimum of 4: accepted=%v", tc.satellites, tc.positioned, accepted)
+		} else {
+			colors.PrintError("%d satellites (positioned=%v) with a minimum of 4: accepted=%v (expected %v)", tc.satellites, tc.positioned, accepted, tc.accepted)
+		}
+	}
+}
+
+// testPlausibleSpeed checks fixes against the highest believable speed of the vehicle's type,
+// including a per-type override from the environment
+func testPlausibleSpeed() {
+	colors.PrintSubHeader("Plausible Speed Test")
+
+	ingest := func(vehicleType string, speed int) string {
+		service := services.NewIngestionServiceWithStore(nil, services.IngestionStore{
+			IsDeviceRegistered: func(imei string) bool { return true },
+			LastLocatedGPS:     func(imei string) *models.GPSData { return nil },
+			VehicleType:        func(imei string) string { return vehicleType },
+			Save:               func(gpsData *models.GPSData) (bool, error) { return true, nil },
+		})
+		gpsData := gpsAt(ingestIMEI, 27.7172, 85.3240, time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+		gpsData.Speed, gpsData.Satellites, gpsData.Ignition = intPtr(speed), intPtr(9), "ON"
+		result, err := service.IngestGPS(&gpsData)
+		if err != nil {
+			return err.Error()
+		}
+		return result.Rejected
+	}
+
+	cases := []struct {
+		vehicleType string
+		speed       int
+		rejected    bool
+	}{
+		{"bike", 180, true},
+		{"bike", 140, false},
+		{"car", 120, false},
+		{"car", 220, true},
+		{"truck", 150, true},
+		// Without a vehicle type there is no limit to check against
+		{"", 180, false},
+	}
+	for _, tc := range cases {
+		reason := ingest(tc.vehicleType, tc.speed)
+		rejected := reason == "implausible_speed"
+		if rejected == tc.rejected && (rejected || reason == "") {
+			colors.PrintSuccess("%q at %d km/h: rejected=%v", tc.vehicleType, tc.speed, rejected)
+		} else {
+			colors.PrintError("%q at %d km/h: result %q (expected rejected=%v)", tc.vehicleType, tc.speed, reason, tc.rejected)
+		}
+	}
+
+	previous, wasSet := os.LookupEnv("GPS_MAX_SPEED_BIKE")
+	os.Setenv("GPS_MAX_SPEED_BIKE", "120")
+	reason := ingest("bike", 130)
+	if wasSet {
+		os.Setenv("GPS_MAX_SPEED_BIKE", previous)
+	} else {
+		os.Unsetenv("GPS_MAX_SPEED_BIKE")
+	}
+	if reason == "implausible_speed" {
+		colors.PrintSuccess("GPS_MAX_SPEED_BIKE=120 rejects a bike at 130 km/h")
+	} else {
+		colors.PrintError("GPS_MAX_SPEED_BIKE=120 with a bike at 130 km/h: result %q", reason)
+	}
+}
+
+// injectIMEI is a device created and removed by the GPS injection test
+const injectIMEI = "0999000000000021"
+
+// testGPSInjection posts points to the admin injection endpoint and checks they go through
+// normal ingestion: accepted points are saved and broadcast, rejected ones are neither
+func testGPSInjection() {
+	colors.PrintSubHeader("GPS Injection Test")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the GPS injection test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.DeviceModel{}, &models.Device{}, &models.Vehicle{}, &models.GPSData{},
+		&models.DrivingEvent{}, &models.AuditLog{}); err != nil {
+		colors.PrintError("FAIL: migrate tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Where("imei = ?", injectIMEI).Delete(&models.GPSData{})
+		conn.Where("imei = ?", injectIMEI).Delete(&models.Device{})
+	}
+	cleanup()
+	defer cleanup()
+	if err := conn.Create(&models.Device{IMEI: injectIMEI, SimNo: "9800000021", SimOperator: models.SimOperatorNcell}).Error; err != nil {
+		colors.PrintError("FAIL: create device: %v", err)
+		return
+	}
+
+	broadcasts := make(chan bool, 10)
+	services.SetGPSBroadcaster(func(gpsData *models.GPSData, located bool) {
+		if gpsData.IMEI == injectIMEI {
+			broadcasts <- located
+		}
+	})
+	defer services.SetGPSBroadcaster(nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/admin/gps/inject", controllers.NewGPSController().InjectGPSData)
+	inject := func(body string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(nethttp.MethodPost, "/api/v1/admin/gps/inject", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	broadcast := func() (located, ok bool) {
+		select {
+		case located = <-broadcasts:
+			return located, true
+		case <-time.After(2 * time.Second):
+			return false, false
+		}
+	}
+
+	status := inject(fmt.Sprintf(`{"imei":%q,"latitude":27.7172,"longitude":85.3240,"speed":30,"satellites":9,"ignition":"ON"}`, injectIMEI))
+	var saved models.GPSData
+	err = conn.Where("imei = ? AND protocol_name = ?", injectIMEI, "INJECTED").First(&saved).Error
+	if status == nethttp.StatusCreated && err == nil && saved.Latitude != nil && saved.Speed != nil && *saved.Speed == 30 {
+		colors.PrintSuccess("Injected point saved with its location and speed")
+	} else {
+		colors.PrintError("Injected point not saved: status=%d err=%v", status, err)
+	}
+	if located, ok := broadcast(); ok && located {
+		colors.PrintSuccess("Injected point broadcast as a full GPS update")
+	} else {
+		colors.PrintError("Injected point not broadcast: received=%v located=%v", ok, located)
+	}
+
+	status = inject(fmt.Sprintf(`{"imei":%q,"latitude":40.7128,"longitude":-74.0060,"speed":30,"satellites":9,"ignition":"ON"}`, injectIMEI))
+	var count int64
+	conn.Model(&models.GPSData{}).Where("imei = ?", injectIMEI).Count(&count)
+	if _, ok := broadcast(); status == nethttp.StatusUnprocessableEntity && count == 1 && !ok {
+		colors.PrintSuccess("Point outside the region rejected, not saved and not broadcast")
+	} else {
+		colors.PrintError("Point outside the region: status=%d rows=%d broadcast=%v", status, count, ok)
+	}
+
+	if status := inject(`{"imei":"0999000000000022","latitude":27.7172,"longitude":85.3240,"speed":30,"ignition":"ON"}`); status == nethttp.StatusNotFound {
+		colors.PrintSuccess("Point for an unregistered device rejected")
+	} else {
+		colors.PrintError("Point for an unregistered device: status=%d", status)
+	}
+	if status := inject(`{"imei":"123","latitude":27.7172,"longitude":85.3240}`); status == nethttp.StatusBadRequest {
+		colors.PrintSuccess("Point with an invalid IMEI rejected")
+	} else {
+		colors.PrintError("Point with an invalid IMEI: status=%d", status)
+	}
+}
+
+// backfillIMEI is the device whose rows the GPS backfill test creates and removes
+const backfillIMEI = "0999000000000042"
+
+// testGPSBackfill clears the derived fields of a few rows, as on rows stored before they
+// existed, and checks that a backfill run fills them in again
+func testGPSBackfill() {
+	colors.PrintSubHeader("GPS Backfill Test")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the GPS backfill test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Unscoped().Where("imei = ?", backfillIMEI).Delete(&models.GPSData{})
+	}
+	cleanup()
+	defer cleanup()
+
+	// Three fixes about 1.1 km apart with a status row in between; the last one carries LBS data
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	rows := []models.GPSData{
+		gpsAt(backfillIMEI, 27.7172, 85.3240, start),
+		gpsAt(backfillIMEI, 27.7272, 85.3240, start.Add(time.Minute)),
+		{IMEI: backfillIMEI, Timestamp: start.Add(90 * time.Second)},
+		gpsAt(backfillIMEI, 27.7372, 85.3240, start.Add(2*time.Minute)),
+	}
+	rows[0].Satellites, rows[1].Satellites, rows[3].Satellites = intPtr(9), intPtr(5), intPtr(2)
+	rows[3].MCC, rows[3].LAC, rows[3].CellID = intPtr(429), intPtr(1234), intPtr(5678)
+	for i := range rows {
+		rows[i].Speed = intPtr(40)
+	}
+	if err := conn.Create(&rows).Error; err != nil {
+		colors.PrintError("FAIL: create GPS rows: %v", err)
+		return
+	}
+	conn.Model(&models.GPSData{}).Where("imei = ?", backfillIMEI).
+		UpdateColumns(map[string]interface{}{"accuracy": "", "has_lbs": false, "distance_from_prev": nil})
+
+	backfill := services.GetGPSBackfillService()
+	if _, err := backfill.Start(rows[0].ID-1, 2); err != nil {
+		colors.PrintError("FAIL: start backfill: %v", err)
+		return
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for backfill.Progress().Running && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	progress := backfill.Progress()
+	if !progress.Running && progress.Error == "" && progress.Processed >= int64(len(rows)) && progress.LastID >= rows[3].ID {
+		colors.PrintSuccess("Backfill finished: %d rows processed in batches of %d", progress.Processed, progress.BatchSize)
+	} else {
+		colors.PrintError("Backfill did not finish: %+v", progress)
+		return
+	}
+
+	var backfilled []models.GPSData
+	conn.Where("imei = ?", backfillIMEI).Order("timestamp ASC").Find(&backfilled)
+	if len(backfilled) != len(rows) {
+		colors.PrintError("Expected %d rows after the backfill, found %d", len(rows), len(backfilled))
+		return
+	}
+
+	if backfilled[0].Accuracy == "good" && backfilled[1].Accuracy == "fair" && backfilled[2].Accuracy == "unknown" && backfilled[3].Accuracy == "poor" {
+		colors.PrintSuccess("Accuracy filled in from the satellite count")
+	} else {
+		colors.PrintError("Accuracy not backfilled: %q %q %q %q", backfilled[0].Accuracy, backfilled[1].Accuracy, backfilled[2].Accuracy, backfilled[3].Accuracy)
+	}
+
+	if backfilled[3].HasLBS && !backfilled[0].HasLBS {
+		colors.PrintSuccess("LBS flag set only on the row with cell tower data")
+	} else {
+		colors.PrintError("LBS flag not backfilled: first=%v last=%v", backfilled[0].HasLBS, backfilled[3].HasLBS)
+	}
+
+	near := func(distance *float64) bool { return distance != nil && math.Abs(*distance-1.11) < 0.05 }
+	if backfilled[0].DistanceFromPrev == nil && near(backfilled[1].DistanceFromPrev) && backfilled[2].DistanceFromPrev == nil && near(backfilled[3].DistanceFromPrev) {
+		colors.PrintSuccess("Distance from the previous fix filled in, skipping the status row")
+	} else {
+		colors.PrintError("Distance not backfilled: %v %v %v %v", backfilled[0].DistanceFromPrev, backfilled[1].DistanceFromPrev,
+			backfilled[2].DistanceFromPrev, backfilled[3].DistanceFromPrev)
+	}
+}
+
+// gpsAt builds a GPS fix for the given IMEI
+func gpsAt(imei string, lat, lng float64, timestamp time.Time) models.GPSData {
+	return models.GPSData{IMEI: imei, Latitude: &lat, Longitude: &lng, Timestamp: timestamp}
+}
+
+// intPtr returns a pointer to the given altitude
+func intPtr(v int) *int {
+	return &v
+}
+
 // calculateDistance calculates the distance between two coordinates using Haversine formula
 func calculateDistance(lat1, lng1, lat2, lng2 float64) float64 {
 	const R = 6371 // Earth's radius in kilometers
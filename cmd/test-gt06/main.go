@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/pkg/colors"
+	"math"
+	"strings"
+	"time"
+)
+
+func main() {
+	colors.PrintHeader("GT06 DECODER TESTING")
+
+	testStandardFrame()
+	testExtendedFrame()
+	testLongExtendedFrame()
+	testMixedFrames()
+	testAlarmFrame()
+	testLoginTimezone()
+	testLocalTimeNormalization()
+	testTruncatedGPSPayloads()
+	testHemisphereFlags()
+	testSouthernCoordinate()
+	testCoordinateDivisor()
+	testAcknowledgement()
+}
+
+// loginFrame is a standard 0x7878 login frame:
+// 7878 | length 0D | protocol 01 | IMEI 0123456789012345 | serial 0001 | crc 0000 | 0D0A
+const loginFrame = "78780D01" + "0123456789012345" + "0001" + "0000" + "0D0A"
+
+// voltageFrame is an extended 0x7979 information transmission frame:
+// 7979 | length 0008 | protocol 94 | type 00 | voltage 04D2 (12.34V) | serial 0001 | crc 0000 | 0D0A
+const voltageFrame = "7979000894" + "0004D2" + "0001" + "0000" + "0D0A"
+
+// timezoneLoginFrame is a login frame with type and timezone/language words:
+// 7878 | length 11 | protocol 01 | IMEI 0123456789012345 | type 0022 |
+// timezone/language 2212 (545 = UTC+05:45, east, English) | serial 0001 | crc 0000 | 0D0A
+const timezoneLoginFrame = "78781101" + "0123456789012345" + "0022" + "2212" + "0001" + "0000" + "0D0A"
+
+// alarmFrame is a standard 0x26 alarm frame with a fix in Kathmandu:
+// 7878 | length 25 | protocol 26 | time 2024-06-15 08:30:00 | satellites C9 |
+// lat 02F94690 (27.7172) | lng 09277E60 (85.3240) | speed 28 | course/status 005A |
+// LBS length 08 | MCC 01AD | MNC 01 | LAC 1234 | cell 00ABCD |
+// terminal info 46 | voltage 04 | GSM 03 | alarm 01 (SOS) | language 02 | serial 0005 | crc 0000 | 0D0A
+const alarmFrame = "78782526" + "18060F081E00" + "C9" + "02F94690" + "09277E60" + "28" + "005A" +
+	"08" + "01AD" + "01" + "1234" + "00ABCD" + "46" + "04" + "03" + "01" + "02" + "0005" + "0000" + "0D0A"
+
+// gpsFrame is a standard 0x22 GPS frame with a fix in Kathmandu:
+// 7878 | length 1F | protocol 22 | time 2024-06-15 08:30:00 | satellites C9 |
+// lat 02F94690 | lng 09277E60 | speed 28 | course/status 005A |
+// MCC 01AD | MNC 01 | LAC 1234 | cell 00ABCD | serial 0001 | crc 0000 | 0D0A
+const gpsFrame = "78781F22" + "18060F081E00" + "C9" + "02F94690" + "09277E60" + "28" + "005A" +
+	"01AD" + "01" + "1234" + "00ABCD" + "0001" + "0000" + "0D0A"
+
+// testStandardFrame decodes a 0x7878 login frame with a one-byte length
+func testStandardFrame() {
+	colors.PrintSubHeader("Standard 0x7878 Frame")
+
+	packets := decode(loginFrame)
+	if !check("decoded exactly 1 packet", len(packets) == 1) {
+		return
+	}
+
+	packet := packets[0]
+	check("length parsed as 13", packet.Length == 13)
+	check("extended flag not set", !packet.Extended)
+	check("protocol is LOGIN", packet.ProtocolName == "LOGIN")
+	check("terminal ID extracted", packet.TerminalID == "0123456789012345")
+}
+
+// testExtendedFrame decodes a 0x7979 information transmission frame with a two-byte length
+func testExtendedFrame() {
+	colors.PrintSubHeader("Extended 0x7979 Frame")
+
+	packets := decode(voltageFrame)
+	if !check("decoded exactly 1 packet", len(packets) == 1) {
+		return
+	}
+
+	packet := packets[0]
+	check("length parsed as 8", packet.Length == 8)
+	check("extended flag set", packet.Extended)
+	check("protocol is INFO_TRANSMISSION", packet.ProtocolName == "INFO_TRANSMISSION")
+	check("info type is external voltage", packet.InfoType != nil && *packet.InfoType == 0x00)
+	check("voltage is 12.34V", packet.ExternalVoltage != nil && *packet.ExternalVoltage == 12.34)
+}
+
+// testLongExtendedFrame checks that the high byte of a two-byte length is honoured
+func testLongExtendedFrame() {
+	colors.PrintSubHeader("Extended Frame Longer Than 255 Bytes")
+
+	content := strings.Repeat("A", 300)
+	// length = protocol(1) + type(1) + content(300) + serial(2) + crc(2) = 306 = 0x0132
+	frame := "797901329404" + hex.EncodeToString([]byte(content)) + "0002" + "0000" + "0D0A"
+
+	packets := decode(frame)
+	if !check("decoded exactly 1 packet", len(packets) == 1) {
+		return
+	}
+
+	packet := packets[0]
+	check("length parsed as 306", packet.Length == 306)
+	check("payload extracted intact", packet.InfoContent == content)
+}
+
+// testMixedFrames checks frame boundaries when standard and extended frames share one read
+func testMixedFrames() {
+	colors.PrintSubHeader("Standard + Extended Frames In One Read")
+
+	packets := decode(loginFrame + voltageFrame + loginFrame)
+	if !check("decoded exactly 3 packets", len(packets) == 3) {
+		return
+	}
+
+	check("first packet is LOGIN", packets[0].ProtocolName == "LOGIN")
+	check("second packet is INFO_TRANSMISSION", packets[1].ProtocolName == "INFO_TRANSMISSION")
+	check("third packet is LOGIN", packets[2].ProtocolName == "LOGIN")
+	check("extended voltage intact", packets[1].ExternalVoltage != nil && *packets[1].ExternalVoltage == 12.34)
+}
+
+// testAlarmFrame decodes a 0x26 alarm frame carrying GPS, LBS, status and the alarm
+func testAlarmFrame() {
+	colors.PrintSubHeader("Alarm With Location 0x26 Frame")
+
+	packets := decode(alarmFrame)
+	if !check("decoded exactly 1 packet", len(packets) == 1) {
+		return
+	}
+
+	packet := packets[0]
+	check("protocol is ALARM_GPS_LBS_STATUS", packet.ProtocolName == "ALARM_GPS_LBS_STATUS")
+	check("response required", packet.NeedsResponse)
+	check("GPS time parsed", packet.GPSTime != nil && packet.GPSTime.Equal(time.Date(2024, 6, 15, 8, 30, 0, 0, time.UTC)))
+	check("satellites parsed as 12", packet.Satellites != nil && *packet.Satellites == 12)
+	check("latitude parsed", packet.Latitude != nil && math.Abs(*packet.Latitude-27.7172) < 1e-6)
+	check("longitude parsed", packet.Longitude != nil && math.Abs(*packet.Longitude-85.3240) < 1e-6)
+	check("speed and course parsed", packet.Speed != nil && *packet.Speed == 40 && packet.Course != nil && *packet.Course == 90)
+	check("cell tower parsed", packet.MCC != nil && *packet.MCC == 429 && packet.MNC != nil && *packet.MNC == 1 &&
+		packet.LAC != nil && *packet.LAC == 0x1234 && packet.CellID != nil && *packet.CellID == 0xABCD)
+	check("status byte parsed", packet.Ignition == "ON" && packet.Charger == "CONNECTED" && packet.GPSTracking == "ENABLED")
+	check("voltage and GSM parsed", packet.Voltage != nil && packet.Voltage.Level == 4 && packet.GSMSignal != nil && packet.GSMSignal.Level == 3)
+	check("alarm is an active SOS", packet.Alarm != nil && packet.Alarm.Active && packet.Alarm.Type == "SOS" && packet.Alarm.Code == 1)
+	check("emergency flag set", packet.AlarmType != nil && packet.AlarmType.Emergency && !packet.AlarmType.Overspeed)
+	check("alarm language is English", packet.AlarmLanguage == "ENGLISH")
+}
+
+// testLoginTimezone decodes the timezone/language word of login packets
+func testLoginTimezone() {
+	colors.PrintSubHeader("Login Timezone And Language")
+
+	packets := decode(timezoneLoginFrame)
+	if !check("decoded exactly 1 packet", len(packets) == 1) {
+		return
+	}
+
+	packet := packets[0]
+	check("terminal ID extracted", packet.TerminalID == "0123456789012345")
+	check("device type parsed", packet.DeviceType != nil && *packet.DeviceType == 0x22)
+	check("timezone decoded as +345 minutes (UTC+05:45)", packet.TimezoneOffset != nil && *packet.TimezoneOffset == 345)
+	check("language decoded as English", packet.Language == "ENGLISH")
+
+	// 300 = 3:00, bit 3 set for west, language bits 01
+	offset, language := protocol.DecodeTimezoneLanguage(0x12C9)
+	check("western zone decoded as -180 minutes (UTC-03:00)", offset == -180)
+	check("language decoded as Chinese", language == "CHINESE")
+
+	offset, _ = protocol.DecodeTimezoneLanguage(0x0002)
+	check("UTC decoded as 0 minutes", offset == 0)
+
+	packets = decode(loginFrame)
+	check("login without timezone leaves it unset", len(packets) == 1 && packets[0].TimezoneOffset == nil)
+}
+
+// testLocalTimeNormalization converts a local-time fix from a UTC+05:45 device to UTC
+func testLocalTimeNormalization() {
+	colors.PrintSubHeader("Device Local Time Normalization")
+
+	packets := decode(timezoneLoginFrame + alarmFrame)
+	if !check("decoded login and fix", len(packets) == 2 && packets[0].TimezoneOffset != nil) {
+		return
+	}
+
+	// The device clock reads 08:30 Kathmandu time, which is 02:45 UTC
+	fix := packets[1]
+	fix.ApplyTimezone(*packets[0].TimezoneOffset)
+	local := time.Date(2024, 6, 15, 8, 30, 0, 0, time.UTC)
+	utc := time.Date(2024, 6, 15, 2, 45, 0, 0, time.UTC)
+	check("GPS time converted to UTC", fix.GPSTime != nil && fix.GPSTime.Equal(utc))
+	check("packet timestamp converted to UTC", fix.Timestamp.Equal(utc))
+	check("device time kept as sent", fix.DeviceTime != nil && fix.DeviceTime.Equal(local))
+
+	fix.ApplyTimezone(*packets[0].TimezoneOffset)
+	check("applying the timezone twice does not shift again", fix.GPSTime.Equal(utc))
+
+	packets = decode(alarmFrame)
+	if len(packets) == 1 {
+		packets[0].ApplyTimezone(0)
+		check("UTC device time left unchanged", packets[0].GPSTime != nil && packets[0].GPSTime.Equal(local))
+	}
+}
+
+// gpsAltitudePayload is a 0x22 GPS payload with an altitude before the cell tower:
+// time 2024-06-15 08:30:00 | satellites C9 | lat 02F94690 | lng 09277E60 | speed 28 |
+// course/status 005A | altitude 0064 (100 m) | MCC 01AD | MNC 01 | LAC 1234 | cell 00ABCD
+const gpsAltitudePayload = "18060F081E00" + "C9" + "02F94690" + "09277E60" + "28" + "005A" + "0064" +
+	"01AD" + "01" + "1234" + "00ABCD"
+
+// testTruncatedGPSPayloads decodes a GPS frame cut short at every length and checks that
+// the decoder fills in exactly the fields whose bytes are all present
+func testTruncatedGPSPayloads() {
+	colors.PrintSubHeader("Truncated GPS Payloads")
+
+	payload, _ := hex.DecodeString(gpsAltitudePayload)
+	panicked, wrong := 0, 0
+	for n := 0; n <= len(payload); n++ {
+		// protocol(1) + payload + serial(2) + crc(2)
+		frame := fmt.Sprintf("7878%02X22%X000100000D0A", n+5, payload[:n])
+		var packets []*protocol.DecodedPacket
+		func() {
+			defer func() {
+				if recover() != nil {
+					panicked++
+				}
+			}()
+			packets = decode(frame)
+		}()
+		if len(packets) != 1 {
+			wrong++
+			continue
+		}
+
+		packet := packets[0]
+		hasTime := packet.GPSTime != nil && packet.Satellites != nil
+		hasFix := packet.Latitude != nil && packet.Longitude != nil && packet.Speed != nil && packet.Course != nil
+		hasAltitude := packet.Altitude != nil && *packet.Altitude == 100
+		hasCell := packet.MCC != nil && *packet.MCC == 429 && packet.CellID != nil && *packet.CellID == 0xABCD
+		if hasTime != (n >= 12) || hasFix != (n >= 18) || hasAltitude != (n >= 20) || hasCell != (n >= 28) {
+			colors.PrintWarning("Payload of %d bytes: time %v, fix %v, altitude %v, cell %v", n, hasTime, hasFix, hasAltitude, hasCell)
+			wrong++
+		}
+	}
+
+	check("no truncated payload panicked", panicked == 0)
+	check("every truncation decoded exactly the fields it holds in full", wrong == 0)
+}
+
+// hemisphereFrame returns gpsFrame with its course/status word replaced, to set the
+// hemisphere flags: 0x0400 marks a southern fix and 0x0800 a western one
+func hemisphereFrame(courseStatus string) string {
+	return strings.Replace(gpsFrame, "28"+"005A", "28"+courseStatus, 1)
+}
+
+// testHemisphereFlags decodes southern and western fixes with and without honoring the hemisphere
+func testHemisphereFlags() {
+	colors.PrintSubHeader("Hemisphere Flags")
+
+	honoring := protocol.NewGT06DecoderWithOptions(protocol.GT06Options{HonorHemisphere: true})
+	near := func(value *float64, want float64) bool {
+		return value != nil && math.Abs(*value-want) < 1e-6
+	}
+
+	packets := decode(hemisphereFrame("045A"))
+	check("southern fix keeps a positive latitude by default", len(packets) == 1 && near(packets[0].Latitude, 27.7172))
+
+	packets = decodeWith(honoring, hemisphereFrame("045A"))
+	if check("southern fix decoded when honoring the hemisphere", len(packets) == 1) {
+		check("southern latitude is negative", near(packets[0].Latitude, -27.7172))
+		check("southern fix keeps an eastern longitude", near(packets[0].Longitude, 85.3240))
+		check("raw latitude keeps the magnitude sent", near(packets[0].RawLatitude, 27.7172))
+		check("course still decoded", packets[0].Course != nil && *packets[0].Course == 90)
+	}
+
+	packets = decodeWith(honoring, hemisphereFrame("085A"))
+	if check("western fix decoded when honoring the hemisphere", len(packets) == 1) {
+		check("western longitude is negative", near(packets[0].Longitude, -85.3240))
+		check("western fix keeps a northern latitude", near(packets[0].Latitude, 27.7172))
+		check("raw longitude keeps the magnitude sent", near(packets[0].RawLongitude, 85.3240))
+	}
+
+	packets = decodeWith(honoring, hemisphereFrame("0C5A"))
+	check("south-western fix has both coordinates negative", len(packets) == 1 &&
+		near(packets[0].Latitude, -27.7172) && near(packets[0].Longitude, -85.3240))
+
+	packets = decodeWith(honoring, gpsFrame)
+	check("north-eastern fix unchanged when honoring the hemisphere", len(packets) == 1 &&
+		near(packets[0].Latitude, 27.7172) && near(packets[0].Longitude, 85.3240))
+}
+
+// sydneyFix replaces the Kathmandu fix of a frame with Sydney (33.8688 S, 151.2093 E):
+// lat 03A23C00 | lng 10391664 | course/status 045A (90 degrees, south flag set)
+func sydneyFix(frame string) string {
+	frame = strings.Replace(frame, "02F94690"+"09277E60", "03A23C00"+"10391664", 1)
+	return strings.Replace(frame, "28"+"005A", "28"+"045A", 1)
+}
+
+// testSouthernCoordinate decodes a known southern-hemisphere fix from GPS and alarm frames
+func testSouthernCoordinate() {
+	colors.PrintSubHeader("Southern Hemisphere Coordinate")
+
+	honoring := protocol.NewGT06DecoderWithOptions(protocol.GT06Options{HonorHemisphere: true})
+	for _, frame := range []struct {
+		name string
+		hex  string
+	}{
+		{"GPS", sydneyFix(gpsFrame)},
+		{"alarm", sydneyFix(alarmFrame)},
+	} {
+		packets := decodeWith(honoring, frame.hex)
+		if !check(frame.name+" frame with a Sydney fix decoded", len(packets) == 1 && packets[0].Latitude != nil && packets[0].Longitude != nil) {
+			continue
+		}
+		check(frame.name+" latitude is -33.8688", math.Abs(*packets[0].Latitude+33.8688) < 1e-6)
+		check(frame.name+" longitude is 151.2093", math.Abs(*packets[0].Longitude-151.2093) < 1e-6)
+		check(frame.name+" fix flagged south", packets[0].NorthLatitude != nil && !*packets[0].NorthLatitude)
+	}
+}
+
+// testCoordinateDivisor decodes a fix from firmware that sends coordinates in 1/10000
+// minutes (600000 units per degree) with a matching custom divisor
+func testCoordinateDivisor() {
+	colors.PrintSubHeader("Custom Coordinate Divisor")
+
+	// Kathmandu at 600000 units per degree: lat 00FDC230, lng 030D2A20
+	frame := strings.Replace(gpsFrame, "02F94690"+"09277E60", "00FDC230"+"030D2A20", 1)
+
+	packets := decodeWith(protocol.NewGT06DecoderWithOptions(protocol.GT06Options{CoordinateDivisor: 600000}), frame)
+	if check("fix decoded with a custom divisor", len(packets) == 1 && packets[0].Latitude != nil && packets[0].Longitude != nil) {
+		check("latitude scaled to 27.7172", math.Abs(*packets[0].Latitude-27.7172) < 1e-6)
+		check("longitude scaled to 85.3240", math.Abs(*packets[0].Longitude-85.3240) < 1e-6)
+	}
+
+	packets = decode(frame)
+	check("standard divisor reads the same fix three times smaller", len(packets) == 1 && packets[0].Latitude != nil &&
+		math.Abs(*packets[0].Latitude-27.7172/3) < 1e-6)
+
+	packets = decodeWith(protocol.NewGT06DecoderWithOptions(protocol.GT06Options{CoordinateDivisor: 0}), gpsFrame)
+	check("zero divisor falls back to the standard one", len(packets) == 1 && packets[0].Latitude != nil &&
+		math.Abs(*packets[0].Latitude-27.7172) < 1e-6)
+}
+
+// Login acks from the GT06 protocol document's examples, for serial numbers 1 and 5
+const (
+	loginAckSerial1 = "787805010001D9DC0D0A"
+	loginAckSerial5 = "7878050100059FF80D0A"
+)
+
+// testAcknowledgement compares generated acks to reference frames and checks that the
+// ack echoes the packet's whole two-byte serial number
+func testAcknowledgement() {
+	colors.PrintSubHeader("Acknowledgements")
+
+	decoder := protocol.NewGT06Decoder()
+	check("login ack for serial 1 matches the reference frame",
+		fmt.Sprintf("%X", decoder.GenerateResponse(1, 0x01)) == loginAckSerial1)
+	check("login ack for serial 5 matches the reference frame",
+		fmt.Sprintf("%X", decoder.GenerateResponse(5, 0x01)) == loginAckSerial5)
+
+	// A serial above 255 must not be cut down to its high byte
+	packets := decode(strings.Replace(loginFrame, "0001"+"0000", "0A0B"+"0000", 1))
+	if check("login with serial 0A0B decoded", len(packets) == 1) {
+		check("full serial decoded", packets[0].SerialNumber == 0x0A0B)
+		ack := fmt.Sprintf("%X", decoder.GenerateResponse(packets[0].SerialNumber, packets[0].Protocol))
+		check(fmt.Sprintf("ack %s echoes serial 0A0B", ack), strings.HasPrefix(ack, "787805010A0B"))
+	}
+}
+
+// decode runs a hex-encoded byte stream through a fresh decoder
+func decode(frameHex string) []*protocol.DecodedPacket {
+	return decodeWith(protocol.NewGT06Decoder(), frameHex)
+}
+
+// decodeWith runs a hex-encoded byte stream through the given decoder
+func decodeWith(decoder *protocol.GT06Decoder, frameHex string) []*protocol.DecodedPacket {
+	frame, err := hex.DecodeString(frameHex)
+	if err != nil {
+		colors.PrintError("Invalid test frame: %v", err)
+		return nil
+	}
+
+	packets, err := decoder.AddData(frame)
+	if err != nil {
+		colors.PrintError("Decode failed: %v", err)
+		return nil
+	}
+	return packets
+}
+
+// check prints a pass/fail line for a single assertion and returns the result
+func check(desc string, ok bool) bool {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+	return ok
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+	"luna_iot_server/pkg/lru"
+)
+
+func main() {
+	if err := config.InitializeTimezone(); err != nil {
+		colors.PrintError("Failed to initialize timezone: %v", err)
+		return
+	}
+
+	colors.PrintHeader("BOUNDED DEVICE STATE TESTING")
+
+	testEviction()
+	testRecentlyUsedKept()
+	testRemoveFunc()
+	testVehicleStateCapacity()
+
+	colors.PrintSuccess("Bounded device state testing completed!")
+}
+
+// testEviction fills a cache beyond capacity and checks the oldest entries are evicted
+func testEviction() {
+	colors.PrintSubHeader("Eviction Beyond Capacity")
+
+	cache := lru.New[string, int](3)
+	evictions := 0
+	for i, imei := range []string{"A", "B", "C", "D", "E"} {
+		if cache.Set(imei, i) {
+			evictions++
+		}
+	}
+
+	check("Cache holds its capacity", cache.Len() == 3)
+	check("Two entries evicted", evictions == 2 && cache.Evicted() == 2)
+	_, hasA := cache.Peek("A")
+	_, hasB := cache.Peek("B")
+	check("Oldest entries A and B evicted", !hasA && !hasB)
+	keys := cache.Keys()
+	check("Newest entries kept, oldest first", len(keys) == 3 && keys[0] == "C" && keys[1] == "D" && keys[2] == "E")
+
+	cache.Set("C", 10)
+	value, _ := cache.Peek("C")
+	check("Updating an entry evicts nothing", cache.Len() == 3 && cache.Evicted() == 2 && value == 10)
+}
+
+// testRecentlyUsedKept checks that reading an entry protects it from eviction
+func testRecentlyUsedKept() {
+	colors.PrintSubHeader("Recently Used Entries Kept")
+
+	cache := lru.New[string, int](3)
+	cache.Set("A", 1)
+	cache.Set("B", 2)
+	cache.Set("C", 3)
+	cache.Get("A") // A is now the most recently used
+	cache.Set("D", 4)
+
+	_, hasA := cache.Peek("A")
+	_, hasB := cache.Peek("B")
+	check("Read entry survives", hasA)
+	check("Least recently used entry evicted instead", !hasB)
+
+	cache.Peek("C") // Peek must not refresh C
+	cache.Set("E", 5)
+	_, hasC := cache.Peek("C")
+	check("Peek does not protect an entry", !hasC)
+}
+
+// testRemoveFunc checks selective removal, as used by the stale state cleanup
+func testRemoveFunc() {
+	colors.PrintSubHeader("Selective Removal")
+
+	cache := lru.New[int, int](10)
+	for i := 1; i <= 6; i++ {
+		cache.Set(i, i)
+	}
+	removed := cache.RemoveFunc(func(key, value int) bool { return value%2 == 0 })
+	check("Matching entries removed", removed == 3 && cache.Len() == 3)
+	_, hasOdd := cache.Peek(5)
+	_, hasEven := cache.Peek(4)
+	check("Other entries kept", hasOdd && !hasEven)
+	check("Delete reports a missing key", cache.Delete(5) && !cache.Delete(5))
+}
+
+// testVehicleStateCapacity checks that notification states are bounded by DEVICE_STATE_CAPACITY
+// while the active vehicles keep their state
+func testVehicleStateCapacity() {
+	colors.PrintSubHeader("Vehicle Notification State Capacity")
+
+	os.Setenv("DEVICE_STATE_CAPACITY", "3")
+	notificationService := services.NewVehicleNotificationService()
+	os.Unsetenv("DEVICE_STATE_CAPACITY")
+
+	speed := 0
+	record := func(imei string) {
+		notificationService.RecordSpeed(&models.GPSData{IMEI: imei, Speed: &speed, Timestamp: time.Now()}, 60)
+	}
+
+	// 3000000000000001 keeps reporting while a stream of new IMEIs arrives
+	for i := 1; i <= 9; i++ {
+		record(fmt.Sprintf("300000000000000%d", i))
+		record("3000000000000001")
+	}
+
+	check("Tracked states capped at the capacity", notificationService.TrackedStateCount() == 3)
+	check("Oldest idle vehicles evicted", notificationService.GetVehicleStateInfo("3000000000000002") == nil &&
+		notificationService.GetVehicleStateInfo("3000000000000007") == nil)
+	check("Vehicle that keeps reporting keeps its state", notificationService.GetVehicleStateInfo("3000000000000001") != nil)
+	check("Most recent vehicles kept", notificationService.GetVehicleStateInfo("3000000000000009") != nil &&
+		notificationService.GetVehicleStateInfo("3000000000000008") != nil)
+}
+
+// check prints a PASS or FAIL line for one expectation
+func check(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+}
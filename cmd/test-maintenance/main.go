@@ -0,0 +1,83 @@
+package main
+
+import (
+	"time"
+
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+)
+
+func main() {
+	colors.PrintHeader("MAINTENANCE REMINDER TESTING")
+
+	testKmRule()
+	testEngineHoursRule()
+	testReminderTemplates()
+
+	colors.PrintSuccess("Maintenance reminder testing completed!")
+}
+
+// testKmRule checks that a distance-based service becomes due exactly at its interval
+func testKmRule() {
+	colors.PrintSubHeader("Distance Rule")
+
+	schedule := &models.MaintenanceSchedule{Name: "Oil change", IntervalKm: 5000, BaselineAt: time.Now()}
+
+	status := services.EvaluateMaintenance(schedule, 4999.9, 0)
+	check("Not due just below 5000 km", !status.IsDue)
+	check("Remaining distance reported", status.KmRemaining != nil && *status.KmRemaining > 0.09 && *status.KmRemaining < 0.11)
+	check("No engine-hours interval reported as nil", status.EngineHoursRemaining == nil)
+
+	status = services.EvaluateMaintenance(schedule, 5000, 0)
+	check("Due at exactly 5000 km", status.IsDue)
+
+	status = services.EvaluateMaintenance(schedule, 5200, 0)
+	check("Overdue distance reported as negative remaining", status.IsDue && status.KmRemaining != nil && *status.KmRemaining == -200)
+}
+
+// testEngineHoursRule checks engine-hours intervals counted from the service baseline
+func testEngineHoursRule() {
+	colors.PrintSubHeader("Engine Hours Rule")
+
+	schedule := &models.MaintenanceSchedule{Name: "Service", IntervalKm: 10000, IntervalEngineHours: 250, BaselineEngineHours: 1000}
+
+	status := services.EvaluateMaintenance(schedule, 2000, 1249)
+	check("Not due before either interval", !status.IsDue && status.EngineHoursSinceService == 249)
+
+	status = services.EvaluateMaintenance(schedule, 2000, 1250)
+	check("Due when engine hours reach the interval first", status.IsDue)
+
+	status = services.EvaluateMaintenance(schedule, 0, 900)
+	check("Counter calibrated below the baseline counts as zero", !status.IsDue && status.EngineHoursSinceService == 0)
+}
+
+// testReminderTemplates checks that the reminder renders in both languages
+func testReminderTemplates() {
+	colors.PrintSubHeader("Reminder Text")
+
+	data := map[string]string{
+		"reg_no":              "BA 1 PA 1234",
+		"service":             "Oil change",
+		"km_since_service":    "5012",
+		"hours_since_service": "120.5",
+		"date":                "2024-06-15",
+		"time":                "09:00 AM",
+	}
+	for _, language := range []string{models.LanguageEnglish, models.LanguageNepali} {
+		rendered, err := services.RenderNotificationTemplate(string(services.NotificationTypeMaintenanceDue), language, data)
+		_, missingTitle := services.RenderTemplate(rendered.Title, data)
+		_, missingBody := services.RenderTemplate(rendered.Body, data)
+		check("Reminder renders in "+language+" with every variable", err == nil &&
+			rendered.Language == language && len(missingTitle) == 0 && len(missingBody) == 0)
+	}
+}
+
+// check prints a PASS or FAIL line for one expectation
+func check(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+}
@@ -1,11 +1,25 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"luna_iot_server/config"
+	server "luna_iot_server/internal/http"
+	"luna_iot_server/internal/http/controllers"
 	"luna_iot_server/internal/models"
 	"luna_iot_server/internal/services"
 	"luna_iot_server/pkg/colors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
 func main() {
@@ -99,9 +113,993 @@ func main() {
 
 	// Test cleanup
 	colors.PrintSubHeader("Testing State Cleanup")
-	notificationService.CleanupOldVehicleStates()
+	notificationService.CleanupOldVehicleStates(config.GetTCPConfig().VehicleStateMaxAge)
 
 	colors.PrintSuccess("✅ Vehicle notification state tracking test completed!")
+
+	testUnregisteredTokenDetection()
+	testMultiDeviceFanOut()
+	testMixedDeliveryResults()
+	testTemplateRendering()
+	testLocalizedNotifications()
+	testInboxRequestValidation()
+	testWebSocketNotificationDelivery()
+	testStateTransitionBroadcast()
+	testWebSocketSequence()
+	testConcurrentWebSocketWrites()
+	testWebSocketLatency()
+	testWebSocketKeepalive()
+	testSystemMessageBroadcast()
+	testVehicleStateCleanup()
+	testMovingSpeedThreshold()
+	testVehicleStateBoundaries()
+	testAllowedHours()
+	testTowAwayDetection()
+}
+
+// testUnregisteredTokenDetection parses a send response with one unregistered token
+// and checks that only that token is reported for removal
+func testUnregisteredTokenDetection() {
+	colors.PrintSubHeader("Unregistered FCM Token Detection")
+
+	sample := `{
+		"success": true,
+		"tokens_sent": 3,
+		"tokens_delivered": 1,
+		"tokens_failed": 2,
+		"details": [
+			{"token": "token-ok", "success": true, "response": "projects/x/messages/1"},
+			{"token": "token-dead", "success": false, "response": {"code": "messaging/registration-token-not-registered", "message": "Requested entity was not found."}},
+			{"token": "token-busy", "success": false, "response": "messaging/server-unavailable"}
+		]
+	}`
+
+	var response services.RavipangaliResponse
+	if err := json.Unmarshal([]byte(sample), &response); err != nil {
+		colors.PrintError("FAIL: sample response did not parse: %v", err)
+		return
+	}
+
+	failed := response.FailedTokens()
+	report("two failed tokens reported", len(failed) == 2)
+
+	permanent := response.PermanentlyFailedTokens()
+	report("only the unregistered token is marked for removal", len(permanent) == 1 && permanent[0] == "token-dead")
+}
+
+// testMultiDeviceFanOut checks that a user with two devices is sent to on both,
+// without duplicating the legacy single-column token
+func testMultiDeviceFanOut() {
+	colors.PrintSubHeader("Multi-Device Fan-Out")
+
+	users := []models.User{
+		{ID: 1, FCMToken: "phone-b"}, // legacy column holds the most recent registration
+		{ID: 2, FCMToken: "legacy-only"},
+	}
+	devices := []models.UserDevice{
+		{UserID: 1, FCMToken: "phone-a", IsActive: true},
+		{UserID: 1, FCMToken: "phone-b", IsActive: true},
+		{UserID: 1, FCMToken: "phone-old", IsActive: false},
+	}
+
+	tokens := services.MergeUserFCMTokens(users, devices)
+	report("user with two devices gets both tokens", len(tokens[1]) == 2 && tokens[1][0] == "phone-a" && tokens[1][1] == "phone-b")
+	report("inactive device skipped", !containsToken(tokens[1], "phone-old"))
+	report("legacy-only user still included", len(tokens[2]) == 1 && tokens[2][0] == "legacy-only")
+	report("fan-out sends to three tokens", len(services.FlattenFCMTokens(tokens)) == 3)
+}
+
+// testMixedDeliveryResults records a send where recipients end up delivered,
+// partially delivered, failed and without tokens
+func testMixedDeliveryResults() {
+	colors.PrintSubHeader("Per-Recipient Delivery Status")
+
+	tokensByUser := map[uint][]string{
+		1: {"a1"},
+		2: {"b1", "b2"},
+		3: {"c1"},
+	}
+	response := &services.RavipangaliResponse{
+		Success: true,
+		Details: []services.Detail{
+			{Token: "a1", Success: true},
+			{Token: "b1", Success: false, Response: "messaging/server-unavailable"},
+			{Token: "b2", Success: true},
+			{Token: "c1", Success: false, Response: "messaging/registration-token-not-registered"},
+		},
+	}
+
+	deliveries := services.ResolveDeliveries([]uint{1, 2, 3, 4}, tokensByUser, response, nil)
+	report("single device delivered", deliveries[1].Status == models.DeliveryStatusDelivered)
+	report("one of two devices delivered counts as delivered", deliveries[2].Status == models.DeliveryStatusDelivered && deliveries[2].DevicesFailed == 1)
+	report("failed recipient keeps the provider error", deliveries[3].Status == models.DeliveryStatusFailed && deliveries[3].Error == "messaging/registration-token-not-registered")
+	report("recipient without devices marked no_token", deliveries[4].Status == models.DeliveryStatusNoToken)
+
+	failedSend := services.ResolveDeliveries([]uint{1}, tokensByUser, nil, fmt.Errorf("timeout"))
+	report("transport error fails every recipient", failedSend[1].Status == models.DeliveryStatusFailed && failedSend[1].Error == "timeout")
+}
+
+// testTemplateRendering fills a template from a data map and checks that
+// missing variables are reported and left in place
+func testTemplateRendering() {
+	colors.PrintSubHeader("Notification Template Rendering")
+
+	data := map[string]string{"vehicle": "BA 1 PA 1234", "speed": "82", "time": "03:15 PM"}
+	rendered, missing := services.RenderTemplate("{vehicle} exceeded {speed} km/h at {time}", data)
+	report("all variables substituted", rendered == "BA 1 PA 1234 exceeded 82 km/h at 03:15 PM" && len(missing) == 0)
+
+	rendered, missing = services.RenderTemplate("{vehicle} exceeded {limit} km/h", data)
+	report("missing variable left as written", rendered == "BA 1 PA 1234 exceeded {limit} km/h")
+	report("missing variable reported", len(missing) == 1 && missing[0] == "limit")
+
+	rendered, _ = services.RenderTemplate("Speed: {speed}, not a {variable name}", data)
+	report("braces without a variable name untouched", rendered == "Speed: 82, not a {variable name}")
+
+	overspeed := services.DefaultNotificationTemplates[string(services.NotificationTypeOverspeed)]
+	title, _ := services.RenderTemplate(overspeed.Title, map[string]string{"reg_no": "BA 1 PA 1234"})
+	report("built-in overspeed title matches previous text", title == "BA 1 PA 1234: Vehicle is Overspeed")
+
+	variables := services.TemplateVariables(overspeed.Body)
+	report("template variables listed once each", len(variables) == 3)
+}
+
+// testLocalizedNotifications sends the same event to an English and a Nepali
+// user and checks each gets their own language, with English as the fallback
+func testLocalizedNotifications() {
+	colors.PrintSubHeader("Localized Notifications")
+
+	recipients := []models.User{
+		{ID: 1, Language: models.LanguageEnglish},
+		{ID: 2, Language: models.LanguageNepali},
+		{ID: 3}, // no preference stored yet
+	}
+	data := map[string]string{"reg_no": "BA 1 PA 1234", "date": "2025-01-01", "time": "03:15 PM"}
+
+	batches, err := services.LocalizeNotification(string(services.NotificationTypeIgnitionOn), recipients, data)
+	if err != nil || len(batches) != 2 {
+		colors.PrintError("FAIL: expected one batch per language, got %d (%v)", len(batches), err)
+		return
+	}
+
+	english, nepali := batches[0], batches[1]
+	report("English batch goes to English and unset users", english.Language == models.LanguageEnglish && len(english.UserIDs) == 2)
+	report("English user gets English text", english.Title == "BA 1 PA 1234: Ignition On")
+	report("Nepali batch goes to the Nepali user only", nepali.Language == models.LanguageNepali && len(nepali.UserIDs) == 1 && nepali.UserIDs[0] == 2)
+	report("Nepali user gets Nepali text", nepali.Title == "BA 1 PA 1234: इन्जिन सुरु भयो")
+
+	// An event with only an English template falls back to English for Nepali users
+	services.DefaultNotificationTemplates["test_event"] = models.NotificationTemplate{
+		Name:     "test_event",
+		Language: models.LanguageEnglish,
+		Title:    "{reg_no}: Test",
+		Body:     "Test event",
+	}
+	defer delete(services.DefaultNotificationTemplates, "test_event")
+
+	rendered, err := services.RenderNotificationTemplate("test_event", models.LanguageNepali, data)
+	report("missing translation falls back to English", err == nil && rendered.Title == "BA 1 PA 1234: Test" && rendered.Language == models.LanguageEnglish)
+
+	_, err = services.RenderNotificationTemplate("unknown_event", models.LanguageNepali, data)
+	report("unknown event reported", err == services.ErrTemplateNotFound)
+}
+
+// testInboxRequestValidation checks the inbox endpoints reject bad requests
+// before touching the database. Listing and marking read need a database.
+func testInboxRequestValidation() {
+	colors.PrintSubHeader("Notification Inbox Requests")
+
+	gin.SetMode(gin.ReleaseMode)
+	controller := controllers.NewNotificationController()
+
+	router := gin.New()
+	authenticated := router.Group("/my-notifications", func(c *gin.Context) {
+		if c.GetHeader("X-Test-User") != "" {
+			c.Set("user_id", uint(1))
+		}
+	})
+	authenticated.GET("", controller.GetMyNotifications)
+	authenticated.POST("/:id/read", controller.MarkMyNotificationRead)
+
+	status := func(method, path string, asUser bool) int {
+		request := httptest.NewRequest(method, path, nil)
+		if asUser {
+			request.Header.Set("X-Test-User", "1")
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	report("listing requires a user", status(http.MethodGet, "/my-notifications", false) == http.StatusUnauthorized)
+	report("invalid read filter rejected", status(http.MethodGet, "/my-notifications?is_read=maybe", true) == http.StatusBadRequest)
+	report("marking read requires a user", status(http.MethodPost, "/my-notifications/5/read", false) == http.StatusUnauthorized)
+	report("invalid notification ID rejected", status(http.MethodPost, "/my-notifications/abc/read", true) == http.StatusBadRequest)
+}
+
+// testWebSocketNotificationDelivery connects two WebSocket clients and checks that
+// only the target user's client receives the notification message
+func testWebSocketNotificationDelivery() {
+	colors.PrintSubHeader("WebSocket Notification Delivery")
+
+	hub := server.NewWebSocketHub()
+	go hub.Run()
+	services.SetInAppNotifier(hub.BroadcastNotification)
+	defer services.SetInAppNotifier(nil)
+
+	upgrader := websocket.Upgrader{}
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.Atoi(r.URL.Query().Get("user"))
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Register(conn, uint(userID), nil)
+	}))
+	defer wsServer.Close()
+
+	connect := func(userID int) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(wsServer.URL, "http") + "?user=" + strconv.Itoa(userID)
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			colors.PrintError("FAIL: could not connect client for user %d: %v", userID, err)
+			return nil
+		}
+		return conn
+	}
+
+	target, other := connect(7), connect(8)
+	if target == nil || other == nil {
+		return
+	}
+	defer target.Close()
+	defer other.Close()
+	time.Sleep(100 * time.Millisecond) // let the hub register both clients
+
+	services.NotifyInApp([]uint{7}, &services.InAppNotification{
+		NotificationID: 42,
+		Type:           "alert",
+		Title:          "BA 1 PA 1234: Ignition On",
+		Body:           "Your vehicle is turned ON",
+	})
+
+	var message struct {
+		Type string                     `json:"type"`
+		Data services.InAppNotification `json:"data"`
+	}
+	target.SetReadDeadline(time.Now().Add(2 * time.Second))
+	err := target.ReadJSON(&message)
+	report("target user's client receives the message", err == nil)
+	report("message type is notification", message.Type == "notification")
+	report("payload carries the notification", message.Data.NotificationID == 42 && message.Data.Title == "BA 1 PA 1234: Ignition On")
+
+	other.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	_, _, err = other.ReadMessage()
+	report("other users' clients receive nothing", err != nil)
+}
+
+// testStateTransitionBroadcast simulates an overspeed and checks that clients allowed to
+// see the vehicle get a state_transition message and other clients do not
+func testStateTransitionBroadcast() {
+	colors.PrintSubHeader("State Transition Broadcast")
+
+	const imei = "1234567890123457"
+
+	hub := server.NewWebSocketHub()
+	go hub.Run()
+	services.SetStateTransitionNotifier(hub.BroadcastStateTransition)
+	defer services.SetStateTransitionNotifier(nil)
+
+	upgrader := websocket.Upgrader{}
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.Atoi(r.URL.Query().Get("user"))
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Register(conn, uint(userID), strings.Split(r.URL.Query().Get("imeis"), ","))
+	}))
+	defer wsServer.Close()
+
+	connect := func(userID int, imeis string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(wsServer.URL, "http") + "?user=" + strconv.Itoa(userID) + "&imeis=" + imeis
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			colors.PrintError("FAIL: could not connect client for user %d: %v", userID, err)
+			return nil
+		}
+		return conn
+	}
+
+	watcher, other := connect(7, imei), connect(8, "0000000000000001")
+	if watcher == nil || other == nil {
+		return
+	}
+	defer watcher.Close()
+	defer other.Close()
+	time.Sleep(100 * time.Millisecond) // let the hub register both clients
+
+	notificationService := services.NewVehicleNotificationService()
+	speed := 75
+	transitions := notificationService.RecordSpeed(&models.GPSData{IMEI: imei, Speed: &speed, Timestamp: time.Now()}, 60)
+	report("overspeed is detected as a transition", len(transitions) == 1 && transitions[0] == services.TransitionOverspeedStart)
+
+	var message struct {
+		Type string                       `json:"type"`
+		Seq  uint64                       `json:"seq"`
+		Data server.StateTransitionUpdate `json:"data"`
+	}
+	watcher.SetReadDeadline(time.Now().Add(2 * time.Second))
+	err := watcher.ReadJSON(&message)
+	report("authorized client receives the message", err == nil)
+	report("message type is state_transition", message.Type == "state_transition")
+	report("payload carries the IMEI and new state", message.Data.IMEI == imei && message.Data.State == "overspeed_start" &&
+		message.Data.Speed != nil && *message.Data.Speed == 75)
+	report("message has a sequence number", message.Seq > 0)
+
+	other.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	_, _, err = other.ReadMessage()
+	report("clients without access to the vehicle receive nothing", err != nil)
+
+	// The next fix over the limit is no new overspeed, but the moving state catches up
+	speed = 80
+	transitions = notificationService.RecordSpeed(&models.GPSData{IMEI: imei, Speed: &speed, Timestamp: time.Now()}, 60)
+	report("staying over the limit is not a second overspeed", len(transitions) == 1 && transitions[0] == services.TransitionStartedMoving)
+	watcher.SetReadDeadline(time.Now().Add(2 * time.Second))
+	err = watcher.ReadJSON(&message)
+	report("started_moving follows", err == nil && message.Data.State == "started_moving")
+}
+
+// testWebSocketSequence checks that broadcasts carry a sequence number counting up per
+// device, and that the counters are bounded by DEVICE_STATE_CAPACITY
+func testWebSocketSequence() {
+	colors.PrintSubHeader("WebSocket Sequence Numbers")
+
+	const first, second = "1234567890123458", "1234567890123459"
+
+	// Sequences read by one client of a fresh hub for the given broadcasts
+	sequences := func(imeis ...string) []uint64 {
+		hub := server.NewWebSocketHub()
+		go hub.Run()
+
+		upgrader := websocket.Upgrader{}
+		wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			hub.Register(conn, 7, []string{first, second})
+		}))
+		defer wsServer.Close()
+
+		client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+		if err != nil {
+			colors.PrintError("FAIL: could not connect client: %v", err)
+			return nil
+		}
+		defer client.Close()
+		time.Sleep(100 * time.Millisecond) // let the hub register the client
+
+		var seqs []uint64
+		for _, imei := range imeis {
+			hub.BroadcastStateTransition(&services.VehicleStateTransition{IMEI: imei, State: services.TransitionIgnitionOn, Timestamp: time.Now()})
+			var message struct {
+				Seq  uint64                       `json:"seq"`
+				Data server.StateTransitionUpdate `json:"data"`
+			}
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if err := client.ReadJSON(&message); err != nil || message.Data.IMEI != imei {
+				colors.PrintError("FAIL: broadcast for %s not received: %v", imei, err)
+				return seqs
+			}
+			seqs = append(seqs, message.Seq)
+		}
+		return seqs
+	}
+
+	seqs := sequences(first, first, second, first, second)
+	report("sequence counts up for each device on its own", fmt.Sprint(seqs) == "[1 2 1 3 2]")
+
+	// With room for one device, broadcasting another forgets the first one's count
+	os.Setenv("DEVICE_STATE_CAPACITY", "1")
+	seqs = sequences(first, first, second, first)
+	os.Unsetenv("DEVICE_STATE_CAPACITY")
+	report("evicted device starts again at 1", fmt.Sprint(seqs) == "[1 2 1 1]")
+
+	// Broadcasts from many goroutines at once, as the server sends them, reach the client in
+	// the order of their sequence numbers
+	hub := server.NewWebSocketHub()
+	go hub.Run()
+	upgrader := websocket.Upgrader{}
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Register(conn, 7, []string{first})
+	}))
+	defer wsServer.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	if err != nil {
+		colors.PrintError("FAIL: could not connect client: %v", err)
+		return
+	}
+	defer client.Close()
+	time.Sleep(100 * time.Millisecond) // let the hub register the client
+
+	const concurrent = 500
+	for i := 0; i < concurrent; i++ {
+		go hub.BroadcastStateTransition(&services.VehicleStateTransition{IMEI: first, State: services.TransitionIgnitionOn, Timestamp: time.Now()})
+	}
+	inOrder := true
+	for want := uint64(1); want <= concurrent; want++ {
+		var message struct {
+			Seq uint64 `json:"seq"`
+		}
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := client.ReadJSON(&message); err != nil || message.Seq != want {
+			colors.PrintError("FAIL: expected seq %d, got %d (%v)", want, message.Seq, err)
+			inOrder = false
+			break
+		}
+	}
+	report("concurrent broadcasts arrive in sequence order", inOrder)
+}
+
+// testConcurrentWebSocketWrites hammers one connection with broadcasts, user notifications
+// and direct writes from many goroutines at once. Unserialized writes make gorilla/websocket
+// panic; run with go run -race to also catch unguarded state.
+func testConcurrentWebSocketWrites() {
+	colors.PrintSubHeader("Concurrent WebSocket Writes")
+
+	const imei = "1234567890123458"
+	const goroutines, messagesEach = 4, 25
+
+	hub := server.NewWebSocketHub()
+	go hub.Run()
+
+	writers := make(chan *server.ConnWriter, 1)
+	upgrader := websocket.Upgrader{}
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		writers <- hub.Register(conn, 9, []string{imei})
+	}))
+	defer wsServer.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	if err != nil {
+		colors.PrintError("FAIL: could not connect client: %v", err)
+		return
+	}
+	defer client.Close()
+	writer := <-writers
+	time.Sleep(100 * time.Millisecond) // let the hub register the client
+
+	// Count messages while the writers run so no write blocks on a full socket buffer
+	received := make(chan int)
+	go func() {
+		count := 0
+		for {
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if _, _, err := client.ReadMessage(); err != nil {
+				received <- count
+				return
+			}
+			count++
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < messagesEach; i++ {
+				hub.BroadcastStateTransition(&services.VehicleStateTransition{IMEI: imei, State: services.TransitionStartedMoving, Timestamp: time.Now()})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < messagesEach; i++ {
+				hub.BroadcastNotification(9, &services.InAppNotification{Type: "alert", Title: "Concurrent"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < messagesEach; i++ {
+				writer.WriteMessage(websocket.TextMessage, []byte("pong"), 10*time.Second)
+			}
+		}()
+	}
+	wg.Wait()
+
+	report("every message from every writer arrives intact", <-received == 3*goroutines*messagesEach)
+}
+
+// testWebSocketLatency answers the hub's pings with pongs sent at known delays and checks
+// the latency the admin connections endpoint reports, then makes one real round trip
+func testWebSocketLatency() {
+	colors.PrintSubHeader("WebSocket Ping Latency")
+
+	hub := server.NewWebSocketHub()
+	go hub.Run()
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.SetPongHandler(func(appData string) error {
+			hub.RecordPong(conn, appData, time.Now())
+			return nil
+		})
+		hub.Register(conn, 11, nil)
+		conns <- conn
+		// Control frames are only processed while reading
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer wsServer.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(wsServer.URL, "http"), nil)
+	if err != nil {
+		colors.PrintError("FAIL: could not connect client: %v", err)
+		return
+	}
+	defer client.Close()
+	conn := <-conns
+	time.Sleep(100 * time.Millisecond) // let the hub register the client
+
+	// Hand the ping payloads to the test instead of answering them, until answering is switched on
+	pings := make(chan string, 4)
+	var answer atomic.Bool
+	client.SetPingHandler(func(appData string) error {
+		if answer.Load() {
+			return client.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		}
+		pings <- appData
+		return nil
+	})
+	go func() {
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	stats := func() server.WebSocketClientStats {
+		clients := hub.ClientStats()
+		if len(clients) != 1 {
+			return server.WebSocketClientStats{}
+		}
+		return clients[0]
+	}
+	nextPing := func() (string, time.Time, bool) {
+		if err := hub.Ping(conn); err != nil {
+			return "", time.Time{}, false
+		}
+		select {
+		case payload := <-pings:
+			nanos, err := strconv.ParseInt(payload, 10, 64)
+			return payload, time.Unix(0, nanos), err == nil
+		case <-time.After(2 * time.Second):
+			return "", time.Time{}, false
+		}
+	}
+
+	client.WriteControl(websocket.PongMessage, []byte("unsolicited"), time.Now().Add(time.Second))
+	time.Sleep(100 * time.Millisecond)
+	initial := stats()
+	report("client is listed with its user ID", initial.UserID == 11 && initial.RemoteAddr != "")
+	report("no latency before a ping is answered", initial.LastLatencyMs == nil && initial.LatencySamples == 0)
+
+	payload, sentAt, ok := nextPing()
+	report("ping carries its send time", ok)
+	report("sent ping is outstanding", stats().PingOutstanding)
+	hub.RecordPong(conn, "12345", sentAt.Add(10*time.Millisecond))
+	report("pong echoing another payload is ignored", stats().LatencySamples == 0)
+	hub.RecordPong(conn, payload, sentAt.Add(40*time.Millisecond))
+	hub.RecordPong(conn, payload, sentAt.Add(500*time.Millisecond))
+	first := stats()
+	report("pong sets the last latency", first.LastLatencyMs != nil && *first.LastLatencyMs == 40)
+	report("repeated pong is not counted twice", first.LatencySamples == 1 && !first.PingOutstanding)
+
+	payload, sentAt, _ = nextPing()
+	hub.RecordPong(conn, payload, sentAt.Add(80*time.Millisecond))
+	second := stats()
+	report("average covers every answered ping", second.LatencySamples == 2 &&
+		*second.LastLatencyMs == 80 && *second.AvgLatencyMs == 60)
+
+	answer.Store(true)
+	hub.Ping(conn)
+	deadline := time.Now().Add(2 * time.Second)
+	for stats().LatencySamples < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	roundTrip := stats()
+	report("real pong from the client is measured", roundTrip.LatencySamples == 3 &&
+		*roundTrip.LastLatencyMs >= 0 && *roundTrip.LastLatencyMs < 2000)
+}
+
+// testWebSocketKeepalive runs a hub with short keepalive settings and checks that a client
+// which never answers pings is reaped while one that answers them stays connected
+func testWebSocketKeepalive() {
+	colors.PrintSubHeader("WebSocket Keepalive Settings")
+
+	os.Setenv("WS_PING_INTERVAL", "100ms")
+	os.Setenv("WS_STALE_TIMEOUT", "50ms")
+	fallback := config.GetWebSocketConfig()
+	report("stale timeout within the ping interval falls back", fallback.StaleTimeout > fallback.PingInterval)
+
+	os.Setenv("WS_STALE_TIMEOUT", "400ms")
+	defer os.Unsetenv("WS_PING_INTERVAL")
+	defer os.Unsetenv("WS_STALE_TIMEOUT")
+	wsConfig := config.GetWebSocketConfig()
+	report("ping interval and stale timeout are read from the environment",
+		wsConfig.PingInterval == 100*time.Millisecond && wsConfig.StaleTimeout == 400*time.Millisecond)
+	report("read deadline leaves room for a ping and its pong", wsConfig.ReadTimeout() == 200*time.Millisecond)
+
+	hub := server.NewWebSocketHub()
+	go hub.Run()
+
+	upgrader := websocket.Upgrader{}
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.SetPongHandler(func(appData string) error {
+			hub.RecordPong(conn, appData, time.Now())
+			return nil
+		})
+		userID, _ := strconv.Atoi(r.URL.Query().Get("user"))
+		hub.Register(conn, uint(userID), nil)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer wsServer.Close()
+
+	dial := func(userID int) *websocket.Conn {
+		client, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws%s?user=%d", strings.TrimPrefix(wsServer.URL, "http"), userID), nil)
+		if err != nil {
+			colors.PrintError("FAIL: could not connect client: %v", err)
+			return nil
+		}
+		return client
+	}
+	silent, answering := dial(12), dial(13)
+	if silent == nil || answering == nil {
+		return
+	}
+	defer silent.Close()
+	defer answering.Close()
+
+	// Reading answers the hub's pings with pongs; the silent client never reads
+	go func() {
+		for {
+			if _, _, err := answering.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(time.Second)
+	connected := map[uint]server.WebSocketClientStats{}
+	for _, client := range hub.ClientStats() {
+		connected[client.UserID] = client
+	}
+	_, silentConnected := connected[12]
+	report("silent client is reaped after the stale timeout", !silentConnected)
+	report("client answering pings stays connected", connected[13].LatencySamples > 0)
+
+	silent.SetReadDeadline(time.Now().Add(time.Second))
+	closed := false
+	for {
+		if _, _, err := silent.ReadMessage(); err != nil {
+			closed = !os.IsTimeout(err)
+			break
+		}
+	}
+	report("reaped client's connection is closed", closed)
+}
+
+// testSystemMessageBroadcast checks that a system message reaches every client, including
+// ones with no vehicles, and that the admin endpoint validates its request
+func testSystemMessageBroadcast() {
+	colors.PrintSubHeader("System Message Broadcast")
+
+	hub := server.NewWebSocketHub()
+	go hub.Run()
+
+	upgrader := websocket.Upgrader{}
+	wsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		userID, _ := strconv.Atoi(r.URL.Query().Get("user"))
+		var imeis []string
+		if list := r.URL.Query().Get("imeis"); list != "" {
+			imeis = strings.Split(list, ",")
+		}
+		hub.Register(conn, uint(userID), imeis)
+	}))
+	defer wsServer.Close()
+
+	var clients []*websocket.Conn
+	for _, query := range []string{"user=21&imeis=1234567890123459", "user=22&imeis=1234567890123460", "user=23"} {
+		client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(wsServer.URL, "http")+"?"+query, nil)
+		if err != nil {
+			colors.PrintError("FAIL: could not connect client: %v", err)
+			return
+		}
+		defer client.Close()
+		clients = append(clients, client)
+	}
+	time.Sleep(100 * time.Millisecond) // let the hub register the clients
+
+	sent := hub.BroadcastSystemMessage(server.SystemMessageWarning, "Maintenance in 10 min")
+	report("every connected client is a recipient", sent == len(clients))
+
+	received := 0
+	for _, client := range clients {
+		var message struct {
+			Type string               `json:"type"`
+			Data server.SystemMessage `json:"data"`
+		}
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := client.ReadJSON(&message); err == nil && message.Type == "system_message" &&
+			message.Data.Level == server.SystemMessageWarning && message.Data.Text == "Maintenance in 10 min" {
+			received++
+		}
+	}
+	report("all clients receive the system message, whatever their vehicles", received == len(clients))
+
+	router := gin.New()
+	router.POST("/broadcast", server.HandleWebSocketSystemMessage)
+	post := func(body string) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/broadcast", strings.NewReader(body)))
+		return recorder.Code
+	}
+	report("unknown level is rejected", post(`{"level":"urgent","message":"hi"}`) == http.StatusBadRequest)
+	report("blank message is rejected", post(`{"message":"   "}`) == http.StatusBadRequest)
+	report("overlong message is rejected",
+		post(`{"message":"`+strings.Repeat("x", server.MaxSystemMessageLength+1)+`"}`) == http.StatusBadRequest)
+}
+
+// testVehicleStateCleanup checks that the cleanup removes states older than the
+// configured age, keeps fresh ones and that the tracked count follows
+func testVehicleStateCleanup() {
+	colors.PrintSubHeader("Vehicle State Cleanup")
+
+	os.Setenv("VEHICLE_STATE_MAX_AGE", "2h")
+	os.Setenv("VEHICLE_STATE_CLEANUP_INTERVAL", "15m")
+	tcpConfig := config.GetTCPConfig()
+	os.Unsetenv("VEHICLE_STATE_MAX_AGE")
+	os.Unsetenv("VEHICLE_STATE_CLEANUP_INTERVAL")
+	report("max age and interval read from env", tcpConfig.VehicleStateMaxAge == 2*time.Hour &&
+		tcpConfig.VehicleStateCleanupInterval == 15*time.Minute)
+
+	os.Setenv("VEHICLE_STATE_CLEANUP_INTERVAL", "0s")
+	report("zero interval falls back to the default", config.GetTCPConfig().VehicleStateCleanupInterval == 6*time.Hour)
+	os.Unsetenv("VEHICLE_STATE_CLEANUP_INTERVAL")
+
+	notificationService := services.NewVehicleNotificationService()
+	speed := 0
+	for _, imei := range []string{"2000000000000001", "2000000000000002", "2000000000000003"} {
+		notificationService.RecordSpeed(&models.GPSData{IMEI: imei, Speed: &speed, Timestamp: time.Now()}, 60)
+	}
+	report("three states tracked", notificationService.TrackedStateCount() == 3)
+
+	// Age two states past the configured limit
+	notificationService.GetVehicleStateInfo("2000000000000001").LastUpdate = config.GetCurrentTime().Add(-3 * time.Hour)
+	notificationService.GetVehicleStateInfo("2000000000000002").LastUpdate = config.GetCurrentTime().Add(-2*time.Hour - time.Minute)
+	notificationService.GetVehicleStateInfo("2000000000000003").LastUpdate = config.GetCurrentTime().Add(-time.Hour)
+
+	removed := notificationService.CleanupOldVehicleStates(tcpConfig.VehicleStateMaxAge)
+	report("states older than the max age removed", removed == 2 &&
+		notificationService.GetVehicleStateInfo("2000000000000001") == nil &&
+		notificationService.GetVehicleStateInfo("2000000000000002") == nil)
+	report("fresh state kept", notificationService.GetVehicleStateInfo("2000000000000003") != nil)
+	report("tracked count updated", notificationService.TrackedStateCount() == 1)
+}
+
+// testMovingSpeedThreshold checks that MOVING_SPEED_KMH decides when a vehicle counts as moving
+func testMovingSpeedThreshold() {
+	colors.PrintSubHeader("Moving Speed Threshold")
+
+	report("default threshold is 5 km/h", config.GetMovingSpeedKmh() == config.DefaultMovingSpeedKmh)
+	report("4 km/h is stationary", !config.IsMovingSpeed(4, config.DefaultMovingSpeedKmh))
+	report("exactly 5 km/h is moving", config.IsMovingSpeed(5, config.DefaultMovingSpeedKmh))
+
+	os.Setenv("MOVING_SPEED_KMH", "10")
+	notificationService := services.NewVehicleNotificationService()
+	tcpConfig := config.GetTCPConfig()
+	os.Unsetenv("MOVING_SPEED_KMH")
+	report("threshold read from env", tcpConfig.MovingSpeedKmh == 10)
+
+	record := func(speed int) []services.StateTransition {
+		return notificationService.RecordSpeed(&models.GPSData{IMEI: "4000000000000001", Speed: &speed, Timestamp: time.Now()}, 60)
+	}
+	record(0)
+	report("8 km/h is not moving at a 10 km/h threshold", len(record(8)) == 0 &&
+		!notificationService.GetVehicleStateInfo("4000000000000001").IsMoving)
+	transitions := record(12)
+	report("12 km/h starts moving at a 10 km/h threshold", len(transitions) == 1 && transitions[0] == services.TransitionStartedMoving)
+	transitions = record(9)
+	report("9 km/h stops moving at a 10 km/h threshold", len(transitions) == 1 && transitions[0] == services.TransitionStoppedMoving)
+	transitions = record(10)
+	report("10 km/h starts moving at a 10 km/h threshold", len(transitions) == 1 && transitions[0] == services.TransitionStartedMoving)
+
+	os.Setenv("MOVING_SPEED_KMH", "-1")
+	report("invalid threshold falls back to the default", config.GetMovingSpeedKmh() == config.DefaultMovingSpeedKmh)
+	os.Unsetenv("MOVING_SPEED_KMH")
+}
+
+// testVehicleStateBoundaries locks the stopped/idle/running/overspeed classification
+// at each boundary, with a 60 km/h limit and the default 5 km/h moving threshold
+func testVehicleStateBoundaries() {
+	colors.PrintSubHeader("Vehicle State Boundaries")
+
+	cases := []struct {
+		speed    int
+		ignition string
+		expected services.VehicleStatus
+	}{
+		{0, "OFF", services.VehicleStatusStopped},
+		{0, "", services.VehicleStatusStopped}, // Unknown ignition is not idling
+		{0, "ON", services.VehicleStatusIdle},
+		{4, "ON", services.VehicleStatusIdle},
+		{4, "OFF", services.VehicleStatusStopped},
+		{5, "ON", services.VehicleStatusRunning},  // At the threshold is moving
+		{5, "OFF", services.VehicleStatusRunning}, // Speed wins over a stale ignition
+		{60, "ON", services.VehicleStatusRunning}, // At the limit is not overspeeding
+		{61, "ON", services.VehicleStatusOverspeed},
+		{61, "OFF", services.VehicleStatusOverspeed},
+	}
+	for _, tc := range cases {
+		state := services.DetermineVehicleState(tc.speed, tc.ignition, 60, config.DefaultMovingSpeedKmh)
+		report(fmt.Sprintf("%d km/h ignition %q is %s", tc.speed, tc.ignition, tc.expected), state == tc.expected)
+	}
+
+	report("running and overspeed count as moving", services.VehicleStatusRunning.IsMoving() &&
+		services.VehicleStatusOverspeed.IsMoving() && !services.VehicleStatusIdle.IsMoving() &&
+		!services.VehicleStatusStopped.IsMoving())
+	report("moving threshold passed in is used", services.DetermineVehicleState(8, "ON", 60, 10) == services.VehicleStatusIdle)
+}
+
+// testAllowedHours checks when a moving transition falls outside a vehicle's allowed
+// hours, which are read in the server timezone, and the alert sent for it
+func testAllowedHours() {
+	colors.PrintSubHeader("Allowed Hours")
+
+	report("valid schedules accepted", models.IsValidAllowedHours("", "") &&
+		models.IsValidAllowedHours("06:00", "22:00") && models.IsValidAllowedHours("22:00", "06:00"))
+	report("invalid schedules rejected", !models.IsValidAllowedHours("06:00", "") &&
+		!models.IsValidAllowedHours("6:00", "22:00") && !models.IsValidAllowedHours("06:00", "24:00") &&
+		!models.IsValidAllowedHours("08:00", "08:00"))
+
+	// Times of day in the server timezone
+	at := func(clock string) time.Time {
+		t, _ := config.ParseTimeInTimezone("2025-07-19 "+clock, "2006-01-02 15:04")
+		return t
+	}
+
+	daytime := &models.Vehicle{AllowedHoursStart: "06:00", AllowedHoursEnd: "22:00"}
+	report("moving inside daytime hours is allowed", services.IsWithinAllowedHours(daytime, at("12:30")))
+	report("start of the window is inside", services.IsWithinAllowedHours(daytime, at("06:00")))
+	report("end of the window is outside", !services.IsWithinAllowedHours(daytime, at("22:00")))
+	report("moving at night is outside daytime hours", !services.IsWithinAllowedHours(daytime, at("02:15")))
+
+	overnight := &models.Vehicle{AllowedHoursStart: "22:00", AllowedHoursEnd: "06:00"}
+	report("overnight window allows late night", services.IsWithinAllowedHours(overnight, at("23:30")) &&
+		services.IsWithinAllowedHours(overnight, at("05:59")))
+	report("overnight window rejects midday", !services.IsWithinAllowedHours(overnight, at("12:00")))
+
+	report("vehicle without a schedule is always allowed", services.IsWithinAllowedHours(&models.Vehicle{}, at("03:00")))
+
+	// The same instant in UTC is read in the server timezone, not as 02:15
+	utc := time.Date(2025, 7, 19, 2, 15, 0, 0, time.UTC)
+	local := config.InAppTimezone(utc)
+	report("UTC timestamps use the server timezone", services.IsWithinAllowedHours(daytime, utc) ==
+		(local.Hour() >= 6 && local.Hour() < 22))
+
+	// A moving transition is what triggers the check
+	notificationService := services.NewVehicleNotificationService()
+	record := func(speed int, timestamp time.Time) []services.StateTransition {
+		return notificationService.RecordSpeed(&models.GPSData{IMEI: "4100000000000001", Speed: &speed, Timestamp: timestamp}, 60)
+	}
+	record(0, at("02:14"))
+	transitions := record(30, at("02:15"))
+	report("starting to move at night is a moving transition outside the hours", len(transitions) == 1 &&
+		transitions[0] == services.TransitionStartedMoving && !services.IsWithinAllowedHours(daytime, at("02:15")))
+
+	alert := services.DefaultNotificationTemplates[string(services.NotificationTypeOffHoursMovement)]
+	body, missing := services.RenderTemplate(alert.Body, map[string]string{
+		"speed": "30", "allowed_start": "06:00", "allowed_end": "22:00", "date": "2025-07-19", "time": "02:15 AM",
+	})
+	report("off-hours alert is an urgent alarm", alert.Type == "alarm" && len(missing) == 0 &&
+		strings.Contains(body, "06:00 - 22:00") && strings.Contains(body, "30 km/h"))
+	nepali, exists := services.NepaliNotificationTemplates[string(services.NotificationTypeOffHoursMovement)]
+	report("off-hours alert has a Nepali translation", exists && nepali.Type == "alarm" &&
+		len(services.TemplateVariables(nepali.Body)) == len(services.TemplateVariables(alert.Body)))
+}
+
+// testTowAwayDetection moves a parked vehicle with its ignition off and checks that
+// only sustained displacement, not GPS drift or a stray fix, raises the alert
+func testTowAwayDetection() {
+	colors.PrintSubHeader("Tow-Away Detection")
+
+	towConfig := config.GetTowAwayConfig()
+	report("default tow-away thresholds", towConfig.DistanceMeters == 200 && towConfig.MinDuration == 2*time.Minute)
+
+	notificationService := services.NewVehicleNotificationService()
+	const imei = "4200000000000001"
+	parkedAt := time.Date(2025, 7, 19, 1, 0, 0, 0, time.UTC)
+	record := func(ignition string, latitude float64, minutes int) bool {
+		_, towed := notificationService.RecordParkedPosition(imei, ignition, latitude, 85.3240, parkedAt.Add(time.Duration(minutes)*time.Minute))
+		return towed
+	}
+
+	// 0.0002° of latitude is about 22 m, 0.0027° about 300 m and 0.0045° about 500 m
+	report("parking sets the spot without an alert", !record("OFF", 27.7172, 0))
+	report("GPS drift while parked is ignored", !record("OFF", 27.7174, 1) && !record("OFF", 27.7170, 2))
+	report("one stray fix is not towing", !record("OFF", 27.7217, 3))
+	report("fix back at the spot ends the run", !record("OFF", 27.7172, 20))
+
+	report("moving away with ignition off is not towing at once", !record("OFF", 27.7199, 30) && !record("OFF", 27.7205, 31))
+	report("sustained displacement with ignition off raises the alert", record("OFF", 27.7215, 32))
+	report("alert is sent once per parking", !record("OFF", 27.7250, 35))
+
+	report("unknown ignition leaves the spot alone", !record("", 27.7300, 36) &&
+		notificationService.GetVehicleStateInfo(imei).Parked != nil)
+	report("ignition on forgets the spot", !record("ON", 27.7300, 40) &&
+		notificationService.GetVehicleStateInfo(imei).Parked == nil)
+	report("driving with ignition on never alerts", !record("ON", 27.7400, 45) && !record("ON", 27.7500, 50))
+	report("parking again sets a new spot", !record("OFF", 27.7500, 60) && !record("OFF", 27.7501, 70))
+
+	os.Setenv("TOW_AWAY_DISTANCE_METERS", "0")
+	disabled := services.NewVehicleNotificationService()
+	os.Unsetenv("TOW_AWAY_DISTANCE_METERS")
+	disabled.RecordParkedPosition(imei, "OFF", 27.7172, 85.3240, parkedAt)
+	disabled.RecordParkedPosition(imei, "OFF", 27.7300, 85.3240, parkedAt.Add(5*time.Minute))
+	_, towed := disabled.RecordParkedPosition(imei, "OFF", 27.7300, 85.3240, parkedAt.Add(10*time.Minute))
+	report("0 meters disables detection", !towed)
+
+	alert := services.DefaultNotificationTemplates[string(services.NotificationTypeTowAway)]
+	_, exists := services.NepaliNotificationTemplates[string(services.NotificationTypeTowAway)]
+	report("tow-away alert is an urgent alarm with a Nepali translation", alert.Type == "alarm" && exists)
+}
+
+func containsToken(tokens []string, token string) bool {
+	for _, t := range tokens {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+// report prints a pass/fail line for a single assertion
+func report(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
 }
 
 // simulateStateTransition simulates the state transition logic without database access
@@ -141,8 +1139,11 @@ func simulateStateTransition(service *services.VehicleNotificationService, gpsDa
 		currentSpeed := *gpsData.Speed
 		colors.PrintInfo("🏃 Current speed: %d km/h", currentSpeed)
 
+		// Same classification as the service, with the default overspeed limit
+		status := services.DetermineVehicleState(currentSpeed, "", 60, config.GetMovingSpeedKmh())
+
 		// Check for overspeed state change
-		isCurrentlyOverspeeding := currentSpeed > 60 // Default overspeed limit
+		isCurrentlyOverspeeding := status == services.VehicleStatusOverspeed
 		if isCurrentlyOverspeeding && !vehicleState.IsOverspeeding {
 			// Transition from normal speed to overspeed
 			colors.PrintWarning("🚨 Overspeed detected! Speed: %d km/h", currentSpeed)
@@ -161,7 +1162,7 @@ func simulateStateTransition(service *services.VehicleNotificationService, gpsDa
 		}
 
 		// Check for moving state change
-		isCurrentlyMoving := currentSpeed > 5
+		isCurrentlyMoving := status.IsMoving()
 		if isCurrentlyMoving && !vehicleState.IsMoving {
 			// Transition from stopped to moving
 			colors.PrintInfo("🏃 Vehicle started moving! Speed: %d km/h (previous: %d)", currentSpeed, vehicleState.LastSpeed)
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/http/middleware"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/internal/tcp"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// panicByte makes panickingDecoder panic when it is received
+const panicByte = 0xFF
+
+// panickingDecoder stands in for a decoder bug triggered by one device's data
+type panickingDecoder struct{}
+
+func (panickingDecoder) AddData(data []byte) ([]*protocol.DecodedPacket, error) {
+	for _, b := range data {
+		if b == panicByte {
+			var packets map[string]*protocol.DecodedPacket
+			packets["boom"] = nil
+		}
+	}
+	return nil, nil
+}
+
+func (panickingDecoder) GenerateResponse(serialNumber uint16, protocolNumber byte) []byte {
+	return nil
+}
+
+func main() {
+	colors.PrintHeader("PANIC RECOVERY TESTING")
+
+	testHandlerPanic()
+	testConnectionPanic()
+	testDecoderFuzz()
+
+	colors.PrintSuccess("Panic recovery testing completed!")
+}
+
+// testHandlerPanic checks that a panicking handler returns a JSON 500 and the router keeps serving
+func testHandlerPanic() {
+	colors.PrintSubHeader("HTTP Handler Panic")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.RequestIDMiddleware(), middleware.RecoveryMiddleware())
+	router.GET("/panic", func(c *gin.Context) {
+		c.Set("user", "not a user")
+		currentUser, _ := c.Get("user")
+		user := currentUser.(*models.User)
+		c.JSON(http.StatusOK, gin.H{"user": user.ID})
+	})
+	router.GET("/ok", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(middleware.RequestIDHeader, "panic-test")
+	router.ServeHTTP(recorder, req)
+
+	var response struct {
+		Success   bool   `json:"success"`
+		Error     string `json:"error"`
+		RequestID string `json:"request_id"`
+	}
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	check("Panicking handler answered with 500", recorder.Code == http.StatusInternalServerError)
+	check("500 body is JSON with the request ID", err == nil && !response.Success && response.RequestID == "panic-test")
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	check("Router still serves requests after the panic", recorder.Code == http.StatusOK)
+}
+
+// testConnectionPanic checks that a panic while handling one device connection closes
+// only that connection and the listener keeps accepting devices
+func testConnectionPanic() {
+	colors.PrintSubHeader("TCP Connection Panic")
+
+	port, err := freePort()
+	if !check("Free port found", err == nil) {
+		return
+	}
+
+	tcp.RegisterDecoderFactory("panicking", func() tcp.PacketDecoder { return panickingDecoder{} })
+	listenerConfigs, err := tcp.ParseListenerConfigs(port + ":panicking")
+	if !check("Listener configured with the panicking decoder", err == nil) {
+		return
+	}
+
+	server := tcp.NewServerWithListeners(listenerConfigs, controllers.NewControlController())
+	go server.Start()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	bad, err := dialWithRetry("127.0.0.1:" + port)
+	if !check("Device connected", err == nil) {
+		return
+	}
+	defer bad.Close()
+	bad.Write([]byte{panicByte})
+	bad.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err = bad.Read(make([]byte, 1))
+	netErr, timedOut := err.(net.Error)
+	check("Connection that caused the panic was closed", err != nil && !(timedOut && netErr.Timeout()))
+
+	good, err := net.DialTimeout("tcp", "127.0.0.1:"+port, 2*time.Second)
+	if !check("Listener still accepts devices after the panic", err == nil) {
+		return
+	}
+	defer good.Close()
+	good.Write([]byte{0x01})
+	good.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, err = good.Read(make([]byte, 1))
+	netErr, timedOut = err.(net.Error)
+	check("Other device's connection stays open", timedOut && netErr.Timeout())
+	check("Panicked connection released", server.ConnectionStats().Current == 1)
+}
+
+// fuzzSeeds are valid GT06 frames that the fuzzer mutates, so inputs reach past the start bits:
+// a standard login frame, an extended information frame and a GPS frame
+var fuzzSeeds = []string{
+	"78780D01012345678901234500010000" + "0D0A",
+	"7979000894" + "0004D2" + "0001" + "0000" + "0D0A",
+	"78781F12" + "18060F081E00" + "C9" + "02F94690" + "09277E60" + "28" + "005A" + "01AD" + "01" + "1234" + "00ABCD" + "0001" + "0000" + "0D0A",
+}
+
+// testDecoderFuzz feeds random and mutated frames to the GT06 decoder in random chunks and
+// checks that no panic escapes DecodeSafely
+func testDecoderFuzz() {
+	colors.PrintSubHeader("GT06 Decoder Fuzzing")
+
+	const seed, iterations = 1619, 20000
+	rng := rand.New(rand.NewSource(seed))
+	seeds := make([][]byte, len(fuzzSeeds))
+	for i, frame := range fuzzSeeds {
+		seeds[i], _ = hex.DecodeString(frame)
+	}
+
+	escaped, recovered, malformed := 0, 0, 0
+	for i := 0; i < iterations; i++ {
+		input := fuzzInput(rng, seeds)
+		decoder := protocol.NewGT06Decoder()
+		for len(input) > 0 {
+			chunk := 1 + rng.Intn(len(input))
+			err := decodeGuarded(decoder, input[:chunk])
+			input = input[chunk:]
+			if err == errEscaped {
+				escaped++
+				break
+			}
+			if errors.Is(err, tcp.ErrDecoderPanic) {
+				recovered++
+				break
+			}
+			if err != nil {
+				malformed++
+			}
+		}
+	}
+
+	colors.PrintInfo("%d inputs (seed %d): %d rejected as malformed, %d decoder panics recovered",
+		iterations, seed, malformed, recovered)
+	check("No decoder panic escaped DecodeSafely", escaped == 0)
+
+	_, err := tcp.DecodeSafely(panickingDecoder{}, []byte{panicByte})
+	check("Decoder panic reported as ErrDecoderPanic", errors.Is(err, tcp.ErrDecoderPanic))
+}
+
+// errEscaped marks a panic that got past DecodeSafely
+var errEscaped = errors.New("panic escaped DecodeSafely")
+
+// decodeGuarded calls DecodeSafely, reporting any panic that escapes it as errEscaped
+func decodeGuarded(decoder tcp.PacketDecoder, data []byte) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = errEscaped
+		}
+	}()
+	_, err = tcp.DecodeSafely(decoder, data)
+	return err
+}
+
+// fuzzInput returns either random bytes or a seed frame with random bytes flipped,
+// inserted or cut off
+func fuzzInput(rng *rand.Rand, seeds [][]byte) []byte {
+	if rng.Intn(4) == 0 {
+		input := make([]byte, 1+rng.Intn(64))
+		rng.Read(input)
+		return input
+	}
+
+	input := append([]byte(nil), seeds[rng.Intn(len(seeds))]...)
+	for mutations := 1 + rng.Intn(4); mutations > 0; mutations-- {
+		position := rng.Intn(len(input))
+		switch rng.Intn(3) {
+		case 0:
+			input[position] = byte(rng.Intn(256))
+		case 1:
+			input = append(input[:position], append([]byte{byte(rng.Intn(256))}, input[position:]...)...)
+		default:
+			input = input[:position+1]
+		}
+	}
+	return input
+}
+
+// freePort returns a TCP port that was free a moment ago
+func freePort() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	return port, err
+}
+
+// dialWithRetry connects to the server, waiting briefly for it to start listening
+func dialWithRetry(address string) (net.Conn, error) {
+	var err error
+	for i := 0; i < 20; i++ {
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", address, time.Second); err == nil {
+			return conn, nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil, err
+}
+
+// check prints a PASS or FAIL line for one expectation and returns the result
+func check(desc string, ok bool) bool {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+	return ok
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testIMEI = "0999000000000001"
+
+func main() {
+	if err := config.InitializeTimezone(); err != nil {
+		colors.PrintError("Failed to initialize timezone: %v", err)
+		return
+	}
+
+	colors.PrintHeader("GPS RETENTION TESTING")
+
+	testRetentionCutoffs()
+	testPurgeSchedule()
+	testPurge()
+
+	colors.PrintSuccess("GPS retention testing completed!")
+}
+
+// testRetentionCutoffs checks the cutoff timestamps for ordinary and alarm rows
+func testRetentionCutoffs() {
+	colors.PrintSubHeader("Retention Cutoffs")
+
+	now := time.Date(2024, 6, 15, 2, 0, 0, 0, time.UTC)
+
+	cfg := &config.RetentionConfig{GPSRetentionDays: 90, AlarmRetentionDays: 365}
+	positionCutoff, alarmCutoff := services.RetentionCutoffs(now, cfg)
+	check("Position rows cut off 90 days back", positionCutoff.Equal(now.AddDate(0, 0, -90)))
+	check("Alarm rows cut off 365 days back", alarmCutoff.Equal(now.AddDate(0, 0, -365)))
+
+	cfg = &config.RetentionConfig{GPSRetentionDays: 90}
+	_, alarmCutoff = services.RetentionCutoffs(now, cfg)
+	check("Unset alarm retention follows GPS retention", alarmCutoff.Equal(now.AddDate(0, 0, -90)))
+
+	cfg = &config.RetentionConfig{GPSRetentionDays: 90, AlarmRetentionDays: 30}
+	_, alarmCutoff = services.RetentionCutoffs(now, cfg)
+	check("Alarm rows are never purged sooner than other rows", alarmCutoff.Equal(now.AddDate(0, 0, -90)))
+
+	check("Retention of 0 days disables the purge", !(&config.RetentionConfig{}).IsEnabled())
+}
+
+// testPurgeSchedule checks that the purge is scheduled for the next off-peak hour
+func testPurgeSchedule() {
+	colors.PrintSubHeader("Purge Schedule")
+
+	loc := time.FixedZone("NPT", 5*3600+45*60)
+
+	beforeHour := time.Date(2024, 6, 15, 1, 30, 0, 0, loc)
+	check("Before 02:00 runs the same day", services.NextPurgeTime(beforeHour, 2).Equal(time.Date(2024, 6, 15, 2, 0, 0, 0, loc)))
+
+	atHour := time.Date(2024, 6, 15, 2, 0, 0, 0, loc)
+	check("At 02:00 runs the next day", services.NextPurgeTime(atHour, 2).Equal(time.Date(2024, 6, 16, 2, 0, 0, 0, loc)))
+
+	afterHour := time.Date(2024, 6, 30, 23, 59, 0, 0, loc)
+	check("After 02:00 runs the next day across month end", services.NextPurgeTime(afterHour, 2).Equal(time.Date(2024, 7, 1, 2, 0, 0, 0, loc)))
+}
+
+// testPurge inserts old and recent rows into a scratch database and checks that only
+// rows past their retention period are removed. The database is named by
+// TEST_DATABASE_DSN; every GPS row in it older than the cutoff is deleted.
+func testPurge() {
+	colors.PrintSubHeader("Purge Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the purge test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate gps_data: %v", err)
+		return
+	}
+	conn.Where("imei = ?", testIMEI).Delete(&models.GPSData{})
+	defer conn.Where("imei = ?", testIMEI).Delete(&models.GPSData{})
+
+	now := time.Now()
+	rows := []models.GPSData{
+		{IMEI: testIMEI, Timestamp: now.AddDate(0, 0, -100), ProtocolName: "old-position"},
+		{IMEI: testIMEI, Timestamp: now.AddDate(0, 0, -95), ProtocolName: "old-position-2"},
+		{IMEI: testIMEI, Timestamp: now.AddDate(0, 0, -10), ProtocolName: "recent-position"},
+		{IMEI: testIMEI, Timestamp: now.AddDate(0, 0, -100), AlarmActive: true, ProtocolName: "old-alarm"},
+		{IMEI: testIMEI, Timestamp: now.AddDate(0, 0, -400), AlarmActive: true, ProtocolName: "expired-alarm"},
+	}
+	if err := conn.Create(&rows).Error; err != nil {
+		colors.PrintError("FAIL: insert test rows: %v", err)
+		return
+	}
+
+	retention := services.NewGPSRetentionServiceWithConfig(&config.RetentionConfig{
+		GPSRetentionDays:   90,
+		AlarmRetentionDays: 365,
+		Mode:               config.GPSCleanupDelete,
+		BatchSize:          1,
+	})
+	result, err := retention.PurgeOnce(now)
+	if err != nil {
+		colors.PrintError("FAIL: purge: %v", err)
+		return
+	}
+
+	var remaining []models.GPSData
+	conn.Where("imei = ?", testIMEI).Order("protocol_name ASC").Find(&remaining)
+	names := make(map[string]bool)
+	for _, row := range remaining {
+		names[row.ProtocolName] = true
+	}
+
+	check("Old position rows purged", !names["old-position"] && !names["old-position-2"])
+	check("Recent position row kept", names["recent-position"])
+	check("Alarm row within alarm retention kept", names["old-alarm"])
+	check("Alarm row past alarm retention purged", !names["expired-alarm"])
+	check("Purged counts reported", result.PositionRows >= 2 && result.AlarmRows >= 1)
+}
+
+// check prints a PASS or FAIL line for one expectation
+func check(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/internal/tcp"
+	"luna_iot_server/pkg/colors"
+)
+
+// received reports which protocol's decoder got data, so a test can tell the listeners apart
+var received = make(chan string, 16)
+
+// recordingDecoder stands in for a protocol decoder and reports every chunk it is given
+type recordingDecoder struct {
+	protocol string
+}
+
+func (d recordingDecoder) AddData(data []byte) ([]*protocol.DecodedPacket, error) {
+	received <- d.protocol
+	return nil, nil
+}
+
+func (recordingDecoder) GenerateResponse(serialNumber uint16, protocolNumber byte) []byte {
+	return nil
+}
+
+func main() {
+	colors.PrintHeader("TCP SERVER TESTING")
+
+	testMultipleListeners()
+	testGracefulStop()
+	testConnectionLimit()
+
+	colors.PrintSuccess("TCP server testing completed!")
+}
+
+// testMultipleListeners starts one server on two ports with different protocols and checks
+// that a device can connect to each and is served by that port's decoder
+func testMultipleListeners() {
+	colors.PrintSubHeader("Multiple Listeners")
+
+	firstPort, err := freePort()
+	if !check("First free port found", err == nil) {
+		return
+	}
+	secondPort, err := freePort()
+	if !check("Second free port found", err == nil && secondPort != firstPort) {
+		return
+	}
+
+	tcp.RegisterDecoderFactory("test-first", func() tcp.PacketDecoder { return recordingDecoder{protocol: "test-first"} })
+	tcp.RegisterDecoderFactory("test-second", func() tcp.PacketDecoder { return recordingDecoder{protocol: "test-second"} })
+	listenerConfigs, err := tcp.ParseListenerConfigs(firstPort + ":test-first," + secondPort + ":test-second")
+	if !check("Two listeners configured", err == nil && len(listenerConfigs) == 2) {
+		return
+	}
+
+	server := tcp.NewServerWithListeners(listenerConfigs, controllers.NewControlController())
+	go server.Start()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	for _, listener := range []struct {
+		port     string
+		protocol string
+	}{
+		{firstPort, "test-first"},
+		{secondPort, "test-second"},
+	} {
+		conn, err := dialWithRetry("127.0.0.1:" + listener.port)
+		if !check("Device connected on port "+listener.port, err == nil) {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte{0x01})
+		select {
+		case got := <-received:
+			check("Data on port "+listener.port+" decoded as "+listener.protocol, got == listener.protocol)
+		case <-time.After(3 * time.Second):
+			check("Data on port "+listener.port+" decoded", false)
+		}
+	}
+
+	check("Both connections counted", server.ConnectionStats().Current == 2)
+}
+
+// testGracefulStop stops a server with a device connected and checks that Stop closes the
+// listener and the connection and returns well before its deadline
+func testGracefulStop() {
+	colors.PrintSubHeader("Graceful Stop")
+
+	port, err := freePort()
+	if !check("Free port found", err == nil) {
+		return
+	}
+
+	tcp.RegisterDecoderFactory("test-stop", func() tcp.PacketDecoder { return recordingDecoder{protocol: "test-stop"} })
+	listenerConfigs, err := tcp.ParseListenerConfigs(port + ":test-stop")
+	if !check("Listener configured", err == nil) {
+		return
+	}
+
+	server := tcp.NewServerWithListeners(listenerConfigs, controllers.NewControlController())
+	started := make(chan error, 1)
+	go func() { started <- server.Start() }()
+
+	conn, err := dialWithRetry("127.0.0.1:" + port)
+	if !check("Device connected", err == nil) {
+		return
+	}
+	defer conn.Close()
+
+	// Wait until the handler is reading, so the connection is tracked before Stop
+	conn.Write([]byte{0x01})
+	select {
+	case <-received:
+	case <-time.After(3 * time.Second):
+		check("Connection handled before stopping", false)
+		return
+	}
+
+	const deadline = 5 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	begin := time.Now()
+	err = server.Stop(ctx)
+	elapsed := time.Since(begin)
+	check("Stop returned without error", err == nil)
+	check("Stop returned before the deadline", elapsed < deadline/2)
+
+	select {
+	case err := <-started:
+		check("Start returned after Stop", err == nil)
+	case <-time.After(3 * time.Second):
+		check("Start returned after Stop", false)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	netErr, timedOut := err.(net.Error)
+	check("Device connection closed by the server", err != nil && !(timedOut && netErr.Timeout()))
+	check("No connections left open", server.ConnectionStats().Current == 0)
+
+	_, err = net.DialTimeout("tcp", "127.0.0.1:"+port, time.Second)
+	check("Listener closed", err != nil)
+
+	check("Stopping again is harmless", server.Stop(context.Background()) == nil)
+}
+
+// testConnectionLimit checks that the connection limit is off by default and that with a
+// limit of N the server refuses connection N+1 while keeping the first N open
+func testConnectionLimit() {
+	colors.PrintSubHeader("Connection Limit")
+
+	previous, wasSet := os.LookupEnv("MAX_TCP_CONNECTIONS")
+	defer func() {
+		if wasSet {
+			os.Setenv("MAX_TCP_CONNECTIONS", previous)
+		} else {
+			os.Unsetenv("MAX_TCP_CONNECTIONS")
+		}
+	}()
+
+	os.Unsetenv("MAX_TCP_CONNECTIONS")
+	check("No connection limit by default", config.GetTCPConfig().MaxConnections == 0)
+
+	const limit = 2
+	os.Setenv("MAX_TCP_CONNECTIONS", strconv.Itoa(limit))
+
+	port, err := freePort()
+	if !check("Free port found", err == nil) {
+		return
+	}
+
+	tcp.RegisterDecoderFactory("test-limit", func() tcp.PacketDecoder { return recordingDecoder{protocol: "test-limit"} })
+	listenerConfigs, err := tcp.ParseListenerConfigs(port + ":test-limit")
+	if !check("Listener configured", err == nil) {
+		return
+	}
+
+	server := tcp.NewServerWithListeners(listenerConfigs, controllers.NewControlController())
+	go server.Start()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	// Fill the limit, waiting for each handler so the slots are taken in order
+	for i := 0; i < limit; i++ {
+		conn, err := dialWithRetry("127.0.0.1:" + port)
+		if !check(fmt.Sprintf("Connection %d accepted", i+1), err == nil) {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte{0x01})
+		select {
+		case <-received:
+		case <-time.After(3 * time.Second):
+			check(fmt.Sprintf("Connection %d handled", i+1), false)
+			return
+		}
+	}
+
+	refused, err := net.DialTimeout("tcp", "127.0.0.1:"+port, time.Second)
+	if !check("Connection over the limit reached the listener", err == nil) {
+		return
+	}
+	defer refused.Close()
+	refused.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = refused.Read(make([]byte, 1))
+	netErr, timedOut := err.(net.Error)
+	check(fmt.Sprintf("Connection %d closed by the server", limit+1), err != nil && !(timedOut && netErr.Timeout()))
+
+	stats := server.ConnectionStats()
+	check("Refused connection counted as rejected", stats.Rejected == 1)
+	check("Connections within the limit stay open", stats.Current == limit && stats.Max == limit)
+}
+
+// freePort returns a TCP port that was free a moment ago
+func freePort() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	return port, err
+}
+
+// dialWithRetry connects to the server, waiting briefly for it to start listening
+func dialWithRetry(address string) (net.Conn, error) {
+	var err error
+	for i := 0; i < 20; i++ {
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", address, time.Second); err == nil {
+			return conn, nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil, err
+}
+
+// check prints a PASS or FAIL line for one expectation and returns the result
+func check(desc string, ok bool) bool {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+	return ok
+}
@@ -1,13 +1,27 @@
 package main
 
 import (
+	"encoding/json"
 	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/models"
 	"luna_iot_server/pkg/colors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
+// historyIMEI is the vehicle used by the history timestamp test in the scratch database
+const historyIMEI = "0999000000000051"
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
@@ -47,5 +61,133 @@ func main() {
 	colors.PrintInfo("System time: %s", systemTime.Format("2006-01-02 15:04:05 MST"))
 	colors.PrintInfo("Kathmandu time: %s", currentTime.Format("2006-01-02 15:04:05 MST"))
 
+	testTimestampOutput()
+	testTimestampQueries()
+
 	colors.PrintSuccess("✅ Timezone test completed successfully!")
 }
+
+// testTimestampOutput checks that response timestamps carry the Kathmandu offset
+func testTimestampOutput() {
+	colors.PrintSubHeader("Response Timestamps")
+
+	os.Setenv("APP_TIMEZONE", "Asia/Kathmandu")
+	if err := config.InitializeTimezone(); err != nil {
+		colors.PrintError("FAIL: timezone not initialized: %v", err)
+		return
+	}
+
+	known := time.Date(2025, 7, 19, 12, 45, 0, 0, time.UTC)
+	check("formatted with +05:45 offset", config.FormatTimestamp(known) == "2025-07-19T18:30:00+05:45")
+
+	check("host timezone left as it was", time.Local.String() == "Local")
+
+	parsed, err := config.ParseTimestamp("2025-07-19T12:45:00Z")
+	check("legacy Z timestamps still parse as UTC", err == nil && parsed.Equal(known))
+
+	parsed, err = config.ParseTimestamp("2025-07-19T18:30:00+05:45")
+	check("offset timestamps parse to the same instant", err == nil && parsed.Equal(known))
+
+	parsed, err = config.ParseTimestamp("2025-07-19T18:30:00")
+	check("timestamps without offset use Kathmandu time", err == nil && parsed.Equal(known))
+
+	query, _ := url.ParseQuery("from=2025-07-19T18:30:00+05:45")
+	parsed, err = config.ParseTimestamp(query.Get("from"))
+	check("offset sent with an unencoded + parses", err == nil && parsed.Equal(known))
+
+	_, err = config.ParseTimestamp("19/07/2025")
+	check("invalid timestamps rejected", err != nil)
+}
+
+// testTimestampQueries checks that GPS data and history requests reject a from or to they
+// cannot parse instead of ignoring it, and that times read from the database carry the
+// Kathmandu offset. The history and database checks need TEST_DATABASE_DSN.
+func testTimestampQueries() {
+	colors.PrintSubHeader("Timestamp Query Parameters")
+
+	// The filters are parsed before the query runs, so an unreachable database will do
+	unreachable, err := db.Open("host=127.0.0.1 port=1 user=none dbname=none sslmode=disable connect_timeout=1",
+		&gorm.Config{DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: offline database handle: %v", err)
+		return
+	}
+	db.DB = unreachable
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/gps", controllers.NewGPSController().GetGPSData)
+	router.GET("/gps/:imei", controllers.NewGPSController().GetGPSDataByIMEI)
+	for _, target := range []string{"/gps?from=yesterday", "/gps?to=19/07/2025", "/gps/" + historyIMEI + "?from=yesterday"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		check("bad timestamp rejected: "+target, recorder.Code == http.StatusBadRequest)
+	}
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the history timestamp test")
+		return
+	}
+
+	conn, err := db.Open(dsn, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+
+	var stored time.Time
+	conn.Raw("SELECT '2025-07-19T12:45:00Z'::timestamptz").Scan(&stored)
+	encoded, _ := json.Marshal(struct {
+		Timestamp time.Time `json:"timestamp"`
+	}{stored})
+	check("database times serialize with the offset", string(encoded) == `{"timestamp":"2025-07-19T18:30:00+05:45"}`)
+
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate history tables: %v", err)
+		return
+	}
+	cleanup := func() {
+		conn.Unscoped().Where("imei = ?", historyIMEI).Delete(&models.GPSData{})
+		conn.Where("vehicle_id = ?", historyIMEI).Delete(&models.UserVehicle{})
+		conn.Where("imei = ?", historyIMEI).Delete(&models.Vehicle{})
+		conn.Where("phone = ?", "9800000051").Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "History owner", Phone: "9800000051", Email: "history-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-history-timestamps"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	vehicle := models.Vehicle{IMEI: historyIMEI, RegNo: "TEST-HISTORY-TZ", Name: "History test", VehicleType: models.VehicleTypeCar}
+	if err := conn.Create(&vehicle).Error; err != nil {
+		colors.PrintError("FAIL: create test vehicle: %v", err)
+		return
+	}
+	conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: historyIMEI, History: true, IsActive: true})
+
+	router.GET("/my-tracking/:imei/history", func(c *gin.Context) { c.Set("user", &owner) },
+		controllers.NewUserTrackingController(nil).GetMyVehicleHistory)
+	history := func(query string) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/my-tracking/"+historyIMEI+"/history?"+query, nil))
+		return recorder.Code
+	}
+	check("history rejects a bad from", history("from=yesterday") == http.StatusBadRequest)
+	check("history rejects a bad to", history("to=19/07/2025") == http.StatusBadRequest)
+	check("history accepts an offset with an unencoded +",
+		history("from=2025-07-19T18:30:00+05:45&to=2025-07-19T20:30:00+05:45") == http.StatusOK)
+}
+
+// check prints a pass/fail line for a single assertion
+func check(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+}
@@ -0,0 +1,1631 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/internal/tcp"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testIMEI is only used in the scratch database
+const testIMEI = "0000000000000094"
+
+// Vehicles used by the group tests in the scratch database
+const (
+	groupedIMEI   = "0000000000000095"
+	ungroupedIMEI = "0000000000000096"
+)
+
+// snapshotIMEI is the vehicle used by the live snapshot test in the scratch database
+const snapshotIMEI = "0000000000000097"
+
+// cacheIMEI is the vehicle used by the latest GPS cache test in the scratch database
+const cacheIMEI = "0000000000000140"
+
+// Vehicles used by the comparison test in the scratch database; the last one is not the user's
+var compareIMEIs = []string{"0000000000000141", "0000000000000142", "0000000000000143"}
+
+// Vehicles used by the batch latest test in the scratch database; the last one is not the user's
+var batchIMEIs = []string{"0000000000000150", "0000000000000151", "0000000000000152"}
+
+// Vehicles used by the online status test in the scratch database, named by their state
+var onlineIMEIs = map[string]string{
+	"reporting":  "0000000000000160",
+	"offline":    "0000000000000161",
+	"connected":  "0000000000000162",
+	"never_seen": "0000000000000163",
+	"not_yours":  "0000000000000164",
+}
+
+// Vehicles used by the archive test in the scratch database; the second one fails to archive
+var archiveIMEIs = []string{"0000000000000170", "0000000000000171"}
+
+// Vehicles used by the GPS cleanup test in the scratch database; the second keeps its history
+var cleanupIMEIs = []string{"0000000000000172", "0000000000000173"}
+
+// odometerIMEI is the vehicle used by the odometer calibration test in the scratch database
+const odometerIMEI = "0000000000000174"
+
+// Vehicles used by the fleet summary test in the scratch database
+var fleetIMEIs = []string{"0000000000000110", "0000000000000111", "0000000000000112", "0000000000000113"}
+
+// Vehicles used by the status filter test in the scratch database, named by their state
+var statusIMEIs = map[string]string{
+	"moving":    "0000000000000120",
+	"idle":      "0000000000000121",
+	"parked":    "0000000000000122",
+	"connected": "0000000000000123",
+	"stale":     "0000000000000124",
+	"silent":    "0000000000000125",
+}
+
+// loginDecoder turns "LOGIN <imei>" into a login packet and anything else into a
+// heartbeat, both needing a one-byte acknowledgement
+type loginDecoder struct{}
+
+func (loginDecoder) AddData(data []byte) ([]*protocol.DecodedPacket, error) {
+	if imei, found := strings.CutPrefix(string(data), "LOGIN "); found {
+		return []*protocol.DecodedPacket{{ProtocolName: "LOGIN", TerminalID: imei, NeedsResponse: true}}, nil
+	}
+	return []*protocol.DecodedPacket{{ProtocolName: "HEARTBEAT", NeedsResponse: true}}, nil
+}
+
+func (loginDecoder) GenerateResponse(serialNumber uint16, protocolNumber byte) []byte {
+	return []byte{0x01}
+}
+
+func main() {
+	if err := config.InitializeTimezone(); err != nil {
+		colors.PrintError("Failed to initialize timezone: %v", err)
+		return
+	}
+
+	colors.PrintHeader("VEHICLE TESTING")
+
+	testAppearanceValidation()
+	testAppearancePayload()
+	testAppearanceStorage()
+	testGroupFilter()
+	testGroupTracking()
+	testLiveSnapshot()
+	testBatchLatest()
+	testOnlineStatus()
+	testFleetSummary()
+	testFleetSummaryEndpoint()
+	testStatusFilterValidation()
+	testStatusFilter()
+	testVehicleSortParsing()
+	testVehicleSort()
+	testLatestGPSCache()
+	testLatestGPSCacheIngest()
+	testHistoryRangeLimit()
+	testCompareValidation()
+	testCompareVehicles()
+	testArchiveBeforeDelete()
+	testDeleteGPSCleanup()
+	testOdometerCalibration()
+
+	colors.PrintSuccess("Vehicle testing completed!")
+}
+
+// testAppearanceValidation checks which colors and icon types are accepted
+func testAppearanceValidation() {
+	colors.PrintSubHeader("Color And Icon Validation")
+
+	for _, color := range []string{"", "#1E88E5", "#1e88e5", "#FFF"} {
+		check("Color "+quote(color)+" accepted", models.IsValidVehicleColor(color))
+	}
+	for _, color := range []string{"1E88E5", "#1E88E", "#GGGGGG", "red", "#1E88E5FF"} {
+		check("Color "+quote(color)+" rejected", !models.IsValidVehicleColor(color))
+	}
+
+	for _, iconType := range []string{"", "car", "pickup_truck", "bus-2"} {
+		check("Icon type "+quote(iconType)+" accepted", models.IsValidVehicleIconType(iconType))
+	}
+	for _, iconType := range []string{"Car", "pickup truck", "<svg>", "a_very_long_icon_name_that_goes_on"} {
+		check("Icon type "+quote(iconType)+" rejected", !models.IsValidVehicleIconType(iconType))
+	}
+}
+
+// testAppearancePayload checks the fields bind from a create payload and appear in responses
+func testAppearancePayload() {
+	colors.PrintSubHeader("Create Payload")
+
+	payload := `{"imei":"` + testIMEI + `","reg_no":"BA 1 PA 1234","name":"Van","vehicle_type":"car","color":"#1E88E5","icon_type":"van"}`
+	var vehicle models.Vehicle
+	err := json.Unmarshal([]byte(payload), &vehicle)
+	check("Color and icon type bound from the request", err == nil && vehicle.Color == "#1E88E5" && vehicle.IconType == "van")
+
+	encoded, _ := json.Marshal(vehicle)
+	var response map[string]interface{}
+	json.Unmarshal(encoded, &response)
+	check("Color and icon type included in responses", response["color"] == "#1E88E5" && response["icon_type"] == "van")
+}
+
+// testAppearanceStorage sets and reads back the values in a scratch database named by TEST_DATABASE_DSN
+func testAppearanceStorage() {
+	colors.PrintSubHeader("Color And Icon Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the storage test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	if err := conn.AutoMigrate(&models.Vehicle{}); err != nil {
+		colors.PrintError("FAIL: migrate vehicles: %v", err)
+		return
+	}
+
+	conn.Where("imei = ?", testIMEI).Delete(&models.Vehicle{})
+	defer conn.Where("imei = ?", testIMEI).Delete(&models.Vehicle{})
+
+	vehicle := models.Vehicle{IMEI: testIMEI, RegNo: "TEST-COLOR-1", Name: "Color test", VehicleType: models.VehicleTypeCar,
+		Color: "#1E88E5", IconType: "van"}
+	if err := conn.Create(&vehicle).Error; err != nil {
+		colors.PrintError("FAIL: create test vehicle: %v", err)
+		return
+	}
+
+	var stored models.Vehicle
+	conn.Where("imei = ?", testIMEI).First(&stored)
+	check("Color and icon type stored on create", stored.Color == "#1E88E5" && stored.IconType == "van")
+
+	// Same partial update the vehicle update endpoints perform
+	conn.Model(&stored).Updates(models.Vehicle{Color: "#F4511E"})
+	conn.Where("imei = ?", testIMEI).First(&stored)
+	check("Color updated, icon type kept", stored.Color == "#F4511E" && stored.IconType == "van")
+}
+
+// testGroupFilter checks that a group narrows the user's vehicles without granting access
+func testGroupFilter() {
+	colors.PrintSubHeader("Vehicle Group Filter")
+
+	userVehicles := []models.UserVehicle{
+		{VehicleID: "0000000000000001"},
+		{VehicleID: "0000000000000002"},
+		{VehicleID: "0000000000000003"},
+	}
+
+	filtered := services.FilterUserVehiclesByGroup(userVehicles, []string{"0000000000000001", "0000000000000003"})
+	check("Only group members are kept", len(filtered) == 2 &&
+		filtered[0].VehicleID == "0000000000000001" && filtered[1].VehicleID == "0000000000000003")
+
+	filtered = services.FilterUserVehiclesByGroup(userVehicles, []string{"0000000000000002", "0000000000000009"})
+	check("A member the user cannot access is not returned", len(filtered) == 1 && filtered[0].VehicleID == "0000000000000002")
+
+	filtered = services.FilterUserVehiclesByGroup(userVehicles, nil)
+	check("An empty group returns no vehicles", filtered != nil && len(filtered) == 0)
+
+	group := models.VehicleGroup{Members: []models.VehicleGroupMember{{VehicleID: "0000000000000002"}}}
+	check("Group lists its member IMEIs", len(group.VehicleIDs()) == 1 && group.VehicleIDs()[0] == "0000000000000002")
+}
+
+// testGroupTracking calls the tracking endpoint with ?group_id= against a scratch database
+// named by TEST_DATABASE_DSN and checks that only the group's vehicles are returned
+func testGroupTracking() {
+	colors.PrintSubHeader("Tracking By Group Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the group tracking test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{},
+		&models.VehicleGroup{}, &models.VehicleGroupMember{}); err != nil {
+		colors.PrintError("FAIL: migrate group tables: %v", err)
+		return
+	}
+
+	imeis := []string{groupedIMEI, ungroupedIMEI}
+	cleanup := func() {
+		conn.Where("vehicle_id IN ?", imeis).Delete(&models.VehicleGroupMember{})
+		conn.Where("vehicle_id IN ?", imeis).Delete(&models.UserVehicle{})
+		conn.Where("imei IN ?", imeis).Delete(&models.Vehicle{})
+		conn.Where("phone IN ?", []string{"9800000095", "9800000096"}).Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Group owner", Phone: "9800000095", Email: "group-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-vehicle-group-owner"}
+	other := models.User{Name: "Other user", Phone: "9800000096", Email: "group-other@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-vehicle-group-other"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	if err := conn.Create(&other).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+
+	for i, imei := range imeis {
+		vehicle := models.Vehicle{IMEI: imei, RegNo: "TEST-GROUP-" + strconv.Itoa(i), Name: "Group test", VehicleType: models.VehicleTypeCar}
+		if err := conn.Create(&vehicle).Error; err != nil {
+			colors.PrintError("FAIL: create test vehicle: %v", err)
+			return
+		}
+		conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: imei, LiveTracking: true, IsActive: true})
+	}
+
+	group := models.VehicleGroup{OwnerID: owner.ID, Name: "Vans"}
+	otherGroup := models.VehicleGroup{OwnerID: other.ID, Name: "Not yours"}
+	conn.Create(&group)
+	conn.Create(&otherGroup)
+	defer conn.Delete(&models.VehicleGroup{}, []uint{group.ID, otherGroup.ID})
+	if err := services.AddVehiclesToGroup(group.ID, []string{groupedIMEI}, owner.ID); err != nil {
+		colors.PrintError("FAIL: add vehicle to group: %v", err)
+		return
+	}
+	check("Adding the same vehicle twice is ignored", services.AddVehiclesToGroup(group.ID, []string{groupedIMEI}, owner.ID) == nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/my-tracking", func(c *gin.Context) { c.Set("user", &owner) },
+		controllers.NewUserTrackingController(nil).GetMyVehiclesTracking)
+
+	track := func(query string) (int, int) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/my-tracking"+query, nil))
+		var response struct {
+			Count int `json:"count"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response.Count
+	}
+
+	code, count := track("")
+	check("Without group_id every vehicle is tracked", code == http.StatusOK && count == 2)
+	code, count = track("?group_id=" + strconv.Itoa(int(group.ID)))
+	check("group_id returns only the group's vehicles", code == http.StatusOK && count == 1)
+	code, _ = track("?group_id=" + strconv.Itoa(int(otherGroup.ID)))
+	check("Another user's group is not found", code == http.StatusNotFound)
+	code, _ = track("?group_id=vans")
+	check("Non-numeric group_id is rejected", code == http.StatusBadRequest)
+}
+
+// testBatchLatest requests the latest data of a mix of the user's vehicles, another user's
+// vehicle and an unknown IMEI, and checks only the user's vehicles are returned
+func testBatchLatest() {
+	colors.PrintSubHeader("Batch Latest Location Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the batch latest test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate batch latest tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Unscoped().Where("imei IN ?", batchIMEIs).Delete(&models.GPSData{})
+		conn.Where("vehicle_id IN ?", batchIMEIs).Delete(&models.UserVehicle{})
+		conn.Where("imei IN ?", batchIMEIs).Delete(&models.Vehicle{})
+		conn.Where("phone = ?", "9800000150").Delete(&models.User{})
+		for _, imei := range batchIMEIs {
+			services.GetLatestGPSCache().Invalidate(imei)
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Batch owner", Phone: "9800000150", Email: "batch-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-batch-owner"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	for i, imei := range batchIMEIs {
+		vehicle := models.Vehicle{IMEI: imei, RegNo: fmt.Sprintf("TEST-BATCH-%d", i), Name: "Batch test", VehicleType: models.VehicleTypeCar}
+		if err := conn.Create(&vehicle).Error; err != nil {
+			colors.PrintError("FAIL: create test vehicle: %v", err)
+			return
+		}
+	}
+	for _, imei := range batchIMEIs[:2] {
+		conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: imei, LiveTracking: true, IsActive: true})
+	}
+
+	// The first vehicle has a location; the second has only sent status
+	lat, lng := 27.7172, 85.3240
+	fixes := []models.GPSData{
+		{IMEI: batchIMEIs[0], Timestamp: time.Now().Add(-time.Minute), Latitude: &lat, Longitude: &lng, Ignition: "ON"},
+		{IMEI: batchIMEIs[1], Timestamp: time.Now().Add(-time.Minute), Ignition: "OFF"},
+		{IMEI: batchIMEIs[2], Timestamp: time.Now().Add(-time.Minute), Latitude: &lat, Longitude: &lng, Ignition: "ON"},
+	}
+	if err := conn.Create(&fixes).Error; err != nil {
+		colors.PrintError("FAIL: create test GPS data: %v", err)
+		return
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/my-tracking/latest", func(c *gin.Context) { c.Set("user", &owner) },
+		controllers.NewUserTrackingController(nil).GetMyVehiclesLatest)
+
+	latest := func(body string) (int, []map[string]interface{}) {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/my-tracking/latest", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(recorder, request)
+		var response struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response.Data
+	}
+
+	code, data := latest(fmt.Sprintf(`{"imeis":[%q,%q,%q,"0000000000000159"]}`, batchIMEIs[0], batchIMEIs[1], batchIMEIs[2]))
+	byIMEI := make(map[string]map[string]interface{})
+	for _, vehicle := range data {
+		if imei, ok := vehicle["imei"].(string); ok {
+			byIMEI[imei] = vehicle
+		}
+	}
+	check("Batch latest returned", code == http.StatusOK)
+	check("Only the user's vehicles are returned", len(data) == 2 && byIMEI[batchIMEIs[0]] != nil && byIMEI[batchIMEIs[1]] != nil)
+	check("Another user's vehicle is left out", byIMEI[batchIMEIs[2]] == nil)
+	check("Located vehicle has its latest location", byIMEI[batchIMEIs[0]] != nil && byIMEI[batchIMEIs[0]]["latest_location"] != nil)
+	check("Vehicle never located has status but no location", byIMEI[batchIMEIs[1]] != nil &&
+		byIMEI[batchIMEIs[1]]["latest_status"] != nil && byIMEI[batchIMEIs[1]]["latest_location"] == nil)
+
+	code, data = latest(fmt.Sprintf(`{"imeis":[%q]}`, batchIMEIs[2]))
+	check("Only inaccessible vehicles returns none", code == http.StatusOK && len(data) == 0)
+	code, _ = latest(`{"imeis":[]}`)
+	check("Empty IMEI list is rejected", code == http.StatusBadRequest)
+}
+
+// testOnlineStatus polls the online status of vehicles that are reporting, long offline,
+// connected without recent data and never seen, and of a vehicle the user cannot access
+func testOnlineStatus() {
+	colors.PrintSubHeader("Online Status Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the online status test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate online status tables: %v", err)
+		return
+	}
+
+	var imeis []string
+	for _, imei := range onlineIMEIs {
+		imeis = append(imeis, imei)
+	}
+	cleanup := func() {
+		conn.Unscoped().Where("imei IN ?", imeis).Delete(&models.GPSData{})
+		conn.Where("vehicle_id IN ?", imeis).Delete(&models.UserVehicle{})
+		conn.Where("imei IN ?", imeis).Delete(&models.Vehicle{})
+		conn.Where("phone = ?", "9800000160").Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Online owner", Phone: "9800000160", Email: "online-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-online-owner"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	for state, imei := range onlineIMEIs {
+		vehicle := models.Vehicle{IMEI: imei, RegNo: "TEST-ONLINE-" + imei[12:], Name: "Online test", VehicleType: models.VehicleTypeCar}
+		if err := conn.Create(&vehicle).Error; err != nil {
+			colors.PrintError("FAIL: create test vehicle: %v", err)
+			return
+		}
+		if state != "not_yours" {
+			conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: imei, LiveTracking: true, IsActive: true})
+		}
+	}
+
+	fixes := []models.GPSData{
+		{IMEI: onlineIMEIs["reporting"], Timestamp: time.Now().Add(-time.Minute), Ignition: "ON"},
+		{IMEI: onlineIMEIs["offline"], Timestamp: time.Now().Add(-72 * time.Hour), Ignition: "OFF"},
+		{IMEI: onlineIMEIs["connected"], Timestamp: time.Now().Add(-2 * time.Hour), Ignition: "OFF"},
+		{IMEI: onlineIMEIs["not_yours"], Timestamp: time.Now().Add(-time.Minute), Ignition: "ON"},
+	}
+	if err := conn.Create(&fixes).Error; err != nil {
+		colors.PrintError("FAIL: create test GPS data: %v", err)
+		return
+	}
+
+	// Only the connected vehicle has a TCP connection, opened by logging in to a real server
+	controlController := controllers.NewControlController()
+	address, stop, err := startLoginServer(controlController)
+	if err != nil {
+		colors.PrintError("FAIL: start TCP server: %v", err)
+		return
+	}
+	defer stop()
+	deviceConn, err := loginDevice(address, onlineIMEIs["connected"])
+	if err != nil {
+		colors.PrintError("FAIL: log in over TCP: %v", err)
+		return
+	}
+	defer deviceConn.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/my-tracking/:imei/online", func(c *gin.Context) { c.Set("user_id", owner.ID) },
+		controllers.NewUserTrackingController(controlController).GetMyVehicleOnlineStatus)
+
+	type onlineStatus struct {
+		Online           bool       `json:"online"`
+		LastSeen         *time.Time `json:"last_seen"`
+		ConnectionStatus string     `json:"connection_status"`
+	}
+	poll := func(state string) (int, onlineStatus) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/my-tracking/"+onlineIMEIs[state]+"/online", nil))
+		var response struct {
+			Data onlineStatus `json:"data"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response.Data
+	}
+
+	code, status := poll("reporting")
+	check("Vehicle reporting a minute ago is online", code == http.StatusOK && status.Online &&
+		status.ConnectionStatus == "connected" && status.LastSeen != nil)
+	code, status = poll("offline")
+	check("Vehicle silent for three days is offline", code == http.StatusOK && !status.Online &&
+		status.ConnectionStatus == "inactive" && status.LastSeen != nil && time.Since(*status.LastSeen) > 71*time.Hour)
+	code, status = poll("connected")
+	check("Vehicle with an open TCP connection is online without recent data", code == http.StatusOK && status.Online &&
+		status.ConnectionStatus == "inactive")
+	code, status = poll("never_seen")
+	check("Vehicle that never reported has no last seen", code == http.StatusOK && !status.Online &&
+		status.ConnectionStatus == "no-data" && status.LastSeen == nil)
+	code, _ = poll("not_yours")
+	check("Another user's vehicle is not found", code == http.StatusNotFound)
+
+	// The device drops its connection; nothing else tells the server it is gone
+	deviceConn.Close()
+	disconnected := false
+	for i := 0; i < 40 && !disconnected; i++ {
+		_, status = poll("connected")
+		disconnected = !status.Online
+		if !disconnected {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	check("Vehicle is offline once the device disconnects", disconnected && status.ConnectionStatus == "inactive")
+}
+
+// startLoginServer runs a TCP server for the login decoder on a free port and returns its address
+func startLoginServer(controller *controllers.ControlController) (address string, stop func(), err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	tcp.RegisterDecoderFactory("test-login", func() tcp.PacketDecoder { return loginDecoder{} })
+	listenerConfigs, err := tcp.ParseListenerConfigs(port + ":test-login")
+	if err != nil {
+		return "", nil, err
+	}
+	server := tcp.NewServerWithListeners(listenerConfigs, controller)
+	go server.Start()
+
+	stop = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}
+	return "127.0.0.1:" + port, stop, nil
+}
+
+// loginDevice connects to the server, logs in as imei and waits for the acknowledgement
+func loginDevice(address, imei string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	for i := 0; i < 20; i++ {
+		if conn, err = net.DialTimeout("tcp", address, time.Second); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn.Write([]byte("LOGIN " + imei))
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	return conn, nil
+}
+
+// testLiveSnapshot requests the live snapshot of a vehicle with data in the scratch database
+// named by TEST_DATABASE_DSN and checks that every section of the detail view is present
+func testLiveSnapshot() {
+	colors.PrintSubHeader("Live Snapshot Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the live snapshot test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate snapshot tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Unscoped().Where("imei = ?", snapshotIMEI).Delete(&models.GPSData{})
+		conn.Where("vehicle_id = ?", snapshotIMEI).Delete(&models.UserVehicle{})
+		conn.Where("imei = ?", snapshotIMEI).Delete(&models.Vehicle{})
+		conn.Where("phone = ?", "9800000097").Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Snapshot owner", Phone: "9800000097", Email: "snapshot-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-live-snapshot-owner"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	vehicle := models.Vehicle{IMEI: snapshotIMEI, RegNo: "TEST-SNAPSHOT", Name: "Snapshot test", VehicleType: models.VehicleTypeCar}
+	if err := conn.Create(&vehicle).Error; err != nil {
+		colors.PrintError("FAIL: create test vehicle: %v", err)
+		return
+	}
+	conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: snapshotIMEI, LiveTracking: true, IsActive: true})
+
+	// A drive that ends with the ignition off, then a status-only packet without coordinates
+	now := time.Now()
+	lat, lng := 27.7172, 85.3240
+	moving, stopped := 30, 0
+	fixes := []models.GPSData{
+		{IMEI: snapshotIMEI, Timestamp: now.Add(-30 * time.Second), Latitude: &lat, Longitude: &lng, Speed: &moving, Ignition: "ON"},
+		{IMEI: snapshotIMEI, Timestamp: now.Add(-20 * time.Second), Latitude: &lat, Longitude: &lng, Speed: &stopped, Ignition: "OFF"},
+		{IMEI: snapshotIMEI, Timestamp: now.Add(-10 * time.Second), Speed: &stopped, Ignition: "OFF"},
+	}
+	if err := conn.Create(&fixes).Error; err != nil {
+		colors.PrintError("FAIL: create test GPS data: %v", err)
+		return
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/my-tracking/:imei/live-snapshot", func(c *gin.Context) { c.Set("user", &owner) },
+		controllers.NewUserTrackingController(nil).GetMyVehicleLiveSnapshot)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/my-tracking/"+snapshotIMEI+"/live-snapshot", nil))
+	var response struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	check("Snapshot returned", recorder.Code == http.StatusOK)
+
+	for _, section := range []string{"vehicle", "permissions", "latest_status", "latest_location", "today_stats", "today_trips", "online_status"} {
+		value, exists := response.Data[section]
+		check("Section "+quote(section)+" present", exists && string(value) != "null")
+	}
+
+	var latestStatus, latestLocation models.GPSData
+	json.Unmarshal(response.Data["latest_status"], &latestStatus)
+	json.Unmarshal(response.Data["latest_location"], &latestLocation)
+	check("Latest status is the status-only packet", latestStatus.Latitude == nil && latestStatus.ID == fixes[2].ID)
+	check("Latest location falls back to the last fix", latestLocation.ID == fixes[1].ID)
+	check("Today's trip counted", string(response.Data["today_trips"]) == "1")
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/my-tracking/0000000000000098/live-snapshot", nil))
+	check("Vehicle without access is not found", recorder.Code == http.StatusNotFound)
+}
+
+// testFleetSummary classifies a small fleet in mixed states
+func testFleetSummary() {
+	colors.PrintSubHeader("Fleet Summary")
+
+	now := time.Now()
+	row := func(age time.Duration, speed int, ignition string) *models.GPSData {
+		return &models.GPSData{Timestamp: now.Add(-age), Speed: &speed, Ignition: ignition}
+	}
+	fleet := []services.FleetVehicle{
+		{IMEI: "running", Overspeed: 60, Latest: row(time.Minute, 40, "ON"), DistanceTodayKm: 12.5},
+		{IMEI: "overspeed", Overspeed: 60, Latest: row(time.Minute, 90, "ON"), DistanceTodayKm: 30},
+		{IMEI: "idle", Overspeed: 60, Latest: row(2*time.Minute, 0, "ON"), DistanceTodayKm: 2.5},
+		{IMEI: "parked", Overspeed: 60, Latest: row(3*time.Minute, 0, "OFF")},
+		{IMEI: "connected-quiet", Overspeed: 60, Latest: row(time.Hour, 40, "ON"), Connected: true},
+		{IMEI: "offline", Overspeed: 60, Latest: row(time.Hour, 40, "ON"), DistanceTodayKm: 5},
+		{IMEI: "never-reported", Overspeed: 60},
+	}
+
+	summary := services.SummarizeFleet(fleet, now, 5)
+	check("All vehicles counted", summary.TotalVehicles == 7)
+	check(fmt.Sprintf("Online %d and offline %d", summary.Online, summary.Offline), summary.Online == 5 && summary.Offline == 2)
+	check("Running and overspeeding vehicles are moving", summary.Moving == 2)
+	check("Stationary vehicle with the ignition on is idle", summary.Idle == 1)
+	check("Parked and quiet connected vehicles are stopped", summary.Stopped == 2)
+	check("Vehicle that never reported counted as no data", summary.NoData == 1)
+	check(fmt.Sprintf("Distance today summed across the fleet: %.1f km", summary.DistanceTodayKm), summary.DistanceTodayKm == 50)
+
+	empty := services.SummarizeFleet(nil, now, 5)
+	check("Empty fleet summarized as zeros", empty == services.FleetSummary{})
+}
+
+// testFleetSummaryEndpoint requests the fleet summary for a user with vehicles in the scratch
+// database named by TEST_DATABASE_DSN
+func testFleetSummaryEndpoint() {
+	colors.PrintSubHeader("Fleet Summary Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the fleet summary test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate fleet tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Unscoped().Where("imei IN ?", fleetIMEIs).Delete(&models.GPSData{})
+		conn.Where("vehicle_id IN ?", fleetIMEIs).Delete(&models.UserVehicle{})
+		conn.Where("imei IN ?", fleetIMEIs).Delete(&models.Vehicle{})
+		conn.Where("phone = ?", "9800000110").Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Fleet owner", Phone: "9800000110", Email: "fleet-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-fleet-summary-owner"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	expired := time.Now().Add(-time.Hour)
+	for i, imei := range fleetIMEIs {
+		vehicle := models.Vehicle{IMEI: imei, RegNo: "TEST-FLEET-" + strconv.Itoa(i), Name: "Fleet test", VehicleType: models.VehicleTypeCar}
+		if err := conn.Create(&vehicle).Error; err != nil {
+			colors.PrintError("FAIL: create test vehicle: %v", err)
+			return
+		}
+		access := models.UserVehicle{UserID: owner.ID, VehicleID: imei, IsActive: true}
+		if i == 3 {
+			access.ExpiresAt = &expired // Shared access that has run out
+		}
+		conn.Create(&access)
+	}
+
+	// Moving now, parked after a drive this morning, and silent since yesterday
+	now := time.Now()
+	lat, lng := 27.7172, 85.3240
+	moving, stopped := 40, 0
+	driven, parked := 4.0, 1.5
+	rows := []models.GPSData{
+		{IMEI: fleetIMEIs[0], Timestamp: now.Add(-time.Minute), Latitude: &lat, Longitude: &lng, Speed: &moving, Ignition: "ON", DistanceFromPrev: &driven},
+		{IMEI: fleetIMEIs[1], Timestamp: now.Add(-2 * time.Minute), Latitude: &lat, Longitude: &lng, Speed: &stopped, Ignition: "OFF", DistanceFromPrev: &parked},
+		{IMEI: fleetIMEIs[2], Timestamp: now.Add(-30 * time.Hour), Latitude: &lat, Longitude: &lng, Speed: &stopped, Ignition: "OFF", DistanceFromPrev: &driven},
+		{IMEI: fleetIMEIs[3], Timestamp: now.Add(-time.Minute), Latitude: &lat, Longitude: &lng, Speed: &moving, Ignition: "ON", DistanceFromPrev: &driven},
+	}
+	if err := conn.Create(&rows).Error; err != nil {
+		colors.PrintError("FAIL: create test GPS data: %v", err)
+		return
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/my-fleet/summary", func(c *gin.Context) { c.Set("user", &owner) },
+		controllers.NewUserTrackingController(nil).GetMyFleetSummary)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/my-fleet/summary", nil))
+	var response struct {
+		Data services.FleetSummary `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	summary := response.Data
+
+	check("Summary returned", recorder.Code == http.StatusOK)
+	check("Expired access not counted", summary.TotalVehicles == 3)
+	check("One moving, one stopped, one offline", summary.Moving == 1 && summary.Stopped == 1 && summary.Offline == 1 && summary.Online == 2)
+	check(fmt.Sprintf("Only today's distance summed: %.1f km", summary.DistanceTodayKm), summary.DistanceTodayKm == driven+parked)
+}
+
+// testStatusFilterValidation checks that unknown ?status= values are rejected before any query runs
+func testStatusFilterValidation() {
+	colors.PrintSubHeader("Vehicle Status Filter Validation")
+
+	for _, status := range []string{"online", "offline", "moving", "idle"} {
+		check("Status "+quote(status)+" accepted", services.IsValidConnectionStatus(status))
+	}
+	check("Status \"parked\" rejected", !services.IsValidConnectionStatus("parked"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/vehicles", controllers.NewVehicleController(nil).GetVehicles)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/vehicles?status=parked", nil))
+	check("Unknown status answered with 400", recorder.Code == http.StatusBadRequest)
+}
+
+// testStatusFilter lists vehicles by each ?status= value against a scratch database named
+// by TEST_DATABASE_DSN, with one vehicle kept online by its TCP connection alone
+func testStatusFilter() {
+	colors.PrintSubHeader("Vehicle Status Filter Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the status filter test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.Device{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate vehicle tables: %v", err)
+		return
+	}
+
+	var imeis []string
+	for _, imei := range statusIMEIs {
+		imeis = append(imeis, imei)
+	}
+	cleanup := func() {
+		conn.Where("imei IN ?", imeis).Delete(&models.GPSData{})
+		conn.Where("imei IN ?", imeis).Delete(&models.Vehicle{})
+	}
+	cleanup()
+	defer cleanup()
+
+	for state, imei := range statusIMEIs {
+		vehicle := models.Vehicle{IMEI: imei, RegNo: "TEST-STATUS-" + imei[13:], Name: "Status test " + state, VehicleType: models.VehicleTypeCar}
+		if err := conn.Create(&vehicle).Error; err != nil {
+			colors.PrintError("FAIL: create test vehicle: %v", err)
+			return
+		}
+	}
+
+	now := time.Now()
+	row := func(state string, age time.Duration, speed int, ignition string) models.GPSData {
+		return models.GPSData{IMEI: statusIMEIs[state], Timestamp: now.Add(-age), Speed: &speed, Ignition: ignition}
+	}
+	rows := []models.GPSData{
+		row("moving", time.Minute, 40, "ON"),
+		row("idle", 10*time.Minute, 40, "ON"), // Older fix first; the newest row decides
+		row("idle", time.Minute, 0, "ON"),
+		row("parked", time.Minute, 0, "OFF"),
+		row("connected", time.Hour, 40, "ON"),
+		row("stale", time.Hour, 40, "ON"),
+	}
+	if err := conn.Create(&rows).Error; err != nil {
+		colors.PrintError("FAIL: create test GPS data: %v", err)
+		return
+	}
+
+	registry := controllers.NewControlController()
+	client, server := net.Pipe()
+	defer client.Close()
+	registry.RegisterConnection(statusIMEIs["connected"], server)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/vehicles", controllers.NewVehicleController(registry).GetVehicles)
+
+	list := func(query string) (map[string]bool, int64) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/vehicles?name=Status+test&limit=100&"+query, nil))
+		var response struct {
+			Data []struct {
+				Name string `json:"name"`
+			} `json:"data"`
+			Pagination struct {
+				TotalCount int64 `json:"total_count"`
+			} `json:"pagination"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		names := make(map[string]bool)
+		for _, vehicle := range response.Data {
+			names[strings.TrimPrefix(vehicle.Name, "Status test ")] = true
+		}
+		return names, response.Pagination.TotalCount
+	}
+
+	names, total := list("status=online")
+	check(fmt.Sprintf("Online: %v", names), total == 4 && names["moving"] && names["idle"] && names["parked"] && names["connected"])
+	names, total = list("status=offline")
+	check(fmt.Sprintf("Offline: %v", names), total == 2 && names["stale"] && names["silent"])
+	names, total = list("status=moving")
+	check(fmt.Sprintf("Moving: %v", names), total == 1 && names["moving"])
+	names, total = list("status=idle")
+	check(fmt.Sprintf("Idle: %v", names), total == 1 && names["idle"])
+
+	_, total = list("status=online&reg_no=TEST-STATUS-122")
+	check("Status composes with other filters", total == 1)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/vehicles?name=Status+test&status=online&limit=3&page=2", nil))
+	var paged struct {
+		Data       []json.RawMessage `json:"data"`
+		Pagination struct {
+			TotalCount int64 `json:"total_count"`
+			TotalPages int   `json:"total_pages"`
+		} `json:"pagination"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &paged)
+	check("Status composes with pagination", len(paged.Data) == 1 && paged.Pagination.TotalCount == 4 && paged.Pagination.TotalPages == 2)
+}
+
+// testVehicleSortParsing checks the ORDER BY built from ?sort= and that only whitelisted fields are accepted
+func testVehicleSortParsing() {
+	colors.PrintSubHeader("Vehicle Sort Parsing")
+
+	order, err := services.ParseVehicleSort("reg_no")
+	check("Direction defaults to ascending, IMEI breaks ties", err == nil &&
+		order == "vehicles.reg_no ASC NULLS LAST, vehicles.imei ASC")
+
+	order, err = services.ParseVehicleSort("last_update:desc, name:ASC")
+	check("Several keys in order, directions case-insensitive", err == nil &&
+		strings.HasPrefix(order, "(SELECT gps_data.timestamp") && strings.Contains(order, ") DESC NULLS LAST, vehicles.name ASC NULLS LAST"))
+
+	order, err = services.ParseVehicleSort("imei:desc")
+	check("No extra tie-break when sorting by IMEI", err == nil && order == "vehicles.imei DESC NULLS LAST")
+
+	for _, sort := range []string{"password", "reg_no:sideways", "reg_no;DROP TABLE vehicles", "", "name,"} {
+		_, err := services.ParseVehicleSort(sort)
+		check("Sort "+quote(sort)+" rejected", err != nil)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/vehicles", controllers.NewVehicleController(nil).GetVehicles)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/vehicles?sort=password:asc", nil))
+	check("Unsortable field answered with 400", recorder.Code == http.StatusBadRequest)
+}
+
+// testVehicleSort lists vehicles in the scratch database named by TEST_DATABASE_DSN sorted by
+// registration number and by last update
+func testVehicleSort() {
+	colors.PrintSubHeader("Vehicle Sort Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the sort test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.Device{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate vehicle tables: %v", err)
+		return
+	}
+
+	// Registration numbers and last updates in different orders; the last vehicle never reported
+	now := time.Now()
+	fixtures := []struct {
+		imei, regNo string
+		age         time.Duration
+	}{
+		{"0000000000000130", "TEST-SORT-B", 2 * time.Hour},
+		{"0000000000000131", "TEST-SORT-C", time.Minute},
+		{"0000000000000132", "TEST-SORT-A", time.Hour},
+		{"0000000000000133", "TEST-SORT-D", 0},
+	}
+	var imeis []string
+	for _, fixture := range fixtures {
+		imeis = append(imeis, fixture.imei)
+	}
+	cleanup := func() {
+		conn.Where("imei IN ?", imeis).Delete(&models.GPSData{})
+		conn.Where("imei IN ?", imeis).Delete(&models.Vehicle{})
+	}
+	cleanup()
+	defer cleanup()
+
+	for _, fixture := range fixtures {
+		vehicle := models.Vehicle{IMEI: fixture.imei, RegNo: fixture.regNo, Name: "Sort test", VehicleType: models.VehicleTypeCar}
+		if err := conn.Create(&vehicle).Error; err != nil {
+			colors.PrintError("FAIL: create test vehicle: %v", err)
+			return
+		}
+		if fixture.age > 0 {
+			conn.Create(&models.GPSData{IMEI: fixture.imei, Timestamp: now.Add(-fixture.age)})
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/vehicles", controllers.NewVehicleController(nil).GetVehicles)
+
+	regNos := func(query string) string {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/vehicles?name=Sort+test&"+query, nil))
+		var response struct {
+			Data []struct {
+				RegNo string `json:"reg_no"`
+			} `json:"data"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		var order []string
+		for _, vehicle := range response.Data {
+			order = append(order, strings.TrimPrefix(vehicle.RegNo, "TEST-SORT-"))
+		}
+		return strings.Join(order, "")
+	}
+
+	check("Sorted by registration number", regNos("sort=reg_no:asc") == "ABCD")
+	check("Sorted by registration number descending", regNos("sort=reg_no:desc") == "DCBA")
+	check("Most recently updated first, never reported last", regNos("sort=last_update:desc") == "CABD")
+	check("Least recently updated first, never reported last", regNos("sort=last_update:asc") == "BACD")
+	check("Sort applied before pagination", regNos("sort=reg_no&limit=2&page=2") == "CD")
+}
+
+// testLatestGPSCache checks that saved rows do not fill the cache for devices nobody read
+func testLatestGPSCache() {
+	colors.PrintSubHeader("Latest GPS Cache")
+
+	cache := services.NewLatestGPSCache(10)
+	lat, lng := 27.7172, 85.3240
+	cache.Record(&models.GPSData{IMEI: cacheIMEI, Timestamp: time.Now(), Latitude: &lat, Longitude: &lng})
+	stats := cache.Stats()
+	check("Row for an uncached device is not cached", stats.Entries == 0)
+	check("Recording counts no reads", stats.Hits == 0 && stats.Misses == 0)
+}
+
+// testLatestGPSCacheIngest reads a vehicle in the scratch database named by TEST_DATABASE_DSN,
+// ingests a newer fix and checks the location endpoint serves it from the cache
+func testLatestGPSCacheIngest() {
+	colors.PrintSubHeader("Latest GPS Cache Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the latest GPS cache test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate cache tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Unscoped().Where("imei = ?", cacheIMEI).Delete(&models.GPSData{})
+		conn.Where("vehicle_id = ?", cacheIMEI).Delete(&models.UserVehicle{})
+		conn.Where("imei = ?", cacheIMEI).Delete(&models.Vehicle{})
+		conn.Where("phone = ?", "9800000140").Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Cache owner", Phone: "9800000140", Email: "cache-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-latest-gps-cache-owner"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	vehicle := models.Vehicle{IMEI: cacheIMEI, RegNo: "TEST-CACHE", Name: "Cache test", VehicleType: models.VehicleTypeCar}
+	if err := conn.Create(&vehicle).Error; err != nil {
+		colors.PrintError("FAIL: create test vehicle: %v", err)
+		return
+	}
+	conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: cacheIMEI, LiveTracking: true, IsActive: true})
+
+	now := time.Now()
+	oldLat, oldLng := 27.7000, 85.3000
+	first := models.GPSData{IMEI: cacheIMEI, Timestamp: now.Add(-time.Minute), Latitude: &oldLat, Longitude: &oldLng}
+	if err := conn.Create(&first).Error; err != nil {
+		colors.PrintError("FAIL: create test GPS data: %v", err)
+		return
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/my-tracking/:imei/location", func(c *gin.Context) { c.Set("user", &owner) },
+		controllers.NewUserTrackingController(nil).GetMyVehicleLocation)
+	location := func() models.GPSData {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/my-tracking/"+cacheIMEI+"/location", nil))
+		var response struct {
+			Data struct {
+				Location models.GPSData `json:"location"`
+			} `json:"data"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return response.Data.Location
+	}
+
+	cache := services.GetLatestGPSCache()
+	cache.Invalidate(cacheIMEI)
+	check("First read loads the stored fix", location().ID == first.ID)
+
+	// Ingest a newer fix the way the TCP server does: save the row, then record it
+	newLat, newLng := 27.7172, 85.3240
+	ingested := models.GPSData{IMEI: cacheIMEI, Timestamp: now, Latitude: &newLat, Longitude: &newLng}
+	if err := conn.Create(&ingested).Error; err != nil {
+		colors.PrintError("FAIL: create ingested GPS data: %v", err)
+		return
+	}
+	cache.Record(&ingested)
+
+	// Removing the row behind the cache's back proves the next answer does not come from the database
+	conn.Unscoped().Delete(&ingested)
+	hits := cache.Stats().Hits
+	served := location()
+	check("Newly ingested fix is served", served.ID == ingested.ID)
+	check("Newly ingested fix came from the cache", cache.Stats().Hits == hits+1)
+
+	replayed := models.GPSData{IMEI: cacheIMEI, Timestamp: now.Add(-2 * time.Minute), Latitude: &oldLat, Longitude: &oldLng}
+	cache.Record(&replayed)
+	check("Older replayed fix does not replace the cached one", location().ID == ingested.ID)
+
+	cache.Invalidate(cacheIMEI)
+	check("Invalidated vehicle is read from the database again", location().ID == first.ID)
+}
+
+// testHistoryRangeLimit checks that report requests wider than HISTORY_MAX_RANGE_DAYS are
+// rejected before any query runs
+func testHistoryRangeLimit() {
+	colors.PrintSubHeader("History Range Limit")
+
+	os.Unsetenv("HISTORY_MAX_RANGE_DAYS")
+	check("Default limit is 31 days", config.GetHistoryMaxRange() == 31*24*time.Hour)
+	os.Setenv("HISTORY_MAX_RANGE_DAYS", "0")
+	check("Zero disables the limit", config.GetHistoryMaxRange() == 0)
+	os.Unsetenv("HISTORY_MAX_RANGE_DAYS")
+
+	user := models.User{ID: 1, Role: models.UserRoleClient}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/my-tracking/reports", func(c *gin.Context) { c.Set("user", &user) },
+		controllers.NewUserTrackingController(nil).GetMyVehicleReports)
+	router.GET("/my-gps/reports", func(c *gin.Context) { c.Set("user", &user) },
+		controllers.NewUserGPSController().GetUserVehicleReport)
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -60)
+	query := "?from=" + url.QueryEscape(config.FormatTimestamp(from)) + "&to=" + url.QueryEscape(config.FormatTimestamp(to))
+	for _, path := range []string{"/my-tracking/reports", "/my-gps/reports"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path+query, nil))
+		var response struct {
+			Success      bool   `json:"success"`
+			Message      string `json:"message"`
+			MaxRangeDays int    `json:"max_range_days"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		check("60-day range on "+path+" is rejected", recorder.Code == http.StatusBadRequest && !response.Success)
+		check("Rejection on "+path+" explains the limit", response.MaxRangeDays == 31 && strings.Contains(response.Message, "31 days"))
+	}
+}
+
+// testCompareValidation checks the vehicle lists a comparison rejects before any query runs
+func testCompareValidation() {
+	colors.PrintSubHeader("Vehicle Comparison Validation")
+
+	user := models.User{ID: 1, Role: models.UserRoleClient}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/my-tracking/compare", func(c *gin.Context) { c.Set("user", &user) },
+		controllers.NewUserTrackingController(nil).CompareMyVehicles)
+
+	tooMany := "0000000000000141,0000000000000142,0000000000000143,0000000000000144,0000000000000145,0000000000000146"
+	for _, imeis := range []string{"", "0000000000000141", "0000000000000141,0000000000000141", "0000000000000141,12345", tooMany} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/my-tracking/compare?imeis="+imeis, nil))
+		check("imeis "+quote(imeis)+" rejected", recorder.Code == http.StatusBadRequest)
+	}
+}
+
+// testCompareVehicles compares two vehicles with known statistics in the scratch database
+// named by TEST_DATABASE_DSN
+func testCompareVehicles() {
+	colors.PrintSubHeader("Vehicle Comparison Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the comparison test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate comparison tables: %v", err)
+		return
+	}
+
+	cleanup := func() {
+		conn.Unscoped().Where("imei IN ?", compareIMEIs).Delete(&models.GPSData{})
+		conn.Where("vehicle_id IN ?", compareIMEIs).Delete(&models.UserVehicle{})
+		conn.Where("imei IN ?", compareIMEIs).Delete(&models.Vehicle{})
+		conn.Where("phone = ?", "9800000141").Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Compare owner", Phone: "9800000141", Email: "compare-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-compare-owner"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	for i, imei := range compareIMEIs {
+		vehicle := models.Vehicle{IMEI: imei, RegNo: fmt.Sprintf("TEST-COMPARE-%d", i), Name: "Compare test",
+			VehicleType: models.VehicleTypeCar, Overspeed: 80}
+		if err := conn.Create(&vehicle).Error; err != nil {
+			colors.PrintError("FAIL: create test vehicle: %v", err)
+			return
+		}
+	}
+	for _, imei := range compareIMEIs[:2] {
+		conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: imei, Report: true, IsActive: true})
+	}
+
+	// The first vehicle drives for 10 minutes at up to 60 km/h; the second stays parked
+	start := time.Now().Add(-time.Hour)
+	lat1, lat2, lng := 27.7000, 27.7100, 85.3240
+	slow, fast, parked := 40, 60, 0
+	fixes := []models.GPSData{
+		{IMEI: compareIMEIs[0], Timestamp: start, Latitude: &lat1, Longitude: &lng, Speed: &slow, Ignition: "ON"},
+		{IMEI: compareIMEIs[0], Timestamp: start.Add(10 * time.Minute), Latitude: &lat2, Longitude: &lng, Speed: &fast, Ignition: "ON"},
+		{IMEI: compareIMEIs[1], Timestamp: start, Latitude: &lat1, Longitude: &lng, Speed: &parked, Ignition: "OFF"},
+		{IMEI: compareIMEIs[1], Timestamp: start.Add(5 * time.Minute), Latitude: &lat1, Longitude: &lng, Speed: &parked, Ignition: "OFF"},
+		{IMEI: compareIMEIs[1], Timestamp: start.Add(10 * time.Minute), Latitude: &lat1, Longitude: &lng, Speed: &parked, Ignition: "OFF"},
+	}
+	if err := conn.Create(&fixes).Error; err != nil {
+		colors.PrintError("FAIL: create test GPS data: %v", err)
+		return
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/my-tracking/compare", func(c *gin.Context) { c.Set("user", &owner) },
+		controllers.NewUserTrackingController(nil).CompareMyVehicles)
+
+	// Listed parked vehicle first, so the values must follow the order of imeis
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+		"/my-tracking/compare?imeis="+compareIMEIs[1]+","+compareIMEIs[0], nil))
+	var response struct {
+		Data struct {
+			IMEIs      []string             `json:"imeis"`
+			Comparison map[string][]float64 `json:"comparison"`
+		} `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	check("Comparison returned", recorder.Code == http.StatusOK)
+	check("Vehicles kept in request order", len(response.Data.IMEIs) == 2 && response.Data.IMEIs[0] == compareIMEIs[1])
+
+	points := response.Data.Comparison["total_points"]
+	check("Point counts side by side", len(points) == 2 && points[0] == 3 && points[1] == 2)
+	maxSpeeds := response.Data.Comparison["max_speed"]
+	check("Max speeds side by side", len(maxSpeeds) == 2 && maxSpeeds[0] == 0 && maxSpeeds[1] == 60)
+	distances := response.Data.Comparison["total_distance"]
+	check("Only the driven vehicle covered distance", len(distances) == 2 && distances[0] == 0 && distances[1] > 1 && distances[1] < 1.2)
+	moving := response.Data.Comparison["moving_time_hours"]
+	check("Moving time side by side", len(moving) == 2 && moving[0] == 0 && math.Abs(moving[1]-1.0/6) < 0.001)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+		"/my-tracking/compare?imeis="+compareIMEIs[0]+","+compareIMEIs[2], nil))
+	check("Vehicle without access is not found", recorder.Code == http.StatusNotFound)
+}
+
+// testArchiveBeforeDelete deletes a vehicle with archiving requested and checks that the
+// archive file holds the vehicle, its user access and its GPS history; when the archive
+// cannot be written the vehicle must be left in place
+func testArchiveBeforeDelete() {
+	colors.PrintSubHeader("Archive Before Delete Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the archive test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{}, &models.AuditLog{}); err != nil {
+		colors.PrintError("FAIL: migrate archive tables: %v", err)
+		return
+	}
+
+	archiveDir, err := os.MkdirTemp("", "luna-archive-test")
+	if err != nil {
+		colors.PrintError("FAIL: create archive directory: %v", err)
+		return
+	}
+	defer os.RemoveAll(archiveDir)
+	previousDir, wasSet := os.LookupEnv("ARCHIVE_DIR")
+	defer func() {
+		if wasSet {
+			os.Setenv("ARCHIVE_DIR", previousDir)
+		} else {
+			os.Unsetenv("ARCHIVE_DIR")
+		}
+	}()
+
+	cleanup := func() {
+		conn.Unscoped().Where("imei IN ?", archiveIMEIs).Delete(&models.GPSData{})
+		conn.Where("vehicle_id IN ?", archiveIMEIs).Delete(&models.UserVehicle{})
+		conn.Where("imei IN ?", archiveIMEIs).Delete(&models.Vehicle{})
+		conn.Where("phone = ?", "9800000170").Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Archive owner", Phone: "9800000170", Email: "archive-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-archive-owner"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	lat, lng := 27.7172, 85.3240
+	for i, imei := range archiveIMEIs {
+		vehicle := models.Vehicle{IMEI: imei, RegNo: fmt.Sprintf("TEST-ARCHIVE-%d", i), Name: "Archive test", VehicleType: models.VehicleTypeCar}
+		if err := conn.Create(&vehicle).Error; err != nil {
+			colors.PrintError("FAIL: create test vehicle: %v", err)
+			return
+		}
+		conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: imei, IsMainUser: true, IsActive: true})
+		conn.Create(&[]models.GPSData{
+			{IMEI: imei, Timestamp: time.Now().Add(-2 * time.Minute), Latitude: &lat, Longitude: &lng, Ignition: "ON"},
+			{IMEI: imei, Timestamp: time.Now().Add(-time.Minute), Ignition: "OFF"},
+		})
+	}
+
+	gin.SetMode(gin.TestMode)
+	deleteVehicle := func(imei string) (int, string) {
+		router := gin.New()
+		router.DELETE("/vehicles/:imei", controllers.NewVehicleController(nil).DeleteVehicle)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/vehicles/"+imei+"?archive=true&include_gps=true", nil))
+		var response struct {
+			ArchivePath string `json:"archive_path"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response.ArchivePath
+	}
+	vehicleExists := func(imei string) bool {
+		var count int64
+		conn.Model(&models.Vehicle{}).Where("imei = ?", imei).Count(&count)
+		return count == 1
+	}
+
+	os.Setenv("ARCHIVE_DIR", archiveDir)
+	code, archivePath := deleteVehicle(archiveIMEIs[0])
+	check("Vehicle deleted with archiving", code == http.StatusOK && !vehicleExists(archiveIMEIs[0]))
+	check("Archive file created in ARCHIVE_DIR", archivePath != "" && strings.HasPrefix(archivePath, archiveDir))
+
+	var archive struct {
+		Reason   string `json:"reason"`
+		Vehicles []struct {
+			Vehicle    models.Vehicle       `json:"vehicle"`
+			UserAccess []models.UserVehicle `json:"user_access"`
+			GPSData    []models.GPSData     `json:"gps_data"`
+		} `json:"vehicles"`
+	}
+	contents, err := os.ReadFile(archivePath)
+	if err == nil {
+		err = json.Unmarshal(contents, &archive)
+	}
+	if err != nil {
+		colors.PrintError("FAIL: read archive file: %v", err)
+		return
+	}
+	check("Archive holds the deleted vehicle", len(archive.Vehicles) == 1 && archive.Vehicles[0].Vehicle.IMEI == archiveIMEIs[0] &&
+		archive.Vehicles[0].Vehicle.RegNo == "TEST-ARCHIVE-0")
+	check("Archive holds the vehicle's user access", len(archive.Vehicles) == 1 && len(archive.Vehicles[0].UserAccess) == 1 &&
+		archive.Vehicles[0].UserAccess[0].UserID == owner.ID)
+	check("Archive holds the vehicle's GPS history", len(archive.Vehicles) == 1 && len(archive.Vehicles[0].GPSData) == 2)
+
+	// A regular file where the directory should be makes the archive fail
+	blocker := filepath.Join(archiveDir, "blocked")
+	os.WriteFile(blocker, nil, 0o600)
+	os.Setenv("ARCHIVE_DIR", filepath.Join(blocker, "archives"))
+	code, _ = deleteVehicle(archiveIMEIs[1])
+	check("Delete refused when the archive cannot be written", code == http.StatusInternalServerError)
+	check("Vehicle kept when the archive fails", vehicleExists(archiveIMEIs[1]))
+}
+
+// testDeleteGPSCleanup has an owner delete a vehicle with GPS rows, in batches smaller than
+// the history, and checks the rows and driving events are removed unless asked to keep them
+func testDeleteGPSCleanup() {
+	colors.PrintSubHeader("GPS Cleanup On Delete Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the GPS cleanup test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{},
+		&models.DrivingEvent{}, &models.AuditLog{}); err != nil {
+		colors.PrintError("FAIL: migrate GPS cleanup tables: %v", err)
+		return
+	}
+
+	previousSize, wasSet := os.LookupEnv("GPS_DELETE_BATCH_SIZE")
+	os.Setenv("GPS_DELETE_BATCH_SIZE", "2")
+	defer func() {
+		if wasSet {
+			os.Setenv("GPS_DELETE_BATCH_SIZE", previousSize)
+		} else {
+			os.Unsetenv("GPS_DELETE_BATCH_SIZE")
+		}
+	}()
+
+	cleanup := func() {
+		conn.Where("imei IN ?", cleanupIMEIs).Delete(&models.DrivingEvent{})
+		conn.Unscoped().Where("imei IN ?", cleanupIMEIs).Delete(&models.GPSData{})
+		conn.Where("vehicle_id IN ?", cleanupIMEIs).Delete(&models.UserVehicle{})
+		conn.Where("imei IN ?", cleanupIMEIs).Delete(&models.Vehicle{})
+		conn.Where("phone = ?", "9800000172").Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Cleanup owner", Phone: "9800000172", Email: "cleanup-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-cleanup-owner"}
+	if err := conn.Create(&owner).Error; err != nil {
+		colors.PrintError("FAIL: create test user: %v", err)
+		return
+	}
+	const historyRows = 5
+	for i, imei := range cleanupIMEIs {
+		vehicle := models.Vehicle{IMEI: imei, RegNo: fmt.Sprintf("TEST-CLEANUP-%d", i), Name: "Cleanup test", VehicleType: models.VehicleTypeCar}
+		if err := conn.Create(&vehicle).Error; err != nil {
+			colors.PrintError("FAIL: create test vehicle: %v", err)
+			return
+		}
+		conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: imei, IsMainUser: true, IsActive: true})
+		for j := 0; j < historyRows; j++ {
+			conn.Create(&models.GPSData{IMEI: imei, Timestamp: time.Now().Add(-time.Duration(j+1) * time.Minute), Ignition: "ON"})
+		}
+		conn.Create(&models.DrivingEvent{IMEI: imei, Type: models.DrivingEventHarshBraking, Timestamp: time.Now().Add(-time.Minute)})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.DELETE("/my-vehicles/:imei", func(c *gin.Context) { c.Set("user", &owner) },
+		controllers.NewVehicleController(nil).DeleteMyVehicle)
+	deleteVehicle := func(imei, gpsMode string) (int, int64) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/my-vehicles/"+imei+"?gps="+gpsMode, nil))
+		var response struct {
+			Data struct {
+				GPSRowsDeleted int64 `json:"gps_rows_deleted"`
+			} `json:"data"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response.Data.GPSRowsDeleted
+	}
+	remaining := func(imei string) (gpsRows, events int64) {
+		conn.Model(&models.GPSData{}).Where("imei = ?", imei).Count(&gpsRows)
+		conn.Model(&models.DrivingEvent{}).Where("imei = ?", imei).Count(&events)
+		return gpsRows, events
+	}
+
+	code, deleted := deleteVehicle(cleanupIMEIs[0], config.GPSCleanupDelete)
+	gpsRows, events := remaining(cleanupIMEIs[0])
+	check("Vehicle deleted by its owner", code == http.StatusOK)
+	check(fmt.Sprintf("All %d GPS rows deleted across batches of 2", historyRows), deleted == historyRows && gpsRows == 0)
+	check("Driving events deleted with the GPS history", events == 0)
+
+	code, _ = deleteVehicle(cleanupIMEIs[1], "purge")
+	gpsRows, _ = remaining(cleanupIMEIs[1])
+	check("Unknown GPS cleanup mode rejected", code == http.StatusBadRequest && gpsRows == historyRows)
+
+	code, deleted = deleteVehicle(cleanupIMEIs[1], config.GPSCleanupKeep)
+	gpsRows, events = remaining(cleanupIMEIs[1])
+	check("GPS history kept when asked to", code == http.StatusOK && deleted == 0 && gpsRows == historyRows && events == 1)
+}
+
+// testOdometerCalibration calibrates a vehicle's odometer and checks that the reported total
+// starts from the new base and only adds distance travelled after the calibration
+func testOdometerCalibration() {
+	colors.PrintSubHeader("Odometer Calibration Against Database")
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		colors.PrintWarning("SKIP: set TEST_DATABASE_DSN to a scratch PostgreSQL database to run the odometer calibration test")
+		return
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		colors.PrintError("FAIL: connect to test database: %v", err)
+		return
+	}
+	db.DB = conn
+	if err := conn.AutoMigrate(&models.User{}, &models.Vehicle{}, &models.UserVehicle{}, &models.GPSData{}); err != nil {
+		colors.PrintError("FAIL: migrate odometer tables: %v", err)
+		return
+	}
+
+	phones := []string{"9800000174", "9800000175"}
+	cleanup := func() {
+		conn.Unscoped().Where("imei = ?", odometerIMEI).Delete(&models.GPSData{})
+		conn.Where("vehicle_id = ?", odometerIMEI).Delete(&models.UserVehicle{})
+		conn.Where("imei = ?", odometerIMEI).Delete(&models.Vehicle{})
+		conn.Where("phone IN ?", phones).Delete(&models.User{})
+	}
+	cleanup()
+	defer cleanup()
+
+	owner := models.User{Name: "Odometer owner", Phone: phones[0], Email: "odometer-owner@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-odometer-owner"}
+	viewer := models.User{Name: "Odometer viewer", Phone: phones[1], Email: "odometer-viewer@test.invalid",
+		Password: "secret123", Role: models.UserRoleClient, Token: "test-odometer-viewer"}
+	for _, user := range []*models.User{&owner, &viewer} {
+		if err := conn.Create(user).Error; err != nil {
+			colors.PrintError("FAIL: create test user: %v", err)
+			return
+		}
+	}
+	vehicle := models.Vehicle{IMEI: odometerIMEI, RegNo: "TEST-ODOMETER", Name: "Odometer test", VehicleType: models.VehicleTypeCar, Odometer: 5000}
+	if err := conn.Create(&vehicle).Error; err != nil {
+		colors.PrintError("FAIL: create test vehicle: %v", err)
+		return
+	}
+	conn.Create(&models.UserVehicle{UserID: owner.ID, VehicleID: odometerIMEI, IsMainUser: true, VehicleEdit: true, IsActive: true})
+	conn.Create(&models.UserVehicle{UserID: viewer.ID, VehicleID: odometerIMEI, LiveTracking: true, IsActive: true})
+
+	// Distance travelled before the calibration is already in the physical reading
+	before := 3.0
+	conn.Create(&models.GPSData{IMEI: odometerIMEI, Timestamp: time.Now().Add(-time.Minute), Ignition: "ON", DistanceFromPrev: &before})
+
+	gin.SetMode(gin.TestMode)
+	vehicleController := controllers.NewVehicleController(nil)
+	routerFor := func(user *models.User) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set("user", user) })
+		router.POST("/my-vehicles/:imei/odometer", vehicleController.CalibrateMyVehicleOdometer)
+		router.GET("/my-vehicles", vehicleController.GetMyVehicles)
+		return router
+	}
+	calibrate := func(user *models.User, body string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/my-vehicles/"+odometerIMEI+"/odometer", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		routerFor(user).ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	check("Calibration refused without edit permission", calibrate(&viewer, `{"odometer":12000}`) == http.StatusForbidden)
+	check("Negative odometer rejected", calibrate(&owner, `{"odometer":-1}`) == http.StatusBadRequest)
+	check("Odometer calibrated by the owner", calibrate(&owner, `{"odometer":12000}`) == http.StatusOK)
+
+	var calibrated models.Vehicle
+	conn.Where("imei = ?", odometerIMEI).First(&calibrated)
+	check("New base odometer stored with its calibration time", calibrated.Odometer == 12000 && calibrated.OdometerCalibratedAt != nil)
+
+	// Travel after the calibration adds to the new base
+	for _, distance := range []float64{1.5, 2.5} {
+		travelled := distance
+		conn.Create(&models.GPSData{IMEI: odometerIMEI, Timestamp: time.Now().Add(time.Second), Ignition: "ON", DistanceFromPrev: &travelled})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	recorder := httptest.NewRecorder()
+	routerFor(&owner).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/my-vehicles", nil))
+	var response struct {
+		Data []struct {
+			TotalOdometer float64 `json:"total_odometer"`
+		} `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	check("Reported total is the new base plus distance since calibration",
+		recorder.Code == http.StatusOK && len(response.Data) == 1 && math.Abs(response.Data[0].TotalOdometer-12004) < 0.01)
+}
+
+// quote wraps a value in quotes for test descriptions
+func quote(value string) string {
+	return `"` + value + `"`
+}
+
+// check prints a PASS or FAIL line for one expectation
+func check(desc string, ok bool) {
+	if ok {
+		colors.PrintSuccess("PASS: %s", desc)
+	} else {
+		colors.PrintError("FAIL: %s", desc)
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import "strconv"
+
+// GPS cleanup modes applied when a vehicle is deleted
+const (
+	GPSCleanupKeep    = "keep"    // Leave GPS rows in place
+	GPSCleanupArchive = "archive" // Write GPS rows to an archive file, then delete them
+	GPSCleanupDelete  = "delete"  // Delete GPS rows without archiving
+)
+
+// ArchiveConfig holds configuration for data archives written before irreversible deletes
+type ArchiveConfig struct {
+	Dir string
+	// What happens to a vehicle's GPS rows when the vehicle is deleted
+	VehicleDeleteGPSMode string
+	// Rows deleted per statement when removing a vehicle's GPS history
+	GPSDeleteBatchSize int
+}
+
+// GetArchiveConfig returns archive configuration from environment variables
+func GetArchiveConfig() *ArchiveConfig {
+	mode := getEnv("VEHICLE_DELETE_GPS_MODE", GPSCleanupArchive)
+	if !IsValidGPSCleanupMode(mode) {
+		mode = GPSCleanupArchive
+	}
+
+	batchSize, err := strconv.Atoi(getEnv("GPS_DELETE_BATCH_SIZE", "5000"))
+	if err != nil || batchSize <= 0 {
+		batchSize = 5000
+	}
+
+	return &ArchiveConfig{
+		Dir:                  getEnv("ARCHIVE_DIR", "archives"),
+		VehicleDeleteGPSMode: mode,
+		GPSDeleteBatchSize:   batchSize,
+	}
+}
+
+// IsValidGPSCleanupMode reports whether mode is keep, archive or delete
+func IsValidGPSCleanupMode(mode string) bool {
+	return mode == GPSCleanupKeep || mode == GPSCleanupArchive || mode == GPSCleanupDelete
+}
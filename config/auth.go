@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+// AuthConfig holds configuration for API authentication tokens
+type AuthConfig struct {
+	// HMAC secret for signing JWT access tokens; empty disables JWT issuance
+	JWTSecret string
+	// Lifetime of an issued JWT access token
+	AccessTokenTTL time.Duration
+	// Lifetime of a login session and its refresh token
+	RefreshTokenTTL time.Duration
+	// Brute-force protection for the login endpoint
+	LoginLimits LoginLimits
+}
+
+// LoginLimits controls login rate limiting and lockout after repeated failures
+type LoginLimits struct {
+	MaxFailuresPerIdentifier int           // Failed logins for one phone number before it is locked
+	MaxFailuresPerIP         int           // Failed logins from one IP before it is locked
+	MaxRequestsPerMinute     int           // Login requests per IP per minute, 0 = unlimited
+	FailureWindow            time.Duration // Failures older than this are forgotten and the backoff resets
+	LockoutBase              time.Duration // First lockout duration, doubled on each consecutive lockout
+	LockoutMax               time.Duration // Upper bound for the lockout duration
+}
+
+// GetAuthConfig returns authentication configuration from environment variables
+func GetAuthConfig() *AuthConfig {
+	accessMinutes, err := strconv.Atoi(getEnv("JWT_ACCESS_TTL_MINUTES", "15"))
+	if err != nil || accessMinutes <= 0 {
+		accessMinutes = 15
+	}
+
+	refreshDays, err := strconv.Atoi(getEnv("JWT_REFRESH_TTL_DAYS", "30"))
+	if err != nil || refreshDays <= 0 {
+		refreshDays = 30
+	}
+
+	return &AuthConfig{
+		JWTSecret:       getEnv("JWT_SECRET", ""),
+		AccessTokenTTL:  time.Duration(accessMinutes) * time.Minute,
+		RefreshTokenTTL: time.Duration(refreshDays) * 24 * time.Hour,
+		LoginLimits: LoginLimits{
+			MaxFailuresPerIdentifier: getPositiveInt("LOGIN_MAX_FAILURES", 5),
+			MaxFailuresPerIP:         getPositiveInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+			MaxRequestsPerMinute:     getNonNegativeInt("LOGIN_MAX_REQUESTS_PER_MINUTE", 30),
+			FailureWindow:            time.Duration(getPositiveInt("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute,
+			LockoutBase:              time.Duration(getPositiveInt("LOGIN_LOCKOUT_BASE_SECONDS", 60)) * time.Second,
+			LockoutMax:               time.Duration(getPositiveInt("LOGIN_LOCKOUT_MAX_MINUTES", 60)) * time.Minute,
+		},
+	}
+}
+
+// IsJWTEnabled reports whether JWT access tokens are issued and accepted
+func (c *AuthConfig) IsJWTEnabled() bool {
+	return c.JWTSecret != ""
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 )
 
 // DatabaseConfig holds database configuration
@@ -13,6 +14,14 @@ type DatabaseConfig struct {
 	Role     string
 	DBName   string
 	SSLMode  string
+
+	// Connection pool limits shared by TCP ingestion and the HTTP API
+	MaxOpenConns    int           // 0 means unlimited
+	MaxIdleConns    int           // Idle connections kept open for reuse
+	ConnMaxLifetime time.Duration // Connections are recycled after this long, 0 means never
+
+	// Optional read replica for heavy read-only queries, empty means everything uses the primary
+	ReadDSN string
 }
 
 // GetDatabaseConfig returns database configuration from environment variables
@@ -25,6 +34,12 @@ func GetDatabaseConfig() *DatabaseConfig {
 		Password: getEnv("DB_PASSWORD", "Luna@#$321"),
 		DBName:   getEnv("DB_NAME", "luna_iot"),
 		SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+
+		MaxOpenConns:    getNonNegativeInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    getNonNegativeInt("DB_MAX_IDLE_CONNS", 10),
+		ConnMaxLifetime: getDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+
+		ReadDSN: getEnv("DB_READ_DSN", ""),
 	}
 }
 
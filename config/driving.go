@@ -0,0 +1,28 @@
+package config
+
+import "time"
+
+// DrivingEventConfig holds the thresholds for harsh driving events
+type DrivingEventConfig struct {
+	// Speed drop and rise in km/h between two fixes that count as harsh braking and
+	// harsh acceleration; 0 disables that event
+	HarshBrakingKmh      int
+	HarshAccelerationKmh int
+	// Longest time between the two fixes; slower speed changes are not harsh
+	Window time.Duration
+}
+
+// GetDrivingEventConfig returns the harsh driving thresholds from environment variables.
+// By default a change of more than 12 km/h within 3 seconds is harsh.
+func GetDrivingEventConfig() *DrivingEventConfig {
+	window := getDuration("HARSH_EVENT_WINDOW", 3*time.Second)
+	if window <= 0 {
+		window = 3 * time.Second
+	}
+
+	return &DrivingEventConfig{
+		HarshBrakingKmh:      getNonNegativeInt("HARSH_BRAKING_KMH", 12),
+		HarshAccelerationKmh: getNonNegativeInt("HARSH_ACCELERATION_KMH", 12),
+		Window:               window,
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+// GeocodingConfig holds configuration for reverse geocoding
+type GeocodingConfig struct {
+	Provider       string // "nominatim", "custom" or empty to disable
+	URL            string
+	UserAgent      string
+	Timeout        time.Duration
+	CachePrecision int // Decimal places coordinates are rounded to for caching
+	CacheTTL       time.Duration
+	CacheSize      int // Most addresses kept; the least recently used are dropped first
+}
+
+// GetGeocodingConfig returns geocoding configuration from environment variables
+func GetGeocodingConfig() *GeocodingConfig {
+	timeoutSeconds, err := strconv.Atoi(getEnv("GEOCODER_TIMEOUT_SECONDS", "5"))
+	if err != nil || timeoutSeconds <= 0 {
+		timeoutSeconds = 5
+	}
+
+	precision, err := strconv.Atoi(getEnv("GEOCODER_CACHE_PRECISION", "4"))
+	if err != nil || precision < 0 {
+		precision = 4
+	}
+
+	ttlHours, err := strconv.Atoi(getEnv("GEOCODER_CACHE_TTL_HOURS", "24"))
+	if err != nil || ttlHours <= 0 {
+		ttlHours = 24
+	}
+
+	return &GeocodingConfig{
+		Provider:       getEnv("GEOCODER_PROVIDER", ""),
+		URL:            getEnv("GEOCODER_URL", "https://nominatim.openstreetmap.org/reverse"),
+		UserAgent:      getEnv("GEOCODER_USER_AGENT", "LunaIoTServer/1.0"),
+		Timeout:        time.Duration(timeoutSeconds) * time.Second,
+		CachePrecision: precision,
+		CacheTTL:       time.Duration(ttlHours) * time.Hour,
+		CacheSize:      getPositiveInt("GEOCODER_CACHE_SIZE", 10000),
+	}
+}
+
+// IsEnabled reports whether a geocoding backend is configured
+func (c *GeocodingConfig) IsEnabled() bool {
+	return c.Provider != ""
+}
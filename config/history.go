@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// DefaultHistoryMaxRangeDays is the history query limit used when HISTORY_MAX_RANGE_DAYS is not set
+const DefaultHistoryMaxRangeDays = 31
+
+// GetHistoryMaxRange returns the longest from/to range that history, route and report
+// queries accept (HISTORY_MAX_RANGE_DAYS), so one request cannot read a year of GPS data.
+// Zero disables the limit. GPX and KML route exports are not limited.
+func GetHistoryMaxRange() time.Duration {
+	return time.Duration(getNonNegativeInt("HISTORY_MAX_RANGE_DAYS", DefaultHistoryMaxRangeDays)) * 24 * time.Hour
+}
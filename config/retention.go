@@ -0,0 +1,53 @@
+package config
+
+import "time"
+
+// RetentionConfig controls the scheduled purge of old GPS history
+type RetentionConfig struct {
+	// GPS rows older than this many days are purged, 0 disables the purge
+	GPSRetentionDays int
+	// Rows with an active alarm are kept this many days instead, 0 = same as GPSRetentionDays
+	AlarmRetentionDays int
+	// What happens to purged rows: archive (write to ARCHIVE_DIR first) or delete
+	Mode string
+	// Rows removed per statement, with BatchPause between statements to spare the database
+	BatchSize  int
+	BatchPause time.Duration
+	// Local hour (0-23) at which the daily purge runs, chosen to be off-peak
+	Hour int
+}
+
+// GetRetentionConfig returns GPS retention configuration from environment variables
+func GetRetentionConfig() *RetentionConfig {
+	mode := getEnv("GPS_PURGE_MODE", GPSCleanupDelete)
+	if mode != GPSCleanupArchive && mode != GPSCleanupDelete {
+		mode = GPSCleanupDelete
+	}
+
+	hour := getNonNegativeInt("GPS_PURGE_HOUR", 2)
+	if hour > 23 {
+		hour = 2
+	}
+
+	return &RetentionConfig{
+		GPSRetentionDays:   getNonNegativeInt("GPS_RETENTION_DAYS", 0),
+		AlarmRetentionDays: getNonNegativeInt("GPS_ALARM_RETENTION_DAYS", 0),
+		Mode:               mode,
+		BatchSize:          getPositiveInt("GPS_PURGE_BATCH_SIZE", 5000),
+		BatchPause:         time.Duration(getNonNegativeInt("GPS_PURGE_BATCH_PAUSE_MS", 200)) * time.Millisecond,
+		Hour:               hour,
+	}
+}
+
+// IsEnabled reports whether old GPS rows are purged at all
+func (c *RetentionConfig) IsEnabled() bool {
+	return c.GPSRetentionDays > 0
+}
+
+// EffectiveAlarmRetentionDays returns how long alarm rows are kept, never shorter than other rows
+func (c *RetentionConfig) EffectiveAlarmRetentionDays() int {
+	if c.AlarmRetentionDays < c.GPSRetentionDays {
+		return c.GPSRetentionDays
+	}
+	return c.AlarmRetentionDays
+}
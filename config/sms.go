@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // SMSConfig holds the configuration for the SMS service
 type SMSConfig struct {
 	APIKey     string
@@ -19,3 +21,26 @@ func GetSMSConfig() *SMSConfig {
 		SenderID:   getEnv("SMS_SENDER_ID", "SMSBit"),
 	}
 }
+
+// SMSCommandConfig holds the configuration for sending control commands by SMS
+type SMSCommandConfig struct {
+	Fallback bool   // Send commands by SMS to devices without a TCP connection
+	Password string // Device password GT06 SMS commands carry
+}
+
+// GetSMSCommandConfig returns SMS command configuration from environment variables
+func GetSMSCommandConfig() *SMSCommandConfig {
+	return &SMSCommandConfig{
+		Fallback: getEnv("SMS_COMMAND_FALLBACK", "false") == "true",
+		Password: getEnv("SMS_COMMAND_PASSWORD", "000000"),
+	}
+}
+
+// DefaultControlCommandCooldown is how long a device must wait between oil/electricity commands
+const DefaultControlCommandCooldown = 15 * time.Second
+
+// GetControlCommandCooldown reads CONTROL_COMMAND_COOLDOWN, the minimum time between
+// oil/electricity commands to one device; 0 disables the cooldown
+func GetControlCommandCooldown() time.Duration {
+	return getDuration("CONTROL_COMMAND_COOLDOWN", DefaultControlCommandCooldown)
+}
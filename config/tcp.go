@@ -0,0 +1,173 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TCPConfig holds configuration for the device TCP server
+type TCPConfig struct {
+	MaxConnections int // Maximum simultaneous device connections, 0 disables the limit
+	MinSatellites  int // Minimum satellites for a GPS fix to be accepted when validation is on
+	// Weight of the new fix when smoothing, in (0,1]; 1 disables smoothing in effect
+	SmoothingWeight float64
+	// Highest believable speed in km/h per vehicle type; faster fixes are treated as corrupt
+	MaxSpeeds map[string]int
+	// Replace a reported speed that clearly disagrees with the speed implied by position changes
+	SpeedCrossCheck bool
+	// Reject fixes that could only be reached from the previous fix above the vehicle type's
+	// MaxSpeeds, i.e. position jumps
+	JumpFilter bool
+	// Which fixes keep their coordinates: GPSFilterModeAll, GPSFilterModeIgnitionOn or GPSFilterModeMoving
+	GPSFilterMode string
+	// Speed in km/h at which a vehicle counts as moving, see GetMovingSpeedKmh
+	MovingSpeedKmh int
+	// How devices missing from the devices table are treated, one of the UnregisteredDevicePolicy values
+	UnregisteredDevicePolicy string
+	// How often in-memory vehicle notification states are swept, and how long a state
+	// may go without an update before the sweep removes it
+	VehicleStateCleanupInterval time.Duration
+	VehicleStateMaxAge          time.Duration
+	// Most devices whose per-IMEI state (connections, vehicle types, notification states)
+	// is kept in memory; the least recently seen are evicted beyond this
+	DeviceStateCapacity int
+}
+
+// GPS filter modes. Filtered fixes are stored as status only, without coordinates.
+const (
+	GPSFilterModeAll        = "all"         // Keep every fix, for route continuity
+	GPSFilterModeIgnitionOn = "ignition_on" // Drop coordinates while the ignition is off
+	GPSFilterModeMoving     = "moving"      // Drop coordinates while the ignition is off or the vehicle is stationary
+)
+
+// IsValidGPSFilterMode reports whether mode is one of the GPS filter modes
+func IsValidGPSFilterMode(mode string) bool {
+	return mode == GPSFilterModeAll || mode == GPSFilterModeIgnitionOn || mode == GPSFilterModeMoving
+}
+
+// Unregistered device policies. Data from a device whose IMEI is not registered is never
+// stored; the policy decides how much else the server spends on it.
+const (
+	UnregisteredDevicePolicyAccept = "accept" // Keep the connection and acknowledge its packets
+	UnregisteredDevicePolicyIgnore = "ignore" // Keep the connection but neither acknowledge nor process its packets
+	UnregisteredDevicePolicyReject = "reject" // Close the connection at login
+)
+
+// IsValidUnregisteredDevicePolicy reports whether policy is one of the unregistered device policies
+func IsValidUnregisteredDevicePolicy(policy string) bool {
+	return policy == UnregisteredDevicePolicyAccept || policy == UnregisteredDevicePolicyIgnore ||
+		policy == UnregisteredDevicePolicyReject
+}
+
+// DefaultMovingSpeedKmh is the moving threshold used when MOVING_SPEED_KMH is not set
+const DefaultMovingSpeedKmh = 5
+
+// GetMovingSpeedKmh returns the speed in km/h at which a vehicle counts as moving.
+// Live vehicle states, notifications, GPS filtering and ETAs all use this one threshold.
+func GetMovingSpeedKmh() int {
+	return getNonNegativeInt("MOVING_SPEED_KMH", DefaultMovingSpeedKmh)
+}
+
+// GetHonorGPSHemisphere reports whether GT06 fixes south of the equator get a negative
+// latitude (GPS_HONOR_HEMISPHERE=true). Off by default, keeping latitude always positive
+// as the Nepal deployments expect.
+func GetHonorGPSHemisphere() bool {
+	return getEnv("GPS_HONOR_HEMISPHERE", "false") == "true"
+}
+
+// GetGPSCoordinateDivisor returns the raw units per degree of GT06 coordinates
+// (GPS_COORDINATE_DIVISOR), for device clones that scale them differently.
+// It is 0 when unset or invalid, leaving the decoder on the standard GT06 divisor.
+func GetGPSCoordinateDivisor() float64 {
+	divisor, err := strconv.ParseFloat(getEnv("GPS_COORDINATE_DIVISOR", "0"), 64)
+	if err != nil || divisor <= 0 {
+		return 0
+	}
+	return divisor
+}
+
+// IsMovingSpeed reports whether a speed reaches the moving threshold; below it a vehicle
+// is stationary
+func IsMovingSpeed(speed, movingSpeedKmh int) bool {
+	return speed >= movingSpeedKmh
+}
+
+// defaultMaxSpeeds are the plausible speed limits (km/h) used when no override is set
+var defaultMaxSpeeds = map[string]int{
+	"bike":       150,
+	"car":        200,
+	"truck":      140,
+	"bus":        140,
+	"school_bus": 120,
+}
+
+// GetTCPConfig returns TCP server configuration from environment variables
+func GetTCPConfig() *TCPConfig {
+	maxConnections, err := strconv.Atoi(getEnv("MAX_TCP_CONNECTIONS", "0"))
+	if err != nil || maxConnections < 0 {
+		maxConnections = 0
+	}
+
+	minSatellites, err := strconv.Atoi(getEnv("GPS_MIN_SATELLITES", "1"))
+	if err != nil || minSatellites < 0 {
+		minSatellites = 1
+	}
+
+	smoothingWeight, err := strconv.ParseFloat(getEnv("GPS_SMOOTHING_WEIGHT", "0.95"), 64)
+	if err != nil || !IsValidSmoothingWeight(smoothingWeight) {
+		smoothingWeight = 0.95
+	}
+
+	// Per-type overrides, e.g. GPS_MAX_SPEED_BIKE=120
+	maxSpeeds := make(map[string]int, len(defaultMaxSpeeds))
+	for vehicleType, fallback := range defaultMaxSpeeds {
+		envKey := "GPS_MAX_SPEED_" + strings.ToUpper(vehicleType)
+		maxSpeed, err := strconv.Atoi(getEnv(envKey, strconv.Itoa(fallback)))
+		if err != nil || maxSpeed <= 0 {
+			maxSpeed = fallback
+		}
+		maxSpeeds[vehicleType] = maxSpeed
+	}
+
+	gpsFilterMode := strings.ToLower(getEnv("GPS_FILTER_MODE", GPSFilterModeMoving))
+	if !IsValidGPSFilterMode(gpsFilterMode) {
+		gpsFilterMode = GPSFilterModeMoving
+	}
+
+	unregisteredDevicePolicy := strings.ToLower(getEnv("UNREGISTERED_DEVICE_POLICY", UnregisteredDevicePolicyAccept))
+	if !IsValidUnregisteredDevicePolicy(unregisteredDevicePolicy) {
+		unregisteredDevicePolicy = UnregisteredDevicePolicyAccept
+	}
+
+	// A zero interval would stop the sweep and a zero age would drop live states
+	vehicleStateCleanupInterval := getDuration("VEHICLE_STATE_CLEANUP_INTERVAL", 6*time.Hour)
+	if vehicleStateCleanupInterval <= 0 {
+		vehicleStateCleanupInterval = 6 * time.Hour
+	}
+	vehicleStateMaxAge := getDuration("VEHICLE_STATE_MAX_AGE", 24*time.Hour)
+	if vehicleStateMaxAge <= 0 {
+		vehicleStateMaxAge = 24 * time.Hour
+	}
+
+	return &TCPConfig{
+		MaxConnections:  maxConnections,
+		MinSatellites:   minSatellites,
+		SmoothingWeight: smoothingWeight,
+		MaxSpeeds:       maxSpeeds,
+		SpeedCrossCheck: getEnv("GPS_SPEED_CROSSCHECK", "false") == "true",
+		JumpFilter:      getEnv("GPS_JUMP_FILTER", "true") != "false",
+		GPSFilterMode:   gpsFilterMode,
+
+		VehicleStateCleanupInterval: vehicleStateCleanupInterval,
+		VehicleStateMaxAge:          vehicleStateMaxAge,
+		DeviceStateCapacity:         getPositiveInt("DEVICE_STATE_CAPACITY", 20000),
+		MovingSpeedKmh:              GetMovingSpeedKmh(),
+		UnregisteredDevicePolicy:    unregisteredDevicePolicy,
+	}
+}
+
+// IsValidSmoothingWeight reports whether a smoothing weight is in the range (0,1]
+func IsValidSmoothingWeight(weight float64) bool {
+	return weight > 0 && weight <= 1
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"strings"
 	"time"
 )
 
@@ -78,3 +79,42 @@ func GetTimezoneString() string {
 	}
 	return "Asia/Kathmandu"
 }
+
+// TimestampLayout is the format of timestamps in API and WebSocket responses:
+// RFC 3339 with the numeric offset, e.g. 2025-07-19T18:30:00+05:45
+const TimestampLayout = time.RFC3339
+
+// AppLocation returns the application timezone, or Kathmandu's fixed offset before initialization
+func AppLocation() *time.Location {
+	if AppTimezone != nil && AppTimezone.Location != nil {
+		return AppTimezone.Location
+	}
+	if KathmanduLocation != nil {
+		return KathmanduLocation
+	}
+	return time.FixedZone("Asia/Kathmandu", 5*3600+45*60)
+}
+
+// InAppTimezone returns t in the application timezone, e.g. to read its time of day
+func InAppTimezone(t time.Time) time.Time {
+	return t.In(AppLocation())
+}
+
+// FormatTimestamp formats a time for API output in the application timezone, including its offset
+func FormatTimestamp(t time.Time) string {
+	return t.In(AppLocation()).Format(TimestampLayout)
+}
+
+// ParseTimestamp parses a timestamp from a request. RFC 3339 values keep their offset
+// ("Z" is UTC, as before); values without an offset are read in the application timezone.
+// A "+" left unencoded in a query string arrives as a space, so a space before the offset
+// is read as "+".
+func ParseTimestamp(value string) (time.Time, error) {
+	if date, offset, found := strings.Cut(value, " "); found {
+		value = date + "+" + offset
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04:05", value, AppLocation())
+}
@@ -0,0 +1,26 @@
+package config
+
+import "time"
+
+// TowAwayConfig holds the thresholds for detecting a vehicle moved while its ignition is off
+type TowAwayConfig struct {
+	// How far in meters the vehicle must be from where it parked; 0 disables detection.
+	// Well above GPS drift around a parked vehicle.
+	DistanceMeters int
+	// How long the vehicle must stay that far away, so a single stray fix is not an alert
+	MinDuration time.Duration
+}
+
+// GetTowAwayConfig returns the tow-away thresholds from environment variables.
+// By default a vehicle 200 m from where it parked for 2 minutes is being towed.
+func GetTowAwayConfig() *TowAwayConfig {
+	minDuration := getDuration("TOW_AWAY_MIN_DURATION", 2*time.Minute)
+	if minDuration < 0 {
+		minDuration = 2 * time.Minute
+	}
+
+	return &TowAwayConfig{
+		DistanceMeters: getNonNegativeInt("TOW_AWAY_DISTANCE_METERS", 200),
+		MinDuration:    minDuration,
+	}
+}
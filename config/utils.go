@@ -1,6 +1,10 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
 // getEnv is a helper to get env var with fallback
 func getEnv(key, fallback string) string {
@@ -9,3 +13,30 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getPositiveInt reads an integer env var, using fallback when unset, invalid or not positive
+func getPositiveInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, strconv.Itoa(fallback)))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// getNonNegativeInt reads an integer env var where 0 is meaningful, using fallback when unset or invalid
+func getNonNegativeInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, strconv.Itoa(fallback)))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// getDuration reads a Go duration env var such as "30m" or "1h", using fallback when unset, invalid or negative
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, fallback.String()))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
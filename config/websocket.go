@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// WebSocketConfig holds configuration for the WebSocket endpoints
+type WebSocketConfig struct {
+	// Browser origins allowed to open a WebSocket, e.g. https://app.example.com.
+	// Empty allows every origin.
+	AllowedOrigins []string
+	// A client silent for PingInterval is pinged; connections are checked every half interval
+	PingInterval time.Duration
+	// A client silent for StaleTimeout is disconnected by the hub's connection monitor
+	StaleTimeout time.Duration
+}
+
+// ReadTimeout is how long a connection's read may wait for a message or a pong before the
+// connection is closed. The monitor pings a silent client between PingInterval and 1.5x
+// PingInterval after its last activity, so twice the interval leaves at least half an
+// interval for the pong to arrive. With a short PingInterval this deadline, not
+// StaleTimeout, is what drops a client that stopped answering.
+func (c *WebSocketConfig) ReadTimeout() time.Duration {
+	return 2 * c.PingInterval
+}
+
+// GetWebSocketConfig returns WebSocket configuration from environment variables
+func GetWebSocketConfig() *WebSocketConfig {
+	var allowedOrigins []string
+	for _, origin := range strings.Split(getEnv("WS_ALLOWED_ORIGINS", ""), ",") {
+		if origin = NormalizeOrigin(origin); origin != "" {
+			allowedOrigins = append(allowedOrigins, origin)
+		}
+	}
+
+	// A zero interval would stop the monitor, and a stale timeout within the ping interval
+	// would drop clients before they are pinged
+	pingInterval := getDuration("WS_PING_INTERVAL", time.Minute)
+	if pingInterval <= 0 {
+		pingInterval = time.Minute
+	}
+	staleTimeout := getDuration("WS_STALE_TIMEOUT", 10*time.Minute)
+	if staleTimeout <= pingInterval {
+		staleTimeout = max(10*time.Minute, 2*pingInterval)
+	}
+
+	return &WebSocketConfig{
+		AllowedOrigins: allowedOrigins,
+		PingInterval:   pingInterval,
+		StaleTimeout:   staleTimeout,
+	}
+}
+
+// IsOriginAllowed reports whether a browser origin may open a WebSocket
+func (c *WebSocketConfig) IsOriginAllowed(origin string) bool {
+	if len(c.AllowedOrigins) == 0 {
+		return true
+	}
+	origin = NormalizeOrigin(origin)
+	for _, allowed := range c.AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeOrigin lowercases an origin and drops surrounding spaces and a trailing slash
+func NormalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
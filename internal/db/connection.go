@@ -1,11 +1,15 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"luna_iot_server/config"
 	"luna_iot_server/internal/models"
 	"luna_iot_server/pkg/colors"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -13,6 +17,9 @@ import (
 
 var DB *gorm.DB
 
+// ReadDB is the optional read replica; nil when DB_READ_DSN is not set
+var ReadDB *gorm.DB
+
 // Initialize establishes database connection and runs migrations
 func Initialize() error {
 	dbConfig := config.GetDatabaseConfig()
@@ -20,7 +27,7 @@ func Initialize() error {
 	colors.PrintDebug("Database DSN: %s", dsn)
 
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	DB, err = Open(dsn, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 
@@ -30,6 +37,18 @@ func Initialize() error {
 
 	colors.PrintSuccess("Database connection established successfully")
 
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to access database connection pool: %v", err)
+	}
+	ApplyPoolConfig(sqlDB, dbConfig)
+	colors.PrintInfo("Database pool: max open %d, max idle %d, max lifetime %v",
+		dbConfig.MaxOpenConns, dbConfig.MaxIdleConns, dbConfig.ConnMaxLifetime)
+
+	if err := initializeReadReplica(dbConfig); err != nil {
+		return err
+	}
+
 	// Run auto-migrations
 	if err := RunMigrations(); err != nil {
 		return fmt.Errorf("failed to run migrations: %v", err)
@@ -40,6 +59,27 @@ func Initialize() error {
 	return nil
 }
 
+// Open connects to PostgreSQL with timestamps read in the application timezone, so
+// time.Time fields loaded from the database serialize with its offset. Initialize the
+// timezone first.
+func Open(dsn string, gormConfig *gorm.Config) (*gorm.DB, error) {
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	location := config.AppLocation()
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionAfterConnect(func(ctx context.Context, conn *pgx.Conn) error {
+		conn.TypeMap().RegisterType(&pgtype.Type{
+			Name:  "timestamptz",
+			OID:   pgtype.TimestamptzOID,
+			Codec: &pgtype.TimestamptzCodec{ScanLocation: location},
+		})
+		return nil
+	}))
+	return gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), gormConfig)
+}
+
 // RunMigrations runs all database migrations
 func RunMigrations() error {
 	colors.PrintSubHeader("Running Database Migrations")
@@ -66,6 +106,17 @@ func RunMigrations() error {
 		&models.Popup{},
 		&models.Notification{},
 		&models.NotificationUser{},
+		&models.AuthSession{},
+		&models.UserDevice{},
+		&models.NotificationTemplate{},
+		&models.Driver{},
+		&models.VehicleDriverAssignment{},
+		&models.MaintenanceSchedule{},
+		&models.VehicleGroup{},
+		&models.VehicleGroupMember{},
+		&models.ControlCommand{},
+		&models.AuditLog{},
+		&models.DrivingEvent{},
 	)
 	if err != nil {
 		return fmt.Errorf("auto-migration failed: %v", err)
@@ -89,6 +140,30 @@ func RunMigrations() error {
 	}
 	colors.PrintSuccess("✓ User-Vehicle permissions table structure verified")
 
+	// Deduplicate replayed GPS frames at the database level
+	if err := addGPSDataUniqueIndex(DB); err != nil {
+		return fmt.Errorf("failed to add gps_data unique index: %v", err)
+	}
+	colors.PrintSuccess("✓ GPS data replay protection index verified")
+
+	// Copy single-column FCM tokens into the per-device table
+	if err := backfillUserDevices(DB); err != nil {
+		return fmt.Errorf("failed to backfill user devices: %v", err)
+	}
+	colors.PrintSuccess("✓ User device tokens verified")
+
+	// Allow one template per name and language
+	if err := dropNotificationTemplateNameIndex(DB); err != nil {
+		return fmt.Errorf("failed to update notification template index: %v", err)
+	}
+	colors.PrintSuccess("✓ Notification template indexes verified")
+
+	// Index the per-IMEI latest-first lookups used by tracking, history and reports
+	if err := addGPSDataQueryIndexes(DB); err != nil {
+		return fmt.Errorf("failed to add gps_data query indexes: %v", err)
+	}
+	colors.PrintSuccess("✓ GPS data query indexes verified")
+
 	colors.PrintHeader("DATABASE MIGRATIONS COMPLETED SUCCESSFULLY")
 	return nil
 }
@@ -98,8 +173,48 @@ func GetDB() *gorm.DB {
 	return DB
 }
 
+// GetReadDB returns the read replica for heavy read-only queries such as history and
+// reports, or the primary when no replica is configured. Replicas can lag slightly
+// behind, so reads that must see a just-committed write should use GetDB.
+func GetReadDB() *gorm.DB {
+	if ReadDB != nil {
+		return ReadDB
+	}
+	return DB
+}
+
+// initializeReadReplica connects to DB_READ_DSN when set, with the same pool limits as the primary
+func initializeReadReplica(dbConfig *config.DatabaseConfig) error {
+	if dbConfig.ReadDSN == "" {
+		return nil
+	}
+
+	replica, err := Open(dbConfig.ReadDSN, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to read replica: %v", err)
+	}
+
+	sqlDB, err := replica.DB()
+	if err != nil {
+		return fmt.Errorf("failed to access read replica connection pool: %v", err)
+	}
+	ApplyPoolConfig(sqlDB, dbConfig)
+
+	ReadDB = replica
+	colors.PrintSuccess("Read replica connection established, history and report queries use it")
+	return nil
+}
+
 // Close closes the database connection
 func Close() error {
+	if ReadDB != nil {
+		if sqlDB, err := ReadDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+
 	sqlDB, err := DB.DB()
 	if err != nil {
 		return err
@@ -476,3 +476,121 @@ func updateNotificationImageURLs(db *gorm.DB) error {
 	colors.PrintSuccess("✓ Notification image URLs updated to use public endpoint")
 	return nil
 }
+
+// addGPSDataUniqueIndex removes replayed GPS rows and adds a unique index on
+// (imei, timestamp, protocol_name) so device replays are deduplicated on insert
+func addGPSDataUniqueIndex(db *gorm.DB) error {
+	var indexExists int64
+	db.Raw(`
+		SELECT COUNT(*)
+		FROM pg_indexes
+		WHERE tablename = 'gps_data'
+		AND indexname = 'idx_gps_data_imei_timestamp_protocol'
+	`).Count(&indexExists)
+
+	if indexExists > 0 {
+		colors.PrintInfo("GPS data unique index already exists")
+		return nil
+	}
+
+	// Existing duplicates would block the unique index; keep the earliest row of each
+	colors.PrintInfo("Removing duplicate GPS data rows before adding unique index...")
+	result := db.Exec(`
+		DELETE FROM gps_data a
+		USING gps_data b
+		WHERE a.imei = b.imei
+		AND a.timestamp = b.timestamp
+		AND a.protocol_name = b.protocol_name
+		AND a.id > b.id
+	`)
+	if result.Error != nil {
+		return result.Error
+	}
+	colors.PrintInfo("Removed %d duplicate GPS data rows", result.RowsAffected)
+
+	if err := db.Exec("CREATE UNIQUE INDEX idx_gps_data_imei_timestamp_protocol ON gps_data(imei, timestamp, protocol_name)").Error; err != nil {
+		return err
+	}
+	colors.PrintSuccess("Created unique index on gps_data(imei, timestamp, protocol_name)")
+
+	return nil
+}
+
+// backfillUserDevices copies users.fcm_token into user_devices so multi-device
+// sends include tokens registered before the table existed
+func backfillUserDevices(db *gorm.DB) error {
+	result := db.Exec(`
+		INSERT INTO user_devices (user_id, fcm_token, platform, is_active, last_seen_at, created_at, updated_at)
+		SELECT u.id, u.fcm_token, 'unknown', true, u.updated_at, NOW(), NOW()
+		FROM users u
+		WHERE u.fcm_token IS NOT NULL AND u.fcm_token != ''
+		ON CONFLICT (fcm_token) DO NOTHING
+	`)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		colors.PrintInfo("Copied %d legacy FCM tokens into user_devices", result.RowsAffected)
+	}
+	return nil
+}
+
+// dropNotificationTemplateNameIndex removes the name-only unique index from before
+// templates were per language; names are now unique together with the language
+func dropNotificationTemplateNameIndex(db *gorm.DB) error {
+	return db.Exec("DROP INDEX IF EXISTS idx_notification_templates_name").Error
+}
+
+// gpsDataQueryIndexes support the common "latest rows for one IMEI" lookups.
+// The second is partial so lookups for the last known position skip rows without a fix.
+var gpsDataQueryIndexes = []struct {
+	name       string
+	definition string
+}{
+	{
+		name:       "idx_gps_data_imei_timestamp",
+		definition: "ON gps_data (imei, timestamp DESC)",
+	},
+	{
+		name:       "idx_gps_data_imei_timestamp_location",
+		definition: "ON gps_data (imei, timestamp DESC) WHERE latitude IS NOT NULL AND longitude IS NOT NULL",
+	},
+}
+
+// addGPSDataQueryIndexes creates the (imei, timestamp DESC) indexes. They are built
+// CONCURRENTLY so GPS ingestion keeps writing while a large table is indexed; an
+// invalid index left by an interrupted build is dropped and rebuilt.
+func addGPSDataQueryIndexes(db *gorm.DB) error {
+	for _, index := range gpsDataQueryIndexes {
+		var valid []bool
+		if err := db.Raw(`
+			SELECT i.indisvalid
+			FROM pg_index i
+			JOIN pg_class c ON c.oid = i.indexrelid
+			WHERE c.relname = ?
+		`, index.name).Scan(&valid).Error; err != nil {
+			return err
+		}
+
+		if len(valid) > 0 && valid[0] {
+			colors.PrintInfo("GPS data index %s already exists", index.name)
+			continue
+		}
+
+		if len(valid) > 0 {
+			colors.PrintWarning("GPS data index %s is invalid, rebuilding", index.name)
+			if err := db.Exec("DROP INDEX CONCURRENTLY IF EXISTS " + index.name).Error; err != nil {
+				return err
+			}
+		}
+
+		colors.PrintInfo("Creating GPS data index %s (this can take a while on large tables)...", index.name)
+		if err := db.Exec("CREATE INDEX CONCURRENTLY " + index.name + " " + index.definition).Error; err != nil {
+			return err
+		}
+		colors.PrintSuccess("Created index %s", index.name)
+	}
+
+	return nil
+}
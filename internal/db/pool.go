@@ -0,0 +1,52 @@
+package db
+
+import (
+	"database/sql"
+	"luna_iot_server/config"
+	"time"
+)
+
+// PoolStats describes database connection pool usage for the health endpoint
+type PoolStats struct {
+	MaxOpen           int    `json:"max_open"` // 0 means unlimited
+	Open              int    `json:"open"`
+	InUse             int    `json:"in_use"`
+	Idle              int    `json:"idle"`
+	WaitCount         int64  `json:"wait_count"`
+	WaitDuration      string `json:"wait_duration"`
+	MaxIdleClosed     int64  `json:"max_idle_closed"`
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`
+}
+
+// ApplyPoolConfig sets the connection pool limits on the underlying sql.DB
+func ApplyPoolConfig(sqlDB *sql.DB, dbConfig *config.DatabaseConfig) {
+	sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(dbConfig.ConnMaxLifetime)
+}
+
+// NewPoolStats converts sql.DBStats to the health endpoint form
+func NewPoolStats(stats sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpen:           stats.MaxOpenConnections,
+		Open:              stats.OpenConnections,
+		InUse:             stats.InUse,
+		Idle:              stats.Idle,
+		WaitCount:         stats.WaitCount,
+		WaitDuration:      stats.WaitDuration.Round(time.Millisecond).String(),
+		MaxIdleClosed:     stats.MaxIdleClosed,
+		MaxLifetimeClosed: stats.MaxLifetimeClosed,
+	}
+}
+
+// GetPoolStats returns the current pool usage, or false when there is no connection
+func GetPoolStats() (PoolStats, bool) {
+	if DB == nil {
+		return PoolStats{}, false
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return PoolStats{}, false
+	}
+	return NewPoolStats(sqlDB.Stats()), true
+}
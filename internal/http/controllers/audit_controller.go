@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/http/middleware"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditController serves the audit log of security-sensitive actions to admins
+type AuditController struct{}
+
+// NewAuditController creates a new audit controller
+func NewAuditController() *AuditController {
+	return &AuditController{}
+}
+
+// recordAudit stores an audit entry for the current request, taking the actor from the
+// authenticated user and the result from the response status. Handlers defer it once the
+// target is known so every outcome, including rejections, is recorded.
+func recordAudit(c *gin.Context, action, targetType, targetID string) {
+	entry := &models.AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IPAddress:  c.ClientIP(),
+		RequestID:  middleware.GetRequestID(c),
+		StatusCode: c.Writer.Status(),
+		Result:     services.AuditResultForStatus(c.Writer.Status()),
+	}
+	if currentUser, exists := c.Get("user"); exists {
+		if user, ok := currentUser.(*models.User); ok {
+			entry.ActorID = &user.ID
+			entry.ActorName = user.Name
+			entry.ActorRole = user.Role.String()
+		}
+	}
+	services.RecordAudit(entry)
+}
+
+// GetAuditLogs returns audit entries, newest first. Filters: actor_id, action, target_type,
+// target_id, result, and from/to as RFC 3339 times; page and limit paginate.
+func (ac *AuditController) GetAuditLogs(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	filter := services.AuditLogFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		Result:     c.Query("result"),
+	}
+
+	if actorParam := c.Query("actor_id"); actorParam != "" {
+		actorID, err := strconv.ParseUint(actorParam, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid actor_id filter",
+				"message": "actor_id must be a user ID",
+			})
+			return
+		}
+		id := uint(actorID)
+		filter.ActorID = &id
+	}
+
+	if from := c.Query("from"); from != "" {
+		fromTime, err := config.ParseTimestamp(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
+		}
+		filter.From = &fromTime
+	}
+	if to := c.Query("to"); to != "" {
+		toTime, err := config.ParseTimestamp(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
+		}
+		filter.To = &toTime
+	}
+
+	logs, total, err := services.GetAuditLogs(filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get audit logs",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	totalPages := int((total + int64(limit) - 1) / int64(limit))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    logs,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total_count": total,
+			"total_pages": totalPages,
+			"has_next":    page < totalPages,
+			"has_prev":    page > 1,
+		},
+	})
+}
@@ -2,17 +2,22 @@ package controllers
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"luna_iot_server/config"
+	"math"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/http/middleware"
 	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
 	"luna_iot_server/pkg/colors"
 
 	"github.com/gin-gonic/gin"
@@ -32,11 +37,17 @@ var (
 )
 
 // AuthController handles authentication related HTTP requests
-type AuthController struct{}
+type AuthController struct {
+	sessionService *services.AuthSessionService
+	loginAttempts  *services.LoginAttemptTracker
+}
 
 // NewAuthController creates a new auth controller
 func NewAuthController() *AuthController {
-	return &AuthController{}
+	return &AuthController{
+		sessionService: services.NewAuthSessionService(),
+		loginAttempts:  services.GetLoginAttemptTracker(),
+	}
 }
 
 // LoginRequest represents the login request body
@@ -58,11 +69,73 @@ type RegisterRequest struct {
 
 // AuthResponse represents the authentication response
 type AuthResponse struct {
-	Success bool                   `json:"success"`
-	Message string                 `json:"message"`
-	Token   string                 `json:"token,omitempty"`
-	User    map[string]interface{} `json:"user,omitempty"`
-	Error   string                 `json:"error,omitempty"`
+	Success      bool                   `json:"success"`
+	Message      string                 `json:"message"`
+	Token        string                 `json:"token,omitempty"`
+	AccessToken  string                 `json:"access_token,omitempty"` // JWT, only issued when JWT_SECRET is set
+	RefreshToken string                 `json:"refresh_token,omitempty"`
+	ExpiresIn    int64                  `json:"expires_in,omitempty"` // Access token lifetime in seconds
+	User         map[string]interface{} `json:"user,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// RefreshTokenRequest represents the refresh request body
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutSessionRequest identifies the session to revoke; the current session is used when empty
+type LogoutSessionRequest struct {
+	SessionID    string `json:"session_id"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// UpdateLanguageRequest sets the language notifications are sent in
+type UpdateLanguageRequest struct {
+	Language string `json:"language" binding:"required"`
+}
+
+// sessionTokens are the JWT credentials returned for a login session
+type sessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+}
+
+// startSession creates a refresh-token session for the user and signs its first access token.
+// It returns empty tokens when JWT access tokens are disabled.
+func (ac *AuthController) startSession(c *gin.Context, user *models.User) (sessionTokens, error) {
+	authConfig := config.GetAuthConfig()
+	if !authConfig.IsJWTEnabled() {
+		return sessionTokens{}, nil
+	}
+
+	session, refreshToken, err := ac.sessionService.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	accessToken, err := middleware.IssueAccessToken(user, session.SessionID)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	return sessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(authConfig.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// loadFullUser reloads the authenticated user's complete record.
+// Users authenticated by JWT carry only identity claims, so handlers that
+// read or write other columns must not use the context user directly.
+func loadFullUser(user *models.User) (*models.User, error) {
+	var fullUser models.User
+	if err := db.GetDB().First(&fullUser, user.ID).Error; err != nil {
+		return nil, err
+	}
+	return &fullUser, nil
 }
 
 // Login authenticates a user and returns a token
@@ -80,10 +153,25 @@ func (ac *AuthController) Login(c *gin.Context) {
 
 	colors.PrintInfo("Login attempt for phone: %s", req.Phone)
 
+	// Reject rate-limited or locked-out clients before checking credentials
+	clientIP := c.ClientIP()
+	if retryAfter, allowed := ac.loginAttempts.Allow(clientIP, req.Phone); !allowed {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		colors.PrintWarning("Login blocked for phone %s from %s, retry after %ds", req.Phone, clientIP, seconds)
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, AuthResponse{
+			Success: false,
+			Error:   "Too many login attempts",
+			Message: fmt.Sprintf("Please try again in %d seconds", seconds),
+		})
+		return
+	}
+
 	// Find user by phone number
 	var user models.User
 	if err := db.GetDB().Where("phone = ?", req.Phone).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			ac.loginAttempts.RecordFailure(clientIP, req.Phone)
 			colors.PrintWarning("Login failed: User not found for phone %s", req.Phone)
 			c.JSON(http.StatusUnauthorized, AuthResponse{
 				Success: false,
@@ -114,6 +202,7 @@ func (ac *AuthController) Login(c *gin.Context) {
 
 	// Check password
 	if !user.CheckPassword(req.Password) {
+		ac.loginAttempts.RecordFailure(clientIP, req.Phone)
 		colors.PrintWarning("Login failed: Invalid password for phone %s", req.Phone)
 		c.JSON(http.StatusUnauthorized, AuthResponse{
 			Success: false,
@@ -123,6 +212,8 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
+	ac.loginAttempts.RecordSuccess(req.Phone)
+
 	// Generate new token
 	if err := user.GenerateToken(); err != nil {
 		colors.PrintError("Failed to generate token for user %s: %v", req.Phone, err)
@@ -161,12 +252,26 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
+	tokens, err := ac.startSession(c, &user)
+	if err != nil {
+		colors.PrintError("Failed to start session for user %s: %v", req.Phone, err)
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Error:   "Failed to generate authentication token",
+			Message: "Please try again later",
+		})
+		return
+	}
+
 	colors.PrintSuccess("User %s logged in successfully", req.Phone)
 	c.JSON(http.StatusOK, AuthResponse{
-		Success: true,
-		Message: "Login successful",
-		Token:   user.Token,
-		User:    user.ToSafeUser(),
+		Success:      true,
+		Message:      "Login successful",
+		Token:        user.Token,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         user.ToSafeUser(),
 	})
 }
 
@@ -403,7 +508,16 @@ func (ac *AuthController) Logout(c *gin.Context) {
 		return
 	}
 
-	user := userInterface.(*models.User)
+	user, err := loadFullUser(userInterface.(*models.User))
+	if err != nil {
+		colors.PrintWarning("Authenticated user could not be loaded: %v", err)
+		c.JSON(http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Error:   "Unauthorized",
+			Message: "User not found",
+		})
+		return
+	}
 
 	// Clear token
 	user.ClearToken()
@@ -417,6 +531,15 @@ func (ac *AuthController) Logout(c *gin.Context) {
 		return
 	}
 
+	// Revoke the JWT session this request was made with, if any
+	if sessionID := c.GetString("session_id"); sessionID != "" {
+		if session, err := ac.sessionService.GetSession(sessionID); err == nil {
+			if err := ac.sessionService.RevokeSession(session); err != nil {
+				colors.PrintWarning("Failed to revoke session %s on logout: %v", sessionID, err)
+			}
+		}
+	}
+
 	colors.PrintInfo("User %s logged out successfully", user.Email)
 	c.JSON(http.StatusOK, AuthResponse{
 		Success: true,
@@ -437,7 +560,16 @@ func (ac *AuthController) Me(c *gin.Context) {
 		return
 	}
 
-	user := userInterface.(*models.User)
+	user, err := loadFullUser(userInterface.(*models.User))
+	if err != nil {
+		colors.PrintWarning("Authenticated user could not be loaded: %v", err)
+		c.JSON(http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Error:   "Unauthorized",
+			Message: "User not found",
+		})
+		return
+	}
 	c.JSON(http.StatusOK, AuthResponse{
 		Success: true,
 		Message: "User information retrieved successfully",
@@ -467,7 +599,14 @@ func (ac *AuthController) DeleteAccount(c *gin.Context) {
 		})
 		return
 	}
-	user := currentUser.(*models.User)
+	user, err := loadFullUser(currentUser.(*models.User))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Error:   "User not found",
+		})
+		return
+	}
 
 	password := c.Query("password")
 	if password == "" {
@@ -509,9 +648,26 @@ func (ac *AuthController) DeleteAccount(c *gin.Context) {
 	})
 }
 
-// RefreshToken generates a new token for the authenticated user
+// RefreshToken exchanges a refresh token for new session tokens, or, without one,
+// regenerates the legacy token for the authenticated user
 func (ac *AuthController) RefreshToken(c *gin.Context) {
-	// Get user from context (set by auth middleware)
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Error:   "Invalid request format",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Session refresh: exchange the refresh token, no Authorization header needed
+	if req.RefreshToken != "" {
+		ac.refreshSession(c, req.RefreshToken)
+		return
+	}
+
+	// Legacy refresh: regenerate the permanent token of the authenticated user
 	userInterface, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, AuthResponse{
@@ -522,7 +678,16 @@ func (ac *AuthController) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	user := userInterface.(*models.User)
+	user, err := loadFullUser(userInterface.(*models.User))
+	if err != nil {
+		colors.PrintWarning("Authenticated user could not be loaded: %v", err)
+		c.JSON(http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Error:   "Unauthorized",
+			Message: "User not found",
+		})
+		return
+	}
 
 	// Generate new token
 	if err := user.GenerateToken(); err != nil {
@@ -549,11 +714,264 @@ func (ac *AuthController) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	tokens, err := ac.startSession(c, user)
+	if err != nil {
+		colors.PrintError("Failed to start session for user %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Error:   "Failed to refresh token",
+			Message: "Please try again later",
+		})
+		return
+	}
+
 	colors.PrintInfo("Token refreshed for user %s", user.Email)
 	c.JSON(http.StatusOK, AuthResponse{
-		Success: true,
-		Message: "Token refreshed successfully",
-		Token:   user.Token,
-		User:    user.ToSafeUser(),
+		Success:      true,
+		Message:      "Token refreshed successfully",
+		Token:        user.Token,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         user.ToSafeUser(),
+	})
+}
+
+// refreshSession rotates a refresh token and signs a new access token for the same session
+func (ac *AuthController) refreshSession(c *gin.Context, refreshToken string) {
+	authConfig := config.GetAuthConfig()
+	if !authConfig.IsJWTEnabled() {
+		c.JSON(http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Error:   "Refresh tokens are not enabled",
+			Message: "Use the legacy token refresh with an Authorization header",
+		})
+		return
+	}
+
+	session, newRefreshToken, err := ac.sessionService.Refresh(refreshToken)
+	if err != nil {
+		if err == services.ErrSessionNotFound || err == services.ErrSessionInactive {
+			colors.PrintWarning("Token refresh rejected: %v", err)
+			c.JSON(http.StatusUnauthorized, AuthResponse{
+				Success: false,
+				Error:   "Invalid refresh token",
+				Message: "Your session has ended. Please log in again.",
+			})
+			return
+		}
+		colors.PrintError("Failed to refresh session: %v", err)
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Error:   "Failed to refresh token",
+			Message: "Please try again later",
+		})
+		return
+	}
+
+	var user models.User
+	if err := db.GetDB().First(&user, session.UserID).Error; err != nil || !user.IsActive {
+		colors.PrintWarning("Token refresh rejected: user %d not found or inactive", session.UserID)
+		c.JSON(http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Error:   "Account not active",
+			Message: "Your account is not active. Please contact an administrator.",
+		})
+		return
+	}
+
+	accessToken, err := middleware.IssueAccessToken(&user, session.SessionID)
+	if err != nil {
+		colors.PrintError("Failed to sign access token for user %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Error:   "Failed to refresh token",
+			Message: "Please try again later",
+		})
+		return
+	}
+
+	colors.PrintInfo("Session %s refreshed for user %s", session.SessionID, user.Email)
+	c.JSON(http.StatusOK, AuthResponse{
+		Success:      true,
+		Message:      "Token refreshed successfully",
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    int64(authConfig.AccessTokenTTL.Seconds()),
+		User:         user.ToSafeUser(),
+	})
+}
+
+// LogoutSession revokes a single session. Users can revoke their own sessions;
+// admins can revoke any session by ID.
+func (ac *AuthController) LogoutSession(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+		})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var req LogoutSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var session *models.AuthSession
+	var err error
+	switch {
+	case req.SessionID != "":
+		session, err = ac.sessionService.GetSession(req.SessionID)
+	case req.RefreshToken != "":
+		session, err = ac.sessionService.GetSessionByRefreshToken(req.RefreshToken)
+	case c.GetString("session_id") != "":
+		session, err = ac.sessionService.GetSession(c.GetString("session_id"))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Session not specified",
+			"message": "Provide session_id or refresh_token, or authenticate with a session access token",
+		})
+		return
+	}
+
+	// Other users' sessions are reported as missing rather than forbidden
+	if err == nil && session.UserID != user.ID && user.Role != models.UserRoleAdmin {
+		err = services.ErrSessionNotFound
+	}
+	if err != nil {
+		if err == services.ErrSessionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Session not found",
+			})
+			return
+		}
+		colors.PrintError("Failed to load session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load session",
+		})
+		return
+	}
+
+	if err := ac.sessionService.RevokeSession(session); err != nil {
+		colors.PrintError("Failed to revoke session %s: %v", session.SessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to revoke session",
+			"message": "Please try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Session revoked successfully",
+		"data":    session,
+	})
+}
+
+// GetSessions lists active login sessions for the current user.
+// Admins can pass ?user_id= to list another user's sessions.
+func (ac *AuthController) GetSessions(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+		})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	userID := user.ID
+	if userIDParam := c.Query("user_id"); userIDParam != "" {
+		if user.Role != models.UserRoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error":   "Forbidden",
+				"message": "Admin access required to list other users' sessions",
+			})
+			return
+		}
+		parsedID, err := strconv.ParseUint(userIDParam, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid user_id",
+			})
+			return
+		}
+		userID = uint(parsedID)
+	}
+
+	sessions, err := ac.sessionService.ListUserSessions(userID)
+	if err != nil {
+		colors.PrintError("Failed to list sessions for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to list sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"sessions":           sessions,
+			"current_session_id": c.GetString("session_id"),
+		},
+	})
+}
+
+// UpdateLanguage sets the current user's notification language (en or ne)
+func (ac *AuthController) UpdateLanguage(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Unauthorized",
+			"message": "User not authenticated",
+		})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var req UpdateLanguageRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !models.IsValidLanguage(req.Language) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid language",
+			"message": "Language must be 'en' or 'ne'",
+		})
+		return
+	}
+
+	if err := db.GetDB().Model(&models.User{}).Where("id = ?", user.ID).Update("language", req.Language).Error; err != nil {
+		colors.PrintError("Failed to update language for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update language",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"language": req.Language,
+		},
+		"message": "Language updated successfully",
 	})
 }
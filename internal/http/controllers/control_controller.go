@@ -1,14 +1,20 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"luna_iot_server/config"
 	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/http/middleware"
 	"luna_iot_server/internal/models"
 	"luna_iot_server/internal/protocol"
+	"luna_iot_server/internal/services"
 	"luna_iot_server/pkg/colors"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,33 +23,199 @@ import (
 // ControlController handles oil and electricity control operations
 type ControlController struct {
 	activeConnections map[string]net.Conn // Maps IMEI to active TCP connections
+	// When each registered device connected
+	connectedAt map[string]time.Time
+	// Numbers commands sent on each registered connection and matches the device's replies
+	commandBuilders map[string]*protocol.CommandBuilder
+	// Guards activeConnections, connectedAt and commandBuilders; TCP goroutines register devices while HTTP handlers read
+	connectionsMutex sync.RWMutex
+	// Sends commands to devices without a TCP connection; nil when the SMS fallback is off
+	smsSender services.SMSCommandSender
+	// Last oil/electricity command per IMEI, so repeated or conflicting commands within the cooldown are rejected
+	lastOilCommands map[string]sentCommand
+	commandCooldown time.Duration
+	commandsMutex   sync.Mutex
 }
 
+// sentCommand is a command sent to a device and when
+type sentCommand struct {
+	command string
+	sentAt  time.Time
+}
+
+// CommandCooldownError rejects an oil/electricity command sent too soon after the previous one
+type CommandCooldownError struct {
+	Previous    string        // The command already sent
+	Conflicting bool          // The new command would undo the previous one
+	RetryAfter  time.Duration // Time left in the cooldown
+}
+
+func (e *CommandCooldownError) Error() string {
+	if e.Conflicting {
+		return fmt.Sprintf("conflicting command %s was just sent; wait %ds before reversing it", e.Previous, e.RetryAfterSeconds())
+	}
+	return fmt.Sprintf("command %s was just sent; wait %ds before sending it again", e.Previous, e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds is the time left in the cooldown, rounded up to whole seconds
+func (e *CommandCooldownError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// ErrSMSFallbackUnavailable is returned when a command cannot be sent by SMS
+var ErrSMSFallbackUnavailable = errors.New("SMS command fallback is not available")
+
 // NewControlController creates a new control controller instance
 func NewControlController() *ControlController {
 	return &ControlController{
 		activeConnections: make(map[string]net.Conn),
+		connectedAt:       make(map[string]time.Time),
+		commandBuilders:   make(map[string]*protocol.CommandBuilder),
+		smsSender:         services.GetSMSCommandSender(),
+		lastOilCommands:   make(map[string]sentCommand),
+		commandCooldown:   config.GetControlCommandCooldown(),
+	}
+}
+
+// SetCommandCooldown sets the minimum time between oil/electricity commands to one device; 0 disables it
+func (cc *ControlController) SetCommandCooldown(cooldown time.Duration) {
+	cc.commandsMutex.Lock()
+	defer cc.commandsMutex.Unlock()
+	cc.commandCooldown = cooldown
+}
+
+// ReserveOilCommand claims the device for an oil/electricity command. It returns an error
+// when an oil command was sent to the device within the cooldown: the same command again
+// is a repeated tap, and the opposite command would flip the relay before the first took
+// effect. Other commands are not limited.
+func (cc *ControlController) ReserveOilCommand(imei, command string) *CommandCooldownError {
+	if command != protocol.CmdCutOil && command != protocol.CmdConnectOil {
+		return nil
+	}
+
+	cc.commandsMutex.Lock()
+	defer cc.commandsMutex.Unlock()
+
+	now := time.Now()
+	if previous, exists := cc.lastOilCommands[imei]; exists {
+		if elapsed := now.Sub(previous.sentAt); elapsed < cc.commandCooldown {
+			return &CommandCooldownError{
+				Previous:    previous.command,
+				Conflicting: previous.command != command,
+				RetryAfter:  cc.commandCooldown - elapsed,
+			}
+		}
+	}
+
+	cc.lastOilCommands[imei] = sentCommand{command: command, sentAt: now}
+	return nil
+}
+
+// releaseOilCommand ends the cooldown started by ReserveOilCommand when the command could not be sent at all
+func (cc *ControlController) releaseOilCommand(imei, command string) {
+	cc.commandsMutex.Lock()
+	defer cc.commandsMutex.Unlock()
+	if previous, exists := cc.lastOilCommands[imei]; exists && previous.command == command {
+		delete(cc.lastOilCommands, imei)
+	}
+}
+
+// rejectDuringCooldown answers 429 when an oil/electricity command for the device is still cooling down
+func rejectDuringCooldown(c *gin.Context, cooldownErr *CommandCooldownError) {
+	c.Header("Retry-After", strconv.Itoa(cooldownErr.RetryAfterSeconds()))
+	message := "The same command was just sent to this device. Please wait for it to take effect."
+	if cooldownErr.Conflicting {
+		message = "The opposite command was just sent to this device. Please wait before reversing it."
 	}
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"success":             false,
+		"error":               message,
+		"previous_command":    cooldownErr.Previous,
+		"conflicting":         cooldownErr.Conflicting,
+		"retry_after_seconds": cooldownErr.RetryAfterSeconds(),
+	})
+}
+
+// SetSMSCommandSender replaces the sender used for devices without a TCP connection; nil disables the fallback
+func (cc *ControlController) SetSMSCommandSender(sender services.SMSCommandSender) {
+	cc.smsSender = sender
 }
 
 // RegisterConnection registers an active TCP connection for a device
 func (cc *ControlController) RegisterConnection(imei string, conn net.Conn) {
+	cc.connectionsMutex.Lock()
 	cc.activeConnections[imei] = conn
+	cc.connectedAt[imei] = time.Now()
+	cc.commandBuilders[imei] = protocol.NewCommandBuilder()
+	cc.connectionsMutex.Unlock()
 	colors.PrintConnection("🔗", "Registered connection for device %s", imei)
-
 }
 
 // UnregisterConnection removes a TCP connection for a device
 func (cc *ControlController) UnregisterConnection(imei string) {
-	delete(cc.activeConnections, imei)
+	cc.connectionsMutex.Lock()
+	cc.removeConnection(imei)
+	cc.connectionsMutex.Unlock()
 	colors.PrintConnection("🔌", "Unregistered connection for device %s", imei)
 }
 
+// UnregisterConnectionIfCurrent removes the device's connection only when it is still conn,
+// so a closing connection does not remove the one the device reconnected on.
+// It returns whether the connection was removed.
+func (cc *ControlController) UnregisterConnectionIfCurrent(imei string, conn net.Conn) bool {
+	cc.connectionsMutex.Lock()
+	current, exists := cc.activeConnections[imei]
+	removed := exists && current == conn
+	if removed {
+		cc.removeConnection(imei)
+	}
+	cc.connectionsMutex.Unlock()
+
+	if removed {
+		colors.PrintConnection("🔌", "Unregistered connection for device %s", imei)
+	}
+	return removed
+}
+
+// removeConnection forgets the device's connection state; the caller holds connectionsMutex
+func (cc *ControlController) removeConnection(imei string) {
+	delete(cc.activeConnections, imei)
+	delete(cc.connectedAt, imei)
+	delete(cc.commandBuilders, imei)
+}
+
+// trackerController creates a controller that sends commands on the device's connection
+func (cc *ControlController) trackerController(conn net.Conn, imei string) *protocol.GPSTrackerController {
+	cc.connectionsMutex.RLock()
+	builder, exists := cc.commandBuilders[imei]
+	cc.connectionsMutex.RUnlock()
+	if !exists {
+		// The device disconnected since its connection was looked up; the command will time out
+		builder = protocol.NewCommandBuilder()
+	}
+	return protocol.NewGPSTrackerController(conn, imei, builder)
+}
+
+// DeliverCommandReply passes a command reply read from the device's connection to the
+// command waiting for it. It returns false when no pending command matches.
+func (cc *ControlController) DeliverCommandReply(imei string, packet *protocol.DecodedPacket) bool {
+	cc.connectionsMutex.RLock()
+	builder, exists := cc.commandBuilders[imei]
+	cc.connectionsMutex.RUnlock()
+	if !exists {
+		return false
+	}
+	_, matched := builder.MatchReply(packet)
+	return matched
+}
+
 // GetActiveConnection retrieves the active TCP connection for a device
 func (cc *ControlController) GetActiveConnection(imei string) (net.Conn, bool) {
 	colors.PrintDebug("Looking for active connection for IMEI: %s", imei)
-	colors.PrintDebug("Currently registered IMEIs: %v", cc.getRegisteredIMEIs())
+	colors.PrintDebug("Currently registered IMEIs: %v", cc.ConnectedIMEIs())
+	cc.connectionsMutex.RLock()
 	conn, exists := cc.activeConnections[imei]
+	cc.connectionsMutex.RUnlock()
 	if exists {
 		colors.PrintDebug("Found active connection for IMEI: %s", imei)
 	} else {
@@ -52,15 +224,141 @@ func (cc *ControlController) GetActiveConnection(imei string) (net.Conn, bool) {
 	return conn, exists
 }
 
-// getRegisteredIMEIs returns a list of currently registered IMEIs for debugging
-func (cc *ControlController) getRegisteredIMEIs() []string {
-	var imeis []string
+// IsConnected reports whether a device currently has a registered TCP connection
+func (cc *ControlController) IsConnected(imei string) bool {
+	cc.connectionsMutex.RLock()
+	defer cc.connectionsMutex.RUnlock()
+	_, exists := cc.activeConnections[imei]
+	return exists
+}
+
+// ConnectedSince returns when the device's current TCP connection was registered
+func (cc *ControlController) ConnectedSince(imei string) (time.Time, bool) {
+	cc.connectionsMutex.RLock()
+	defer cc.connectionsMutex.RUnlock()
+	connectedAt, exists := cc.connectedAt[imei]
+	return connectedAt, exists
+}
+
+// ConnectedIMEIs returns a snapshot of the IMEIs with a registered TCP connection
+func (cc *ControlController) ConnectedIMEIs() []string {
+	cc.connectionsMutex.RLock()
+	defer cc.connectionsMutex.RUnlock()
+
+	imeis := make([]string, 0, len(cc.activeConnections))
 	for imei := range cc.activeConnections {
 		imeis = append(imeis, imei)
 	}
 	return imeis
 }
 
+// SendCommandBySMS sends the command to the SIM of a device that has no TCP connection.
+// The device replies by SMS to the gateway, so the response only confirms the text was sent.
+func (cc *ControlController) SendCommandBySMS(device *models.Device, command string) (*protocol.ControlResponse, error) {
+	if cc.smsSender == nil || device.SimNo == "" {
+		return nil, ErrSMSFallbackUnavailable
+	}
+
+	if err := cc.smsSender.SendCommand(device.SimNo, command); err != nil {
+		return nil, err
+	}
+
+	return &protocol.ControlResponse{
+		Command:    command,
+		Success:    true,
+		Message:    fmt.Sprintf("Device is not connected; command sent by SMS to %s", device.SimNo),
+		Timestamp:  time.Now(),
+		DeviceIMEI: device.IMEI,
+	}, nil
+}
+
+// respondNotConnected answers a command for a device without a TCP connection, sending it
+// by SMS when the fallback is available
+func (cc *ControlController) respondNotConnected(c *gin.Context, device *models.Device, command string) {
+	controlResponse, err := cc.SendCommandBySMS(device, command)
+	if err != nil {
+		cc.releaseOilCommand(device.IMEI, command)
+	}
+	if errors.Is(err, ErrSMSFallbackUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, ControlResponse{
+			Success:    false,
+			Error:      "Device not connected",
+			Message:    fmt.Sprintf("Device %s is not currently connected to the server", device.IMEI),
+			DeviceInfo: device,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ControlResponse{
+			Success:    false,
+			Error:      "SMS command failed",
+			Message:    fmt.Sprintf("Device %s is not connected and the SMS could not be sent: %v", device.IMEI, err),
+			DeviceInfo: device,
+		})
+		return
+	}
+
+	middleware.RequestLogger(c).PrintControl("Command %s sent by SMS to offline device %s", command, device.IMEI)
+	recordControlCommand(c, device.IMEI, command, "sms")
+	c.JSON(http.StatusAccepted, ControlResponse{
+		Success:    true,
+		Message:    controlResponse.Message,
+		DeviceInfo: device,
+		Response:   controlResponse,
+		Channel:    "sms",
+	})
+}
+
+// CommandAvailability tells a client whether a control command can reach a device right now
+type CommandAvailability struct {
+	IMEI           string     `json:"imei"`
+	TCPConnected   bool       `json:"tcp_connected"`
+	ConnectedSince *time.Time `json:"connected_since"`
+	LastSeen       *time.Time `json:"last_seen"`
+	SMSFallback    bool       `json:"sms_fallback"` // SMS fallback is configured and the device has a SIM number
+	CanSendCommand bool       `json:"can_send_command"`
+	Channel        string     `json:"channel,omitempty"` // "tcp" or "sms": how a command would be sent
+}
+
+// GetCommandAvailability reports how a command for the device would be sent, from the
+// connection registry and the SMS fallback. lastSeen is the device's newest data, if any.
+func (cc *ControlController) GetCommandAvailability(device *models.Device, lastSeen *time.Time) CommandAvailability {
+	availability := CommandAvailability{
+		IMEI:        device.IMEI,
+		LastSeen:    lastSeen,
+		SMSFallback: cc.smsSender != nil && device.SimNo != "",
+	}
+
+	if connectedAt, connected := cc.ConnectedSince(device.IMEI); connected {
+		availability.TCPConnected = true
+		availability.ConnectedSince = &connectedAt
+	}
+
+	switch {
+	case availability.TCPConnected:
+		availability.Channel = "tcp"
+	case availability.SMSFallback:
+		availability.Channel = "sms"
+	}
+	availability.CanSendCommand = availability.Channel != ""
+	return availability
+}
+
+// recordControlCommand stores a sent oil/electricity command for the requesting user, so the
+// device's next status packet can confirm it took effect. Other commands are not recorded.
+func recordControlCommand(c *gin.Context, imei, command, channel string) {
+	var requestedBy *uint
+	if currentUser, exists := c.Get("user"); exists {
+		if user, ok := currentUser.(*models.User); ok {
+			requestedBy = &user.ID
+		}
+	}
+
+	if _, err := services.RecordControlCommand(imei, command, channel, requestedBy); err != nil {
+		middleware.RequestLogger(c).PrintError("Failed to record command %s for device %s: %v", command, imei, err)
+	}
+}
+
 // ControlRequest represents the request body for control operations
 type ControlRequest struct {
 	DeviceID *uint  `json:"device_id,omitempty"`
@@ -74,6 +372,7 @@ type ControlResponse struct {
 	DeviceInfo *models.Device            `json:"device_info,omitempty"`
 	Response   *protocol.ControlResponse `json:"control_response,omitempty"`
 	Error      string                    `json:"error,omitempty"`
+	Channel    string                    `json:"channel,omitempty"` // "sms" when sent by the SMS fallback
 }
 
 // validateControlRequest validates and processes the control request
@@ -133,20 +432,23 @@ func (cc *ControlController) CutOilAndElectricity(c *gin.Context) {
 		return
 	}
 
+	defer recordAudit(c, models.AuditActionOilCut, "device", device.IMEI)
+
+	// Reject repeated or conflicting oil commands within the cooldown
+	if cooldownErr := cc.ReserveOilCommand(device.IMEI, protocol.CmdCutOil); cooldownErr != nil {
+		rejectDuringCooldown(c, cooldownErr)
+		return
+	}
+
 	// Check if device has an active connection
 	conn, exists := cc.GetActiveConnection(device.IMEI)
 	if !exists {
-		c.JSON(http.StatusServiceUnavailable, ControlResponse{
-			Success:    false,
-			Error:      "Device not connected",
-			Message:    fmt.Sprintf("Device %s is not currently connected to the server", device.IMEI),
-			DeviceInfo: device,
-		})
+		cc.respondNotConnected(c, device, protocol.CmdCutOil)
 		return
 	}
 
 	// Create GPS tracker controller
-	controller := protocol.NewGPSTrackerController(conn, device.IMEI)
+	controller := cc.trackerController(conn, device.IMEI)
 
 	// Send cut oil command
 	controlResponse, err := controller.CutOilAndElectricity()
@@ -160,10 +462,13 @@ func (cc *ControlController) CutOilAndElectricity(c *gin.Context) {
 		return
 	}
 
-	// Save control action to database (optional - you can create a control_logs table)
-	colors.PrintControl("Oil cut command sent to device %s - Success: %v, Message: %s",
+	middleware.RequestLogger(c).PrintControl("Oil cut command sent to device %s - Success: %v, Message: %s",
 		device.IMEI, controlResponse.Success, controlResponse.Message)
 
+	if controlResponse.Success {
+		recordControlCommand(c, device.IMEI, protocol.CmdCutOil, "tcp")
+	}
+
 	c.JSON(http.StatusOK, ControlResponse{
 		Success:    controlResponse.Success,
 		Message:    controlResponse.Message,
@@ -191,20 +496,23 @@ func (cc *ControlController) ConnectOilAndElectricity(c *gin.Context) {
 		return
 	}
 
+	defer recordAudit(c, models.AuditActionOilConnect, "device", device.IMEI)
+
+	// Reject repeated or conflicting oil commands within the cooldown
+	if cooldownErr := cc.ReserveOilCommand(device.IMEI, protocol.CmdConnectOil); cooldownErr != nil {
+		rejectDuringCooldown(c, cooldownErr)
+		return
+	}
+
 	// Check if device has an active connection
 	conn, exists := cc.GetActiveConnection(device.IMEI)
 	if !exists {
-		c.JSON(http.StatusServiceUnavailable, ControlResponse{
-			Success:    false,
-			Error:      "Device not connected",
-			Message:    fmt.Sprintf("Device %s is not currently connected to the server", device.IMEI),
-			DeviceInfo: device,
-		})
+		cc.respondNotConnected(c, device, protocol.CmdConnectOil)
 		return
 	}
 
 	// Create GPS tracker controller
-	controller := protocol.NewGPSTrackerController(conn, device.IMEI)
+	controller := cc.trackerController(conn, device.IMEI)
 
 	// Send connect oil command
 	controlResponse, err := controller.ConnectOilAndElectricity()
@@ -218,10 +526,13 @@ func (cc *ControlController) ConnectOilAndElectricity(c *gin.Context) {
 		return
 	}
 
-	// Save control action to database (optional)
-	colors.PrintControl("Oil connect command sent to device %s - Success: %v, Message: %s",
+	middleware.RequestLogger(c).PrintControl("Oil connect command sent to device %s - Success: %v, Message: %s",
 		device.IMEI, controlResponse.Success, controlResponse.Message)
 
+	if controlResponse.Success {
+		recordControlCommand(c, device.IMEI, protocol.CmdConnectOil, "tcp")
+	}
+
 	c.JSON(http.StatusOK, ControlResponse{
 		Success:    controlResponse.Success,
 		Message:    controlResponse.Message,
@@ -252,17 +563,12 @@ func (cc *ControlController) GetLocation(c *gin.Context) {
 	// Check if device has an active connection
 	conn, exists := cc.GetActiveConnection(device.IMEI)
 	if !exists {
-		c.JSON(http.StatusServiceUnavailable, ControlResponse{
-			Success:    false,
-			Error:      "Device not connected",
-			Message:    fmt.Sprintf("Device %s is not currently connected to the server", device.IMEI),
-			DeviceInfo: device,
-		})
+		cc.respondNotConnected(c, device, protocol.CmdLocation)
 		return
 	}
 
 	// Create GPS tracker controller
-	controller := protocol.NewGPSTrackerController(conn, device.IMEI)
+	controller := cc.trackerController(conn, device.IMEI)
 
 	// Send get location command
 	controlResponse, err := controller.GetLocation()
@@ -277,7 +583,7 @@ func (cc *ControlController) GetLocation(c *gin.Context) {
 	}
 
 	// Save control action to database (optional)
-	colors.PrintControl("Location request sent to device %s - Success: %v, Response: %s",
+	middleware.RequestLogger(c).PrintControl("Location request sent to device %s - Success: %v, Response: %s",
 		device.IMEI, controlResponse.Success, controlResponse.Response)
 
 	c.JSON(http.StatusOK, ControlResponse{
@@ -298,7 +604,13 @@ func (cc *ControlController) GetLocation(c *gin.Context) {
 func (cc *ControlController) GetActiveDevices(c *gin.Context) {
 	activeDevices := make([]map[string]interface{}, 0)
 
-	for imei := range cc.activeConnections {
+	// Iterate over a snapshot so the lock is not held during the device lookups
+	for _, imei := range cc.ConnectedIMEIs() {
+		connectedAt, connected := cc.ConnectedSince(imei)
+		if !connected {
+			continue // Disconnected since the snapshot
+		}
+
 		var device models.Device
 		err := db.GetDB().Where("imei = ?", imei).First(&device).Error
 		if err == nil {
@@ -308,7 +620,7 @@ func (cc *ControlController) GetActiveDevices(c *gin.Context) {
 				"sim_no":       device.SimNo,
 				"sim_operator": device.SimOperator,
 				"protocol":     device.Protocol,
-				"connected_at": time.Now(),
+				"connected_at": connectedAt,
 			})
 		}
 	}
@@ -371,19 +683,22 @@ func (cc *ControlController) QuickCutOil(c *gin.Context) {
 		return
 	}
 
+	defer recordAudit(c, models.AuditActionOilCut, "device", device.IMEI)
+
+	// Reject repeated or conflicting oil commands within the cooldown
+	if cooldownErr := cc.ReserveOilCommand(device.IMEI, protocol.CmdCutOil); cooldownErr != nil {
+		rejectDuringCooldown(c, cooldownErr)
+		return
+	}
+
 	// Check connection and send command
 	conn, exists := cc.GetActiveConnection(device.IMEI)
 	if !exists {
-		c.JSON(http.StatusServiceUnavailable, ControlResponse{
-			Success:    false,
-			Error:      "Device not connected",
-			Message:    fmt.Sprintf("Device %s is not currently connected", device.IMEI),
-			DeviceInfo: &device,
-		})
+		cc.respondNotConnected(c, &device, protocol.CmdCutOil)
 		return
 	}
 
-	controller := protocol.NewGPSTrackerController(conn, device.IMEI)
+	controller := cc.trackerController(conn, device.IMEI)
 	controlResponse, err := controller.CutOilAndElectricity()
 
 	if err != nil {
@@ -396,6 +711,10 @@ func (cc *ControlController) QuickCutOil(c *gin.Context) {
 		return
 	}
 
+	if controlResponse.Success {
+		recordControlCommand(c, device.IMEI, protocol.CmdCutOil, "tcp")
+	}
+
 	c.JSON(http.StatusOK, ControlResponse{
 		Success:    controlResponse.Success,
 		Message:    controlResponse.Message,
@@ -454,19 +773,22 @@ func (cc *ControlController) QuickConnectOil(c *gin.Context) {
 		return
 	}
 
+	defer recordAudit(c, models.AuditActionOilConnect, "device", device.IMEI)
+
+	// Reject repeated or conflicting oil commands within the cooldown
+	if cooldownErr := cc.ReserveOilCommand(device.IMEI, protocol.CmdConnectOil); cooldownErr != nil {
+		rejectDuringCooldown(c, cooldownErr)
+		return
+	}
+
 	// Check connection and send command
 	conn, exists := cc.GetActiveConnection(device.IMEI)
 	if !exists {
-		c.JSON(http.StatusServiceUnavailable, ControlResponse{
-			Success:    false,
-			Error:      "Device not connected",
-			Message:    fmt.Sprintf("Device %s is not currently connected", device.IMEI),
-			DeviceInfo: &device,
-		})
+		cc.respondNotConnected(c, &device, protocol.CmdConnectOil)
 		return
 	}
 
-	controller := protocol.NewGPSTrackerController(conn, device.IMEI)
+	controller := cc.trackerController(conn, device.IMEI)
 	controlResponse, err := controller.ConnectOilAndElectricity()
 
 	if err != nil {
@@ -479,6 +801,10 @@ func (cc *ControlController) QuickConnectOil(c *gin.Context) {
 		return
 	}
 
+	if controlResponse.Success {
+		recordControlCommand(c, device.IMEI, protocol.CmdConnectOil, "tcp")
+	}
+
 	c.JSON(http.StatusOK, ControlResponse{
 		Success:    controlResponse.Success,
 		Message:    controlResponse.Message,
@@ -6,9 +6,10 @@ import (
 	"net/http"
 	"time"
 
+	"luna_iot_server/config"
 	"luna_iot_server/internal/db"
 	"luna_iot_server/internal/models"
-	"luna_iot_server/pkg/utils"
+	"luna_iot_server/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -64,10 +65,11 @@ func (dc *DashboardController) GetDashboardStats(c *gin.Context) {
 	}
 
 	if len(gpsDataToday) > 1 {
+		movingSpeedKmh := config.GetMovingSpeedKmh()
 		for i := 1; i < len(gpsDataToday); i++ {
-			prev, curr := gpsDataToday[i-1], gpsDataToday[i]
-			if prev.IMEI == curr.IMEI && prev.IsValidLocation() && curr.IsValidLocation() {
-				totalKMToday += utils.CalculateDistance(*prev.Latitude, *prev.Longitude, *curr.Latitude, *curr.Longitude)
+			prev, curr := &gpsDataToday[i-1], &gpsDataToday[i]
+			if prev.IMEI == curr.IMEI {
+				totalKMToday += services.SegmentDistanceKm(prev, curr, movingSpeedKmh)
 			}
 		}
 	}
@@ -180,6 +180,43 @@ func (dc *DeviceController) GetDeviceByIMEI(c *gin.Context) {
 	dc.createSuccessResponse(c, http.StatusOK, "Device retrieved successfully", device, 0)
 }
 
+// GetDeviceBySIM returns a device by the phone number of the SIM installed in it
+func (dc *DeviceController) GetDeviceBySIM(c *gin.Context) {
+	simNo := models.NormalizeSimNumber(c.Param("sim_no"))
+	if !models.IsValidSimNumber(simNo) {
+		dc.createErrorResponse(c, http.StatusBadRequest, "INVALID_SIM_NUMBER",
+			"SIM number must be 7 to 15 digits with an optional leading +",
+			map[string]string{
+				"provided_sim_no": c.Param("sim_no"),
+				"expected_format": "7 to 15 digits with an optional leading + (e.g., 9801234567)",
+				"suggestion":      "Please provide the phone number of the SIM installed in the device",
+			})
+		return
+	}
+
+	var device models.Device
+	if err := db.GetDB().Preload("Model").Where("sim_no = ?", simNo).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			dc.createErrorResponse(c, http.StatusNotFound, "DEVICE_NOT_FOUND",
+				"No device found with the specified SIM number",
+				map[string]string{
+					"sim_no":     simNo,
+					"suggestion": "Please verify the SIM number and ensure it is recorded on the device",
+				})
+		} else {
+			dc.createErrorResponse(c, http.StatusInternalServerError, "DATABASE_ERROR",
+				"Failed to retrieve device from database",
+				map[string]string{
+					"database_error": err.Error(),
+					"sim_no":         simNo,
+				})
+		}
+		return
+	}
+
+	dc.createSuccessResponse(c, http.StatusOK, "Device retrieved successfully", device, 0)
+}
+
 // CreateDevice creates a new device
 func (dc *DeviceController) CreateDevice(c *gin.Context) {
 	var device models.Device
@@ -244,6 +281,31 @@ func (dc *DeviceController) CreateDevice(c *gin.Context) {
 		return
 	}
 
+	device.SimNo = models.NormalizeSimNumber(device.SimNo)
+	if !models.IsValidSimNumber(device.SimNo) {
+		colors.PrintWarning("⚠️ Invalid SIM number: %s", device.SimNo)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":         false,
+			"error":           "Invalid SIM number",
+			"provided":        device.SimNo,
+			"expected_format": "7 to 15 digits with an optional leading + (e.g., 9801234567)",
+		})
+		return
+	}
+
+	// Validate ICCID if provided
+	device.ICCID = models.NormalizeICCID(device.ICCID)
+	if !models.IsValidICCID(device.ICCID) {
+		colors.PrintWarning("⚠️ Invalid ICCID: %s", device.ICCID)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":         false,
+			"error":           "Invalid ICCID",
+			"provided":        device.ICCID,
+			"expected_format": "18 to 20 digits starting with 89",
+		})
+		return
+	}
+
 	// Check if device with this IMEI already exists
 	var existingDevice models.Device
 	if err := db.GetDB().Where("imei = ?", device.IMEI).First(&existingDevice).Error; err == nil {
@@ -276,6 +338,23 @@ func (dc *DeviceController) CreateDevice(c *gin.Context) {
 		return
 	}
 
+	// Check if ICCID already exists
+	if device.ICCID != "" {
+		var existingICCID models.Device
+		if err := db.GetDB().Where("iccid = ?", device.ICCID).First(&existingICCID).Error; err == nil {
+			colors.PrintWarning("⚠️ Device with ICCID %s already exists (IMEI: %s)", device.ICCID, existingICCID.IMEI)
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   "Device with this ICCID already exists",
+				"existing_device": gin.H{
+					"imei":  existingICCID.IMEI,
+					"iccid": existingICCID.ICCID,
+				},
+			})
+			return
+		}
+	}
+
 	// Validate SIM operator
 	if device.SimOperator != models.SimOperatorNcell && device.SimOperator != models.SimOperatorNtc {
 		colors.PrintWarning("⚠️ Invalid SIM operator: %s", device.SimOperator)
@@ -437,6 +516,59 @@ func (dc *DeviceController) UpdateDevice(c *gin.Context) {
 		}
 	*/
 
+	// Validate the SIM number and ICCID if they are being changed
+	if updateData.SimNo != "" {
+		updateData.SimNo = models.NormalizeSimNumber(updateData.SimNo)
+		if !models.IsValidSimNumber(updateData.SimNo) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":         false,
+				"error":           "Invalid SIM number",
+				"provided":        updateData.SimNo,
+				"expected_format": "7 to 15 digits with an optional leading + (e.g., 9801234567)",
+			})
+			return
+		}
+
+		var existingSim models.Device
+		if err := db.GetDB().Where("sim_no = ? AND id != ?", updateData.SimNo, device.ID).First(&existingSim).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   "Device with this SIM number already exists",
+				"existing_device": gin.H{
+					"imei":   existingSim.IMEI,
+					"sim_no": existingSim.SimNo,
+				},
+			})
+			return
+		}
+	}
+
+	if updateData.ICCID != "" {
+		updateData.ICCID = models.NormalizeICCID(updateData.ICCID)
+		if !models.IsValidICCID(updateData.ICCID) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":         false,
+				"error":           "Invalid ICCID",
+				"provided":        updateData.ICCID,
+				"expected_format": "18 to 20 digits starting with 89",
+			})
+			return
+		}
+
+		var existingICCID models.Device
+		if err := db.GetDB().Where("iccid = ? AND id != ?", updateData.ICCID, device.ID).First(&existingICCID).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   "Device with this ICCID already exists",
+				"existing_device": gin.H{
+					"imei":  existingICCID.IMEI,
+					"iccid": existingICCID.ICCID,
+				},
+			})
+			return
+		}
+	}
+
 	if err := db.GetDB().Model(&device).Updates(updateData).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -454,6 +586,8 @@ func (dc *DeviceController) UpdateDevice(c *gin.Context) {
 
 // DeleteDevice deletes a device
 func (dc *DeviceController) DeleteDevice(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionDeviceDelete, "device", c.Param("id"))
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
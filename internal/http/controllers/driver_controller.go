@@ -0,0 +1,463 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DriverController handles a user's drivers and their vehicle assignments
+type DriverController struct{}
+
+// NewDriverController creates a new driver controller
+func NewDriverController() *DriverController {
+	return &DriverController{}
+}
+
+// DriverRequest is the body for creating or updating a driver
+type DriverRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Phone     string `json:"phone"`
+	LicenseNo string `json:"license_no"`
+	IsActive  *bool  `json:"is_active"`
+}
+
+// AssignDriverRequest is the body for assigning a driver to a vehicle
+type AssignDriverRequest struct {
+	DriverID  uint   `json:"driver_id" binding:"required"`
+	StartTime string `json:"start_time"` // RFC 3339, defaults to now
+}
+
+// GetMyDrivers returns the current user's drivers with their current vehicles
+func (dc *DriverController) GetMyDrivers(c *gin.Context) {
+	user, ok := dc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var drivers []models.Driver
+	if err := db.GetDB().Where("owner_id = ?", user.ID).Order("name ASC").Find(&drivers).Error; err != nil {
+		colors.PrintError("Failed to fetch drivers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch drivers",
+			"message": "Unable to retrieve drivers from database",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    drivers,
+		"count":   len(drivers),
+		"message": "Drivers retrieved successfully",
+	})
+}
+
+// CreateMyDriver creates a driver owned by the current user
+func (dc *DriverController) CreateMyDriver(c *gin.Context) {
+	user, ok := dc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req DriverRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"message": "Driver name is required",
+		})
+		return
+	}
+
+	driver := models.Driver{OwnerID: user.ID, IsActive: true}
+	applyDriverRequest(&driver, &req)
+
+	if err := db.GetDB().Create(&driver).Error; err != nil {
+		colors.PrintError("Failed to create driver: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to create driver",
+			"message": "Database error occurred while creating driver",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    driver,
+		"message": "Driver created successfully",
+	})
+}
+
+// UpdateMyDriver replaces the details of one of the current user's drivers
+func (dc *DriverController) UpdateMyDriver(c *gin.Context) {
+	driver, ok := dc.findMyDriver(c)
+	if !ok {
+		return
+	}
+
+	var req DriverRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"message": "Driver name is required",
+		})
+		return
+	}
+
+	applyDriverRequest(driver, &req)
+
+	if err := db.GetDB().Save(driver).Error; err != nil {
+		colors.PrintError("Failed to update driver: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update driver",
+			"message": "Database error occurred while updating driver",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    driver,
+		"message": "Driver updated successfully",
+	})
+}
+
+// DeleteMyDriver removes a driver. A driver with assignment history is deactivated
+// instead, and unassigned from any vehicle, so past trips keep their attribution.
+func (dc *DriverController) DeleteMyDriver(c *gin.Context) {
+	driver, ok := dc.findMyDriver(c)
+	if !ok {
+		return
+	}
+
+	var assignmentCount int64
+	db.GetDB().Model(&models.VehicleDriverAssignment{}).Where("driver_id = ?", driver.ID).Count(&assignmentCount)
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if assignmentCount == 0 {
+			return tx.Delete(driver).Error
+		}
+		if err := tx.Model(&models.VehicleDriverAssignment{}).
+			Where("driver_id = ? AND end_time IS NULL", driver.ID).
+			Update("end_time", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Model(driver).Update("is_active", false).Error
+	})
+	if err != nil {
+		colors.PrintError("Failed to delete driver: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to delete driver",
+			"message": "Database error occurred while deleting driver",
+		})
+		return
+	}
+
+	message := "Driver deleted successfully"
+	if assignmentCount > 0 {
+		message = "Driver deactivated; assignment history is kept for reports"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+	})
+}
+
+// GetMyDriverVehicles lists the vehicles a driver is assigned to.
+// ?include_ended=true also returns past assignments.
+func (dc *DriverController) GetMyDriverVehicles(c *gin.Context) {
+	driver, ok := dc.findMyDriver(c)
+	if !ok {
+		return
+	}
+
+	assignments, err := services.GetDriverAssignments(driver.ID, c.Query("include_ended") == "true")
+	if err != nil {
+		colors.PrintError("Failed to fetch driver assignments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch driver vehicles",
+			"message": "Unable to retrieve driver assignments from database",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    assignments,
+		"driver":  driver,
+		"count":   len(assignments),
+		"message": "Driver vehicles retrieved successfully",
+	})
+}
+
+// GetMyDriverSafety summarises a driver's harsh braking and acceleration over the time they
+// were assigned to vehicles between from and to (default the last 30 days), with the
+// distance they drove for a per-100 km rate
+func (dc *DriverController) GetMyDriverSafety(c *gin.Context) {
+	driver, ok := dc.findMyDriver(c)
+	if !ok {
+		return
+	}
+
+	fromTime, toTime := time.Now().AddDate(0, 0, -30), time.Now()
+	var err error
+	if from := c.Query("from"); from != "" {
+		if fromTime, err = config.ParseTimestamp(from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if toTime, err = config.ParseTimestamp(to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
+		}
+	}
+	if !withinHistoryRange(c, fromTime, toTime) {
+		return
+	}
+
+	summary, err := services.GetDriverSafetySummary(driver.ID, fromTime, toTime, config.GetMovingSpeedKmh())
+	if err != nil {
+		colors.PrintError("Failed to summarize driver safety: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to summarize driver safety",
+			"message": "Unable to retrieve driving events from database",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    summary,
+		"driver":  driver,
+		"message": "Driver safety summary retrieved successfully",
+	})
+}
+
+// AssignVehicleDriver makes one of the user's drivers the current driver of a vehicle.
+// Requires vehicle edit permission.
+func (dc *DriverController) AssignVehicleDriver(c *gin.Context) {
+	imei, ok := dc.requireVehicleEdit(c)
+	if !ok {
+		return
+	}
+	user, _ := dc.currentUser(c)
+
+	var req AssignDriverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"message": "driver_id is required",
+		})
+		return
+	}
+
+	start := time.Now()
+	if req.StartTime != "" {
+		parsed, err := config.ParseTimestamp(req.StartTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid start_time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
+		}
+		start = parsed
+	}
+
+	var driver models.Driver
+	if err := db.GetDB().Where("id = ? AND owner_id = ? AND is_active = ?", req.DriverID, user.ID, true).
+		First(&driver).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Driver not found",
+			"message": "No active driver with this ID belongs to you",
+		})
+		return
+	}
+
+	assignment, err := services.AssignDriver(imei, driver.ID, user.ID, start)
+	if err != nil {
+		if err == services.ErrAssignmentBeforeCurrent {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   "Invalid start_time",
+				"message": "start_time is before the current driver's assignment began",
+			})
+			return
+		}
+		colors.PrintError("Failed to assign driver %d to %s: %v", driver.ID, imei, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to assign driver",
+			"message": "Database error occurred while assigning driver",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    assignment,
+		"message": "Driver assigned successfully",
+	})
+}
+
+// UnassignVehicleDriver ends the vehicle's current driver assignment.
+// Requires vehicle edit permission.
+func (dc *DriverController) UnassignVehicleDriver(c *gin.Context) {
+	imei, ok := dc.requireVehicleEdit(c)
+	if !ok {
+		return
+	}
+
+	assignment, err := services.UnassignDriver(imei, time.Now())
+	if err != nil {
+		if err == services.ErrNoDriverAssigned {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "No driver assigned",
+				"message": "This vehicle has no current driver",
+			})
+			return
+		}
+		colors.PrintError("Failed to unassign driver from %s: %v", imei, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to unassign driver",
+			"message": "Database error occurred while unassigning driver",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    assignment,
+		"message": "Driver unassigned successfully",
+	})
+}
+
+// findMyDriver loads the current user's driver named by the :id parameter,
+// writing the error response if it fails
+func (dc *DriverController) findMyDriver(c *gin.Context) (*models.Driver, bool) {
+	user, ok := dc.currentUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid driver ID",
+			"message": "Driver ID must be a valid number",
+		})
+		return nil, false
+	}
+
+	var driver models.Driver
+	if err := db.GetDB().Where("id = ? AND owner_id = ?", uint(id), user.ID).First(&driver).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Driver not found",
+				"message": "No driver with this ID belongs to you",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Database error",
+				"message": "Failed to retrieve driver from database",
+			})
+		}
+		return nil, false
+	}
+
+	return &driver, true
+}
+
+// requireVehicleEdit checks that the current user may edit the vehicle named by :imei,
+// writing the error response if not
+func (dc *DriverController) requireVehicleEdit(c *gin.Context) (string, bool) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return "", false
+	}
+
+	user, ok := dc.currentUser(c)
+	if !ok {
+		return "", false
+	}
+
+	var userVehicle models.UserVehicle
+	if err := db.GetDB().Where("user_id = ? AND vehicle_id = ? AND is_active = ?", user.ID, imei, true).
+		First(&userVehicle).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not found or access denied",
+		})
+		return "", false
+	}
+
+	if userVehicle.IsExpired() || (!userVehicle.VehicleEdit && !userVehicle.AllAccess) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "You don't have permission to edit this vehicle",
+		})
+		return "", false
+	}
+
+	return imei, true
+}
+
+// currentUser returns the authenticated user, writing the error response if there is none
+func (dc *DriverController) currentUser(c *gin.Context) (*models.User, bool) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "User not authenticated",
+		})
+		return nil, false
+	}
+	return currentUser.(*models.User), true
+}
+
+// applyDriverRequest copies request fields onto the driver
+func applyDriverRequest(driver *models.Driver, req *DriverRequest) {
+	driver.Name = strings.TrimSpace(req.Name)
+	driver.Phone = strings.TrimSpace(req.Phone)
+	driver.LicenseNo = strings.TrimSpace(req.LicenseNo)
+	if req.IsActive != nil {
+		driver.IsActive = *req.IsActive
+	}
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GeoController handles geographic lookups such as reverse geocoding
+type GeoController struct {
+	addressResolver services.AddressResolver
+}
+
+// NewGeoController creates a new geo controller
+func NewGeoController() *GeoController {
+	return &GeoController{
+		addressResolver: services.GetAddressResolver(),
+	}
+}
+
+// ReverseGeocode returns a human-readable address for the given coordinates
+func (gc *GeoController) ReverseGeocode(c *gin.Context) {
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid or missing lat parameter",
+		})
+		return
+	}
+
+	lng, err := strconv.ParseFloat(c.Query("lng"), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid or missing lng parameter",
+		})
+		return
+	}
+
+	address, err := gc.addressResolver.ReverseGeocode(lat, lng)
+	if err == services.ErrGeocoderDisabled {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "Reverse geocoding is not configured on this server",
+		})
+		return
+	}
+	if err != nil {
+		colors.PrintError("Reverse geocoding failed for %.6f,%.6f: %v", lat, lng, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"error":   "Failed to resolve address",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"latitude":  lat,
+			"longitude": lng,
+			"address":   address,
+		},
+		"message": "Address resolved successfully",
+	})
+}
@@ -5,8 +5,10 @@ import (
 	"strconv"
 	"time"
 
+	"luna_iot_server/config"
 	"luna_iot_server/internal/db"
 	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
 	"luna_iot_server/pkg/colors"
 
 	"github.com/gin-gonic/gin"
@@ -23,7 +25,7 @@ func NewGPSController() *GPSController {
 // GetGPSData returns GPS data with optional filtering
 func (gc *GPSController) GetGPSData(c *gin.Context) {
 	var gpsData []models.GPSData
-	query := db.GetDB().Preload("Device").Preload("Vehicle")
+	query := db.GetReadDB().Preload("Device").Preload("Vehicle")
 
 	// Optional filters
 	if imei := c.Query("imei"); imei != "" {
@@ -31,15 +33,25 @@ func (gc *GPSController) GetGPSData(c *gin.Context) {
 	}
 
 	if from := c.Query("from"); from != "" {
-		if fromTime, err := time.Parse("2006-01-02T15:04:05Z", from); err == nil {
-			query = query.Where("timestamp >= ?", fromTime)
+		fromTime, err := config.ParseTimestamp(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
 		}
+		query = query.Where("timestamp >= ?", fromTime)
 	}
 
 	if to := c.Query("to"); to != "" {
-		if toTime, err := time.Parse("2006-01-02T15:04:05Z", to); err == nil {
-			query = query.Where("timestamp <= ?", toTime)
+		toTime, err := config.ParseTimestamp(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
 		}
+		query = query.Where("timestamp <= ?", toTime)
 	}
 
 	// Pagination
@@ -76,19 +88,29 @@ func (gc *GPSController) GetGPSDataByIMEI(c *gin.Context) {
 	}
 
 	var gpsData []models.GPSData
-	query := db.GetDB().Where("imei = ?", imei).Preload("Device").Preload("Vehicle")
+	query := db.GetReadDB().Where("imei = ?", imei).Preload("Device").Preload("Vehicle")
 
 	// Time range filtering
 	if from := c.Query("from"); from != "" {
-		if fromTime, err := time.Parse("2006-01-02T15:04:05Z", from); err == nil {
-			query = query.Where("timestamp >= ?", fromTime)
+		fromTime, err := config.ParseTimestamp(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
 		}
+		query = query.Where("timestamp >= ?", fromTime)
 	}
 
 	if to := c.Query("to"); to != "" {
-		if toTime, err := time.Parse("2006-01-02T15:04:05Z", to); err == nil {
-			query = query.Where("timestamp <= ?", toTime)
+		toTime, err := config.ParseTimestamp(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
 		}
+		query = query.Where("timestamp <= ?", toTime)
 	}
 
 	// Pagination
@@ -119,7 +141,7 @@ func (gc *GPSController) GetLatestGPSData(c *gin.Context) {
 	var gpsData []models.GPSData
 
 	// Get latest GPS data for each IMEI regardless of device connection
-	if err := db.GetDB().Raw(`
+	if err := db.GetReadDB().Raw(`
 		SELECT DISTINCT ON (imei) *
 		FROM gps_data
 		WHERE deleted_at IS NULL
@@ -167,7 +189,7 @@ func (gc *GPSController) GetLatestValidGPSDataByIMEI(c *gin.Context) {
 	// ENHANCED HISTORICAL FALLBACK STRATEGY
 	// Get all GPS records for this IMEI ordered by timestamp (latest first)
 	var allGPSData []models.GPSData
-	if err := db.GetDB().Where("imei = ?", imei).
+	if err := db.GetReadDB().Where("imei = ?", imei).
 		Preload("Device").
 		Preload("Vehicle").
 		Order("timestamp DESC").
@@ -249,7 +271,7 @@ func (gc *GPSController) GetLatestGPSDataByIMEI(c *gin.Context) {
 	}
 
 	var gpsData models.GPSData
-	if err := db.GetDB().Where("imei = ?", imei).
+	if err := db.GetReadDB().Where("imei = ?", imei).
 		Preload("Device").
 		Preload("Vehicle").
 		Order("timestamp DESC").
@@ -294,24 +316,24 @@ func (gc *GPSController) GetGPSRoute(c *gin.Context) {
 		return
 	}
 
-	fromTime, err := time.Parse("2006-01-02T15:04:05Z", from)
+	fromTime, err := config.ParseTimestamp(from)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid from time format. Use: 2006-01-02T15:04:05Z",
+			"error": "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
 		})
 		return
 	}
 
-	toTime, err := time.Parse("2006-01-02T15:04:05Z", to)
+	toTime, err := config.ParseTimestamp(to)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid to time format. Use: 2006-01-02T15:04:05Z",
+			"error": "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
 		})
 		return
 	}
 
 	var gpsData []models.GPSData
-	if err := db.GetDB().Where("imei = ? AND timestamp BETWEEN ? AND ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND speed IS NOT NULL",
+	if err := db.GetReadDB().Where("imei = ? AND timestamp BETWEEN ? AND ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND speed IS NOT NULL",
 		imei, fromTime, toTime).
 		Order("timestamp ASC").
 		Find(&gpsData).Error; err != nil {
@@ -343,8 +365,10 @@ func (gc *GPSController) GetGPSRoute(c *gin.Context) {
 	})
 }
 
-// DeleteGPSData deletes GPS data (admin only - implement auth middleware)
+// DeleteGPSData deletes GPS data (admin only, enforced by RequireRole in routes)
 func (gc *GPSController) DeleteGPSData(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionGPSDataDelete, "gps_data", c.Param("id"))
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -367,19 +391,92 @@ func (gc *GPSController) DeleteGPSData(c *gin.Context) {
 		})
 		return
 	}
+	services.GetLatestGPSCache().Invalidate(gpsData.IMEI)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "GPS data deleted successfully",
 	})
 }
 
+// InjectGPSData runs a GPS point through the same validation, filtering, notifications,
+// saving and broadcast as a fix from a device, so QA and demos can move a vehicle without
+// one (admin only). The body is shaped like a GPS data row; timestamp defaults to now.
+func (gc *GPSController) InjectGPSData(c *gin.Context) {
+	var gpsData models.GPSData
+	defer func() { recordAudit(c, models.AuditActionGPSDataInject, "device", gpsData.IMEI) }()
+
+	if err := c.ShouldBindJSON(&gpsData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if len(gpsData.IMEI) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "IMEI must be exactly 16 digits",
+		})
+		return
+	}
+
+	// Only the reported fields are taken; the rest is filled in by ingestion
+	gpsData.ID = 0
+	gpsData.SpeedSource = ""
+	gpsData.DistanceFromPrev = nil
+	if gpsData.Timestamp.IsZero() {
+		gpsData.Timestamp = time.Now()
+	}
+	if gpsData.ProtocolName == "" {
+		gpsData.ProtocolName = "INJECTED"
+	}
+
+	result, err := services.GetIngestionService().IngestGPS(&gpsData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to save GPS point",
+		})
+		return
+	}
+
+	switch {
+	case result.Rejected == "unregistered_device":
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Device not found",
+		})
+	case result.Rejected != "":
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"error":   "GPS point rejected: " + result.Rejected,
+			"data":    result,
+		})
+	case !result.Saved:
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "GPS point already stored",
+			"data":    result,
+		})
+	default:
+		colors.PrintInfo("📍 Injected GPS point saved for device %s", gpsData.IMEI)
+		c.JSON(http.StatusCreated, gin.H{
+			"success": true,
+			"message": "GPS point injected successfully",
+			"data":    result,
+		})
+	}
+}
+
 // GetLatestValidGPSData returns the latest GPS data with valid coordinates for all devices
 func (gc *GPSController) GetLatestValidGPSData(c *gin.Context) {
 	var gpsData []models.GPSData
 
 	// Get latest GPS data with valid coordinates for each IMEI
 	// This query selects the most recent GPS record with non-null coordinates for each device
-	if err := db.GetDB().Raw(`
+	if err := db.GetReadDB().Raw(`
 		SELECT DISTINCT ON (imei) *
 		FROM gps_data
 		WHERE deleted_at IS NULL 
@@ -412,7 +509,7 @@ func (gc *GPSController) GetLatestLocationData(c *gin.Context) {
 	var gpsData []models.GPSData
 
 	// Get latest location data for each IMEI - ONLY records with valid coordinates
-	if err := db.GetDB().Raw(`
+	if err := db.GetReadDB().Raw(`
 		SELECT DISTINCT ON (imei) *
 		FROM gps_data
 		WHERE deleted_at IS NULL 
@@ -446,7 +543,7 @@ func (gc *GPSController) GetLatestStatusData(c *gin.Context) {
 	var gpsData []models.GPSData
 
 	// Get latest status data for each IMEI - regardless of coordinates
-	if err := db.GetDB().Raw(`
+	if err := db.GetReadDB().Raw(`
 		SELECT DISTINCT ON (imei) *
 		FROM gps_data
 		WHERE deleted_at IS NULL
@@ -484,7 +581,7 @@ func (gc *GPSController) GetLocationDataByIMEI(c *gin.Context) {
 	var gpsData models.GPSData
 
 	// First try to get the latest GPS data with valid coordinates
-	if err := db.GetDB().Where("imei = ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND latitude != 0 AND longitude != 0").
+	if err := db.GetReadDB().Where("imei = ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND latitude != 0 AND longitude != 0").
 		Preload("Device").
 		Preload("Vehicle").
 		Order("timestamp DESC").
@@ -518,7 +615,7 @@ func (gc *GPSController) GetStatusDataByIMEI(c *gin.Context) {
 	}
 
 	var gpsData models.GPSData
-	if err := db.GetDB().Where("imei = ?", imei).
+	if err := db.GetReadDB().Where("imei = ?", imei).
 		Preload("Device").
 		Preload("Vehicle").
 		Order("timestamp DESC").
@@ -556,7 +653,7 @@ func (gc *GPSController) GetIndividualTrackingData(c *gin.Context) {
 	// Get latest status data (for ignition, battery, etc.)
 	var latestStatusData models.GPSData
 	statusFound := false
-	if err := db.GetDB().Where("imei = ?", imei).
+	if err := db.GetReadDB().Where("imei = ?", imei).
 		Preload("Device").
 		Preload("Vehicle").
 		Order("timestamp DESC").
@@ -569,7 +666,7 @@ func (gc *GPSController) GetIndividualTrackingData(c *gin.Context) {
 	// Get latest valid location data (with historical fallback)
 	var locationData *models.GPSData
 	var allGPSData []models.GPSData
-	if err := db.GetDB().Where("imei = ?", imei).
+	if err := db.GetReadDB().Where("imei = ?", imei).
 		Preload("Device").
 		Preload("Vehicle").
 		Order("timestamp DESC").
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaintenanceController handles admin-only data maintenance jobs
+type MaintenanceController struct {
+	backfillService *services.GPSBackfillService
+}
+
+// NewMaintenanceController creates a new maintenance controller
+func NewMaintenanceController() *MaintenanceController {
+	return &MaintenanceController{
+		backfillService: services.GetGPSBackfillService(),
+	}
+}
+
+// GPSBackfillRequest represents the request body for starting a GPS backfill
+type GPSBackfillRequest struct {
+	StartAfterID *uint `json:"start_after_id"` // Resume point; defaults to the last run's progress when resume is set
+	BatchSize    int   `json:"batch_size"`
+	Resume       bool  `json:"resume"`
+}
+
+// StartGPSBackfill starts recomputing derived fields for historical GPS rows in the background
+func (mc *MaintenanceController) StartGPSBackfill(c *gin.Context) {
+	var req GPSBackfillRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request format",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	var startAfterID uint
+	if req.StartAfterID != nil {
+		startAfterID = *req.StartAfterID
+	} else if req.Resume {
+		startAfterID = mc.backfillService.Progress().LastID
+	}
+
+	if req.BatchSize < 0 || req.BatchSize > 5000 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "batch_size must be between 1 and 5000",
+		})
+		return
+	}
+
+	progress, err := mc.backfillService.Start(startAfterID, req.BatchSize)
+	if err == services.ErrBackfillRunning {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"data":    progress,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    progress,
+		"message": "GPS backfill started",
+	})
+}
+
+// GetGPSBackfillStatus returns the progress of the current or last GPS backfill
+func (mc *MaintenanceController) GetGPSBackfillStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    mc.backfillService.Progress(),
+	})
+}
+
+// CancelGPSBackfill stops a running GPS backfill after its current batch
+func (mc *MaintenanceController) CancelGPSBackfill(c *gin.Context) {
+	if !mc.backfillService.Cancel() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "No GPS backfill is running",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "GPS backfill cancellation requested",
+	})
+}
+
+// RedecodeRecentPackets re-runs a device's last n stored raw frames (?n=, default 10)
+// through a fresh decoder, to check decoder changes against its real traffic
+func (mc *MaintenanceController) RedecodeRecentPackets(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+			"message": "IMEI must be exactly 16 digits",
+		})
+		return
+	}
+
+	n, err := strconv.Atoi(c.DefaultQuery("n", "10"))
+	if err != nil || n < 1 || n > services.MaxRedecodePackets {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("n must be between 1 and %d", services.MaxRedecodePackets),
+		})
+		return
+	}
+
+	var device models.Device
+	if err := db.GetDB().Where("imei = ?", imei).First(&device).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Device not found",
+		})
+		return
+	}
+	if device.Protocol != models.ProtocolGT06 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("No decoder for protocol %s", device.Protocol),
+		})
+		return
+	}
+
+	results, err := services.RedecodeRecentPackets(imei, n)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode recent packets",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    results,
+		"count":   len(results),
+	})
+}
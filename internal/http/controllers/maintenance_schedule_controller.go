@@ -0,0 +1,307 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MaintenanceScheduleController handles per-vehicle maintenance schedules
+type MaintenanceScheduleController struct{}
+
+// NewMaintenanceScheduleController creates a new maintenance schedule controller
+func NewMaintenanceScheduleController() *MaintenanceScheduleController {
+	return &MaintenanceScheduleController{}
+}
+
+// MaintenanceScheduleRequest is the body for creating or updating a schedule
+type MaintenanceScheduleRequest struct {
+	Name                string  `json:"name" binding:"required"`
+	IntervalKm          float64 `json:"interval_km"`
+	IntervalEngineHours float64 `json:"interval_engine_hours"`
+	IsActive            *bool   `json:"is_active"`
+}
+
+// GetSchedules lists the vehicle's maintenance schedules with their progress
+func (msc *MaintenanceScheduleController) GetSchedules(c *gin.Context) {
+	userVehicle, ok := msc.vehicleAccess(c, false)
+	if !ok {
+		return
+	}
+
+	var schedules []models.MaintenanceSchedule
+	if err := db.GetDB().Where("vehicle_id = ?", userVehicle.VehicleID).Order("name ASC").Find(&schedules).Error; err != nil {
+		colors.PrintError("Failed to fetch maintenance schedules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch maintenance schedules",
+		})
+		return
+	}
+
+	data := make([]gin.H, 0, len(schedules))
+	for i := range schedules {
+		data = append(data, gin.H{
+			"schedule": schedules[i],
+			"status":   services.GetMaintenanceStatus(&schedules[i], &userVehicle.Vehicle),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+		"count":   len(data),
+		"message": "Maintenance schedules retrieved successfully",
+	})
+}
+
+// CreateSchedule adds a maintenance schedule counted from the vehicle's current usage
+func (msc *MaintenanceScheduleController) CreateSchedule(c *gin.Context) {
+	userVehicle, ok := msc.vehicleAccess(c, true)
+	if !ok {
+		return
+	}
+
+	req, ok := bindMaintenanceScheduleRequest(c)
+	if !ok {
+		return
+	}
+
+	schedule := models.MaintenanceSchedule{
+		VehicleID:           userVehicle.VehicleID,
+		BaselineAt:          time.Now(),
+		BaselineEngineHours: userVehicle.Vehicle.EngineHours,
+		IsActive:            true,
+		CreatedBy:           userVehicle.UserID,
+	}
+	applyMaintenanceScheduleRequest(&schedule, req)
+
+	if err := db.GetDB().Create(&schedule).Error; err != nil {
+		colors.PrintError("Failed to create maintenance schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to create maintenance schedule",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"schedule": schedule,
+			"status":   services.GetMaintenanceStatus(&schedule, &userVehicle.Vehicle),
+		},
+		"message": "Maintenance schedule created successfully",
+	})
+}
+
+// UpdateSchedule changes a schedule's name, intervals or active flag. The baseline is kept.
+func (msc *MaintenanceScheduleController) UpdateSchedule(c *gin.Context) {
+	userVehicle, ok := msc.vehicleAccess(c, true)
+	if !ok {
+		return
+	}
+	schedule, ok := msc.findSchedule(c, userVehicle.VehicleID)
+	if !ok {
+		return
+	}
+
+	req, ok := bindMaintenanceScheduleRequest(c)
+	if !ok {
+		return
+	}
+	applyMaintenanceScheduleRequest(schedule, req)
+	// New intervals may not be due yet, so allow the reminder to fire again
+	schedule.NotifiedAt = nil
+
+	if err := db.GetDB().Save(schedule).Error; err != nil {
+		colors.PrintError("Failed to update maintenance schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update maintenance schedule",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"schedule": schedule,
+			"status":   services.GetMaintenanceStatus(schedule, &userVehicle.Vehicle),
+		},
+		"message": "Maintenance schedule updated successfully",
+	})
+}
+
+// DeleteSchedule removes a maintenance schedule
+func (msc *MaintenanceScheduleController) DeleteSchedule(c *gin.Context) {
+	userVehicle, ok := msc.vehicleAccess(c, true)
+	if !ok {
+		return
+	}
+	schedule, ok := msc.findSchedule(c, userVehicle.VehicleID)
+	if !ok {
+		return
+	}
+
+	if err := db.GetDB().Delete(schedule).Error; err != nil {
+		colors.PrintError("Failed to delete maintenance schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to delete maintenance schedule",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Maintenance schedule deleted successfully",
+	})
+}
+
+// MarkServiced records that the service was done now, restarting the interval
+func (msc *MaintenanceScheduleController) MarkServiced(c *gin.Context) {
+	userVehicle, ok := msc.vehicleAccess(c, true)
+	if !ok {
+		return
+	}
+	schedule, ok := msc.findSchedule(c, userVehicle.VehicleID)
+	if !ok {
+		return
+	}
+
+	if err := services.MarkMaintenanceServiced(schedule, &userVehicle.Vehicle, time.Now()); err != nil {
+		colors.PrintError("Failed to mark maintenance schedule %d as serviced: %v", schedule.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to mark service as done",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"schedule": schedule,
+			"status":   services.GetMaintenanceStatus(schedule, &userVehicle.Vehicle),
+		},
+		"message": "Service recorded successfully",
+	})
+}
+
+// vehicleAccess loads the current user's access to the vehicle named by :imei, with the
+// vehicle. Changing schedules requires edit permission. Writes the error response if it fails.
+func (msc *MaintenanceScheduleController) vehicleAccess(c *gin.Context, requireEdit bool) (*models.UserVehicle, bool) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return nil, false
+	}
+
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "User not authenticated",
+		})
+		return nil, false
+	}
+	user := currentUser.(*models.User)
+
+	var userVehicle models.UserVehicle
+	if err := db.GetDB().Where("user_id = ? AND vehicle_id = ? AND is_active = ?", user.ID, imei, true).
+		Preload("Vehicle").
+		First(&userVehicle).Error; err != nil || userVehicle.IsExpired() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not found or access denied",
+		})
+		return nil, false
+	}
+
+	if requireEdit && !userVehicle.VehicleEdit && !userVehicle.AllAccess {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "You don't have permission to edit this vehicle",
+		})
+		return nil, false
+	}
+
+	return &userVehicle, true
+}
+
+// findSchedule loads the vehicle's schedule named by :scheduleId, writing the error response if it fails
+func (msc *MaintenanceScheduleController) findSchedule(c *gin.Context, imei string) (*models.MaintenanceSchedule, bool) {
+	id, err := strconv.ParseUint(c.Param("scheduleId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid schedule ID",
+		})
+		return nil, false
+	}
+
+	var schedule models.MaintenanceSchedule
+	if err := db.GetDB().Where("id = ? AND vehicle_id = ?", uint(id), imei).First(&schedule).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Maintenance schedule not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to retrieve maintenance schedule",
+			})
+		}
+		return nil, false
+	}
+
+	return &schedule, true
+}
+
+// bindMaintenanceScheduleRequest parses and validates the request body, writing the error response if invalid
+func bindMaintenanceScheduleRequest(c *gin.Context) (*MaintenanceScheduleRequest, bool) {
+	var req MaintenanceScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"message": "name is required",
+		})
+		return nil, false
+	}
+
+	if req.IntervalKm < 0 || req.IntervalEngineHours < 0 || (req.IntervalKm == 0 && req.IntervalEngineHours == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid interval",
+			"message": "Set interval_km, interval_engine_hours or both to a positive value",
+		})
+		return nil, false
+	}
+
+	return &req, true
+}
+
+// applyMaintenanceScheduleRequest copies request fields onto the schedule
+func applyMaintenanceScheduleRequest(schedule *models.MaintenanceSchedule, req *MaintenanceScheduleRequest) {
+	schedule.Name = strings.TrimSpace(req.Name)
+	schedule.IntervalKm = req.IntervalKm
+	schedule.IntervalEngineHours = req.IntervalEngineHours
+	if req.IsActive != nil {
+		schedule.IsActive = *req.IsActive
+	}
+}
@@ -12,12 +12,14 @@ import (
 )
 
 type NotificationController struct {
-	notificationService *services.NotificationService
+	notificationService   *services.NotificationService
+	notificationDBService *services.NotificationDBService
 }
 
 func NewNotificationController() *NotificationController {
 	return &NotificationController{
-		notificationService: services.NewNotificationService(),
+		notificationService:   services.NewNotificationService(),
+		notificationDBService: services.NewNotificationDBService(),
 	}
 }
 
@@ -50,6 +52,18 @@ type UpdateFCMTokenRequest struct {
 	FCMToken string `json:"fcm_token" binding:"required"`
 }
 
+// RegisterDeviceRequest represents the request body for registering a device push token
+type RegisterDeviceRequest struct {
+	FCMToken   string `json:"fcm_token" binding:"required"`
+	Platform   string `json:"platform"` // android, ios or web
+	DeviceName string `json:"device_name"`
+}
+
+// UnregisterDeviceRequest represents the request body for unregistering a device push token
+type UnregisterDeviceRequest struct {
+	FCMToken string `json:"fcm_token" binding:"required"`
+}
+
 // SendNotification sends notification to specific users
 func (nc *NotificationController) SendNotification(c *gin.Context) {
 	var req SendNotificationRequest
@@ -194,6 +208,126 @@ func (nc *NotificationController) RemoveFCMToken(c *gin.Context) {
 	})
 }
 
+// GetDevices lists the push devices registered by the current user
+func (nc *NotificationController) GetDevices(c *gin.Context) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not authenticated",
+		})
+		return
+	}
+	userID := userIDInterface.(uint)
+
+	devices, err := services.GetUserDevices(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get devices",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    devices,
+	})
+}
+
+// RegisterDevice registers a push token for one of the current user's devices
+func (nc *NotificationController) RegisterDevice(c *gin.Context) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not authenticated",
+		})
+		return
+	}
+	userID := userIDInterface.(uint)
+
+	var req RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if req.Platform != "" && !models.IsValidDevicePlatform(req.Platform) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid platform",
+			"error":   "platform must be android, ios or web",
+		})
+		return
+	}
+
+	device, err := services.RegisterUserDevice(userID, req.FCMToken, req.Platform, req.DeviceName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to register device",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Device registered successfully",
+		"data":    device,
+	})
+}
+
+// UnregisterDevice stops push notifications to one of the current user's devices
+func (nc *NotificationController) UnregisterDevice(c *gin.Context) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not authenticated",
+		})
+		return
+	}
+	userID := userIDInterface.(uint)
+
+	var req UnregisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := services.UnregisterUserDevice(userID, req.FCMToken); err != nil {
+		if err == services.ErrDeviceNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Device token not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to unregister device",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Device unregistered successfully",
+	})
+}
+
 // SubscribeToTopic subscribes user to a topic
 func (nc *NotificationController) SubscribeToTopic(c *gin.Context) {
 	userIDInterface, exists := c.Get("user_id")
@@ -354,3 +488,122 @@ func (nc *NotificationController) DeleteNotification(c *gin.Context) {
 		"message": "Notification permanently deleted",
 	})
 }
+
+// GetMyNotifications lists the notifications sent to the current user, newest first.
+// Supports ?page=, ?limit= (max 100) and ?is_read=true|false.
+func (nc *NotificationController) GetMyNotifications(c *gin.Context) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not authenticated",
+		})
+		return
+	}
+	userID := userIDInterface.(uint)
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	var isRead *bool
+	if isReadParam := c.Query("is_read"); isReadParam != "" {
+		parsed, err := strconv.ParseBool(isReadParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid is_read filter",
+				"message": "is_read must be true or false",
+			})
+			return
+		}
+		isRead = &parsed
+	}
+
+	notifications, total, err := nc.notificationDBService.GetUserNotifications(userID, isRead, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get notifications",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	unreadCount, err := nc.notificationDBService.CountUnreadNotifications(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to count unread notifications",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	totalPages := int((total + int64(limit) - 1) / int64(limit))
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"data":         notifications,
+		"unread_count": unreadCount,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total_count": total,
+			"total_pages": totalPages,
+			"has_next":    page < totalPages,
+			"has_prev":    page > 1,
+		},
+	})
+}
+
+// MarkMyNotificationRead marks one of the current user's notifications as read
+func (nc *NotificationController) MarkMyNotificationRead(c *gin.Context) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not authenticated",
+		})
+		return
+	}
+	userID := userIDInterface.(uint)
+
+	notificationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid notification ID",
+			"message": "Please provide a valid notification ID",
+		})
+		return
+	}
+
+	if err := nc.notificationDBService.MarkUserNotificationAsRead(userID, uint(notificationID)); err != nil {
+		if err == services.ErrUserNotificationNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Notification not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to mark notification as read",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification marked as read",
+	})
+}
@@ -199,9 +199,14 @@ func (nmc *NotificationManagementController) CreateNotification(c *gin.Context)
 			ImageURL: imageURL,
 			Sound:    req.Sound,
 			Priority: req.Priority,
+
+			NotificationID: response.Data.ID,
 		}
 
 		sendResponse, err := nmc.notificationService.SendToMultipleUsers(req.UserIDs, notificationData)
+		if sendResponse != nil {
+			services.RecordDeliveries(response.Data.ID, sendResponse.Deliveries)
+		}
 		if err != nil {
 			colors.PrintError("Failed to send notification: %v", err)
 			// Don't fail the request, just log the error
@@ -295,9 +300,14 @@ func (nmc *NotificationManagementController) UpdateNotification(c *gin.Context)
 			ImageURL: imageURL,
 			Sound:    req.Sound,
 			Priority: req.Priority,
+
+			NotificationID: response.Data.ID,
 		}
 
 		sendResponse, err := nmc.notificationService.SendToMultipleUsers(req.UserIDs, notificationData)
+		if sendResponse != nil {
+			services.RecordDeliveries(response.Data.ID, sendResponse.Deliveries)
+		}
 		if err != nil {
 			colors.PrintError("Failed to send notification: %v", err)
 			// Don't fail the request, just log the error
@@ -347,6 +357,92 @@ func (nmc *NotificationManagementController) DeleteNotification(c *gin.Context)
 	})
 }
 
+// GetNotificationDeliveryStatus shows the push delivery state of every recipient of a notification
+func (nmc *NotificationManagementController) GetNotificationDeliveryStatus(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid notification ID",
+			"message": "Please provide a valid notification ID",
+		})
+		return
+	}
+
+	var notification models.Notification
+	if err := db.GetDB().First(&notification, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Notification not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get notification",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var recipients []models.NotificationUser
+	if err := db.GetDB().Preload("User").
+		Where("notification_id = ?", notification.ID).
+		Order("user_id ASC").
+		Find(&recipients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get delivery status",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	summary := map[string]int{
+		models.DeliveryStatusPending:   0,
+		models.DeliveryStatusDelivered: 0,
+		models.DeliveryStatusFailed:    0,
+		models.DeliveryStatusNoToken:   0,
+	}
+	recipientStatuses := make([]gin.H, 0, len(recipients))
+	for _, recipient := range recipients {
+		status := recipient.DeliveryStatus
+		if status == "" {
+			status = models.DeliveryStatusPending
+		}
+		summary[status]++
+
+		recipientStatuses = append(recipientStatuses, gin.H{
+			"user_id":         recipient.UserID,
+			"user_name":       recipient.User.Name,
+			"user_phone":      recipient.User.Phone,
+			"delivery_status": status,
+			"delivered_at":    recipient.DeliveredAt,
+			"delivery_error":  recipient.DeliveryError,
+			"devices_sent":    recipient.DevicesSent,
+			"devices_failed":  recipient.DevicesFailed,
+			"is_sent":         recipient.IsSent,
+			"sent_at":         recipient.SentAt,
+			"is_read":         recipient.IsRead,
+			"read_at":         recipient.ReadAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"notification_id": notification.ID,
+			"title":           notification.Title,
+			"is_sent":         notification.IsSent,
+			"sent_at":         notification.SentAt,
+			"summary":         summary,
+			"recipients":      recipientStatuses,
+		},
+	})
+}
+
 // SendNotification sends a notification immediately via Ravipangali API
 func (nmc *NotificationManagementController) SendNotification(c *gin.Context) {
 	idStr := c.Param("id")
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NotificationTemplateController handles notification template CRUD
+type NotificationTemplateController struct{}
+
+// NewNotificationTemplateController creates a new notification template controller
+func NewNotificationTemplateController() *NotificationTemplateController {
+	return &NotificationTemplateController{}
+}
+
+// NotificationTemplateRequest is the body for creating or updating a template
+type NotificationTemplateRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Language    string `json:"language"`
+	Title       string `json:"title" binding:"required"`
+	Body        string `json:"body" binding:"required"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+// GetTemplates returns all stored templates and the built-in catalog they can override
+func (ntc *NotificationTemplateController) GetTemplates(c *gin.Context) {
+	var templates []models.NotificationTemplate
+	if err := db.GetDB().Order("name ASC, language ASC").Find(&templates).Error; err != nil {
+		colors.PrintError("Failed to fetch notification templates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch notification templates",
+			"message": "Unable to retrieve notification templates from database",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"data":     templates,
+		"defaults": services.NotificationCatalog,
+		"count":    len(templates),
+		"message":  "Notification templates retrieved successfully",
+	})
+}
+
+// GetTemplate returns a single template with the variables it uses
+func (ntc *NotificationTemplateController) GetTemplate(c *gin.Context) {
+	template, ok := ntc.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      template,
+		"variables": services.TemplateVariables(template.Title + "\n" + template.Body),
+		"message":   "Notification template retrieved successfully",
+	})
+}
+
+// CreateTemplate creates a new template
+func (ntc *NotificationTemplateController) CreateTemplate(c *gin.Context) {
+	var req NotificationTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"message": "Name, title and body are required",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !validTemplateLanguage(c, req.Language) {
+		return
+	}
+
+	template := models.NotificationTemplate{IsActive: true}
+	applyTemplateRequest(&template, &req)
+
+	if ntc.nameTaken(template.Name, template.Language, 0) {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Template name already exists",
+			"message": "A notification template with this name already exists for this language",
+		})
+		return
+	}
+
+	if err := db.GetDB().Create(&template).Error; err != nil {
+		colors.PrintError("Failed to create notification template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to create notification template",
+			"message": "Database error occurred while creating notification template",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    template,
+		"message": "Notification template created successfully",
+	})
+}
+
+// UpdateTemplate replaces the fields of an existing template
+func (ntc *NotificationTemplateController) UpdateTemplate(c *gin.Context) {
+	template, ok := ntc.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	var req NotificationTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"message": "Name, title and body are required",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !validTemplateLanguage(c, req.Language) {
+		return
+	}
+
+	applyTemplateRequest(template, &req)
+
+	if ntc.nameTaken(template.Name, template.Language, template.ID) {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Template name already exists",
+			"message": "A notification template with this name already exists for this language",
+		})
+		return
+	}
+
+	// Save writes every column, so is_active can be set to false
+	if err := db.GetDB().Save(template).Error; err != nil {
+		colors.PrintError("Failed to update notification template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update notification template",
+			"message": "Database error occurred while updating notification template",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    template,
+		"message": "Notification template updated successfully",
+	})
+}
+
+// DeleteTemplate deletes a template. Vehicle events fall back to the built-in default.
+func (ntc *NotificationTemplateController) DeleteTemplate(c *gin.Context) {
+	template, ok := ntc.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	if err := db.GetDB().Delete(template).Error; err != nil {
+		colors.PrintError("Failed to delete notification template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to delete notification template",
+			"message": "Database error occurred while deleting notification template",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification template deleted successfully",
+	})
+}
+
+// findTemplate loads the template named by the :id parameter, writing the error response if it fails
+func (ntc *NotificationTemplateController) findTemplate(c *gin.Context) (*models.NotificationTemplate, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid template ID",
+			"message": "Template ID must be a valid number",
+		})
+		return nil, false
+	}
+
+	var template models.NotificationTemplate
+	if err := db.GetDB().First(&template, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Notification template not found",
+				"message": "No notification template found with the specified ID",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Database error",
+				"message": "Failed to retrieve notification template from database",
+			})
+		}
+		return nil, false
+	}
+
+	return &template, true
+}
+
+// nameTaken reports whether another template already uses the name in the language
+func (ntc *NotificationTemplateController) nameTaken(name, language string, excludeID uint) bool {
+	var count int64
+	db.GetDB().Model(&models.NotificationTemplate{}).
+		Where("name = ? AND language = ? AND id != ?", name, language, excludeID).
+		Count(&count)
+	return count > 0
+}
+
+// validTemplateLanguage rejects unsupported languages, writing the error response
+func validTemplateLanguage(c *gin.Context, language string) bool {
+	if language == "" || models.IsValidLanguage(language) {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"success": false,
+		"error":   "Invalid language",
+		"message": "Language must be 'en' or 'ne'",
+	})
+	return false
+}
+
+// applyTemplateRequest copies request fields onto the template
+func applyTemplateRequest(template *models.NotificationTemplate, req *NotificationTemplateRequest) {
+	template.Name = strings.TrimSpace(req.Name)
+	template.Language = req.Language
+	if template.Language == "" {
+		template.Language = models.LanguageEnglish
+	}
+	template.Title = req.Title
+	template.Body = req.Body
+	template.Type = req.Type
+	if template.Type == "" {
+		template.Type = "alert"
+	}
+	template.Description = req.Description
+	if req.IsActive != nil {
+		template.IsActive = *req.IsActive
+	}
+}
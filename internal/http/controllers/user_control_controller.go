@@ -1,12 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/http/middleware"
 	"luna_iot_server/internal/models"
 	"luna_iot_server/internal/protocol"
-	"luna_iot_server/pkg/colors"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,6 +33,7 @@ type UserControlResponse struct {
 	ControlResponse *protocol.ControlResponse `json:"control_response,omitempty"`
 	Permissions     []models.Permission       `json:"permissions,omitempty"`
 	Error           string                    `json:"error,omitempty"`
+	Channel         string                    `json:"channel,omitempty"` // "sms" when sent by the SMS fallback
 }
 
 // validateUserVehicleAccess checks if user has access to vehicle and specific permission
@@ -58,7 +61,7 @@ func (ucc *UserControlController) validateUserVehicleAccess(c *gin.Context, imei
 
 	// Manually load device for the vehicle
 	if err := userVehicle.Vehicle.LoadDevice(db.GetDB()); err != nil {
-		colors.PrintWarning("Failed to load device for vehicle %s: %v", userVehicle.Vehicle.IMEI, err)
+		middleware.RequestLogger(c).PrintWarning("Failed to load device for vehicle %s: %v", userVehicle.Vehicle.IMEI, err)
 	}
 
 	if userVehicle.IsExpired() {
@@ -83,6 +86,8 @@ func (ucc *UserControlController) validateUserVehicleAccess(c *gin.Context, imei
 
 // CutOilAndElectricity cuts oil and electricity for user's vehicle
 func (ucc *UserControlController) CutOilAndElectricity(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionOilCut, "device", c.Param("imei"))
+
 	imei := c.Param("imei")
 	if len(imei) != 16 {
 		c.JSON(http.StatusBadRequest, UserControlResponse{
@@ -102,28 +107,25 @@ func (ucc *UserControlController) CutOilAndElectricity(c *gin.Context) {
 		return
 	}
 
+	// Reject repeated or conflicting oil commands within the cooldown
+	if cooldownErr := ucc.controlController.ReserveOilCommand(imei, protocol.CmdCutOil); cooldownErr != nil {
+		rejectDuringCooldown(c, cooldownErr)
+		return
+	}
+
 	// Get active connection for this device
 	conn, exists := ucc.controlController.GetActiveConnection(imei)
 	if !exists {
-		c.JSON(http.StatusNotFound, UserControlResponse{
-			Success: false,
-			Error:   "Device is not currently connected",
-			VehicleInfo: map[string]interface{}{
-				"imei":         userVehicle.Vehicle.IMEI,
-				"reg_no":       userVehicle.Vehicle.RegNo,
-				"name":         userVehicle.Vehicle.Name,
-				"vehicle_type": userVehicle.Vehicle.VehicleType,
-			},
-		})
+		ucc.respondNotConnected(c, userVehicle, protocol.CmdCutOil)
 		return
 	}
 
 	// Create GPS tracker controller and send command
-	controller := protocol.NewGPSTrackerController(conn, imei)
+	controller := ucc.controlController.trackerController(conn, imei)
 	response, err := controller.CutOilAndElectricity()
 
 	if err != nil {
-		colors.PrintError("Failed to cut oil and electricity for IMEI %s: %v", imei, err)
+		middleware.RequestLogger(c).PrintError("Failed to cut oil and electricity for IMEI %s: %v", imei, err)
 		c.JSON(http.StatusInternalServerError, UserControlResponse{
 			Success: false,
 			Error:   "Failed to send command to device",
@@ -137,7 +139,11 @@ func (ucc *UserControlController) CutOilAndElectricity(c *gin.Context) {
 		return
 	}
 
-	colors.PrintSuccess("Oil and electricity cut for vehicle %s (IMEI: %s) by user %s",
+	if response.Success {
+		recordControlCommand(c, imei, protocol.CmdCutOil, "tcp")
+	}
+
+	middleware.RequestLogger(c).PrintSuccess("Oil and electricity cut for vehicle %s (IMEI: %s) by user %s",
 		userVehicle.Vehicle.RegNo, imei, c.GetString("user_email"))
 
 	c.JSON(http.StatusOK, UserControlResponse{
@@ -156,6 +162,8 @@ func (ucc *UserControlController) CutOilAndElectricity(c *gin.Context) {
 
 // ConnectOilAndElectricity connects oil and electricity for user's vehicle
 func (ucc *UserControlController) ConnectOilAndElectricity(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionOilConnect, "device", c.Param("imei"))
+
 	imei := c.Param("imei")
 	if len(imei) != 16 {
 		c.JSON(http.StatusBadRequest, UserControlResponse{
@@ -175,28 +183,25 @@ func (ucc *UserControlController) ConnectOilAndElectricity(c *gin.Context) {
 		return
 	}
 
+	// Reject repeated or conflicting oil commands within the cooldown
+	if cooldownErr := ucc.controlController.ReserveOilCommand(imei, protocol.CmdConnectOil); cooldownErr != nil {
+		rejectDuringCooldown(c, cooldownErr)
+		return
+	}
+
 	// Get active connection for this device
 	conn, exists := ucc.controlController.GetActiveConnection(imei)
 	if !exists {
-		c.JSON(http.StatusNotFound, UserControlResponse{
-			Success: false,
-			Error:   "Device is not currently connected",
-			VehicleInfo: map[string]interface{}{
-				"imei":         userVehicle.Vehicle.IMEI,
-				"reg_no":       userVehicle.Vehicle.RegNo,
-				"name":         userVehicle.Vehicle.Name,
-				"vehicle_type": userVehicle.Vehicle.VehicleType,
-			},
-		})
+		ucc.respondNotConnected(c, userVehicle, protocol.CmdConnectOil)
 		return
 	}
 
 	// Create GPS tracker controller and send command
-	controller := protocol.NewGPSTrackerController(conn, imei)
+	controller := ucc.controlController.trackerController(conn, imei)
 	response, err := controller.ConnectOilAndElectricity()
 
 	if err != nil {
-		colors.PrintError("Failed to connect oil and electricity for IMEI %s: %v", imei, err)
+		middleware.RequestLogger(c).PrintError("Failed to connect oil and electricity for IMEI %s: %v", imei, err)
 		c.JSON(http.StatusInternalServerError, UserControlResponse{
 			Success: false,
 			Error:   "Failed to send command to device",
@@ -210,7 +215,11 @@ func (ucc *UserControlController) ConnectOilAndElectricity(c *gin.Context) {
 		return
 	}
 
-	colors.PrintSuccess("Oil and electricity connected for vehicle %s (IMEI: %s) by user %s",
+	if response.Success {
+		recordControlCommand(c, imei, protocol.CmdConnectOil, "tcp")
+	}
+
+	middleware.RequestLogger(c).PrintSuccess("Oil and electricity connected for vehicle %s (IMEI: %s) by user %s",
 		userVehicle.Vehicle.RegNo, imei, c.GetString("user_email"))
 
 	c.JSON(http.StatusOK, UserControlResponse{
@@ -251,25 +260,16 @@ func (ucc *UserControlController) GetVehicleLocation(c *gin.Context) {
 	// Get active connection for this device
 	conn, exists := ucc.controlController.GetActiveConnection(imei)
 	if !exists {
-		c.JSON(http.StatusNotFound, UserControlResponse{
-			Success: false,
-			Error:   "Device is not currently connected",
-			VehicleInfo: map[string]interface{}{
-				"imei":         userVehicle.Vehicle.IMEI,
-				"reg_no":       userVehicle.Vehicle.RegNo,
-				"name":         userVehicle.Vehicle.Name,
-				"vehicle_type": userVehicle.Vehicle.VehicleType,
-			},
-		})
+		ucc.respondNotConnected(c, userVehicle, protocol.CmdLocation)
 		return
 	}
 
 	// Create GPS tracker controller and send command
-	controller := protocol.NewGPSTrackerController(conn, imei)
+	controller := ucc.controlController.trackerController(conn, imei)
 	response, err := controller.GetLocation()
 
 	if err != nil {
-		colors.PrintError("Failed to get location for IMEI %s: %v", imei, err)
+		middleware.RequestLogger(c).PrintError("Failed to get location for IMEI %s: %v", imei, err)
 		c.JSON(http.StatusInternalServerError, UserControlResponse{
 			Success: false,
 			Error:   "Failed to send command to device",
@@ -283,7 +283,7 @@ func (ucc *UserControlController) GetVehicleLocation(c *gin.Context) {
 		return
 	}
 
-	colors.PrintInfo("Location requested for vehicle %s (IMEI: %s) by user %s",
+	middleware.RequestLogger(c).PrintInfo("Location requested for vehicle %s (IMEI: %s) by user %s",
 		userVehicle.Vehicle.RegNo, imei, c.GetString("user_email"))
 
 	c.JSON(http.StatusOK, UserControlResponse{
@@ -300,6 +300,95 @@ func (ucc *UserControlController) GetVehicleLocation(c *gin.Context) {
 	})
 }
 
+// respondNotConnected answers a command for a vehicle whose device has no TCP connection,
+// sending it by SMS when the fallback is available
+func (ucc *UserControlController) respondNotConnected(c *gin.Context, userVehicle *models.UserVehicle, command string) {
+	vehicleInfo := map[string]interface{}{
+		"imei":         userVehicle.Vehicle.IMEI,
+		"reg_no":       userVehicle.Vehicle.RegNo,
+		"name":         userVehicle.Vehicle.Name,
+		"vehicle_type": userVehicle.Vehicle.VehicleType,
+	}
+
+	response, err := ucc.controlController.SendCommandBySMS(&userVehicle.Vehicle.Device, command)
+	if err != nil {
+		ucc.controlController.releaseOilCommand(userVehicle.Vehicle.IMEI, command)
+	}
+	if errors.Is(err, ErrSMSFallbackUnavailable) {
+		c.JSON(http.StatusNotFound, UserControlResponse{
+			Success:     false,
+			Error:       "Device is not currently connected",
+			VehicleInfo: vehicleInfo,
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).PrintError("Failed to send command %s by SMS for IMEI %s: %v", command, userVehicle.Vehicle.IMEI, err)
+		c.JSON(http.StatusBadGateway, UserControlResponse{
+			Success:     false,
+			Error:       "Device is not connected and the SMS command could not be sent",
+			VehicleInfo: vehicleInfo,
+		})
+		return
+	}
+
+	middleware.RequestLogger(c).PrintInfo("Command %s sent by SMS for vehicle %s (IMEI: %s) by user %s",
+		command, userVehicle.Vehicle.RegNo, userVehicle.Vehicle.IMEI, c.GetString("user_email"))
+	recordControlCommand(c, userVehicle.Vehicle.IMEI, command, "sms")
+
+	c.JSON(http.StatusAccepted, UserControlResponse{
+		Success:         true,
+		Message:         response.Message,
+		VehicleInfo:     vehicleInfo,
+		ControlResponse: response,
+		Permissions:     userVehicle.GetPermissions(),
+		Channel:         "sms",
+	})
+}
+
+// GetCommandAvailability tells the app whether control commands can currently reach the
+// vehicle's device, so it does not offer commands that would fail
+func (ucc *UserControlController) GetCommandAvailability(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, UserControlResponse{
+			Success: false,
+			Error:   "Invalid IMEI format",
+		})
+		return
+	}
+
+	userVehicle, errorResponse, err := ucc.validateUserVehicleAccess(c, imei, models.PermissionLiveTracking)
+	if err != nil || errorResponse != nil {
+		statusCode := http.StatusForbidden
+		if err != nil {
+			statusCode = http.StatusNotFound
+		}
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	var lastSeen *time.Time
+	var latestGPS models.GPSData
+	if err := db.GetReadDB().Select("timestamp").Where("imei = ?", imei).
+		Order("timestamp DESC").First(&latestGPS).Error; err == nil {
+		lastSeen = &latestGPS.Timestamp
+	}
+
+	device := userVehicle.Vehicle.Device
+	device.IMEI = imei // Device may not be registered; availability is still reported for the IMEI
+	availability := ucc.controlController.GetCommandAvailability(&device, lastSeen)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"availability": availability,
+			"permissions":  userVehicle.GetPermissions(),
+		},
+		"message": "Command availability retrieved successfully",
+	})
+}
+
 // GetUserActiveDevices returns list of active devices for user's vehicles
 func (ucc *UserControlController) GetUserActiveDevices(c *gin.Context) {
 	currentUser, exists := c.Get("user")
@@ -326,12 +415,12 @@ func (ucc *UserControlController) GetUserActiveDevices(c *gin.Context) {
 	// Manually load device for each vehicle
 	for i := range userVehicles {
 		if err := userVehicles[i].Vehicle.LoadDevice(db.GetDB()); err != nil {
-			colors.PrintWarning("Failed to load device for vehicle %s: %v", userVehicles[i].Vehicle.IMEI, err)
+			middleware.RequestLogger(c).PrintWarning("Failed to load device for vehicle %s: %v", userVehicles[i].Vehicle.IMEI, err)
 		}
 	}
 
 	// Get registered IMEIs from control controller
-	registeredIMEIs := ucc.controlController.getRegisteredIMEIs()
+	registeredIMEIs := ucc.controlController.ConnectedIMEIs()
 	registeredSet := make(map[string]bool)
 	for _, imei := range registeredIMEIs {
 		registeredSet[imei] = true
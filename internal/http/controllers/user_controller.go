@@ -267,6 +267,13 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 		colors.PrintInfo("User image updated (size: %d bytes)", len(image))
 	}
 
+	if language, ok := updateData["language"]; ok {
+		if code, isString := language.(string); !isString || !models.IsValidLanguage(code) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Language must be 'en' or 'ne'"})
+			return
+		}
+	}
+
 	// Handle password update
 	if password, ok := updateData["password"].(string); ok {
 		if strings.TrimSpace(password) == "" {
@@ -323,6 +330,8 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 
 // DeleteUser deletes a user
 func (uc *UserController) DeleteUser(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionUserDelete, "user", c.Param("id"))
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
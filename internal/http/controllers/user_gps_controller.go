@@ -5,8 +5,10 @@ import (
 	"strconv"
 	"time"
 
+	"luna_iot_server/config"
 	"luna_iot_server/internal/db"
 	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -58,7 +60,7 @@ func (ugc *UserGPSController) GetUserVehicleTracking(c *gin.Context) {
 
 		// Get latest GPS data for this vehicle
 		var latestGPS models.GPSData
-		if err := db.GetDB().Where("imei = ?", userVehicle.Vehicle.IMEI).
+		if err := db.GetReadDB().Where("imei = ?", userVehicle.Vehicle.IMEI).
 			Order("timestamp DESC").First(&latestGPS).Error; err != nil {
 			continue // Skip if no GPS data found
 		}
@@ -66,7 +68,7 @@ func (ugc *UserGPSController) GetUserVehicleTracking(c *gin.Context) {
 		// Get latest valid location data (fallback through history)
 		var locationData *models.GPSData
 		var allGPSData []models.GPSData
-		if err := db.GetDB().Where("imei = ?", userVehicle.Vehicle.IMEI).
+		if err := db.GetReadDB().Where("imei = ?", userVehicle.Vehicle.IMEI).
 			Order("timestamp DESC").Limit(50).Find(&allGPSData).Error; err == nil {
 
 			for _, data := range allGPSData {
@@ -86,6 +88,8 @@ func (ugc *UserGPSController) GetUserVehicleTracking(c *gin.Context) {
 			"reg_no":          userVehicle.Vehicle.RegNo,
 			"name":            userVehicle.Vehicle.Name,
 			"vehicle_type":    userVehicle.Vehicle.VehicleType,
+			"color":           userVehicle.Vehicle.Color,
+			"icon_type":       userVehicle.Vehicle.IconType,
 			"user_role":       userVehicle.GetUserRole(),
 			"permissions":     userVehicle.GetPermissions(),
 			"latest_status":   latestGPS,
@@ -144,29 +148,16 @@ func (ugc *UserGPSController) GetUserVehicleLocation(c *gin.Context) {
 		return
 	}
 
-	// Get latest valid location data with historical fallback
-	var allGPSData []models.GPSData
-	if err := db.GetDB().Where("imei = ?", imei).
-		Order("timestamp DESC").Limit(100).Find(&allGPSData).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+	// Latest valid location, which may be older than the latest status-only packet
+	_, locationData, err := services.GetLatestGPSCache().Latest(imei)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"error":   "No GPS data found for this vehicle",
+			"error":   "Failed to fetch location data",
 		})
 		return
 	}
 
-	var locationData *models.GPSData
-	for _, data := range allGPSData {
-		if data.Latitude != nil && data.Longitude != nil {
-			lat := *data.Latitude
-			lng := *data.Longitude
-			if lat != 0 && lng != 0 && lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 {
-				locationData = &data
-				break
-			}
-		}
-	}
-
 	if locationData == nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
@@ -229,7 +220,7 @@ func (ugc *UserGPSController) GetUserVehicleStatus(c *gin.Context) {
 
 	// Get latest GPS data for status
 	var latestGPS models.GPSData
-	if err := db.GetDB().Where("imei = ?", imei).
+	if err := db.GetReadDB().Where("imei = ?", imei).
 		Order("timestamp DESC").First(&latestGPS).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
@@ -291,18 +282,30 @@ func (ugc *UserGPSController) GetUserVehicleHistory(c *gin.Context) {
 	}
 
 	// Parse time filters
-	query := db.GetDB().Where("imei = ?", imei)
+	query := db.GetReadDB().Where("imei = ?", imei)
 
 	if from := c.Query("from"); from != "" {
-		if fromTime, err := time.Parse("2006-01-02T15:04:05Z", from); err == nil {
-			query = query.Where("timestamp >= ?", fromTime)
+		fromTime, err := config.ParseTimestamp(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
 		}
+		query = query.Where("timestamp >= ?", fromTime)
 	}
 
 	if to := c.Query("to"); to != "" {
-		if toTime, err := time.Parse("2006-01-02T15:04:05Z", to); err == nil {
-			query = query.Where("timestamp <= ?", toTime)
+		toTime, err := config.ParseTimestamp(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
 		}
+		query = query.Where("timestamp <= ?", toTime)
 	}
 
 	// Pagination
@@ -385,26 +388,29 @@ func (ugc *UserGPSController) GetUserVehicleRoute(c *gin.Context) {
 		return
 	}
 
-	fromTime, err := time.Parse("2006-01-02T15:04:05Z", from)
+	fromTime, err := config.ParseTimestamp(from)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Invalid from time format. Use: 2006-01-02T15:04:05Z",
+			"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
 		})
 		return
 	}
 
-	toTime, err := time.Parse("2006-01-02T15:04:05Z", to)
+	toTime, err := config.ParseTimestamp(to)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Invalid to time format. Use: 2006-01-02T15:04:05Z",
+			"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
 		})
 		return
 	}
+	if !withinHistoryRange(c, fromTime, toTime) {
+		return
+	}
 
 	var gpsData []models.GPSData
-	if err := db.GetDB().Where("imei = ? AND timestamp BETWEEN ? AND ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND speed IS NOT NULL",
+	if err := db.GetReadDB().Where("imei = ? AND timestamp BETWEEN ? AND ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND speed IS NOT NULL",
 		imei, fromTime, toTime).Order("timestamp ASC").Find(&gpsData).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -453,6 +459,30 @@ func (ugc *UserGPSController) GetUserVehicleReport(c *gin.Context) {
 	}
 	user := currentUser.(*models.User)
 
+	// Parse date range
+	from := c.DefaultQuery("from", config.FormatTimestamp(time.Now().AddDate(0, 0, -7)))
+	to := c.DefaultQuery("to", config.FormatTimestamp(time.Now()))
+
+	fromTime, err := config.ParseTimestamp(from)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return
+	}
+	toTime, err := config.ParseTimestamp(to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return
+	}
+	if !withinHistoryRange(c, fromTime, toTime) {
+		return
+	}
+
 	// Get user's accessible vehicles with report permission
 	var userVehicles []models.UserVehicle
 	if err := db.GetDB().Where("user_id = ? AND is_active = ? AND (report = ? OR all_access = ?)",
@@ -464,13 +494,6 @@ func (ugc *UserGPSController) GetUserVehicleReport(c *gin.Context) {
 		return
 	}
 
-	// Parse date range
-	from := c.DefaultQuery("from", time.Now().AddDate(0, 0, -7).Format("2006-01-02T15:04:05Z"))
-	to := c.DefaultQuery("to", time.Now().Format("2006-01-02T15:04:05Z"))
-
-	fromTime, _ := time.Parse("2006-01-02T15:04:05Z", from)
-	toTime, _ := time.Parse("2006-01-02T15:04:05Z", to)
-
 	var reportData []map[string]interface{}
 
 	for _, userVehicle := range userVehicles {
@@ -480,7 +503,7 @@ func (ugc *UserGPSController) GetUserVehicleReport(c *gin.Context) {
 
 		// Get GPS data for the date range
 		var gpsData []models.GPSData
-		if err := db.GetDB().Where("imei = ? AND timestamp BETWEEN ? AND ?",
+		if err := db.GetReadDB().Where("imei = ? AND timestamp BETWEEN ? AND ?",
 			userVehicle.Vehicle.IMEI, fromTime, toTime).Find(&gpsData).Error; err != nil {
 			continue
 		}
@@ -1,11 +1,17 @@
 package controllers
 
 import (
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"luna_iot_server/config"
 	"luna_iot_server/internal/db"
 	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
 	"luna_iot_server/pkg/colors"
 	"luna_iot_server/pkg/utils"
 
@@ -13,11 +19,17 @@ import (
 )
 
 // UserTrackingController handles all user-based tracking operations
-type UserTrackingController struct{}
+type UserTrackingController struct {
+	addressResolver   services.AddressResolver
+	controlController *ControlController
+}
 
 // NewUserTrackingController creates a new user tracking controller
-func NewUserTrackingController() *UserTrackingController {
-	return &UserTrackingController{}
+func NewUserTrackingController(controlController *ControlController) *UserTrackingController {
+	return &UserTrackingController{
+		addressResolver:   services.GetAddressResolver(),
+		controlController: controlController,
+	}
 }
 
 // GetMyVehiclesTracking returns real-time tracking data for all user's vehicles
@@ -39,6 +51,12 @@ func (utc *UserTrackingController) GetMyVehiclesTracking(c *gin.Context) {
 		return
 	}
 
+	// Optional ?group_id= narrows tracking to one of the user's vehicle groups
+	userVehicles, ok := groupFilter(c, user.ID, userVehicles)
+	if !ok {
+		return
+	}
+
 	if len(userVehicles) == 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -55,27 +73,13 @@ func (utc *UserTrackingController) GetMyVehiclesTracking(c *gin.Context) {
 		imeis = append(imeis, uv.VehicleID)
 	}
 
-	// Efficiently fetch the latest GPS data for all vehicles in a single query
-	var latestGpsData []models.GPSData
-	subQuery := db.GetDB().
-		Select("MAX(id) as id").
-		Model(&models.GPSData{}).
-		Where("imei IN ?", imeis).
-		Group("imei")
-
-	if err := db.GetDB().
-		Where("id IN (?)", subQuery).
-		Find(&latestGpsData).Error; err != nil {
+	// Latest GPS data for all vehicles from the cache; uncached vehicles are loaded together
+	gpsDataMap, _, err := services.GetLatestGPSCache().LatestMany(imeis)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch latest GPS data"})
 		return
 	}
 
-	// Create a map for quick lookup of GPS data by IMEI
-	gpsDataMap := make(map[string]models.GPSData)
-	for _, gps := range latestGpsData {
-		gpsDataMap[gps.IMEI] = gps
-	}
-
 	// Manually load device for each vehicle and build the response
 	var trackingData []map[string]interface{}
 	for i := range userVehicles {
@@ -110,6 +114,330 @@ func (utc *UserTrackingController) GetMyVehiclesTracking(c *gin.Context) {
 	})
 }
 
+// GetMyFleetSummary returns dashboard counts for all of the user's vehicles: how many are
+// online, moving, idle, stopped or offline right now, and the fleet's distance today
+func (utc *UserTrackingController) GetMyFleetSummary(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "User not authenticated"})
+		return
+	}
+	user := currentUser.(*models.User)
+
+	var isConnected func(imei string) bool
+	if utc.controlController != nil {
+		isConnected = utc.controlController.IsConnected
+	}
+
+	summary, err := services.GetFleetSummary(user.ID, isConnected)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to summarize fleet"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    summary,
+		"message": "Fleet summary retrieved successfully",
+	})
+}
+
+// LatestTrackingRequest represents the request body for batch latest-location lookups
+type LatestTrackingRequest struct {
+	IMEIs []string `json:"imeis" binding:"required"`
+}
+
+// GetMyVehiclesLatest returns the latest location and status for a list of the user's vehicles
+func (utc *UserTrackingController) GetMyVehiclesLatest(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "User not authenticated"})
+		return
+	}
+	user := currentUser.(*models.User)
+
+	var req LatestTrackingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if len(req.IMEIs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "At least one IMEI is required",
+		})
+		return
+	}
+
+	geoJSON, ok := wantsGeoJSON(c)
+	if !ok {
+		return
+	}
+
+	// Only keep IMEIs the user can live-track
+	var userVehicles []models.UserVehicle
+	if err := db.GetDB().
+		Where("user_id = ? AND vehicle_id IN ? AND is_active = ? AND (live_tracking = ? OR all_access = ?)",
+			user.ID, req.IMEIs, true, true, true).
+		Preload("Vehicle").
+		Find(&userVehicles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch user vehicles"})
+		return
+	}
+
+	var imeis []string
+	for _, uv := range userVehicles {
+		if uv.IsExpired() {
+			continue
+		}
+		imeis = append(imeis, uv.VehicleID)
+	}
+
+	if len(imeis) == 0 && geoJSON {
+		respondGeoJSON(c, services.NewFeatureCollection(nil))
+		return
+	}
+	if len(imeis) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"data":      []map[string]interface{}{},
+			"count":     0,
+			"requested": len(req.IMEIs),
+			"message":   "None of the requested vehicles are accessible.",
+		})
+		return
+	}
+
+	// Latest status and latest valid location of each IMEI, from the cache where possible
+	statusMap, locationMap, err := services.GetLatestGPSCache().LatestMany(imeis)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch latest GPS data"})
+		return
+	}
+
+	// One point per vehicle at its latest valid location; vehicles never located are left out
+	if geoJSON {
+		var positions []services.GeoJSONFeature
+		for _, uv := range userVehicles {
+			location, located := locationMap[uv.VehicleID]
+			if uv.IsExpired() || !located {
+				continue
+			}
+			if position, ok := services.PositionFeature(location, map[string]interface{}{
+				"name":   uv.Vehicle.Name,
+				"reg_no": uv.Vehicle.RegNo,
+			}); ok {
+				positions = append(positions, position)
+			}
+		}
+		respondGeoJSON(c, services.NewFeatureCollection(positions))
+		return
+	}
+
+	var latestData []map[string]interface{}
+	for _, uv := range userVehicles {
+		if uv.IsExpired() {
+			continue
+		}
+
+		vehicleData := map[string]interface{}{
+			"imei":            uv.VehicleID,
+			"vehicle":         uv.Vehicle,
+			"latest_status":   nil,
+			"latest_location": nil,
+		}
+
+		if status, ok := statusMap[uv.VehicleID]; ok {
+			vehicleData["latest_status"] = status
+		}
+		if location, ok := locationMap[uv.VehicleID]; ok {
+			vehicleData["latest_location"] = location
+		}
+
+		latestData = append(latestData, vehicleData)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      latestData,
+		"count":     len(latestData),
+		"requested": len(req.IMEIs),
+		"message":   "Latest vehicle data retrieved successfully",
+	})
+}
+
+// GetMyNearestVehicles returns the user's vehicles closest to a point, e.g. an incident
+// location, using each vehicle's latest valid fix. Vehicles without a fix in the last
+// max_age_minutes (default 60) are left out.
+func (utc *UserTrackingController) GetMyNearestVehicles(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "User not authenticated"})
+		return
+	}
+	user := currentUser.(*models.User)
+
+	lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(c.Query("lng"), 64)
+	if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid coordinates",
+			"message": "lat and lng are required, with lat between -90 and 90 and lng between -180 and 180",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid limit",
+			"message": "limit must be between 1 and 100",
+		})
+		return
+	}
+
+	maxAgeMinutes, err := strconv.Atoi(c.DefaultQuery("max_age_minutes", "60"))
+	if err != nil || maxAgeMinutes < 1 || maxAgeMinutes > 7*24*60 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid max_age_minutes",
+			"message": "max_age_minutes must be between 1 and 10080 (7 days)",
+		})
+		return
+	}
+
+	vehicles, latestLocationData, err := utc.liveTrackingLocations(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch latest location data"})
+		return
+	}
+
+	since := time.Now().Add(-time.Duration(maxAgeMinutes) * time.Minute)
+	nearest := make([]map[string]interface{}, 0, limit)
+	for _, ranked := range services.RankByDistance(lat, lng, latestLocationData, since, limit) {
+		nearest = append(nearest, map[string]interface{}{
+			"imei":        ranked.IMEI,
+			"vehicle":     vehicles[ranked.IMEI],
+			"distance_km": math.Round(ranked.DistanceKm*1000) / 1000,
+			"location":    ranked.Location,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    nearest,
+		"count":   len(nearest),
+		"point":   gin.H{"latitude": lat, "longitude": lng},
+		"message": "Nearest vehicles retrieved successfully",
+	})
+}
+
+// GetMyVehicleClusters returns the user's vehicles for a map overview, grouped into
+// clusters on a grid sized for the zoom level. From ClusterMaxZoom up every vehicle
+// is returned individually. bbox (minLng,minLat,maxLng,maxLat) defaults to the world.
+func (utc *UserTrackingController) GetMyVehicleClusters(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "User not authenticated"})
+		return
+	}
+	user := currentUser.(*models.User)
+
+	zoom, err := strconv.Atoi(c.Query("zoom"))
+	if err != nil || zoom < 0 || zoom > services.MaxMapZoom {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid zoom",
+			"message": fmt.Sprintf("zoom is required and must be between 0 and %d", services.MaxMapZoom),
+		})
+		return
+	}
+
+	box := services.WorldBoundingBox
+	if bbox := c.Query("bbox"); bbox != "" {
+		if box, err = services.ParseBoundingBox(bbox); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid bbox",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	vehicles, latestLocationData, err := utc.liveTrackingLocations(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch latest location data"})
+		return
+	}
+
+	clusters, singles := services.ClusterLocations(latestLocationData, zoom, box)
+	individual := make([]map[string]interface{}, 0, len(singles))
+	for _, location := range singles {
+		individual = append(individual, map[string]interface{}{
+			"imei":     location.IMEI,
+			"vehicle":  vehicles[location.IMEI],
+			"location": location,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": map[string]interface{}{
+			"zoom":      zoom,
+			"bbox":      box,
+			"clustered": zoom < services.ClusterMaxZoom,
+			"clusters":  clusters,
+			"vehicles":  individual,
+		},
+		"message": "Vehicle clusters retrieved successfully",
+	})
+}
+
+// liveTrackingLocations returns the vehicles the user can live-track and the latest
+// valid fix of each. Vehicles without a fix have no entry in the locations.
+func (utc *UserTrackingController) liveTrackingLocations(userID uint) (map[string]models.Vehicle, []models.GPSData, error) {
+	var userVehicles []models.UserVehicle
+	if err := db.GetDB().
+		Where("user_id = ? AND is_active = ? AND (live_tracking = ? OR all_access = ?)", userID, true, true, true).
+		Preload("Vehicle").
+		Find(&userVehicles).Error; err != nil {
+		return nil, nil, err
+	}
+
+	vehicles := make(map[string]models.Vehicle)
+	var imeis []string
+	for _, uv := range userVehicles {
+		if uv.IsExpired() {
+			continue
+		}
+		vehicles[uv.VehicleID] = uv.Vehicle
+		imeis = append(imeis, uv.VehicleID)
+	}
+
+	var latestLocationData []models.GPSData
+	if len(imeis) > 0 {
+		_, locations, err := services.GetLatestGPSCache().LatestMany(imeis)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, imei := range imeis {
+			if location, located := locations[imei]; located {
+				latestLocationData = append(latestLocationData, *location)
+			}
+		}
+	}
+
+	return vehicles, latestLocationData, nil
+}
+
 // GetMyVehicleTracking returns detailed tracking data for a specific vehicle
 func (utc *UserTrackingController) GetMyVehicleTracking(c *gin.Context) {
 	imei := c.Param("imei")
@@ -163,43 +491,15 @@ func (utc *UserTrackingController) GetMyVehicleTracking(c *gin.Context) {
 		return
 	}
 
-	// Get latest status data
-	var latestGPS models.GPSData
-	hasStatusData := false
-	if err := db.GetDB().Where("imei = ?", imei).
-		Order("timestamp DESC").First(&latestGPS).Error; err == nil {
-		hasStatusData = true
-	}
+	latestGPS := latestStatus(imei)
+	hasStatusData := latestGPS != nil
 
 	// Get latest valid location data with extensive historical fallback
-	var locationData *models.GPSData
-	var allGPSData []models.GPSData
-	hasLocationData := false
-	if err := db.GetDB().Where("imei = ?", imei).
-		Order("timestamp DESC").Limit(100).Find(&allGPSData).Error; err == nil {
-
-		for _, data := range allGPSData {
-			if data.Latitude != nil && data.Longitude != nil {
-				lat := *data.Latitude
-				lng := *data.Longitude
-				if lat != 0 && lng != 0 && lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 {
-					locationData = &data
-					hasLocationData = true
-					break
-				}
-			}
-		}
-	}
+	locationData := latestValidLocation(imei)
+	hasLocationData := locationData != nil
 
 	// Calculate vehicle statistics for today
-	today := time.Now()
-	startOfDay := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
-
-	var todayData []models.GPSData
-	db.GetDB().Where("imei = ? AND timestamp >= ?", imei, startOfDay).
-		Order("timestamp ASC").Find(&todayData)
-
-	stats := utc.calculateVehicleStats(todayData, userVehicle.Vehicle.Overspeed)
+	stats := utc.calculateVehicleStats(todayGPSData(imei), userVehicle.Vehicle.Overspeed)
 
 	response := gin.H{
 		"success": true,
@@ -241,27 +541,19 @@ func (utc *UserTrackingController) GetMyVehicleLocation(c *gin.Context) {
 		return // Error already sent in response
 	}
 
-	// Get latest valid location data with historical fallback
-	var allGPSData []models.GPSData
-	if err := db.GetDB().Where("imei = ?", imei).
-		Order("timestamp DESC").Limit(100).Find(&allGPSData).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "No GPS data found for this vehicle",
-		})
+	geoJSON, ok := wantsGeoJSON(c)
+	if !ok {
 		return
 	}
 
-	var locationData *models.GPSData
-	for _, data := range allGPSData {
-		if data.Latitude != nil && data.Longitude != nil {
-			lat := *data.Latitude
-			lng := *data.Longitude
-			if lat != 0 && lng != 0 && lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 {
-				locationData = &data
-				break
-			}
-		}
+	// Latest valid location, which may be older than the latest status-only packet
+	_, locationData, err := services.GetLatestGPSCache().Latest(imei)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch location data",
+		})
+		return
 	}
 
 	if locationData == nil {
@@ -272,14 +564,34 @@ func (utc *UserTrackingController) GetMyVehicleLocation(c *gin.Context) {
 		return
 	}
 
+	data := map[string]interface{}{
+		"imei":        imei,
+		"vehicle":     userVehicle.Vehicle,
+		"permissions": userVehicle.GetPermissions(),
+		"location":    locationData,
+	}
+
+	// Optionally enrich with a human-readable address
+	if c.Query("include_address") == "true" {
+		data["address"] = utc.resolveAddress(locationData.Latitude, locationData.Longitude)
+	}
+
+	if geoJSON {
+		properties := map[string]interface{}{
+			"name":   userVehicle.Vehicle.Name,
+			"reg_no": userVehicle.Vehicle.RegNo,
+		}
+		if address, exists := data["address"]; exists {
+			properties["address"] = address
+		}
+		position, _ := services.PositionFeature(locationData, properties)
+		respondGeoJSON(c, services.NewFeatureCollection([]services.GeoJSONFeature{position}))
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data": map[string]interface{}{
-			"imei":        imei,
-			"vehicle":     userVehicle.Vehicle,
-			"permissions": userVehicle.GetPermissions(),
-			"location":    locationData,
-		},
+		"data":    data,
 		"message": "Vehicle location retrieved successfully",
 	})
 }
@@ -301,9 +613,15 @@ func (utc *UserTrackingController) GetMyVehicleStatus(c *gin.Context) {
 	}
 
 	// Get latest GPS data for status
-	var latestGPS models.GPSData
-	if err := db.GetDB().Where("imei = ?", imei).
-		Order("timestamp DESC").First(&latestGPS).Error; err != nil {
+	latestGPS, _, err := services.GetLatestGPSCache().Latest(imei)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch status data",
+		})
+		return
+	}
+	if latestGPS == nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"error":   "No status data found for this vehicle",
@@ -323,8 +641,9 @@ func (utc *UserTrackingController) GetMyVehicleStatus(c *gin.Context) {
 	})
 }
 
-// GetMyVehicleHistory returns GPS history for user's vehicle
-func (utc *UserTrackingController) GetMyVehicleHistory(c *gin.Context) {
+// GetMyVehicleOnlineStatus returns a lightweight online/offline status for user's vehicle
+// It avoids loading device and permission data so it can be polled frequently
+func (utc *UserTrackingController) GetMyVehicleOnlineStatus(c *gin.Context) {
 	imei := c.Param("imei")
 	if len(imei) != 16 {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -334,33 +653,680 @@ func (utc *UserTrackingController) GetMyVehicleHistory(c *gin.Context) {
 		return
 	}
 
-	userVehicle, err := utc.validateUserVehicleAccess(c, imei, models.PermissionHistory)
-	if err != nil {
-		return // Error already sent in response
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "User not authenticated",
+		})
+		return
 	}
 
-	// Parse time filters
-	query := db.GetDB().Where("imei = ?", imei)
+	var accessCount int64
+	if err := db.GetDB().Model(&models.UserVehicle{}).
+		Where("user_id = ? AND vehicle_id = ? AND is_active = ? AND (expires_at IS NULL OR expires_at > ?)",
+			userID, imei, true, time.Now()).
+		Count(&accessCount).Error; err != nil || accessCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not found or access denied",
+		})
+		return
+	}
 
-	if from := c.Query("from"); from != "" {
-		if fromTime, err := time.Parse("2006-01-02T15:04:05Z", from); err == nil {
-			query = query.Where("timestamp >= ?", fromTime)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    utc.onlineStatus(imei),
+	})
+}
+
+// onlineStatus reports whether the device is online and when it was last seen
+func (utc *UserTrackingController) onlineStatus(imei string) gin.H {
+	tcpConnected := utc.controlController != nil && utc.controlController.IsConnected(imei)
+
+	var latestGPS models.GPSData
+	if err := db.GetReadDB().Select("timestamp").Where("imei = ?", imei).
+		Order("timestamp DESC").First(&latestGPS).Error; err != nil {
+		return gin.H{
+			"online":            tcpConnected,
+			"last_seen":         nil,
+			"connection_status": "no-data",
 		}
 	}
 
-	if to := c.Query("to"); to != "" {
-		if toTime, err := time.Parse("2006-01-02T15:04:05Z", to); err == nil {
-			query = query.Where("timestamp <= ?", toTime)
+	// Use the same freshness thresholds as the TCP server's device timeout monitor
+	sinceLastUpdate := time.Since(latestGPS.Timestamp)
+	connectionStatus := "inactive"
+	if sinceLastUpdate <= 5*time.Minute {
+		connectionStatus = "connected"
+	} else if sinceLastUpdate <= 30*time.Minute {
+		connectionStatus = "stopped"
+	}
+
+	return gin.H{
+		"online":            tcpConnected || connectionStatus == "connected",
+		"last_seen":         latestGPS.Timestamp,
+		"connection_status": connectionStatus,
+	}
+}
+
+// GetMyVehicleLiveSnapshot returns everything the vehicle detail view needs in one response:
+// latest status, latest valid location, today's statistics and trips, and online status
+func (utc *UserTrackingController) GetMyVehicleLiveSnapshot(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return
+	}
+
+	userVehicle, err := utc.validateUserVehicleAccess(c, imei, models.PermissionLiveTracking)
+	if err != nil {
+		return // Error already sent in response
+	}
+
+	todayData := todayGPSData(imei)
+
+	// Sections without data are null rather than missing so clients can rely on the shape
+	data := map[string]interface{}{
+		"imei":            imei,
+		"vehicle":         userVehicle.Vehicle,
+		"permissions":     userVehicle.GetPermissions(),
+		"user_role":       userVehicle.GetUserRole(),
+		"latest_status":   latestStatus(imei),
+		"latest_location": latestValidLocation(imei),
+		"today_stats":     utc.calculateVehicleStats(todayData, userVehicle.Vehicle.Overspeed),
+		"today_trips":     services.CountTrips(todayData, config.GetMovingSpeedKmh()),
+		"online_status":   utc.onlineStatus(imei),
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+		"message": "Vehicle live snapshot retrieved successfully",
+	})
+}
+
+// GetMyVehicleHistory returns GPS history for user's vehicle
+func (utc *UserTrackingController) GetMyVehicleHistory(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return
+	}
+
+	userVehicle, err := utc.validateUserVehicleAccess(c, imei, models.PermissionHistory)
+	if err != nil {
+		return // Error already sent in response
+	}
+
+	// Parse time filters. The range may span at most HISTORY_MAX_RANGE_DAYS; without from,
+	// the history starts that long before to (or now).
+	query := db.GetReadDB().Where("imei = ?", imei)
+
+	rangeEnd := time.Now()
+	if to := c.Query("to"); to != "" {
+		toTime, err := config.ParseTimestamp(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
+		}
+		query = query.Where("timestamp <= ?", toTime)
+		rangeEnd = toTime
+	}
+
+	if from := c.Query("from"); from != "" {
+		fromTime, err := config.ParseTimestamp(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
+		}
+		if !withinHistoryRange(c, fromTime, rangeEnd) {
+			return
+		}
+		query = query.Where("timestamp >= ?", fromTime)
+	} else if maxRange := config.GetHistoryMaxRange(); maxRange > 0 {
+		query = query.Where("timestamp >= ?", rangeEnd.Add(-maxRange))
+	}
+
+	// Get ALL GPS data for the date range (no pagination for history)
+	// Order by timestamp ASC (oldest first) for proper route plotting
+	var gpsData []models.GPSData
+	if err := query.Order("timestamp ASC").Find(&gpsData).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch GPS history",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": map[string]interface{}{
+			"imei":                imei,
+			"vehicle":             userVehicle.Vehicle,
+			"permissions":         userVehicle.GetPermissions(),
+			"history":             gpsData,
+			"count":               len(gpsData),
+			"overspeed_threshold": userVehicle.Vehicle.Overspeed, // Add overspeed threshold
+		},
+		"message": "Vehicle history retrieved successfully",
+	})
+
+	// Debug: Log the overspeed threshold being sent
+	colors.PrintInfo("Vehicle history response - IMEI: %s, Overspeed threshold: %d km/h", imei, userVehicle.Vehicle.Overspeed)
+}
+
+// GetMyVehicleRoute returns route data for user's vehicle
+func (utc *UserTrackingController) GetMyVehicleRoute(c *gin.Context) {
+	imei := c.Param("imei")
+	userVehicle, fromTime, toTime, ok := utc.routeRequest(c, imei)
+	if !ok {
+		return // Error already sent in response
+	}
+
+	// Optional line simplification for overview maps, tolerance in meters
+	var tolerance float64
+	if simplify := c.Query("simplify"); simplify != "" {
+		var err error
+		tolerance, err = strconv.ParseFloat(simplify, 64)
+		if err != nil || tolerance <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid simplify tolerance",
+				"message": "simplify must be a positive tolerance in meters",
+			})
+			return
+		}
+	}
+
+	geoJSON, ok := wantsGeoJSON(c)
+	if !ok {
+		return
+	}
+
+	gpsData, err := routeGPSData(imei, fromTime, toTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch GPS route data",
+		})
+		return
+	}
+
+	// Create route points
+	routePoints := make([]gin.H, len(gpsData))
+	altitudes := make([]*int, len(gpsData))
+	for i, data := range gpsData {
+		routePoints[i] = gin.H{
+			"latitude":  data.Latitude,
+			"longitude": data.Longitude,
+			"altitude":  data.Altitude,
+			"timestamp": data.Timestamp,
+			"speed":     data.Speed,
+			"course":    data.Course,
+			"ignition":  data.Ignition,
+		}
+		altitudes[i] = data.Altitude
+	}
+
+	// Calculate route statistics, including elevation for hilly terrain
+	stats := utc.calculateVehicleStats(gpsData, userVehicle.Vehicle.Overspeed)
+	elevation := utils.CalculateElevationStats(altitudes)
+	stats["elevation_gain"] = elevation.Gain
+	stats["elevation_loss"] = elevation.Loss
+	stats["min_altitude"] = elevation.Min
+	stats["max_altitude"] = elevation.Max
+
+	// Statistics above use every fix; only the returned points are simplified
+	originalPoints := len(routePoints)
+	routeData := gpsData
+	if tolerance > 0 {
+		path := make([]utils.Point, len(gpsData))
+		for i, data := range gpsData {
+			path[i] = utils.Point{Lat: *data.Latitude, Lng: *data.Longitude}
+		}
+		kept := utils.SimplifyPath(path, tolerance)
+		simplified := make([]gin.H, len(kept))
+		routeData = make([]models.GPSData, len(kept))
+		for i, index := range kept {
+			simplified[i] = routePoints[index]
+			routeData[i] = gpsData[index]
+		}
+		routePoints = simplified
+	}
+
+	if geoJSON {
+		route := services.RouteFeature(routeData, map[string]interface{}{
+			"imei":       imei,
+			"name":       userVehicle.Vehicle.Name,
+			"reg_no":     userVehicle.Vehicle.RegNo,
+			"from":       config.FormatTimestamp(fromTime),
+			"to":         config.FormatTimestamp(toTime),
+			"statistics": stats,
+		})
+		respondGeoJSON(c, services.NewFeatureCollection([]services.GeoJSONFeature{route}))
+		return
+	}
+
+	data := map[string]interface{}{
+		"imei":         imei,
+		"vehicle":      userVehicle.Vehicle,
+		"permissions":  userVehicle.GetPermissions(),
+		"from":         fromTime,
+		"to":           toTime,
+		"route":        routePoints,
+		"total_points": len(routePoints),
+		"statistics":   stats,
+	}
+	if tolerance > 0 {
+		data["simplify_tolerance"] = tolerance
+		data["original_points"] = originalPoints
+		data["simplified_points"] = len(routePoints)
+	}
+
+	// Attribute the trip to the driver assigned for most of it
+	data["driver"] = nil
+	if len(gpsData) > 0 {
+		tripStart := gpsData[0].Timestamp
+		tripEnd := gpsData[len(gpsData)-1].Timestamp
+		assignments, err := services.GetVehicleAssignments([]string{imei}, tripStart, tripEnd)
+		if err != nil {
+			colors.PrintWarning("Failed to load driver assignments for %s: %v", imei, err)
+		} else if assignment := services.AttributeTrip(assignments[imei], tripStart, tripEnd); assignment != nil {
+			data["driver"] = assignment.Driver
+		}
+	}
+
+	// Optionally enrich the trip start and end points with addresses
+	if c.Query("include_address") == "true" && len(gpsData) > 0 {
+		first := gpsData[0]
+		last := gpsData[len(gpsData)-1]
+		data["start_address"] = utc.resolveAddress(first.Latitude, first.Longitude)
+		data["end_address"] = utc.resolveAddress(last.Latitude, last.Longitude)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+		"message": "Vehicle route retrieved successfully",
+	})
+}
+
+// GetMyVehicleRouteGPX exports the route of user's vehicle as a GPX 1.1 track, for mapping tools
+func (utc *UserTrackingController) GetMyVehicleRouteGPX(c *gin.Context) {
+	imei := c.Param("imei")
+	userVehicle, fromTime, toTime, ok := utc.routeExportRequest(c, imei)
+	if !ok {
+		return // Error already sent in response
+	}
+
+	gpsData, err := routeGPSData(imei, fromTime, toTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch GPS route data",
+		})
+		return
+	}
+
+	gpx, err := services.RouteGPX(routeExportName(&userVehicle.Vehicle), gpsData, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to build GPX route",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, routeFilename(imei, fromTime, toTime, "gpx")))
+	c.Data(http.StatusOK, services.GPXContentType, gpx)
+}
+
+// GetMyVehicleRouteKML exports the route of user's vehicle as KML for Google Earth, with a
+// placemark for each stop along it
+func (utc *UserTrackingController) GetMyVehicleRouteKML(c *gin.Context) {
+	imei := c.Param("imei")
+	userVehicle, fromTime, toTime, ok := utc.routeExportRequest(c, imei)
+	if !ok {
+		return // Error already sent in response
+	}
+
+	gpsData, err := routeGPSData(imei, fromTime, toTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch GPS route data",
+		})
+		return
+	}
+
+	stops := services.FindRouteStops(gpsData, config.GetMovingSpeedKmh(), services.MinRouteStopDuration)
+	kml, err := services.RouteKML(routeExportName(&userVehicle.Vehicle), gpsData, stops)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to build KML route",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, routeFilename(imei, fromTime, toTime, "kml")))
+	c.Data(http.StatusOK, services.KMLContentType, kml)
+}
+
+// routeRequest validates the IMEI, the user's history permission and the from/to range of a
+// route request, which may span at most HISTORY_MAX_RANGE_DAYS. When ok is false the error
+// response has already been sent.
+func (utc *UserTrackingController) routeRequest(c *gin.Context, imei string) (userVehicle *models.UserVehicle, fromTime, toTime time.Time, ok bool) {
+	userVehicle, fromTime, toTime, ok = utc.routeExportRequest(c, imei)
+	if !ok || !withinHistoryRange(c, fromTime, toTime) {
+		return nil, time.Time{}, time.Time{}, false
+	}
+	return userVehicle, fromTime, toTime, true
+}
+
+// routeExportRequest is routeRequest without the HISTORY_MAX_RANGE_DAYS limit, for the
+// GPX and KML exports, which may cover longer periods
+func (utc *UserTrackingController) routeExportRequest(c *gin.Context, imei string) (userVehicle *models.UserVehicle, fromTime, toTime time.Time, ok bool) {
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	userVehicle, err := utc.validateUserVehicleAccess(c, imei, models.PermissionHistory)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, false // Error already sent in response
+	}
+
+	from := c.Query("from")
+	to := c.Query("to")
+
+	if from == "" || to == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "from and to query parameters are required",
+		})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	fromTime, err = config.ParseTimestamp(from)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	toTime, err = config.ParseTimestamp(to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	return userVehicle, fromTime, toTime, true
+}
+
+// withinHistoryRange reports whether from and to are at most HISTORY_MAX_RANGE_DAYS apart.
+// When they are not, the 400 response explaining the limit has already been sent.
+func withinHistoryRange(c *gin.Context, fromTime, toTime time.Time) bool {
+	maxRange := config.GetHistoryMaxRange()
+	if maxRange == 0 || toTime.Sub(fromTime) <= maxRange {
+		return true
+	}
+
+	maxDays := int(maxRange / (24 * time.Hour))
+	c.JSON(http.StatusBadRequest, gin.H{
+		"success": false,
+		"error":   "Time range too long",
+		"message": fmt.Sprintf("from and to may be at most %d days apart. Request shorter ranges, "+
+			"or export the route as GPX or KML for longer periods.", maxDays),
+		"max_range_days": maxDays,
+	})
+	return false
+}
+
+// routeGPSData reads the positioned fixes of a route, oldest first
+func routeGPSData(imei string, fromTime, toTime time.Time) ([]models.GPSData, error) {
+	var gpsData []models.GPSData
+	err := db.GetReadDB().Where("imei = ? AND timestamp BETWEEN ? AND ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND speed IS NOT NULL",
+		imei, fromTime, toTime).Order("timestamp ASC").Find(&gpsData).Error
+	return gpsData, err
+}
+
+// wantsGeoJSON reads the format query parameter: json, the default, or geojson for a bare
+// GeoJSON FeatureCollection. When ok is false the error response has already been sent.
+func wantsGeoJSON(c *gin.Context) (geoJSON, ok bool) {
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		return false, true
+	case "geojson":
+		return true, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"success": false,
+		"error":   "format must be json or geojson",
+	})
+	return false, false
+}
+
+// respondGeoJSON sends a FeatureCollection as is, without the success/data envelope, so
+// mapping libraries can load the response directly
+func respondGeoJSON(c *gin.Context, collection services.GeoJSONFeatureCollection) {
+	c.Header("Content-Type", services.GeoJSONContentType)
+	c.JSON(http.StatusOK, collection)
+}
+
+// routeExportName titles an exported route with the vehicle's name and registration
+func routeExportName(vehicle *models.Vehicle) string {
+	if vehicle.RegNo == "" {
+		return vehicle.Name
+	}
+	return fmt.Sprintf("%s (%s)", vehicle.Name, vehicle.RegNo)
+}
+
+// routeFilename names a route export after the vehicle and the period it covers
+func routeFilename(imei string, fromTime, toTime time.Time, extension string) string {
+	const layout = "20060102-1504"
+	return fmt.Sprintf("%s_%s_%s.%s", imei, fromTime.Format(layout), toTime.Format(layout), extension)
+}
+
+// GetMyVehicleTimeline returns one merged point per second for playback, with
+// status-only seconds carrying the last known position
+func (utc *UserTrackingController) GetMyVehicleTimeline(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return
+	}
+
+	userVehicle, err := utc.validateUserVehicleAccess(c, imei, models.PermissionHistory)
+	if err != nil {
+		return // Error already sent in response
+	}
+
+	from := c.Query("from")
+	to := c.Query("to")
+
+	if from == "" || to == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "from and to query parameters are required",
+		})
+		return
+	}
+
+	fromTime, err := config.ParseTimestamp(from)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return
+	}
+
+	toTime, err := config.ParseTimestamp(to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return
+	}
+
+	if toTime.Before(fromTime) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "to must not be before from",
+		})
+		return
+	}
+
+	var gpsData []models.GPSData
+	if err := db.GetReadDB().Where("imei = ? AND timestamp BETWEEN ? AND ?", imei, fromTime, toTime).
+		Order("timestamp ASC, id ASC").Find(&gpsData).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch GPS timeline data",
+		})
+		return
+	}
+
+	// Seed the forward fill with the last fix before the range, so the first
+	// status-only seconds still have a position
+	var previousFix *models.GPSData
+	var lastFix models.GPSData
+	if err := db.GetReadDB().Where("imei = ? AND timestamp < ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND latitude != 0 AND longitude != 0",
+		imei, fromTime).Order("timestamp DESC").First(&lastFix).Error; err == nil {
+		previousFix = &lastFix
+	}
+
+	timeline := services.BuildTimeline(gpsData, previousFix)
+
+	interpolated := 0
+	for _, point := range timeline {
+		if point.Interpolated {
+			interpolated++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": map[string]interface{}{
+			"imei":               imei,
+			"vehicle":            userVehicle.Vehicle,
+			"from":               fromTime,
+			"to":                 toTime,
+			"timeline":           timeline,
+			"total_points":       len(timeline),
+			"interpolated_count": interpolated,
+		},
+		"message": "Vehicle timeline retrieved successfully",
+	})
+}
+
+// GetMyVehicleCoverage reports how much of a period the device reported in: the period is
+// split into buckets of ?expected_interval= (e.g. 30s, 5m or a number of seconds) and the
+// buckets with at least one packet are counted, with the empty runs listed as gaps
+func (utc *UserTrackingController) GetMyVehicleCoverage(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return
+	}
+
+	userVehicle, err := utc.validateUserVehicleAccess(c, imei, models.PermissionHistory)
+	if err != nil {
+		return // Error already sent in response
+	}
+
+	from := c.Query("from")
+	to := c.Query("to")
+
+	if from == "" || to == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "from and to query parameters are required",
+		})
+		return
+	}
+
+	fromTime, err := config.ParseTimestamp(from)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return
+	}
+
+	toTime, err := config.ParseTimestamp(to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return
+	}
+
+	if !toTime.After(fromTime) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "to must be after from",
+		})
+		return
+	}
+
+	interval := services.DefaultCoverageInterval
+	if value := c.Query("expected_interval"); value != "" {
+		if interval, err = parseExpectedInterval(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "expected_interval must be a duration such as 30s or 5m, or a number of seconds, of at least 1s",
+			})
+			return
 		}
 	}
 
-	// Get ALL GPS data for the date range (no pagination for history)
-	// Order by timestamp ASC (oldest first) for proper route plotting
-	var gpsData []models.GPSData
-	if err := query.Order("timestamp ASC").Find(&gpsData).Error; err != nil {
+	if services.CoverageBucketCount(fromTime, toTime, interval) > services.MaxCoverageBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("The period holds more than %d expected intervals; shorten it or use a longer interval", services.MaxCoverageBuckets),
+		})
+		return
+	}
+
+	var timestamps []time.Time
+	if err := db.GetReadDB().Model(&models.GPSData{}).
+		Where("imei = ? AND timestamp >= ? AND timestamp < ?", imei, fromTime, toTime).
+		Pluck("timestamp", &timestamps).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"error":   "Failed to fetch GPS history",
+			"error":   "Failed to fetch GPS data",
 		})
 		return
 	}
@@ -368,104 +1334,209 @@ func (utc *UserTrackingController) GetMyVehicleHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": map[string]interface{}{
-			"imei":                imei,
-			"vehicle":             userVehicle.Vehicle,
-			"permissions":         userVehicle.GetPermissions(),
-			"history":             gpsData,
-			"count":               len(gpsData),
-			"overspeed_threshold": userVehicle.Vehicle.Overspeed, // Add overspeed threshold
+			"imei":     imei,
+			"vehicle":  userVehicle.Vehicle,
+			"coverage": services.CalculateCoverage(timestamps, fromTime, toTime, interval),
 		},
-		"message": "Vehicle history retrieved successfully",
+		"message": "Vehicle coverage retrieved successfully",
 	})
+}
 
-	// Debug: Log the overspeed threshold being sent
-	colors.PrintInfo("Vehicle history response - IMEI: %s, Overspeed threshold: %d km/h", imei, userVehicle.Vehicle.Overspeed)
+// parseExpectedInterval reads a Go duration such as "30s" or a plain number of seconds
+func parseExpectedInterval(value string) (time.Duration, error) {
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, err
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	if interval < time.Second {
+		return 0, fmt.Errorf("expected interval %v is shorter than 1s", interval)
+	}
+	return interval, nil
 }
 
-// GetMyVehicleRoute returns route data for user's vehicle
-func (utc *UserTrackingController) GetMyVehicleRoute(c *gin.Context) {
+// GetMyVehicleHeatmap buckets the vehicle's fixes between from and to into a grid and returns
+// the visited cells with their weights, for heatmap rendering. cell_size is in meters
+// (default 200); weight is points, the number of fixes, or time, the seconds spent there.
+func (utc *UserTrackingController) GetMyVehicleHeatmap(c *gin.Context) {
 	imei := c.Param("imei")
-	if len(imei) != 16 {
+	_, fromTime, toTime, ok := utc.routeRequest(c, imei)
+	if !ok {
+		return // Error already sent in response
+	}
+
+	cellMeters := services.DefaultHeatmapCellMeters
+	if value := c.Query("cell_size"); value != "" {
+		size, err := strconv.ParseFloat(value, 64)
+		if err != nil || size < services.MinHeatmapCellMeters || size > services.MaxHeatmapCellMeters {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": fmt.Sprintf("cell_size must be between %.0f and %.0f meters",
+					services.MinHeatmapCellMeters, services.MaxHeatmapCellMeters),
+			})
+			return
+		}
+		cellMeters = size
+	}
+
+	weight := c.DefaultQuery("weight", services.HeatmapWeightPoints)
+	if !services.IsValidHeatmapWeight(weight) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Invalid IMEI format",
+			"error":   "weight must be points or time",
 		})
 		return
 	}
 
-	userVehicle, err := utc.validateUserVehicleAccess(c, imei, models.PermissionHistory)
-	if err != nil {
-		return // Error already sent in response
+	// Status-only rows are read too, so time parked without a fix counts toward its cell
+	var gpsData []models.GPSData
+	if err := db.GetReadDB().Select("latitude, longitude, timestamp").
+		Where("imei = ? AND timestamp BETWEEN ? AND ?", imei, fromTime, toTime).
+		Order("timestamp ASC").Find(&gpsData).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch GPS data",
+		})
+		return
 	}
 
-	from := c.Query("from")
-	to := c.Query("to")
+	cells := services.BuildHeatmap(gpsData, cellMeters, weight, services.HeatmapMaxGap)
+	maxWeight := 0.0
+	if len(cells) > 0 {
+		maxWeight = cells[0].Weight
+	}
 
-	if from == "" || to == "" {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"imei":             imei,
+			"from":             fromTime,
+			"to":               toTime,
+			"cell_size_meters": cellMeters,
+			"weight":           weight,
+			"max_weight":       maxWeight,
+			"cells":            cells,
+			"total_cells":      len(cells),
+		},
+		"message": "Vehicle heatmap retrieved successfully",
+	})
+}
+
+// GetMyVehicleDrivingEvents lists the harsh braking and acceleration events of the vehicle
+// between from and to, optionally only one type (?type=harsh_braking or harsh_acceleration)
+func (utc *UserTrackingController) GetMyVehicleDrivingEvents(c *gin.Context) {
+	imei := c.Param("imei")
+	_, fromTime, toTime, ok := utc.routeRequest(c, imei)
+	if !ok {
+		return // Error already sent in response
+	}
+
+	eventType := c.Query("type")
+	if eventType != "" && !models.IsValidDrivingEventType(eventType) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "from and to query parameters are required",
+			"error":   "Invalid type",
+			"message": fmt.Sprintf("type must be %s or %s", models.DrivingEventHarshBraking, models.DrivingEventHarshAcceleration),
 		})
 		return
 	}
 
-	fromTime, err := time.Parse("2006-01-02T15:04:05Z", from)
+	events, err := services.GetDrivingEvents(imei, fromTime, toTime, eventType)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch driving events",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"imei":   imei,
+			"from":   fromTime,
+			"to":     toTime,
+			"events": events,
+			"counts": services.CountDrivingEvents(events),
+		},
+		"count":   len(events),
+		"message": "Vehicle driving events retrieved successfully",
+	})
+}
+
+// GetMyVehicleETA estimates when the vehicle reaches a destination, e.g. ?lat=27.7172&lng=85.3240.
+// The estimate uses straight-line distance, so it is only a rough guide.
+func (utc *UserTrackingController) GetMyVehicleETA(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Invalid from time format. Use: 2006-01-02T15:04:05Z",
+			"error":   "Invalid IMEI format",
 		})
 		return
 	}
 
-	toTime, err := time.Parse("2006-01-02T15:04:05Z", to)
-	if err != nil {
+	lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(c.Query("lng"), 64)
+	if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Invalid to time format. Use: 2006-01-02T15:04:05Z",
+			"error":   "Invalid coordinates",
+			"message": "lat and lng are required, with lat between -90 and 90 and lng between -180 and 180",
 		})
 		return
 	}
 
-	var gpsData []models.GPSData
-	if err := db.GetDB().Where("imei = ? AND timestamp BETWEEN ? AND ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND speed IS NOT NULL",
-		imei, fromTime, toTime).Order("timestamp ASC").Find(&gpsData).Error; err != nil {
+	userVehicle, err := utc.validateUserVehicleAccess(c, imei, models.PermissionLiveTracking)
+	if err != nil {
+		return // Error already sent in response
+	}
+
+	// Latest valid fix, looking back over the most recent rows as GetMyVehicleTracking does
+	var currentFix *models.GPSData
+	var latestRows []models.GPSData
+	if err := db.GetReadDB().Where("imei = ?", imei).
+		Order("timestamp DESC").Limit(100).Find(&latestRows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"error":   "Failed to fetch GPS route data",
+			"error":   "Failed to fetch location data",
 		})
 		return
 	}
-
-	// Create route points
-	routePoints := make([]gin.H, len(gpsData))
-	for i, data := range gpsData {
-		routePoints[i] = gin.H{
-			"latitude":  data.Latitude,
-			"longitude": data.Longitude,
-			"timestamp": data.Timestamp,
-			"speed":     data.Speed,
-			"course":    data.Course,
-			"ignition":  data.Ignition,
+	for i := range latestRows {
+		if services.HasValidFix(&latestRows[i]) {
+			currentFix = &latestRows[i]
+			break
 		}
 	}
+	if currentFix == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "No location data available for this vehicle",
+		})
+		return
+	}
 
-	// Calculate route statistics
-	stats := utc.calculateVehicleStats(gpsData, userVehicle.Vehicle.Overspeed)
+	var recent []models.GPSData
+	db.GetReadDB().Where("imei = ? AND timestamp >= ? AND latitude IS NOT NULL AND longitude IS NOT NULL",
+		imei, currentFix.Timestamp.Add(-services.ETARecentWindow)).
+		Order("timestamp ASC").Find(&recent)
+
+	estimate := services.EstimateETA(*currentFix, recent, userVehicle.Vehicle.VehicleType, lat, lng, time.Now())
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": map[string]interface{}{
-			"imei":         imei,
-			"vehicle":      userVehicle.Vehicle,
-			"permissions":  userVehicle.GetPermissions(),
-			"from":         fromTime,
-			"to":           toTime,
-			"route":        routePoints,
-			"total_points": len(routePoints),
-			"statistics":   stats,
+			"imei":        imei,
+			"vehicle":     userVehicle.Vehicle,
+			"location":    currentFix,
+			"destination": gin.H{"latitude": lat, "longitude": lng},
+			"eta":         estimate,
 		},
-		"message": "Vehicle route retrieved successfully",
+		"message": "Estimate only: straight-line distance at a constant speed, ignoring roads and traffic",
 	})
 }
 
@@ -482,11 +1553,28 @@ func (utc *UserTrackingController) GetMyVehicleReports(c *gin.Context) {
 	user := currentUser.(*models.User)
 
 	// Parse date range
-	from := c.DefaultQuery("from", time.Now().AddDate(0, 0, -7).Format("2006-01-02T15:04:05Z"))
-	to := c.DefaultQuery("to", time.Now().Format("2006-01-02T15:04:05Z"))
+	from := c.DefaultQuery("from", config.FormatTimestamp(time.Now().AddDate(0, 0, -7)))
+	to := c.DefaultQuery("to", config.FormatTimestamp(time.Now()))
 
-	fromTime, _ := time.Parse("2006-01-02T15:04:05Z", from)
-	toTime, _ := time.Parse("2006-01-02T15:04:05Z", to)
+	fromTime, err := config.ParseTimestamp(from)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return
+	}
+	toTime, err := config.ParseTimestamp(to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+		})
+		return
+	}
+	if !withinHistoryRange(c, fromTime, toTime) {
+		return
+	}
 
 	// Get user's vehicles with report permission
 	var userVehicles []models.UserVehicle
@@ -499,6 +1587,33 @@ func (utc *UserTrackingController) GetMyVehicleReports(c *gin.Context) {
 		return
 	}
 
+	// Optional driver filter: only the time each vehicle was driven by this driver is reported
+	var driverID uint
+	if value := c.Query("driver_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid driver_id",
+			})
+			return
+		}
+		driverID = uint(id)
+	}
+
+	var imeis []string
+	for _, userVehicle := range userVehicles {
+		imeis = append(imeis, userVehicle.VehicleID)
+	}
+	assignments, err := services.GetVehicleAssignments(imeis, fromTime, toTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch driver assignments",
+		})
+		return
+	}
+
 	var reportData []map[string]interface{}
 
 	for _, userVehicle := range userVehicles {
@@ -506,15 +1621,34 @@ func (utc *UserTrackingController) GetMyVehicleReports(c *gin.Context) {
 			continue
 		}
 
+		vehicleAssignments := assignments[userVehicle.Vehicle.IMEI]
+		if driverID != 0 && !hasDriverAssignment(vehicleAssignments, driverID) {
+			continue
+		}
+
 		// Get GPS data for the date range
 		var gpsData []models.GPSData
-		if err := db.GetDB().Where("imei = ? AND timestamp BETWEEN ? AND ?",
+		if err := db.GetReadDB().Where("imei = ? AND timestamp BETWEEN ? AND ?",
 			userVehicle.Vehicle.IMEI, fromTime, toTime).Order("timestamp ASC").Find(&gpsData).Error; err != nil {
 			continue
 		}
+		if driverID != 0 {
+			gpsData = services.FilterByDriver(gpsData, vehicleAssignments, driverID)
+		}
 
 		stats := utc.calculateVehicleStats(gpsData, userVehicle.Vehicle.Overspeed)
 
+		// Everyone who drove the vehicle in the range, once each
+		drivers := make([]models.Driver, 0, len(vehicleAssignments))
+		seenDrivers := make(map[uint]bool)
+		for _, assignment := range vehicleAssignments {
+			if seenDrivers[assignment.DriverID] || (driverID != 0 && assignment.DriverID != driverID) {
+				continue
+			}
+			seenDrivers[assignment.DriverID] = true
+			drivers = append(drivers, assignment.Driver)
+		}
+
 		vehicleReport := map[string]interface{}{
 			"imei":         userVehicle.Vehicle.IMEI,
 			"reg_no":       userVehicle.Vehicle.RegNo,
@@ -524,6 +1658,7 @@ func (utc *UserTrackingController) GetMyVehicleReports(c *gin.Context) {
 			"from":         fromTime,
 			"to":           toTime,
 			"statistics":   stats,
+			"drivers":      drivers,
 		}
 
 		reportData = append(reportData, vehicleReport)
@@ -539,6 +1674,163 @@ func (utc *UserTrackingController) GetMyVehicleReports(c *gin.Context) {
 	})
 }
 
+// maxComparedVehicles bounds how many vehicles one comparison may read history for
+const maxComparedVehicles = 5
+
+// CompareMyVehicles returns the statistics of 2 to 5 of the user's vehicles over the same
+// range side by side, e.g. ?imeis=a,b&from=&to= (default the last 7 days). Each statistic
+// lists one value per vehicle in the order of imeis.
+func (utc *UserTrackingController) CompareMyVehicles(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "User not authenticated"})
+		return
+	}
+	user := currentUser.(*models.User)
+
+	var imeis []string
+	seen := make(map[string]bool)
+	for _, imei := range strings.Split(c.Query("imeis"), ",") {
+		imei = strings.TrimSpace(imei)
+		if imei == "" || seen[imei] {
+			continue
+		}
+		if len(imei) != 16 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid IMEI format",
+				"imei":    imei,
+			})
+			return
+		}
+		seen[imei] = true
+		imeis = append(imeis, imei)
+	}
+	if len(imeis) < 2 || len(imeis) > maxComparedVehicles {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid imeis",
+			"message": fmt.Sprintf("imeis must list between 2 and %d different vehicles, separated by commas", maxComparedVehicles),
+		})
+		return
+	}
+
+	fromTime, toTime := time.Now().AddDate(0, 0, -7), time.Now()
+	var err error
+	if from := c.Query("from"); from != "" {
+		if fromTime, err = config.ParseTimestamp(from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid from time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if toTime, err = config.ParseTimestamp(to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid to time format. Use RFC 3339, e.g. 2006-01-02T15:04:05+05:45",
+			})
+			return
+		}
+	}
+	if !withinHistoryRange(c, fromTime, toTime) {
+		return
+	}
+
+	// Every vehicle must be one the user may see reports for
+	var userVehicles []models.UserVehicle
+	if err := db.GetDB().Where("user_id = ? AND vehicle_id IN ? AND is_active = ? AND (report = ? OR all_access = ?)",
+		user.ID, imeis, true, true, true).Preload("Vehicle").Find(&userVehicles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch user vehicles",
+		})
+		return
+	}
+	accessible := make(map[string]models.UserVehicle, len(userVehicles))
+	for _, userVehicle := range userVehicles {
+		if !userVehicle.IsExpired() {
+			accessible[userVehicle.VehicleID] = userVehicle
+		}
+	}
+
+	vehicles := make([]map[string]interface{}, 0, len(imeis))
+	comparison := make(map[string][]interface{})
+	for _, imei := range imeis {
+		userVehicle, ok := accessible[imei]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Vehicle not found or access denied",
+				"imei":    imei,
+			})
+			return
+		}
+
+		var gpsData []models.GPSData
+		if err := db.GetReadDB().Where("imei = ? AND timestamp BETWEEN ? AND ?",
+			imei, fromTime, toTime).Order("timestamp ASC").Find(&gpsData).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to fetch GPS data",
+			})
+			return
+		}
+
+		stats := utc.calculateVehicleStats(gpsData, userVehicle.Vehicle.Overspeed)
+		for name, value := range stats {
+			comparison[name] = append(comparison[name], value)
+		}
+		vehicles = append(vehicles, map[string]interface{}{
+			"imei":         imei,
+			"reg_no":       userVehicle.Vehicle.RegNo,
+			"name":         userVehicle.Vehicle.Name,
+			"vehicle_type": userVehicle.Vehicle.VehicleType,
+			"statistics":   stats,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": map[string]interface{}{
+			"from":       fromTime,
+			"to":         toTime,
+			"imeis":      imeis,
+			"vehicles":   vehicles,
+			"comparison": comparison,
+		},
+		"message": "Vehicle comparison retrieved successfully",
+	})
+}
+
+// hasDriverAssignment reports whether the driver appears in the assignments
+func hasDriverAssignment(assignments []models.VehicleDriverAssignment, driverID uint) bool {
+	for _, assignment := range assignments {
+		if assignment.DriverID == driverID {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAddress returns the address for the coordinates, or an empty string when unavailable
+func (utc *UserTrackingController) resolveAddress(lat, lng *float64) string {
+	if lat == nil || lng == nil {
+		return ""
+	}
+
+	address, err := utc.addressResolver.ReverseGeocode(*lat, *lng)
+	if err != nil {
+		if err != services.ErrGeocoderDisabled {
+			colors.PrintWarning("Failed to resolve address for %.6f,%.6f: %v", *lat, *lng, err)
+		}
+		return ""
+	}
+	return address
+}
+
 // Helper function to validate user vehicle access
 func (utc *UserTrackingController) validateUserVehicleAccess(c *gin.Context, imei string, permission models.Permission) (*models.UserVehicle, error) {
 	currentUser, exists := c.Get("user")
@@ -588,33 +1880,34 @@ func (utc *UserTrackingController) validateUserVehicleAccess(c *gin.Context, ime
 	return &userVehicle, nil
 }
 
-type vehicleState int
-
-const (
-	stateUnknown vehicleState = iota
-	stateOverspeed
-	stateRunning
-	stateIdle
-	stateStopped
-)
-
-func getVehicleState(data models.GPSData, overspeedThreshold int) vehicleState {
-	speed := 0
-	if data.Speed != nil {
-		speed = *data.Speed
+// latestStatus returns the device's most recent row, or nil when it has none
+func latestStatus(imei string) *models.GPSData {
+	status, _, err := services.GetLatestGPSCache().Latest(imei)
+	if err != nil {
+		return nil
 	}
-	ignitionOn := data.Ignition == "ON"
+	return status
+}
 
-	if speed > overspeedThreshold {
-		return stateOverspeed
-	}
-	if speed > 5 {
-		return stateRunning
-	}
-	if ignitionOn {
-		return stateIdle
+// latestValidLocation returns the device's newest row with a usable fix, so a vehicle
+// sending only status packets still has a position; nil when none has one
+func latestValidLocation(imei string) *models.GPSData {
+	_, location, err := services.GetLatestGPSCache().Latest(imei)
+	if err != nil {
+		return nil
 	}
-	return stateStopped
+	return location
+}
+
+// todayGPSData returns the device's rows since the start of today, oldest first
+func todayGPSData(imei string) []models.GPSData {
+	today := time.Now()
+	startOfDay := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+
+	var todayData []models.GPSData
+	db.GetReadDB().Where("imei = ? AND timestamp >= ?", imei, startOfDay).
+		Order("timestamp ASC").Find(&todayData)
+	return todayData
 }
 
 // Helper function to calculate vehicle statistics
@@ -640,18 +1933,13 @@ func (utc *UserTrackingController) calculateVehicleStats(gpsData []models.GPSDat
 
 	var totalIgnitionOnTime, movingTime, runningTime, overspeedTime, idleTime, stoppedTime time.Duration
 
-	// Calculate total distance and max speed first
+	// Calculate total distance, ignoring jitter while parked, and max speed first
+	movingSpeedKmh := config.GetMovingSpeedKmh()
+	totalDistance = services.TravelDistanceKm(gpsData, movingSpeedKmh)
 	for i := 0; i < len(gpsData); i++ {
 		if gpsData[i].Speed != nil && *gpsData[i].Speed > maxSpeed {
 			maxSpeed = *gpsData[i].Speed
 		}
-		if i > 0 {
-			p1 := gpsData[i-1]
-			p2 := gpsData[i]
-			if p1.Latitude != nil && p1.Longitude != nil && p2.Latitude != nil && p2.Longitude != nil {
-				totalDistance += utils.CalculateDistance(*p1.Latitude, *p1.Longitude, *p2.Latitude, *p2.Longitude)
-			}
-		}
 	}
 
 	// Calculate state durations
@@ -661,16 +1949,19 @@ func (utc *UserTrackingController) calculateVehicleStats(gpsData []models.GPSDat
 		duration := p2.Timestamp.Sub(p1.Timestamp)
 
 		// State is determined by the starting point of the interval
-		state := getVehicleState(p1, vehicleOverspeed)
+		speed := 0
+		if p1.Speed != nil {
+			speed = *p1.Speed
+		}
 
-		switch state {
-		case stateOverspeed:
+		switch services.DetermineVehicleState(speed, p1.Ignition, vehicleOverspeed, movingSpeedKmh) {
+		case services.VehicleStatusOverspeed:
 			overspeedTime += duration
-		case stateRunning:
+		case services.VehicleStatusRunning:
 			runningTime += duration
-		case stateIdle:
+		case services.VehicleStatusIdle:
 			idleTime += duration
-		case stateStopped:
+		case services.VehicleStatusStopped:
 			stoppedTime += duration
 		}
 
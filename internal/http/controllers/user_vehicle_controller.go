@@ -61,6 +61,8 @@ func (uvc *UserVehicleController) AssignVehicleToUser(c *gin.Context) {
 		return
 	}
 
+	defer recordAudit(c, models.AuditActionAccessAssign, "vehicle", req.VehicleID)
+
 	// Get the current user (who is granting access)
 	currentUser, exists := c.Get("user")
 	if !exists {
@@ -153,6 +155,8 @@ func (uvc *UserVehicleController) BulkAssignVehiclesToUser(c *gin.Context) {
 		return
 	}
 
+	defer recordAudit(c, models.AuditActionAccessBulkAssign, "user", strconv.FormatUint(uint64(req.UserID), 10))
+
 	// Get the current user (who is granting access)
 	currentUser, exists := c.Get("user")
 	if !exists {
@@ -234,6 +238,8 @@ func (uvc *UserVehicleController) BulkAssignVehiclesToUser(c *gin.Context) {
 
 // UpdateVehiclePermissions updates permissions for a user-vehicle relationship
 func (uvc *UserVehicleController) UpdateVehiclePermissions(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionAccessPermissions, "user_vehicle", c.Param("id"))
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -291,6 +297,8 @@ func (uvc *UserVehicleController) UpdateVehiclePermissions(c *gin.Context) {
 
 // RevokeVehicleAccess revokes a user's access to a vehicle
 func (uvc *UserVehicleController) RevokeVehicleAccess(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionAccessRevoke, "user_vehicle", c.Param("id"))
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -390,6 +398,8 @@ type SetMainUserRequest struct {
 
 // SetMainUser sets a user as the main user for a vehicle
 func (uvc *UserVehicleController) SetMainUser(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionAccessMainUser, "vehicle", c.Param("vehicle_id"))
+
 	vehicleID := c.Param("vehicle_id")
 	if len(vehicleID) != 16 {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -7,20 +7,28 @@ import (
 	"strings"
 	"time"
 
+	"luna_iot_server/config"
 	"luna_iot_server/internal/db"
 	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
 	"luna_iot_server/pkg/colors"
-	"luna_iot_server/pkg/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // VehicleController handles vehicle-related HTTP requests
-type VehicleController struct{}
+type VehicleController struct {
+	archiveService    *services.ArchiveService
+	controlController *ControlController // Connection registry for the ?status= filter; may be nil
+}
 
 // NewVehicleController creates a new vehicle controller
-func NewVehicleController() *VehicleController {
-	return &VehicleController{}
+func NewVehicleController(controlController *ControlController) *VehicleController {
+	return &VehicleController{
+		archiveService:    services.NewArchiveService(),
+		controlController: controlController,
+	}
 }
 
 // GetVehicles returns all vehicles with pagination and filtering
@@ -64,6 +72,32 @@ func (vc *VehicleController) GetVehicles(c *gin.Context) {
 			Where("user_vehicles.user_id = ? AND user_vehicles.is_active = ?", userId, true)
 	}
 
+	if status := c.Query("status"); status != "" {
+		if !services.IsValidConnectionStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "status must be one of online, offline, moving or idle",
+			})
+			return
+		}
+		var connected []string
+		if vc.controlController != nil {
+			connected = vc.controlController.ConnectedIMEIs()
+		}
+		query, _ = services.FilterVehiclesByConnectionStatus(query, status, connected, time.Now(), config.GetMovingSpeedKmh())
+	}
+
+	// Optional ?sort=field:dir[,field:dir], applied to the page query only since the count has no order
+	var order string
+	if sort := c.Query("sort"); sort != "" {
+		var err error
+		if order, err = services.ParseVehicleSort(sort); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
 	// Get total count for pagination
 	var totalCount int64
 	if err := query.Model(&models.Vehicle{}).Count(&totalCount).Error; err != nil {
@@ -74,8 +108,12 @@ func (vc *VehicleController) GetVehicles(c *gin.Context) {
 	}
 
 	// Get vehicles with pagination
+	pageQuery := query
+	if order != "" {
+		pageQuery = pageQuery.Order(order)
+	}
 	var vehicles []models.Vehicle
-	if err := query.Limit(limit).Offset(offset).Find(&vehicles).Error; err != nil {
+	if err := pageQuery.Limit(limit).Offset(offset).Find(&vehicles).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch vehicles",
 		})
@@ -120,21 +158,26 @@ func (vc *VehicleController) GetVehicles(c *gin.Context) {
 		}
 
 		vehicleInfo := map[string]interface{}{
-			"imei":              vehicle.IMEI,
-			"reg_no":            vehicle.RegNo,
-			"name":              vehicle.Name,
-			"vehicle_type":      vehicle.VehicleType,
-			"odometer":          vehicle.Odometer,
-			"mileage":           vehicle.Mileage,
-			"min_fuel":          vehicle.MinFuel,
-			"overspeed":         vehicle.Overspeed,
-			"created_at":        vehicle.CreatedAt,
-			"updated_at":        vehicle.UpdatedAt,
-			"device":            vehicle.Device,
-			"main_user_count":   mainUserCount,
-			"shared_user_count": sharedUserCount,
-			"total_user_count":  mainUserCount + sharedUserCount,
-			"main_user_name":    mainUserName,
+			"imei":                vehicle.IMEI,
+			"reg_no":              vehicle.RegNo,
+			"name":                vehicle.Name,
+			"vehicle_type":        vehicle.VehicleType,
+			"odometer":            vehicle.Odometer,
+			"engine_hours":        vehicle.EngineHours,
+			"color":               vehicle.Color,
+			"icon_type":           vehicle.IconType,
+			"allowed_hours_start": vehicle.AllowedHoursStart,
+			"allowed_hours_end":   vehicle.AllowedHoursEnd,
+			"mileage":             vehicle.Mileage,
+			"min_fuel":            vehicle.MinFuel,
+			"overspeed":           vehicle.Overspeed,
+			"created_at":          vehicle.CreatedAt,
+			"updated_at":          vehicle.UpdatedAt,
+			"device":              vehicle.Device,
+			"main_user_count":     mainUserCount,
+			"shared_user_count":   sharedUserCount,
+			"total_user_count":    mainUserCount + sharedUserCount,
+			"main_user_name":      mainUserName,
 		}
 
 		vehicleList = append(vehicleList, vehicleInfo)
@@ -154,6 +197,20 @@ func (vc *VehicleController) GetVehicles(c *gin.Context) {
 	})
 }
 
+// vehicleAppearanceError returns why the vehicle's color or icon type is invalid, or "" when both are fine
+func vehicleAppearanceError(vehicle *models.Vehicle) string {
+	if !models.IsValidVehicleColor(vehicle.Color) {
+		return "Color must be a hex color such as #1E88E5"
+	}
+	if !models.IsValidVehicleIconType(vehicle.IconType) {
+		return "Icon type must be up to 30 lowercase letters, digits, '_' or '-'"
+	}
+	return ""
+}
+
+// allowedHoursErrorMessage explains the allowed-hours format when it is invalid
+const allowedHoursErrorMessage = "Allowed hours must be two different HH:MM times, or both empty for no schedule"
+
 // Helper function to parse integer
 func parseInt(s string) int {
 	if i, err := strconv.Atoi(s); err == nil {
@@ -368,6 +425,20 @@ func (vc *VehicleController) CreateVehicle(c *gin.Context) {
 		return
 	}
 
+	if message := vehicleAppearanceError(&vehicle); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": message,
+		})
+		return
+	}
+
+	if !models.IsValidAllowedHours(vehicle.AllowedHoursStart, vehicle.AllowedHoursEnd) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": allowedHoursErrorMessage,
+		})
+		return
+	}
+
 	// Check if device exists
 	var device models.Device
 	if err := db.GetDB().Where("imei = ?", vehicle.IMEI).First(&device).Error; err != nil {
@@ -521,9 +592,25 @@ func (vc *VehicleController) UpdateVehicle(c *gin.Context) {
 		return
 	}
 
+	if message := vehicleAppearanceError(&updateData); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": message,
+		})
+		return
+	}
+
 	// Don't allow IMEI or registration number updates
 	updateData.IMEI = vehicle.IMEI
 	updateData.RegNo = vehicle.RegNo
+	// Calibration time is only set through the odometer endpoint
+	updateData.OdometerCalibratedAt = nil
+	// Engine hours are only changed by GPS processing and the engine-hours endpoint
+	updateData.EngineHours = 0
+	updateData.EngineHoursUpdatedAt = nil
+	updateData.EngineOn = false
+	// Allowed hours are only changed through the allowed-hours endpoint, which can also clear them
+	updateData.AllowedHoursStart = ""
+	updateData.AllowedHoursEnd = ""
 
 	if err := db.GetDB().Model(&vehicle).Updates(updateData).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -546,6 +633,8 @@ func (vc *VehicleController) UpdateVehicle(c *gin.Context) {
 
 // DeleteVehicle deletes a vehicle
 func (vc *VehicleController) DeleteVehicle(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionVehicleDelete, "vehicle", c.Param("imei"))
+
 	imei := c.Param("imei")
 	if len(imei) != 16 {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -562,6 +651,20 @@ func (vc *VehicleController) DeleteVehicle(c *gin.Context) {
 		return
 	}
 
+	// Optionally archive the vehicle (and its GPS history) before the irreversible delete
+	archivePath := ""
+	if c.Query("archive") == "true" {
+		path, err := vc.archiveService.ArchiveVehicles([]models.Vehicle{vehicle}, c.Query("include_gps") == "true", "admin vehicle delete")
+		if err != nil {
+			colors.PrintError("Failed to archive vehicle %s before delete: %v", imei, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to archive vehicle, nothing was deleted",
+			})
+			return
+		}
+		archivePath = path
+	}
+
 	// Start transaction to delete vehicle and all related user access
 	tx := db.GetDB().Begin()
 	defer func() {
@@ -596,9 +699,14 @@ func (vc *VehicleController) DeleteVehicle(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "Vehicle deleted successfully",
-	})
+	}
+	if archivePath != "" {
+		response["archive_path"] = archivePath
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // GetVehiclesByType returns vehicles filtered by type
@@ -630,7 +738,8 @@ func (vc *VehicleController) GetVehiclesByType(c *gin.Context) {
 
 // ===== CUSTOMER VEHICLE MANAGEMENT METHODS =====
 
-// GetMyVehicles returns vehicles accessible to the current user
+// GetMyVehicles returns vehicles accessible to the current user, optionally only
+// those in one of their groups (?group_id=)
 func (vc *VehicleController) GetMyVehicles(c *gin.Context) {
 	currentUser, exists := c.Get("user")
 	if !exists {
@@ -655,6 +764,12 @@ func (vc *VehicleController) GetMyVehicles(c *gin.Context) {
 		return
 	}
 
+	// Optional ?group_id= narrows the list to one of the user's vehicle groups
+	userVehicles, ok := groupFilter(c, user.ID, userVehicles)
+	if !ok {
+		return
+	}
+
 	if len(userVehicles) == 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -728,17 +843,8 @@ func (vc *VehicleController) GetMyVehicles(c *gin.Context) {
 		if err := db.GetDB().Where("imei = ? AND timestamp >= ? AND timestamp < ? AND latitude IS NOT NULL AND longitude IS NOT NULL AND speed IS NOT NULL",
 			imei, today, tomorrowStart).Order("timestamp ASC").Find(&todayGPSData).Error; err == nil {
 
-			var totalDistance float64
-			if len(todayGPSData) > 1 {
-				for i := 0; i < len(todayGPSData)-1; i++ {
-					p1 := todayGPSData[i]
-					p2 := todayGPSData[i+1]
-					if p1.Latitude != nil && p1.Longitude != nil && p2.Latitude != nil && p2.Longitude != nil {
-						distance := utils.CalculateDistance(*p1.Latitude, *p1.Longitude, *p2.Latitude, *p2.Longitude)
-						totalDistance += distance
-					}
-				}
-			}
+			// Jitter while parked is not counted as travel
+			totalDistance := services.TravelDistanceKm(todayGPSData, config.GetMovingSpeedKmh())
 
 			vehicleData["today_km"] = totalDistance
 
@@ -748,8 +854,13 @@ func (vc *VehicleController) GetMyVehicles(c *gin.Context) {
 			}
 		}
 
-		// 4. Calculate total odometer by adding today's distance to base odometer
-		vehicleData["total_odometer"] = userVehicle.Vehicle.Odometer + vehicleData["today_km"].(float64)
+		// 4. Calculate total odometer by adding distance travelled to the base odometer.
+		// A calibrated base accumulates everything since calibration, otherwise only today's distance.
+		if userVehicle.Vehicle.OdometerCalibratedAt != nil {
+			vehicleData["total_odometer"] = userVehicle.Vehicle.Odometer + services.DistanceSince(imei, *userVehicle.Vehicle.OdometerCalibratedAt)
+		} else {
+			vehicleData["total_odometer"] = userVehicle.Vehicle.Odometer + vehicleData["today_km"].(float64)
+		}
 
 		// 5. Determine last update and since duration
 		var mostRecentData *models.GPSData
@@ -918,6 +1029,22 @@ func (vc *VehicleController) CreateMyVehicle(c *gin.Context) {
 		return
 	}
 
+	if message := vehicleAppearanceError(&vehicle); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   message,
+		})
+		return
+	}
+
+	if !models.IsValidAllowedHours(vehicle.AllowedHoursStart, vehicle.AllowedHoursEnd) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   allowedHoursErrorMessage,
+		})
+		return
+	}
+
 	// Check if device exists
 	var device models.Device
 	if err := db.GetDB().Where("imei = ?", vehicle.IMEI).First(&device).Error; err != nil {
@@ -1024,20 +1151,24 @@ func (vc *VehicleController) CreateMyVehicle(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
 		"data": map[string]interface{}{
-			"imei":         vehicle.IMEI,
-			"reg_no":       vehicle.RegNo,
-			"name":         vehicle.Name,
-			"vehicle_type": vehicle.VehicleType,
-			"odometer":     vehicle.Odometer,
-			"mileage":      vehicle.Mileage,
-			"min_fuel":     vehicle.MinFuel,
-			"overspeed":    vehicle.Overspeed,
-			"created_at":   vehicle.CreatedAt,
-			"updated_at":   vehicle.UpdatedAt,
-			"device":       vehicle.Device,
-			"user_role":    "Main User",
-			"permissions":  []string{"all_access", "live_tracking", "history", "report", "vehicle_edit", "notification", "share_tracking"},
-			"is_main_user": true,
+			"imei":                vehicle.IMEI,
+			"reg_no":              vehicle.RegNo,
+			"name":                vehicle.Name,
+			"vehicle_type":        vehicle.VehicleType,
+			"odometer":            vehicle.Odometer,
+			"mileage":             vehicle.Mileage,
+			"min_fuel":            vehicle.MinFuel,
+			"overspeed":           vehicle.Overspeed,
+			"color":               vehicle.Color,
+			"icon_type":           vehicle.IconType,
+			"allowed_hours_start": vehicle.AllowedHoursStart,
+			"allowed_hours_end":   vehicle.AllowedHoursEnd,
+			"created_at":          vehicle.CreatedAt,
+			"updated_at":          vehicle.UpdatedAt,
+			"device":              vehicle.Device,
+			"user_role":           "Main User",
+			"permissions":         []string{"all_access", "live_tracking", "history", "report", "vehicle_edit", "notification", "share_tracking"},
+			"is_main_user":        true,
 		},
 		"message": "Vehicle created successfully",
 	})
@@ -1102,9 +1233,24 @@ func (vc *VehicleController) UpdateMyVehicle(c *gin.Context) {
 		return
 	}
 
+	if message := vehicleAppearanceError(&updateData); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   message,
+		})
+		return
+	}
+
 	// Don't allow IMEI or registration number updates
 	updateData.IMEI = vehicle.IMEI
 	updateData.RegNo = vehicle.RegNo
+	// Engine hours are only changed by GPS processing and the engine-hours endpoint
+	updateData.EngineHours = 0
+	updateData.EngineHoursUpdatedAt = nil
+	updateData.EngineOn = false
+	// Allowed hours are only changed through the allowed-hours endpoint, which can also clear them
+	updateData.AllowedHoursStart = ""
+	updateData.AllowedHoursEnd = ""
 
 	if err := db.GetDB().Model(&vehicle).Updates(updateData).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1123,27 +1269,321 @@ func (vc *VehicleController) UpdateMyVehicle(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": map[string]interface{}{
-			"imei":         vehicle.IMEI,
-			"reg_no":       vehicle.RegNo,
-			"name":         vehicle.Name,
-			"vehicle_type": vehicle.VehicleType,
-			"odometer":     vehicle.Odometer,
-			"mileage":      vehicle.Mileage,
-			"min_fuel":     vehicle.MinFuel,
-			"overspeed":    vehicle.Overspeed,
-			"created_at":   vehicle.CreatedAt,
-			"updated_at":   vehicle.UpdatedAt,
-			"device":       vehicle.Device,
-			"user_role":    userVehicle.GetUserRole(),
-			"permissions":  userVehicle.GetPermissions(),
-			"is_main_user": userVehicle.IsMainUser,
+			"imei":                vehicle.IMEI,
+			"reg_no":              vehicle.RegNo,
+			"name":                vehicle.Name,
+			"vehicle_type":        vehicle.VehicleType,
+			"odometer":            vehicle.Odometer,
+			"mileage":             vehicle.Mileage,
+			"min_fuel":            vehicle.MinFuel,
+			"overspeed":           vehicle.Overspeed,
+			"color":               vehicle.Color,
+			"icon_type":           vehicle.IconType,
+			"allowed_hours_start": vehicle.AllowedHoursStart,
+			"allowed_hours_end":   vehicle.AllowedHoursEnd,
+			"created_at":          vehicle.CreatedAt,
+			"updated_at":          vehicle.UpdatedAt,
+			"device":              vehicle.Device,
+			"user_role":           userVehicle.GetUserRole(),
+			"permissions":         userVehicle.GetPermissions(),
+			"is_main_user":        userVehicle.IsMainUser,
 		},
 		"message": "Vehicle updated successfully",
 	})
 }
 
+// OdometerCalibrationRequest represents the request body for calibrating a vehicle odometer
+type OdometerCalibrationRequest struct {
+	Odometer *float64 `json:"odometer" binding:"required"`
+}
+
+// CalibrateMyVehicleOdometer sets a new base odometer from the physical reading
+func (vc *VehicleController) CalibrateMyVehicleOdometer(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return
+	}
+
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "User not authenticated",
+		})
+		return
+	}
+	user := currentUser.(*models.User)
+
+	// Check if user has edit permission for this vehicle
+	var userVehicle models.UserVehicle
+	if err := db.GetDB().Where("user_id = ? AND vehicle_id = ? AND is_active = ?", user.ID, imei, true).
+		First(&userVehicle).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not found or access denied",
+		})
+		return
+	}
+
+	if userVehicle.IsExpired() || (!userVehicle.VehicleEdit && !userVehicle.AllAccess) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "You don't have permission to edit this vehicle",
+		})
+		return
+	}
+
+	var req OdometerCalibrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if *req.Odometer < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Odometer cannot be negative",
+		})
+		return
+	}
+
+	calibratedAt := time.Now()
+	result := db.GetDB().Model(&models.Vehicle{}).Where("imei = ?", imei).Updates(map[string]interface{}{
+		"odometer":               *req.Odometer,
+		"odometer_calibrated_at": calibratedAt,
+	})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to calibrate odometer",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not found",
+		})
+		return
+	}
+
+	colors.PrintSuccess("Odometer calibrated: IMEI=%s, Odometer=%.2f, User=%s", imei, *req.Odometer, user.Email)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"imei":                   imei,
+			"odometer":               *req.Odometer,
+			"odometer_calibrated_at": calibratedAt,
+			"total_odometer":         *req.Odometer,
+		},
+		"message": "Odometer calibrated successfully",
+	})
+}
+
+// EngineHoursCalibrationRequest represents the request body for calibrating engine hours
+type EngineHoursCalibrationRequest struct {
+	EngineHours *float64 `json:"engine_hours" binding:"required"`
+}
+
+// CalibrateMyVehicleEngineHours sets the engine-hours counter, e.g. to the hour meter
+// reading or to 0 after a service
+func (vc *VehicleController) CalibrateMyVehicleEngineHours(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return
+	}
+
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "User not authenticated",
+		})
+		return
+	}
+	user := currentUser.(*models.User)
+
+	// Check if user has edit permission for this vehicle
+	var userVehicle models.UserVehicle
+	if err := db.GetDB().Where("user_id = ? AND vehicle_id = ? AND is_active = ?", user.ID, imei, true).
+		First(&userVehicle).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not found or access denied",
+		})
+		return
+	}
+
+	if userVehicle.IsExpired() || (!userVehicle.VehicleEdit && !userVehicle.AllAccess) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "You don't have permission to edit this vehicle",
+		})
+		return
+	}
+
+	var req EngineHoursCalibrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if *req.EngineHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Engine hours cannot be negative",
+		})
+		return
+	}
+
+	found, err := services.CalibrateEngineHours(imei, *req.EngineHours)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to calibrate engine hours",
+		})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not found",
+		})
+		return
+	}
+
+	colors.PrintSuccess("Engine hours calibrated: IMEI=%s, EngineHours=%.2f, User=%s", imei, *req.EngineHours, user.Email)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"imei":         imei,
+			"engine_hours": *req.EngineHours,
+		},
+		"message": "Engine hours calibrated successfully",
+	})
+}
+
+// AllowedHoursRequest represents the request body for a vehicle's allowed hours
+type AllowedHoursRequest struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// SetMyVehicleAllowedHours sets the daily window in which the vehicle may move, in the
+// server timezone, or clears it when start and end are both empty. Starting to move
+// outside the window sends an urgent alert.
+func (vc *VehicleController) SetMyVehicleAllowedHours(c *gin.Context) {
+	imei := c.Param("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid IMEI format",
+		})
+		return
+	}
+
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "User not authenticated",
+		})
+		return
+	}
+	user := currentUser.(*models.User)
+
+	// Check if user has edit permission for this vehicle
+	var userVehicle models.UserVehicle
+	if err := db.GetDB().Where("user_id = ? AND vehicle_id = ? AND is_active = ?", user.ID, imei, true).
+		First(&userVehicle).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not found or access denied",
+		})
+		return
+	}
+
+	if userVehicle.IsExpired() || (!userVehicle.VehicleEdit && !userVehicle.AllAccess) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "You don't have permission to edit this vehicle",
+		})
+		return
+	}
+
+	var req AllowedHoursRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !models.IsValidAllowedHours(req.Start, req.End) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   allowedHoursErrorMessage,
+		})
+		return
+	}
+
+	result := db.GetDB().Model(&models.Vehicle{}).Where("imei = ?", imei).Updates(map[string]interface{}{
+		"allowed_hours_start": req.Start,
+		"allowed_hours_end":   req.End,
+	})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update allowed hours",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not found",
+		})
+		return
+	}
+
+	colors.PrintSuccess("Allowed hours set: IMEI=%s, Start=%q, End=%q, User=%s", imei, req.Start, req.End, user.Email)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"imei":                imei,
+			"allowed_hours_start": req.Start,
+			"allowed_hours_end":   req.End,
+			"timezone":            config.GetTimezoneString(),
+		},
+		"message": "Allowed hours updated successfully",
+	})
+}
+
 // DeleteMyVehicle deletes a vehicle owned by the current user (only main users can delete)
 func (vc *VehicleController) DeleteMyVehicle(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionVehicleDelete, "vehicle", c.Param("imei"))
+
 	imei := c.Param("imei")
 	if len(imei) != 16 {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -1191,6 +1631,31 @@ func (vc *VehicleController) DeleteMyVehicle(c *gin.Context) {
 		return
 	}
 
+	// Decide what happens to the vehicle's GPS history (keep/archive/delete)
+	archiveConfig := config.GetArchiveConfig()
+	gpsMode := c.DefaultQuery("gps", archiveConfig.VehicleDeleteGPSMode)
+	if !config.IsValidGPSCleanupMode(gpsMode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "gps must be one of keep, archive or delete",
+		})
+		return
+	}
+
+	archivePath := ""
+	if gpsMode == config.GPSCleanupArchive {
+		path, err := vc.archiveService.ArchiveVehicles([]models.Vehicle{vehicle}, true, "owner vehicle delete")
+		if err != nil {
+			colors.PrintError("Failed to archive GPS data for vehicle %s: %v", imei, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to archive vehicle GPS data, nothing was deleted",
+			})
+			return
+		}
+		archivePath = path
+	}
+
 	// Start transaction to delete vehicle and all related user access
 	tx := db.GetDB().Begin()
 	defer func() {
@@ -1209,6 +1674,31 @@ func (vc *VehicleController) DeleteMyVehicle(c *gin.Context) {
 		return
 	}
 
+	// Remove the GPS history so it is not orphaned
+	var gpsRowsDeleted int64
+	if gpsMode != config.GPSCleanupKeep {
+		deleted, err := deleteGPSDataInBatches(tx, imei, archiveConfig.GPSDeleteBatchSize)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to delete vehicle GPS data",
+			})
+			return
+		}
+		gpsRowsDeleted = deleted
+
+		// Driving events are derived from the GPS history and go with it
+		if err := tx.Where("imei = ?", imei).Delete(&models.DrivingEvent{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to delete vehicle driving events",
+			})
+			return
+		}
+	}
+
 	// Delete the vehicle
 	if err := tx.Unscoped().Delete(&vehicle).Error; err != nil {
 		tx.Rollback()
@@ -1227,16 +1717,48 @@ func (vc *VehicleController) DeleteMyVehicle(c *gin.Context) {
 		})
 		return
 	}
+	if gpsRowsDeleted > 0 {
+		services.GetLatestGPSCache().Invalidate(imei)
+	}
 
-	colors.PrintSuccess("Vehicle deleted successfully: IMEI=%s, RegNo=%s, User=%s",
-		vehicle.IMEI, vehicle.RegNo, user.Email)
+	colors.PrintSuccess("Vehicle deleted successfully: IMEI=%s, RegNo=%s, User=%s, GPS=%s (%d rows removed)",
+		vehicle.IMEI, vehicle.RegNo, user.Email, gpsMode, gpsRowsDeleted)
+
+	data := gin.H{
+		"gps_mode":         gpsMode,
+		"gps_rows_deleted": gpsRowsDeleted,
+	}
+	if archivePath != "" {
+		data["archive_path"] = archivePath
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
+		"data":    data,
 		"message": "Vehicle deleted successfully",
 	})
 }
 
+// deleteGPSDataInBatches removes a device's GPS rows a batch at a time so a long
+// history does not turn into one huge delete statement
+func deleteGPSDataInBatches(tx *gorm.DB, imei string, batchSize int) (int64, error) {
+	var total int64
+	for {
+		result := tx.Exec(`
+			DELETE FROM gps_data
+			WHERE id IN (SELECT id FROM gps_data WHERE imei = ? LIMIT ?)
+		`, imei, batchSize)
+		if result.Error != nil {
+			return total, result.Error
+		}
+
+		total += result.RowsAffected
+		if result.RowsAffected < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
+
 // GetVehicleShares returns sharing information for a vehicle
 func (vc *VehicleController) GetVehicleShares(c *gin.Context) {
 	imei := c.Param("imei")
@@ -1319,6 +1841,8 @@ func (vc *VehicleController) GetVehicleShares(c *gin.Context) {
 
 // ShareMyVehicle shares a vehicle with another user
 func (vc *VehicleController) ShareMyVehicle(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionVehicleShare, "vehicle", c.Param("imei"))
+
 	imei := c.Param("imei")
 	if len(imei) != 16 {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -1446,6 +1970,8 @@ func (vc *VehicleController) ShareMyVehicle(c *gin.Context) {
 
 // RevokeVehicleShare revokes access to a shared vehicle
 func (vc *VehicleController) RevokeVehicleShare(c *gin.Context) {
+	defer recordAudit(c, models.AuditActionVehicleRevoke, "user_vehicle", c.Param("shareId"))
+
 	imei := c.Param("imei")
 	if len(imei) != 16 {
 		c.JSON(http.StatusBadRequest, gin.H{
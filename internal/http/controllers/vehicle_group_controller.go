@@ -0,0 +1,414 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VehicleGroupController handles a user's vehicle groups (fleet organization)
+type VehicleGroupController struct{}
+
+// NewVehicleGroupController creates a new vehicle group controller
+func NewVehicleGroupController() *VehicleGroupController {
+	return &VehicleGroupController{}
+}
+
+// VehicleGroupRequest is the body for creating or updating a group.
+// VehicleIDs is only used on create, to add the first vehicles.
+type VehicleGroupRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	VehicleIDs  []string `json:"vehicle_ids"`
+}
+
+// GroupVehiclesRequest is the body for adding vehicles to a group
+type GroupVehiclesRequest struct {
+	VehicleIDs []string `json:"vehicle_ids" binding:"required"`
+}
+
+// GetMyVehicleGroups returns the current user's groups with the vehicles in them
+// that the user can still access
+func (vgc *VehicleGroupController) GetMyVehicleGroups(c *gin.Context) {
+	user, ok := vgc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var groups []models.VehicleGroup
+	if err := db.GetDB().Where("owner_id = ?", user.ID).Preload("Members").Order("name ASC").Find(&groups).Error; err != nil {
+		colors.PrintError("Failed to fetch vehicle groups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch vehicle groups",
+			"message": "Unable to retrieve vehicle groups from database",
+		})
+		return
+	}
+
+	accessible, err := services.AccessibleVehicleIDs(user.ID)
+	if err != nil {
+		colors.PrintError("Failed to fetch vehicle access for groups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch vehicle groups",
+			"message": "Unable to retrieve vehicle access from database",
+		})
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(groups))
+	for i := range groups {
+		results = append(results, vehicleGroupResponse(&groups[i], accessible))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    results,
+		"count":   len(results),
+		"message": "Vehicle groups retrieved successfully",
+	})
+}
+
+// CreateMyVehicleGroup creates a group owned by the current user, optionally with vehicles
+func (vgc *VehicleGroupController) CreateMyVehicleGroup(c *gin.Context) {
+	user, ok := vgc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req VehicleGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"message": "Group name is required",
+		})
+		return
+	}
+
+	accessible, ok := vgc.checkVehicleAccess(c, user.ID, req.VehicleIDs)
+	if !ok {
+		return
+	}
+
+	group := models.VehicleGroup{
+		OwnerID:     user.ID,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+	}
+	if err := db.GetDB().Create(&group).Error; err != nil {
+		colors.PrintError("Failed to create vehicle group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to create vehicle group",
+			"message": "Database error occurred while creating vehicle group",
+		})
+		return
+	}
+
+	if err := services.AddVehiclesToGroup(group.ID, req.VehicleIDs, user.ID); err != nil {
+		colors.PrintError("Failed to add vehicles to group %d: %v", group.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to add vehicles to group",
+			"message": "The group was created but its vehicles could not be added",
+		})
+		return
+	}
+
+	db.GetDB().Where("group_id = ?", group.ID).Find(&group.Members)
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    vehicleGroupResponse(&group, accessible),
+		"message": "Vehicle group created successfully",
+	})
+}
+
+// UpdateMyVehicleGroup renames one of the current user's groups
+func (vgc *VehicleGroupController) UpdateMyVehicleGroup(c *gin.Context) {
+	group, ok := vgc.findMyGroup(c)
+	if !ok {
+		return
+	}
+
+	var req VehicleGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"message": "Group name is required",
+		})
+		return
+	}
+
+	if err := db.GetDB().Model(group).Updates(map[string]interface{}{
+		"name":        strings.TrimSpace(req.Name),
+		"description": req.Description,
+	}).Error; err != nil {
+		colors.PrintError("Failed to update vehicle group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update vehicle group",
+			"message": "Database error occurred while updating vehicle group",
+		})
+		return
+	}
+
+	accessible, _ := services.AccessibleVehicleIDs(group.OwnerID)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    vehicleGroupResponse(group, accessible),
+		"message": "Vehicle group updated successfully",
+	})
+}
+
+// DeleteMyVehicleGroup removes a group and its memberships; the vehicles are not affected
+func (vgc *VehicleGroupController) DeleteMyVehicleGroup(c *gin.Context) {
+	group, ok := vgc.findMyGroup(c)
+	if !ok {
+		return
+	}
+
+	if err := db.GetDB().Delete(group).Error; err != nil {
+		colors.PrintError("Failed to delete vehicle group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to delete vehicle group",
+			"message": "Database error occurred while deleting vehicle group",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Vehicle group deleted successfully",
+	})
+}
+
+// AddMyGroupVehicles adds vehicles the current user can access to one of their groups
+func (vgc *VehicleGroupController) AddMyGroupVehicles(c *gin.Context) {
+	group, ok := vgc.findMyGroup(c)
+	if !ok {
+		return
+	}
+
+	var req GroupVehiclesRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.VehicleIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"message": "vehicle_ids must list at least one IMEI",
+		})
+		return
+	}
+
+	accessible, ok := vgc.checkVehicleAccess(c, group.OwnerID, req.VehicleIDs)
+	if !ok {
+		return
+	}
+
+	if err := services.AddVehiclesToGroup(group.ID, req.VehicleIDs, group.OwnerID); err != nil {
+		colors.PrintError("Failed to add vehicles to group %d: %v", group.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to add vehicles to group",
+			"message": "Database error occurred while adding vehicles",
+		})
+		return
+	}
+
+	db.GetDB().Where("group_id = ?", group.ID).Find(&group.Members)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    vehicleGroupResponse(group, accessible),
+		"message": "Vehicles added to group successfully",
+	})
+}
+
+// RemoveMyGroupVehicle takes a vehicle out of one of the current user's groups
+func (vgc *VehicleGroupController) RemoveMyGroupVehicle(c *gin.Context) {
+	group, ok := vgc.findMyGroup(c)
+	if !ok {
+		return
+	}
+
+	imei := c.Param("imei")
+	result := db.GetDB().Where("group_id = ? AND vehicle_id = ?", group.ID, imei).Delete(&models.VehicleGroupMember{})
+	if result.Error != nil {
+		colors.PrintError("Failed to remove %s from group %d: %v", imei, group.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to remove vehicle from group",
+			"message": "Database error occurred while removing vehicle",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Vehicle not in group",
+			"message": "This vehicle is not a member of the group",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Vehicle removed from group successfully",
+	})
+}
+
+// vehicleGroupResponse describes a group with the member vehicles the user can access
+func vehicleGroupResponse(group *models.VehicleGroup, accessible map[string]bool) map[string]interface{} {
+	vehicleIDs := []string{}
+	for _, imei := range group.VehicleIDs() {
+		if accessible[imei] {
+			vehicleIDs = append(vehicleIDs, imei)
+		}
+	}
+	sort.Strings(vehicleIDs)
+
+	return map[string]interface{}{
+		"id":            group.ID,
+		"name":          group.Name,
+		"description":   group.Description,
+		"vehicle_ids":   vehicleIDs,
+		"vehicle_count": len(vehicleIDs),
+		"created_at":    group.CreatedAt,
+		"updated_at":    group.UpdatedAt,
+	}
+}
+
+// groupFilter applies the optional ?group_id= filter to the user's vehicles,
+// writing the error response if the group is invalid or not the user's
+func groupFilter(c *gin.Context, userID uint, userVehicles []models.UserVehicle) ([]models.UserVehicle, bool) {
+	value := c.Query("group_id")
+	if value == "" {
+		return userVehicles, true
+	}
+
+	groupID, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid group_id",
+			"message": "group_id must be a valid number",
+		})
+		return nil, false
+	}
+
+	group, err := services.GetOwnedVehicleGroup(userID, uint(groupID))
+	if err != nil {
+		if err == services.ErrVehicleGroupNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Vehicle group not found",
+				"message": "No vehicle group with this ID belongs to you",
+			})
+		} else {
+			colors.PrintError("Failed to load vehicle group %d: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Database error",
+				"message": "Failed to retrieve vehicle group from database",
+			})
+		}
+		return nil, false
+	}
+
+	return services.FilterUserVehiclesByGroup(userVehicles, group.VehicleIDs()), true
+}
+
+// checkVehicleAccess checks that the user can access every listed vehicle,
+// writing the error response if not. It returns the user's accessible vehicles.
+func (vgc *VehicleGroupController) checkVehicleAccess(c *gin.Context, userID uint, imeis []string) (map[string]bool, bool) {
+	accessible, err := services.AccessibleVehicleIDs(userID)
+	if err != nil {
+		colors.PrintError("Failed to fetch vehicle access: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Database error",
+			"message": "Failed to retrieve vehicle access from database",
+		})
+		return nil, false
+	}
+
+	var denied []string
+	for _, imei := range imeis {
+		if !accessible[imei] {
+			denied = append(denied, imei)
+		}
+	}
+	if len(denied) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success":     false,
+			"error":       "Vehicle not found or access denied",
+			"message":     "You can only group vehicles you have access to",
+			"vehicle_ids": denied,
+		})
+		return nil, false
+	}
+
+	return accessible, true
+}
+
+// findMyGroup loads the current user's group named by the :id parameter,
+// writing the error response if it fails
+func (vgc *VehicleGroupController) findMyGroup(c *gin.Context) (*models.VehicleGroup, bool) {
+	user, ok := vgc.currentUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid group ID",
+			"message": "Group ID must be a valid number",
+		})
+		return nil, false
+	}
+
+	group, err := services.GetOwnedVehicleGroup(user.ID, uint(id))
+	if err != nil {
+		if err == services.ErrVehicleGroupNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Vehicle group not found",
+				"message": "No vehicle group with this ID belongs to you",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Database error",
+				"message": "Failed to retrieve vehicle group from database",
+			})
+		}
+		return nil, false
+	}
+
+	return group, true
+}
+
+// currentUser returns the authenticated user, writing the error response if there is none
+func (vgc *VehicleGroupController) currentUser(c *gin.Context) (*models.User, bool) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "User not authenticated",
+		})
+		return nil, false
+	}
+	return currentUser.(*models.User), true
+}
@@ -0,0 +1,207 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/http/middleware"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// debugSubscriberBuffer is how many packets a slow debug client may fall behind before
+// packets are dropped for it; the TCP server never waits on a debug client
+const debugSubscriberBuffer = 64
+
+// PacketDebug streams decoded device packets to admin debug sessions
+var PacketDebug = NewPacketDebugStream()
+
+// PacketDebugStream is a registry of debug subscribers by device IMEI
+type PacketDebugStream struct {
+	subscribers map[string]map[*DebugSubscriber]struct{}
+	mutex       sync.RWMutex
+	// Total subscribers, read without the lock on every packet
+	count int64
+}
+
+// DebugSubscriber receives the packets of one device
+type DebugSubscriber struct {
+	IMEI     string
+	messages chan []byte
+	dropped  uint64
+}
+
+// NewPacketDebugStream creates an empty debug subscriber registry
+func NewPacketDebugStream() *PacketDebugStream {
+	return &PacketDebugStream{
+		subscribers: make(map[string]map[*DebugSubscriber]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber for the device's packets
+func (s *PacketDebugStream) Subscribe(imei string) *DebugSubscriber {
+	subscriber := &DebugSubscriber{
+		IMEI:     imei,
+		messages: make(chan []byte, debugSubscriberBuffer),
+	}
+
+	s.mutex.Lock()
+	if s.subscribers[imei] == nil {
+		s.subscribers[imei] = make(map[*DebugSubscriber]struct{})
+	}
+	s.subscribers[imei][subscriber] = struct{}{}
+	s.mutex.Unlock()
+
+	atomic.AddInt64(&s.count, 1)
+	return subscriber
+}
+
+// Unsubscribe removes the subscriber; it receives no packets afterwards
+func (s *PacketDebugStream) Unsubscribe(subscriber *DebugSubscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.subscribers[subscriber.IMEI][subscriber]; !exists {
+		return
+	}
+	delete(s.subscribers[subscriber.IMEI], subscriber)
+	if len(s.subscribers[subscriber.IMEI]) == 0 {
+		delete(s.subscribers, subscriber.IMEI)
+	}
+	atomic.AddInt64(&s.count, -1)
+}
+
+// HasSubscribers reports whether anyone is watching the device. With no debug
+// sessions open this is a single atomic load.
+func (s *PacketDebugStream) HasSubscribers(imei string) bool {
+	if atomic.LoadInt64(&s.count) == 0 || imei == "" {
+		return false
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.subscribers[imei]) > 0
+}
+
+// Publish sends a decoded packet to the device's subscribers. Nothing is encoded
+// unless someone is subscribed, and a full subscriber buffer drops the packet.
+func (s *PacketDebugStream) Publish(imei, remoteAddr string, packet interface{}) {
+	if !s.HasSubscribers(imei) {
+		return
+	}
+
+	message, err := json.Marshal(WebSocketMessage{
+		Type:      "debug_packet",
+		Timestamp: config.FormatTimestamp(time.Now()),
+		Data: map[string]interface{}{
+			"imei":        imei,
+			"remote_addr": remoteAddr,
+			"packet":      packet,
+		},
+	})
+	if err != nil {
+		colors.PrintError("Failed to encode debug packet for %s: %v", imei, err)
+		return
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for subscriber := range s.subscribers[imei] {
+		select {
+		case subscriber.messages <- message:
+		default:
+			atomic.AddUint64(&subscriber.dropped, 1)
+		}
+	}
+}
+
+// Messages returns the channel the subscriber's packets arrive on
+func (sub *DebugSubscriber) Messages() <-chan []byte {
+	return sub.messages
+}
+
+// Dropped returns how many packets were dropped because the subscriber fell behind
+func (sub *DebugSubscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+// HandleDebugWebSocket streams the decoded packets of one device to an admin,
+// e.g. /ws/debug?imei=0123456789012345&token=...
+func HandleDebugWebSocket(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication token required"})
+		return
+	}
+
+	user, err := middleware.AuthenticateToken(token)
+	if err != nil {
+		colors.PrintError("Debug WebSocket connection attempted with invalid token: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	if user.Role != models.UserRoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	imei := c.Query("imei")
+	if len(imei) != 16 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IMEI format"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		colors.PrintError("Failed to upgrade debug WebSocket: %v", err)
+		return
+	}
+
+	colors.PrintConnection("🐞", "Debug stream for %s opened by User ID %d from %s", imei, user.ID, c.ClientIP())
+	ServeDebugStream(conn, PacketDebug, imei)
+	colors.PrintConnection("🐞", "Debug stream for %s closed by User ID %d", imei, user.ID)
+}
+
+// ServeDebugStream writes the device's packets to the connection until the client
+// disconnects, then unsubscribes and closes the connection
+func ServeDebugStream(conn *websocket.Conn, stream *PacketDebugStream, imei string) {
+	subscriber := stream.Subscribe(imei)
+	defer stream.Unsubscribe(subscriber)
+	defer conn.Close()
+
+	// The client only sends pings; a read error means it has gone
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(message) == "ping" {
+				conn.WriteControl(websocket.PongMessage, nil, time.Now().Add(5*time.Second))
+			}
+		}
+	}()
+
+	for {
+		select {
+		case message := <-subscriber.Messages():
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -1,15 +1,14 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 
-	"luna_iot_server/internal/db"
 	"luna_iot_server/internal/models"
 	"luna_iot_server/pkg/colors"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // AuthMiddleware validates the authentication token
@@ -17,7 +16,7 @@ func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			colors.PrintWarning("Authentication failed: No Authorization header")
+			RequestLogger(c).PrintWarning("Authentication failed: No Authorization header")
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"error":   "Unauthorized",
@@ -30,7 +29,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Extract token from Bearer token format
 		tokenParts := strings.Split(authHeader, " ")
 		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			colors.PrintWarning("Authentication failed: Invalid Authorization header format")
+			RequestLogger(c).PrintWarning("Authentication failed: Invalid Authorization header format")
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"error":   "Unauthorized",
@@ -42,7 +41,7 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		token := tokenParts[1]
 		if token == "" {
-			colors.PrintWarning("Authentication failed: Empty token")
+			RequestLogger(c).PrintWarning("Authentication failed: Empty token")
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"error":   "Unauthorized",
@@ -52,18 +51,17 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Find user by token
-		var user models.User
-		if err := db.GetDB().Where("token = ?", token).First(&user).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				colors.PrintWarning("Authentication failed: Invalid token")
+		user, sessionID, err := authenticateToken(token)
+		if err != nil {
+			if err == ErrInvalidToken {
+				RequestLogger(c).PrintWarning("Authentication failed: Invalid token")
 				c.JSON(http.StatusUnauthorized, gin.H{
 					"success": false,
 					"error":   "Unauthorized",
 					"message": "Invalid or expired token",
 				})
 			} else {
-				colors.PrintError("Database error during authentication: %v", err)
+				RequestLogger(c).PrintError("Database error during authentication: %v", err)
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"success": false,
 					"error":   "Internal server error",
@@ -74,22 +72,13 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Check if token is valid (not expired)
-		if !user.IsTokenValid() {
-			colors.PrintWarning("Authentication failed: Invalid token for user %s", user.Email)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"error":   "Unauthorized",
-				"message": "Invalid token",
-			})
-			c.Abort()
-			return
-		}
-
 		// Set user in context for use in handlers
-		c.Set("user", &user)
+		c.Set("user", user)
 		c.Set("user_id", user.ID)
 		c.Set("user_role", user.Role)
+		if sessionID != "" {
+			c.Set("session_id", sessionID)
+		}
 
 		colors.PrintDebug("Authentication successful for user %s (ID: %d)", user.Email, user.ID)
 		c.Next()
@@ -121,25 +110,20 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Find user by token
-		var user models.User
-		if err := db.GetDB().Where("token = ?", token).First(&user).Error; err != nil {
-			// Invalid token, continue without authentication
-			c.Next()
-			return
-		}
-
-		// Check if token is valid (not expired)
-		if !user.IsTokenValid() {
+		user, sessionID, err := authenticateToken(token)
+		if err != nil {
 			// Invalid token, continue without authentication
 			c.Next()
 			return
 		}
 
 		// Set user in context for use in handlers
-		c.Set("user", &user)
+		c.Set("user", user)
 		c.Set("user_id", user.ID)
 		c.Set("user_role", user.Role)
+		if sessionID != "" {
+			c.Set("session_id", sessionID)
+		}
 
 		colors.PrintDebug("Optional authentication successful for user %s (ID: %d)", user.Email, user.ID)
 		c.Next()
@@ -148,10 +132,22 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 
 // AdminOnlyMiddleware ensures the authenticated user is an admin
 func AdminOnlyMiddleware() gin.HandlerFunc {
+	return RequireRole(models.UserRoleAdmin)
+}
+
+// RequireRole ensures the authenticated user has one of the given roles.
+// It must run after AuthMiddleware; requests without a user get 401, other roles get 403.
+func RequireRole(roles ...models.UserRole) gin.HandlerFunc {
+	allowed := make([]string, len(roles))
+	for i, role := range roles {
+		allowed[i] = role.String()
+	}
+	allowedList := strings.Join(allowed, ", ")
+
 	return func(c *gin.Context) {
 		userInterface, exists := c.Get("user")
 		if !exists {
-			colors.PrintWarning("Admin access denied: No authenticated user")
+			RequestLogger(c).PrintWarning("Access denied to %s: No authenticated user", c.FullPath())
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"error":   "Unauthorized",
@@ -162,18 +158,19 @@ func AdminOnlyMiddleware() gin.HandlerFunc {
 		}
 
 		user := userInterface.(*models.User)
-		if user.Role != models.UserRoleAdmin {
-			colors.PrintWarning("Admin access denied: User %s is not an admin (role: %d)", user.Email, user.Role)
-			c.JSON(http.StatusForbidden, gin.H{
-				"success": false,
-				"error":   "Forbidden",
-				"message": "Admin access required",
-			})
-			c.Abort()
-			return
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
 		}
 
-		colors.PrintDebug("Admin access granted for user %s", user.Email)
-		c.Next()
+		RequestLogger(c).PrintWarning("Access denied to %s: User %s has role %s, requires %s", c.FullPath(), user.Email, user.Role, allowedList)
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "Forbidden",
+			"message": fmt.Sprintf("Requires role: %s", allowedList),
+		})
+		c.Abort()
 	}
 }
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecoveryMiddleware turns a panic in a handler into a JSON 500, logging the panic and
+// its stack with the request ID so the failing request can be traced
+func RecoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// The client went away; let net/http drop the connection as it expects
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			RequestLogger(c).PrintError("Recovered from panic in %s %s: %v\n%s",
+				c.Request.Method, c.Request.URL.Path, recovered, debug.Stack())
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"success":    false,
+				"error":      "Internal server error",
+				"message":    "The request could not be completed",
+				"request_id": GetRequestID(c),
+			})
+		}()
+		c.Next()
+	}
+}
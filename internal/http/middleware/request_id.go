@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+
+	"luna_iot_server/pkg/colors"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader carries the request ID in both directions
+	RequestIDHeader = "X-Request-ID"
+	// requestIDKey stores the request ID in the gin context
+	requestIDKey = "request_id"
+)
+
+// requestIDPattern limits client-supplied IDs to characters that are safe to log
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware tags each request with an ID, taken from the X-Request-ID header
+// when the client sent a usable one and generated otherwise. The ID is stored in the
+// context for RequestLogger and echoed back in the response header.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = generateRequestID()
+		}
+
+		c.Set(requestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID of the current request, or "" outside RequestIDMiddleware
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// RequestLogger returns a logger that tags messages with the current request's ID
+func RequestLogger(c *gin.Context) colors.RequestLogger {
+	return colors.ForRequest(GetRequestID(c))
+}
+
+// RequestLogFormatter formats gin access log lines with the request ID
+func RequestLogFormatter(param gin.LogFormatterParams) string {
+	requestID, _ := param.Keys[requestIDKey].(string)
+	return fmt.Sprintf("[GIN] %v | req %s | %3d | %13v | %15s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		requestID,
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		param.ErrorMessage,
+	)
+}
+
+// generateRequestID returns a random 16-byte hex ID, falling back to the time if the
+// random source fails
+func generateRequestID() string {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(idBytes)
+}
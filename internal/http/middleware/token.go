@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"errors"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/jwt"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidToken is returned when a token is unknown, expired or fails verification
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// AuthenticateToken resolves a bearer token to a user.
+// JWT access tokens are verified locally without touching the database when
+// JWT_SECRET is set; any other token falls back to the legacy users.token lookup.
+func AuthenticateToken(token string) (*models.User, error) {
+	user, _, err := authenticateToken(token)
+	return user, err
+}
+
+// authenticateToken resolves a token and also returns the session ID of a JWT, if any
+func authenticateToken(token string) (*models.User, string, error) {
+	authConfig := config.GetAuthConfig()
+	if authConfig.IsJWTEnabled() && jwt.LooksLikeJWT(token) {
+		claims, err := jwt.Parse(token, authConfig.JWTSecret)
+		if err != nil {
+			return nil, "", ErrInvalidToken
+		}
+		if claims.SessionID != "" && services.IsSessionRevoked(claims.SessionID) {
+			return nil, "", ErrInvalidToken
+		}
+		return UserFromClaims(claims), claims.SessionID, nil
+	}
+
+	var user models.User
+	if err := db.GetDB().Where("token = ?", token).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, "", ErrInvalidToken
+		}
+		return nil, "", err
+	}
+
+	if !user.IsTokenValid() {
+		return nil, "", ErrInvalidToken
+	}
+
+	return &user, "", nil
+}
+
+// UserFromClaims builds a partial user from JWT claims.
+// Only identity fields are populated; handlers that need the full record
+// (password, FCM token, image) must reload it by ID.
+func UserFromClaims(claims *jwt.Claims) *models.User {
+	return &models.User{
+		ID:       claims.UserID,
+		Name:     claims.Name,
+		Phone:    claims.Phone,
+		Email:    claims.Email,
+		Role:     models.UserRole(claims.Role),
+		IsActive: true,
+	}
+}
+
+// IssueAccessToken signs a short-lived JWT for the user's session, or returns "" when JWT is disabled
+func IssueAccessToken(user *models.User, sessionID string) (string, error) {
+	authConfig := config.GetAuthConfig()
+	if !authConfig.IsJWTEnabled() {
+		return "", nil
+	}
+
+	claims := jwt.NewClaims(user.ID, int(user.Role), authConfig.AccessTokenTTL)
+	claims.SessionID = sessionID
+	claims.Name = user.Name
+	claims.Phone = user.Phone
+	claims.Email = user.Email
+
+	return jwt.Sign(claims, authConfig.JWTSecret)
+}
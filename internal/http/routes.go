@@ -1,8 +1,12 @@
 package http
 
 import (
+	"luna_iot_server/internal/db"
 	"luna_iot_server/internal/http/controllers"
 	"luna_iot_server/internal/http/middleware"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
+	"luna_iot_server/pkg/colors"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,23 +18,33 @@ func SetupRoutes(router *gin.Engine) {
 
 // SetupRoutesWithControlController configures all API routes with a shared control controller
 func SetupRoutesWithControlController(router *gin.Engine, sharedControlController *controllers.ControlController) {
+	// Restore revoked sessions so their access tokens stay rejected across restarts
+	if err := services.LoadRevokedSessions(); err != nil {
+		colors.PrintWarning("Failed to load revoked auth sessions: %v", err)
+	}
+
 	// Initialize controllers
 	authController := controllers.NewAuthController()
 	userController := controllers.NewUserController()
 	deviceController := controllers.NewDeviceController()
 	deviceModelController := controllers.NewDeviceModelController()
 	settingController := controllers.NewSettingController()
-	vehicleController := controllers.NewVehicleController()
 	userVehicleController := controllers.NewUserVehicleController()
 	gpsController := controllers.NewGPSController()
-	userTrackingController := controllers.NewUserTrackingController()
 	dashboardController := controllers.NewDashboardController()
 	rechargeController := controllers.NewRechargeController()
 	popupController := controllers.NewPopupController()
 	notificationController := controllers.NewNotificationController()
 	notificationManagementController := controllers.NewNotificationManagementController()
+	notificationTemplateController := controllers.NewNotificationTemplateController()
 	userSearchController := controllers.NewUserSearchController()
 	fileUploadController := controllers.NewFileUploadController()
+	geoController := controllers.NewGeoController()
+	maintenanceController := controllers.NewMaintenanceController()
+	driverController := controllers.NewDriverController()
+	maintenanceScheduleController := controllers.NewMaintenanceScheduleController()
+	vehicleGroupController := controllers.NewVehicleGroupController()
+	auditController := controllers.NewAuditController()
 
 	// Use shared control controller if provided, otherwise create new one
 	var controlController *controllers.ControlController
@@ -39,14 +53,19 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 	} else {
 		controlController = controllers.NewControlController()
 	}
+	vehicleController := controllers.NewVehicleController(controlController)
 
 	// Initialize user-based controllers
 	userControlController := controllers.NewUserControlController(controlController)
 	userGPSController := controllers.NewUserGPSController()
+	userTrackingController := controllers.NewUserTrackingController(controlController)
 
 	// WebSocket endpoint for real-time data (no auth required for now)
 	router.GET("/ws", HandleWebSocket)
 
+	// Admin-only WebSocket that streams one device's decoded packets, e.g. /ws/debug?imei=...&token=...
+	router.GET("/ws/debug", HandleDebugWebSocket)
+
 	// API version 1
 	v1 := router.Group("/api/v1")
 	{
@@ -56,6 +75,8 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			auth.POST("/login", authController.Login)
 			auth.POST("/register", authController.Register)
 			auth.POST("/send-otp", authController.SendOTP)
+			// Accepts a refresh token in the body, or a legacy token in the Authorization header
+			auth.POST("/refresh", middleware.OptionalAuthMiddleware(), authController.RefreshToken)
 		}
 
 		// Protected authentication routes (require auth)
@@ -64,7 +85,9 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 		{
 			authProtected.POST("/logout", authController.Logout)
 			authProtected.GET("/me", authController.Me)
-			authProtected.POST("/refresh", authController.RefreshToken)
+			authProtected.POST("/logout-session", authController.LogoutSession)
+			authProtected.GET("/sessions", authController.GetSessions)
+			authProtected.PUT("/language", authController.UpdateLanguage)
 			authProtected.GET("/delete-account", authController.DeleteAccount)
 		}
 
@@ -76,7 +99,7 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			users.GET("/:id", userController.GetUser) // Users can view their own profile
 			users.POST("", middleware.AdminOnlyMiddleware(), userController.CreateUser)
 			users.PUT("/:id", userController.UpdateUser) // Users can update their own profile
-			users.DELETE("/:id", middleware.AdminOnlyMiddleware(), userController.DeleteUser)
+			users.DELETE("/:id", middleware.RequireRole(models.UserRoleAdmin), userController.DeleteUser)
 
 			// User image routes
 			users.GET("/:id/image", userController.GetUserImage)
@@ -106,6 +129,7 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			devices.GET("", deviceController.GetDevices)
 			devices.GET("/:id", deviceController.GetDevice)
 			devices.GET("/imei/:imei", deviceController.GetDeviceByIMEI)
+			devices.GET("/sim/:sim_no", deviceController.GetDeviceBySIM)
 			devices.POST("", middleware.AdminOnlyMiddleware(), deviceController.CreateDevice)       // Admin only
 			devices.PUT("/:id", middleware.AdminOnlyMiddleware(), deviceController.UpdateDevice)    // Admin only
 			devices.DELETE("/:id", middleware.AdminOnlyMiddleware(), deviceController.DeleteDevice) // Admin only
@@ -132,9 +156,9 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			vehicles.GET("/:imei", vehicleController.GetVehicle)
 			vehicles.GET("/reg/:reg_no", vehicleController.GetVehicleByRegNo)
 			vehicles.GET("/type/:type", vehicleController.GetVehiclesByType)
-			vehicles.POST("", middleware.AdminOnlyMiddleware(), vehicleController.CreateVehicle)         // Admin only
-			vehicles.PUT("/:imei", middleware.AdminOnlyMiddleware(), vehicleController.UpdateVehicle)    // Admin only
-			vehicles.DELETE("/:imei", middleware.AdminOnlyMiddleware(), vehicleController.DeleteVehicle) // Admin only
+			vehicles.POST("", middleware.AdminOnlyMiddleware(), vehicleController.CreateVehicle)                     // Admin only
+			vehicles.PUT("/:imei", middleware.AdminOnlyMiddleware(), vehicleController.UpdateVehicle)                // Admin only
+			vehicles.DELETE("/:imei", middleware.RequireRole(models.UserRoleAdmin), vehicleController.DeleteVehicle) // Admin only
 
 		}
 
@@ -147,9 +171,56 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			customerVehicles.POST("", vehicleController.CreateMyVehicle)                           // Create vehicle for current user
 			customerVehicles.PUT("/:imei", vehicleController.UpdateMyVehicle)                      // Update user's own vehicle
 			customerVehicles.DELETE("/:imei", vehicleController.DeleteMyVehicle)                   // Delete user's own vehicle
+			customerVehicles.POST("/:imei/odometer", vehicleController.CalibrateMyVehicleOdometer) // Calibrate odometer
 			customerVehicles.GET("/:imei/share", vehicleController.GetVehicleShares)               // Get vehicle sharing info
 			customerVehicles.POST("/:imei/share", vehicleController.ShareMyVehicle)                // Share vehicle with others
 			customerVehicles.DELETE("/:imei/share/:shareId", vehicleController.RevokeVehicleShare) // Revoke vehicle share
+			customerVehicles.POST("/:imei/driver", driverController.AssignVehicleDriver)           // Assign the current driver
+			customerVehicles.DELETE("/:imei/driver", driverController.UnassignVehicleDriver)       // End the current driver's assignment
+
+			// Calibrate engine hours to the hour meter, or reset them after a service
+			customerVehicles.POST("/:imei/engine-hours", vehicleController.CalibrateMyVehicleEngineHours)
+
+			// Daily window in which the vehicle may move; moving outside it sends an urgent alert
+			customerVehicles.PUT("/:imei/allowed-hours", vehicleController.SetMyVehicleAllowedHours)
+
+			// Maintenance schedules by distance or engine hours, with reminders when due
+			customerVehicles.GET("/:imei/maintenance", maintenanceScheduleController.GetSchedules)
+			customerVehicles.POST("/:imei/maintenance", maintenanceScheduleController.CreateSchedule)
+			customerVehicles.PUT("/:imei/maintenance/:scheduleId", maintenanceScheduleController.UpdateSchedule)
+			customerVehicles.DELETE("/:imei/maintenance/:scheduleId", maintenanceScheduleController.DeleteSchedule)
+			customerVehicles.POST("/:imei/maintenance/:scheduleId/serviced", maintenanceScheduleController.MarkServiced)
+		}
+
+		// Driver routes (users manage their own drivers)
+		myDrivers := v1.Group("/my-drivers")
+		myDrivers.Use(middleware.AuthMiddleware())
+		{
+			myDrivers.GET("", driverController.GetMyDrivers)
+			myDrivers.POST("", driverController.CreateMyDriver)
+			myDrivers.PUT("/:id", driverController.UpdateMyDriver)
+			myDrivers.DELETE("/:id", driverController.DeleteMyDriver)
+			myDrivers.GET("/:id/vehicles", driverController.GetMyDriverVehicles)
+			myDrivers.GET("/:id/safety", driverController.GetMyDriverSafety)
+		}
+
+		// Vehicle group routes (users organize their fleet; ?group_id= filters my-vehicles and my-tracking)
+		myVehicleGroups := v1.Group("/my-vehicle-groups")
+		myVehicleGroups.Use(middleware.AuthMiddleware())
+		{
+			myVehicleGroups.GET("", vehicleGroupController.GetMyVehicleGroups)
+			myVehicleGroups.POST("", vehicleGroupController.CreateMyVehicleGroup)
+			myVehicleGroups.PUT("/:id", vehicleGroupController.UpdateMyVehicleGroup)
+			myVehicleGroups.DELETE("/:id", vehicleGroupController.DeleteMyVehicleGroup)
+			myVehicleGroups.POST("/:id/vehicles", vehicleGroupController.AddMyGroupVehicles)
+			myVehicleGroups.DELETE("/:id/vehicles/:imei", vehicleGroupController.RemoveMyGroupVehicle)
+		}
+
+		// Fleet dashboard routes (counts across all of the user's vehicles)
+		myFleet := v1.Group("/my-fleet")
+		myFleet.Use(middleware.AuthMiddleware())
+		{
+			myFleet.GET("/summary", userTrackingController.GetMyFleetSummary)
 		}
 
 		// ===========================================
@@ -161,6 +232,18 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			// Get tracking data for all user's vehicles
 			userTracking.GET("", userTrackingController.GetMyVehiclesTracking)
 
+			// Get latest location and status for a list of vehicles
+			userTracking.POST("/latest", userTrackingController.GetMyVehiclesLatest)
+
+			// Get the vehicles closest to a point, e.g. ?lat=27.7172&lng=85.3240&limit=5
+			userTracking.GET("/nearest", userTrackingController.GetMyNearestVehicles)
+
+			// Get vehicles grouped for a map overview, e.g. ?zoom=7&bbox=80.0,26.3,88.2,30.5
+			userTracking.GET("/clusters", userTrackingController.GetMyVehicleClusters)
+
+			// Compare 2 to 5 vehicles' statistics side by side, e.g. ?imeis=a,b&from=&to=
+			userTracking.GET("/compare", userTrackingController.CompareMyVehicles)
+
 			// Get detailed tracking for a specific vehicle
 			userTracking.GET("/:imei", userTrackingController.GetMyVehicleTracking)
 
@@ -170,12 +253,37 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			// Get only status data for a specific vehicle
 			userTracking.GET("/:imei/status", userTrackingController.GetMyVehicleStatus)
 
+			// Get lightweight online/offline status for a specific vehicle
+			userTracking.GET("/:imei/online", userTrackingController.GetMyVehicleOnlineStatus)
+
+			// Get status, location, today's stats and trips, and online status in one call
+			userTracking.GET("/:imei/live-snapshot", userTrackingController.GetMyVehicleLiveSnapshot)
+
 			// Get GPS history for a specific vehicle
 			userTracking.GET("/:imei/history", userTrackingController.GetMyVehicleHistory)
 
 			// Get route data for a specific vehicle
 			userTracking.GET("/:imei/route", userTrackingController.GetMyVehicleRoute)
 
+			// Export the route as a GPX track for mapping tools, or as KML for Google Earth
+			userTracking.GET("/:imei/route.gpx", userTrackingController.GetMyVehicleRouteGPX)
+			userTracking.GET("/:imei/route.kml", userTrackingController.GetMyVehicleRouteKML)
+
+			// Get a per-second status and location timeline for playback
+			userTracking.GET("/:imei/timeline", userTrackingController.GetMyVehicleTimeline)
+
+			// Share of expected reporting intervals the device reported in, with the gaps
+			userTracking.GET("/:imei/coverage", userTrackingController.GetMyVehicleCoverage)
+
+			// Grid cells the vehicle visited, weighted by fixes or time spent, for a heatmap
+			userTracking.GET("/:imei/heatmap", userTrackingController.GetMyVehicleHeatmap)
+
+			// Harsh braking and acceleration events, e.g. ?from=&to=&type=harsh_braking
+			userTracking.GET("/:imei/driving-events", userTrackingController.GetMyVehicleDrivingEvents)
+
+			// Estimate the arrival time at a destination, e.g. /eta?lat=27.7172&lng=85.3240
+			userTracking.GET("/:imei/eta", userTrackingController.GetMyVehicleETA)
+
 			// Get reports for a specific vehicle
 			userTracking.GET("/:imei/reports", userTrackingController.GetMyVehicleReports)
 		}
@@ -195,6 +303,9 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			// Get location for user's vehicle
 			userControl.POST("/:imei/get-location", userControlController.GetVehicleLocation)
 
+			// Check whether control commands can reach user's vehicle
+			userControl.GET("/:imei/availability", userControlController.GetCommandAvailability)
+
 			// Get user's active devices
 			userControl.GET("/active-devices", userControlController.GetUserActiveDevices)
 		}
@@ -248,7 +359,14 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			gps.GET("/:imei/individual-tracking", gpsController.GetIndividualTrackingData)
 
 			gps.GET("/:imei/route", gpsController.GetGPSRoute)
-			gps.DELETE("/:id", middleware.AdminOnlyMiddleware(), gpsController.DeleteGPSData) // Admin only
+			gps.DELETE("/:id", middleware.RequireRole(models.UserRoleAdmin), gpsController.DeleteGPSData) // Admin only
+		}
+
+		// Geo routes (authenticated users only)
+		geo := v1.Group("/geo")
+		geo.Use(middleware.AuthMiddleware())
+		{
+			geo.GET("/reverse", geoController.ReverseGeocode)
 		}
 
 		// Control routes for oil and electricity (authenticated users only)
@@ -281,6 +399,29 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			userVehicles.GET("/vehicle/:vehicle_id", userVehicleController.GetVehicleUserAccess) // Will be restricted by middleware
 		}
 
+		// Admin maintenance and audit routes
+		admin := v1.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), middleware.AdminOnlyMiddleware())
+		{
+			admin.POST("/gps/backfill", maintenanceController.StartGPSBackfill)
+			admin.GET("/gps/backfill", maintenanceController.GetGPSBackfillStatus)
+			admin.POST("/gps/backfill/cancel", maintenanceController.CancelGPSBackfill)
+
+			// Feed a GPS point through normal ingestion, to move a vehicle without a device
+			admin.POST("/gps/inject", gpsController.InjectGPSData)
+
+			// Re-decode a device's last stored raw frames with the current decoder, e.g. ?n=10
+			admin.GET("/devices/:imei/decode-recent", maintenanceController.RedecodeRecentPackets)
+
+			// Audit log of control and admin actions, e.g. ?action=control.cut_oil&target_id=<imei>
+			admin.GET("/audit", auditController.GetAuditLogs)
+
+			// Connected WebSocket clients with their ping round-trip latency
+			admin.GET("/websocket/connections", HandleWebSocketConnections)
+			// System banner such as a maintenance warning, pushed to every live dashboard
+			admin.POST("/websocket/broadcast", HandleWebSocketSystemMessage)
+		}
+
 		// Popup routes (admin only)
 		popups := v1.Group("/popups")
 		popups.Use(middleware.AuthMiddleware(), middleware.AdminOnlyMiddleware())
@@ -318,10 +459,25 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			// User routes for managing their own FCM tokens
 			notifications.POST("/fcm-token", notificationController.UpdateFCMToken)
 			notifications.DELETE("/fcm-token", notificationController.RemoveFCMToken)
+			// Per-device push tokens for users signed in on several phones
+			notifications.GET("/devices", notificationController.GetDevices)
+			notifications.POST("/devices", notificationController.RegisterDevice)
+			notifications.DELETE("/devices", notificationController.UnregisterDevice)
+
+			// Per-recipient delivery state of a sent notification (admin only)
+			notifications.GET("/:id/status", middleware.RequireRole(models.UserRoleAdmin), notificationManagementController.GetNotificationDeliveryStatus)
 			notifications.POST("/subscribe/:topic", notificationController.SubscribeToTopic)
 			notifications.DELETE("/subscribe/:topic", notificationController.UnsubscribeFromTopic)
 		}
 
+		// In-app notification inbox for the current user
+		myNotifications := v1.Group("/my-notifications")
+		myNotifications.Use(middleware.AuthMiddleware())
+		{
+			myNotifications.GET("", notificationController.GetMyNotifications)
+			myNotifications.POST("/:id/read", notificationController.MarkMyNotificationRead)
+		}
+
 		// Admin notification routes
 		adminNotifications := v1.Group("/admin/notifications")
 		adminNotifications.Use(middleware.AuthMiddleware(), middleware.AdminOnlyMiddleware())
@@ -348,6 +504,17 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 			notificationManagement.GET("/diagnose-fcm-tokens", notificationManagementController.DiagnoseFCMTokens)
 		}
 
+		// Notification template routes (admin only)
+		notificationTemplates := v1.Group("/admin/notification-templates")
+		notificationTemplates.Use(middleware.AuthMiddleware(), middleware.AdminOnlyMiddleware())
+		{
+			notificationTemplates.GET("", notificationTemplateController.GetTemplates)
+			notificationTemplates.POST("", notificationTemplateController.CreateTemplate)
+			notificationTemplates.GET("/:id", notificationTemplateController.GetTemplate)
+			notificationTemplates.PUT("/:id", notificationTemplateController.UpdateTemplate)
+			notificationTemplates.DELETE("/:id", notificationTemplateController.DeleteTemplate)
+		}
+
 		// File upload routes (admin only)
 		files := v1.Group("/files")
 		files.Use(middleware.AuthMiddleware(), middleware.AdminOnlyMiddleware())
@@ -385,7 +552,7 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 
 	// Health check endpoint (public)
 	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
+		response := gin.H{
 			"status":    "ok",
 			"message":   "Luna IoT Server is running",
 			"websocket": "/ws",
@@ -401,7 +568,20 @@ func SetupRoutesWithControlController(router *gin.Engine, sharedControlControlle
 				"my_tracking": "/api/v1/my-tracking",
 				"my_control":  "/api/v1/my-control",
 				"my_gps":      "/api/v1/my-gps",
+				"my_fleet":    "/api/v1/my-fleet/summary",
 			},
-		})
+		}
+
+		if tcpStats, ok := getTCPConnectionStats(); ok {
+			response["tcp_connections"] = tcpStats
+		}
+
+		if poolStats, ok := db.GetPoolStats(); ok {
+			response["database_pool"] = poolStats
+		}
+
+		response["latest_gps_cache"] = services.GetLatestGPSCache().Stats()
+
+		c.JSON(200, response)
 	})
 }
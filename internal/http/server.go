@@ -2,6 +2,7 @@ package http
 
 import (
 	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/http/middleware"
 	"luna_iot_server/pkg/colors"
 	"os"
 
@@ -22,12 +23,15 @@ func NewServer(port string) *Server {
 	// Create Gin router
 	router := gin.Default()
 
+	// Tag every request with an ID before anything logs about it
+	router.Use(middleware.RequestIDMiddleware())
+
 	// Add middleware conditionally
 	// Only add logger middleware if LOG_HTTP is set to true
 	if os.Getenv("LOG_HTTP") == "true" {
-		router.Use(gin.Logger())
+		router.Use(gin.LoggerWithFormatter(middleware.RequestLogFormatter))
 	}
-	router.Use(gin.Recovery())
+	router.Use(middleware.RecoveryMiddleware())
 	router.Use(CORSMiddleware())
 
 	// Initialize WebSocket hub
@@ -46,7 +50,7 @@ func NewServer(port string) *Server {
 		}
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 		c.Writer.Header().Set("Access-Control-Max-Age", "86400")
 
@@ -67,12 +71,15 @@ func NewServerWithController(port string, sharedController *controllers.ControlC
 	// Create Gin router
 	router := gin.Default()
 
+	// Tag every request with an ID before anything logs about it
+	router.Use(middleware.RequestIDMiddleware())
+
 	// Add middleware conditionally
 	// Only add logger middleware if LOG_HTTP is set to true
 	if os.Getenv("LOG_HTTP") == "true" {
-		router.Use(gin.Logger())
+		router.Use(gin.LoggerWithFormatter(middleware.RequestLogFormatter))
 	}
-	router.Use(gin.Recovery())
+	router.Use(middleware.RecoveryMiddleware())
 	router.Use(CORSMiddleware())
 
 	// Initialize WebSocket hub
@@ -106,8 +113,9 @@ func CORSMiddleware() gin.HandlerFunc {
 		}
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Retry-After")
 		c.Writer.Header().Set("Access-Control-Max-Age", "86400")
 
 		// Handle preflight requests
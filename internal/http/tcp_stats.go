@@ -0,0 +1,37 @@
+package http
+
+import "sync"
+
+// TCPConnectionStats describes device connection usage on the TCP server
+type TCPConnectionStats struct {
+	Current  int    `json:"current"`
+	Max      int    `json:"max"` // 0 means unlimited
+	Rejected uint64 `json:"rejected"`
+
+	// Vehicle notification states held in memory, bounded by the periodic cleanup
+	VehicleStates int `json:"vehicle_states"`
+}
+
+var (
+	tcpStatsProvider func() TCPConnectionStats
+	tcpStatsMutex    sync.RWMutex
+)
+
+// SetTCPConnectionStatsProvider lets the TCP server expose its connection counters to the health endpoint
+func SetTCPConnectionStatsProvider(provider func() TCPConnectionStats) {
+	tcpStatsMutex.Lock()
+	defer tcpStatsMutex.Unlock()
+	tcpStatsProvider = provider
+}
+
+// getTCPConnectionStats returns the current TCP connection stats, if a TCP server is running in this process
+func getTCPConnectionStats() (TCPConnectionStats, bool) {
+	tcpStatsMutex.RLock()
+	provider := tcpStatsProvider
+	tcpStatsMutex.RUnlock()
+
+	if provider == nil {
+		return TCPConnectionStats{}, false
+	}
+	return provider(), true
+}
@@ -2,13 +2,21 @@ package http
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"luna_iot_server/config"
 	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/http/middleware"
 	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/services"
 	"luna_iot_server/pkg/colors"
+	"luna_iot_server/pkg/lru"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -19,18 +27,35 @@ var WSHub *WebSocketHub
 
 // WebSocket upgrader configuration
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now
-	},
+	CheckOrigin: CheckWebSocketOrigin,
+}
+
+// CheckWebSocketOrigin allows an upgrade when the Origin header is in WS_ALLOWED_ORIGINS.
+// Requests without an Origin header come from non-browser clients such as the mobile
+// app and are allowed; an empty allow-list allows every origin.
+func CheckWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || config.GetWebSocketConfig().IsOriginAllowed(origin) {
+		return true
+	}
+
+	colors.PrintWarning("🚫 WebSocket upgrade rejected for origin %s from %s", origin, r.RemoteAddr)
+	return false
 }
 
 // WebSocketHub manages all WebSocket connections
 type WebSocketHub struct {
 	clients    map[*websocket.Conn]*ClientInfo
-	broadcast  chan []byte
+	broadcast  chan deviceBroadcast
 	register   chan *ClientConnection
 	unregister chan *websocket.Conn
 	mutex      sync.RWMutex
+	// Per-IMEI message sequence numbers so clients can detect missed broadcasts, least
+	// recently broadcast devices evicted first (DEVICE_STATE_CAPACITY)
+	sequences *lru.Cache[string, uint64]
+	seqMutex  sync.Mutex
+	// Keepalive settings: ping interval, stale timeout and the read deadline derived from them
+	keepalive *config.WebSocketConfig
 }
 
 // ClientInfo stores information about a connected client
@@ -39,6 +64,23 @@ type ClientInfo struct {
 	AccessibleIMEIs []string
 	IsAuthenticated bool
 	LastActivity    time.Time
+	ConnectedAt     time.Time
+	RemoteAddr      string
+	// Round trip of the last answered ping, and the mean over LatencySamples pings
+	LastLatency    time.Duration
+	AvgLatency     time.Duration
+	LatencySamples int
+	// Payload of the ping waiting for its pong; empty when none is outstanding
+	pendingPing string
+	// All writes to the connection go through the writer
+	writer *ConnWriter
+}
+
+// deviceBroadcast is a message about one device for the clients allowed to see it. The hub
+// loop numbers and encodes it, so clients receive a device's messages in sequence order.
+type deviceBroadcast struct {
+	imei    string
+	message WebSocketMessage
 }
 
 // ClientConnection represents a new client connection
@@ -46,12 +88,14 @@ type ClientConnection struct {
 	Conn   *websocket.Conn
 	UserID uint
 	IMEIs  []string
+	Writer *ConnWriter
 }
 
 // WebSocketMessage represents a WebSocket message
 type WebSocketMessage struct {
 	Type      string      `json:"type"`
 	Timestamp string      `json:"timestamp"`
+	Seq       uint64      `json:"seq,omitempty"` // Per-IMEI sequence number, increments on every broadcast
 	Data      interface{} `json:"data"`
 }
 
@@ -168,6 +212,15 @@ type DeviceInfo struct {
 	Satellites    int  `json:"satellites"`
 }
 
+// StateTransitionUpdate represents a vehicle state transition message
+type StateTransitionUpdate struct {
+	IMEI      string `json:"imei"`
+	State     string `json:"state"` // e.g. "started_moving", "overspeed_start", "ignition_off"
+	Speed     *int   `json:"speed"`
+	Ignition  string `json:"ignition"`
+	Timestamp string `json:"timestamp"`
+}
+
 // AlarmInfo represents alarm status
 type AlarmInfo struct {
 	Active    bool   `json:"active"`
@@ -183,12 +236,36 @@ type AlarmInfo struct {
 func NewWebSocketHub() *WebSocketHub {
 	return &WebSocketHub{
 		clients:    make(map[*websocket.Conn]*ClientInfo),
-		broadcast:  make(chan []byte),
+		broadcast:  make(chan deviceBroadcast),
 		register:   make(chan *ClientConnection),
 		unregister: make(chan *websocket.Conn),
+		sequences:  lru.New[string, uint64](config.GetTCPConfig().DeviceStateCapacity),
+		keepalive:  config.GetWebSocketConfig(),
 	}
 }
 
+// nextSeq increments and returns the sequence number for an IMEI. An evicted device starts
+// again at 1, which clients see as a gap and answer with a refresh.
+func (h *WebSocketHub) nextSeq(imei string) uint64 {
+	h.seqMutex.Lock()
+	defer h.seqMutex.Unlock()
+	seq, _ := h.sequences.Get(imei)
+	seq++
+	h.sequences.Set(imei, seq)
+	return seq
+}
+
+// currentSeqs returns the latest sequence number for each of the given IMEIs
+func (h *WebSocketHub) currentSeqs(imeis []string) map[string]uint64 {
+	h.seqMutex.Lock()
+	defer h.seqMutex.Unlock()
+	seqs := make(map[string]uint64, len(imeis))
+	for _, imei := range imeis {
+		seqs[imei], _ = h.sequences.Peek(imei)
+	}
+	return seqs
+}
+
 // Run starts the WebSocket hub
 func (h *WebSocketHub) Run() {
 	colors.PrintServer("🔗", "WebSocket Hub started - Ready for real-time connections")
@@ -205,6 +282,9 @@ func (h *WebSocketHub) Run() {
 				AccessibleIMEIs: clientConn.IMEIs,
 				IsAuthenticated: true,
 				LastActivity:    time.Now(),
+				ConnectedAt:     time.Now(),
+				RemoteAddr:      clientConn.Conn.RemoteAddr().String(),
+				writer:          clientConn.Writer,
 			}
 			h.mutex.Unlock()
 			colors.PrintConnection("📱", "WebSocket client connected for User ID %d. Total clients: %d", clientConn.UserID, len(h.clients))
@@ -218,22 +298,16 @@ func (h *WebSocketHub) Run() {
 			}
 			h.mutex.Unlock()
 
-		case message := <-h.broadcast:
-			h.mutex.RLock()
-			// To authorize, we need to know the IMEI. We can get this by
-			// unmarshalling the message into a temporary struct.
-			var msg struct {
-				Data struct {
-					IMEI string `json:"imei"`
-				} `json:"data"`
-			}
-			if err := json.Unmarshal(message, &msg); err != nil {
-				colors.PrintError("Could not unmarshal broadcast message for auth: %v", err)
-				h.mutex.RUnlock()
+		case broadcast := <-h.broadcast:
+			imei := broadcast.imei
+			broadcast.message.Seq = h.nextSeq(imei)
+			message, err := json.Marshal(broadcast.message)
+			if err != nil {
+				colors.PrintError("Could not marshal broadcast message for IMEI %s: %v", imei, err)
 				continue
 			}
-			imei := msg.Data.IMEI
 
+			h.mutex.RLock()
 			// Send to authorized clients only with improved error handling
 			clientsToRemove := []*websocket.Conn{}
 			successfulSends := 0
@@ -242,9 +316,7 @@ func (h *WebSocketHub) Run() {
 			for client, clientInfo := range h.clients {
 				totalClients++
 				if clientInfo.IsAuthenticated && h.isClientAuthorizedForIMEI(clientInfo, imei) {
-					// FIXED: Use WriteControl for better error handling and timeouts
-					client.SetWriteDeadline(time.Now().Add(10 * time.Second))
-					err := client.WriteMessage(websocket.TextMessage, message)
+					err := clientInfo.writer.WriteMessage(websocket.TextMessage, message, 10*time.Second)
 
 					if err != nil {
 						colors.PrintError("Error sending WebSocket message to User ID %d: %v", clientInfo.UserID, err)
@@ -276,7 +348,7 @@ func (h *WebSocketHub) Run() {
 
 // monitorConnections monitors connection health and cleans up stale connections
 func (h *WebSocketHub) monitorConnections() {
-	ticker := time.NewTicker(30 * time.Second) // FIXED: Check every 30 seconds instead of 2 minutes
+	ticker := time.NewTicker(h.keepalive.PingInterval / 2)
 	defer ticker.Stop()
 
 	for range ticker.C {
@@ -286,19 +358,17 @@ func (h *WebSocketHub) monitorConnections() {
 		activeConnections := 0
 
 		for client, clientInfo := range h.clients {
-			// FIXED: More lenient timeout - consider connection stale after 10 minutes instead of 5
-			if now.Sub(clientInfo.LastActivity) > 10*time.Minute {
+			if now.Sub(clientInfo.LastActivity) > h.keepalive.StaleTimeout {
 				colors.PrintWarning("Detected stale WebSocket connection for User ID %d (inactive for %v)",
 					clientInfo.UserID, now.Sub(clientInfo.LastActivity))
 				staleConnections = append(staleConnections, client)
 			} else {
 				activeConnections++
 
-				// FIXED: Send periodic ping to keep connections alive
-				if now.Sub(clientInfo.LastActivity) > 1*time.Minute {
-					go func(c *websocket.Conn, uid uint) {
-						c.SetWriteDeadline(time.Now().Add(5 * time.Second))
-						if err := c.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+				// Ping silent clients to keep the connection alive through proxies
+				if now.Sub(clientInfo.LastActivity) > h.keepalive.PingInterval {
+					go func(conn *websocket.Conn, uid uint) {
+						if err := h.Ping(conn); err != nil {
 							colors.PrintDebug("Failed to send ping to User ID %d: %v", uid, err)
 						}
 					}(client, clientInfo.UserID)
@@ -324,6 +394,110 @@ func (h *WebSocketHub) monitorConnections() {
 	}
 }
 
+// Ping sends a ping carrying its send time, so the round trip can be measured when the
+// client's pong echoes it back to RecordPong
+func (h *WebSocketHub) Ping(conn *websocket.Conn) error {
+	h.mutex.Lock()
+	clientInfo, exists := h.clients[conn]
+	if !exists {
+		h.mutex.Unlock()
+		return fmt.Errorf("connection is not registered")
+	}
+	payload := strconv.FormatInt(time.Now().UnixNano(), 10)
+	clientInfo.pendingPing = payload
+	writer := clientInfo.writer
+	h.mutex.Unlock()
+
+	return writer.WriteMessage(websocket.PingMessage, []byte(payload), 5*time.Second)
+}
+
+// RecordPong measures the round trip of the ping a pong answers. Pongs that do not echo
+// the outstanding ping, such as unsolicited ones, are ignored.
+func (h *WebSocketHub) RecordPong(conn *websocket.Conn, appData string, receivedAt time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	clientInfo, exists := h.clients[conn]
+	if !exists || clientInfo.pendingPing == "" || appData != clientInfo.pendingPing {
+		return
+	}
+	clientInfo.pendingPing = ""
+	clientInfo.LastActivity = receivedAt
+
+	sentNanos, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return
+	}
+	latency := receivedAt.Sub(time.Unix(0, sentNanos))
+	if latency < 0 {
+		return
+	}
+
+	clientInfo.LatencySamples++
+	clientInfo.LastLatency = latency
+	clientInfo.AvgLatency += (latency - clientInfo.AvgLatency) / time.Duration(clientInfo.LatencySamples)
+}
+
+// WebSocketClientStats describes one connected client for the admin connections endpoint
+type WebSocketClientStats struct {
+	UserID             uint      `json:"user_id"`
+	RemoteAddr         string    `json:"remote_addr"`
+	ConnectedAt        time.Time `json:"connected_at"`
+	LastActivity       time.Time `json:"last_activity"`
+	AccessibleVehicles int       `json:"accessible_vehicles"`
+	LastLatencyMs      *float64  `json:"last_latency_ms"` // nil until a ping has been answered
+	AvgLatencyMs       *float64  `json:"avg_latency_ms"`
+	LatencySamples     int       `json:"latency_samples"`
+	PingOutstanding    bool      `json:"ping_outstanding"`
+}
+
+// ClientStats returns a snapshot of every connected client, longest connected first
+func (h *WebSocketHub) ClientStats() []WebSocketClientStats {
+	h.mutex.RLock()
+	stats := make([]WebSocketClientStats, 0, len(h.clients))
+	for _, clientInfo := range h.clients {
+		entry := WebSocketClientStats{
+			UserID:             clientInfo.UserID,
+			RemoteAddr:         clientInfo.RemoteAddr,
+			ConnectedAt:        clientInfo.ConnectedAt,
+			LastActivity:       clientInfo.LastActivity,
+			AccessibleVehicles: len(clientInfo.AccessibleIMEIs),
+			LatencySamples:     clientInfo.LatencySamples,
+			PingOutstanding:    clientInfo.pendingPing != "",
+		}
+		if clientInfo.LatencySamples > 0 {
+			last := float64(clientInfo.LastLatency) / float64(time.Millisecond)
+			avg := float64(clientInfo.AvgLatency) / float64(time.Millisecond)
+			entry.LastLatencyMs = &last
+			entry.AvgLatencyMs = &avg
+		}
+		stats = append(stats, entry)
+	}
+	h.mutex.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ConnectedAt.Before(stats[j].ConnectedAt) })
+	return stats
+}
+
+// HandleWebSocketConnections lists the connected WebSocket clients with their ping latency (admin only)
+func HandleWebSocketConnections(c *gin.Context) {
+	if WSHub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "WebSocket hub is not running",
+		})
+		return
+	}
+
+	clients := WSHub.ClientStats()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    clients,
+		"count":   len(clients),
+		"message": "WebSocket connections retrieved successfully",
+	})
+}
+
 // isClientAuthorizedForIMEI checks if client has access to the specific IMEI
 func (h *WebSocketHub) isClientAuthorizedForIMEI(clientInfo *ClientInfo, imei string) bool {
 	// Check if the client has access to this IMEI
@@ -359,10 +533,10 @@ func (h *WebSocketHub) BroadcastGPSUpdate(gpsData *models.GPSData, vehicleName,
 		Course:        gpsData.Course,
 		Altitude:      gpsData.Altitude,
 		Ignition:      gpsData.Ignition,
-		Timestamp:     gpsData.Timestamp.Format("2006-01-02T15:04:05Z"),
+		Timestamp:     config.FormatTimestamp(gpsData.Timestamp),
 		ProtocolName:  gpsData.ProtocolName,
-		IsMoving:      gpsData.Speed != nil && *gpsData.Speed > 0,
-		LastSeen:      time.Now().Format("2006-01-02T15:04:05Z"),
+		IsMoving:      gpsData.Speed != nil && config.IsMovingSpeed(*gpsData.Speed, config.GetMovingSpeedKmh()),
+		LastSeen:      config.FormatTimestamp(time.Now()),
 		LocationValid: gpsData.IsValidLocation(),
 	}
 
@@ -424,14 +598,12 @@ func (h *WebSocketHub) BroadcastGPSUpdate(gpsData *models.GPSData, vehicleName,
 
 	message := WebSocketMessage{
 		Type:      "gps_update",
-		Timestamp: time.Now().Format("2006-01-02T15:04:05Z"),
+		Timestamp: config.FormatTimestamp(time.Now()),
 		Data:      gpsUpdate,
 	}
 
-	if data, err := json.Marshal(message); err == nil {
-		h.broadcast <- data
-		colors.PrintConnection("📡", "Broadcasted GPS update for IMEI %s: %s (%s)", gpsData.IMEI, vehicleName, regNo)
-	}
+	h.broadcast <- deviceBroadcast{imei: gpsData.IMEI, message: message}
+	colors.PrintConnection("📡", "Broadcasted GPS update for IMEI %s: %s (%s)", gpsData.IMEI, vehicleName, regNo)
 }
 
 // BroadcastLocationUpdate broadcasts location data to all authorized clients
@@ -457,21 +629,19 @@ func (h *WebSocketHub) BroadcastLocationUpdate(gpsData *models.GPSData, vehicleN
 		Speed:         gpsData.Speed,
 		Course:        gpsData.Course,
 		Altitude:      gpsData.Altitude,
-		Timestamp:     gpsData.Timestamp.Format("2006-01-02T15:04:05Z"),
+		Timestamp:     config.FormatTimestamp(gpsData.Timestamp),
 		ProtocolName:  gpsData.ProtocolName,
 		LocationValid: gpsData.IsValidLocation(),
 	}
 
 	message := WebSocketMessage{
 		Type:      "location_update",
-		Timestamp: time.Now().Format("2006-01-02T15:04:05Z"),
+		Timestamp: config.FormatTimestamp(time.Now()),
 		Data:      locationUpdate,
 	}
 
-	if data, err := json.Marshal(message); err == nil {
-		h.broadcast <- data
-		colors.PrintConnection("📍", "Broadcasted location update for IMEI %s: %s (%s)", gpsData.IMEI, vehicleName, regNo)
-	}
+	h.broadcast <- deviceBroadcast{imei: gpsData.IMEI, message: message}
+	colors.PrintConnection("📍", "Broadcasted location update for IMEI %s: %s (%s)", gpsData.IMEI, vehicleName, regNo)
 }
 
 // BroadcastStatusUpdate broadcasts status data to all authorized clients
@@ -494,10 +664,10 @@ func (h *WebSocketHub) BroadcastStatusUpdate(gpsData *models.GPSData, vehicleNam
 		VehicleType:  vehicleType,
 		Speed:        gpsData.Speed,
 		Ignition:     gpsData.Ignition,
-		Timestamp:    gpsData.Timestamp.Format("2006-01-02T15:04:05Z"),
+		Timestamp:    config.FormatTimestamp(gpsData.Timestamp),
 		ProtocolName: gpsData.ProtocolName,
-		IsMoving:     gpsData.Speed != nil && *gpsData.Speed > 0,
-		LastSeen:     time.Now().Format("2006-01-02T15:04:05Z"),
+		IsMoving:     gpsData.Speed != nil && config.IsMovingSpeed(*gpsData.Speed, config.GetMovingSpeedKmh()),
+		LastSeen:     config.FormatTimestamp(time.Now()),
 	}
 
 	// Add enhanced status information
@@ -558,14 +728,12 @@ func (h *WebSocketHub) BroadcastStatusUpdate(gpsData *models.GPSData, vehicleNam
 
 	message := WebSocketMessage{
 		Type:      "status_update",
-		Timestamp: time.Now().Format("2006-01-02T15:04:05Z"),
+		Timestamp: config.FormatTimestamp(time.Now()),
 		Data:      statusUpdate,
 	}
 
-	if data, err := json.Marshal(message); err == nil {
-		h.broadcast <- data
-		colors.PrintConnection("📊", "Broadcasted status update for IMEI %s: %s (%s)", gpsData.IMEI, vehicleName, regNo)
-	}
+	h.broadcast <- deviceBroadcast{imei: gpsData.IMEI, message: message}
+	colors.PrintConnection("📊", "Broadcasted status update for IMEI %s: %s (%s)", gpsData.IMEI, vehicleName, regNo)
 }
 
 // BroadcastDeviceStatus broadcasts device status to all authorized clients
@@ -607,7 +775,7 @@ func (h *WebSocketHub) BroadcastDeviceStatus(imei, status, vehicleReg string) {
 	statusUpdate := DeviceStatus{
 		IMEI:        imei,
 		Status:      status,
-		LastSeen:    time.Now().Format("2006-01-02T15:04:05Z"),
+		LastSeen:    config.FormatTimestamp(time.Now()),
 		VehicleReg:  vehicleReg,
 		VehicleName: vehicleName,
 		VehicleType: vehicleType,
@@ -617,14 +785,12 @@ func (h *WebSocketHub) BroadcastDeviceStatus(imei, status, vehicleReg string) {
 
 	message := WebSocketMessage{
 		Type:      "device_status",
-		Timestamp: time.Now().Format("2006-01-02T15:04:05Z"),
+		Timestamp: config.FormatTimestamp(time.Now()),
 		Data:      statusUpdate,
 	}
 
-	if data, err := json.Marshal(message); err == nil {
-		h.broadcast <- data
-		colors.PrintConnection("📡", "Broadcasted device status for IMEI %s: %s (%s)", imei, status, vehicleName)
-	}
+	h.broadcast <- deviceBroadcast{imei: imei, message: message}
+	colors.PrintConnection("📡", "Broadcasted device status for IMEI %s: %s (%s)", imei, status, vehicleName)
 }
 
 // HandleWebSocket handles WebSocket connections with user authentication
@@ -637,21 +803,14 @@ func HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	// Validate user token and get user information
-	var user models.User
-	if err := db.GetDB().Where("token = ?", token).First(&user).Error; err != nil {
-		colors.PrintError("WebSocket connection attempted with invalid token")
+	// Validate user token (legacy or JWT) and get user information
+	user, err := middleware.AuthenticateToken(token)
+	if err != nil {
+		colors.PrintError("WebSocket connection attempted with invalid token: %v", err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		return
 	}
 
-	// Check if token is valid (exists)
-	if !user.IsTokenValid() {
-		colors.PrintError("WebSocket connection attempted with expired token")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
-		return
-	}
-
 	// Get user's accessible vehicles
 	var userVehicles []models.UserVehicle
 	if err := db.GetDB().Where("user_id = ? AND is_active = ? AND (live_tracking = ? OR all_access = ?)",
@@ -681,11 +840,7 @@ func HandleWebSocket(c *gin.Context) {
 	colors.PrintConnection("🔗", "New WebSocket connection established for User ID %d from %s", user.ID, c.ClientIP())
 
 	// Register the connection with user information
-	WSHub.register <- &ClientConnection{
-		Conn:   conn,
-		UserID: user.ID,
-		IMEIs:  accessibleIMEIs,
-	}
+	writer := WSHub.Register(conn, user.ID, accessibleIMEIs)
 
 	// Handle connection in a goroutine
 	go func() {
@@ -698,30 +853,34 @@ func HandleWebSocket(c *gin.Context) {
 		// Send initial welcome message with user's accessible vehicles
 		welcomeMsg := WebSocketMessage{
 			Type:      "welcome",
-			Timestamp: time.Now().Format(time.RFC3339),
+			Timestamp: config.FormatTimestamp(time.Now()),
 			Data: map[string]interface{}{
 				"user_id":          user.ID,
 				"accessible_imeis": accessibleIMEIs,
+				"seq":              WSHub.currentSeqs(accessibleIMEIs),
 				"message":          "WebSocket connection established",
 			},
 		}
 
 		if welcomeData, err := json.Marshal(welcomeMsg); err == nil {
-			if err := conn.WriteMessage(websocket.TextMessage, welcomeData); err != nil {
+			if err := writer.WriteMessage(websocket.TextMessage, welcomeData, 10*time.Second); err != nil {
 				colors.PrintError("Failed to send welcome message to User ID %d: %v", user.ID, err)
 			}
 		}
 
-		// Set up ping/pong for connection health monitoring
-		conn.SetPongHandler(func(string) error {
-			conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		// Set up ping/pong for connection health monitoring. The read deadline outlasts the
+		// hub's ping schedule, so a client that answers pings stays connected while silent.
+		readTimeout := WSHub.keepalive.ReadTimeout()
+		conn.SetPongHandler(func(appData string) error {
+			conn.SetReadDeadline(time.Now().Add(readTimeout))
+			WSHub.RecordPong(conn, appData, time.Now())
 			return nil
 		})
 
 		// Keep connection alive and handle incoming messages
 		for {
 			// Set read deadline to detect stale connections
-			conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			conn.SetReadDeadline(time.Now().Add(readTimeout))
 
 			_, message, err := conn.ReadMessage()
 			if err != nil {
@@ -735,7 +894,7 @@ func HandleWebSocket(c *gin.Context) {
 
 			// Handle ping messages
 			if string(message) == "ping" {
-				if err := conn.WriteMessage(websocket.TextMessage, []byte("pong")); err != nil {
+				if err := writer.WriteMessage(websocket.TextMessage, []byte("pong"), 10*time.Second); err != nil {
 					colors.PrintError("Failed to send pong to User ID %d: %v", user.ID, err)
 					break
 				}
@@ -751,10 +910,28 @@ func HandleWebSocket(c *gin.Context) {
 	}()
 }
 
+// Register adds an authenticated connection to the hub and returns the writer that
+// the caller must use for its own writes to the connection
+func (h *WebSocketHub) Register(conn *websocket.Conn, userID uint, imeis []string) *ConnWriter {
+	writer := NewConnWriter(conn)
+	h.register <- &ClientConnection{
+		Conn:   conn,
+		UserID: userID,
+		IMEIs:  imeis,
+		Writer: writer,
+	}
+	return writer
+}
+
 // InitializeWebSocket initializes the global WebSocket hub
 func InitializeWebSocket() {
 	WSHub = NewWebSocketHub()
 	go WSHub.Run()
+
+	// Deliver notifications to connected users in real time
+	services.SetInAppNotifier(WSHub.BroadcastNotification)
+	services.SetStateTransitionNotifier(WSHub.BroadcastStateTransition)
+	services.SetGPSBroadcaster(WSHub.BroadcastSavedGPS)
 }
 
 // Helper functions for status calculations
@@ -842,14 +1019,44 @@ func (h *WebSocketHub) BroadcastFullGPSUpdate(gpsData *models.GPSData) {
 	h.BroadcastGPSUpdate(gpsData, vehicle.Name, vehicle.RegNo)
 }
 
+// BroadcastSavedGPS sends a freshly saved row: the full GPS update when it has a location,
+// otherwise a status update
+func (h *WebSocketHub) BroadcastSavedGPS(gpsData *models.GPSData, located bool) {
+	if located {
+		h.BroadcastFullGPSUpdate(gpsData)
+		return
+	}
+	h.BroadcastStatusUpdate(gpsData, "", "")
+}
+
+// BroadcastStateTransition sends a vehicle state transition to all authorized clients,
+// so dashboards can react without waiting for the push notification
+func (h *WebSocketHub) BroadcastStateTransition(transition *services.VehicleStateTransition) {
+	if h == nil {
+		return
+	}
+
+	message := WebSocketMessage{
+		Type:      "state_transition",
+		Timestamp: config.FormatTimestamp(time.Now()),
+		Data: StateTransitionUpdate{
+			IMEI:      transition.IMEI,
+			State:     string(transition.State),
+			Speed:     transition.Speed,
+			Ignition:  transition.Ignition,
+			Timestamp: config.FormatTimestamp(transition.Timestamp),
+		},
+	}
+
+	h.broadcast <- deviceBroadcast{imei: transition.IMEI, message: message}
+	colors.PrintConnection("🚦", "Broadcasted state transition for IMEI %s: %s", transition.IMEI, transition.State)
+}
+
 // BroadcastLogoutNotification sends a logout notification to all clients of a specific user
 func (h *WebSocketHub) BroadcastLogoutNotification(userID uint, reason string) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
-
 	logoutMessage := WebSocketMessage{
 		Type:      "logout_notification",
-		Timestamp: time.Now().Format(time.RFC3339),
+		Timestamp: config.FormatTimestamp(time.Now()),
 		Data: map[string]interface{}{
 			"reason":  reason,
 			"user_id": userID,
@@ -862,20 +1069,161 @@ func (h *WebSocketHub) BroadcastLogoutNotification(userID uint, reason string) {
 		return
 	}
 
-	// Send logout notification to all clients of this user
+	colors.PrintInfo("Sending logout notification to clients of user %d", userID)
+	h.sendToUser(userID, messageBytes)
+}
+
+// BroadcastNotification pushes an in-app notification to all clients of a specific user
+func (h *WebSocketHub) BroadcastNotification(userID uint, notification *services.InAppNotification) {
+	if h == nil {
+		return
+	}
+
+	message := WebSocketMessage{
+		Type:      "notification",
+		Timestamp: config.FormatTimestamp(time.Now()),
+		Data:      notification,
+	}
+
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		colors.PrintError("Failed to marshal notification for user %d: %v", userID, err)
+		return
+	}
+
+	if sent := h.sendToUser(userID, messageBytes); sent > 0 {
+		colors.PrintConnection("🔔", "Sent notification to %d clients of user %d: %s", sent, userID, notification.Title)
+	}
+}
+
+// Levels of a system message, which clients may use to style the banner
+const (
+	SystemMessageInfo     = "info"
+	SystemMessageWarning  = "warning"
+	SystemMessageCritical = "critical"
+)
+
+// MaxSystemMessageLength bounds the text of a system message
+const MaxSystemMessageLength = 500
+
+// IsValidSystemMessageLevel reports whether level is one of the system message levels
+func IsValidSystemMessageLevel(level string) bool {
+	return level == SystemMessageInfo || level == SystemMessageWarning || level == SystemMessageCritical
+}
+
+// SystemMessage is a banner shown on every live dashboard, such as a maintenance warning
+type SystemMessage struct {
+	Level string `json:"level"`
+	Text  string `json:"text"`
+}
+
+// BroadcastSystemMessage sends a system_message to every connected client, whatever vehicles
+// it may see, and returns how many clients received it
+func (h *WebSocketHub) BroadcastSystemMessage(level, text string) int {
+	if h == nil {
+		return 0
+	}
+
+	message := WebSocketMessage{
+		Type:      "system_message",
+		Timestamp: config.FormatTimestamp(time.Now()),
+		Data:      SystemMessage{Level: level, Text: text},
+	}
+
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		colors.PrintError("Failed to marshal system message: %v", err)
+		return 0
+	}
+
+	sent := h.sendToClients(messageBytes, func(*ClientInfo) bool { return true })
+	colors.PrintConnection("📢", "Sent %s system message to %d clients", level, sent)
+	return sent
+}
+
+// HandleWebSocketSystemMessage broadcasts a system message to every connected client (admin only)
+func HandleWebSocketSystemMessage(c *gin.Context) {
+	var req struct {
+		Level   string `json:"level"`
+		Message string `json:"message" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+		})
+		return
+	}
+
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Level == "" {
+		req.Level = SystemMessageInfo
+	}
+	if !IsValidSystemMessageLevel(req.Level) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "level must be info, warning or critical",
+		})
+		return
+	}
+	if req.Message == "" || len(req.Message) > MaxSystemMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("message must be between 1 and %d characters", MaxSystemMessageLength),
+		})
+		return
+	}
+
+	if WSHub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "WebSocket hub is not running",
+		})
+		return
+	}
+
+	sent := WSHub.BroadcastSystemMessage(req.Level, req.Message)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"level":      req.Level,
+			"message":    req.Message,
+			"recipients": sent,
+		},
+		"message": "System message broadcast successfully",
+	})
+}
+
+// sendToUser writes a message to every client of the user and returns how many received it
+func (h *WebSocketHub) sendToUser(userID uint, message []byte) int {
+	return h.sendToClients(message, func(clientInfo *ClientInfo) bool { return clientInfo.UserID == userID })
+}
+
+// sendToClients writes a message to every client matching the filter, bypassing the per-IMEI
+// authorization of broadcasts, and returns how many received it. The hub lock guards
+// LastActivity; each client's writer keeps the writes themselves serialized.
+func (h *WebSocketHub) sendToClients(message []byte, matches func(*ClientInfo) bool) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	sent := 0
 	for conn, clientInfo := range h.clients {
-		if clientInfo.UserID == userID {
-			colors.PrintInfo("Sending logout notification to client for user %d", userID)
-			err := conn.WriteMessage(websocket.TextMessage, messageBytes)
-			if err != nil {
-				colors.PrintError("Failed to send logout notification: %v", err)
-				// The client is likely disconnected, so we unregister them
-				go func(c *websocket.Conn) {
-					h.unregister <- c
-				}(conn)
-			}
+		if !matches(clientInfo) {
+			continue
+		}
+
+		if err := clientInfo.writer.WriteMessage(websocket.TextMessage, message, 10*time.Second); err != nil {
+			colors.PrintError("Failed to send message to client of user %d: %v", clientInfo.UserID, err)
+			// The client is likely disconnected, so we unregister them
+			go func(c *websocket.Conn) {
+				h.unregister <- c
+			}(conn)
+			continue
 		}
+		clientInfo.LastActivity = time.Now()
+		sent++
 	}
+	return sent
 }
 
 // BroadcastLogoutNotificationGlobal sends a logout notification using the global WSHub
@@ -0,0 +1,30 @@
+package http
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConnWriter serializes writes to one WebSocket connection. gorilla/websocket allows only
+// one concurrent writer, while the broadcast loop, user notifications, the health check
+// pings and the client's own goroutine (welcome, pong) all write to the same connection.
+type ConnWriter struct {
+	conn  *websocket.Conn
+	mutex sync.Mutex
+}
+
+// NewConnWriter wraps a connection; every write to it must then go through the writer
+func NewConnWriter(conn *websocket.Conn) *ConnWriter {
+	return &ConnWriter{conn: conn}
+}
+
+// WriteMessage writes one message, giving up after timeout
+func (w *ConnWriter) WriteMessage(messageType int, data []byte, timeout time.Duration) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.conn.SetWriteDeadline(time.Now().Add(timeout))
+	return w.conn.WriteMessage(messageType, data)
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// Audited actions
+const (
+	AuditActionOilCut            = "control.cut_oil"
+	AuditActionOilConnect        = "control.connect_oil"
+	AuditActionDeviceDelete      = "device.delete"
+	AuditActionVehicleDelete     = "vehicle.delete"
+	AuditActionUserDelete        = "user.delete"
+	AuditActionGPSDataDelete     = "gps_data.delete"
+	AuditActionGPSDataInject     = "gps_data.inject"
+	AuditActionVehicleShare      = "vehicle.share"
+	AuditActionVehicleRevoke     = "vehicle.revoke_share"
+	AuditActionAccessAssign      = "user_vehicle.assign"
+	AuditActionAccessBulkAssign  = "user_vehicle.bulk_assign"
+	AuditActionAccessPermissions = "user_vehicle.update_permissions"
+	AuditActionAccessMainUser    = "user_vehicle.set_main_user"
+	AuditActionAccessRevoke      = "user_vehicle.revoke"
+)
+
+// Audit results, from the response status of the audited request
+const (
+	AuditResultSuccess  = "success"
+	AuditResultRejected = "rejected" // Refused by permissions, validation or a cooldown
+	AuditResultFailed   = "failed"
+)
+
+// AuditLog records who performed a security-sensitive action, on what, from where and how it ended
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	ActorID    *uint     `json:"actor_id" gorm:"index"` // nil when the actor is not authenticated
+	ActorName  string    `json:"actor_name" gorm:"size:100"`
+	ActorRole  string    `json:"actor_role" gorm:"size:20"`
+	Action     string    `json:"action" gorm:"size:50;not null;index"`
+	TargetType string    `json:"target_type" gorm:"size:30;index:idx_audit_logs_target"`
+	TargetID   string    `json:"target_id" gorm:"size:50;index:idx_audit_logs_target"`
+	IPAddress  string    `json:"ip_address" gorm:"size:45"`
+	RequestID  string    `json:"request_id" gorm:"size:128;index"` // X-Request-ID of the request, to find its log lines
+	Result     string    `json:"result" gorm:"size:20;not null;index"`
+	StatusCode int       `json:"status_code"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
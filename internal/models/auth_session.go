@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// AuthSession is a login session backing short-lived JWT access tokens.
+// The refresh token is only stored as a SHA-256 hash.
+type AuthSession struct {
+	ID               uint       `json:"id" gorm:"primarykey"`
+	SessionID        string     `json:"session_id" gorm:"size:36;uniqueIndex;not null"`
+	UserID           uint       `json:"user_id" gorm:"not null;index"`
+	RefreshTokenHash string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	UserAgent        string     `json:"user_agent" gorm:"size:255"`
+	IPAddress        string     `json:"ip_address" gorm:"size:45"`
+	ExpiresAt        time.Time  `json:"expires_at" gorm:"not null;index"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at" gorm:"index"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (AuthSession) TableName() string {
+	return "auth_sessions"
+}
+
+// IsRevoked checks if the session has been revoked
+func (s *AuthSession) IsRevoked() bool {
+	return s.RevokedAt != nil
+}
+
+// IsUsable checks if the session can still be refreshed
+func (s *AuthSession) IsUsable() bool {
+	return !s.IsRevoked() && time.Now().Before(s.ExpiresAt)
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// ControlCommandStatus is whether an oil/electricity command took effect on the device
+type ControlCommandStatus string
+
+const (
+	ControlCommandPending    ControlCommandStatus = "pending"    // Sent, waiting for the next status packet
+	ControlCommandConfirmed  ControlCommandStatus = "confirmed"  // The status packet showed the requested state
+	ControlCommandFailed     ControlCommandStatus = "failed"     // The status packet still showed the other state
+	ControlCommandSuperseded ControlCommandStatus = "superseded" // A newer command was sent before a status packet arrived
+)
+
+// ControlCommand records an oil/electricity command sent to a device. The device's
+// next status packet reports OilElectricity, which confirms whether it took effect.
+type ControlCommand struct {
+	ID                     uint                 `json:"id" gorm:"primarykey"`
+	IMEI                   string               `json:"imei" gorm:"size:16;not null;index:idx_control_commands_imei_status"`
+	Command                string               `json:"command" gorm:"size:20;not null"` // e.g. DYD#
+	Channel                string               `json:"channel" gorm:"size:10;not null"` // tcp or sms
+	ExpectedOilElectricity string               `json:"expected_oil_electricity" gorm:"size:20;not null"`
+	Status                 ControlCommandStatus `json:"status" gorm:"size:20;not null;default:'pending';index:idx_control_commands_imei_status"`
+	ObservedOilElectricity string               `json:"observed_oil_electricity" gorm:"size:20"`
+	RequestedBy            *uint                `json:"requested_by"` // User who sent the command
+	SentAt                 time.Time            `json:"sent_at" gorm:"not null"`
+	ResolvedAt             *time.Time           `json:"resolved_at"`
+	CreatedAt              time.Time            `json:"created_at"`
+	UpdatedAt              time.Time            `json:"updated_at"`
+}
+
+func (ControlCommand) TableName() string {
+	return "control_commands"
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"regexp"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -25,7 +27,7 @@ const (
 type Device struct {
 	ID          uint        `json:"id" gorm:"primarykey"`
 	IMEI        string      `json:"imei" gorm:"uniqueIndex;not null;size:16" validate:"required,len=16"`
-	SimNo       string      `json:"sim_no" gorm:"size:20" validate:"required"`
+	SimNo       string      `json:"sim_no" gorm:"size:20;index" validate:"required"`
 	SimOperator SimOperator `json:"sim_operator" gorm:"type:varchar(10);not null" validate:"required,oneof=Ncell Ntc"`
 	Protocol    Protocol    `json:"protocol" gorm:"type:varchar(10);not null;default:'GT06'" validate:"required"`
 	ICCID       string      `json:"iccid" gorm:"type:text"`
@@ -37,6 +39,35 @@ type Device struct {
 	Model DeviceModel `json:"model,omitempty" gorm:"foreignKey:ModelID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
 }
 
+// simNumberPattern matches a SIM phone number: 7 to 15 digits with an optional leading +
+var simNumberPattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// iccidPattern matches an ICCID: 18 to 20 digits starting with the telecom prefix 89
+var iccidPattern = regexp.MustCompile(`^89[0-9]{16,18}$`)
+
+// simSeparatorReplacer removes the spaces and dashes people type into SIM numbers
+var simSeparatorReplacer = strings.NewReplacer(" ", "", "-", "")
+
+// NormalizeSimNumber strips separators from a SIM phone number
+func NormalizeSimNumber(simNo string) string {
+	return simSeparatorReplacer.Replace(strings.TrimSpace(simNo))
+}
+
+// NormalizeICCID strips separators from an ICCID
+func NormalizeICCID(iccid string) string {
+	return simSeparatorReplacer.Replace(strings.TrimSpace(iccid))
+}
+
+// IsValidSimNumber checks if the normalized SIM number is a phone number
+func IsValidSimNumber(simNo string) bool {
+	return simNumberPattern.MatchString(simNo)
+}
+
+// IsValidICCID checks if the ICCID is empty (not recorded) or an 18 to 20 digit SIM card number
+func IsValidICCID(iccid string) bool {
+	return iccid == "" || iccidPattern.MatchString(iccid)
+}
+
 // TableName specifies the table name for Device model
 func (Device) TableName() string {
 	return "devices"
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// Driver is a person who drives fleet vehicles. Drivers belong to the user who
+// created them and are linked to vehicles through VehicleDriverAssignment.
+type Driver struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	OwnerID   uint      `json:"owner_id" gorm:"not null;index"`
+	Name      string    `json:"name" gorm:"size:100;not null"`
+	Phone     string    `json:"phone" gorm:"size:20"`
+	LicenseNo string    `json:"license_no" gorm:"size:50"`
+	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Driver) TableName() string {
+	return "drivers"
+}
+
+// VehicleDriverAssignment records who drove a vehicle between StartTime and EndTime.
+// A nil EndTime means the driver is still assigned.
+type VehicleDriverAssignment struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	VehicleID  string     `json:"vehicle_id" gorm:"size:16;not null;index"` // IMEI
+	DriverID   uint       `json:"driver_id" gorm:"not null;index"`
+	StartTime  time.Time  `json:"start_time" gorm:"not null;index"`
+	EndTime    *time.Time `json:"end_time" gorm:"index"`
+	AssignedBy uint       `json:"assigned_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	Driver  Driver  `json:"driver,omitempty" gorm:"foreignKey:DriverID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Vehicle Vehicle `json:"vehicle,omitempty" gorm:"foreignKey:VehicleID;references:IMEI;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (VehicleDriverAssignment) TableName() string {
+	return "vehicle_driver_assignments"
+}
+
+// IsCurrent reports whether the assignment has not been ended
+func (a *VehicleDriverAssignment) IsCurrent() bool {
+	return a.EndTime == nil
+}
+
+// Overlap returns how much of the window [from, to] the assignment covers
+func (a *VehicleDriverAssignment) Overlap(from, to time.Time) time.Duration {
+	start := a.StartTime
+	if from.After(start) {
+		start = from
+	}
+	end := to
+	if a.EndTime != nil && a.EndTime.Before(end) {
+		end = *a.EndTime
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// Covers reports whether the driver was assigned at time t
+func (a *VehicleDriverAssignment) Covers(t time.Time) bool {
+	return !t.Before(a.StartTime) && (a.EndTime == nil || t.Before(*a.EndTime))
+}
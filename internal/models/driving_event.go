@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// Driving event types
+const (
+	DrivingEventHarshBraking      = "harsh_braking"
+	DrivingEventHarshAcceleration = "harsh_acceleration"
+)
+
+// IsValidDrivingEventType reports whether eventType is one of the driving event types
+func IsValidDrivingEventType(eventType string) bool {
+	return eventType == DrivingEventHarshBraking || eventType == DrivingEventHarshAcceleration
+}
+
+// DrivingEvent is a harsh braking or acceleration detected between two consecutive fixes
+// of a vehicle. Timestamp and position are those of the later fix.
+type DrivingEvent struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	IMEI         string    `json:"imei" gorm:"size:16;not null;uniqueIndex:idx_driving_events_imei_time_type,priority:1"`
+	Timestamp    time.Time `json:"timestamp" gorm:"not null;uniqueIndex:idx_driving_events_imei_time_type,priority:2"`
+	Type         string    `json:"type" gorm:"size:30;not null;uniqueIndex:idx_driving_events_imei_time_type,priority:3"`
+	StartSpeed   int       `json:"start_speed"`  // km/h at the earlier fix
+	EndSpeed     int       `json:"end_speed"`    // km/h at the later fix
+	Seconds      float64   `json:"seconds"`      // Time between the two fixes
+	Acceleration float64   `json:"acceleration"` // m/s², negative when braking
+	Latitude     *float64  `json:"latitude"`
+	Longitude    *float64  `json:"longitude"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (DrivingEvent) TableName() string {
+	return "driving_events"
+}
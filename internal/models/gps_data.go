@@ -13,6 +13,9 @@ type GPSData struct {
 	IMEI      string    `json:"imei" gorm:"size:16;not null;index" validate:"required,len=16"`
 	Timestamp time.Time `json:"timestamp" gorm:"not null;index"`
 
+	// GPS date-time exactly as the device sent it; Timestamp is the same instant in UTC
+	DeviceTime *time.Time `json:"device_time"`
+
 	// GPS Location Data
 	Latitude  *float64 `json:"latitude"`
 	Longitude *float64 `json:"longitude"`
@@ -20,6 +23,9 @@ type GPSData struct {
 	Course    *int     `json:"course"`   // degrees (0-360)
 	Altitude  *int     `json:"altitude"` // meters
 
+	// Where Speed came from: "device" as reported, or "computed" from position deltas
+	SpeedSource string `json:"speed_source" gorm:"size:10"`
+
 	// GPS Status
 	GPSRealTime   *bool `json:"gps_real_time"`
 	GPSPositioned *bool `json:"gps_positioned"`
@@ -44,6 +50,11 @@ type GPSData struct {
 	LAC    *int `json:"lac"`     // Location Area Code
 	CellID *int `json:"cell_id"` // Cell ID
 
+	// Derived Data (computed on insert, backfilled for older rows)
+	Accuracy         string   `json:"accuracy" gorm:"size:10"` // good/fair/poor/unknown
+	HasLBS           bool     `json:"has_lbs"`                 // Cell tower data present
+	DistanceFromPrev *float64 `json:"distance_from_prev"`      // km from the previous located point
+
 	// Alarm Data
 	AlarmActive bool   `json:"alarm_active"`
 	AlarmType   string `json:"alarm_type"`
@@ -73,9 +84,36 @@ func (g *GPSData) BeforeCreate(tx *gorm.DB) error {
 	if g.Timestamp.IsZero() {
 		g.Timestamp = time.Now()
 	}
+
+	g.Accuracy = g.AccuracyBucket()
+	g.HasLBS = g.HasLBSData()
 	return nil
 }
 
+// AccuracyBucket classifies the fix quality from satellite count and positioning
+func (g *GPSData) AccuracyBucket() string {
+	if g.GPSPositioned != nil && !*g.GPSPositioned {
+		return "poor"
+	}
+	if g.Satellites == nil {
+		return "unknown"
+	}
+
+	switch {
+	case *g.Satellites >= 7:
+		return "good"
+	case *g.Satellites >= 4:
+		return "fair"
+	default:
+		return "poor"
+	}
+}
+
+// HasLBSData checks if the record carries cell tower (LBS) information
+func (g *GPSData) HasLBSData() bool {
+	return g.MCC != nil && g.LAC != nil && g.CellID != nil
+}
+
 // IsValidLocation checks if GPS coordinates are valid
 func (g *GPSData) IsValidLocation() bool {
 	// Only check if coordinates are not null
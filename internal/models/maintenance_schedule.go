@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// MaintenanceSchedule is a recurring service for a vehicle, due every IntervalKm
+// kilometres or IntervalEngineHours engine hours, whichever comes first. Usage is
+// counted from the baseline, which moves forward each time the service is done.
+type MaintenanceSchedule struct {
+	ID                  uint    `json:"id" gorm:"primarykey"`
+	VehicleID           string  `json:"vehicle_id" gorm:"size:16;not null;index"` // IMEI
+	Name                string  `json:"name" gorm:"size:100;not null"`
+	IntervalKm          float64 `json:"interval_km" gorm:"default:0"`           // 0 = not distance based
+	IntervalEngineHours float64 `json:"interval_engine_hours" gorm:"default:0"` // 0 = not engine-hours based
+
+	// Usage at the last service; distance is summed from BaselineAt
+	BaselineAt          time.Time `json:"baseline_at" gorm:"not null"`
+	BaselineEngineHours float64   `json:"baseline_engine_hours" gorm:"default:0"`
+
+	LastServicedAt *time.Time `json:"last_serviced_at"`
+	NotifiedAt     *time.Time `json:"notified_at"` // Reminder sent for the current interval
+	IsActive       bool       `json:"is_active" gorm:"default:true"`
+	CreatedBy      uint       `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	Vehicle Vehicle `json:"-" gorm:"foreignKey:VehicleID;references:IMEI;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (MaintenanceSchedule) TableName() string {
+	return "maintenance_schedules"
+}
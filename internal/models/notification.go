@@ -31,6 +31,14 @@ type Notification struct {
 	Creator User `json:"creator,omitempty" gorm:"foreignKey:CreatedBy;references:ID"`
 }
 
+// Per-recipient push delivery states recorded on NotificationUser
+const (
+	DeliveryStatusPending   = "pending"   // Not sent yet
+	DeliveryStatusDelivered = "delivered" // Accepted for at least one of the user's devices
+	DeliveryStatusFailed    = "failed"    // Rejected for every device of the user
+	DeliveryStatusNoToken   = "no_token"  // User has no registered device to send to
+)
+
 // NotificationUser represents the many-to-many relationship between notifications and users
 type NotificationUser struct {
 	ID             uint       `json:"id" gorm:"primarykey;autoIncrement"`
@@ -40,6 +48,11 @@ type NotificationUser struct {
 	ReadAt         *time.Time `json:"read_at"`
 	IsSent         bool       `json:"is_sent" gorm:"default:false"`
 	SentAt         *time.Time `json:"sent_at"`
+	DeliveryStatus string     `json:"delivery_status" gorm:"size:20;default:'pending';index"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	DeliveryError  string     `json:"delivery_error" gorm:"type:text"`
+	DevicesSent    int        `json:"devices_sent" gorm:"default:0"`
+	DevicesFailed  int        `json:"devices_failed" gorm:"default:0"`
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// NotificationTemplate is a named title/body pair with {variable} placeholders
+// that are filled from a data map before a notification is sent.
+// Each name can have one template per language.
+type NotificationTemplate struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	Name        string    `json:"name" gorm:"size:100;not null;uniqueIndex:idx_notification_templates_name_language"`
+	Language    string    `json:"language" gorm:"size:5;not null;default:'en';uniqueIndex:idx_notification_templates_name_language"`
+	Title       string    `json:"title" gorm:"size:255;not null"`
+	Body        string    `json:"body" gorm:"type:text;not null"`
+	Type        string    `json:"type" gorm:"size:50;default:'alert'"`
+	Description string    `json:"description" gorm:"size:255"`
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (NotificationTemplate) TableName() string {
+	return "notification_templates"
+}
@@ -9,6 +9,12 @@ import (
 	"gorm.io/gorm"
 )
 
+// Supported notification languages
+const (
+	LanguageEnglish = "en"
+	LanguageNepali  = "ne"
+)
+
 // UserRole represents the user role enum
 type UserRole int
 
@@ -30,6 +36,7 @@ type User struct {
 	Token     string     `json:"-" gorm:"size:255;uniqueIndex"` // Authentication token (hidden from JSON)
 	TokenExp  *time.Time `json:"-" gorm:"index"`                // Token expiration time
 	FCMToken  string     `json:"fcm_token" gorm:"size:255"`     // Firebase Cloud Messaging token
+	Language  string     `json:"language" gorm:"size:5;default:'en'"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 
@@ -119,9 +126,9 @@ func (u *User) ClearToken() {
 	u.TokenExp = nil
 }
 
-// GetRoleString returns the string representation of the user role
-func (u *User) GetRoleString() string {
-	switch u.Role {
+// String returns the string representation of the role
+func (r UserRole) String() string {
+	switch r {
 	case UserRoleAdmin:
 		return "admin"
 	case UserRoleClient:
@@ -131,6 +138,24 @@ func (u *User) GetRoleString() string {
 	}
 }
 
+// GetRoleString returns the string representation of the user role
+func (u *User) GetRoleString() string {
+	return u.Role.String()
+}
+
+// IsValidLanguage checks if the language code is one notifications can be sent in
+func IsValidLanguage(language string) bool {
+	return language == LanguageEnglish || language == LanguageNepali
+}
+
+// GetLanguage returns the user's notification language, defaulting to English
+func (u *User) GetLanguage() string {
+	if IsValidLanguage(u.Language) {
+		return u.Language
+	}
+	return LanguageEnglish
+}
+
 // ToSafeUser returns user data without sensitive information
 func (u *User) ToSafeUser() map[string]interface{} {
 	return map[string]interface{}{
@@ -141,6 +166,7 @@ func (u *User) ToSafeUser() map[string]interface{} {
 		"role":           u.Role,
 		"image":          u.Image,
 		"is_active":      u.IsActive,
+		"language":       u.GetLanguage(),
 		"role_name":      u.GetRoleString(),
 		"vehicle_access": u.VehicleAccess,
 		"vehicles":       u.Vehicles,
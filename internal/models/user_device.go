@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// Device platforms reported when registering a push token
+const (
+	DevicePlatformAndroid = "android"
+	DevicePlatformIOS     = "ios"
+	DevicePlatformWeb     = "web"
+	DevicePlatformUnknown = "unknown"
+)
+
+// UserDevice stores one FCM push token per app installation, so a user
+// signed in on several phones receives notifications on all of them
+type UserDevice struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	FCMToken   string    `json:"fcm_token" gorm:"size:255;not null;uniqueIndex"`
+	Platform   string    `json:"platform" gorm:"size:20;default:'unknown'"`
+	DeviceName string    `json:"device_name" gorm:"size:100"`
+	IsActive   bool      `json:"is_active" gorm:"default:true;index"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (UserDevice) TableName() string {
+	return "user_devices"
+}
+
+// IsValidDevicePlatform checks if the platform is one of the known platforms
+func IsValidDevicePlatform(platform string) bool {
+	switch platform {
+	case DevicePlatformAndroid, DevicePlatformIOS, DevicePlatformWeb, DevicePlatformUnknown:
+		return true
+	default:
+		return false
+	}
+}
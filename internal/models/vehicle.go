@@ -1,6 +1,7 @@
 package models
 
 import (
+	"regexp"
 	"time"
 
 	"gorm.io/gorm"
@@ -30,6 +31,28 @@ type Vehicle struct {
 	CreatedAt   time.Time   `json:"created_at"`
 	UpdatedAt   time.Time   `json:"updated_at"`
 
+	// Set when the owner calibrates Odometer against the physical reading; distance
+	// is then accumulated from this point instead of from the start of the day
+	OdometerCalibratedAt *time.Time `json:"odometer_calibrated_at"`
+
+	// Cumulative engine running time, accumulated from the ignition state of incoming
+	// GPS and status data. EngineOn and EngineHoursUpdatedAt describe the last sample
+	// counted, so accumulation resumes correctly after a restart.
+	EngineHours          float64    `json:"engine_hours" gorm:"default:0"`
+	EngineHoursUpdatedAt *time.Time `json:"engine_hours_updated_at"`
+	EngineOn             bool       `json:"-" gorm:"default:false"`
+
+	// Optional map appearance chosen by the owner: a hex color such as "#1E88E5"
+	// and the name of the marker icon the apps should draw
+	Color    string `json:"color" gorm:"size:7"`
+	IconType string `json:"icon_type" gorm:"size:30"`
+
+	// Optional anti-theft schedule: the daily "HH:MM" window, in the server timezone, in
+	// which the vehicle may move. Starting to move outside it sends an urgent alert. Both
+	// empty means no schedule; an end before the start spans midnight.
+	AllowedHoursStart string `json:"allowed_hours_start" gorm:"size:5"`
+	AllowedHoursEnd   string `json:"allowed_hours_end" gorm:"size:5"`
+
 	// Relationship - Reference device by IMEI but no foreign key constraint
 	// This allows devices to be created independently
 	Device Device `json:"device,omitempty" gorm:"-"`
@@ -39,6 +62,46 @@ type Vehicle struct {
 	Users      []User        `json:"-" gorm:"many2many:user_vehicles;foreignKey:IMEI;joinForeignKey:VehicleID;References:ID;joinReferences:UserID"`
 }
 
+// vehicleColorPattern matches #RGB and #RRGGBB hex colors
+var vehicleColorPattern = regexp.MustCompile(`^#([0-9A-Fa-f]{3}|[0-9A-Fa-f]{6})$`)
+
+// vehicleIconTypePattern matches icon names such as "car", "pickup_truck" or "bus-2"
+var vehicleIconTypePattern = regexp.MustCompile(`^[a-z0-9_-]{1,30}$`)
+
+// IsValidVehicleColor checks if the color is empty (app default) or a #RGB/#RRGGBB hex string
+func IsValidVehicleColor(color string) bool {
+	return color == "" || vehicleColorPattern.MatchString(color)
+}
+
+// IsValidVehicleIconType checks if the icon type is empty (icon from the vehicle type) or an icon name
+func IsValidVehicleIconType(iconType string) bool {
+	return iconType == "" || vehicleIconTypePattern.MatchString(iconType)
+}
+
+// ParseClockMinutes parses an "HH:MM" time of day into minutes after midnight
+func ParseClockMinutes(value string) (int, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil || len(value) != 5 {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// IsValidAllowedHours checks if the schedule is empty (no schedule) or two different "HH:MM" times
+func IsValidAllowedHours(start, end string) bool {
+	if start == "" && end == "" {
+		return true
+	}
+	startMinutes, startOK := ParseClockMinutes(start)
+	endMinutes, endOK := ParseClockMinutes(end)
+	return startOK && endOK && startMinutes != endMinutes
+}
+
+// HasAllowedHours reports whether the vehicle has an anti-theft schedule
+func (v *Vehicle) HasAllowedHours() bool {
+	return v.AllowedHoursStart != "" && v.AllowedHoursEnd != ""
+}
+
 // TableName specifies the table name for Vehicle model
 func (Vehicle) TableName() string {
 	return "vehicles"
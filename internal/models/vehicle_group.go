@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// VehicleGroup is a named set of vehicles, e.g. "Delivery vans" or "Kathmandu branch".
+// Groups belong to the user who created them; a vehicle can be in several groups.
+type VehicleGroup struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	OwnerID     uint      `json:"owner_id" gorm:"not null;index"`
+	Name        string    `json:"name" gorm:"size:100;not null"`
+	Description string    `json:"description" gorm:"type:text"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Members []VehicleGroupMember `json:"members,omitempty" gorm:"foreignKey:GroupID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (VehicleGroup) TableName() string {
+	return "vehicle_groups"
+}
+
+// VehicleGroupMember puts a vehicle in a group
+type VehicleGroupMember struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	GroupID   uint      `json:"group_id" gorm:"not null;uniqueIndex:idx_vehicle_group_member"`
+	VehicleID string    `json:"vehicle_id" gorm:"size:16;not null;uniqueIndex:idx_vehicle_group_member;index"` // IMEI
+	AddedBy   uint      `json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Vehicle Vehicle `json:"-" gorm:"foreignKey:VehicleID;references:IMEI;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (VehicleGroupMember) TableName() string {
+	return "vehicle_group_members"
+}
+
+// VehicleIDs returns the IMEIs of the group's loaded members
+func (g *VehicleGroup) VehicleIDs() []string {
+	imeis := make([]string, 0, len(g.Members))
+	for _, member := range g.Members {
+		imeis = append(imeis, member.VehicleID)
+	}
+	return imeis
+}
@@ -1,8 +1,6 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 	"luna_iot_server/pkg/colors"
 	"net"
@@ -12,12 +10,13 @@ import (
 
 // Protocol constants for GPS tracker control
 const (
-	ProtocolServer   = 0x80 // Server to terminal
-	ProtocolTerminal = 0x15 // Terminal response
-	StartBit         = 0x7878
-	StopBit          = 0x0D0A
-	LanguageChinese  = 0x0001
-	LanguageEnglish  = 0x0002
+	ProtocolServer           = 0x80 // Server to terminal
+	ProtocolTerminal         = 0x15 // Terminal response
+	ProtocolTerminalExtended = 0x21 // Terminal response in an extended 0x7979 frame
+	StartBit                 = 0x7878
+	StopBit                  = 0x0D0A
+	LanguageChinese          = 0x0001
+	LanguageEnglish          = 0x0002
 )
 
 // Control Commands
@@ -27,27 +26,11 @@ const (
 	CmdLocation   = "DWXX#" // Get location info
 )
 
-// ControlPacket represents the GPS tracker communication packet for control commands
-type ControlPacket struct {
-	StartBit         uint16
-	PacketLength     uint8
-	ProtocolNumber   uint8
-	CommandLength    uint8
-	ServerFlag       [4]byte
-	CommandContent   string
-	Language         uint16
-	InfoSerialNumber uint16
-	ErrorCheck       uint16
-	StopBit          uint16
-}
-
 // GPSTrackerController handles oil and electricity control communication with GPS tracking device
 type GPSTrackerController struct {
-	conn         net.Conn
-	serverFlag   [4]byte
-	serialNumber uint16
-	language     uint16
-	deviceIMEI   string
+	conn       net.Conn
+	commands   *CommandBuilder // Numbers commands on this connection and receives their replies
+	deviceIMEI string
 }
 
 // ControlResponse represents the response from a control command
@@ -60,79 +43,17 @@ type ControlResponse struct {
 	DeviceIMEI string    `json:"device_imei"`
 }
 
-// NewGPSTrackerController creates a new GPS tracker controller instance
-func NewGPSTrackerController(conn net.Conn, deviceIMEI string) *GPSTrackerController {
-	return &GPSTrackerController{
-		conn:         conn,
-		serverFlag:   [4]byte{0x01, 0x02, 0x03, 0x04}, // Server identification flag
-		serialNumber: 1,
-		language:     LanguageEnglish,
-		deviceIMEI:   deviceIMEI,
-	}
-}
-
-// buildControlPacket creates a packet for sending control commands to terminal
-func (g *GPSTrackerController) buildControlPacket(command string) *ControlPacket {
-	commandBytes := []byte(command)
-	commandLength := uint8(4 + len(commandBytes)) // ServerFlag(4) + Command content
-
-	packet := &ControlPacket{
-		StartBit:         StartBit,
-		PacketLength:     uint8(1 + 1 + commandLength + 2 + 2 + 2), // Protocol + Length + Command + Language + Serial + ErrorCheck
-		ProtocolNumber:   ProtocolServer,
-		CommandLength:    commandLength,
-		ServerFlag:       g.serverFlag,
-		CommandContent:   command,
-		Language:         g.language,
-		InfoSerialNumber: g.serialNumber,
-		ErrorCheck:       0, // Will be calculated
-		StopBit:          StopBit,
-	}
+// CommandReplyTimeout is how long a control command waits for the device's reply
+const CommandReplyTimeout = 10 * time.Second
 
-	// Calculate error check (simple checksum)
-	packet.ErrorCheck = g.calculateChecksum(packet)
-	g.serialNumber++
-
-	return packet
-}
-
-// calculateChecksum calculates a simple checksum for the packet
-func (g *GPSTrackerController) calculateChecksum(packet *ControlPacket) uint16 {
-	var sum uint16
-	sum += uint16(packet.PacketLength)
-	sum += uint16(packet.ProtocolNumber)
-	sum += uint16(packet.CommandLength)
-
-	for _, b := range packet.ServerFlag {
-		sum += uint16(b)
-	}
-
-	for _, b := range []byte(packet.CommandContent) {
-		sum += uint16(b)
+// NewGPSTrackerController creates a new GPS tracker controller instance. Replies are
+// read by the connection's own reader, which passes them to commands.MatchReply.
+func NewGPSTrackerController(conn net.Conn, deviceIMEI string, commands *CommandBuilder) *GPSTrackerController {
+	return &GPSTrackerController{
+		conn:       conn,
+		commands:   commands,
+		deviceIMEI: deviceIMEI,
 	}
-
-	sum += packet.Language
-	sum += packet.InfoSerialNumber
-
-	return sum
-}
-
-// packetToBytes converts control packet to byte array for transmission
-func (g *GPSTrackerController) packetToBytes(packet *ControlPacket) []byte {
-	buf := new(bytes.Buffer)
-
-	binary.Write(buf, binary.BigEndian, packet.StartBit)
-	binary.Write(buf, binary.BigEndian, packet.PacketLength)
-	binary.Write(buf, binary.BigEndian, packet.ProtocolNumber)
-	binary.Write(buf, binary.BigEndian, packet.CommandLength)
-	buf.Write(packet.ServerFlag[:])
-	buf.Write([]byte(packet.CommandContent))
-	binary.Write(buf, binary.BigEndian, packet.Language)
-	binary.Write(buf, binary.BigEndian, packet.InfoSerialNumber)
-	binary.Write(buf, binary.BigEndian, packet.ErrorCheck)
-	binary.Write(buf, binary.BigEndian, packet.StopBit)
-
-	return buf.Bytes()
 }
 
 // sendCommand sends a control command to the GPS tracker and waits for response
@@ -143,64 +64,39 @@ func (g *GPSTrackerController) sendCommand(command string) (*ControlResponse, er
 		DeviceIMEI: g.deviceIMEI,
 	}
 
-	// Build and send packet
-	packet := g.buildControlPacket(command)
-	data := g.packetToBytes(packet)
+	data, flag, err := g.commands.Build(command)
+	if err != nil {
+		response.Success = false
+		response.Message = fmt.Sprintf("Failed to build command: %v", err)
+		return response, fmt.Errorf("failed to build command: %v", err)
+	}
 
-	colors.PrintControl("Sending command %s to device %s", command, g.deviceIMEI)
+	colors.PrintControl("Sending command %s to device %s (server flag %08X)", command, g.deviceIMEI, flag)
 	colors.PrintDebug("Command packet bytes: %x", data)
 
-	_, err := g.conn.Write(data)
-	if err != nil {
+	if _, err := g.conn.Write(data); err != nil {
+		g.commands.Cancel(flag)
 		response.Success = false
 		response.Message = fmt.Sprintf("Failed to send command: %v", err)
 		return response, fmt.Errorf("failed to send command: %v", err)
 	}
 
-	// Read response with timeout
-	responseData := make([]byte, 256)
-	g.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-	n, err := g.conn.Read(responseData)
+	reply, err := g.commands.WaitForReply(flag, CommandReplyTimeout)
 	if err != nil {
 		response.Success = false
 		response.Message = fmt.Sprintf("Failed to read response: %v", err)
 		return response, fmt.Errorf("failed to read response: %v", err)
 	}
 
-	responseStr, parseErr := g.parseResponse(responseData[:n])
-	response.Response = responseStr
-
-	if parseErr != nil {
-		response.Success = false
-		response.Message = fmt.Sprintf("Failed to parse response: %v", parseErr)
-		return response, parseErr
-	}
+	response.Response = reply.Content
 
 	// Analyze response for success/failure
-	response.Success = g.isSuccessfulResponse(command, responseStr)
-	response.Message = g.getResponseMessage(command, responseStr)
+	response.Success = g.isSuccessfulResponse(command, reply.Content)
+	response.Message = g.getResponseMessage(command, reply.Content)
 
 	return response, nil
 }
 
-// parseResponse extracts the command content from terminal response
-func (g *GPSTrackerController) parseResponse(data []byte) (string, error) {
-	if len(data) < 10 {
-		return "", fmt.Errorf("response too short")
-	}
-
-	// Skip header and extract command content
-	// This is a simplified parser - in real implementation, you'd parse the full packet structure
-	commandStart := 8           // Approximate position where command content starts
-	commandEnd := len(data) - 6 // Approximate position where command content ends
-
-	if commandStart >= commandEnd {
-		return "", fmt.Errorf("invalid response format")
-	}
-
-	return string(data[commandStart:commandEnd]), nil
-}
-
 // isSuccessfulResponse checks if the response indicates success
 func (g *GPSTrackerController) isSuccessfulResponse(command, response string) bool {
 	switch command {
@@ -294,6 +190,15 @@ func (g *GPSTrackerController) GetLocation() (*ControlResponse, error) {
 	return response, nil
 }
 
+// SMSCommand returns the text message form of a control command. Over SMS the device
+// expects its password before the closing #, e.g. "DYD,000000#".
+func SMSCommand(command, password string) string {
+	if password == "" {
+		return command
+	}
+	return strings.TrimSuffix(command, "#") + "," + password + "#"
+}
+
 // Helper function to check if string contains substring (case-insensitive)
 func contains(s, substr string) bool {
 	s = strings.ToLower(s)
@@ -0,0 +1,163 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// MaxCommandContent is the longest command that fits the one-byte length of a 0x80 frame
+const MaxCommandContent = 255 - (1 + 1 + 4 + 2 + 2 + 2)
+
+var (
+	ErrCommandTooLong      = fmt.Errorf("command content is longer than %d bytes", MaxCommandContent)
+	ErrCommandReplyTimeout = errors.New("timed out waiting for the command reply")
+)
+
+// CommandReply is the terminal's answer to a command sent through a CommandBuilder
+type CommandReply struct {
+	Flag    uint32        `json:"flag"`    // Server flag the command was sent with and the terminal echoed
+	Command string        `json:"command"` // The command that was sent
+	Content string        `json:"content"` // What the terminal answered
+	Latency time.Duration `json:"latency"` // Time between building the command and matching the reply
+}
+
+// pendingCommand is a command waiting for the terminal's reply
+type pendingCommand struct {
+	command string
+	sentAt  time.Time
+	matched bool // A reply was already handed over; repeats of it are ignored
+	reply   chan *CommandReply
+}
+
+// CommandBuilder builds 0x80 server command frames for one device connection. Each
+// command gets its own 4-byte server flag, which the terminal echoes in its reply, and
+// replies decoded from the device are matched back to the command by that flag. The
+// reply's serial number is the terminal's own and says nothing about the command.
+type CommandBuilder struct {
+	mutex      sync.Mutex
+	language   uint16
+	nextSerial uint16
+	nextFlag   uint32
+	pending    map[uint32]*pendingCommand
+}
+
+// NewCommandBuilder creates a command builder for a new connection. Flags start at a
+// random value, so a late reply to a command from an earlier connection is not matched.
+func NewCommandBuilder() *CommandBuilder {
+	return &CommandBuilder{
+		language:   LanguageEnglish,
+		nextSerial: 1,
+		nextFlag:   rand.Uint32(),
+		pending:    make(map[uint32]*pendingCommand),
+	}
+}
+
+// Build returns the frame for command and the server flag it was given. The command
+// stays pending until its reply is matched or WaitForReply gives up on it.
+func (b *CommandBuilder) Build(command string) ([]byte, uint32, error) {
+	if len(command) > MaxCommandContent {
+		return nil, 0, ErrCommandTooLong
+	}
+
+	b.mutex.Lock()
+	serial := b.nextSerial
+	b.nextSerial++
+	if b.nextSerial == 0 {
+		b.nextSerial = 1
+	}
+	flag := b.nextFlag
+	b.nextFlag++
+	b.pending[flag] = &pendingCommand{
+		command: command,
+		sentAt:  time.Now(),
+		reply:   make(chan *CommandReply, 1),
+	}
+	b.mutex.Unlock()
+
+	commandLength := 4 + len(command) // Server flag + command content
+	frame := make([]byte, 0, 2+1+1+1+commandLength+2+2+2+2)
+	frame = append(frame, 0x78, 0x78)
+	frame = append(frame, byte(1+1+commandLength+2+2+2)) // Protocol + command length + command + language + serial + CRC
+	frame = append(frame, ProtocolServer, byte(commandLength))
+	frame = binary.BigEndian.AppendUint32(frame, flag)
+	frame = append(frame, command...)
+	frame = binary.BigEndian.AppendUint16(frame, b.language)
+	frame = binary.BigEndian.AppendUint16(frame, serial)
+	frame = binary.BigEndian.AppendUint16(frame, gt06CRC(frame[2:]))
+	frame = append(frame, 0x0D, 0x0A)
+
+	return frame, flag, nil
+}
+
+// MatchReply hands a decoded 0x15/0x21 packet to the command it answers. It returns
+// false for other packets, for repeated replies and for flags with no pending command,
+// such as a reply arriving after WaitForReply gave up.
+func (b *CommandBuilder) MatchReply(packet *DecodedPacket) (*CommandReply, bool) {
+	if packet == nil || packet.ServerFlag == nil {
+		return nil, false
+	}
+	if packet.Protocol != ProtocolTerminal && packet.Protocol != ProtocolTerminalExtended {
+		return nil, false
+	}
+
+	b.mutex.Lock()
+	pending, exists := b.pending[*packet.ServerFlag]
+	if !exists || pending.matched {
+		b.mutex.Unlock()
+		return nil, false
+	}
+	pending.matched = true
+	b.mutex.Unlock()
+
+	reply := &CommandReply{
+		Flag:    *packet.ServerFlag,
+		Command: pending.command,
+		Content: packet.CommandReply,
+		Latency: time.Since(pending.sentAt),
+	}
+	pending.reply <- reply
+	return reply, true
+}
+
+// WaitForReply blocks until the reply to the command sent with flag is matched or timeout
+// passes. Either way the command is no longer pending afterwards, so a late reply is not
+// matched to it.
+func (b *CommandBuilder) WaitForReply(flag uint32, timeout time.Duration) (*CommandReply, error) {
+	b.mutex.Lock()
+	pending, exists := b.pending[flag]
+	b.mutex.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("no pending command with server flag %08X", flag)
+	}
+
+	defer b.Cancel(flag)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-pending.reply:
+		return reply, nil
+	case <-timer.C:
+		return nil, ErrCommandReplyTimeout
+	}
+}
+
+// Cancel stops waiting for the reply to the command sent with flag, e.g. when it could not
+// be written
+func (b *CommandBuilder) Cancel(flag uint32) {
+	b.mutex.Lock()
+	delete(b.pending, flag)
+	b.mutex.Unlock()
+}
+
+// PendingCount returns how many commands have been built and not yet waited for or cancelled
+func (b *CommandBuilder) PendingCount() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.pending)
+}
@@ -19,29 +19,53 @@ type GT06Decoder struct {
 	stopBits         []byte
 	protocolNumbers  map[byte]string
 	responseRequired []byte
+
+	// Sign latitudes south of the equator negative instead of always reporting them positive
+	honorHemisphere bool
+	// Raw coordinate units per degree
+	coordinateDivisor float64
+}
+
+// DefaultCoordinateDivisor converts standard GT06 coordinates, sent in 1/30000 minutes, to degrees
+const DefaultCoordinateDivisor = 1800000.0
+
+// GT06Options configures a GT06 decoder
+type GT06Options struct {
+	// HonorHemisphere makes latitude negative when the course word flags a southern fix.
+	// When false latitude is always positive, as the Nepal deployments have relied on;
+	// longitude follows the east/west flag either way.
+	HonorHemisphere bool
+	// CoordinateDivisor converts raw coordinates to degrees, for clones whose firmware
+	// scales them differently; 0 uses DefaultCoordinateDivisor
+	CoordinateDivisor float64
 }
 
 // DecodedPacket represents a decoded GT06 packet
 type DecodedPacket struct {
 	Raw           string      `json:"raw"`
 	Timestamp     time.Time   `json:"timestamp"`
-	Length        byte        `json:"length"`
+	Length        uint16      `json:"length"`
+	Extended      bool        `json:"extended,omitempty"` // Framed with 0x7979 and a two-byte length
 	Protocol      byte        `json:"protocol"`
 	ProtocolName  string      `json:"protocolName"`
-	SerialNumber  byte        `json:"serialNumber"`
-	Checksum      byte        `json:"checksum"`
+	SerialNumber  uint16      `json:"serialNumber"` // Information serial number; acks must echo all of it
+	Checksum      uint16      `json:"checksum"`
 	NeedsResponse bool        `json:"needsResponse"`
 	Data          interface{} `json:"data,omitempty"`
 
 	// Login data
 	TerminalID     string  `json:"terminalId,omitempty"`
 	DeviceType     *uint16 `json:"deviceType,omitempty"`
-	TimezoneOffset *int16  `json:"timezoneOffset,omitempty"`
+	TimezoneOffset *int16  `json:"timezoneOffset,omitempty"` // Minutes east of UTC, negative for west
+	Language       string  `json:"language,omitempty"`       // Language configured on the device
 
 	// GPS data
-	GPSTime       *time.Time `json:"gpsTime,omitempty"`
+	GPSTime       *time.Time `json:"gpsTime,omitempty"`    // UTC once the device timezone is applied
+	DeviceTime    *time.Time `json:"deviceTime,omitempty"` // Date-time exactly as the device sent it
 	Latitude      *float64   `json:"latitude,omitempty"`
 	Longitude     *float64   `json:"longitude,omitempty"`
+	RawLatitude   *float64   `json:"rawLatitude,omitempty"`  // Magnitude as sent, before hemisphere flags
+	RawLongitude  *float64   `json:"rawLongitude,omitempty"` // Magnitude as sent, before hemisphere flags
 	Speed         *byte      `json:"speed,omitempty"`
 	Course        *uint16    `json:"course,omitempty"`
 	Altitude      *int       `json:"altitude,omitempty"`
@@ -71,7 +95,21 @@ type DecodedPacket struct {
 	RawData        string       `json:"rawData,omitempty"`
 
 	// Alarm data
-	AlarmType *AlarmTypeInfo `json:"alarmType,omitempty"`
+	AlarmType     *AlarmTypeInfo `json:"alarmType,omitempty"`
+	AlarmLanguage string         `json:"alarmLanguage,omitempty"` // Language the device expects alarm replies in
+
+	// Information transmission data (extended 0x94 packets)
+	InfoType        *byte    `json:"infoType,omitempty"`
+	InfoTypeName    string   `json:"infoTypeName,omitempty"`
+	ExternalVoltage *float64 `json:"externalVoltage,omitempty"`
+	DoorStatus      string   `json:"doorStatus,omitempty"`
+	IMSI            string   `json:"imsi,omitempty"`
+	ICCID           string   `json:"iccid,omitempty"`
+	InfoContent     string   `json:"infoContent,omitempty"`
+
+	// Command reply data (0x15 and 0x21 answers to server commands)
+	ServerFlag   *uint32 `json:"serverFlag,omitempty"`   // Flag echoed from the server's command
+	CommandReply string  `json:"commandReply,omitempty"` // Text the terminal answered with
 
 	// Additional data
 	AdditionalData string `json:"additionalData,omitempty"`
@@ -115,8 +153,18 @@ type StartInfo struct {
 	Index int
 }
 
-// NewGT06Decoder creates a new GT06 decoder instance
+// NewGT06Decoder creates a new GT06 decoder instance with the default options
 func NewGT06Decoder() *GT06Decoder {
+	return NewGT06DecoderWithOptions(GT06Options{})
+}
+
+// NewGT06DecoderWithOptions creates a GT06 decoder with the given options
+func NewGT06DecoderWithOptions(options GT06Options) *GT06Decoder {
+	coordinateDivisor := options.CoordinateDivisor
+	if coordinateDivisor <= 0 {
+		coordinateDivisor = DefaultCoordinateDivisor
+	}
+
 	return &GT06Decoder{
 		buffer:      make([]byte, 0),
 		startBits78: []byte{0x78, 0x78}, // Standard packets
@@ -129,10 +177,15 @@ func NewGT06Decoder() *GT06Decoder {
 			0x15: "STRING_INFO",
 			0x16: "ALARM_DATA",
 			0x1A: "GPS_LBS_DATA",
-			0x22: "GPS_LBS", // GPS Data Packet - this is what your device is sending
+			0x21: "STRING_INFO_EXTENDED", // Command reply in an extended (0x7979) frame
+			0x22: "GPS_LBS",              // GPS Data Packet - this is what your device is sending
+			0x26: "ALARM_GPS_LBS_STATUS", // Alarm with GPS, LBS and status
+			0x94: "INFO_TRANSMISSION",    // Extended (0x7979) information transmission
 			0xA0: "GPS_LBS_STATUS_A0",
 		},
-		responseRequired: []byte{0x01, 0x21, 0x15, 0x16, 0x18, 0x19},
+		responseRequired:  []byte{0x01, 0x21, 0x15, 0x16, 0x18, 0x19, 0x26},
+		honorHemisphere:   options.HonorHemisphere,
+		coordinateDivisor: coordinateDivisor,
 	}
 }
 
@@ -164,12 +217,16 @@ func (d *GT06Decoder) processBuffer() ([]*DecodedPacket, error) {
 			d.buffer = d.buffer[startInfo.Index:]
 		}
 
-		if len(d.buffer) < 5 {
+		totalLength, ok := d.frameLength()
+		if !ok {
 			break
 		}
 
-		lengthByte := d.buffer[2]
-		totalLength := int(lengthByte) + 5
+		if totalLength < 0 {
+			// Declared length cannot hold protocol, serial and CRC - skip these start bits and resync
+			d.buffer = d.buffer[2:]
+			continue
+		}
 
 		if len(d.buffer) < totalLength {
 			break
@@ -177,13 +234,18 @@ func (d *GT06Decoder) processBuffer() ([]*DecodedPacket, error) {
 
 		packet := d.buffer[0:totalLength]
 
-		if packet[totalLength-2] == 0x0D && packet[totalLength-1] == 0x0A {
-			decoded, err := d.decodePacket(packet)
-			if err != nil {
-				colors.PrintError("Error decoding packet: %v", err)
-			} else if decoded != nil {
-				packets = append(packets, decoded)
-			}
+		if packet[totalLength-2] != 0x0D || packet[totalLength-1] != 0x0A {
+			// Length does not line up with the stop bits, so this was not a real frame start
+			colors.PrintWarning("GT06 frame without stop bits (declared length %d), resyncing", totalLength)
+			d.buffer = d.buffer[2:]
+			continue
+		}
+
+		decoded, err := d.decodePacket(packet)
+		if err != nil {
+			colors.PrintError("Error decoding packet: %v", err)
+		} else if decoded != nil {
+			packets = append(packets, decoded)
 		}
 
 		d.buffer = d.buffer[totalLength:]
@@ -192,6 +254,32 @@ func (d *GT06Decoder) processBuffer() ([]*DecodedPacket, error) {
 	return packets, nil
 }
 
+// frameLength returns the full length of the frame at the start of the buffer.
+// Standard 0x7878 frames have a one-byte length field and extended 0x7979 frames a
+// two-byte one; in both cases the length counts protocol, content, serial and CRC.
+// ok is false until the whole header has arrived; a negative length marks an invalid header.
+func (d *GT06Decoder) frameLength() (totalLength int, ok bool) {
+	if d.buffer[0] == 0x79 {
+		if len(d.buffer) < 6 {
+			return 0, false
+		}
+		declared := int(binary.BigEndian.Uint16(d.buffer[2:4]))
+		if declared < 5 {
+			return -1, true
+		}
+		return declared + 6, true // start(2) + length(2) + declared + stop(2)
+	}
+
+	if len(d.buffer) < 5 {
+		return 0, false
+	}
+	declared := int(d.buffer[2])
+	if declared < 5 {
+		return -1, true
+	}
+	return declared + 5, true // start(2) + length(1) + declared + stop(2)
+}
+
 // findStartBits finds the start bits in the buffer
 func (d *GT06Decoder) findStartBits() StartInfo {
 	for i := 0; i <= len(d.buffer)-2; i++ {
@@ -213,15 +301,25 @@ func (d *GT06Decoder) decodePacket(packet []byte) (*DecodedPacket, error) {
 		return nil, nil
 	}
 
+	extended := packet[0] == 0x79
+	length := uint16(packet[2])
 	protocolOffset := 3
-	dataStartOffset := 4
+	if extended {
+		if len(packet) < 6 {
+			return nil, nil
+		}
+		length = binary.BigEndian.Uint16(packet[2:4])
+		protocolOffset = 4
+	}
+	dataStartOffset := protocolOffset + 1
 	serialOffset := len(packet) - 6
 	checksumOffset := len(packet) - 4
 
 	result := &DecodedPacket{
 		Raw:           strings.ToUpper(hex.EncodeToString(packet)),
 		Timestamp:     time.Now(), // Will be updated with GPS time if available
-		Length:        packet[2],
+		Length:        length,
+		Extended:      extended,
 		Protocol:      packet[protocolOffset],
 		ProtocolName:  d.getProtocolName(packet[protocolOffset]),
 		SerialNumber:  0,
@@ -230,10 +328,10 @@ func (d *GT06Decoder) decodePacket(packet []byte) (*DecodedPacket, error) {
 	}
 
 	if serialOffset >= 0 {
-		result.SerialNumber = packet[serialOffset]
+		result.SerialNumber = binary.BigEndian.Uint16(packet[serialOffset : serialOffset+2])
 	}
 	if checksumOffset >= 0 {
-		result.Checksum = packet[checksumOffset]
+		result.Checksum = binary.BigEndian.Uint16(packet[checksumOffset : checksumOffset+2])
 	}
 
 	var dataPayload []byte
@@ -252,6 +350,12 @@ func (d *GT06Decoder) decodePacket(packet []byte) (*DecodedPacket, error) {
 		d.decodeStatusInfo(dataPayload, result)
 	case 0x16:
 		d.decodeAlarmData(dataPayload, result)
+	case 0x26:
+		d.decodeAlarmGPSLBSStatus(dataPayload, result)
+	case 0x94:
+		d.decodeInfoTransmission(dataPayload, result)
+	case ProtocolTerminal, ProtocolTerminalExtended:
+		d.decodeCommandReply(packet[protocolOffset], dataPayload, result)
 	default:
 		result.Data = strings.ToUpper(hex.EncodeToString(dataPayload))
 	}
@@ -281,18 +385,54 @@ func (d *GT06Decoder) needsResponse(protocol byte) bool {
 func (d *GT06Decoder) decodeLogin(data []byte, result *DecodedPacket) {
 	if len(data) >= 8 {
 		result.TerminalID = strings.ToUpper(hex.EncodeToString(data[0:8]))
-		if len(data) > 8 {
+		if len(data) >= 10 {
 			deviceType := binary.BigEndian.Uint16(data[8:10])
 			result.DeviceType = &deviceType
 		}
-		if len(data) > 10 {
-			timezoneOffset := int16(binary.BigEndian.Uint16(data[10:12]))
-			result.TimezoneOffset = &timezoneOffset
+		if len(data) >= 12 {
+			timezoneWord := binary.BigEndian.Uint16(data[10:12])
+			timezoneOffset, language := DecodeTimezoneLanguage(timezoneWord)
+			// A garbled word can decode to minutes past 59 or an offset no zone has
+			if (timezoneWord>>4)%100 < 60 && timezoneOffset >= MinTimezoneOffset && timezoneOffset <= MaxTimezoneOffset {
+				result.TimezoneOffset = &timezoneOffset
+			}
+			result.Language = language
 		}
 	}
 }
 
-// decodeGPSLBS decodes GPS and LBS data
+// Range of real UTC offsets in minutes, from UTC-12:00 to UTC+14:00
+const (
+	MinTimezoneOffset = -12 * 60
+	MaxTimezoneOffset = 14 * 60
+)
+
+// DecodeTimezoneLanguage decodes the timezone/language word of a login packet into the
+// offset in minutes east of UTC and the device language. Bits 15-4 hold the offset as
+// hours*100 + minutes (e.g. 545 for 5:45), bit 3 is set for zones west of UTC and
+// bits 1-0 select the language.
+func DecodeTimezoneLanguage(value uint16) (int16, string) {
+	zone := int16(value >> 4)
+	offset := (zone/100)*60 + zone%100
+	if value&0x0008 != 0 {
+		offset = -offset
+	}
+
+	language := "UNKNOWN"
+	switch value & 0x0003 {
+	case 0x01:
+		language = "CHINESE"
+	case 0x02:
+		language = "ENGLISH"
+	}
+
+	return offset, language
+}
+
+// decodeGPSLBS decodes GPS and LBS data:
+// date-time(6) | satellites(1) | lat(4) | lng(4) | speed(1) | course/status(2) | [altitude(2)] | MCC(2) MNC(1) LAC(2) cell ID(3)
+// Every field is read only once all of its bytes are present, so a truncated payload
+// decodes the fields it holds in full and leaves the rest unset.
 func (d *GT06Decoder) decodeGPSLBS(data []byte, result *DecodedPacket) {
 	if len(data) < 12 {
 		return
@@ -301,57 +441,39 @@ func (d *GT06Decoder) decodeGPSLBS(data []byte, result *DecodedPacket) {
 	offset := 0
 
 	// Decode time
-	if len(data) >= 6 {
-		year := 2000 + int(data[offset])
-		month := int(data[offset+1])
-		day := int(data[offset+2])
-		hour := int(data[offset+3])
-		minute := int(data[offset+4])
-		second := int(data[offset+5])
-		offset += 6
-
-		if year >= 2000 && year <= 2050 && month >= 1 && month <= 12 &&
-			day >= 1 && day <= 31 && hour <= 23 && minute <= 59 && second <= 59 {
-			gpsTime := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
-			result.GPSTime = &gpsTime
-			// Use GPS time as the main timestamp for the packet
-			result.Timestamp = gpsTime
-		}
-	}
+	d.decodeGPSTime(data[offset:offset+6], result)
+	offset += 6
 
 	// if result.Protocol == 0xA0 {
 	if offset < len(data) {
 		// Parse satellites count from first byte (upper 4 bits)
-		if offset < len(data) {
-			satellitesByte := data[offset]
-			satellites := (satellitesByte >> 4) & 0x0F
-			result.Satellites = &satellites
-		}
+		satellitesByte := data[offset]
+		satellites := (satellitesByte >> 4) & 0x0F
+		result.Satellites = &satellites
 		offset += 1
 
-		if offset+12 <= len(data) {
+		// Coordinates are only usable with the course word, which carries the hemisphere flags
+		gpsComplete := false
+		if offset+11 <= len(data) {
 			latRaw := binary.BigEndian.Uint32(data[offset : offset+4])
 			if latRaw > 0 && latRaw < 0xFFFFFFFF {
-				lat := float64(latRaw) / 1800000.0
-
-				// Convert negative latitude to positive (remove minus sign)
-				if lat < 0 {
-					lat = -lat
-				}
-
+				// Unsigned magnitude; decodeCourseStatus applies the hemisphere flags
+				lat := float64(latRaw) / d.coordinateDivisor
 				if lat > 0 && lat <= 90 {
+					rawLat := lat
 					result.Latitude = &lat
+					result.RawLatitude = &rawLat
 				}
 			}
 			offset += 4
 
 			lngRaw := binary.BigEndian.Uint32(data[offset : offset+4])
 			if lngRaw > 0 && lngRaw < 0xFFFFFFFF {
-				lng := float64(lngRaw) / 1800000.0
-
-				// Accept both negative and positive longitude values
-				if lng >= -180 && lng <= 180 {
+				lng := float64(lngRaw) / d.coordinateDivisor
+				if lng <= 180 {
+					rawLng := lng
 					result.Longitude = &lng
+					result.RawLongitude = &rawLng
 				}
 			}
 			offset += 4
@@ -360,46 +482,15 @@ func (d *GT06Decoder) decodeGPSLBS(data []byte, result *DecodedPacket) {
 				speed := data[offset]
 				result.Speed = &speed
 
-				courseStatus := binary.BigEndian.Uint16(data[offset+1 : offset+3])
-				course := courseStatus & 0x03FF
-				result.Course = &course
-
-				// Status flags
-				gpsRealTime := (courseStatus & 0x2000) == 0
-				result.GPSRealTime = &gpsRealTime
-
-				gpsPositioned := (courseStatus & 0x1000) == 0
-				result.GPSPositioned = &gpsPositioned
-
-				eastLongitude := (courseStatus & 0x0800) == 0
-				result.EastLongitude = &eastLongitude
-
-				northLatitude := (courseStatus & 0x0400) == 0
-				result.NorthLatitude = &northLatitude
-
-				// Apply hemisphere corrections for longitude only
-				// Longitude: negative for western hemisphere, positive for eastern
-				if result.Longitude != nil && !eastLongitude {
-					lng := -*result.Longitude
-					result.Longitude = &lng
-				}
-
-				// For latitude: always convert to positive regardless of hemisphere
-				if result.Latitude != nil && !northLatitude {
-					// Convert negative latitude to positive
-					lat := *result.Latitude
-					if lat < 0 {
-						lat = -lat
-					}
-					result.Latitude = &lat
-				}
+				d.decodeCourseStatus(binary.BigEndian.Uint16(data[offset+1:offset+3]), result)
 
 				offset += 3
+				gpsComplete = true
 			}
 		}
 
-		// Parse altitude if available (after GPS data)
-		if offset+2 <= len(data) {
+		// Parse altitude if available (after GPS data); without the GPS block these bytes are coordinates
+		if gpsComplete && offset+2 <= len(data) {
 			altitudeRaw := binary.BigEndian.Uint16(data[offset : offset+2])
 			if altitudeRaw > 0 && altitudeRaw < 0xFFFF {
 				altitude := int(altitudeRaw)
@@ -408,8 +499,8 @@ func (d *GT06Decoder) decodeGPSLBS(data []byte, result *DecodedPacket) {
 			offset += 2
 		}
 
-		// Decode cell tower information
-		for offset+9 <= len(data) {
+		// Decode cell tower information; each candidate reads 8 bytes from offset
+		for gpsComplete && offset+8 <= len(data) {
 			testMCC := binary.BigEndian.Uint16(data[offset : offset+2])
 
 			if testMCC >= 100 && testMCC <= 999 {
@@ -529,6 +620,79 @@ func (d *GT06Decoder) decodeGPSLBS(data []byte, result *DecodedPacket) {
 	}
 }
 
+// decodeGPSTime decodes the six date-time bytes (YY MM DD hh mm ss) and, when they
+// form a valid date, uses it as the packet timestamp
+func (d *GT06Decoder) decodeGPSTime(data []byte, result *DecodedPacket) {
+	year := 2000 + int(data[0])
+	month := int(data[1])
+	day := int(data[2])
+	hour := int(data[3])
+	minute := int(data[4])
+	second := int(data[5])
+
+	if year >= 2000 && year <= 2050 && month >= 1 && month <= 12 &&
+		day >= 1 && day <= 31 && hour <= 23 && minute <= 59 && second <= 59 {
+		gpsTime := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+		if gpsTime.Day() != day {
+			// time.Date rolls days past the end of the month (e.g. 30 February) into the next
+			return
+		}
+		deviceTime := gpsTime
+		result.GPSTime = &gpsTime
+		result.DeviceTime = &deviceTime
+		// Use GPS time as the main timestamp for the packet
+		result.Timestamp = gpsTime
+	}
+}
+
+// ApplyTimezone converts the GPS time of a device that reports local time to UTC,
+// given the device's offset in minutes east of UTC from its login packet.
+// DeviceTime keeps the time as sent.
+func (p *DecodedPacket) ApplyTimezone(offsetMinutes int16) {
+	if p.GPSTime == nil || p.DeviceTime == nil || offsetMinutes == 0 {
+		return
+	}
+
+	utc := p.DeviceTime.Add(-time.Duration(offsetMinutes) * time.Minute)
+	p.GPSTime = &utc
+	p.Timestamp = utc
+}
+
+// decodeCourseStatus decodes the course and GPS status flags word and applies the
+// hemisphere flags to the already decoded coordinates
+func (d *GT06Decoder) decodeCourseStatus(courseStatus uint16, result *DecodedPacket) {
+	// The course field is 10 bits wide, so garbled data can exceed 359 degrees
+	if course := courseStatus & 0x03FF; course < 360 {
+		result.Course = &course
+	}
+
+	// Status flags
+	gpsRealTime := (courseStatus & 0x2000) == 0
+	result.GPSRealTime = &gpsRealTime
+
+	gpsPositioned := (courseStatus & 0x1000) == 0
+	result.GPSPositioned = &gpsPositioned
+
+	eastLongitude := (courseStatus & 0x0800) == 0
+	result.EastLongitude = &eastLongitude
+
+	northLatitude := (courseStatus & 0x0400) == 0
+	result.NorthLatitude = &northLatitude
+
+	// Longitude: negative for western hemisphere, positive for eastern
+	if result.Longitude != nil && !eastLongitude {
+		lng := -*result.Longitude
+		result.Longitude = &lng
+	}
+
+	// Latitude is negative south of the equator when honoring the hemisphere, and is
+	// otherwise kept positive regardless of the flag
+	if result.Latitude != nil && !northLatitude && d.honorHemisphere {
+		lat := -*result.Latitude
+		result.Latitude = &lat
+	}
+}
+
 // decodeStatusInfo decodes status information
 func (d *GT06Decoder) decodeStatusInfo(data []byte, result *DecodedPacket) {
 	if len(data) < 3 {
@@ -696,7 +860,196 @@ func (d *GT06Decoder) decodeAlarmData(data []byte, result *DecodedPacket) {
 	}
 }
 
-// GenerateResponse generates a response packet
+// decodeAlarmGPSLBSStatus decodes 0x26 alarm packets, which carry a full fix, one cell
+// tower, the terminal status and the alarm:
+// date-time(6) | satellites(1) | lat(4) | lng(4) | speed(1) | course/status(2) |
+// LBS length(1) | MCC(2) | MNC(1) | LAC(2) | cell ID(3) | terminal info(1) |
+// voltage(1) | GSM signal(1) | alarm(1) | language(1)
+func (d *GT06Decoder) decodeAlarmGPSLBSStatus(data []byte, result *DecodedPacket) {
+	if len(data) < 32 {
+		colors.PrintWarning("Alarm packet too short: %d bytes", len(data))
+		result.RawData = strings.ToUpper(hex.EncodeToString(data))
+		return
+	}
+
+	d.decodeGPSTime(data[0:6], result)
+
+	satellites := (data[6] >> 4) & 0x0F
+	result.Satellites = &satellites
+
+	if latRaw := binary.BigEndian.Uint32(data[7:11]); latRaw > 0 && latRaw < 0xFFFFFFFF {
+		if lat := float64(latRaw) / d.coordinateDivisor; lat <= 90 {
+			rawLat := lat
+			result.Latitude = &lat
+			result.RawLatitude = &rawLat
+		}
+	}
+	if lngRaw := binary.BigEndian.Uint32(data[11:15]); lngRaw > 0 && lngRaw < 0xFFFFFFFF {
+		if lng := float64(lngRaw) / d.coordinateDivisor; lng <= 180 {
+			rawLng := lng
+			result.Longitude = &lng
+			result.RawLongitude = &rawLng
+		}
+	}
+
+	speed := data[15]
+	result.Speed = &speed
+	d.decodeCourseStatus(binary.BigEndian.Uint16(data[16:18]), result)
+
+	// Cell tower, skipped when the LBS length byte says there is none
+	if data[18] > 0 {
+		mcc := binary.BigEndian.Uint16(data[19:21])
+		result.MCC = &mcc
+		mnc := data[21]
+		result.MNC = &mnc
+		lac := binary.BigEndian.Uint16(data[22:24])
+		result.LAC = &lac
+		cellID := (uint32(data[24]) << 16) | (uint32(data[25]) << 8) | uint32(data[26])
+		result.CellID = &cellID
+	}
+
+	d.decodeStatusInfo(data[27:30], result)
+
+	// The alarm byte is more specific than the alarm bits of the terminal info byte
+	alarmCode := data[30]
+	result.Alarm = &AlarmInfo{
+		Active: alarmCode != 0x00,
+		Type:   d.getAlarmPacketType(alarmCode),
+		Code:   int(alarmCode),
+	}
+	result.AlarmType = &AlarmTypeInfo{
+		Emergency: alarmCode == 0x01,
+		Overspeed: alarmCode == 0x06,
+		LowPower:  alarmCode == 0x0E || alarmCode == 0x19,
+		Shock:     alarmCode == 0x03,
+		IntoArea:  alarmCode == 0x04,
+		OutArea:   alarmCode == 0x05,
+	}
+
+	switch data[31] {
+	case 0x01:
+		result.AlarmLanguage = "CHINESE"
+	case 0x02:
+		result.AlarmLanguage = "ENGLISH"
+	default:
+		result.AlarmLanguage = "UNKNOWN"
+	}
+
+	if len(data) > 32 {
+		result.AdditionalData = strings.ToUpper(hex.EncodeToString(data[32:]))
+	}
+}
+
+// getAlarmPacketType returns the alarm name for the alarm byte of 0x26 packets
+func (d *GT06Decoder) getAlarmPacketType(code byte) string {
+	switch code {
+	case 0x00:
+		return "NORMAL"
+	case 0x01:
+		return "SOS"
+	case 0x02:
+		return "POWER_CUT"
+	case 0x03:
+		return "SHOCK"
+	case 0x04:
+		return "ENTER_FENCE"
+	case 0x05:
+		return "EXIT_FENCE"
+	case 0x06:
+		return "OVERSPEED"
+	case 0x09:
+		return "MOVEMENT"
+	case 0x0E:
+		return "LOW_EXTERNAL_BATTERY"
+	case 0x13:
+		return "TAMPER"
+	case 0x19:
+		return "LOW_BATTERY"
+	case 0xFE:
+		return "ACC_ON"
+	case 0xFF:
+		return "ACC_OFF"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// decodeInfoTransmission decodes extended information transmission packets.
+// The first byte is the information type, followed by its content.
+func (d *GT06Decoder) decodeInfoTransmission(data []byte, result *DecodedPacket) {
+	if len(data) < 1 {
+		return
+	}
+
+	infoType := data[0]
+	content := data[1:]
+	result.InfoType = &infoType
+
+	switch infoType {
+	case 0x00:
+		result.InfoTypeName = "EXTERNAL_POWER_VOLTAGE"
+		if len(content) >= 2 {
+			voltage := float64(binary.BigEndian.Uint16(content[0:2])) / 100.0
+			result.ExternalVoltage = &voltage
+		}
+	case 0x04:
+		result.InfoTypeName = "TERMINAL_STATUS_SYNC"
+		result.InfoContent = string(content)
+	case 0x05:
+		result.InfoTypeName = "DOOR_STATUS"
+		if len(content) >= 1 {
+			if content[0]&0x01 != 0 {
+				result.DoorStatus = "OPEN"
+			} else {
+				result.DoorStatus = "CLOSED"
+			}
+		}
+	case 0x0A:
+		result.InfoTypeName = "ICCID"
+		// IMEI (8 bytes), IMSI (8 bytes) and ICCID (10 bytes), all BCD encoded
+		if len(content) >= 26 {
+			result.TerminalID = strings.ToUpper(hex.EncodeToString(content[0:8]))
+			result.IMSI = strings.ToUpper(hex.EncodeToString(content[8:16]))
+			result.ICCID = strings.ToUpper(hex.EncodeToString(content[16:26]))
+		} else {
+			result.InfoContent = strings.ToUpper(hex.EncodeToString(content))
+		}
+	default:
+		result.InfoTypeName = "UNKNOWN"
+		result.InfoContent = strings.ToUpper(hex.EncodeToString(content))
+	}
+}
+
+// decodeCommandReply decodes a terminal's answer to a 0x80 server command. A standard
+// 0x15 reply carries command length(1) + server flag(4) + content + language(2); an
+// extended 0x21 reply carries server flag(4) + encoding(1) + content.
+func (d *GT06Decoder) decodeCommandReply(protocol byte, data []byte, result *DecodedPacket) {
+	if len(data) < 5 {
+		result.Data = strings.ToUpper(hex.EncodeToString(data))
+		return
+	}
+
+	var flag uint32
+	var content []byte
+	if protocol == ProtocolTerminalExtended {
+		flag = binary.BigEndian.Uint32(data[0:4])
+		content = data[5:]
+	} else {
+		flag = binary.BigEndian.Uint32(data[1:5])
+		contentEnd := 1 + int(data[0])
+		if contentEnd < 5 || contentEnd > len(data) {
+			contentEnd = len(data)
+		}
+		content = data[5:contentEnd]
+	}
+
+	result.ServerFlag = &flag
+	result.CommandReply = string(content)
+}
+
+// GenerateResponse generates the ack for a packet: 7878 05 | protocol | serial | CRC | 0D0A,
+// with the CRC-ITU taken over length, protocol and serial. Devices that get an ack with
+// the wrong serial or CRC keep re-sending the packet.
 func (d *GT06Decoder) GenerateResponse(serialNumber uint16, protocolNumber byte) []byte {
 	response := make([]byte, 10)
 	offset := 0
@@ -719,7 +1072,7 @@ func (d *GT06Decoder) GenerateResponse(serialNumber uint16, protocolNumber byte)
 	binary.BigEndian.PutUint16(response[offset:], serialNumber)
 	offset += 2
 
-	// CRC (simplified - in real implementation should calculate proper CRC)
+	// CRC over length through serial
 	crc := d.calculateCRC(response[2:offset])
 	binary.BigEndian.PutUint16(response[offset:], crc)
 	offset += 2
@@ -732,8 +1085,13 @@ func (d *GT06Decoder) GenerateResponse(serialNumber uint16, protocolNumber byte)
 	return response
 }
 
-// calculateCRC calculates CRC for packet (simplified implementation)
+// calculateCRC calculates the CRC-ITU checksum of a frame
 func (d *GT06Decoder) calculateCRC(data []byte) uint16 {
+	return gt06CRC(data)
+}
+
+// gt06CRC is the CRC-ITU checksum GT06 frames carry over length through serial number
+func gt06CRC(data []byte) uint16 {
 	crc := uint16(0xFFFF)
 	for i := 0; i < len(data); i++ {
 		crc ^= uint16(data[i])
@@ -0,0 +1,114 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"testing"
+)
+
+// fuzzSeedFrames are well-formed frames of each kind: standard logins, a GPS, a status
+// and an alarm frame, and extended 0x7979 information frames
+var fuzzSeedFrames = []string{
+	"78780D01" + "0123456789012345" + "0001" + "0000" + "0D0A",
+	"78781101" + "0123456789012345" + "0022" + "2212" + "0001" + "0000" + "0D0A",
+	"78781F22" + "18060F081E00" + "C9" + "02F94690" + "09277E60" + "28" + "005A" +
+		"01AD" + "01" + "1234" + "00ABCD" + "0001" + "0000" + "0D0A",
+	"78780A13" + "46" + "04" + "03" + "0102" + "0001" + "0000" + "0D0A",
+	"78782526" + "18060F081E00" + "C9" + "02F94690" + "09277E60" + "28" + "005A" +
+		"08" + "01AD" + "01" + "1234" + "00ABCD" + "46" + "04" + "03" + "01" + "02" + "0005" + "0000" + "0D0A",
+	"7979000894" + "0004D2" + "0001" + "0000" + "0D0A",
+	"79790020940A" + "0123456789012345" + "0429011234567890" + "89977010000000000011" +
+		"0001" + "0000" + "0D0A",
+}
+
+// FuzzGT06Decode feeds arbitrary byte streams through AddData. The decoder must not panic,
+// which also rules out reads past the end of a frame, every packet must be a frame taken
+// from the input, and no packet may carry a value a real device cannot report.
+func FuzzGT06Decode(f *testing.F) {
+	for _, frameHex := range fuzzSeedFrames {
+		frame, err := hex.DecodeString(frameHex)
+		if err != nil {
+			f.Fatalf("invalid seed frame %s: %v", frameHex, err)
+		}
+		f.Add(frame)
+	}
+
+	// The decoder logs every frame; silence it so failures stay readable
+	if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		stdout := os.Stdout
+		os.Stdout = devNull
+		f.Cleanup(func() {
+			os.Stdout = stdout
+			devNull.Close()
+		})
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		input := append([]byte(nil), data...)
+		packets, _ := NewGT06Decoder().AddData(data)
+
+		for _, packet := range packets {
+			if packet == nil {
+				t.Fatalf("nil packet decoded from %X", input)
+			}
+			raw, err := hex.DecodeString(packet.Raw)
+			if err != nil || !bytes.Contains(input, raw) {
+				t.Errorf("%s packet raw %s is not a frame of the input %X", packet.ProtocolName, packet.Raw, input)
+			}
+			checkPossibleValues(t, packet)
+		}
+	})
+}
+
+// checkPossibleValues reports decoded fields whose values no real device can report
+func checkPossibleValues(t *testing.T, packet *DecodedPacket) {
+	t.Helper()
+
+	if packet.Latitude != nil && (*packet.Latitude < -90 || *packet.Latitude > 90) {
+		t.Errorf("latitude %f in %s packet %s", *packet.Latitude, packet.ProtocolName, packet.Raw)
+	}
+	if packet.Longitude != nil && (*packet.Longitude < -180 || *packet.Longitude > 180) {
+		t.Errorf("longitude %f in %s packet %s", *packet.Longitude, packet.ProtocolName, packet.Raw)
+	}
+	if packet.Course != nil && *packet.Course >= 360 {
+		t.Errorf("course %d in %s packet %s", *packet.Course, packet.ProtocolName, packet.Raw)
+	}
+	if packet.Satellites != nil && *packet.Satellites > 15 {
+		t.Errorf("satellites %d in %s packet %s", *packet.Satellites, packet.ProtocolName, packet.Raw)
+	}
+	if packet.TimezoneOffset != nil && (*packet.TimezoneOffset < MinTimezoneOffset || *packet.TimezoneOffset > MaxTimezoneOffset) {
+		t.Errorf("timezone offset %d in %s packet %s", *packet.TimezoneOffset, packet.ProtocolName, packet.Raw)
+	}
+	if packet.Voltage != nil && (packet.Voltage.Percentage < 0 || packet.Voltage.Percentage > 100) {
+		t.Errorf("voltage percentage %d in %s packet %s", packet.Voltage.Percentage, packet.ProtocolName, packet.Raw)
+	}
+	if packet.GSMSignal != nil && (packet.GSMSignal.Bars < 0 || packet.GSMSignal.Bars > 4) {
+		t.Errorf("GSM bars %d in %s packet %s", packet.GSMSignal.Bars, packet.ProtocolName, packet.Raw)
+	}
+	if packet.DeviceTime != nil && !deviceTimeMatchesRaw(packet) {
+		t.Errorf("device time %s in %s packet %s is not the date sent", packet.DeviceTime, packet.ProtocolName, packet.Raw)
+	}
+}
+
+// deviceTimeMatchesRaw checks the decoded device time against the date bytes of the frame,
+// which catches dates such as 30 February being rolled into the next month
+func deviceTimeMatchesRaw(packet *DecodedPacket) bool {
+	raw, err := hex.DecodeString(packet.Raw)
+	if err != nil {
+		return false
+	}
+	offset := 4 // start(2) + length(1) + protocol(1)
+	if packet.Extended {
+		offset = 5
+	}
+	if packet.Protocol == 0x16 {
+		offset++ // alarm type byte precedes the date
+	}
+	if len(raw) < offset+6 {
+		return false
+	}
+	return packet.DeviceTime.Year() == 2000+int(raw[offset]) &&
+		int(packet.DeviceTime.Month()) == int(raw[offset+1]) &&
+		packet.DeviceTime.Day() == int(raw[offset+2])
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/colors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ArchiveService writes JSON snapshots of data that is about to be permanently deleted
+type ArchiveService struct {
+	dir string
+}
+
+// NewArchiveService creates a new archive service writing to the configured directory
+func NewArchiveService() *ArchiveService {
+	return &ArchiveService{
+		dir: config.GetArchiveConfig().Dir,
+	}
+}
+
+// VehicleArchive is the archived form of a vehicle and its related records
+type VehicleArchive struct {
+	Vehicle    models.Vehicle       `json:"vehicle"`
+	UserAccess []models.UserVehicle `json:"user_access"`
+	GPSData    []models.GPSData     `json:"gps_data,omitempty"`
+}
+
+// vehicleArchiveFile is the top-level layout of a vehicle archive file
+type vehicleArchiveFile struct {
+	ArchivedAt time.Time        `json:"archived_at"`
+	Reason     string           `json:"reason"`
+	Vehicles   []VehicleArchive `json:"vehicles"`
+}
+
+// ArchiveVehicles writes the given vehicles, their user access records and optionally
+// their GPS history to a new JSON file, returning the file path
+func (as *ArchiveService) ArchiveVehicles(vehicles []models.Vehicle, includeGPS bool, reason string) (string, error) {
+	archive := vehicleArchiveFile{
+		ArchivedAt: time.Now(),
+		Reason:     reason,
+	}
+
+	for _, vehicle := range vehicles {
+		entry := VehicleArchive{Vehicle: vehicle}
+
+		if err := db.GetDB().Where("vehicle_id = ?", vehicle.IMEI).Find(&entry.UserAccess).Error; err != nil {
+			return "", fmt.Errorf("failed to load user access for %s: %v", vehicle.IMEI, err)
+		}
+
+		if includeGPS {
+			if err := db.GetDB().Where("imei = ?", vehicle.IMEI).Order("timestamp ASC").Find(&entry.GPSData).Error; err != nil {
+				return "", fmt.Errorf("failed to load GPS data for %s: %v", vehicle.IMEI, err)
+			}
+		}
+
+		archive.Vehicles = append(archive.Vehicles, entry)
+	}
+
+	name := fmt.Sprintf("vehicles-%s.json", archive.ArchivedAt.Format("20060102-150405.000"))
+	return as.writeJSON(name, archive)
+}
+
+// writeJSON writes v as indented JSON to a new file in the archive directory
+func (as *ArchiveService) writeJSON(name string, v interface{}) (string, error) {
+	if err := os.MkdirAll(as.dir, 0o750); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %v", err)
+	}
+
+	path := filepath.Join(as.dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive file: %v", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write archive: %v", err)
+	}
+
+	colors.PrintData("🗄️", "Archive written to %s", path)
+	return path, nil
+}
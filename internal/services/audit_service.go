@@ -0,0 +1,75 @@
+package services
+
+import (
+	"time"
+
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/colors"
+)
+
+// AuditResultForStatus maps the response status of an audited request to its result
+func AuditResultForStatus(statusCode int) string {
+	switch {
+	case statusCode < 400:
+		return models.AuditResultSuccess
+	case statusCode < 500:
+		return models.AuditResultRejected
+	default:
+		return models.AuditResultFailed
+	}
+}
+
+// RecordAudit stores an audit entry. A failure is logged rather than returned, since the
+// audited action has already happened and its response must not change.
+func RecordAudit(entry *models.AuditLog) {
+	if err := db.GetDB().Create(entry).Error; err != nil {
+		colors.PrintError("Failed to record audit entry %s on %s %s: %v", entry.Action, entry.TargetType, entry.TargetID, err)
+	}
+}
+
+// AuditLogFilter narrows an audit log query; zero values do not filter
+type AuditLogFilter struct {
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   string
+	Result     string
+	From       *time.Time
+	To         *time.Time
+}
+
+// GetAuditLogs returns one page of matching audit entries, newest first, and the total match count
+func GetAuditLogs(filter AuditLogFilter, page, limit int) ([]models.AuditLog, int64, error) {
+	query := db.GetDB().Model(&models.AuditLog{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Result != "" {
+		query = query.Where("result = ?", filter.Result)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []models.AuditLog
+	err := query.Order("created_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&logs).Error
+	return logs, total, err
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/colors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSessionNotFound is returned when no session matches a session ID or refresh token
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionInactive is returned when a session has expired or been revoked
+	ErrSessionInactive = errors.New("session expired or revoked")
+)
+
+// Revoked session IDs, kept until every access token issued for them has expired.
+// Access tokens are validated without a database hit, so this list is what makes
+// revocation take effect before the token's own expiry.
+var (
+	revokedSessions      = make(map[string]time.Time)
+	revokedSessionsMutex sync.RWMutex
+)
+
+// IsSessionRevoked reports whether access tokens for the session must be rejected
+func IsSessionRevoked(sessionID string) bool {
+	revokedSessionsMutex.RLock()
+	defer revokedSessionsMutex.RUnlock()
+
+	until, exists := revokedSessions[sessionID]
+	return exists && time.Now().Before(until)
+}
+
+// MarkSessionRevoked adds a session to the in-memory revocation list until the given time
+func MarkSessionRevoked(sessionID string, until time.Time) {
+	revokedSessionsMutex.Lock()
+	defer revokedSessionsMutex.Unlock()
+
+	now := time.Now()
+	for id, expiry := range revokedSessions {
+		if now.After(expiry) {
+			delete(revokedSessions, id)
+		}
+	}
+	revokedSessions[sessionID] = until
+}
+
+// LoadRevokedSessions restores the revocation list from the database after a restart
+func LoadRevokedSessions() error {
+	accessTTL := config.GetAuthConfig().AccessTokenTTL
+
+	var sessions []models.AuthSession
+	if err := db.GetDB().Where("revoked_at > ?", time.Now().Add(-accessTTL)).Find(&sessions).Error; err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		MarkSessionRevoked(session.SessionID, session.RevokedAt.Add(accessTTL))
+	}
+
+	if len(sessions) > 0 {
+		colors.PrintInfo("Restored %d revoked auth sessions", len(sessions))
+	}
+	return nil
+}
+
+// HashRefreshToken returns the stored form of a refresh token
+func HashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRefreshToken returns a random 32-byte hex token
+func generateRefreshToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
+
+// AuthSessionService manages login sessions and their refresh tokens
+type AuthSessionService struct {
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewAuthSessionService creates a new session service using the configured token lifetimes
+func NewAuthSessionService() *AuthSessionService {
+	authConfig := config.GetAuthConfig()
+	return &AuthSessionService{
+		accessTTL:  authConfig.AccessTokenTTL,
+		refreshTTL: authConfig.RefreshTokenTTL,
+	}
+}
+
+// CreateSession starts a new session for the user and returns it with its plain refresh token
+func (s *AuthSessionService) CreateSession(userID uint, userAgent, ipAddress string) (*models.AuthSession, string, error) {
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	session := &models.AuthSession{
+		SessionID:        uuid.New().String(),
+		UserID:           userID,
+		RefreshTokenHash: HashRefreshToken(refreshToken),
+		UserAgent:        userAgent,
+		IPAddress:        ipAddress,
+		ExpiresAt:        time.Now().Add(s.refreshTTL),
+	}
+
+	if err := db.GetDB().Create(session).Error; err != nil {
+		return nil, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// Refresh exchanges a refresh token for a new one, keeping the same session.
+// The old refresh token stops working immediately.
+func (s *AuthSessionService) Refresh(refreshToken string) (*models.AuthSession, string, error) {
+	var session models.AuthSession
+	if err := db.GetDB().Where("refresh_token_hash = ?", HashRefreshToken(refreshToken)).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, "", ErrSessionNotFound
+		}
+		return nil, "", err
+	}
+
+	if !session.IsUsable() {
+		return nil, "", ErrSessionInactive
+	}
+
+	newRefreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	result := db.GetDB().Model(&models.AuthSession{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, session.RefreshTokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash": HashRefreshToken(newRefreshToken),
+			"last_used_at":       now,
+		})
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	// Another request rotated or revoked the session first
+	if result.RowsAffected == 0 {
+		return nil, "", ErrSessionInactive
+	}
+
+	session.LastUsedAt = &now
+	return &session, newRefreshToken, nil
+}
+
+// GetSession finds a session by its public session ID
+func (s *AuthSessionService) GetSession(sessionID string) (*models.AuthSession, error) {
+	var session models.AuthSession
+	if err := db.GetDB().Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionByRefreshToken finds a session by its plain refresh token
+func (s *AuthSessionService) GetSessionByRefreshToken(refreshToken string) (*models.AuthSession, error) {
+	var session models.AuthSession
+	if err := db.GetDB().Where("refresh_token_hash = ?", HashRefreshToken(refreshToken)).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListUserSessions returns the user's sessions that have not expired, newest first
+func (s *AuthSessionService) ListUserSessions(userID uint) ([]models.AuthSession, error) {
+	var sessions []models.AuthSession
+	err := db.GetDB().Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession revokes the session so neither its refresh token nor its access tokens are accepted
+func (s *AuthSessionService) RevokeSession(session *models.AuthSession) error {
+	if session.IsRevoked() {
+		return nil
+	}
+
+	now := time.Now()
+	if err := db.GetDB().Model(session).Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	session.RevokedAt = &now
+
+	MarkSessionRevoked(session.SessionID, now.Add(s.accessTTL))
+	colors.PrintInfo("Auth session %s revoked for user %d", session.SessionID, session.UserID)
+	return nil
+}
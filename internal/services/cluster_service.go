@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"luna_iot_server/internal/models"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ClusterMaxZoom is the zoom level from which vehicles are returned individually
+	ClusterMaxZoom = 15
+	// MaxMapZoom is the highest zoom level accepted from map clients
+	MaxMapZoom = 22
+	// clusterCellPixels is the grid cell size in screen pixels at the requested zoom
+	clusterCellPixels = 60
+)
+
+// ErrInvalidBoundingBox is returned for a bbox that is not four in-range numbers
+var ErrInvalidBoundingBox = errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+
+// BoundingBox is the visible map area in degrees
+type BoundingBox struct {
+	MinLat float64 `json:"min_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+// WorldBoundingBox covers every valid coordinate
+var WorldBoundingBox = BoundingBox{MinLat: -90, MinLng: -180, MaxLat: 90, MaxLng: 180}
+
+// ParseBoundingBox parses "minLng,minLat,maxLng,maxLat", the order map libraries use
+func ParseBoundingBox(value string) (BoundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, ErrInvalidBoundingBox
+	}
+
+	var numbers [4]float64
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BoundingBox{}, ErrInvalidBoundingBox
+		}
+		numbers[i] = number
+	}
+
+	box := BoundingBox{MinLng: numbers[0], MinLat: numbers[1], MaxLng: numbers[2], MaxLat: numbers[3]}
+	if box.MinLat < -90 || box.MaxLat > 90 || box.MinLng < -180 || box.MaxLng > 180 ||
+		box.MinLat > box.MaxLat || box.MinLng > box.MaxLng {
+		return BoundingBox{}, ErrInvalidBoundingBox
+	}
+	return box, nil
+}
+
+// Contains reports whether the point lies inside the box, edges included
+func (b BoundingBox) Contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// VehicleCluster is a group of nearby vehicles drawn as one marker
+type VehicleCluster struct {
+	Latitude  float64 `json:"latitude"`  // Centroid of the grouped vehicles
+	Longitude float64 `json:"longitude"` // Centroid of the grouped vehicles
+	Count     int     `json:"count"`
+}
+
+// ClusterCellSize returns the grid cell size in degrees for a zoom level. A 256 pixel
+// tile spans 360 degrees at zoom 0 and halves with every zoom level.
+func ClusterCellSize(zoom int) float64 {
+	return 360 / (256 * math.Pow(2, float64(zoom))) * clusterCellPixels
+}
+
+// ClusterLocations groups the valid fixes inside box on a grid sized for zoom.
+// Cells holding two or more vehicles become clusters; lone vehicles and every vehicle
+// at ClusterMaxZoom and above are returned individually. Clusters are ordered by
+// grid cell and vehicles by IMEI, so the same input always gives the same output.
+func ClusterLocations(locations []models.GPSData, zoom int, box BoundingBox) ([]VehicleCluster, []models.GPSData) {
+	clusters := []VehicleCluster{}
+	singles := []models.GPSData{}
+
+	type cellKey struct{ row, col int64 }
+	cells := make(map[cellKey][]models.GPSData)
+	var keys []cellKey
+
+	cellSize := ClusterCellSize(zoom)
+	for _, location := range locations {
+		if !HasValidFix(&location) || !box.Contains(*location.Latitude, *location.Longitude) {
+			continue
+		}
+		if zoom >= ClusterMaxZoom {
+			singles = append(singles, location)
+			continue
+		}
+
+		key := cellKey{
+			row: int64(math.Floor((*location.Latitude + 90) / cellSize)),
+			col: int64(math.Floor((*location.Longitude + 180) / cellSize)),
+		}
+		if _, exists := cells[key]; !exists {
+			keys = append(keys, key)
+		}
+		cells[key] = append(cells[key], location)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].row != keys[j].row {
+			return keys[i].row < keys[j].row
+		}
+		return keys[i].col < keys[j].col
+	})
+
+	for _, key := range keys {
+		members := cells[key]
+		if len(members) == 1 {
+			singles = append(singles, members[0])
+			continue
+		}
+
+		var latSum, lngSum float64
+		for _, member := range members {
+			latSum += *member.Latitude
+			lngSum += *member.Longitude
+		}
+		clusters = append(clusters, VehicleCluster{
+			Latitude:  latSum / float64(len(members)),
+			Longitude: lngSum / float64(len(members)),
+			Count:     len(members),
+		})
+	}
+
+	sort.SliceStable(singles, func(i, j int) bool {
+		return singles[i].IMEI < singles[j].IMEI
+	})
+	return clusters, singles
+}
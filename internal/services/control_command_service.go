@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/pkg/colors"
+)
+
+// ExpectedOilElectricity returns the OilElectricity state a command should leave the device
+// in, or "" for commands that do not change it
+func ExpectedOilElectricity(command string) string {
+	switch command {
+	case protocol.CmdCutOil:
+		return "DISCONNECTED"
+	case protocol.CmdConnectOil:
+		return "CONNECTED"
+	default:
+		return ""
+	}
+}
+
+// RecordControlCommand stores a sent oil/electricity command as pending confirmation.
+// Older pending commands for the device are superseded, since only the newest one can
+// match the next status packet. Commands that do not change OilElectricity are not recorded.
+func RecordControlCommand(imei, command, channel string, requestedBy *uint) (*models.ControlCommand, error) {
+	expected := ExpectedOilElectricity(command)
+	if expected == "" {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if err := db.GetDB().Model(&models.ControlCommand{}).
+		Where("imei = ? AND status = ?", imei, models.ControlCommandPending).
+		Updates(map[string]interface{}{"status": models.ControlCommandSuperseded, "resolved_at": now}).Error; err != nil {
+		return nil, fmt.Errorf("failed to supersede pending commands: %v", err)
+	}
+
+	record := &models.ControlCommand{
+		IMEI:                   imei,
+		Command:                command,
+		Channel:                channel,
+		ExpectedOilElectricity: expected,
+		Status:                 models.ControlCommandPending,
+		RequestedBy:            requestedBy,
+		SentAt:                 now,
+	}
+	if err := db.GetDB().Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to record control command: %v", err)
+	}
+	return record, nil
+}
+
+// EvaluateControlCommand decides a pending command from a status packet received at
+// receivedAt. It reports false when the packet says nothing about the command: it has
+// no OilElectricity state or was received before the command was sent.
+func EvaluateControlCommand(command *models.ControlCommand, oilElectricity string, receivedAt time.Time) (models.ControlCommandStatus, bool) {
+	if oilElectricity == "" || receivedAt.Before(command.SentAt) {
+		return command.Status, false
+	}
+	if oilElectricity == command.ExpectedOilElectricity {
+		return models.ControlCommandConfirmed, true
+	}
+	return models.ControlCommandFailed, true
+}
+
+// ConfirmControlCommands resolves the device's pending commands from the OilElectricity
+// state in a status packet and tells the user who sent each command the outcome
+func ConfirmControlCommands(imei, oilElectricity string, receivedAt time.Time) {
+	if oilElectricity == "" {
+		return
+	}
+
+	var pending []models.ControlCommand
+	if err := db.GetDB().Where("imei = ? AND status = ?", imei, models.ControlCommandPending).
+		Find(&pending).Error; err != nil {
+		colors.PrintError("Failed to load pending control commands for %s: %v", imei, err)
+		return
+	}
+
+	for i := range pending {
+		command := &pending[i]
+		status, decided := EvaluateControlCommand(command, oilElectricity, receivedAt)
+		if !decided {
+			continue
+		}
+
+		command.Status = status
+		command.ObservedOilElectricity = oilElectricity
+		command.ResolvedAt = &receivedAt
+		if err := db.GetDB().Model(command).Updates(map[string]interface{}{
+			"status":                   command.Status,
+			"observed_oil_electricity": command.ObservedOilElectricity,
+			"resolved_at":              command.ResolvedAt,
+		}).Error; err != nil {
+			colors.PrintError("Failed to update control command %d: %v", command.ID, err)
+			continue
+		}
+
+		if status == models.ControlCommandConfirmed {
+			colors.PrintControl("Command %s confirmed for device %s: oil/electricity %s", command.Command, imei, oilElectricity)
+		} else {
+			colors.PrintWarning("Command %s did not take effect on device %s: oil/electricity still %s", command.Command, imei, oilElectricity)
+		}
+		notifyControlCommandResult(command)
+	}
+}
+
+// notifyControlCommandResult tells the user who sent the command whether it took effect
+func notifyControlCommandResult(command *models.ControlCommand) {
+	if command.RequestedBy == nil {
+		return
+	}
+
+	vehicleName := command.IMEI
+	var vehicle models.Vehicle
+	if err := db.GetDB().Select("name").Where("imei = ?", command.IMEI).First(&vehicle).Error; err == nil && vehicle.Name != "" {
+		vehicleName = vehicle.Name
+	}
+
+	action := "cut"
+	if command.ExpectedOilElectricity == "CONNECTED" {
+		action = "connect"
+	}
+
+	title := "Oil and electricity " + action + " confirmed"
+	body := fmt.Sprintf("%s reported oil and electricity %s.", vehicleName, command.ExpectedOilElectricity)
+	if command.Status == models.ControlCommandFailed {
+		title = "Oil and electricity " + action + " did not take effect"
+		body = fmt.Sprintf("%s still reports oil and electricity %s.", vehicleName, command.ObservedOilElectricity)
+	}
+
+	NotifyInApp([]uint{*command.RequestedBy}, &InAppNotification{
+		Type:  "control_command",
+		Title: title,
+		Body:  body,
+		Data: map[string]interface{}{
+			"command_id": command.ID,
+			"imei":       command.IMEI,
+			"command":    command.Command,
+			"status":     command.Status,
+		},
+	})
+}
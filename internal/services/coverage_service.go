@@ -0,0 +1,91 @@
+package services
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultCoverageInterval is the expected reporting interval when a coverage request does not give one
+const DefaultCoverageInterval = time.Minute
+
+// MaxCoverageBuckets bounds how many intervals one coverage request may split its period into
+const MaxCoverageBuckets = 20000
+
+// CoverageGap is a run of consecutive intervals in which the device sent nothing
+type CoverageGap struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	MissedBuckets int       `json:"missed_buckets"`
+}
+
+// CoverageReport is how much of a period a device reported in
+type CoverageReport struct {
+	From                    time.Time     `json:"from"`
+	To                      time.Time     `json:"to"`
+	ExpectedIntervalSeconds float64       `json:"expected_interval_seconds"`
+	TotalBuckets            int           `json:"total_buckets"`
+	ReportedBuckets         int           `json:"reported_buckets"`
+	CoveragePercent         float64       `json:"coverage_percent"`
+	Gaps                    []CoverageGap `json:"gaps"`
+}
+
+// CoverageBucketCount is how many intervals [from, to) splits into; the last may be shorter
+func CoverageBucketCount(from, to time.Time, interval time.Duration) int {
+	if interval <= 0 || !to.After(from) {
+		return 0
+	}
+	return int(math.Ceil(float64(to.Sub(from)) / float64(interval)))
+}
+
+// CalculateCoverage splits [from, to) into buckets of the expected interval and counts the
+// buckets holding at least one of the timestamps. Empty buckets next to each other are
+// reported as one gap.
+func CalculateCoverage(timestamps []time.Time, from, to time.Time, interval time.Duration) CoverageReport {
+	report := CoverageReport{
+		From:                    from,
+		To:                      to,
+		ExpectedIntervalSeconds: interval.Seconds(),
+		TotalBuckets:            CoverageBucketCount(from, to, interval),
+		Gaps:                    []CoverageGap{},
+	}
+	if report.TotalBuckets == 0 {
+		return report
+	}
+
+	reported := make([]bool, report.TotalBuckets)
+	for _, timestamp := range timestamps {
+		if timestamp.Before(from) || !timestamp.Before(to) {
+			continue
+		}
+		bucket := int(timestamp.Sub(from) / interval)
+		if !reported[bucket] {
+			reported[bucket] = true
+			report.ReportedBuckets++
+		}
+	}
+
+	bucketStart := func(bucket int) time.Time {
+		start := from.Add(time.Duration(bucket) * interval)
+		if start.After(to) {
+			return to
+		}
+		return start
+	}
+	for bucket := 0; bucket < report.TotalBuckets; bucket++ {
+		if reported[bucket] {
+			continue
+		}
+		first := bucket
+		for bucket+1 < report.TotalBuckets && !reported[bucket+1] {
+			bucket++
+		}
+		report.Gaps = append(report.Gaps, CoverageGap{
+			From:          bucketStart(first),
+			To:            bucketStart(bucket + 1),
+			MissedBuckets: bucket - first + 1,
+		})
+	}
+
+	report.CoveragePercent = math.Round(float64(report.ReportedBuckets)/float64(report.TotalBuckets)*10000) / 100
+	return report
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrNoDriverAssigned is returned when unassigning a vehicle that has no current driver
+var ErrNoDriverAssigned = errors.New("no driver assigned to vehicle")
+
+// ErrAssignmentBeforeCurrent is returned when a new assignment would start before the current one
+var ErrAssignmentBeforeCurrent = errors.New("assignment starts before the current driver's assignment")
+
+// AssignDriver makes the driver the vehicle's current driver from start. Any current
+// assignment of the vehicle ends at start, so a vehicle has one driver at a time.
+func AssignDriver(imei string, driverID, assignedBy uint, start time.Time) (*models.VehicleDriverAssignment, error) {
+	assignment := models.VehicleDriverAssignment{
+		VehicleID:  imei,
+		DriverID:   driverID,
+		StartTime:  start,
+		AssignedBy: assignedBy,
+	}
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var current models.VehicleDriverAssignment
+		err := tx.Where("vehicle_id = ? AND end_time IS NULL", imei).First(&current).Error
+		if err == nil {
+			if start.Before(current.StartTime) {
+				return ErrAssignmentBeforeCurrent
+			}
+			if err := tx.Model(&current).Update("end_time", start).Error; err != nil {
+				return err
+			}
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		return tx.Create(&assignment).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	assignment.Driver = models.Driver{}
+	db.GetDB().First(&assignment.Driver, driverID)
+	return &assignment, nil
+}
+
+// UnassignDriver ends the vehicle's current assignment at end
+func UnassignDriver(imei string, end time.Time) (*models.VehicleDriverAssignment, error) {
+	var current models.VehicleDriverAssignment
+	if err := db.GetDB().Where("vehicle_id = ? AND end_time IS NULL", imei).Preload("Driver").First(&current).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNoDriverAssigned
+		}
+		return nil, err
+	}
+
+	if end.Before(current.StartTime) {
+		end = current.StartTime
+	}
+	if err := db.GetDB().Model(&current).Update("end_time", end).Error; err != nil {
+		return nil, err
+	}
+	return &current, nil
+}
+
+// GetDriverAssignments returns the driver's assignments with their vehicles, newest first.
+// Only current assignments are returned unless includeEnded is set.
+func GetDriverAssignments(driverID uint, includeEnded bool) ([]models.VehicleDriverAssignment, error) {
+	query := db.GetDB().Where("driver_id = ?", driverID)
+	if !includeEnded {
+		query = query.Where("end_time IS NULL")
+	}
+
+	var assignments []models.VehicleDriverAssignment
+	err := query.Preload("Vehicle").Order("start_time DESC").Find(&assignments).Error
+	return assignments, err
+}
+
+// GetVehicleAssignments returns the assignments of the given vehicles that overlap
+// [from, to], with their drivers, grouped by IMEI and ordered by start time
+func GetVehicleAssignments(imeis []string, from, to time.Time) (map[string][]models.VehicleDriverAssignment, error) {
+	assignmentsByVehicle := make(map[string][]models.VehicleDriverAssignment)
+	if len(imeis) == 0 {
+		return assignmentsByVehicle, nil
+	}
+
+	var assignments []models.VehicleDriverAssignment
+	if err := db.GetDB().
+		Where("vehicle_id IN ? AND start_time <= ? AND (end_time IS NULL OR end_time > ?)", imeis, to, from).
+		Preload("Driver").
+		Order("start_time ASC").
+		Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+
+	for _, assignment := range assignments {
+		assignmentsByVehicle[assignment.VehicleID] = append(assignmentsByVehicle[assignment.VehicleID], assignment)
+	}
+	return assignmentsByVehicle, nil
+}
+
+// AttributeTrip returns the assignment covering most of the trip window [start, end],
+// or nil when no driver was assigned during it. For an instantaneous trip the driver
+// assigned at that moment is used.
+func AttributeTrip(assignments []models.VehicleDriverAssignment, start, end time.Time) *models.VehicleDriverAssignment {
+	var best *models.VehicleDriverAssignment
+	var bestOverlap time.Duration
+
+	for i := range assignments {
+		assignment := &assignments[i]
+		if !end.After(start) {
+			if assignment.Covers(start) {
+				return assignment
+			}
+			continue
+		}
+
+		if overlap := assignment.Overlap(start, end); overlap > bestOverlap {
+			best = assignment
+			bestOverlap = overlap
+		}
+	}
+	return best
+}
+
+// FilterByDriver keeps the GPS rows recorded while the driver was assigned
+func FilterByDriver(gpsData []models.GPSData, assignments []models.VehicleDriverAssignment, driverID uint) []models.GPSData {
+	var filtered []models.GPSData
+	for _, data := range gpsData {
+		for i := range assignments {
+			if assignments[i].DriverID == driverID && assignments[i].Covers(data.Timestamp) {
+				filtered = append(filtered, data)
+				break
+			}
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DetectDrivingEvent compares a fix with the previous fix of its device and returns the
+// harsh braking or acceleration between them, or nil. Both fixes need a speed, and the
+// speed must change by more than the threshold within the window.
+func DetectDrivingEvent(previous, current *models.GPSData, cfg *config.DrivingEventConfig) *models.DrivingEvent {
+	if previous == nil || previous.Speed == nil || current.Speed == nil {
+		return nil
+	}
+
+	gap := current.Timestamp.Sub(previous.Timestamp)
+	if gap <= 0 || gap > cfg.Window {
+		return nil
+	}
+
+	change := *current.Speed - *previous.Speed
+	var eventType string
+	switch {
+	case cfg.HarshBrakingKmh > 0 && -change > cfg.HarshBrakingKmh:
+		eventType = models.DrivingEventHarshBraking
+	case cfg.HarshAccelerationKmh > 0 && change > cfg.HarshAccelerationKmh:
+		eventType = models.DrivingEventHarshAcceleration
+	default:
+		return nil
+	}
+
+	// A status-only fix, e.g. when stopping filters the coordinates, takes the previous position
+	latitude, longitude := current.Latitude, current.Longitude
+	if latitude == nil || longitude == nil {
+		latitude, longitude = previous.Latitude, previous.Longitude
+	}
+
+	return &models.DrivingEvent{
+		IMEI:         current.IMEI,
+		Timestamp:    current.Timestamp,
+		Type:         eventType,
+		StartSpeed:   *previous.Speed,
+		EndSpeed:     *current.Speed,
+		Seconds:      gap.Seconds(),
+		Acceleration: float64(change) / 3.6 / gap.Seconds(),
+		Latitude:     latitude,
+		Longitude:    longitude,
+	}
+}
+
+// RecordDrivingEvent checks a saved GPS or status row against the device's previous row
+// with a speed and stores the harsh driving event between them, if any. Replayed frames
+// find the event already stored and leave it alone.
+func RecordDrivingEvent(gpsData *models.GPSData, cfg *config.DrivingEventConfig) (*models.DrivingEvent, error) {
+	if gpsData.Speed == nil {
+		return nil, nil
+	}
+
+	var previous models.GPSData
+	err := db.GetDB().Where("imei = ? AND timestamp < ? AND timestamp >= ? AND speed IS NOT NULL",
+		gpsData.IMEI, gpsData.Timestamp, gpsData.Timestamp.Add(-cfg.Window)).
+		Order("timestamp DESC").First(&previous).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	event := DetectDrivingEvent(&previous, gpsData, cfg)
+	if event == nil {
+		return nil, nil
+	}
+
+	result := db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil // Already recorded
+	}
+	return event, nil
+}
+
+// GetDrivingEvents returns a vehicle's driving events between from and to, oldest first,
+// optionally only those of one type
+func GetDrivingEvents(imei string, from, to time.Time, eventType string) ([]models.DrivingEvent, error) {
+	query := db.GetReadDB().Where("imei = ? AND timestamp BETWEEN ? AND ?", imei, from, to)
+	if eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+
+	var events []models.DrivingEvent
+	err := query.Order("timestamp ASC").Find(&events).Error
+	return events, err
+}
+
+// CountDrivingEvents counts events by type; every type is present, with zero when unseen
+func CountDrivingEvents(events []models.DrivingEvent) map[string]int {
+	counts := map[string]int{
+		models.DrivingEventHarshBraking:      0,
+		models.DrivingEventHarshAcceleration: 0,
+	}
+	for _, event := range events {
+		counts[event.Type]++
+	}
+	return counts
+}
+
+// DriverSafetySummary totals a driver's harsh driving over the time they were assigned
+// to vehicles within a range
+type DriverSafetySummary struct {
+	DriverID          uint      `json:"driver_id"`
+	From              time.Time `json:"from"`
+	To                time.Time `json:"to"`
+	DistanceKm        float64   `json:"distance_km"`
+	HarshBraking      int       `json:"harsh_braking"`
+	HarshAcceleration int       `json:"harsh_acceleration"`
+	// Harsh events per 100 km driven, for comparing drivers who drive different amounts;
+	// 0 when the driver covered no distance
+	EventsPer100Km float64 `json:"events_per_100km"`
+	Vehicles       int     `json:"vehicles"` // Vehicles driven in the range
+}
+
+// GetDriverSafetySummary totals the distance and harsh driving events of the vehicles the
+// driver was assigned to, counting only the part of each assignment inside [from, to]
+func GetDriverSafetySummary(driverID uint, from, to time.Time, movingSpeedKmh int) (*DriverSafetySummary, error) {
+	var assignments []models.VehicleDriverAssignment
+	if err := db.GetDB().
+		Where("driver_id = ? AND start_time <= ? AND (end_time IS NULL OR end_time > ?)", driverID, to, from).
+		Order("start_time ASC").
+		Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+
+	summary := &DriverSafetySummary{DriverID: driverID, From: from, To: to}
+	vehicles := make(map[string]bool)
+	for _, assignment := range assignments {
+		start, end := assignment.StartTime, to
+		if from.After(start) {
+			start = from
+		}
+		if assignment.EndTime != nil && assignment.EndTime.Before(end) {
+			end = *assignment.EndTime
+		}
+		if !end.After(start) {
+			continue
+		}
+		vehicles[assignment.VehicleID] = true
+
+		var gpsData []models.GPSData
+		if err := db.GetReadDB().Where("imei = ? AND timestamp >= ? AND timestamp < ?", assignment.VehicleID, start, end).
+			Order("timestamp ASC").Find(&gpsData).Error; err != nil {
+			return nil, err
+		}
+		summary.DistanceKm += TravelDistanceKm(gpsData, movingSpeedKmh)
+
+		var events []models.DrivingEvent
+		if err := db.GetReadDB().Where("imei = ? AND timestamp >= ? AND timestamp < ?", assignment.VehicleID, start, end).
+			Find(&events).Error; err != nil {
+			return nil, err
+		}
+		counts := CountDrivingEvents(events)
+		summary.HarshBraking += counts[models.DrivingEventHarshBraking]
+		summary.HarshAcceleration += counts[models.DrivingEventHarshAcceleration]
+	}
+
+	summary.Vehicles = len(vehicles)
+	if summary.DistanceKm > 0 {
+		summary.EventsPer100Km = float64(summary.HarshBraking+summary.HarshAcceleration) / summary.DistanceKm * 100
+	}
+	return summary, nil
+}
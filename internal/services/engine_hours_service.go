@@ -0,0 +1,91 @@
+package services
+
+import (
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EngineHoursMaxGap caps the time credited between two samples. A device that stops
+// reporting with the ignition on (lost signal, power cut) is not assumed to have run
+// for the whole silence.
+const EngineHoursMaxGap = 15 * time.Minute
+
+// EngineHoursState is the running engine-hours counter of one vehicle
+type EngineHoursState struct {
+	Hours     float64
+	EngineOn  bool       // Ignition state of the last sample counted
+	UpdatedAt *time.Time // Timestamp of the last sample counted
+}
+
+// AccumulateEngineHours applies one sample to the counter. The time since the previous
+// sample is credited when the ignition was on at the previous sample, capped at maxGap.
+// Samples without an ignition state or older than the last one counted are ignored.
+func AccumulateEngineHours(state EngineHoursState, ignition string, timestamp time.Time, maxGap time.Duration) EngineHoursState {
+	if ignition != "ON" && ignition != "OFF" {
+		return state
+	}
+	if state.UpdatedAt != nil && !timestamp.After(*state.UpdatedAt) {
+		return state
+	}
+
+	if state.EngineOn && state.UpdatedAt != nil {
+		gap := timestamp.Sub(*state.UpdatedAt)
+		if gap > maxGap {
+			gap = maxGap
+		}
+		state.Hours += gap.Hours()
+	}
+
+	state.EngineOn = ignition == "ON"
+	state.UpdatedAt = &timestamp
+	return state
+}
+
+// RecordEngineHours adds a saved GPS or status row to its vehicle's engine-hours counter.
+// The vehicle row is locked so concurrent packets from one device are counted once each.
+func RecordEngineHours(gpsData *models.GPSData) error {
+	if gpsData.Ignition != "ON" && gpsData.Ignition != "OFF" {
+		return nil
+	}
+
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var vehicle models.Vehicle
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("imei", "engine_hours", "engine_on", "engine_hours_updated_at").
+			Where("imei = ?", gpsData.IMEI).
+			First(&vehicle).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil // Device without a vehicle
+		}
+		if err != nil {
+			return err
+		}
+
+		state := AccumulateEngineHours(EngineHoursState{
+			Hours:     vehicle.EngineHours,
+			EngineOn:  vehicle.EngineOn,
+			UpdatedAt: vehicle.EngineHoursUpdatedAt,
+		}, gpsData.Ignition, gpsData.Timestamp, EngineHoursMaxGap)
+
+		if state.UpdatedAt == vehicle.EngineHoursUpdatedAt {
+			return nil // Sample ignored
+		}
+
+		return tx.Model(&models.Vehicle{}).Where("imei = ?", gpsData.IMEI).Updates(map[string]interface{}{
+			"engine_hours":            state.Hours,
+			"engine_on":               state.EngineOn,
+			"engine_hours_updated_at": state.UpdatedAt,
+		}).Error
+	})
+}
+
+// CalibrateEngineHours sets the counter to the reading on the vehicle's hour meter.
+// Accumulation continues from the last sample counted.
+func CalibrateEngineHours(imei string, hours float64) (bool, error) {
+	result := db.GetDB().Model(&models.Vehicle{}).Where("imei = ?", imei).Update("engine_hours", hours)
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"luna_iot_server/config"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/utils"
+	"math"
+	"time"
+)
+
+const (
+	// ETARecentWindow is how far back fixes count towards the recent average speed
+	ETARecentWindow = 15 * time.Minute
+	// defaultTypicalSpeedKmh is used for vehicle types without a typical speed
+	defaultTypicalSpeedKmh = 35
+)
+
+// Where the ETA speed came from
+const (
+	ETASpeedRecentAverage = "recent_average"
+	ETASpeedTypical       = "typical_for_vehicle_type"
+)
+
+// TypicalSpeedKmh is the average road speed assumed for a vehicle type, used when
+// the vehicle is stopped and its own recent speed says nothing about the trip ahead
+var TypicalSpeedKmh = map[models.VehicleType]float64{
+	models.VehicleTypeBike:      35,
+	models.VehicleTypeCar:       40,
+	models.VehicleTypeTruck:     30,
+	models.VehicleTypeBus:       30,
+	models.VehicleTypeSchoolBus: 30,
+}
+
+// ETAEstimate is a naive arrival estimate: straight-line distance at a constant speed.
+// Roads, traffic and stops are not considered, so it is always marked as an estimate.
+type ETAEstimate struct {
+	DistanceKm  float64   `json:"distance_km"`
+	SpeedKmh    float64   `json:"speed_kmh"`
+	SpeedSource string    `json:"speed_source"`
+	ETASeconds  int64     `json:"eta_seconds"`
+	ArrivalTime time.Time `json:"arrival_time"`
+	IsEstimate  bool      `json:"is_estimate"`
+	Method      string    `json:"method"`
+}
+
+// EstimateETA estimates when the vehicle at current reaches (destLat, destLng).
+// The speed is the average of the recent fixes while the vehicle is moving, and the
+// vehicle type's typical speed when it is stopped or there is no recent movement.
+func EstimateETA(current models.GPSData, recent []models.GPSData, vehicleType models.VehicleType, destLat, destLng float64, now time.Time) ETAEstimate {
+	distanceKm := utils.CalculateDistance(*current.Latitude, *current.Longitude, destLat, destLng)
+
+	speedKmh, source := RecentAverageSpeed(current, recent), ETASpeedRecentAverage
+	if speedKmh < float64(config.GetMovingSpeedKmh()) {
+		speedKmh, source = TypicalSpeed(vehicleType), ETASpeedTypical
+	}
+
+	etaSeconds := int64(math.Round(distanceKm / speedKmh * 3600))
+	return ETAEstimate{
+		DistanceKm:  math.Round(distanceKm*1000) / 1000,
+		SpeedKmh:    math.Round(speedKmh*10) / 10,
+		SpeedSource: source,
+		ETASeconds:  etaSeconds,
+		ArrivalTime: now.Add(time.Duration(etaSeconds) * time.Second),
+		IsEstimate:  true,
+		Method:      "straight_line",
+	}
+}
+
+// RecentAverageSpeed averages the reported speed of the recent fixes, stops included.
+// It is 0 when the current fix shows the vehicle stopped, since a parked vehicle's
+// earlier speed does not predict when it will arrive.
+func RecentAverageSpeed(current models.GPSData, recent []models.GPSData) float64 {
+	if current.Speed == nil || !config.IsMovingSpeed(*current.Speed, config.GetMovingSpeedKmh()) {
+		return 0
+	}
+
+	total, count := 0, 0
+	for i := range recent {
+		if recent[i].Speed == nil || !HasValidFix(&recent[i]) {
+			continue
+		}
+		total += *recent[i].Speed
+		count++
+	}
+	if count == 0 {
+		return float64(*current.Speed)
+	}
+	return float64(total) / float64(count)
+}
+
+// TypicalSpeed returns the typical road speed for the vehicle type
+func TypicalSpeed(vehicleType models.VehicleType) float64 {
+	if speed, exists := TypicalSpeedKmh[vehicleType]; exists {
+		return speed
+	}
+	return defaultTypicalSpeedKmh
+}
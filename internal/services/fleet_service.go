@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FleetOnlineWindow is how recent a vehicle's last packet must be for it to count as online,
+// the same threshold the TCP server's device timeout monitor uses
+const FleetOnlineWindow = 5 * time.Minute
+
+// Connection states a vehicle list can be filtered by
+const (
+	ConnectionStatusOnline  = "online"
+	ConnectionStatusOffline = "offline"
+	ConnectionStatusMoving  = "moving"
+	ConnectionStatusIdle    = "idle"
+)
+
+// IsValidConnectionStatus reports whether status is one of the connection state filters
+func IsValidConnectionStatus(status string) bool {
+	switch status {
+	case ConnectionStatusOnline, ConnectionStatusOffline, ConnectionStatusMoving, ConnectionStatusIdle:
+		return true
+	}
+	return false
+}
+
+// latestRowMatches is a condition on each vehicle's newest gps_data row, with the row aliased as latest
+func latestRowMatches(condition string) string {
+	return "EXISTS (SELECT 1 FROM (SELECT timestamp, speed, ignition FROM gps_data" +
+		" WHERE gps_data.imei = vehicles.imei ORDER BY gps_data.id DESC LIMIT 1) latest WHERE " + condition + ")"
+}
+
+// FilterVehiclesByConnectionStatus narrows a query on vehicles to one connection state,
+// classified as SummarizeFleet does: online vehicles are connected or reported within
+// FleetOnlineWindow, and moving and idle vehicles must have reported within it.
+// connected lists the IMEIs with an open TCP connection.
+func FilterVehiclesByConnectionStatus(query *gorm.DB, status string, connected []string, now time.Time, movingSpeedKmh int) (*gorm.DB, error) {
+	cutoff := now.Add(-FleetOnlineWindow)
+	fresh := latestRowMatches("latest.timestamp >= ?")
+
+	switch status {
+	case ConnectionStatusOnline:
+		if len(connected) == 0 {
+			return query.Where(fresh, cutoff), nil
+		}
+		return query.Where("(vehicles.imei IN ? OR "+fresh+")", connected, cutoff), nil
+	case ConnectionStatusOffline:
+		if len(connected) == 0 {
+			return query.Where("NOT "+fresh, cutoff), nil
+		}
+		return query.Where("vehicles.imei NOT IN ? AND NOT "+fresh, connected, cutoff), nil
+	case ConnectionStatusMoving:
+		return query.Where(latestRowMatches("latest.timestamp >= ? AND latest.speed > ?"), cutoff, movingSpeedKmh), nil
+	case ConnectionStatusIdle:
+		return query.Where(latestRowMatches("latest.timestamp >= ? AND COALESCE(latest.speed, 0) <= ? AND latest.ignition = 'ON'"),
+			cutoff, movingSpeedKmh), nil
+	}
+	return nil, fmt.Errorf("unknown connection status %q", status)
+}
+
+// FleetSummary counts a user's vehicles by their current state. Online vehicles are split
+// into moving, idle and stopped; offline includes the vehicles that never reported.
+type FleetSummary struct {
+	TotalVehicles   int     `json:"total_vehicles"`
+	Online          int     `json:"online"`
+	Moving          int     `json:"moving"`
+	Idle            int     `json:"idle"`
+	Stopped         int     `json:"stopped"`
+	Offline         int     `json:"offline"`
+	NoData          int     `json:"no_data"`
+	DistanceTodayKm float64 `json:"distance_today_km"`
+}
+
+// FleetVehicle is one vehicle's input to SummarizeFleet
+type FleetVehicle struct {
+	IMEI            string
+	Overspeed       int
+	Latest          *models.GPSData // Newest row of any kind; nil when the device never reported
+	Connected       bool            // Has an open TCP connection
+	DistanceTodayKm float64
+}
+
+// SummarizeFleet classifies each vehicle at now. A vehicle is online while connected or
+// when its latest row is within FleetOnlineWindow, and its state comes from that row; an
+// online vehicle whose latest row is older is counted as stopped.
+func SummarizeFleet(vehicles []FleetVehicle, now time.Time, movingSpeedKmh int) FleetSummary {
+	summary := FleetSummary{TotalVehicles: len(vehicles)}
+
+	for _, vehicle := range vehicles {
+		summary.DistanceTodayKm += vehicle.DistanceTodayKm
+
+		fresh := vehicle.Latest != nil && now.Sub(vehicle.Latest.Timestamp) <= FleetOnlineWindow
+		if !vehicle.Connected && !fresh {
+			summary.Offline++
+			if vehicle.Latest == nil {
+				summary.NoData++
+			}
+			continue
+		}
+
+		summary.Online++
+		if !fresh {
+			summary.Stopped++
+			continue
+		}
+
+		speed := 0
+		if vehicle.Latest.Speed != nil {
+			speed = *vehicle.Latest.Speed
+		}
+		switch state := DetermineVehicleState(speed, vehicle.Latest.Ignition, vehicle.Overspeed, movingSpeedKmh); {
+		case state.IsMoving():
+			summary.Moving++
+		case state == VehicleStatusIdle:
+			summary.Idle++
+		default:
+			summary.Stopped++
+		}
+	}
+
+	return summary
+}
+
+// GetFleetSummary summarizes every vehicle the user has active, unexpired access to. The
+// latest rows and today's distances are each read with one query for the whole fleet;
+// isConnected reports open TCP connections and may be nil.
+func GetFleetSummary(userID uint, isConnected func(imei string) bool) (FleetSummary, error) {
+	var userVehicles []models.UserVehicle
+	if err := db.GetDB().
+		Where("user_id = ? AND is_active = ?", userID, true).
+		Preload("Vehicle").
+		Find(&userVehicles).Error; err != nil {
+		return FleetSummary{}, err
+	}
+
+	var imeis []string
+	vehicles := make([]FleetVehicle, 0, len(userVehicles))
+	for _, uv := range userVehicles {
+		if uv.IsExpired() {
+			continue
+		}
+		imeis = append(imeis, uv.VehicleID)
+		vehicles = append(vehicles, FleetVehicle{IMEI: uv.VehicleID, Overspeed: uv.Vehicle.Overspeed})
+	}
+	if len(vehicles) == 0 {
+		return FleetSummary{}, nil
+	}
+
+	var latestRows []models.GPSData
+	latestSubQuery := db.GetReadDB().
+		Select("MAX(id) as id").
+		Model(&models.GPSData{}).
+		Where("imei IN ?", imeis).
+		Group("imei")
+	if err := db.GetReadDB().
+		Select("id, imei, timestamp, speed, ignition").
+		Where("id IN (?)", latestSubQuery).
+		Find(&latestRows).Error; err != nil {
+		return FleetSummary{}, err
+	}
+	latest := make(map[string]*models.GPSData, len(latestRows))
+	for i := range latestRows {
+		latest[latestRows[i].IMEI] = &latestRows[i]
+	}
+
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var distances []struct {
+		IMEI     string
+		Distance float64
+	}
+	if err := db.GetReadDB().Model(&models.GPSData{}).
+		Select("imei, COALESCE(SUM(distance_from_prev), 0) AS distance").
+		Where("imei IN ? AND timestamp >= ? AND distance_from_prev IS NOT NULL", imeis, startOfDay).
+		Group("imei").
+		Scan(&distances).Error; err != nil {
+		return FleetSummary{}, err
+	}
+	distanceToday := make(map[string]float64, len(distances))
+	for _, d := range distances {
+		distanceToday[d.IMEI] = d.Distance
+	}
+
+	for i := range vehicles {
+		imei := vehicles[i].IMEI
+		vehicles[i].Latest = latest[imei]
+		vehicles[i].DistanceTodayKm = distanceToday[imei]
+		vehicles[i].Connected = isConnected != nil && isConnected(imei)
+	}
+
+	return SummarizeFleet(vehicles, now, config.GetMovingSpeedKmh()), nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/pkg/colors"
+	"luna_iot_server/pkg/lru"
+)
+
+// ErrGeocoderDisabled is returned when no geocoding backend is configured
+var ErrGeocoderDisabled = errors.New("reverse geocoding is not configured")
+
+// AddressResolver converts coordinates into a human-readable address
+type AddressResolver interface {
+	ReverseGeocode(lat, lng float64) (string, error)
+}
+
+// NominatimResolver resolves addresses using an OSM Nominatim compatible endpoint
+type NominatimResolver struct {
+	url       string
+	userAgent string
+	client    *http.Client
+}
+
+// NewNominatimResolver creates a new Nominatim resolver
+func NewNominatimResolver(endpoint, userAgent string, timeout time.Duration) *NominatimResolver {
+	return &NominatimResolver{
+		url:       endpoint,
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// nominatimResponse represents the subset of the Nominatim reverse response we use
+type nominatimResponse struct {
+	DisplayName string `json:"display_name"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ReverseGeocode looks up the address for the given coordinates
+func (nr *NominatimResolver) ReverseGeocode(lat, lng float64) (string, error) {
+	params := url.Values{}
+	params.Set("format", "jsonv2")
+	params.Set("lat", fmt.Sprintf("%.6f", lat))
+	params.Set("lon", fmt.Sprintf("%.6f", lng))
+
+	req, err := http.NewRequest("GET", nr.url+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create geocoding request: %v", err)
+	}
+	req.Header.Set("User-Agent", nr.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := nr.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("geocoding request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read geocoding response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("geocoding service returned status %d", resp.StatusCode)
+	}
+
+	var result nominatimResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse geocoding response: %v", err)
+	}
+
+	if result.Error != "" {
+		return "", fmt.Errorf("geocoding service error: %s", result.Error)
+	}
+
+	return result.DisplayName, nil
+}
+
+// disabledResolver is used when no geocoding backend is configured
+type disabledResolver struct{}
+
+// ReverseGeocode always reports that geocoding is disabled
+func (disabledResolver) ReverseGeocode(lat, lng float64) (string, error) {
+	return "", ErrGeocoderDisabled
+}
+
+// cachedAddress stores a resolved address with its resolution time
+type cachedAddress struct {
+	Address    string
+	ResolvedAt time.Time
+}
+
+// CachingAddressResolver wraps an AddressResolver and caches results by rounded coordinate.
+// At most size addresses are kept, least recently used dropped first, so a fleet moving
+// through new places cannot grow the cache without bound.
+type CachingAddressResolver struct {
+	backend   AddressResolver
+	precision int
+	ttl       time.Duration
+	cache     *lru.Cache[string, cachedAddress]
+	mutex     sync.Mutex
+}
+
+// NewCachingAddressResolver creates a caching wrapper around the given resolver
+func NewCachingAddressResolver(backend AddressResolver, precision int, ttl time.Duration, size int) *CachingAddressResolver {
+	return &CachingAddressResolver{
+		backend:   backend,
+		precision: precision,
+		ttl:       ttl,
+		cache:     lru.New[string, cachedAddress](size),
+	}
+}
+
+// cacheKey rounds coordinates to the configured precision so nearby points share an entry
+func (cr *CachingAddressResolver) cacheKey(lat, lng float64) string {
+	factor := math.Pow(10, float64(cr.precision))
+	return fmt.Sprintf("%.*f,%.*f", cr.precision, math.Round(lat*factor)/factor, cr.precision, math.Round(lng*factor)/factor)
+}
+
+// ReverseGeocode returns a cached address or resolves it through the backend
+func (cr *CachingAddressResolver) ReverseGeocode(lat, lng float64) (string, error) {
+	key := cr.cacheKey(lat, lng)
+
+	cr.mutex.Lock()
+	entry, exists := cr.cache.Get(key)
+	if exists && time.Since(entry.ResolvedAt) >= cr.ttl {
+		cr.cache.Delete(key)
+		exists = false
+	}
+	cr.mutex.Unlock()
+
+	if exists {
+		return entry.Address, nil
+	}
+
+	address, err := cr.backend.ReverseGeocode(lat, lng)
+	if err != nil {
+		return "", err
+	}
+
+	cr.mutex.Lock()
+	cr.cache.Set(key, cachedAddress{Address: address, ResolvedAt: time.Now()})
+	cr.mutex.Unlock()
+
+	return address, nil
+}
+
+var (
+	addressResolver     AddressResolver
+	addressResolverOnce sync.Once
+)
+
+// GetAddressResolver returns the shared address resolver built from configuration
+func GetAddressResolver() AddressResolver {
+	addressResolverOnce.Do(func() {
+		geoConfig := config.GetGeocodingConfig()
+		if !geoConfig.IsEnabled() {
+			colors.PrintInfo("🗺️ Reverse geocoding disabled (GEOCODER_PROVIDER not set)")
+			addressResolver = disabledResolver{}
+			return
+		}
+
+		// Both supported providers speak the Nominatim reverse API; "custom" only changes the endpoint
+		backend := NewNominatimResolver(geoConfig.URL, geoConfig.UserAgent, geoConfig.Timeout)
+		addressResolver = NewCachingAddressResolver(backend, geoConfig.CachePrecision, geoConfig.CacheTTL, geoConfig.CacheSize)
+		colors.PrintInfo("🗺️ Reverse geocoding enabled: provider=%s, url=%s", geoConfig.Provider, geoConfig.URL)
+	})
+	return addressResolver
+}
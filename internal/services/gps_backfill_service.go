@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/colors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrBackfillRunning is returned when a backfill is started while another is in progress
+var ErrBackfillRunning = errors.New("a GPS backfill is already running")
+
+// GPSBackfillProgress describes the state of the current or last backfill run
+type GPSBackfillProgress struct {
+	Running     bool       `json:"running"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	LastID      uint       `json:"last_id"` // Rows up to this ID are done; pass it back to resume
+	Processed   int64      `json:"processed"`
+	Updated     int64      `json:"updated"`
+	Cancelled   bool       `json:"cancelled"`
+	Error       string     `json:"error,omitempty"`
+	BatchSize   int        `json:"batch_size"`
+	StartAfter  uint       `json:"start_after_id"`
+	LastBatchAt *time.Time `json:"last_batch_at,omitempty"`
+}
+
+// GPSBackfillService recomputes derived GPS fields (accuracy, LBS flag and
+// distance from the previous point) for historical rows in ID order
+type GPSBackfillService struct {
+	mutex    sync.Mutex
+	progress GPSBackfillProgress
+	cancel   context.CancelFunc
+}
+
+var (
+	gpsBackfillService     *GPSBackfillService
+	gpsBackfillServiceOnce sync.Once
+)
+
+// GetGPSBackfillService returns the shared backfill service so progress survives between requests
+func GetGPSBackfillService() *GPSBackfillService {
+	gpsBackfillServiceOnce.Do(func() {
+		gpsBackfillService = &GPSBackfillService{}
+	})
+	return gpsBackfillService
+}
+
+// Start launches a backfill in the background beginning after startAfterID.
+// Passing the LastID of a previous run resumes it.
+func (s *GPSBackfillService) Start(startAfterID uint, batchSize int) (GPSBackfillProgress, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.progress.Running {
+		return s.progress, ErrBackfillRunning
+	}
+
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	now := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.progress = GPSBackfillProgress{
+		Running:    true,
+		StartedAt:  &now,
+		LastID:     startAfterID,
+		BatchSize:  batchSize,
+		StartAfter: startAfterID,
+	}
+
+	go s.run(ctx, startAfterID, batchSize)
+
+	return s.progress, nil
+}
+
+// Cancel stops a running backfill after its current batch; returns false if none is running
+func (s *GPSBackfillService) Cancel() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.progress.Running || s.cancel == nil {
+		return false
+	}
+	s.cancel()
+	return true
+}
+
+// Progress returns a snapshot of the current or last run
+func (s *GPSBackfillService) Progress() GPSBackfillProgress {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.progress
+}
+
+// run processes batches until the table is exhausted or ctx is cancelled
+func (s *GPSBackfillService) run(ctx context.Context, startAfterID uint, batchSize int) {
+	colors.PrintInfo("🧮 GPS backfill started after ID %d (batch size %d)", startAfterID, batchSize)
+
+	// Last located point per device, so distance only needs a DB lookup on first sight
+	previousPoints := make(map[string]*models.GPSData)
+	lastID := startAfterID
+	var runErr error
+
+	for {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var batch []models.GPSData
+		if err := db.GetDB().Where("id > ?", lastID).Order("id ASC").Limit(batchSize).Find(&batch).Error; err != nil {
+			runErr = err
+			break
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		updated, err := s.processBatch(batch, previousPoints)
+		if err != nil {
+			runErr = err
+			break
+		}
+
+		lastID = batch[len(batch)-1].ID
+		now := time.Now()
+
+		s.mutex.Lock()
+		s.progress.LastID = lastID
+		s.progress.Processed += int64(len(batch))
+		s.progress.Updated += updated
+		s.progress.LastBatchAt = &now
+		processed := s.progress.Processed
+		s.mutex.Unlock()
+
+		colors.PrintInfo("🧮 GPS backfill progress: %d rows processed, last ID %d", processed, lastID)
+	}
+
+	finished := time.Now()
+	s.mutex.Lock()
+	s.progress.Running = false
+	s.progress.FinishedAt = &finished
+	s.progress.Cancelled = ctx.Err() != nil
+	if runErr != nil {
+		s.progress.Error = runErr.Error()
+	}
+	s.cancel = nil
+	progress := s.progress
+	s.mutex.Unlock()
+
+	// Cached latest rows still carry the derived fields from before the backfill
+	if progress.Updated > 0 {
+		GetLatestGPSCache().Clear()
+	}
+
+	switch {
+	case runErr != nil:
+		colors.PrintError("GPS backfill stopped at ID %d: %v", progress.LastID, runErr)
+	case progress.Cancelled:
+		colors.PrintWarning("GPS backfill cancelled at ID %d (%d rows processed)", progress.LastID, progress.Processed)
+	default:
+		colors.PrintSuccess("GPS backfill completed: %d rows processed, %d updated", progress.Processed, progress.Updated)
+	}
+}
+
+// processBatch recomputes derived fields for one batch inside a single transaction
+func (s *GPSBackfillService) processBatch(batch []models.GPSData, previousPoints map[string]*models.GPSData) (int64, error) {
+	var updated int64
+	movingSpeedKmh := config.GetMovingSpeedKmh()
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		for i := range batch {
+			row := &batch[i]
+			updates := map[string]interface{}{
+				"accuracy": row.AccuracyBucket(),
+				"has_lbs":  row.HasLBSData(),
+			}
+
+			if row.Latitude != nil && row.Longitude != nil {
+				if previous := s.previousLocatedPoint(tx, row, previousPoints); previous != nil {
+					updates["distance_from_prev"] = SegmentDistanceKm(previous, row, movingSpeedKmh)
+				}
+				previousPoints[row.IMEI] = row
+			}
+
+			if err := tx.Model(&models.GPSData{}).Where("id = ?", row.ID).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+
+	return updated, err
+}
+
+// previousLocatedPoint returns the located point recorded just before row for the same device
+func (s *GPSBackfillService) previousLocatedPoint(tx *gorm.DB, row *models.GPSData, previousPoints map[string]*models.GPSData) *models.GPSData {
+	if cached, ok := previousPoints[row.IMEI]; ok && !cached.Timestamp.After(row.Timestamp) {
+		return cached
+	}
+
+	var previous models.GPSData
+	err := tx.Where("imei = ? AND timestamp < ? AND latitude IS NOT NULL AND longitude IS NOT NULL", row.IMEI, row.Timestamp).
+		Order("timestamp DESC").First(&previous).Error
+	if err != nil {
+		return nil
+	}
+	return &previous
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"luna_iot_server/internal/models"
+	"sync"
+)
+
+// GPSBroadcaster delivers a saved row to live dashboards; located is false for status-only
+// rows whose coordinates were filtered out
+type GPSBroadcaster func(gpsData *models.GPSData, located bool)
+
+var (
+	gpsBroadcaster      GPSBroadcaster
+	gpsBroadcasterMutex sync.RWMutex
+)
+
+// SetGPSBroadcaster registers the real-time channel (the WebSocket hub) for saved GPS rows.
+// Services cannot import the HTTP layer, so the hub registers itself here on startup.
+func SetGPSBroadcaster(broadcaster GPSBroadcaster) {
+	gpsBroadcasterMutex.Lock()
+	defer gpsBroadcasterMutex.Unlock()
+	gpsBroadcaster = broadcaster
+}
+
+// BroadcastGPS passes the row to the registered broadcaster without waiting for it.
+// It is a no-op until a broadcaster is registered.
+func BroadcastGPS(gpsData *models.GPSData, located bool) {
+	gpsBroadcasterMutex.RLock()
+	broadcaster := gpsBroadcaster
+	gpsBroadcasterMutex.RUnlock()
+
+	if broadcaster == nil {
+		return
+	}
+	go broadcaster(gpsData, located)
+}
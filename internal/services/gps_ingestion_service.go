@@ -0,0 +1,740 @@
+package services
+
+import (
+	"fmt"
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/pkg/colors"
+	"luna_iot_server/pkg/lru"
+	"luna_iot_server/pkg/utils"
+	"math"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// IngestionService validates, filters, smooths, notifies about, saves and broadcasts GPS
+// fixes. The device TCP server and the admin injection endpoint both feed fixes through
+// it, so a fix is handled the same way wherever it comes from.
+type IngestionService struct {
+	vehicleNotificationService *VehicleNotificationService
+	store                      IngestionStore
+	// GPS processing configuration
+	enableGPSSmoothing  bool
+	enableGPSValidation bool
+	minSatellites       int
+	smoothingWeight     float64
+	// Speed sanity limits per vehicle type, with a short-lived IMEI -> type cache
+	maxSpeeds        map[string]int
+	speedCrossCheck  bool
+	jumpFilter       bool
+	vehicleTypeCache *lru.Cache[string, vehicleTypeCacheEntry]
+	vehicleTypeMutex sync.Mutex
+	// Which fixes keep their coordinates (GPS_FILTER_MODE), and the moving threshold (MOVING_SPEED_KMH)
+	gpsFilterMode  string
+	movingSpeedKmh int
+}
+
+// IngestionStore is what ingestion looks up and saves. DatabaseIngestionStore is the one
+// in use; replacing it lets fixes be ingested without a device connection or database.
+type IngestionStore struct {
+	IsDeviceRegistered func(imei string) bool
+	LastLocatedGPS     func(imei string) *models.GPSData
+	// Vehicle type of a device's vehicle, or "" when it has none; cached by the service
+	VehicleType func(imei string) string
+	// Insert a row, reporting false for a frame already stored
+	Save func(gpsData *models.GPSData) (bool, error)
+}
+
+// DatabaseIngestionStore reads and saves GPS data in the database, recording engine hours
+// and harsh driving events (HARSH_BRAKING_KMH, HARSH_ACCELERATION_KMH, HARSH_EVENT_WINDOW)
+// for every saved row
+func DatabaseIngestionStore(drivingEvents *config.DrivingEventConfig) IngestionStore {
+	return IngestionStore{
+		IsDeviceRegistered: IsDeviceRegistered,
+		LastLocatedGPS:     LastLocatedGPS,
+		VehicleType:        vehicleTypeOf,
+		Save: func(gpsData *models.GPSData) (bool, error) {
+			return saveGPSData(gpsData, drivingEvents)
+		},
+	}
+}
+
+// vehicleTypeCacheEntry caches a device's vehicle type to avoid a lookup per fix
+type vehicleTypeCacheEntry struct {
+	vehicleType string
+	expiresAt   time.Time
+}
+
+// GPSIngestResult describes what happened to a fix
+type GPSIngestResult struct {
+	// Why the fix was dropped, e.g. "implausible_speed"; empty when it was kept
+	Rejected string `json:"rejected,omitempty"`
+	// Stored as status only, without coordinates, under GPS_FILTER_MODE
+	Filtered bool `json:"filtered"`
+	// A new row was stored; false for a rejected fix, an unregistered device or a replay
+	Saved bool `json:"saved"`
+	// The row as stored, after filtering, speed correction and smoothing
+	Data *models.GPSData `json:"data,omitempty"`
+}
+
+// NewIngestionService creates an ingestion service with the GPS settings from the
+// environment, sending vehicle notifications through the given service
+func NewIngestionService(vehicleNotificationService *VehicleNotificationService) *IngestionService {
+	return NewIngestionServiceWithStore(vehicleNotificationService, DatabaseIngestionStore(config.GetDrivingEventConfig()))
+}
+
+// NewIngestionServiceWithStore creates an ingestion service that uses the given store.
+// A nil notification service sends no vehicle notifications and skips tow-away detection.
+func NewIngestionServiceWithStore(vehicleNotificationService *VehicleNotificationService, store IngestionStore) *IngestionService {
+	tcpConfig := config.GetTCPConfig()
+	return &IngestionService{
+		vehicleNotificationService: vehicleNotificationService,
+		store:                      store,
+		enableGPSSmoothing:         true, // Enable GPS smoothing by default
+		enableGPSValidation:        true, // Enable GPS validation by default
+		minSatellites:              tcpConfig.MinSatellites,
+		smoothingWeight:            tcpConfig.SmoothingWeight,
+		maxSpeeds:                  tcpConfig.MaxSpeeds,
+		speedCrossCheck:            tcpConfig.SpeedCrossCheck,
+		jumpFilter:                 tcpConfig.JumpFilter,
+		vehicleTypeCache:           lru.New[string, vehicleTypeCacheEntry](tcpConfig.DeviceStateCapacity),
+		gpsFilterMode:              tcpConfig.GPSFilterMode,
+		movingSpeedKmh:             tcpConfig.MovingSpeedKmh,
+	}
+}
+
+var (
+	ingestionService     *IngestionService
+	ingestionServiceOnce sync.Once
+)
+
+// GetIngestionService returns the shared ingestion service, so devices and injected fixes
+// in one process share vehicle states and settings
+func GetIngestionService() *IngestionService {
+	ingestionServiceOnce.Do(func() {
+		ingestionService = NewIngestionService(NewVehicleNotificationService())
+	})
+	return ingestionService
+}
+
+// VehicleNotifications returns the service that sends the vehicle notifications for ingested fixes
+func (is *IngestionService) VehicleNotifications() *VehicleNotificationService {
+	return is.vehicleNotificationService
+}
+
+// ConfigureGPSProcessing sets GPS processing options.
+// smoothingWeight is the share given to the new fix and must be in (0,1].
+func (is *IngestionService) ConfigureGPSProcessing(enableValidation, enableSmoothing bool, smoothingWeight float64) error {
+	if !config.IsValidSmoothingWeight(smoothingWeight) {
+		return fmt.Errorf("GPS smoothing weight must be in (0,1], got %v", smoothingWeight)
+	}
+
+	is.enableGPSValidation = enableValidation
+	is.enableGPSSmoothing = enableSmoothing
+	is.smoothingWeight = smoothingWeight
+	colors.PrintInfo("📍 GPS Processing configured: Validation=%v, Smoothing=%v, SmoothingWeight=%.2f",
+		enableValidation, enableSmoothing, smoothingWeight)
+	return nil
+}
+
+// GPSProcessing returns whether validation and smoothing are on, and the smoothing weight
+func (is *IngestionService) GPSProcessing() (validation, smoothing bool, smoothingWeight float64) {
+	return is.enableGPSValidation, is.enableGPSSmoothing, is.smoothingWeight
+}
+
+// SetMinSatellites sets the minimum satellite count a GPS fix needs to be accepted.
+// Fixes the device reports as not positioned need one satellite more than this.
+func (is *IngestionService) SetMinSatellites(minSatellites int) {
+	if minSatellites < 0 {
+		minSatellites = 0
+	}
+	is.minSatellites = minSatellites
+	colors.PrintInfo("📍 GPS minimum satellites set to %d", minSatellites)
+}
+
+// ProcessGPS ingests a GPS packet decoded from a device's connection, see IngestGPS. The
+// error reports a failed save; rejected and filtered fixes are not errors.
+func (is *IngestionService) ProcessGPS(packet *protocol.DecodedPacket, imei string) error {
+	gpsData := GPSDataFromPacket(packet, imei)
+	_, err := is.IngestGPS(&gpsData)
+	return err
+}
+
+// IngestGPS runs a fix through validation, tow-away detection and the GPS filter, then
+// notifies, saves and broadcasts it. gpsData is the fix as the device reported it, with
+// IMEI and Timestamp set; it is updated to the row that was stored. Rejected fixes and
+// fixes from unregistered devices are not stored, which the result reports.
+func (is *IngestionService) IngestGPS(gpsData *models.GPSData) (*GPSIngestResult, error) {
+	deviceIMEI := gpsData.IMEI
+	result := &GPSIngestResult{}
+
+	var speed int
+
+	// Extract speed if available
+	if gpsData.Speed != nil {
+		speed = *gpsData.Speed
+	}
+
+	// Reject fixes with a speed the vehicle cannot physically reach (corrupt speed byte)
+	if is.enableGPSValidation && speed > 0 {
+		if vehicleType := is.getVehicleType(deviceIMEI); vehicleType != "" {
+			if maxSpeed, ok := is.maxSpeeds[vehicleType]; ok && speed > maxSpeed {
+				colors.PrintWarning("🚫 GPS fix rejected [implausible_speed]: device=%s type=%s speed=%d km/h max=%d km/h",
+					deviceIMEI, vehicleType, speed, maxSpeed)
+				result.Rejected = "implausible_speed"
+				return result, nil
+			}
+		}
+	}
+
+	// Optionally cross-check the reported speed against the distance covered since the last fix,
+	// so a stuck speed field does not hide a moving vehicle
+	speedSource := ""
+	if gpsData.Speed != nil {
+		speedSource = "device"
+	}
+	if is.speedCrossCheck && gpsData.Latitude != nil && gpsData.Longitude != nil {
+		if previous := is.store.LastLocatedGPS(deviceIMEI); previous != nil {
+			implied, ok := utils.ImpliedSpeedKmh(*previous.Latitude, *previous.Longitude, previous.Timestamp,
+				*gpsData.Latitude, *gpsData.Longitude, gpsData.Timestamp)
+			if ok && utils.SpeedsDisagree(speed, implied) {
+				colors.PrintWarning("⚠️ Reported speed %d km/h disagrees with implied %.1f km/h for %s - using computed speed",
+					speed, implied, deviceIMEI)
+				speed = int(math.Round(implied))
+				speedSource = "computed"
+			}
+		}
+	}
+
+	// Check for towing with the device's own position, before the filter drops the
+	// coordinates of fixes with the ignition off. Weak fixes are skipped as they drift most.
+	if is.vehicleNotificationService != nil && deviceIMEI != "" && gpsData.Latitude != nil && gpsData.Longitude != nil &&
+		is.hasEnoughSatellites(gpsData) {
+		if err := is.vehicleNotificationService.CheckTowAway(deviceIMEI, gpsData.Ignition,
+			*gpsData.Latitude, *gpsData.Longitude, gpsData.Timestamp); err != nil {
+			colors.PrintWarning("Failed to send tow-away alert for %s: %v", deviceIMEI, err)
+		}
+	}
+
+	// Filter conditions depend on GPS_FILTER_MODE; filtered fixes are saved as status only
+	if keep, reason := KeepGPSLocation(is.gpsFilterMode, gpsData.Ignition, speed, is.movingSpeedKmh); !keep {
+		colors.PrintWarning("🚫 Filtering location data (mode %s): %s", is.gpsFilterMode, reason)
+		colors.PrintInfo("📍 Saving status data only (no GPS coordinates) for device %s", deviceIMEI)
+		result.Filtered = true
+
+		if deviceIMEI == "" || !is.store.IsDeviceRegistered(deviceIMEI) {
+			result.Rejected = "unregistered_device"
+			return result, nil
+		}
+
+		// Keep the status but not the location information, including the speed
+		gpsData.Latitude, gpsData.Longitude = nil, nil
+		gpsData.Speed, gpsData.Course, gpsData.Altitude = nil, nil, nil
+		gpsData.SpeedSource = ""
+		result.Data = gpsData
+
+		// Check notifications, then save filtered data whatever their outcome
+		inserted, err := is.NotifyAndSave(gpsData)
+		if err != nil {
+			colors.PrintError("Error saving filtered GPS data: %v", err)
+			return result, err
+		}
+		if inserted {
+			colors.PrintSuccess("✅ Filtered GPS data (status only) saved for device %s", deviceIMEI)
+			result.Saved = true
+
+			// Broadcast status update only (no location)
+			BroadcastGPS(gpsData, false)
+		}
+		return result, nil
+	}
+
+	// Validate GPS data exists (only when not filtering)
+	if gpsData.Latitude == nil || gpsData.Longitude == nil {
+		colors.PrintWarning("⚠️ Skipping GPS: Missing coordinates (Lat=%v, Lng=%v)", gpsData.Latitude, gpsData.Longitude)
+		result.Rejected = "missing_coordinates"
+		return result, nil
+	}
+
+	lat := *gpsData.Latitude
+	lng := *gpsData.Longitude
+
+	// FIXED: Enhanced coordinate range validation for Nepal region
+	// Nepal coordinates: Lat: 26.3478° to 30.4465°, Lng: 80.0586° to 88.2014°
+	// Made range more lenient to accept valid GPS data
+	if is.enableGPSValidation && (lat < 25.0 || lat > 31.5 || lng < 79.0 || lng > 89.5) {
+		colors.PrintWarning("📍 Invalid GPS coordinates (outside Nepal region): Lat=%.12f, Lng=%.12f", lat, lng)
+		result.Rejected = "outside_region"
+		return result, nil
+	}
+
+	// Satellite threshold is configurable (GPS_MIN_SATELLITES); unpositioned fixes need one more
+	if is.enableGPSValidation && !is.hasEnoughSatellites(gpsData) {
+		colors.PrintWarning("📍 GPS fix rejected [low_satellites]: device=%s satellites=%v positioned=%v min=%d",
+			deviceIMEI, gpsData.Satellites, gpsData.GPSPositioned, is.minSatellites)
+		result.Rejected = "low_satellites"
+		return result, nil
+	}
+
+	if is.enableGPSValidation && gpsData.GPSPositioned != nil && !*gpsData.GPSPositioned {
+		colors.PrintInfo("⚠️ GPS not positioned but decent satellite signal (%d satellites) - accepting", *gpsData.Satellites)
+	}
+
+	colors.PrintData("🌍", "Processing GPS: Lat=%.12f, Lng=%.12f, Speed=%v km/h, Ignition=%s, Satellites=%v",
+		lat, lng, gpsData.Speed, gpsData.Ignition, gpsData.Satellites)
+
+	// GPS accepted with full location data
+	colors.PrintInfo("✅ GPS accepted with location data: Ignition=%s, Speed=%d km/h", gpsData.Ignition, speed)
+
+	// FIXED: Improved duplicate coordinates check with much larger threshold
+	if is.isDuplicateCoordinates(deviceIMEI, lat, lng) {
+		colors.PrintWarning("🚫 GPS rejected: Duplicate coordinates")
+		result.Rejected = "duplicate_coordinates"
+		return result, nil
+	}
+
+	// Reject position jumps the vehicle could not have driven since its previous fix
+	if is.enableGPSValidation && is.jumpFilter && is.isGPSJump(deviceIMEI, lat, lng, gpsData.Timestamp) {
+		result.Rejected = "position_jump"
+		return result, nil
+	}
+
+	// FIXED: Less aggressive GPS smoothing to reduce zigzag lines
+	var smoothedLat, smoothedLng float64
+	if is.enableGPSSmoothing {
+		smoothedLat, smoothedLng = is.smoothGPSCoordinates(deviceIMEI, lat, lng)
+	} else {
+		smoothedLat, smoothedLng = lat, lng
+	}
+
+	// Save GPS data and broadcast to WebSocket clients
+	if deviceIMEI == "" || !is.store.IsDeviceRegistered(deviceIMEI) {
+		result.Rejected = "unregistered_device"
+		return result, nil
+	}
+
+	applySpeed(gpsData, speed, speedSource)
+
+	// Apply smoothed coordinates to the GPS data
+	gpsData.Latitude = &smoothedLat
+	gpsData.Longitude = &smoothedLng
+
+	// Record distance travelled since the previous located point, ignoring jitter while parked
+	if previous := is.store.LastLocatedGPS(deviceIMEI); previous != nil {
+		distance := SegmentDistanceKm(previous, gpsData, is.movingSpeedKmh)
+		gpsData.DistanceFromPrev = &distance
+	}
+	result.Data = gpsData
+
+	// Check notifications, then always save (don't block on notification failures)
+	inserted, err := is.NotifyAndSave(gpsData)
+	if err != nil {
+		colors.PrintError("Error saving GPS data: %v", err)
+		return result, err
+	}
+	if inserted {
+		colors.PrintSuccess("✅ GPS data saved for device %s (Original: %.12f,%.12f -> Smoothed: %.12f,%.12f)",
+			deviceIMEI, lat, lng, smoothedLat, smoothedLng)
+		result.Saved = true
+
+		// Broadcast the new full GPS data object over WebSocket
+		BroadcastGPS(gpsData, true)
+	}
+	return result, nil
+}
+
+// IngestStatus saves a status row from a registered device and broadcasts it as a status
+// update. Status packets carry no position, so a row without coordinates takes the device's
+// last located ones; speed and course come along only when filtered is false, since a
+// parked or stationary vehicle is not still moving at its last speed.
+func (is *IngestionService) IngestStatus(statusData *models.GPSData, filtered bool) (*GPSIngestResult, error) {
+	result := &GPSIngestResult{Filtered: filtered, Data: statusData}
+	if statusData.IMEI == "" || !is.store.IsDeviceRegistered(statusData.IMEI) {
+		result.Rejected = "unregistered_device"
+		return result, nil
+	}
+
+	if statusData.Latitude == nil || statusData.Longitude == nil {
+		InheritLocation(statusData, is.store.LastLocatedGPS(statusData.IMEI), !filtered)
+	}
+
+	// Check notifications, then always save so a notification failure never loses status
+	inserted, err := is.NotifyAndSave(statusData)
+	if err != nil {
+		return result, err
+	}
+	if inserted {
+		result.Saved = true
+		BroadcastGPS(statusData, false)
+	}
+	return result, nil
+}
+
+// InheritLocation copies the last known position (latest may be nil) onto a status row
+// without coordinates, so the row still shows where the vehicle is. With withMovement,
+// speed and course are copied too, but only when the row has none of its own.
+func InheritLocation(statusData, latest *models.GPSData, withMovement bool) {
+	if latest == nil || (statusData.Latitude != nil && statusData.Longitude != nil) {
+		return
+	}
+
+	statusData.Latitude = latest.Latitude
+	statusData.Longitude = latest.Longitude
+	if !withMovement {
+		return
+	}
+	if statusData.Speed == nil {
+		statusData.Speed = latest.Speed
+	}
+	if statusData.Course == nil {
+		statusData.Course = latest.Course
+	}
+}
+
+// GPSDataFromPacket creates a GPSData model from a decoded packet
+func GPSDataFromPacket(packet *protocol.DecodedPacket, deviceIMEI string) models.GPSData {
+	// Use GPS time from device if available, otherwise use packet timestamp
+	timestamp := packet.Timestamp
+	if packet.GPSTime != nil {
+		timestamp = *packet.GPSTime
+	}
+
+	gpsData := models.GPSData{
+		IMEI:         deviceIMEI,
+		Timestamp:    timestamp, // Use device GPS time
+		DeviceTime:   packet.DeviceTime,
+		ProtocolName: packet.ProtocolName,
+		RawPacket:    packet.Raw,
+	}
+
+	// GPS location data with enhanced precision
+	if packet.Latitude != nil {
+		gpsData.Latitude = packet.Latitude
+	}
+	if packet.Longitude != nil {
+		gpsData.Longitude = packet.Longitude
+	}
+	if packet.Speed != nil {
+		speed := int(*packet.Speed)
+		gpsData.Speed = &speed
+	}
+	if packet.Course != nil {
+		course := int(*packet.Course)
+		gpsData.Course = &course
+	}
+	if packet.Altitude != nil {
+		gpsData.Altitude = packet.Altitude
+	}
+	if packet.Satellites != nil {
+		satellites := int(*packet.Satellites)
+		gpsData.Satellites = &satellites
+	}
+
+	// GPS status
+	if packet.GPSRealTime != nil {
+		gpsData.GPSRealTime = packet.GPSRealTime
+	}
+	if packet.GPSPositioned != nil {
+		gpsData.GPSPositioned = packet.GPSPositioned
+	}
+
+	// Device status
+	gpsData.Ignition = packet.Ignition
+	gpsData.Charger = packet.Charger
+	gpsData.GPSTracking = packet.GPSTracking
+	gpsData.OilElectricity = packet.OilElectricity
+	gpsData.DeviceStatus = packet.DeviceStatus
+
+	// LBS data (cell tower information)
+	if packet.MCC != nil {
+		mcc := int(*packet.MCC)
+		gpsData.MCC = &mcc
+	}
+	if packet.MNC != nil {
+		mnc := int(*packet.MNC)
+		gpsData.MNC = &mnc
+	}
+	if packet.LAC != nil {
+		lac := int(*packet.LAC)
+		gpsData.LAC = &lac
+	}
+	if packet.CellID != nil {
+		cellID := int(*packet.CellID)
+		gpsData.CellID = &cellID
+	}
+
+	// Signal, power and alarm, sent by packets that combine a fix with the terminal status
+	if packet.Voltage != nil {
+		voltageLevel := int(packet.Voltage.Level)
+		gpsData.VoltageLevel = &voltageLevel
+		gpsData.VoltageStatus = packet.Voltage.Status
+	}
+	if packet.GSMSignal != nil {
+		gsmSignal := int(packet.GSMSignal.Level)
+		gpsData.GSMSignal = &gsmSignal
+		gpsData.GSMStatus = packet.GSMSignal.Status
+	}
+	if packet.Alarm != nil {
+		gpsData.AlarmActive = packet.Alarm.Active
+		gpsData.AlarmType = packet.Alarm.Type
+		gpsData.AlarmCode = packet.Alarm.Code
+	}
+
+	return gpsData
+}
+
+// NotifyAndSave checks vehicle notifications for a row and then saves it, see NotifyThenSave
+func (is *IngestionService) NotifyAndSave(gpsData *models.GPSData) (bool, error) {
+	var notify func(*models.GPSData) error
+	if is.vehicleNotificationService != nil {
+		notify = is.vehicleNotificationService.CheckAndSendVehicleNotifications
+	}
+	return NotifyThenSave(gpsData, notify, is.store.Save)
+}
+
+// NotifyThenSave runs the notification check (skipped when notify is nil) before saving the
+// row, and saves it whatever the check's outcome: a failed notification must never lose
+// device data. It returns the result of save.
+func NotifyThenSave(gpsData *models.GPSData, notify func(*models.GPSData) error, save func(*models.GPSData) (bool, error)) (bool, error) {
+	if notify != nil {
+		colors.PrintInfo("🔔 Checking notifications BEFORE saving to database")
+		if err := notify(gpsData); err != nil {
+			colors.PrintError("❌ Notification check failed: %v - STILL saving to database", err)
+		} else {
+			colors.PrintSuccess("✅ Notification check completed successfully")
+		}
+	}
+	return save(gpsData)
+}
+
+// saveGPSData inserts a GPS record, ignoring frames the device has already sent.
+// Devices replay buffered frames after reconnecting; the unique index on
+// (imei, timestamp, protocol_name) turns those replays into no-ops.
+func saveGPSData(gpsData *models.GPSData, drivingEvents *config.DrivingEventConfig) (bool, error) {
+	result := db.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "imei"}, {Name: "timestamp"}, {Name: "protocol_name"}},
+		DoNothing: true,
+	}).Create(gpsData)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		colors.PrintWarning("🔁 Replayed %s frame for device %s at %s ignored", gpsData.ProtocolName, gpsData.IMEI, gpsData.Timestamp)
+		return false, nil
+	}
+
+	// Count engine running time from the ignition state; a failure here must not drop the row
+	if err := RecordEngineHours(gpsData); err != nil {
+		colors.PrintWarning("Failed to update engine hours for %s: %v", gpsData.IMEI, err)
+	}
+
+	// Record harsh braking or acceleration since the previous row; likewise never drops the row
+	if event, err := RecordDrivingEvent(gpsData, drivingEvents); err != nil {
+		colors.PrintWarning("Failed to check driving events for %s: %v", gpsData.IMEI, err)
+	} else if event != nil {
+		colors.PrintWarning("⚠️ %s for %s: %d -> %d km/h in %.0fs", event.Type, event.IMEI,
+			event.StartSpeed, event.EndSpeed, event.Seconds)
+	}
+	GetLatestGPSCache().Record(gpsData)
+	return true, nil
+}
+
+// KeepGPSLocation decides whether a fix keeps its coordinates under the filter mode.
+// When it does not, reason explains why and the fix is stored as status only.
+func KeepGPSLocation(mode, ignition string, speed, movingSpeedKmh int) (bool, string) {
+	switch mode {
+	case config.GPSFilterModeAll:
+		return true, ""
+	case config.GPSFilterModeIgnitionOn:
+		if ignition == "OFF" {
+			return false, "Ignition is OFF"
+		}
+		return true, ""
+	default:
+		if ignition == "OFF" {
+			return false, "Ignition is OFF"
+		}
+		if !config.IsMovingSpeed(speed, movingSpeedKmh) {
+			return false, fmt.Sprintf("Speed (%d km/h) is below %d", speed, movingSpeedKmh)
+		}
+		return true, ""
+	}
+}
+
+// IsDeviceRegistered checks if a device with given IMEI exists in the database
+func IsDeviceRegistered(imei string) bool {
+	var device models.Device
+	err := db.GetDB().Where("imei = ?", imei).First(&device).Error
+	return err == nil
+}
+
+// LastLocatedGPS returns the most recent record with coordinates for a device
+func LastLocatedGPS(imei string) *models.GPSData {
+	var previous models.GPSData
+	err := db.GetDB().Where("imei = ? AND latitude IS NOT NULL AND longitude IS NOT NULL", imei).
+		Order("timestamp DESC").First(&previous).Error
+	if err != nil {
+		return nil
+	}
+	return &previous
+}
+
+// applySpeed records the speed chosen for a fix and where it came from
+func applySpeed(gpsData *models.GPSData, speed int, source string) {
+	if source == "" {
+		return
+	}
+	gpsData.Speed = &speed
+	gpsData.SpeedSource = source
+}
+
+// getVehicleType returns the vehicle type for a device, cached for a few minutes
+func (is *IngestionService) getVehicleType(imei string) string {
+	if imei == "" {
+		return ""
+	}
+
+	is.vehicleTypeMutex.Lock()
+	entry, exists := is.vehicleTypeCache.Get(imei)
+	is.vehicleTypeMutex.Unlock()
+	if exists && time.Now().Before(entry.expiresAt) {
+		return entry.vehicleType
+	}
+
+	vehicleType := is.store.VehicleType(imei)
+
+	is.vehicleTypeMutex.Lock()
+	is.vehicleTypeCache.Set(imei, vehicleTypeCacheEntry{
+		vehicleType: vehicleType,
+		expiresAt:   time.Now().Add(10 * time.Minute),
+	})
+	is.vehicleTypeMutex.Unlock()
+
+	return vehicleType
+}
+
+// vehicleTypeOf looks up the vehicle type of a device's vehicle
+func vehicleTypeOf(imei string) string {
+	var vehicle models.Vehicle
+	if err := db.GetDB().Select("vehicle_type").Where("imei = ?", imei).First(&vehicle).Error; err != nil {
+		return ""
+	}
+	return string(vehicle.VehicleType)
+}
+
+// hasEnoughSatellites checks a GPS fix against the configured satellite threshold
+func (is *IngestionService) hasEnoughSatellites(gpsData *models.GPSData) bool {
+	// Unpositioned fixes are only trusted with a stronger signal
+	required := is.minSatellites
+	positioned := gpsData.GPSPositioned == nil || *gpsData.GPSPositioned
+	if !positioned {
+		required++
+	}
+
+	if gpsData.Satellites == nil {
+		// Devices that do not report satellites are only rejected when they also report no fix
+		return positioned
+	}
+
+	return *gpsData.Satellites >= required
+}
+
+// isDuplicateCoordinates checks if the coordinates are duplicate (within larger threshold)
+func (is *IngestionService) isDuplicateCoordinates(imei string, lat, lng float64) bool {
+	// Get the latest GPS data for this device
+	latestGPS := is.store.LastLocatedGPS(imei)
+	if latestGPS == nil {
+		// No previous GPS data, not a duplicate
+		return false
+	}
+
+	// Calculate distance between current and latest coordinates
+	distance := utils.CalculateDistance(lat, lng, *latestGPS.Latitude, *latestGPS.Longitude)
+
+	// FIXED: Much more lenient duplicate threshold - only reject if distance is less than 1 meter
+	// This allows vehicles to be tracked even when parked or moving slowly
+	if distance < 0.001 { // 1 meter threshold
+		colors.PrintDebug("📍 Duplicate coordinates detected: Distance=%.6f km (threshold: 0.001 km)", distance)
+		return true
+	}
+
+	return false
+}
+
+// isGPSJump checks whether reaching the fix from the device's previous located fix would
+// need a speed above what its vehicle type can do (GPS_MAX_SPEED_*). Devices without a
+// vehicle are held to the fastest type.
+func (is *IngestionService) isGPSJump(imei string, lat, lng float64, timestamp time.Time) bool {
+	previous := is.store.LastLocatedGPS(imei)
+	if previous == nil {
+		return false
+	}
+
+	vehicleType := is.getVehicleType(imei)
+	maxSpeed, ok := is.maxSpeeds[vehicleType]
+	if !ok {
+		for _, typeMax := range is.maxSpeeds {
+			maxSpeed = max(maxSpeed, typeMax)
+		}
+	}
+
+	implied, jump := IsGPSJump(previous, lat, lng, timestamp, maxSpeed)
+	if jump {
+		colors.PrintWarning("🚫 GPS fix rejected [position_jump]: device=%s type=%s implied=%.0f km/h max=%d km/h",
+			imei, vehicleType, implied, maxSpeed)
+	}
+	return jump
+}
+
+// minGPSJumpKm is the shortest hop the jump filter rejects; position error alone can
+// explain shorter ones between fixes a second or two apart
+const minGPSJumpKm = 0.5
+
+// IsGPSJump reports whether moving from previous to lat/lng by timestamp implies a speed
+// above maxSpeedKmh, returning the implied speed. Unlike a flat distance limit, a long
+// stretch between sparse fixes is accepted while a short-lived teleport is not. Fixes
+// apart by under a second are treated as a second apart; maxSpeedKmh 0 accepts every fix.
+func IsGPSJump(previous *models.GPSData, lat, lng float64, timestamp time.Time, maxSpeedKmh int) (float64, bool) {
+	if maxSpeedKmh <= 0 || previous.Latitude == nil || previous.Longitude == nil {
+		return 0, false
+	}
+
+	distance := utils.CalculateDistance(*previous.Latitude, *previous.Longitude, lat, lng)
+	elapsed := timestamp.Sub(previous.Timestamp)
+	if elapsed < 0 {
+		elapsed = -elapsed // A buffered fix older than the previous one
+	}
+	elapsed = max(elapsed, time.Second)
+
+	implied := distance / elapsed.Hours()
+	return implied, distance >= minGPSJumpKm && implied > float64(maxSpeedKmh)
+}
+
+// smoothGPSCoordinates applies minimal smoothing to reduce noise without creating zigzag patterns
+func (is *IngestionService) smoothGPSCoordinates(imei string, lat, lng float64) (float64, float64) {
+	// Get the last GPS point for this device
+	previous := is.store.LastLocatedGPS(imei)
+	if previous == nil {
+		// Not enough data for smoothing, return original coordinates
+		return lat, lng
+	}
+
+	// FIXED: Much less aggressive smoothing to preserve route accuracy
+	prevLat := *previous.Latitude
+	prevLng := *previous.Longitude
+
+	// Apply minimal smoothing, by default 95% weight for new point and only 5% for previous
+	// This maintains route accuracy while reducing minor GPS noise
+	smoothedLat := utils.SmoothCoordinate(is.smoothingWeight, lat, prevLat)
+	smoothedLng := utils.SmoothCoordinate(is.smoothingWeight, lng, prevLng)
+
+	colors.PrintDebug("📍 GPS smoothing: Original(%.12f,%.12f) -> Smoothed(%.12f,%.12f)",
+		lat, lng, smoothedLat, smoothedLng)
+
+	return smoothedLat, smoothedLng
+}
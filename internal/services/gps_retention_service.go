@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/colors"
+	"sync"
+	"time"
+)
+
+// GPSRetentionService purges GPS rows older than the configured retention period.
+// It runs once a day at an off-peak hour and removes rows in small batches.
+type GPSRetentionService struct {
+	config   *config.RetentionConfig
+	archive  *ArchiveService
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// GPSPurgeResult reports what one purge run removed
+type GPSPurgeResult struct {
+	PositionCutoff time.Time `json:"position_cutoff"`
+	AlarmCutoff    time.Time `json:"alarm_cutoff"`
+	PositionRows   int64     `json:"position_rows"`
+	AlarmRows      int64     `json:"alarm_rows"`
+	ArchiveFiles   []string  `json:"archive_files,omitempty"`
+}
+
+// gpsPurgeArchiveFile is the top-level layout of a GPS purge archive file
+type gpsPurgeArchiveFile struct {
+	ArchivedAt time.Time        `json:"archived_at"`
+	Reason     string           `json:"reason"`
+	Cutoff     time.Time        `json:"cutoff"`
+	GPSData    []models.GPSData `json:"gps_data"`
+}
+
+// NewGPSRetentionService creates a retention service from the environment configuration
+func NewGPSRetentionService() *GPSRetentionService {
+	return NewGPSRetentionServiceWithConfig(config.GetRetentionConfig())
+}
+
+// NewGPSRetentionServiceWithConfig creates a retention service with explicit settings
+func NewGPSRetentionServiceWithConfig(cfg *config.RetentionConfig) *GPSRetentionService {
+	return &GPSRetentionService{
+		config:  cfg,
+		archive: NewArchiveService(),
+		quit:    make(chan struct{}),
+	}
+}
+
+// RetentionCutoffs returns the timestamps before which ordinary and alarm rows are purged
+func RetentionCutoffs(now time.Time, cfg *config.RetentionConfig) (positionCutoff, alarmCutoff time.Time) {
+	positionCutoff = now.AddDate(0, 0, -cfg.GPSRetentionDays)
+	alarmCutoff = now.AddDate(0, 0, -cfg.EffectiveAlarmRetentionDays())
+	return positionCutoff, alarmCutoff
+}
+
+// NextPurgeTime returns the next time after now that falls on the given local hour
+func NextPurgeTime(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Start runs the daily purge in the background until Stop is called.
+// It does nothing when GPS_RETENTION_DAYS is not set.
+func (rs *GPSRetentionService) Start() {
+	if !rs.config.IsEnabled() {
+		colors.PrintInfo("GPS retention purge disabled (GPS_RETENTION_DAYS not set)")
+		return
+	}
+
+	colors.PrintInfo("🧹 GPS retention purge scheduled daily at %02d:00 (keep %d days, alarms %d days, mode %s)",
+		rs.config.Hour, rs.config.GPSRetentionDays, rs.config.EffectiveAlarmRetentionDays(), rs.config.Mode)
+
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(NextPurgeTime(time.Now(), rs.config.Hour)))
+			select {
+			case <-timer.C:
+				if _, err := rs.PurgeOnce(time.Now()); err != nil {
+					colors.PrintError("GPS retention purge failed: %v", err)
+				}
+			case <-rs.quit:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background purge loop. A batch in progress finishes first.
+func (rs *GPSRetentionService) Stop() {
+	rs.stopOnce.Do(func() {
+		close(rs.quit)
+	})
+}
+
+// PurgeOnce removes every row past its retention period as of now and logs the counts
+func (rs *GPSRetentionService) PurgeOnce(now time.Time) (*GPSPurgeResult, error) {
+	if !rs.config.IsEnabled() {
+		return &GPSPurgeResult{}, nil
+	}
+
+	positionCutoff, alarmCutoff := RetentionCutoffs(now, rs.config)
+	result := &GPSPurgeResult{
+		PositionCutoff: positionCutoff,
+		AlarmCutoff:    alarmCutoff,
+	}
+
+	// A device whose newest rows were purged must not keep serving them from the cache
+	defer func() {
+		if result.PositionRows+result.AlarmRows > 0 {
+			GetLatestGPSCache().Clear()
+		}
+	}()
+
+	started := time.Now()
+	colors.PrintInfo("🧹 Purging GPS data before %s (alarms before %s)",
+		config.FormatTimestamp(positionCutoff), config.FormatTimestamp(alarmCutoff))
+
+	// Rows without an active alarm
+	purged, files, err := rs.purgeBatches("(alarm_active IS NULL OR alarm_active = false)", positionCutoff)
+	result.PositionRows = purged
+	result.ArchiveFiles = append(result.ArchiveFiles, files...)
+	if err != nil {
+		return result, err
+	}
+
+	// Alarm rows, which may be kept longer
+	purged, files, err = rs.purgeBatches("alarm_active = true", alarmCutoff)
+	result.AlarmRows = purged
+	result.ArchiveFiles = append(result.ArchiveFiles, files...)
+	if err != nil {
+		return result, err
+	}
+
+	colors.PrintSuccess("🧹 GPS retention purge removed %d position rows and %d alarm rows in %v",
+		result.PositionRows, result.AlarmRows, time.Since(started).Round(time.Millisecond))
+	return result, nil
+}
+
+// purgeBatches removes rows matching the condition with a timestamp before cutoff,
+// one batch per statement, archiving each batch first in archive mode
+func (rs *GPSRetentionService) purgeBatches(condition string, cutoff time.Time) (int64, []string, error) {
+	var total int64
+	var files []string
+
+	for batch := 1; ; batch++ {
+		select {
+		case <-rs.quit:
+			return total, files, nil
+		default:
+		}
+
+		var removed int64
+		if rs.config.Mode == config.GPSCleanupArchive {
+			var rows []models.GPSData
+			if err := db.GetDB().Where(condition).Where("timestamp < ?", cutoff).
+				Order("id ASC").Limit(rs.config.BatchSize).Find(&rows).Error; err != nil {
+				return total, files, fmt.Errorf("failed to load GPS rows to archive: %v", err)
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			name := fmt.Sprintf("gps-purge-%s-%d.json", time.Now().Format("20060102-150405.000"), batch)
+			path, err := rs.archive.writeJSON(name, gpsPurgeArchiveFile{
+				ArchivedAt: time.Now(),
+				Reason:     "retention",
+				Cutoff:     cutoff,
+				GPSData:    rows,
+			})
+			if err != nil {
+				return total, files, err
+			}
+			files = append(files, path)
+
+			ids := make([]uint, len(rows))
+			for i, row := range rows {
+				ids[i] = row.ID
+			}
+			result := db.GetDB().Where("id IN ?", ids).Delete(&models.GPSData{})
+			if result.Error != nil {
+				return total, files, fmt.Errorf("failed to delete archived GPS rows: %v", result.Error)
+			}
+			removed = result.RowsAffected
+		} else {
+			result := db.GetDB().Exec(
+				"DELETE FROM gps_data WHERE id IN (SELECT id FROM gps_data WHERE "+condition+" AND timestamp < ? LIMIT ?)",
+				cutoff, rs.config.BatchSize,
+			)
+			if result.Error != nil {
+				return total, files, fmt.Errorf("failed to delete GPS rows: %v", result.Error)
+			}
+			removed = result.RowsAffected
+		}
+
+		total += removed
+		if removed < int64(rs.config.BatchSize) {
+			break
+		}
+		time.Sleep(rs.config.BatchPause)
+	}
+
+	return total, files, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/utils"
+	"math"
+	"sort"
+	"time"
+)
+
+// Heatmap grid sizes in meters: the default and the range a request may choose from
+const (
+	DefaultHeatmapCellMeters = 200.0
+	MinHeatmapCellMeters     = 10.0
+	MaxHeatmapCellMeters     = 10000.0
+)
+
+// How heatmap cells are weighted
+const (
+	HeatmapWeightPoints = "points" // Number of fixes in the cell
+	HeatmapWeightTime   = "time"   // Seconds spent in the cell
+)
+
+// HeatmapMaxGap caps the time credited between two fixes, so a device that goes silent
+// does not pile hours onto the cell it was last seen in
+const HeatmapMaxGap = 15 * time.Minute
+
+// IsValidHeatmapWeight reports whether weight is one of the heatmap weightings
+func IsValidHeatmapWeight(weight string) bool {
+	return weight == HeatmapWeightPoints || weight == HeatmapWeightTime
+}
+
+// HeatmapCell is one grid cell a vehicle visited, placed at the centroid of its fixes
+type HeatmapCell struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Weight    float64 `json:"weight"`
+	Points    int     `json:"points"`
+}
+
+type heatmapKey struct {
+	row, column int64
+}
+
+type heatmapAccumulator struct {
+	latitudeSum, longitudeSum float64
+	points                    int
+	seconds                   float64
+}
+
+// BuildHeatmap buckets fixes ordered by time into a grid of roughly cellMeters square cells
+// and returns the visited cells, heaviest first. Cell sizes in degrees come from Haversine
+// distances at the first fix, which keeps cells square across the area of one vehicle's
+// movements. Fixes without coordinates, such as status-only rows, are not counted as points,
+// but for time weighting they keep crediting the last known position, so parked time counts.
+// Each fix is credited the time until the next one, capped at maxGap.
+func BuildHeatmap(fixes []models.GPSData, cellMeters float64, weight string, maxGap time.Duration) []HeatmapCell {
+	var origin *models.GPSData
+	for i := range fixes {
+		if fixes[i].Latitude != nil && fixes[i].Longitude != nil {
+			origin = &fixes[i]
+			break
+		}
+	}
+	if origin == nil || cellMeters <= 0 {
+		return []HeatmapCell{}
+	}
+
+	latitudeStep := cellMeters / (utils.CalculateDistance(*origin.Latitude, *origin.Longitude, *origin.Latitude+1, *origin.Longitude) * 1000)
+	longitudeStep := cellMeters / (utils.CalculateDistance(*origin.Latitude, *origin.Longitude, *origin.Latitude, *origin.Longitude+1) * 1000)
+
+	cells := make(map[heatmapKey]*heatmapAccumulator)
+	var current *heatmapAccumulator // Cell of the last known position
+	for i := range fixes {
+		fix := &fixes[i]
+		if fix.Latitude != nil && fix.Longitude != nil {
+			key := heatmapKey{
+				row:    int64(math.Floor(*fix.Latitude / latitudeStep)),
+				column: int64(math.Floor(*fix.Longitude / longitudeStep)),
+			}
+			if cells[key] == nil {
+				cells[key] = &heatmapAccumulator{}
+			}
+			current = cells[key]
+			current.latitudeSum += *fix.Latitude
+			current.longitudeSum += *fix.Longitude
+			current.points++
+		}
+
+		if current != nil && i+1 < len(fixes) {
+			gap := fixes[i+1].Timestamp.Sub(fix.Timestamp)
+			if gap > maxGap {
+				gap = maxGap
+			}
+			if gap > 0 {
+				current.seconds += gap.Seconds()
+			}
+		}
+	}
+
+	heatmap := make([]HeatmapCell, 0, len(cells))
+	for _, cell := range cells {
+		entry := HeatmapCell{
+			Latitude:  cell.latitudeSum / float64(cell.points),
+			Longitude: cell.longitudeSum / float64(cell.points),
+			Weight:    float64(cell.points),
+			Points:    cell.points,
+		}
+		if weight == HeatmapWeightTime {
+			entry.Weight = cell.seconds
+		}
+		heatmap = append(heatmap, entry)
+	}
+
+	sort.Slice(heatmap, func(i, j int) bool {
+		if heatmap[i].Weight != heatmap[j].Weight {
+			return heatmap[i].Weight > heatmap[j].Weight
+		}
+		if heatmap[i].Latitude != heatmap[j].Latitude {
+			return heatmap[i].Latitude < heatmap[j].Latitude
+		}
+		return heatmap[i].Longitude < heatmap[j].Longitude
+	})
+	return heatmap
+}
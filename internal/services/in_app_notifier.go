@@ -0,0 +1,64 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// InAppNotification is the payload delivered to a user's open app and dashboard sessions
+type InAppNotification struct {
+	NotificationID uint                   `json:"notification_id,omitempty"` // Stored notification, if any
+	Type           string                 `json:"type"`
+	Title          string                 `json:"title"`
+	Body           string                 `json:"body"`
+	ImageURL       string                 `json:"image_url,omitempty"`
+	Data           map[string]interface{} `json:"data,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+// InAppNotifier delivers a notification to the connected clients of one user
+type InAppNotifier func(userID uint, notification *InAppNotification)
+
+var (
+	inAppNotifier      InAppNotifier
+	inAppNotifierMutex sync.RWMutex
+)
+
+// SetInAppNotifier registers the real-time channel (the WebSocket hub) used for in-app delivery.
+// Services cannot import the HTTP layer, so the hub registers itself here on startup.
+func SetInAppNotifier(notifier InAppNotifier) {
+	inAppNotifierMutex.Lock()
+	defer inAppNotifierMutex.Unlock()
+	inAppNotifier = notifier
+}
+
+// NotifyInApp sends the notification to every connected client of the given users.
+// It is a no-op until a notifier is registered.
+func NotifyInApp(userIDs []uint, notification *InAppNotification) {
+	inAppNotifierMutex.RLock()
+	notifier := inAppNotifier
+	inAppNotifierMutex.RUnlock()
+
+	if notifier == nil {
+		return
+	}
+
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+	for _, userID := range userIDs {
+		notifier(userID, notification)
+	}
+}
+
+// inAppNotificationFrom builds the in-app payload for a push notification
+func inAppNotificationFrom(notification *NotificationData) *InAppNotification {
+	return &InAppNotification{
+		NotificationID: notification.NotificationID,
+		Type:           notification.Type,
+		Title:          notification.Title,
+		Body:           notification.Body,
+		ImageURL:       notification.ImageURL,
+		Data:           notification.Data,
+	}
+}
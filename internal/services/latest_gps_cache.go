@@ -0,0 +1,236 @@
+package services
+
+import (
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/lru"
+	"sync"
+)
+
+// LatestGPSCache keeps each vehicle's newest GPS row and newest row with a valid fix in
+// memory, so live maps do not query gps_data on every refresh. Entries are loaded from the
+// database on a miss and kept current by Record as rows are saved; the least recently used
+// vehicles are evicted beyond the capacity.
+type LatestGPSCache struct {
+	mutex   sync.Mutex
+	entries *lru.Cache[string, latestGPSEntry]
+	// Devices being loaded from the database, with the rows recorded while they load so
+	// a load that read before a save cannot cache an older row
+	loading map[string]int
+	pending map[string]latestGPSEntry
+	hits    uint64
+	misses  uint64
+}
+
+// latestGPSEntry holds copies, so callers cannot change what other readers see
+type latestGPSEntry struct {
+	status   *models.GPSData // Newest row of any kind; nil when the device never reported
+	location *models.GPSData // Newest row with a valid fix; nil when none is known
+}
+
+// LatestGPSCacheStats describes the cache for monitoring
+type LatestGPSCacheStats struct {
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// NewLatestGPSCache creates an empty cache holding at most capacity vehicles
+func NewLatestGPSCache(capacity int) *LatestGPSCache {
+	return &LatestGPSCache{
+		entries: lru.New[string, latestGPSEntry](capacity),
+		loading: make(map[string]int),
+		pending: make(map[string]latestGPSEntry),
+	}
+}
+
+var (
+	latestGPSCache     *LatestGPSCache
+	latestGPSCacheOnce sync.Once
+)
+
+// GetLatestGPSCache returns the shared cache, sized like the other per-device state
+// (DEVICE_STATE_CAPACITY)
+func GetLatestGPSCache() *LatestGPSCache {
+	latestGPSCacheOnce.Do(func() {
+		latestGPSCache = NewLatestGPSCache(config.GetTCPConfig().DeviceStateCapacity)
+	})
+	return latestGPSCache
+}
+
+// Latest returns the device's newest row and newest row with a valid fix, either of which
+// may be nil, reading the database only when the device is not cached
+func (c *LatestGPSCache) Latest(imei string) (status, location *models.GPSData, err error) {
+	statuses, locations, err := c.LatestMany([]string{imei})
+	if err != nil {
+		return nil, nil, err
+	}
+	return statuses[imei], locations[imei], nil
+}
+
+// LatestMany is Latest for several devices. The devices that are not cached are loaded
+// together with one query for their newest rows and one for their newest fixes. Devices
+// without rows have no entry in the maps.
+func (c *LatestGPSCache) LatestMany(imeis []string) (statuses, locations map[string]*models.GPSData, err error) {
+	statuses = make(map[string]*models.GPSData, len(imeis))
+	locations = make(map[string]*models.GPSData, len(imeis))
+
+	var missing []string
+	c.mutex.Lock()
+	for _, imei := range imeis {
+		entry, cached := c.entries.Get(imei)
+		if !cached {
+			missing = append(missing, imei)
+			c.loading[imei]++
+			c.misses++
+			continue
+		}
+		c.hits++
+		addLatest(statuses, locations, imei, entry)
+	}
+	c.mutex.Unlock()
+
+	if len(missing) == 0 {
+		return statuses, locations, nil
+	}
+
+	loaded, err := loadLatestGPS(missing)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, imei := range missing {
+		// Rows saved while the load ran, or cached by a concurrent load, may be newer
+		entry := loaded[imei]
+		if saved, exists := c.pending[imei]; exists {
+			entry = mergeLatest(entry, saved)
+		}
+		if current, cached := c.entries.Peek(imei); cached {
+			entry = mergeLatest(entry, current)
+		}
+
+		if c.loading[imei]--; c.loading[imei] == 0 {
+			delete(c.loading, imei)
+			delete(c.pending, imei)
+		}
+		if err != nil {
+			continue
+		}
+		c.entries.Set(imei, entry)
+		addLatest(statuses, locations, imei, entry)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return statuses, locations, nil
+}
+
+// Record applies a row that was just saved, keeping the newer of it and the cached rows.
+// Devices that are not cached are left to be loaded on their next read, since a replayed
+// old frame must not become their latest row.
+func (c *LatestGPSCache) Record(gpsData *models.GPSData) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	saved := latestGPSEntry{status: new(models.GPSData)}
+	*saved.status = *gpsData
+	if HasValidFix(saved.status) {
+		saved.location = saved.status
+	}
+
+	if c.loading[gpsData.IMEI] > 0 {
+		c.pending[gpsData.IMEI] = mergeLatest(c.pending[gpsData.IMEI], saved)
+	}
+	if entry, cached := c.entries.Peek(gpsData.IMEI); cached {
+		c.entries.Set(gpsData.IMEI, mergeLatest(entry, saved))
+	}
+}
+
+// Invalidate drops a device, e.g. after some of its rows were deleted
+func (c *LatestGPSCache) Invalidate(imei string) {
+	c.mutex.Lock()
+	c.entries.Delete(imei)
+	c.mutex.Unlock()
+}
+
+// Clear drops every device, e.g. after a purge that may have removed any device's rows
+func (c *LatestGPSCache) Clear() {
+	c.mutex.Lock()
+	c.entries.RemoveFunc(func(string, latestGPSEntry) bool { return true })
+	c.mutex.Unlock()
+}
+
+// Stats returns the number of cached devices and the hit and miss counts
+func (c *LatestGPSCache) Stats() LatestGPSCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return LatestGPSCacheStats{Entries: c.entries.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+// addLatest copies an entry's rows into the result maps
+func addLatest(statuses, locations map[string]*models.GPSData, imei string, entry latestGPSEntry) {
+	if entry.status != nil {
+		status := *entry.status
+		statuses[imei] = &status
+	}
+	if entry.location != nil {
+		location := *entry.location
+		locations[imei] = &location
+	}
+}
+
+// mergeLatest keeps the newer status and location of two entries
+func mergeLatest(a, b latestGPSEntry) latestGPSEntry {
+	return latestGPSEntry{status: newerGPS(a.status, b.status), location: newerGPS(a.location, b.location)}
+}
+
+// newerGPS returns the later of two rows by timestamp, preferring candidate on a tie
+func newerGPS(current, candidate *models.GPSData) *models.GPSData {
+	if candidate == nil {
+		return current
+	}
+	if current == nil || !candidate.Timestamp.Before(current.Timestamp) {
+		return candidate
+	}
+	return current
+}
+
+// loadLatestGPS reads the newest row and the newest row with a valid fix of each device
+func loadLatestGPS(imeis []string) (map[string]latestGPSEntry, error) {
+	var statusRows []models.GPSData
+	if err := db.GetReadDB().Raw(`
+		SELECT DISTINCT ON (imei) *
+		FROM gps_data
+		WHERE imei IN ?
+		ORDER BY imei, timestamp DESC, id DESC
+	`, imeis).Scan(&statusRows).Error; err != nil {
+		return nil, err
+	}
+
+	var locationRows []models.GPSData
+	if err := db.GetReadDB().Raw(`
+		SELECT DISTINCT ON (imei) *
+		FROM gps_data
+		WHERE imei IN ?
+		AND latitude IS NOT NULL AND longitude IS NOT NULL
+		AND latitude != 0 AND longitude != 0
+		AND latitude BETWEEN -90 AND 90 AND longitude BETWEEN -180 AND 180
+		ORDER BY imei, timestamp DESC, id DESC
+	`, imeis).Scan(&locationRows).Error; err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]latestGPSEntry, len(imeis))
+	for i := range statusRows {
+		entry := entries[statusRows[i].IMEI]
+		entry.status = &statusRows[i]
+		entries[statusRows[i].IMEI] = entry
+	}
+	for i := range locationRows {
+		entry := entries[locationRows[i].IMEI]
+		entry.location = &locationRows[i]
+		entries[locationRows[i].IMEI] = entry
+	}
+	return entries, nil
+}
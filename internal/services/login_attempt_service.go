@@ -0,0 +1,166 @@
+package services
+
+import (
+	"luna_iot_server/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loginFailureState tracks failed logins for one phone number or IP address
+type loginFailureState struct {
+	failures    int       // Failures since the last lockout
+	lockouts    int       // Consecutive lockouts, drives the backoff
+	lockedUntil time.Time // Zero when not locked
+	lastFailure time.Time
+}
+
+// loginRequestWindow counts login requests from one IP in a fixed one-minute window
+type loginRequestWindow struct {
+	start time.Time
+	count int
+}
+
+// LoginAttemptTracker rate limits login requests and locks out phone numbers and IPs
+// after repeated failures. Lockouts double on each consecutive lockout until no
+// failure has been seen for the failure window. State is kept in memory only.
+type LoginAttemptTracker struct {
+	mutex     sync.Mutex
+	limits    config.LoginLimits
+	failures  map[string]*loginFailureState
+	requests  map[string]*loginRequestWindow
+	lastPrune time.Time
+}
+
+var (
+	loginAttemptTracker     *LoginAttemptTracker
+	loginAttemptTrackerOnce sync.Once
+)
+
+// GetLoginAttemptTracker returns the shared tracker configured from the environment
+func GetLoginAttemptTracker() *LoginAttemptTracker {
+	loginAttemptTrackerOnce.Do(func() {
+		loginAttemptTracker = NewLoginAttemptTracker(config.GetAuthConfig().LoginLimits)
+	})
+	return loginAttemptTracker
+}
+
+// NewLoginAttemptTracker creates a tracker with the given limits
+func NewLoginAttemptTracker(limits config.LoginLimits) *LoginAttemptTracker {
+	return &LoginAttemptTracker{
+		limits:    limits,
+		failures:  make(map[string]*loginFailureState),
+		requests:  make(map[string]*loginRequestWindow),
+		lastPrune: time.Now(),
+	}
+}
+
+func identifierKey(identifier string) string {
+	return "id:" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Allow registers a login request and reports whether it may proceed.
+// When it may not, the returned duration is how long the client should wait.
+func (t *LoginAttemptTracker) Allow(ip, identifier string) (time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	t.pruneLocked(now)
+
+	var retryAfter time.Duration
+	for _, key := range []string{identifierKey(identifier), ipKey(ip)} {
+		if state, exists := t.failures[key]; exists && now.Before(state.lockedUntil) {
+			if wait := state.lockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	if t.limits.MaxRequestsPerMinute > 0 {
+		window, exists := t.requests[ip]
+		if !exists || now.Sub(window.start) >= time.Minute {
+			window = &loginRequestWindow{start: now}
+			t.requests[ip] = window
+		}
+		window.count++
+		if window.count > t.limits.MaxRequestsPerMinute {
+			if wait := window.start.Add(time.Minute).Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	return retryAfter, retryAfter == 0
+}
+
+// RecordFailure counts a failed login against both the phone number and the IP
+func (t *LoginAttemptTracker) RecordFailure(ip, identifier string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	t.recordFailureLocked(identifierKey(identifier), t.limits.MaxFailuresPerIdentifier, now)
+	t.recordFailureLocked(ipKey(ip), t.limits.MaxFailuresPerIP, now)
+}
+
+// RecordSuccess clears the failure history of the phone number after a successful login.
+// The IP history is kept so one valid account cannot be used to reset it.
+func (t *LoginAttemptTracker) RecordSuccess(identifier string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.failures, identifierKey(identifier))
+}
+
+func (t *LoginAttemptTracker) recordFailureLocked(key string, maxFailures int, now time.Time) {
+	state, exists := t.failures[key]
+	if !exists || now.Sub(state.lastFailure) > t.limits.FailureWindow {
+		state = &loginFailureState{}
+		t.failures[key] = state
+	}
+
+	state.failures++
+	state.lastFailure = now
+
+	if state.failures >= maxFailures {
+		state.lockouts++
+		state.failures = 0
+		state.lockedUntil = now.Add(t.lockoutDuration(state.lockouts))
+	}
+}
+
+// lockoutDuration doubles the base lockout for each consecutive lockout, up to the maximum
+func (t *LoginAttemptTracker) lockoutDuration(lockouts int) time.Duration {
+	duration := t.limits.LockoutBase
+	for i := 1; i < lockouts && duration < t.limits.LockoutMax; i++ {
+		duration *= 2
+	}
+	if duration > t.limits.LockoutMax {
+		duration = t.limits.LockoutMax
+	}
+	return duration
+}
+
+// pruneLocked drops entries that no longer affect any decision, at most once per minute
+func (t *LoginAttemptTracker) pruneLocked(now time.Time) {
+	if now.Sub(t.lastPrune) < time.Minute {
+		return
+	}
+	t.lastPrune = now
+
+	for key, state := range t.failures {
+		if now.After(state.lockedUntil) && now.Sub(state.lastFailure) > t.limits.FailureWindow {
+			delete(t.failures, key)
+		}
+	}
+	for ip, window := range t.requests {
+		if now.Sub(window.start) >= time.Minute {
+			delete(t.requests, ip)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/colors"
+	"sync"
+	"time"
+)
+
+// maintenanceCheckInterval is how often maintenance schedules are compared with vehicle usage
+const maintenanceCheckInterval = time.Hour
+
+// MaintenanceStatus is a schedule's progress towards its next service
+type MaintenanceStatus struct {
+	KmSinceService          float64  `json:"km_since_service"`
+	EngineHoursSinceService float64  `json:"engine_hours_since_service"`
+	KmRemaining             *float64 `json:"km_remaining"`           // nil when the schedule has no km interval
+	EngineHoursRemaining    *float64 `json:"engine_hours_remaining"` // nil when the schedule has no engine-hours interval
+	IsDue                   bool     `json:"is_due"`
+}
+
+// DistanceSince sums the distance a device has travelled after the given time, in km
+func DistanceSince(imei string, since time.Time) float64 {
+	var distance float64
+	db.GetDB().Model(&models.GPSData{}).
+		Where("imei = ? AND timestamp > ? AND distance_from_prev IS NOT NULL", imei, since).
+		Select("COALESCE(SUM(distance_from_prev), 0)").
+		Scan(&distance)
+	return distance
+}
+
+// EvaluateMaintenance compares usage since the last service with the schedule's intervals.
+// The service is due once either interval is reached.
+func EvaluateMaintenance(schedule *models.MaintenanceSchedule, kmSinceService, engineHours float64) MaintenanceStatus {
+	status := MaintenanceStatus{
+		KmSinceService:          kmSinceService,
+		EngineHoursSinceService: engineHours - schedule.BaselineEngineHours,
+	}
+	if status.EngineHoursSinceService < 0 {
+		// Engine hours were calibrated below the baseline
+		status.EngineHoursSinceService = 0
+	}
+
+	if schedule.IntervalKm > 0 {
+		remaining := schedule.IntervalKm - status.KmSinceService
+		status.KmRemaining = &remaining
+		if remaining <= 0 {
+			status.IsDue = true
+		}
+	}
+	if schedule.IntervalEngineHours > 0 {
+		remaining := schedule.IntervalEngineHours - status.EngineHoursSinceService
+		status.EngineHoursRemaining = &remaining
+		if remaining <= 0 {
+			status.IsDue = true
+		}
+	}
+	return status
+}
+
+// GetMaintenanceStatus evaluates a schedule against the vehicle's current usage
+func GetMaintenanceStatus(schedule *models.MaintenanceSchedule, vehicle *models.Vehicle) MaintenanceStatus {
+	return EvaluateMaintenance(schedule, DistanceSince(vehicle.IMEI, schedule.BaselineAt), vehicle.EngineHours)
+}
+
+// MarkMaintenanceServiced restarts the schedule from the vehicle's current usage
+// and re-arms its reminder
+func MarkMaintenanceServiced(schedule *models.MaintenanceSchedule, vehicle *models.Vehicle, servicedAt time.Time) error {
+	schedule.BaselineAt = servicedAt
+	schedule.BaselineEngineHours = vehicle.EngineHours
+	schedule.LastServicedAt = &servicedAt
+	schedule.NotifiedAt = nil
+
+	return db.GetDB().Model(schedule).Updates(map[string]interface{}{
+		"baseline_at":           schedule.BaselineAt,
+		"baseline_engine_hours": schedule.BaselineEngineHours,
+		"last_serviced_at":      schedule.LastServicedAt,
+		"notified_at":           nil,
+	}).Error
+}
+
+// MaintenanceReminderService periodically notifies vehicle users of services that are due.
+// Each schedule is notified once per service interval.
+type MaintenanceReminderService struct {
+	notifier *VehicleNotificationService
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMaintenanceReminderService creates a new maintenance reminder service
+func NewMaintenanceReminderService() *MaintenanceReminderService {
+	return &MaintenanceReminderService{
+		notifier: NewVehicleNotificationService(),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start runs the reminder check in the background until Stop is called
+func (mrs *MaintenanceReminderService) Start() {
+	colors.PrintInfo("🔧 Maintenance reminders checked every %v", maintenanceCheckInterval)
+
+	go func() {
+		ticker := time.NewTicker(maintenanceCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := mrs.CheckOnce(); err != nil {
+					colors.PrintError("Maintenance reminder check failed: %v", err)
+				}
+			case <-mrs.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background reminder loop
+func (mrs *MaintenanceReminderService) Stop() {
+	mrs.stopOnce.Do(func() {
+		close(mrs.quit)
+	})
+}
+
+// CheckOnce notifies every active schedule that has become due, returning how many were notified
+func (mrs *MaintenanceReminderService) CheckOnce() (int, error) {
+	var schedules []models.MaintenanceSchedule
+	if err := db.GetDB().Preload("Vehicle").
+		Where("is_active = ? AND notified_at IS NULL", true).
+		Find(&schedules).Error; err != nil {
+		return 0, err
+	}
+
+	notified := 0
+	for i := range schedules {
+		schedule := &schedules[i]
+		status := GetMaintenanceStatus(schedule, &schedule.Vehicle)
+		if !status.IsDue {
+			continue
+		}
+
+		if err := mrs.notifier.SendMaintenanceReminder(&schedule.Vehicle, schedule, status); err != nil {
+			colors.PrintWarning("Failed to send maintenance reminder %d for %s: %v", schedule.ID, schedule.VehicleID, err)
+			continue
+		}
+
+		now := time.Now()
+		if err := db.GetDB().Model(schedule).Update("notified_at", now).Error; err != nil {
+			colors.PrintWarning("Failed to mark maintenance reminder %d as sent: %v", schedule.ID, err)
+			continue
+		}
+		notified++
+	}
+
+	if notified > 0 {
+		colors.PrintSuccess("🔧 Sent %d maintenance reminders", notified)
+	}
+	return notified, nil
+}
@@ -455,3 +455,101 @@ func (nds *NotificationDBService) DeleteNotification(notificationID uint) error
 	colors.PrintSuccess("Notification deleted successfully: %d", notificationID)
 	return nil
 }
+
+// ErrUserNotificationNotFound is returned when the notification was not sent to the user
+var ErrUserNotificationNotFound = errors.New("notification not found for user")
+
+// UserNotification is a notification as it appears in a recipient's inbox
+type UserNotification struct {
+	ID         uint                   `json:"id"`
+	Title      string                 `json:"title"`
+	Body       string                 `json:"body"`
+	Type       string                 `json:"type"`
+	ImageURL   string                 `json:"image_url"`
+	ImageData  string                 `json:"image_data"`
+	Priority   string                 `json:"priority"`
+	Data       map[string]interface{} `json:"data" gorm:"-"`
+	RawData    string                 `json:"-" gorm:"column:data"`
+	IsRead     bool                   `json:"is_read"`
+	ReadAt     *time.Time             `json:"read_at"`
+	ReceivedAt time.Time              `json:"received_at"`
+}
+
+// userNotificationsQuery selects the sent notifications of a user, optionally filtered by read state
+func userNotificationsQuery(database *gorm.DB, userID uint, isRead *bool) *gorm.DB {
+	query := database.Table("notification_users AS nu").
+		Joins("JOIN notifications AS n ON n.id = nu.notification_id").
+		Where("nu.user_id = ? AND nu.is_sent = ?", userID, true)
+	if isRead != nil {
+		query = query.Where("nu.is_read = ?", *isRead)
+	}
+	return query
+}
+
+// GetUserNotifications returns a page of the notifications sent to the user, newest first.
+// Pass isRead to only return read or unread notifications.
+func (nds *NotificationDBService) GetUserNotifications(userID uint, isRead *bool, page, limit int) ([]UserNotification, int64, error) {
+	database := db.GetDB()
+
+	var total int64
+	if err := userNotificationsQuery(database, userID, isRead).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	notifications := []UserNotification{}
+	if err := userNotificationsQuery(database, userID, isRead).
+		Select("n.id, n.title, n.body, n.type, n.image_url, n.image_data, n.priority, n.data, " +
+			"nu.is_read, nu.read_at, COALESCE(nu.sent_at, nu.created_at) AS received_at").
+		Order("received_at DESC, n.id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Scan(&notifications).Error; err != nil {
+		return nil, 0, err
+	}
+
+	for i := range notifications {
+		notification := models.Notification{Data: notifications[i].RawData}
+		notifications[i].Data = notification.GetDataMap()
+	}
+
+	return notifications, total, nil
+}
+
+// CountUnreadNotifications returns how many sent notifications the user has not read
+func (nds *NotificationDBService) CountUnreadNotifications(userID uint) (int64, error) {
+	unread := false
+	var count int64
+	err := userNotificationsQuery(db.GetDB(), userID, &unread).Count(&count).Error
+	return count, err
+}
+
+// MarkUserNotificationAsRead marks a notification read for the user.
+// Marking an already read notification again keeps the original read time.
+func (nds *NotificationDBService) MarkUserNotificationAsRead(userID, notificationID uint) error {
+	database := db.GetDB()
+
+	result := database.Model(&models.NotificationUser{}).
+		Where("user_id = ? AND notification_id = ? AND is_sent = ? AND is_read = ?", userID, notificationID, true, false).
+		Updates(map[string]interface{}{
+			"is_read": true,
+			"read_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing updated: either already read or not one of the user's notifications
+	var count int64
+	if err := database.Model(&models.NotificationUser{}).
+		Where("user_id = ? AND notification_id = ? AND is_sent = ?", userID, notificationID, true).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserNotificationNotFound
+	}
+	return nil
+}
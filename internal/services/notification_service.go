@@ -24,12 +24,91 @@ type NotificationData struct {
 	Sound       string                 `json:"sound,omitempty"`
 	Priority    string                 `json:"priority,omitempty"`
 	CollapseKey string                 `json:"collapse_key,omitempty"`
+
+	// NotificationID links the send to a stored notification, if any
+	NotificationID uint `json:"-"`
 }
 
 type NotificationServiceResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Error   string `json:"error,omitempty"`
+
+	// Deliveries holds the per-recipient outcome of a multi-user send
+	Deliveries map[uint]DeliveryResult `json:"-"`
+}
+
+// DeliveryResult is the push outcome for one recipient across all of their devices
+type DeliveryResult struct {
+	Status        string // One of the models.DeliveryStatus* values
+	Error         string
+	DevicesSent   int
+	DevicesFailed int
+}
+
+// ResolveDeliveries maps a push response back to each recipient using the
+// per-token details. Without details, the overall result applies to every token.
+func ResolveDeliveries(userIDs []uint, tokensByUser map[uint][]string, response *RavipangaliResponse, sendErr error) map[uint]DeliveryResult {
+	tokenOK := make(map[string]bool)
+	tokenReason := make(map[string]string)
+	if response != nil {
+		for _, detail := range response.Details {
+			tokenOK[detail.Token] = detail.Success
+			if !detail.Success {
+				tokenReason[detail.Token] = describeDetailResponse(detail.Response)
+			}
+		}
+	}
+
+	results := make(map[uint]DeliveryResult, len(userIDs))
+	for _, userID := range userIDs {
+		tokens := tokensByUser[userID]
+		if len(tokens) == 0 {
+			results[userID] = DeliveryResult{Status: models.DeliveryStatusNoToken}
+			continue
+		}
+
+		result := DeliveryResult{DevicesSent: len(tokens)}
+		delivered := 0
+		for _, token := range tokens {
+			ok, reported := tokenOK[token]
+			switch {
+			case sendErr != nil || response == nil:
+				ok = false
+			case !reported:
+				ok = response.Success
+			}
+
+			if ok {
+				delivered++
+				continue
+			}
+
+			result.DevicesFailed++
+			if result.Error == "" {
+				result.Error = tokenReason[token]
+			}
+		}
+
+		if delivered > 0 {
+			result.Status = models.DeliveryStatusDelivered
+		} else {
+			result.Status = models.DeliveryStatusFailed
+			if result.Error == "" {
+				switch {
+				case sendErr != nil:
+					result.Error = sendErr.Error()
+				case response != nil && response.Error != "":
+					result.Error = response.Error
+				default:
+					result.Error = "delivery failed"
+				}
+			}
+		}
+		results[userID] = result
+	}
+
+	return results
 }
 
 func NewNotificationService() *NotificationService {
@@ -51,31 +130,35 @@ func (ns *NotificationService) SendToUser(userID uint, notification *Notificatio
 		}, err
 	}
 
-	// Check if user has FCM token
-	if user.FCMToken == "" {
-		colors.PrintWarning("User %d (%s) has no FCM token", userID, user.Name)
+	// Deliver to open app and dashboard sessions even when the user has no push token
+	NotifyInApp([]uint{userID}, inAppNotificationFrom(notification))
+
+	// Collect every active device token for the user, including the legacy column
+	tokensByUser, err := GetUsersFCMTokens([]uint{userID})
+	if err != nil {
+		colors.PrintError("Failed to load FCM tokens for user %d: %v", userID, err)
 		return &NotificationServiceResponse{
 			Success: false,
-			Message: "User has no FCM token",
-		}, fmt.Errorf("user has no FCM token")
+			Message: "Failed to load FCM tokens",
+		}, err
 	}
 
-	// Validate FCM token format (basic validation)
-	if len(user.FCMToken) < 100 {
-		colors.PrintWarning("User %d (%s) has invalid FCM token (too short)", userID, user.Name)
+	tokens := tokensByUser[userID]
+	if len(tokens) == 0 {
+		colors.PrintWarning("User %d (%s) has no FCM token", userID, user.Name)
 		return &NotificationServiceResponse{
 			Success: false,
-			Message: "User has invalid FCM token",
-		}, fmt.Errorf("user has invalid FCM token")
+			Message: "User has no FCM token",
+		}, fmt.Errorf("user has no FCM token")
 	}
 
-	colors.PrintInfo("Sending notification to user %d (%s) with FCM token: %s...", userID, user.Name, user.FCMToken[:20])
+	colors.PrintInfo("Sending notification to user %d (%s) on %d devices", userID, user.Name, len(tokens))
 
 	// Send via Ravipangali API
 	response, err := ns.ravipangaliService.SendPushNotification(
 		notification.Title,
 		notification.Body,
-		[]string{user.FCMToken},
+		tokens,
 		notification.ImageURL,
 		notification.Data,
 		notification.Priority,
@@ -83,6 +166,8 @@ func (ns *NotificationService) SendToUser(userID uint, notification *Notificatio
 		notification.Sound,
 	)
 
+	ClearUnregisteredFCMTokens(response)
+
 	if err != nil {
 		colors.PrintError("Failed to send notification to user %d via Ravipangali: %v", userID, err)
 		return &NotificationServiceResponse{
@@ -123,31 +208,45 @@ func (ns *NotificationService) SendToMultipleUsers(userIDs []uint, notification
 		}, err
 	}
 
-	// Extract FCM tokens with validation
+	// Deliver to open app and dashboard sessions even when users have no push token
+	NotifyInApp(userIDs, inAppNotificationFrom(notification))
+
+	tokensByUser, err := GetUsersFCMTokens(userIDs)
+	if err != nil {
+		log.Printf("Failed to fetch FCM tokens for notification: %v", err)
+		return &NotificationServiceResponse{
+			Success: false,
+			Message: "Failed to fetch FCM tokens",
+		}, err
+	}
+
+	// Fan out to every active device of each user
 	var tokens []string
 	var validUsers []string
 	var invalidUsers []string
 
 	for _, user := range users {
-		if user.FCMToken != "" && len(user.FCMToken) >= 100 {
-			tokens = append(tokens, user.FCMToken)
+		userTokens := tokensByUser[user.ID]
+		if len(userTokens) > 0 {
+			tokens = append(tokens, userTokens...)
 			validUsers = append(validUsers, user.Name)
-			colors.PrintInfo("User %d (%s) has valid FCM token", user.ID, user.Name)
+			colors.PrintInfo("User %d (%s) has %d FCM tokens", user.ID, user.Name, len(userTokens))
 		} else {
 			invalidUsers = append(invalidUsers, user.Name)
-			colors.PrintWarning("User %d (%s) has no FCM token or invalid token", user.ID, user.Name)
+			colors.PrintWarning("User %d (%s) has no FCM token", user.ID, user.Name)
 		}
 	}
 
 	if len(tokens) == 0 {
 		colors.PrintWarning("No valid FCM tokens found for any of the %d users", len(userIDs))
 		return &NotificationServiceResponse{
-			Success: false,
-			Message: "No valid FCM tokens found for any users",
+			Success:    false,
+			Message:    "No valid FCM tokens found for any users",
+			Deliveries: ResolveDeliveries(userIDs, tokensByUser, nil, nil),
 		}, fmt.Errorf("no valid FCM tokens found")
 	}
 
-	colors.PrintInfo("Sending notification to %d users with valid FCM tokens: %v", len(tokens), validUsers)
+	colors.PrintInfo("Sending notification to %d tokens for users: %v", len(tokens), validUsers)
 
 	// Send via Ravipangali API
 	response, err := ns.ravipangaliService.SendPushNotification(
@@ -161,21 +260,26 @@ func (ns *NotificationService) SendToMultipleUsers(userIDs []uint, notification
 		notification.Sound,
 	)
 
+	ClearUnregisteredFCMTokens(response)
+	deliveries := ResolveDeliveries(userIDs, tokensByUser, response, err)
+
 	if err != nil {
 		colors.PrintError("Failed to send notification to %d users via Ravipangali: %v", len(tokens), err)
 		return &NotificationServiceResponse{
-			Success: false,
-			Message: "Failed to send notification",
-			Error:   err.Error(),
+			Success:    false,
+			Message:    "Failed to send notification",
+			Error:      err.Error(),
+			Deliveries: deliveries,
 		}, err
 	}
 
 	if !response.Success {
 		colors.PrintError("Ravipangali API returned failure: %s", response.Error)
 		return &NotificationServiceResponse{
-			Success: false,
-			Message: "Failed to send notification",
-			Error:   response.Error,
+			Success:    false,
+			Message:    "Failed to send notification",
+			Error:      response.Error,
+			Deliveries: deliveries,
 		}, fmt.Errorf("Ravipangali API error: %s", response.Error)
 	}
 
@@ -187,11 +291,35 @@ func (ns *NotificationService) SendToMultipleUsers(userIDs []uint, notification
 	}
 
 	return &NotificationServiceResponse{
-		Success: true,
-		Message: "Notification sent successfully",
+		Success:    true,
+		Message:    "Notification sent successfully",
+		Deliveries: deliveries,
 	}, nil
 }
 
+// RecordDeliveries stores each recipient's push outcome on their notification_users row
+func RecordDeliveries(notificationID uint, deliveries map[uint]DeliveryResult) {
+	now := time.Now()
+	for userID, result := range deliveries {
+		updates := map[string]interface{}{
+			"delivery_status": result.Status,
+			"delivery_error":  result.Error,
+			"devices_sent":    result.DevicesSent,
+			"devices_failed":  result.DevicesFailed,
+			"updated_at":      now,
+		}
+		if result.Status == models.DeliveryStatusDelivered {
+			updates["delivered_at"] = now
+		}
+
+		if err := db.GetDB().Model(&models.NotificationUser{}).
+			Where("notification_id = ? AND user_id = ?", notificationID, userID).
+			Updates(updates).Error; err != nil {
+			colors.PrintError("Failed to record delivery status for notification %d user %d: %v", notificationID, userID, err)
+		}
+	}
+}
+
 // SendToTopic sends notification to a topic
 func (ns *NotificationService) SendToTopic(topic string, notification *NotificationData) (*NotificationServiceResponse, error) {
 	// For topic notifications, we need to get all users subscribed to the topic
@@ -242,6 +370,8 @@ func (ns *NotificationService) SendNotificationByID(notificationID uint) (*Notif
 		ImageURL: notification.ImageData, // Use image_data as primary image URL
 		Sound:    notification.Sound,
 		Priority: notification.Priority,
+
+		NotificationID: notification.ID,
 	}
 
 	// If image_data is not available, fallback to image_url
@@ -251,6 +381,9 @@ func (ns *NotificationService) SendNotificationByID(notificationID uint) (*Notif
 
 	// Send the notification
 	response, err := ns.SendToMultipleUsers(userIDs, notificationData)
+	if response != nil {
+		RecordDeliveries(notificationID, response.Deliveries)
+	}
 	if err != nil {
 		return response, err
 	}
@@ -305,16 +438,53 @@ func (ns *NotificationService) convertDataToMap(data map[string]interface{}) map
 	return result
 }
 
-// UpdateUserFCMToken updates user's FCM token
+// ClearUnregisteredFCMTokens removes tokens the push provider reported as permanently
+// invalid so later sends stop retrying them. It returns the number of users updated.
+func ClearUnregisteredFCMTokens(response *RavipangaliResponse) int64 {
+	if response == nil {
+		return 0
+	}
+
+	tokens := response.PermanentlyFailedTokens()
+	if len(tokens) == 0 {
+		return 0
+	}
+
+	if err := db.GetDB().Model(&models.UserDevice{}).Where("fcm_token IN ?", tokens).Update("is_active", false).Error; err != nil {
+		colors.PrintError("Failed to deactivate %d unregistered device tokens: %v", len(tokens), err)
+	}
+
+	result := db.GetDB().Model(&models.User{}).Where("fcm_token IN ?", tokens).Update("fcm_token", "")
+	if result.Error != nil {
+		colors.PrintError("Failed to clear %d unregistered FCM tokens: %v", len(tokens), result.Error)
+		return 0
+	}
+
+	if result.RowsAffected > 0 {
+		colors.PrintWarning("Cleared unregistered FCM token for %d users", result.RowsAffected)
+	}
+	return result.RowsAffected
+}
+
+// UpdateUserFCMToken updates user's FCM token and registers it as one of the user's devices
 func (ns *NotificationService) UpdateUserFCMToken(userID uint, fcmToken string) error {
-	database := db.GetDB()
-	return database.Model(&models.User{}).Where("id = ?", userID).Update("fcm_token", fcmToken).Error
+	_, err := RegisterUserDevice(userID, fcmToken, models.DevicePlatformUnknown, "")
+	return err
 }
 
-// RemoveUserFCMToken removes user's FCM token
+// RemoveUserFCMToken removes user's FCM token and deactivates the matching device
 func (ns *NotificationService) RemoveUserFCMToken(userID uint) error {
 	database := db.GetDB()
-	return database.Model(&models.User{}).Where("id = ?", userID).Update("fcm_token", "").Error
+
+	var user models.User
+	if err := database.Select("id", "fcm_token").First(&user, userID).Error; err != nil {
+		return err
+	}
+	if user.FCMToken == "" {
+		return nil
+	}
+
+	return UnregisterUserDevice(userID, user.FCMToken)
 }
 
 // SubscribeToTopic subscribes a user to a topic
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"errors"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/colors"
+	"regexp"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// ErrTemplateNotFound is returned when no stored or built-in template has the given name
+var ErrTemplateNotFound = errors.New("notification template not found")
+
+// templateVariablePattern matches {name} placeholders
+var templateVariablePattern = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// NotificationCatalog holds the built-in vehicle event templates by language and name.
+// A stored template with the same name and language overrides the built-in one.
+var NotificationCatalog = map[string]map[string]models.NotificationTemplate{
+	models.LanguageEnglish: DefaultNotificationTemplates,
+	models.LanguageNepali:  NepaliNotificationTemplates,
+}
+
+// DefaultNotificationTemplates are the built-in English templates, used whenever
+// a translation is missing
+var DefaultNotificationTemplates = map[string]models.NotificationTemplate{
+	string(NotificationTypeIgnitionOn): {
+		Name:     string(NotificationTypeIgnitionOn),
+		Language: models.LanguageEnglish,
+		Title:    "{reg_no}: Ignition On",
+		Body:     "Your vehicle is turned ON\nDate: {date}\nTime: {time}",
+		Type:     "alert",
+	},
+	string(NotificationTypeIgnitionOff): {
+		Name:     string(NotificationTypeIgnitionOff),
+		Language: models.LanguageEnglish,
+		Title:    "{reg_no}: Ignition Off",
+		Body:     "Your vehicle is turned OFF\nDate: {date}\nTime: {time}",
+		Type:     "alert",
+	},
+	string(NotificationTypeOverspeed): {
+		Name:     string(NotificationTypeOverspeed),
+		Language: models.LanguageEnglish,
+		Title:    "{reg_no}: Vehicle is Overspeed",
+		Body:     "Your vehicle is overspeeding (Speed: {speed} km/h)\nDate: {date}\nTime: {time}",
+		Type:     "alert",
+	},
+	string(NotificationTypeRunning): {
+		Name:     string(NotificationTypeRunning),
+		Language: models.LanguageEnglish,
+		Title:    "{reg_no}: Vehicle is Running",
+		Body:     "Your vehicle is moving (Speed: {speed} km/h)\nDate: {date}\nTime: {time}",
+		Type:     "alert",
+	},
+	string(NotificationTypeOffHoursMovement): {
+		Name:     string(NotificationTypeOffHoursMovement),
+		Language: models.LanguageEnglish,
+		Title:    "{reg_no}: Moving Outside Allowed Hours",
+		Body:     "Your vehicle started moving outside its allowed hours ({allowed_start} - {allowed_end}) (Speed: {speed} km/h)\nDate: {date}\nTime: {time}",
+		Type:     "alarm",
+	},
+	string(NotificationTypeTowAway): {
+		Name:     string(NotificationTypeTowAway),
+		Language: models.LanguageEnglish,
+		Title:    "{reg_no}: Possible Tow-Away",
+		Body:     "Your vehicle has moved {distance} m from where it was parked while the ignition is OFF\nDate: {date}\nTime: {time}",
+		Type:     "alarm",
+	},
+	string(NotificationTypeMaintenanceDue): {
+		Name:     string(NotificationTypeMaintenanceDue),
+		Language: models.LanguageEnglish,
+		Title:    "{reg_no}: {service} Due",
+		Body:     "{service} is due ({km_since_service} km and {hours_since_service} engine hours since last service)\nDate: {date}\nTime: {time}",
+		Type:     "reminder",
+	},
+}
+
+// NepaliNotificationTemplates are the built-in Nepali templates
+var NepaliNotificationTemplates = map[string]models.NotificationTemplate{
+	string(NotificationTypeIgnitionOn): {
+		Name:     string(NotificationTypeIgnitionOn),
+		Language: models.LanguageNepali,
+		Title:    "{reg_no}: इन्जिन सुरु भयो",
+		Body:     "तपाईंको सवारी साधन सुरु भयो\nमिति: {date}\nसमय: {time}",
+		Type:     "alert",
+	},
+	string(NotificationTypeIgnitionOff): {
+		Name:     string(NotificationTypeIgnitionOff),
+		Language: models.LanguageNepali,
+		Title:    "{reg_no}: इन्जिन बन्द भयो",
+		Body:     "तपाईंको सवारी साधन बन्द भयो\nमिति: {date}\nसमय: {time}",
+		Type:     "alert",
+	},
+	string(NotificationTypeOverspeed): {
+		Name:     string(NotificationTypeOverspeed),
+		Language: models.LanguageNepali,
+		Title:    "{reg_no}: सवारी साधन तीव्र गतिमा छ",
+		Body:     "तपाईंको सवारी साधन तोकिएको गतिभन्दा बढी चलिरहेको छ (गति: {speed} कि.मि./घण्टा)\nमिति: {date}\nसमय: {time}",
+		Type:     "alert",
+	},
+	string(NotificationTypeRunning): {
+		Name:     string(NotificationTypeRunning),
+		Language: models.LanguageNepali,
+		Title:    "{reg_no}: सवारी साधन चलिरहेको छ",
+		Body:     "तपाईंको सवारी साधन चलिरहेको छ (गति: {speed} कि.मि./घण्टा)\nमिति: {date}\nसमय: {time}",
+		Type:     "alert",
+	},
+	string(NotificationTypeOffHoursMovement): {
+		Name:     string(NotificationTypeOffHoursMovement),
+		Language: models.LanguageNepali,
+		Title:    "{reg_no}: अनुमति नभएको समयमा सवारी साधन चल्यो",
+		Body:     "तपाईंको सवारी साधन अनुमति दिइएको समय ({allowed_start} - {allowed_end}) बाहिर चल्न थाल्यो (गति: {speed} कि.मि./घण्टा)\nमिति: {date}\nसमय: {time}",
+		Type:     "alarm",
+	},
+	string(NotificationTypeTowAway): {
+		Name:     string(NotificationTypeTowAway),
+		Language: models.LanguageNepali,
+		Title:    "{reg_no}: सवारी साधन टो गरिएको हुन सक्छ",
+		Body:     "इन्जिन बन्द हुँदा तपाईंको सवारी साधन पार्क गरिएको ठाउँबाट {distance} मिटर सरेको छ\nमिति: {date}\nसमय: {time}",
+		Type:     "alarm",
+	},
+	string(NotificationTypeMaintenanceDue): {
+		Name:     string(NotificationTypeMaintenanceDue),
+		Language: models.LanguageNepali,
+		Title:    "{reg_no}: {service} गर्ने समय भयो",
+		Body:     "{service} गर्ने समय भयो (पछिल्लो सर्भिसदेखि {km_since_service} कि.मि. र {hours_since_service} इन्जिन घण्टा)\nमिति: {date}\nसमय: {time}",
+		Type:     "reminder",
+	},
+}
+
+// RenderTemplate replaces {name} placeholders with values from data.
+// Placeholders without a value are left as written and returned in missing,
+// so a template referring to an unknown variable still produces readable text.
+func RenderTemplate(text string, data map[string]string) (string, []string) {
+	var missing []string
+	rendered := templateVariablePattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if value, exists := data[name]; exists {
+			return value
+		}
+		missing = append(missing, name)
+		return placeholder
+	})
+	return rendered, missing
+}
+
+// TemplateVariables lists the distinct placeholder names used in the text
+func TemplateVariables(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range templateVariablePattern.FindAllStringSubmatch(text, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// GetNotificationTemplate returns the template with the given name in the requested
+// language, falling back to English when there is no translation. Stored templates
+// take precedence over the built-in catalog.
+func GetNotificationTemplate(name, language string) (*models.NotificationTemplate, error) {
+	if !models.IsValidLanguage(language) {
+		language = models.LanguageEnglish
+	}
+
+	languages := []string{language}
+	if language != models.LanguageEnglish {
+		languages = append(languages, models.LanguageEnglish)
+	}
+
+	for _, lang := range languages {
+		if template := findStoredTemplate(name, lang); template != nil {
+			return template, nil
+		}
+		if builtIn, exists := NotificationCatalog[lang][name]; exists {
+			return &builtIn, nil
+		}
+	}
+	return nil, ErrTemplateNotFound
+}
+
+// findStoredTemplate loads an active stored template, or returns nil when there is
+// none or no database connection (the built-in catalog is used then)
+func findStoredTemplate(name, language string) *models.NotificationTemplate {
+	if db.GetDB() == nil {
+		return nil
+	}
+
+	var template models.NotificationTemplate
+	err := db.GetDB().Where("name = ? AND language = ? AND is_active = ?", name, language, true).First(&template).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			colors.PrintWarning("Failed to load notification template %s (%s), using default: %v", name, language, err)
+		}
+		return nil
+	}
+	return &template
+}
+
+// RenderedNotification is a template filled with event data, ready to send
+type RenderedNotification struct {
+	Title    string
+	Body     string
+	Type     string
+	Language string
+}
+
+// RenderNotificationTemplate renders the named template's title and body in the given language
+func RenderNotificationTemplate(name, language string, data map[string]string) (*RenderedNotification, error) {
+	template, err := GetNotificationTemplate(name, language)
+	if err != nil {
+		return nil, err
+	}
+
+	title, missingInTitle := RenderTemplate(template.Title, data)
+	body, missingInBody := RenderTemplate(template.Body, data)
+	if missing := append(missingInTitle, missingInBody...); len(missing) > 0 {
+		colors.PrintWarning("Notification template %s has no value for %v", name, missing)
+	}
+
+	notificationType := template.Type
+	if notificationType == "" {
+		notificationType = "alert"
+	}
+
+	// Report the language actually used, which is English after a fallback
+	renderedLanguage := template.Language
+	if renderedLanguage == "" {
+		renderedLanguage = models.LanguageEnglish
+	}
+
+	return &RenderedNotification{
+		Title:    title,
+		Body:     body,
+		Type:     notificationType,
+		Language: renderedLanguage,
+	}, nil
+}
+
+// LocalizedNotification is a rendered notification and the users who should receive it
+type LocalizedNotification struct {
+	RenderedNotification
+	UserIDs []uint
+}
+
+// LocalizeNotification renders the named template once per language used by the
+// recipients and groups the recipients by it. Batches are ordered by language.
+func LocalizeNotification(name string, recipients []models.User, data map[string]string) ([]LocalizedNotification, error) {
+	usersByLanguage := make(map[string][]uint)
+	for _, recipient := range recipients {
+		language := recipient.GetLanguage()
+		usersByLanguage[language] = append(usersByLanguage[language], recipient.ID)
+	}
+
+	languages := make([]string, 0, len(usersByLanguage))
+	for language := range usersByLanguage {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	batches := make([]LocalizedNotification, 0, len(languages))
+	for _, language := range languages {
+		rendered, err := RenderNotificationTemplate(name, language, data)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, LocalizedNotification{
+			RenderedNotification: *rendered,
+			UserIDs:              usersByLanguage[language],
+		})
+	}
+	return batches, nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/internal/protocol"
+)
+
+// MaxRedecodePackets caps how many stored frames one re-decode request may replay
+const MaxRedecodePackets = 100
+
+// NewConfiguredGT06Decoder creates a GT06 decoder with the options set in the environment,
+// as used for live device connections
+func NewConfiguredGT06Decoder() *protocol.GT06Decoder {
+	return protocol.NewGT06DecoderWithOptions(protocol.GT06Options{
+		HonorHemisphere:   config.GetHonorGPSHemisphere(),
+		CoordinateDivisor: config.GetGPSCoordinateDivisor(),
+	})
+}
+
+// RedecodedPacket is a stored raw frame run again through the current decoder,
+// next to what was stored for it
+type RedecodedPacket struct {
+	GPSDataID      uint                      `json:"gps_data_id"`
+	Timestamp      time.Time                 `json:"timestamp"`
+	StoredProtocol string                    `json:"stored_protocol"`
+	RawPacket      string                    `json:"raw_packet"`
+	Decoded        []*protocol.DecodedPacket `json:"decoded"`
+	Error          string                    `json:"error,omitempty"`
+}
+
+// RedecodeRawPacket decodes a stored hex frame with a fresh decoder. A decoder panic is
+// returned as an error, since replaying old frames is how decoder regressions are found.
+func RedecodeRawPacket(rawHex string) (packets []*protocol.DecodedPacket, err error) {
+	frame, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, fmt.Errorf("stored packet is not valid hex: %v", err)
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			packets = nil
+			err = fmt.Errorf("decoder panicked: %v", recovered)
+		}
+	}()
+	return NewConfiguredGT06Decoder().AddData(frame)
+}
+
+// RedecodeRecentPackets re-decodes the last limit raw frames stored for the device, newest first
+func RedecodeRecentPackets(imei string, limit int) ([]RedecodedPacket, error) {
+	var rows []models.GPSData
+	if err := db.GetDB().Select("id", "timestamp", "protocol_name", "raw_packet").
+		Where("imei = ? AND raw_packet <> ''", imei).
+		Order("id DESC").Limit(limit).
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load raw packets: %v", err)
+	}
+
+	results := make([]RedecodedPacket, 0, len(rows))
+	for _, row := range rows {
+		result := RedecodedPacket{
+			GPSDataID:      row.ID,
+			Timestamp:      row.Timestamp,
+			StoredProtocol: row.ProtocolName,
+			RawPacket:      row.RawPacket,
+		}
+		packets, err := RedecodeRawPacket(row.RawPacket)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Decoded = packets
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/utils"
+	"sort"
+	"time"
+)
+
+// VehicleDistance is a vehicle's last known position and its distance from a reference point
+type VehicleDistance struct {
+	IMEI       string         `json:"imei"`
+	DistanceKm float64        `json:"distance_km"`
+	Location   models.GPSData `json:"location"`
+}
+
+// RankByDistance returns the locations nearest to (lat, lng) first, at most limit of them.
+// Locations without coordinates, at 0,0 or older than since are left out.
+func RankByDistance(lat, lng float64, locations []models.GPSData, since time.Time, limit int) []VehicleDistance {
+	ranked := make([]VehicleDistance, 0, len(locations))
+	for _, location := range locations {
+		if !location.IsValidLocation() || location.Timestamp.Before(since) {
+			continue
+		}
+		if *location.Latitude == 0 && *location.Longitude == 0 {
+			continue
+		}
+		ranked = append(ranked, VehicleDistance{
+			IMEI:       location.IMEI,
+			DistanceKm: utils.CalculateDistance(lat, lng, *location.Latitude, *location.Longitude),
+			Location:   location,
+		})
+	}
+
+	// Stable so vehicles at the same distance keep a predictable order
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].DistanceKm < ranked[j].DistanceKm
+	})
+
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"luna_iot_server/pkg/colors"
@@ -50,6 +51,9 @@ type RavipangaliResponse struct {
 	TokensDelivered int      `json:"tokens_delivered,omitempty"`
 	TokensFailed    int      `json:"tokens_failed,omitempty"`
 	Details         []Detail `json:"details,omitempty"`
+
+	// Failed lists per-token failures derived from Details so callers can act on them
+	Failed []FailedToken `json:"failed_tokens,omitempty"`
 }
 
 // Detail represents individual token delivery details
@@ -59,6 +63,79 @@ type Detail struct {
 	Response interface{} `json:"response"`
 }
 
+// FailedToken describes a token the push provider could not deliver to
+type FailedToken struct {
+	Token     string `json:"token"`
+	Reason    string `json:"reason"`
+	Permanent bool   `json:"permanent"` // Token is unregistered or invalid and will never succeed
+}
+
+// permanentTokenErrors are FCM error markers meaning a token should not be retried
+var permanentTokenErrors = []string{
+	"registration-token-not-registered",
+	"invalid-registration-token",
+	"unregistered",
+	"notregistered",
+	"not registered",
+	"invalidregistration",
+	"requested entity was not found",
+}
+
+// FailedTokens returns the per-token failures reported in the response details
+func (r *RavipangaliResponse) FailedTokens() []FailedToken {
+	var failed []FailedToken
+	for _, detail := range r.Details {
+		if detail.Success {
+			continue
+		}
+
+		reason := describeDetailResponse(detail.Response)
+		failed = append(failed, FailedToken{
+			Token:     detail.Token,
+			Reason:    reason,
+			Permanent: isPermanentTokenFailure(reason),
+		})
+	}
+	return failed
+}
+
+// PermanentlyFailedTokens returns the tokens that should be removed from their users
+func (r *RavipangaliResponse) PermanentlyFailedTokens() []string {
+	var tokens []string
+	for _, failed := range r.FailedTokens() {
+		if failed.Permanent {
+			tokens = append(tokens, failed.Token)
+		}
+	}
+	return tokens
+}
+
+// describeDetailResponse flattens a provider detail response into a string
+func describeDetailResponse(response interface{}) string {
+	switch v := response.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		if jsonBytes, err := json.Marshal(v); err == nil {
+			return string(jsonBytes)
+		}
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// isPermanentTokenFailure reports whether a failure reason marks the token as dead
+func isPermanentTokenFailure(reason string) bool {
+	reason = strings.ToLower(reason)
+	for _, marker := range permanentTokenErrors {
+		if strings.Contains(reason, marker) {
+			return true
+		}
+	}
+	return false
+}
+
 // SendPushNotification sends push notification via Ravipangali API
 func (rs *RavipangaliService) SendPushNotification(
 	title, body string,
@@ -239,15 +316,12 @@ func (rs *RavipangaliService) SendPushNotification(
 	colors.PrintInfo("  Tokens Failed: %d", response.TokensFailed)
 
 	// If there are failed tokens, log them
-	if response.TokensFailed > 0 {
+	response.Failed = response.FailedTokens()
+	if response.TokensFailed > 0 || len(response.Failed) > 0 {
 		colors.PrintWarning("❌   Tokens Failed: %d", response.TokensFailed)
-		if len(response.Details) > 0 {
-			for _, detail := range response.Details {
-				if !detail.Success {
-					colors.PrintWarning("    Failed token: %s", detail.Token[:20]+"...")
-					colors.PrintWarning("    Response: %v", detail.Response)
-				}
-			}
+		for _, failed := range response.Failed {
+			colors.PrintWarning("    Failed token: %s (permanent: %t)", tokenPreview(failed.Token), failed.Permanent)
+			colors.PrintWarning("    Response: %s", failed.Reason)
 		}
 	}
 
@@ -259,6 +333,14 @@ func (rs *RavipangaliService) SendPushNotification(
 	return &response, nil
 }
 
+// tokenPreview shortens a token for logging
+func tokenPreview(token string) string {
+	if len(token) <= 20 {
+		return token
+	}
+	return token[:20] + "..."
+}
+
 // GetUserFCMTokens retrieves FCM tokens for the given user IDs
 func (rs *RavipangaliService) GetUserFCMTokens(userIDs []uint) ([]string, error) {
 	// This function would typically query your database to get FCM tokens
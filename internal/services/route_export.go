@@ -0,0 +1,291 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"luna_iot_server/config"
+	"luna_iot_server/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media types of the route export formats
+const (
+	GPXContentType     = "application/gpx+xml"
+	KMLContentType     = "application/vnd.google-earth.kml+xml"
+	GeoJSONContentType = "application/geo+json"
+)
+
+// gpxCreator names this server in the GPX documents it writes
+const gpxCreator = "Luna IOT Server"
+
+type gpxDocument struct {
+	XMLName        xml.Name    `xml:"gpx"`
+	Version        string      `xml:"version,attr"`
+	Creator        string      `xml:"creator,attr"`
+	Namespace      string      `xml:"xmlns,attr"`
+	XSINamespace   string      `xml:"xmlns:xsi,attr"`
+	SchemaLocation string      `xml:"xsi:schemaLocation,attr"`
+	Metadata       gpxMetadata `xml:"metadata"`
+	Track          gpxTrack    `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Time string `xml:"time"`
+}
+
+type gpxTrack struct {
+	Name    string          `xml:"name,omitempty"`
+	Segment gpxTrackSegment `xml:"trkseg"`
+}
+
+type gpxTrackSegment struct {
+	Points []gpxTrackPoint `xml:"trkpt"`
+}
+
+// gpxTrackPoint fields follow the element order the GPX 1.1 schema requires
+type gpxTrackPoint struct {
+	Lat       float64 `xml:"lat,attr"`
+	Lon       float64 `xml:"lon,attr"`
+	Elevation *int    `xml:"ele,omitempty"`
+	Time      string  `xml:"time"`
+}
+
+// RouteGPX writes the positioned fixes of a route as a GPX 1.1 track named name. Times
+// are in UTC as GPX requires, and fixes with an altitude carry it as the elevation.
+// Fixes without coordinates are skipped.
+func RouteGPX(name string, points []models.GPSData, generatedAt time.Time) ([]byte, error) {
+	document := gpxDocument{
+		Version:        "1.1",
+		Creator:        gpxCreator,
+		Namespace:      "http://www.topografix.com/GPX/1/1",
+		XSINamespace:   "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://www.topografix.com/GPX/1/1 http://www.topografix.com/GPX/1/1/gpx.xsd",
+		Metadata:       gpxMetadata{Name: name, Time: exportTime(generatedAt)},
+		Track: gpxTrack{
+			Name:    name,
+			Segment: gpxTrackSegment{Points: make([]gpxTrackPoint, 0, len(points))},
+		},
+	}
+
+	for _, point := range points {
+		if point.Latitude == nil || point.Longitude == nil {
+			continue
+		}
+		document.Track.Segment.Points = append(document.Track.Segment.Points, gpxTrackPoint{
+			Lat:       *point.Latitude,
+			Lon:       *point.Longitude,
+			Elevation: point.Altitude,
+			Time:      exportTime(point.Timestamp),
+		})
+	}
+
+	body, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// exportTime formats a time as the UTC xsd:dateTime that GPX and KML use
+func exportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+type kmlDocument struct {
+	XMLName   xml.Name    `xml:"kml"`
+	Namespace string      `xml:"xmlns,attr"`
+	Document  kmlContents `xml:"Document"`
+}
+
+type kmlContents struct {
+	Name       string         `xml:"name"`
+	Styles     []kmlStyle     `xml:"Style"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlStyle struct {
+	ID        string        `xml:"id,attr"`
+	LineStyle *kmlLineStyle `xml:"LineStyle,omitempty"`
+	IconStyle *kmlIconStyle `xml:"IconStyle,omitempty"`
+}
+
+type kmlLineStyle struct {
+	Color string `xml:"color"` // aabbggrr
+	Width int    `xml:"width"`
+}
+
+type kmlIconStyle struct {
+	Color string  `xml:"color"`
+	Scale float64 `xml:"scale"`
+	Href  string  `xml:"Icon>href"`
+}
+
+type kmlPlacemark struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	StyleURL    string         `xml:"styleUrl"`
+	TimeSpan    *kmlTimeSpan   `xml:"TimeSpan,omitempty"`
+	LineString  *kmlLineString `xml:"LineString,omitempty"`
+	Point       *kmlPoint      `xml:"Point,omitempty"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// RouteKML writes a route as a KML document for Google Earth: the positioned fixes as one
+// styled line, and a placemark for each stop. Fixes without coordinates are skipped.
+func RouteKML(name string, points []models.GPSData, stops []RouteStop) ([]byte, error) {
+	coordinates := make([]string, 0, len(points))
+	for _, point := range points {
+		if point.Latitude == nil || point.Longitude == nil {
+			continue
+		}
+		coordinates = append(coordinates, kmlCoordinate(*point.Latitude, *point.Longitude))
+	}
+
+	document := kmlDocument{
+		Namespace: "http://www.opengis.net/kml/2.2",
+		Document: kmlContents{
+			Name: name,
+			Styles: []kmlStyle{
+				{ID: "track", LineStyle: &kmlLineStyle{Color: "ffd77800", Width: 4}},
+				{ID: "stop", IconStyle: &kmlIconStyle{
+					Color: "ff0000ff",
+					Scale: 1.1,
+					Href:  "http://maps.google.com/mapfiles/kml/shapes/parking_lot.png",
+				}},
+			},
+		},
+	}
+
+	track := kmlPlacemark{
+		Name:       name,
+		StyleURL:   "#track",
+		LineString: &kmlLineString{Tessellate: 1, Coordinates: strings.Join(coordinates, " ")},
+	}
+	if len(points) > 0 {
+		track.TimeSpan = &kmlTimeSpan{Begin: exportTime(points[0].Timestamp), End: exportTime(points[len(points)-1].Timestamp)}
+	}
+	document.Document.Placemarks = append(document.Document.Placemarks, track)
+
+	for i, stop := range stops {
+		document.Document.Placemarks = append(document.Document.Placemarks, kmlPlacemark{
+			Name: fmt.Sprintf("Stop %d", i+1),
+			Description: fmt.Sprintf("%s to %s (%s)", config.FormatTimestamp(stop.Start), config.FormatTimestamp(stop.End),
+				stop.Duration.Round(time.Minute)),
+			StyleURL: "#stop",
+			TimeSpan: &kmlTimeSpan{Begin: exportTime(stop.Start), End: exportTime(stop.End)},
+			Point:    &kmlPoint{Coordinates: kmlCoordinate(stop.Latitude, stop.Longitude)},
+		})
+	}
+
+	body, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// kmlCoordinate formats a position as KML's longitude,latitude tuple
+func kmlCoordinate(latitude, longitude float64) string {
+	return strconv.FormatFloat(longitude, 'f', -1, 64) + "," + strconv.FormatFloat(latitude, 'f', -1, 64)
+}
+
+// GeoJSONFeatureCollection is a GeoJSON (RFC 7946) document, which web mapping libraries
+// such as Leaflet and Mapbox read directly
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature is one geometry with its properties
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONGeometry is a Point, whose coordinates are one position, or a LineString, whose
+// coordinates are a list of them. Positions are [longitude, latitude].
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// NewFeatureCollection wraps features in a FeatureCollection; nil becomes an empty list
+func NewFeatureCollection(features []GeoJSONFeature) GeoJSONFeatureCollection {
+	if features == nil {
+		features = []GeoJSONFeature{}
+	}
+	return GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// RouteFeature turns the positioned fixes of a route into one LineString feature. The
+// timestamps and speeds properties hold one entry per position, in the same order, and
+// properties are merged in. Fixes without coordinates are skipped.
+func RouteFeature(points []models.GPSData, properties map[string]interface{}) GeoJSONFeature {
+	coordinates := make([][]float64, 0, len(points))
+	timestamps := make([]string, 0, len(points))
+	speeds := make([]*int, 0, len(points))
+	for _, point := range points {
+		if point.Latitude == nil || point.Longitude == nil {
+			continue
+		}
+		coordinates = append(coordinates, []float64{*point.Longitude, *point.Latitude})
+		timestamps = append(timestamps, config.FormatTimestamp(point.Timestamp))
+		speeds = append(speeds, point.Speed)
+	}
+
+	featureProperties := map[string]interface{}{
+		"timestamps": timestamps,
+		"speeds":     speeds,
+	}
+	for key, value := range properties {
+		featureProperties[key] = value
+	}
+
+	return GeoJSONFeature{
+		Type:       "Feature",
+		Geometry:   GeoJSONGeometry{Type: "LineString", Coordinates: coordinates},
+		Properties: featureProperties,
+	}
+}
+
+// PositionFeature turns a positioned fix into a Point feature carrying its IMEI, time,
+// speed, course and ignition, with properties merged in. ok is false without coordinates.
+func PositionFeature(point *models.GPSData, properties map[string]interface{}) (feature GeoJSONFeature, ok bool) {
+	if point == nil || point.Latitude == nil || point.Longitude == nil {
+		return GeoJSONFeature{}, false
+	}
+
+	featureProperties := map[string]interface{}{
+		"imei":      point.IMEI,
+		"timestamp": config.FormatTimestamp(point.Timestamp),
+		"speed":     point.Speed,
+		"course":    point.Course,
+		"ignition":  point.Ignition,
+	}
+	for key, value := range properties {
+		featureProperties[key] = value
+	}
+
+	return GeoJSONFeature{
+		Type:       "Feature",
+		Geometry:   GeoJSONGeometry{Type: "Point", Coordinates: []float64{*point.Longitude, *point.Latitude}},
+		Properties: featureProperties,
+	}, true
+}
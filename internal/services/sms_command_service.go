@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"luna_iot_server/config"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/pkg/colors"
+)
+
+// SMSCommandSender delivers a GT06 control command (e.g. protocol.CmdCutOil) by text
+// message to the SIM installed in a device
+type SMSCommandSender interface {
+	SendCommand(simNo, command string) error
+}
+
+// GatewaySMSCommandSender sends commands through the SMS gateway also used for OTPs
+type GatewaySMSCommandSender struct {
+	smsConfig *config.SMSConfig
+	password  string
+	client    *http.Client
+}
+
+// NewGatewaySMSCommandSender creates a sender for the given gateway and device password
+func NewGatewaySMSCommandSender(smsConfig *config.SMSConfig, password string) *GatewaySMSCommandSender {
+	return &GatewaySMSCommandSender{
+		smsConfig: smsConfig,
+		password:  password,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SendCommand sends the SMS form of the command to the SIM number
+func (gs *GatewaySMSCommandSender) SendCommand(simNo, command string) error {
+	params := url.Values{}
+	params.Set("key", gs.smsConfig.APIKey)
+	params.Set("campaign", gs.smsConfig.CampaignID)
+	params.Set("routeid", gs.smsConfig.RouteID)
+	params.Set("type", "text")
+	params.Set("contacts", simNo)
+	params.Set("senderid", gs.smsConfig.SenderID)
+	params.Set("msg", protocol.SMSCommand(command, gs.password))
+
+	resp, err := gs.client.Get(gs.smsConfig.APIURL + "?" + params.Encode())
+	if err != nil {
+		return fmt.Errorf("failed to make HTTP request to SMS API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SMS API returned non-200 status code: %d", resp.StatusCode)
+	}
+
+	colors.PrintControl("Command %s sent by SMS to %s", command, simNo)
+	return nil
+}
+
+var (
+	smsCommandSender     SMSCommandSender
+	smsCommandSenderOnce sync.Once
+)
+
+// GetSMSCommandSender returns the shared SMS command sender built from configuration,
+// or nil when the SMS fallback is disabled
+func GetSMSCommandSender() SMSCommandSender {
+	smsCommandSenderOnce.Do(func() {
+		commandConfig := config.GetSMSCommandConfig()
+		smsConfig := config.GetSMSConfig()
+		if !commandConfig.Fallback || smsConfig.APIKey == "" {
+			colors.PrintInfo("📵 SMS command fallback disabled (SMS_COMMAND_FALLBACK not set)")
+			return
+		}
+
+		smsCommandSender = NewGatewaySMSCommandSender(smsConfig, commandConfig.Password)
+		colors.PrintInfo("📨 SMS command fallback enabled for devices without a TCP connection")
+	})
+	return smsCommandSender
+}
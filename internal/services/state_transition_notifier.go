@@ -0,0 +1,57 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// StateTransition is a change in a vehicle's live state
+type StateTransition string
+
+const (
+	TransitionIgnitionOn     StateTransition = "ignition_on"
+	TransitionIgnitionOff    StateTransition = "ignition_off"
+	TransitionStartedMoving  StateTransition = "started_moving"
+	TransitionStoppedMoving  StateTransition = "stopped_moving"
+	TransitionOverspeedStart StateTransition = "overspeed_start"
+	TransitionOverspeedEnd   StateTransition = "overspeed_end"
+	TransitionTowAway        StateTransition = "tow_away"
+)
+
+// VehicleStateTransition is a transition detected while checking a vehicle's GPS data
+type VehicleStateTransition struct {
+	IMEI      string
+	State     StateTransition
+	Speed     *int
+	Ignition  string
+	Timestamp time.Time
+}
+
+// StateTransitionNotifier delivers a transition to the live dashboards allowed to see the vehicle
+type StateTransitionNotifier func(transition *VehicleStateTransition)
+
+var (
+	stateTransitionNotifier      StateTransitionNotifier
+	stateTransitionNotifierMutex sync.RWMutex
+)
+
+// SetStateTransitionNotifier registers the real-time channel (the WebSocket hub) for transitions.
+// Services cannot import the HTTP layer, so the hub registers itself here on startup.
+func SetStateTransitionNotifier(notifier StateTransitionNotifier) {
+	stateTransitionNotifierMutex.Lock()
+	defer stateTransitionNotifierMutex.Unlock()
+	stateTransitionNotifier = notifier
+}
+
+// NotifyStateTransition passes the transition to the registered notifier.
+// It is a no-op until a notifier is registered.
+func NotifyStateTransition(transition *VehicleStateTransition) {
+	stateTransitionNotifierMutex.RLock()
+	notifier := stateTransitionNotifier
+	stateTransitionNotifierMutex.RUnlock()
+
+	if notifier == nil {
+		return
+	}
+	notifier(transition)
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"luna_iot_server/internal/models"
+	"time"
+)
+
+// TimelinePoint is one second of a vehicle's playback timeline. Status and location
+// packets received in the same second are merged into one point, and a point without
+// its own fix carries the previous valid fix with Interpolated set.
+type TimelinePoint struct {
+	Timestamp time.Time `json:"timestamp"`
+
+	// Location, either from this second or carried from LocationTimestamp
+	Latitude          *float64   `json:"latitude"`
+	Longitude         *float64   `json:"longitude"`
+	Speed             *int       `json:"speed"`
+	Course            *int       `json:"course"`
+	Altitude          *int       `json:"altitude"`
+	Interpolated      bool       `json:"interpolated"`
+	LocationTimestamp *time.Time `json:"location_timestamp"`
+
+	// Device status
+	Ignition       string `json:"ignition"`
+	Charger        string `json:"charger"`
+	GPSTracking    string `json:"gps_tracking"`
+	OilElectricity string `json:"oil_electricity"`
+	DeviceStatus   string `json:"device_status"`
+	VoltageLevel   *int   `json:"voltage_level"`
+	GSMSignal      *int   `json:"gsm_signal"`
+	AlarmActive    bool   `json:"alarm_active"`
+	AlarmType      string `json:"alarm_type"`
+}
+
+// HasValidFix reports whether the row has usable coordinates: present, in range and not 0,0
+func HasValidFix(data *models.GPSData) bool {
+	if !data.IsValidLocation() {
+		return false
+	}
+	lat := *data.Latitude
+	lng := *data.Longitude
+	return lat != 0 && lng != 0 && lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// BuildTimeline merges rows ordered by timestamp into one point per second.
+// Within a second the latest non-empty value of each field wins. Seconds without
+// a valid fix carry the most recent earlier fix, starting from previousFix (the
+// last fix before the range, may be nil); points before any fix have no coordinates.
+func BuildTimeline(rows []models.GPSData, previousFix *models.GPSData) []TimelinePoint {
+	timeline := make([]TimelinePoint, 0, len(rows))
+
+	var lastFix *models.GPSData
+	if previousFix != nil && HasValidFix(previousFix) {
+		lastFix = previousFix
+	}
+
+	for i := 0; i < len(rows); {
+		second := rows[i].Timestamp.Truncate(time.Second)
+		point := TimelinePoint{Timestamp: second}
+		var fix *models.GPSData
+
+		for ; i < len(rows) && rows[i].Timestamp.Truncate(time.Second).Equal(second); i++ {
+			row := &rows[i]
+			mergeTimelineStatus(&point, row)
+			if HasValidFix(row) {
+				fix = row
+			}
+		}
+
+		if fix != nil {
+			lastFix = fix
+		} else if lastFix != nil {
+			point.Interpolated = true
+		}
+		if lastFix != nil {
+			fixTime := lastFix.Timestamp
+			point.Latitude = lastFix.Latitude
+			point.Longitude = lastFix.Longitude
+			point.Speed = lastFix.Speed
+			point.Course = lastFix.Course
+			point.Altitude = lastFix.Altitude
+			point.LocationTimestamp = &fixTime
+		}
+
+		timeline = append(timeline, point)
+	}
+
+	return timeline
+}
+
+// mergeTimelineStatus copies the row's non-empty status fields onto the point
+func mergeTimelineStatus(point *TimelinePoint, row *models.GPSData) {
+	if row.Ignition != "" {
+		point.Ignition = row.Ignition
+	}
+	if row.Charger != "" {
+		point.Charger = row.Charger
+	}
+	if row.GPSTracking != "" {
+		point.GPSTracking = row.GPSTracking
+	}
+	if row.OilElectricity != "" {
+		point.OilElectricity = row.OilElectricity
+	}
+	if row.DeviceStatus != "" {
+		point.DeviceStatus = row.DeviceStatus
+	}
+	if row.VoltageLevel != nil {
+		point.VoltageLevel = row.VoltageLevel
+	}
+	if row.GSMSignal != nil {
+		point.GSMSignal = row.GSMSignal
+	}
+	if row.AlarmActive {
+		point.AlarmActive = true
+		point.AlarmType = row.AlarmType
+	}
+}
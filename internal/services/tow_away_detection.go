@@ -0,0 +1,111 @@
+package services
+
+import (
+	"fmt"
+	"luna_iot_server/config"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/colors"
+	"luna_iot_server/pkg/utils"
+	"time"
+)
+
+// towAwayMinFixes is how many fixes in a row must be far from the parking spot before an
+// alert, so one stray fix cannot raise it however long it stays the latest
+const towAwayMinFixes = 2
+
+// ParkedPosition is where a vehicle stopped with its ignition off, and how long it has
+// been away from there since
+type ParkedPosition struct {
+	Latitude  float64
+	Longitude float64
+	// First fix of the current run far from the parking spot; nil while the vehicle is there
+	DisplacedSince *time.Time
+	DisplacedFixes int
+	// Set once the vehicle was reported towed, so the alert is sent once per parking
+	TowAlerted bool
+}
+
+// RecordParkedPosition applies a fix's raw position and ignition to the vehicle's parking
+// spot and reports whether the vehicle is being towed: with the ignition off, it has been
+// at least the configured distance from where it parked for the minimum duration and
+// several fixes. A fix back near the spot ends the run, so GPS drift does not add up.
+// Turning the ignition on forgets the spot; an unknown ignition leaves it alone.
+func (vns *VehicleNotificationService) RecordParkedPosition(imei, ignition string, latitude, longitude float64, timestamp time.Time) (distanceMeters float64, towed bool) {
+	if vns.towAway == nil || vns.towAway.DistanceMeters <= 0 {
+		return 0, false
+	}
+
+	vns.statesMutex.Lock()
+	defer vns.statesMutex.Unlock()
+
+	vehicleState := vns.getOrCreateState(imei)
+	switch ignition {
+	case "OFF":
+	case "":
+		return 0, false
+	default:
+		vehicleState.Parked = nil
+		return 0, false
+	}
+	vehicleState.LastUpdate = config.GetCurrentTime()
+
+	parked := vehicleState.Parked
+	if parked == nil {
+		vehicleState.Parked = &ParkedPosition{Latitude: latitude, Longitude: longitude}
+		return 0, false
+	}
+
+	distanceMeters = utils.CalculateDistance(parked.Latitude, parked.Longitude, latitude, longitude) * 1000
+	if distanceMeters < float64(vns.towAway.DistanceMeters) {
+		parked.DisplacedSince = nil
+		parked.DisplacedFixes = 0
+		return distanceMeters, false
+	}
+
+	if parked.DisplacedSince == nil {
+		since := timestamp
+		parked.DisplacedSince = &since
+	}
+	parked.DisplacedFixes++
+
+	if parked.TowAlerted || parked.DisplacedFixes < towAwayMinFixes ||
+		timestamp.Sub(*parked.DisplacedSince) < vns.towAway.MinDuration {
+		return distanceMeters, false
+	}
+	parked.TowAlerted = true
+	return distanceMeters, true
+}
+
+// CheckTowAway runs RecordParkedPosition for a fix and, when it shows the vehicle being
+// towed, sends its users an urgent alert and tells live dashboards. The position must be
+// the device's own, before the GPS filter drops coordinates of fixes with the ignition off.
+func (vns *VehicleNotificationService) CheckTowAway(imei, ignition string, latitude, longitude float64, timestamp time.Time) error {
+	distanceMeters, towed := vns.RecordParkedPosition(imei, ignition, latitude, longitude, timestamp)
+	if !towed {
+		return nil
+	}
+
+	colors.PrintWarning("🚨 Possible tow-away: %s is %.0f m from where it parked with the ignition OFF", imei, distanceMeters)
+	NotifyStateTransition(&VehicleStateTransition{
+		IMEI:      imei,
+		State:     TransitionTowAway,
+		Ignition:  ignition,
+		Timestamp: timestamp,
+	})
+
+	var vehicle models.Vehicle
+	if err := db.GetDB().Where("imei = ?", imei).First(&vehicle).Error; err != nil {
+		colors.PrintWarning("Vehicle not found for IMEI %s: %v", imei, err)
+		return nil // Not an error, just no vehicle registered
+	}
+
+	values := templateData(&VehicleNotificationData{
+		IMEI:        imei,
+		RegNo:       vehicle.RegNo,
+		VehicleName: vehicle.Name,
+	}, config.GetCurrentTime())
+	values["distance"] = fmt.Sprintf("%.0f", distanceMeters)
+
+	return vns.sendNotificationToVehicleUsers(imei, NotificationTypeTowAway, values)
+}
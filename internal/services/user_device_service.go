@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrDeviceNotFound is returned when unregistering a token the user does not own
+var ErrDeviceNotFound = errors.New("device token not found")
+
+// RegisterUserDevice stores an FCM token for the user, or refreshes it if already known.
+// A token that moves to another account (e.g. after re-login) is reassigned to the new user.
+// The legacy users.fcm_token column is updated too so single-token readers keep working.
+func RegisterUserDevice(userID uint, fcmToken, platform, deviceName string) (*models.UserDevice, error) {
+	if platform == "" || !models.IsValidDevicePlatform(platform) {
+		platform = models.DevicePlatformUnknown
+	}
+
+	device := models.UserDevice{
+		UserID:     userID,
+		FCMToken:   fcmToken,
+		Platform:   platform,
+		DeviceName: deviceName,
+		IsActive:   true,
+		LastSeenAt: time.Now(),
+	}
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "fcm_token"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "device_name", "is_active", "last_seen_at", "updated_at"}),
+		}).Create(&device).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("fcm_token", fcmToken).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+// UnregisterUserDevice deactivates one of the user's tokens, e.g. on logout from that phone
+func UnregisterUserDevice(userID uint, fcmToken string) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.UserDevice{}).
+			Where("user_id = ? AND fcm_token = ?", userID, fcmToken).
+			Update("is_active", false)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		legacy := tx.Model(&models.User{}).
+			Where("id = ? AND fcm_token = ?", userID, fcmToken).
+			Update("fcm_token", "")
+		if legacy.Error != nil {
+			return legacy.Error
+		}
+
+		if result.RowsAffected == 0 && legacy.RowsAffected == 0 {
+			return ErrDeviceNotFound
+		}
+		return nil
+	})
+}
+
+// GetUserDevices returns the user's registered devices, most recently seen first
+func GetUserDevices(userID uint) ([]models.UserDevice, error) {
+	var devices []models.UserDevice
+	err := db.GetDB().Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices).Error
+	return devices, err
+}
+
+// GetUsersFCMTokens returns every active push token for each of the given users
+func GetUsersFCMTokens(userIDs []uint) (map[uint][]string, error) {
+	if len(userIDs) == 0 {
+		return map[uint][]string{}, nil
+	}
+
+	var users []models.User
+	if err := db.GetDB().Select("id", "fcm_token").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	var devices []models.UserDevice
+	if err := db.GetDB().Where("user_id IN ? AND is_active = ?", userIDs, true).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+
+	return MergeUserFCMTokens(users, devices), nil
+}
+
+// MergeUserFCMTokens combines active device tokens with the legacy single-column token,
+// dropping empty and duplicate tokens. Device tokens come first.
+func MergeUserFCMTokens(users []models.User, devices []models.UserDevice) map[uint][]string {
+	tokens := make(map[uint][]string)
+	seen := make(map[string]bool)
+
+	add := func(userID uint, token string) {
+		if token == "" || seen[token] {
+			return
+		}
+		seen[token] = true
+		tokens[userID] = append(tokens[userID], token)
+	}
+
+	for _, device := range devices {
+		if device.IsActive {
+			add(device.UserID, device.FCMToken)
+		}
+	}
+	for _, user := range users {
+		add(user.ID, user.FCMToken)
+	}
+
+	return tokens
+}
+
+// FlattenFCMTokens returns all tokens of a per-user token map in one list
+func FlattenFCMTokens(tokensByUser map[uint][]string) []string {
+	var tokens []string
+	for _, userTokens := range tokensByUser {
+		tokens = append(tokens, userTokens...)
+	}
+	return tokens
+}
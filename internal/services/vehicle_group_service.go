@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"luna_iot_server/internal/db"
+	"luna_iot_server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrVehicleGroupNotFound is returned when the group does not exist or belongs to another user
+var ErrVehicleGroupNotFound = errors.New("vehicle group not found")
+
+// GetOwnedVehicleGroup loads the owner's group with its members
+func GetOwnedVehicleGroup(ownerID, groupID uint) (*models.VehicleGroup, error) {
+	var group models.VehicleGroup
+	if err := db.GetDB().Where("id = ? AND owner_id = ?", groupID, ownerID).Preload("Members").First(&group).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrVehicleGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// AccessibleVehicleIDs returns the IMEIs of the vehicles the user has active, unexpired access to
+func AccessibleVehicleIDs(userID uint) (map[string]bool, error) {
+	var userVehicles []models.UserVehicle
+	if err := db.GetDB().Where("user_id = ? AND is_active = ?", userID, true).Find(&userVehicles).Error; err != nil {
+		return nil, err
+	}
+
+	accessible := make(map[string]bool, len(userVehicles))
+	for _, userVehicle := range userVehicles {
+		if !userVehicle.IsExpired() {
+			accessible[userVehicle.VehicleID] = true
+		}
+	}
+	return accessible, nil
+}
+
+// AddVehiclesToGroup puts the vehicles in the group; vehicles already in it are left as they are
+func AddVehiclesToGroup(groupID uint, imeis []string, addedBy uint) error {
+	if len(imeis) == 0 {
+		return nil
+	}
+
+	members := make([]models.VehicleGroupMember, 0, len(imeis))
+	for _, imei := range imeis {
+		members = append(members, models.VehicleGroupMember{GroupID: groupID, VehicleID: imei, AddedBy: addedBy})
+	}
+	return db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+}
+
+// FilterUserVehiclesByGroup keeps the user vehicles whose vehicle is one of groupVehicleIDs.
+// Group membership never grants access: a member the user cannot see is simply not returned.
+func FilterUserVehiclesByGroup(userVehicles []models.UserVehicle, groupVehicleIDs []string) []models.UserVehicle {
+	inGroup := make(map[string]bool, len(groupVehicleIDs))
+	for _, imei := range groupVehicleIDs {
+		inGroup[imei] = true
+	}
+
+	filtered := []models.UserVehicle{}
+	for _, userVehicle := range userVehicles {
+		if inGroup[userVehicle.VehicleID] {
+			filtered = append(filtered, userVehicle)
+		}
+	}
+	return filtered
+}
@@ -6,14 +6,23 @@ import (
 	"luna_iot_server/internal/db"
 	"luna_iot_server/internal/models"
 	"luna_iot_server/pkg/colors"
+	"luna_iot_server/pkg/lru"
+	"strconv"
+	"sync"
 	"time"
 )
 
 // VehicleNotificationService handles vehicle-specific notifications
 type VehicleNotificationService struct {
 	ravipangaliService *RavipangaliService
-	// Track vehicle states to prevent duplicate notifications
-	vehicleStates map[string]*VehicleState
+	// Track vehicle states to prevent duplicate notifications, least recently seen evicted first
+	vehicleStates *lru.Cache[string, *VehicleState]
+	// Guards vehicleStates; device connections, the cleanup job and monitoring all use it
+	statesMutex sync.Mutex
+	// Speed at which a vehicle counts as moving (MOVING_SPEED_KMH)
+	movingSpeedKmh int
+	// Displacement with the ignition off that counts as being towed (TOW_AWAY_DISTANCE_METERS, TOW_AWAY_MIN_DURATION)
+	towAway *config.TowAwayConfig
 }
 
 // VehicleState tracks the current state of a vehicle
@@ -22,13 +31,18 @@ type VehicleState struct {
 	IsOverspeeding bool
 	LastSpeed      int
 	LastUpdate     time.Time
+	// Where the vehicle parked with its ignition off; nil while the ignition is on
+	Parked *ParkedPosition
 }
 
 // NewVehicleNotificationService creates a new vehicle notification service
 func NewVehicleNotificationService() *VehicleNotificationService {
+	tcpConfig := config.GetTCPConfig()
 	return &VehicleNotificationService{
 		ravipangaliService: NewRavipangaliService(),
-		vehicleStates:      make(map[string]*VehicleState),
+		vehicleStates:      lru.New[string, *VehicleState](tcpConfig.DeviceStateCapacity),
+		movingSpeedKmh:     tcpConfig.MovingSpeedKmh,
+		towAway:            config.GetTowAwayConfig(),
 	}
 }
 
@@ -40,6 +54,14 @@ const (
 	NotificationTypeIgnitionOff NotificationType = "ignition_off"
 	NotificationTypeOverspeed   NotificationType = "overspeed"
 	NotificationTypeRunning     NotificationType = "running"
+
+	// Sent instead of running when a vehicle starts moving outside its allowed hours
+	NotificationTypeOffHoursMovement NotificationType = "off_hours_movement"
+	// Sent when a vehicle moves away from where it parked while its ignition stays off
+	NotificationTypeTowAway NotificationType = "tow_away"
+
+	// Sent by the maintenance reminder check rather than from GPS events
+	NotificationTypeMaintenanceDue NotificationType = "maintenance_due"
 )
 
 // VehicleNotificationData represents the data needed for vehicle notifications
@@ -66,17 +88,9 @@ func (vns *VehicleNotificationService) CheckAndSendVehicleNotifications(gpsData
 	colors.PrintInfo("🚗 Vehicle found: %s (%s)", vehicle.Name, vehicle.RegNo)
 
 	// Get or create vehicle state tracker
-	vehicleState, exists := vns.vehicleStates[gpsData.IMEI]
-	if !exists {
-		vehicleState = &VehicleState{
-			IsMoving:       false,
-			IsOverspeeding: false,
-			LastSpeed:      0,
-			LastUpdate:     config.GetCurrentTime(),
-		}
-		vns.vehicleStates[gpsData.IMEI] = vehicleState
-		colors.PrintInfo("🆕 Created new state tracker for vehicle %s", gpsData.IMEI)
-	}
+	vns.statesMutex.Lock()
+	vns.getOrCreateState(gpsData.IMEI)
+	vns.statesMutex.Unlock()
 
 	// Prepare notification data
 	notificationData := &VehicleNotificationData{
@@ -103,6 +117,7 @@ func (vns *VehicleNotificationService) CheckAndSendVehicleNotifications(gpsData
 			colors.PrintInfo("📝 No previous ignition data found")
 			if gpsData.Ignition == "ON" {
 				colors.PrintInfo("🚀 First ignition ON detected - sending notification")
+				emitStateTransition(gpsData, TransitionIgnitionOn)
 				return vns.sendIgnitionNotification(notificationData, NotificationTypeIgnitionOn)
 			}
 		} else {
@@ -111,8 +126,10 @@ func (vns *VehicleNotificationService) CheckAndSendVehicleNotifications(gpsData
 			if lastGPSData.Ignition != gpsData.Ignition {
 				colors.PrintInfo("🔄 Ignition status changed from %s to %s", lastGPSData.Ignition, gpsData.Ignition)
 				if gpsData.Ignition == "ON" {
+					emitStateTransition(gpsData, TransitionIgnitionOn)
 					return vns.sendIgnitionNotification(notificationData, NotificationTypeIgnitionOn)
 				} else if gpsData.Ignition == "OFF" {
+					emitStateTransition(gpsData, TransitionIgnitionOff)
 					return vns.sendIgnitionNotification(notificationData, NotificationTypeIgnitionOff)
 				}
 			} else {
@@ -124,53 +141,18 @@ func (vns *VehicleNotificationService) CheckAndSendVehicleNotifications(gpsData
 	// Check speed-based notifications
 	if gpsData.Speed != nil {
 		currentSpeed := *gpsData.Speed
-		colors.PrintInfo("🏃 Current speed: %d km/h, Overspeed limit: %d km/h", currentSpeed, vehicle.Overspeed)
-		colors.PrintInfo("📊 Vehicle state - Moving: %v, Overspeeding: %v, Last Speed: %d",
-			vehicleState.IsMoving, vehicleState.IsOverspeeding, vehicleState.LastSpeed)
-
-		// Check for overspeed state change
-		isCurrentlyOverspeeding := currentSpeed > vehicle.Overspeed
-		if isCurrentlyOverspeeding && !vehicleState.IsOverspeeding {
-			// Transition from normal speed to overspeed
-			colors.PrintWarning("🚨 Overspeed detected! Speed: %d km/h, Limit: %d km/h", currentSpeed, vehicle.Overspeed)
-			vehicleState.IsOverspeeding = true
-			vehicleState.LastSpeed = currentSpeed
-			vehicleState.LastUpdate = config.GetCurrentTime()
-			return vns.sendSpeedNotification(notificationData, NotificationTypeOverspeed, currentSpeed, vehicle.Overspeed)
-		} else if !isCurrentlyOverspeeding && vehicleState.IsOverspeeding {
-			// Transition from overspeed to normal speed
-			colors.PrintInfo("✅ Vehicle returned to normal speed: %d km/h", currentSpeed)
-			vehicleState.IsOverspeeding = false
-			vehicleState.LastSpeed = currentSpeed
-			vehicleState.LastUpdate = config.GetCurrentTime()
-		} else if isCurrentlyOverspeeding {
-			colors.PrintInfo("⏭️ Already overspeeding - skipping notification")
-		}
-
-		// Check for moving state change
-		isCurrentlyMoving := currentSpeed > 5
-		if isCurrentlyMoving && !vehicleState.IsMoving {
-			// Transition from stopped to moving
-			colors.PrintInfo("🏃 Vehicle started moving! Speed: %d km/h (previous: %d)", currentSpeed, vehicleState.LastSpeed)
-			vehicleState.IsMoving = true
-			vehicleState.LastSpeed = currentSpeed
-			vehicleState.LastUpdate = config.GetCurrentTime()
-			return vns.sendSpeedNotification(notificationData, NotificationTypeRunning, currentSpeed, 5)
-		} else if !isCurrentlyMoving && vehicleState.IsMoving {
-			// Transition from moving to stopped
-			colors.PrintInfo("🛑 Vehicle stopped moving. Speed: %d km/h", currentSpeed)
-			vehicleState.IsMoving = false
-			vehicleState.LastSpeed = currentSpeed
-			vehicleState.LastUpdate = config.GetCurrentTime()
-		} else if isCurrentlyMoving {
-			colors.PrintInfo("⏭️ Vehicle already moving (speed: %d km/h) - skipping notification", currentSpeed)
-			// Update last speed even if already moving
-			vehicleState.LastSpeed = currentSpeed
-			vehicleState.LastUpdate = config.GetCurrentTime()
-		} else {
-			// Vehicle is stopped
-			vehicleState.LastSpeed = currentSpeed
-			vehicleState.LastUpdate = config.GetCurrentTime()
+		for _, transition := range vns.RecordSpeed(gpsData, vehicle.Overspeed) {
+			switch transition {
+			case TransitionOverspeedStart:
+				return vns.sendSpeedNotification(notificationData, NotificationTypeOverspeed, currentSpeed, vehicle.Overspeed)
+			case TransitionStartedMoving:
+				if !IsWithinAllowedHours(&vehicle, gpsData.Timestamp) {
+					colors.PrintWarning("🌙 Vehicle %s started moving outside its allowed hours (%s-%s)",
+						gpsData.IMEI, vehicle.AllowedHoursStart, vehicle.AllowedHoursEnd)
+					return vns.sendOffHoursNotification(notificationData, &vehicle, currentSpeed)
+				}
+				return vns.sendSpeedNotification(notificationData, NotificationTypeRunning, currentSpeed, 5)
+			}
 		}
 	}
 
@@ -178,63 +160,195 @@ func (vns *VehicleNotificationService) CheckAndSendVehicleNotifications(gpsData
 	return nil
 }
 
-// sendIgnitionNotification sends ignition-related notifications
-func (vns *VehicleNotificationService) sendIgnitionNotification(data *VehicleNotificationData, notificationType NotificationType) error {
-	var title, body string
+// RecordSpeed applies the fix's speed to the vehicle's tracked state and returns the
+// transitions it caused, which are also sent to live dashboards. An overspeed start is
+// reported on its own; the moving state catches up with the next fix.
+func (vns *VehicleNotificationService) RecordSpeed(gpsData *models.GPSData, overspeedLimit int) []StateTransition {
+	if gpsData.Speed == nil {
+		return nil
+	}
+
+	vns.statesMutex.Lock()
+	transitions := vns.applySpeed(vns.getOrCreateState(gpsData.IMEI), *gpsData.Speed, overspeedLimit)
+	vns.statesMutex.Unlock()
+
+	for _, transition := range transitions {
+		emitStateTransition(gpsData, transition)
+	}
+	return transitions
+}
+
+// applySpeed updates the state for the current speed and returns the transitions.
+// The caller holds statesMutex.
+func (vns *VehicleNotificationService) applySpeed(vehicleState *VehicleState, currentSpeed, overspeedLimit int) []StateTransition {
+	var transitions []StateTransition
+
+	colors.PrintInfo("🏃 Current speed: %d km/h, Overspeed limit: %d km/h", currentSpeed, overspeedLimit)
+	colors.PrintInfo("📊 Vehicle state - Moving: %v, Overspeeding: %v, Last Speed: %d",
+		vehicleState.IsMoving, vehicleState.IsOverspeeding, vehicleState.LastSpeed)
+
+	// Ignition is tracked separately, so only the speed decides the state here
+	status := DetermineVehicleState(currentSpeed, "", overspeedLimit, vns.movingSpeedKmh)
+
+	// Check for overspeed state change
+	isCurrentlyOverspeeding := status == VehicleStatusOverspeed
+	if isCurrentlyOverspeeding && !vehicleState.IsOverspeeding {
+		// Transition from normal speed to overspeed
+		colors.PrintWarning("🚨 Overspeed detected! Speed: %d km/h, Limit: %d km/h", currentSpeed, overspeedLimit)
+		vehicleState.IsOverspeeding = true
+		vehicleState.LastSpeed = currentSpeed
+		vehicleState.LastUpdate = config.GetCurrentTime()
+		return []StateTransition{TransitionOverspeedStart}
+	} else if !isCurrentlyOverspeeding && vehicleState.IsOverspeeding {
+		// Transition from overspeed to normal speed
+		colors.PrintInfo("✅ Vehicle returned to normal speed: %d km/h", currentSpeed)
+		vehicleState.IsOverspeeding = false
+		vehicleState.LastSpeed = currentSpeed
+		vehicleState.LastUpdate = config.GetCurrentTime()
+		transitions = append(transitions, TransitionOverspeedEnd)
+	} else if isCurrentlyOverspeeding {
+		colors.PrintInfo("⏭️ Already overspeeding - skipping notification")
+	}
 
-	// Use timezone-aware time formatting
-	currentTime := config.GetCurrentTime()
+	// Check for moving state change
+	isCurrentlyMoving := status.IsMoving()
+	if isCurrentlyMoving && !vehicleState.IsMoving {
+		// Transition from stopped to moving
+		colors.PrintInfo("🏃 Vehicle started moving! Speed: %d km/h (previous: %d)", currentSpeed, vehicleState.LastSpeed)
+		vehicleState.IsMoving = true
+		transitions = append(transitions, TransitionStartedMoving)
+	} else if !isCurrentlyMoving && vehicleState.IsMoving {
+		// Transition from moving to stopped
+		colors.PrintInfo("🛑 Vehicle stopped moving. Speed: %d km/h", currentSpeed)
+		vehicleState.IsMoving = false
+		transitions = append(transitions, TransitionStoppedMoving)
+	} else if isCurrentlyMoving {
+		colors.PrintInfo("⏭️ Vehicle already moving (speed: %d km/h) - skipping notification", currentSpeed)
+	}
+	vehicleState.LastSpeed = currentSpeed
+	vehicleState.LastUpdate = config.GetCurrentTime()
 
+	return transitions
+}
+
+// getOrCreateState returns the vehicle's tracked state, creating it for a new vehicle.
+// The caller holds statesMutex.
+func (vns *VehicleNotificationService) getOrCreateState(imei string) *VehicleState {
+	vehicleState, exists := vns.vehicleStates.Get(imei)
+	if !exists {
+		vehicleState = &VehicleState{
+			IsMoving:       false,
+			IsOverspeeding: false,
+			LastSpeed:      0,
+			LastUpdate:     config.GetCurrentTime(),
+		}
+		if vns.vehicleStates.Set(imei, vehicleState) {
+			colors.PrintWarning("Vehicle state capacity (%d) reached, evicted the least recently seen vehicle", vns.vehicleStates.Capacity())
+		}
+		colors.PrintInfo("🆕 Created new state tracker for vehicle %s", imei)
+	}
+	return vehicleState
+}
+
+// emitStateTransition sends a detected transition to live dashboards
+func emitStateTransition(gpsData *models.GPSData, state StateTransition) {
+	NotifyStateTransition(&VehicleStateTransition{
+		IMEI:      gpsData.IMEI,
+		State:     state,
+		Speed:     gpsData.Speed,
+		Ignition:  gpsData.Ignition,
+		Timestamp: gpsData.Timestamp,
+	})
+}
+
+// sendIgnitionNotification sends ignition-related notifications
+func (vns *VehicleNotificationService) sendIgnitionNotification(data *VehicleNotificationData, notificationType NotificationType) error {
 	switch notificationType {
-	case NotificationTypeIgnitionOn:
-		title = fmt.Sprintf("%s: Ignition On", data.RegNo)
-		body = fmt.Sprintf("Your vehicle is turned ON\nDate: %s\nTime: %s",
-			currentTime.Format("2006-01-02"),
-			currentTime.Format("03:04 PM"))
-	case NotificationTypeIgnitionOff:
-		title = fmt.Sprintf("%s: Ignition Off", data.RegNo)
-		body = fmt.Sprintf("Your vehicle is turned OFF\nDate: %s\nTime: %s",
-			currentTime.Format("2006-01-02"),
-			currentTime.Format("03:04 PM"))
+	case NotificationTypeIgnitionOn, NotificationTypeIgnitionOff:
 	default:
 		return fmt.Errorf("unknown ignition notification type: %s", notificationType)
 	}
 
-	return vns.sendNotificationToVehicleUsers(data.IMEI, title, body, "alert")
+	return vns.sendNotificationToVehicleUsers(data.IMEI, notificationType, templateData(data, config.GetCurrentTime()))
 }
 
 // sendSpeedNotification sends speed-related notifications
 func (vns *VehicleNotificationService) sendSpeedNotification(data *VehicleNotificationData, notificationType NotificationType, currentSpeed int, threshold int) error {
-	var title, body string
-
-	// Use timezone-aware time formatting
-	currentTime := config.GetCurrentTime()
-
 	switch notificationType {
-	case NotificationTypeOverspeed:
-		title = fmt.Sprintf("%s: Vehicle is Overspeed", data.RegNo)
-		body = fmt.Sprintf("Your vehicle is overspeeding (Speed: %d km/h)\nDate: %s\nTime: %s",
-			currentSpeed,
-			currentTime.Format("2006-01-02"),
-			currentTime.Format("03:04 PM"))
-	case NotificationTypeRunning:
-		title = fmt.Sprintf("%s: Vehicle is Running", data.RegNo)
-		body = fmt.Sprintf("Your vehicle is moving (Speed: %d km/h)\nDate: %s\nTime: %s",
-			currentSpeed,
-			currentTime.Format("2006-01-02"),
-			currentTime.Format("03:04 PM"))
+	case NotificationTypeOverspeed, NotificationTypeRunning:
 	default:
 		return fmt.Errorf("unknown speed notification type: %s", notificationType)
 	}
 
-	return vns.sendNotificationToVehicleUsers(data.IMEI, title, body, "alert")
+	values := templateData(data, config.GetCurrentTime())
+	values["speed"] = strconv.Itoa(currentSpeed)
+	values["limit"] = strconv.Itoa(threshold)
+
+	return vns.sendNotificationToVehicleUsers(data.IMEI, notificationType, values)
+}
+
+// sendOffHoursNotification sends the urgent alert for a vehicle that started moving outside its allowed hours
+func (vns *VehicleNotificationService) sendOffHoursNotification(data *VehicleNotificationData, vehicle *models.Vehicle, currentSpeed int) error {
+	values := templateData(data, config.GetCurrentTime())
+	values["speed"] = strconv.Itoa(currentSpeed)
+	values["allowed_start"] = vehicle.AllowedHoursStart
+	values["allowed_end"] = vehicle.AllowedHoursEnd
+
+	return vns.sendNotificationToVehicleUsers(data.IMEI, NotificationTypeOffHoursMovement, values)
+}
+
+// IsWithinAllowedHours reports whether t falls inside the vehicle's allowed hours, read
+// in the server timezone. The start minute is inside and the end minute outside; a
+// vehicle without a schedule is always allowed.
+func IsWithinAllowedHours(vehicle *models.Vehicle, t time.Time) bool {
+	if !vehicle.HasAllowedHours() {
+		return true
+	}
+	start, startOK := models.ParseClockMinutes(vehicle.AllowedHoursStart)
+	end, endOK := models.ParseClockMinutes(vehicle.AllowedHoursEnd)
+	if !startOK || !endOK || start == end {
+		return true // Never alert on a schedule that could not be saved through the API
+	}
+
+	local := config.InAppTimezone(t)
+	minute := local.Hour()*60 + local.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	// Overnight window, e.g. 22:00-06:00
+	return minute >= start || minute < end
+}
+
+// SendMaintenanceReminder notifies the vehicle's users that a scheduled service is due
+func (vns *VehicleNotificationService) SendMaintenanceReminder(vehicle *models.Vehicle, schedule *models.MaintenanceSchedule, status MaintenanceStatus) error {
+	values := templateData(&VehicleNotificationData{
+		IMEI:        vehicle.IMEI,
+		RegNo:       vehicle.RegNo,
+		VehicleName: vehicle.Name,
+	}, config.GetCurrentTime())
+	values["service"] = schedule.Name
+	values["km_since_service"] = fmt.Sprintf("%.0f", status.KmSinceService)
+	values["hours_since_service"] = fmt.Sprintf("%.1f", status.EngineHoursSinceService)
+
+	return vns.sendNotificationToVehicleUsers(vehicle.IMEI, NotificationTypeMaintenanceDue, values)
+}
+
+// templateData returns the template variables shared by all vehicle events.
+// Times use the configured timezone.
+func templateData(data *VehicleNotificationData, currentTime time.Time) map[string]string {
+	return map[string]string{
+		"vehicle": data.VehicleName,
+		"reg_no":  data.RegNo,
+		"imei":    data.IMEI,
+		"date":    currentTime.Format("2006-01-02"),
+		"time":    currentTime.Format("03:04 PM"),
+	}
 }
 
-// sendNotificationToVehicleUsers sends notification to all users who have notification permission for the vehicle
-func (vns *VehicleNotificationService) sendNotificationToVehicleUsers(imei, title, body, notificationType string) error {
-	colors.PrintInfo("📤 Sending notification to vehicle users for IMEI: %s", imei)
-	colors.PrintInfo("📋 Title: %s", title)
-	colors.PrintInfo("📝 Body: %s", body)
+// sendNotificationToVehicleUsers sends notification to all users who have notification permission for the vehicle.
+// Each user receives the event in their preferred language.
+func (vns *VehicleNotificationService) sendNotificationToVehicleUsers(imei string, notificationType NotificationType, values map[string]string) error {
+	colors.PrintInfo("📤 Sending %s notification to vehicle users for IMEI: %s", notificationType, imei)
 
 	// Get all users who have notification permission for this vehicle
 	var userVehicles []models.UserVehicle
@@ -254,53 +368,101 @@ func (vns *VehicleNotificationService) sendNotificationToVehicleUsers(imei, titl
 		return nil
 	}
 
-	// Collect FCM tokens from users
-	var fcmTokens []string
+	// Collect users whose access is still valid
+	var recipients []models.User
+	var userIDs []uint
 	for _, uv := range userVehicles {
 		// Check if access has expired
 		if uv.ExpiresAt != nil && config.GetCurrentTime().After(*uv.ExpiresAt) {
 			colors.PrintWarning("⏰ User %d access expired for vehicle %s", uv.UserID, imei)
 			continue
 		}
+		recipient := uv.User
+		recipient.ID = uv.UserID
+		recipients = append(recipients, recipient)
+		userIDs = append(userIDs, uv.UserID)
+	}
 
-		if uv.User.FCMToken != "" {
-			fcmTokens = append(fcmTokens, uv.User.FCMToken)
-			colors.PrintInfo("📱 User %d (%s) has FCM token", uv.UserID, uv.User.Name)
+	// Collect FCM tokens from every active device of those users
+	tokensByUser, err := GetUsersFCMTokens(userIDs)
+	if err != nil {
+		colors.PrintError("Failed to get FCM tokens for vehicle %s users: %v", imei, err)
+		return err
+	}
+	for _, userID := range userIDs {
+		if count := len(tokensByUser[userID]); count > 0 {
+			colors.PrintInfo("📱 User %d has %d FCM tokens", userID, count)
 		} else {
-			colors.PrintWarning("📱 User %d (%s) has no FCM token", uv.UserID, uv.User.Name)
+			colors.PrintWarning("📱 User %d has no FCM token", userID)
 		}
 	}
 
-	if len(fcmTokens) == 0 {
-		colors.PrintWarning("No FCM tokens found for vehicle %s users", imei)
-		return nil
+	batches, err := LocalizeNotification(string(notificationType), recipients, values)
+	if err != nil {
+		colors.PrintError("Failed to render %s notification for vehicle %s: %v", notificationType, imei, err)
+		return err
+	}
+
+	var sendErr error
+	for _, batch := range batches {
+		NotifyInApp(batch.UserIDs, &InAppNotification{
+			Type:  batch.Type,
+			Title: batch.Title,
+			Body:  batch.Body,
+			Data: map[string]interface{}{
+				"vehicle_imei":      imei,
+				"notification_type": string(notificationType),
+			},
+		})
+
+		var fcmTokens []string
+		for _, userID := range batch.UserIDs {
+			fcmTokens = append(fcmTokens, tokensByUser[userID]...)
+		}
+		if len(fcmTokens) == 0 {
+			colors.PrintWarning("No FCM tokens found for vehicle %s users (language: %s)", imei, batch.Language)
+			continue
+		}
+
+		if err := vns.sendToTokens(imei, &batch.RenderedNotification, fcmTokens); err != nil {
+			sendErr = err
+		}
 	}
 
-	colors.PrintInfo("📲 Sending notification to %d FCM tokens", len(fcmTokens))
+	return sendErr
+}
+
+// sendToTokens pushes one rendered vehicle notification to the given FCM tokens
+func (vns *VehicleNotificationService) sendToTokens(imei string, notification *RenderedNotification, fcmTokens []string) error {
+	colors.PrintInfo("📋 Title: %s", notification.Title)
+	colors.PrintInfo("📝 Body: %s", notification.Body)
+	colors.PrintInfo("📲 Sending notification to %d FCM tokens (language: %s)", len(fcmTokens), notification.Language)
 
 	// Send notification via Ravipangali API
 	response, err := vns.ravipangaliService.SendPushNotification(
-		title,
-		body,
+		notification.Title,
+		notification.Body,
 		fcmTokens,
 		"", // No image
 		map[string]interface{}{
 			"vehicle_imei":      imei,
-			"notification_type": notificationType,
+			"notification_type": notification.Type,
 			"timestamp":         config.GetCurrentTime().Unix(),
 		},
 		"high", // High priority for vehicle notifications
-		notificationType,
+		notification.Type,
 		"default",
 	)
 
+	ClearUnregisteredFCMTokens(response)
+
 	if err != nil {
 		colors.PrintError("Failed to send vehicle notification: %v", err)
 		return err
 	}
 
 	if response.Success {
-		colors.PrintSuccess("✅ Vehicle notification sent successfully to %d users for vehicle %s", len(fcmTokens), imei)
+		colors.PrintSuccess("✅ Vehicle notification sent successfully to %d devices for vehicle %s", len(fcmTokens), imei)
 		colors.PrintInfo("📊 Notification details: Sent=%d, Delivered=%d, Failed=%d",
 			response.TokensSent, response.TokensDelivered, response.TokensFailed)
 	} else {
@@ -310,31 +472,44 @@ func (vns *VehicleNotificationService) sendNotificationToVehicleUsers(imei, titl
 	return nil
 }
 
-// CleanupOldVehicleStates removes vehicle states that haven't been updated for more than 24 hours
-func (vns *VehicleNotificationService) CleanupOldVehicleStates() {
+// CleanupOldVehicleStates removes vehicle states that haven't been updated for longer
+// than maxAge and returns how many were removed
+func (vns *VehicleNotificationService) CleanupOldVehicleStates(maxAge time.Duration) int {
 	colors.PrintInfo("🧹 Cleaning up old vehicle states...")
 
-	cutoffTime := config.GetCurrentTime().Add(-24 * time.Hour)
-	removedCount := 0
+	cutoffTime := config.GetCurrentTime().Add(-maxAge)
 
-	for imei, state := range vns.vehicleStates {
-		if state.LastUpdate.Before(cutoffTime) {
-			delete(vns.vehicleStates, imei)
-			removedCount++
-			colors.PrintInfo("🗑️ Removed old state for vehicle %s (last update: %s)", imei, state.LastUpdate.Format("2006-01-02 15:04:05"))
+	vns.statesMutex.Lock()
+	removedCount := vns.vehicleStates.RemoveFunc(func(imei string, state *VehicleState) bool {
+		if !state.LastUpdate.Before(cutoffTime) {
+			return false
 		}
-	}
+		colors.PrintInfo("🗑️ Removed old state for vehicle %s (last update: %s)", imei, state.LastUpdate.Format("2006-01-02 15:04:05"))
+		return true
+	})
+	remaining := vns.vehicleStates.Len()
+	vns.statesMutex.Unlock()
 
 	if removedCount > 0 {
-		colors.PrintSuccess("✅ Cleaned up %d old vehicle states", removedCount)
+		colors.PrintSuccess("✅ Cleaned up %d old vehicle states, %d still tracked", removedCount, remaining)
 	} else {
-		colors.PrintInfo("✅ No old vehicle states to clean up")
+		colors.PrintInfo("✅ No old vehicle states to clean up (%d tracked)", remaining)
 	}
+	return removedCount
+}
+
+// TrackedStateCount returns how many vehicle states are held in memory
+func (vns *VehicleNotificationService) TrackedStateCount() int {
+	vns.statesMutex.Lock()
+	defer vns.statesMutex.Unlock()
+	return vns.vehicleStates.Len()
 }
 
 // GetVehicleStateInfo returns information about the current state of a vehicle
 func (vns *VehicleNotificationService) GetVehicleStateInfo(imei string) *VehicleState {
-	if state, exists := vns.vehicleStates[imei]; exists {
+	vns.statesMutex.Lock()
+	defer vns.statesMutex.Unlock()
+	if state, exists := vns.vehicleStates.Peek(imei); exists {
 		return state
 	}
 	return nil
@@ -342,8 +517,9 @@ func (vns *VehicleNotificationService) GetVehicleStateInfo(imei string) *Vehicle
 
 // ResetVehicleState resets the state for a specific vehicle (useful for testing)
 func (vns *VehicleNotificationService) ResetVehicleState(imei string) {
-	if _, exists := vns.vehicleStates[imei]; exists {
-		delete(vns.vehicleStates, imei)
+	vns.statesMutex.Lock()
+	defer vns.statesMutex.Unlock()
+	if vns.vehicleStates.Delete(imei) {
 		colors.PrintInfo("🔄 Reset state for vehicle %s", imei)
 	}
 }
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// vehicleSortColumns maps the sortable fields of the vehicle list to their SQL. Only these
+// fragments reach the ORDER BY, so a sort parameter cannot inject SQL.
+var vehicleSortColumns = map[string]string{
+	"reg_no":     "vehicles.reg_no",
+	"name":       "vehicles.name",
+	"imei":       "vehicles.imei",
+	"created_at": "vehicles.created_at",
+	// Timestamp of the newest gps_data row, as the status filter reads it
+	"last_update": "(SELECT gps_data.timestamp FROM gps_data WHERE gps_data.imei = vehicles.imei ORDER BY gps_data.id DESC LIMIT 1)",
+}
+
+// VehicleSortFields lists the fields ParseVehicleSort accepts
+var VehicleSortFields = []string{"reg_no", "name", "imei", "created_at", "last_update"}
+
+// ParseVehicleSort turns a sort parameter such as "last_update:desc,reg_no" into an ORDER BY
+// clause for the vehicle list. The direction defaults to asc. Vehicles without a value sort
+// last either way, and ties are broken by IMEI so pages do not overlap.
+func ParseVehicleSort(value string) (string, error) {
+	var terms []string
+	sortsByIMEI := false
+
+	for _, key := range strings.Split(value, ",") {
+		field, direction, _ := strings.Cut(strings.TrimSpace(key), ":")
+		column, exists := vehicleSortColumns[field]
+		if !exists {
+			return "", fmt.Errorf("cannot sort by %q; sortable fields are %s", field, strings.Join(VehicleSortFields, ", "))
+		}
+
+		switch strings.ToLower(direction) {
+		case "", "asc":
+			direction = "ASC"
+		case "desc":
+			direction = "DESC"
+		default:
+			return "", fmt.Errorf("sort direction for %s must be asc or desc", field)
+		}
+
+		terms = append(terms, column+" "+direction+" NULLS LAST")
+		sortsByIMEI = sortsByIMEI || field == "imei"
+	}
+
+	if !sortsByIMEI {
+		terms = append(terms, vehicleSortColumns["imei"]+" ASC")
+	}
+	return strings.Join(terms, ", "), nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"luna_iot_server/config"
+	"luna_iot_server/internal/models"
+	"luna_iot_server/pkg/utils"
+	"time"
+)
+
+// VehicleStatus is the running state of a vehicle at one GPS fix
+type VehicleStatus string
+
+const (
+	VehicleStatusStopped   VehicleStatus = "stopped"   // Not moving, ignition off or unknown
+	VehicleStatusIdle      VehicleStatus = "idle"      // Not moving with the ignition on
+	VehicleStatusRunning   VehicleStatus = "running"   // Moving within the speed limit
+	VehicleStatusOverspeed VehicleStatus = "overspeed" // Moving above the speed limit
+)
+
+// DetermineVehicleState classifies a fix. Speeds above overspeedLimit are overspeed, speeds
+// at or above the moving threshold (MOVING_SPEED_KMH) are running, and a slower vehicle is idle
+// while its ignition is on and stopped otherwise. Notifications and route statistics both
+// use it so a vehicle is never running in one and idle in the other.
+func DetermineVehicleState(speed int, ignition string, overspeedLimit, movingSpeedKmh int) VehicleStatus {
+	if speed > overspeedLimit {
+		return VehicleStatusOverspeed
+	}
+	if config.IsMovingSpeed(speed, movingSpeedKmh) {
+		return VehicleStatusRunning
+	}
+	if ignition == "ON" {
+		return VehicleStatusIdle
+	}
+	return VehicleStatusStopped
+}
+
+// IsMoving reports whether the vehicle is running, within the speed limit or not
+func (s VehicleStatus) IsMoving() bool {
+	return s == VehicleStatusRunning || s == VehicleStatusOverspeed
+}
+
+// CountTrips counts the trips in fixes ordered by time. A trip starts when the vehicle
+// moves and ends when the ignition turns off, so stops at traffic lights do not split it.
+// Fixes with an unknown ignition never end a trip.
+func CountTrips(fixes []models.GPSData, movingSpeedKmh int) int {
+	trips := 0
+	inTrip := false
+	for i := range fixes {
+		if fixes[i].Ignition == "OFF" {
+			inTrip = false
+			continue
+		}
+		if !inTrip && fixes[i].Speed != nil && config.IsMovingSpeed(*fixes[i].Speed, movingSpeedKmh) {
+			trips++
+			inTrip = true
+		}
+	}
+	return trips
+}
+
+// MinMovementMeters is the shortest hop between two fixes that counts as travel while the
+// vehicle is not moving. Shorter hops at low speed are GPS jitter around a parked vehicle.
+const MinMovementMeters = 10.0
+
+// SegmentDistanceKm is the distance travelled between two fixes, 0 when either lacks
+// coordinates. A hop under MinMovementMeters counts as 0 unless either fix is above the
+// moving threshold, so jitter while parked does not add to the odometer.
+func SegmentDistanceKm(previous, current *models.GPSData, movingSpeedKmh int) float64 {
+	if !previous.IsValidLocation() || !current.IsValidLocation() {
+		return 0
+	}
+
+	distance := utils.CalculateDistance(*previous.Latitude, *previous.Longitude, *current.Latitude, *current.Longitude)
+	if distance*1000 >= MinMovementMeters {
+		return distance
+	}
+	moving := func(fix *models.GPSData) bool {
+		return fix.Speed != nil && config.IsMovingSpeed(*fix.Speed, movingSpeedKmh)
+	}
+	if moving(previous) || moving(current) {
+		return distance
+	}
+	return 0
+}
+
+// TravelDistanceKm sums SegmentDistanceKm over consecutive fixes ordered by time
+func TravelDistanceKm(fixes []models.GPSData, movingSpeedKmh int) float64 {
+	var total float64
+	for i := 1; i < len(fixes); i++ {
+		total += SegmentDistanceKm(&fixes[i-1], &fixes[i], movingSpeedKmh)
+	}
+	return total
+}
+
+// MinRouteStopDuration is how long a vehicle must stay below the moving threshold for the
+// pause to count as a stop on its route, so traffic lights and queues are not listed
+const MinRouteStopDuration = 5 * time.Minute
+
+// RouteStop is a place on a route where the vehicle stayed put
+type RouteStop struct {
+	Latitude  float64       `json:"latitude"`
+	Longitude float64       `json:"longitude"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// FindRouteStops lists the stops in positioned fixes ordered by time: runs of fixes at or
+// below the moving threshold lasting at least minDuration. A stop ends at the first moving
+// fix after it, or at the last fix when the route ends stationary, and is placed at the
+// position where the vehicle came to rest.
+func FindRouteStops(fixes []models.GPSData, movingSpeedKmh int, minDuration time.Duration) []RouteStop {
+	var stops []RouteStop
+	start := -1
+	closeStop := func(end time.Time) {
+		if start >= 0 && end.Sub(fixes[start].Timestamp) >= minDuration {
+			stops = append(stops, RouteStop{
+				Latitude:  *fixes[start].Latitude,
+				Longitude: *fixes[start].Longitude,
+				Start:     fixes[start].Timestamp,
+				End:       end,
+				Duration:  end.Sub(fixes[start].Timestamp),
+			})
+		}
+		start = -1
+	}
+
+	for i := range fixes {
+		if fixes[i].Latitude == nil || fixes[i].Longitude == nil {
+			continue
+		}
+		moving := fixes[i].Speed != nil && config.IsMovingSpeed(*fixes[i].Speed, movingSpeedKmh)
+		if moving {
+			closeStop(fixes[i].Timestamp)
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		closeStop(fixes[len(fixes)-1].Timestamp)
+	}
+	return stops
+}
@@ -0,0 +1,93 @@
+package tcp
+
+import (
+	"fmt"
+	"luna_iot_server/internal/protocol"
+	"luna_iot_server/internal/services"
+	"strings"
+)
+
+// PacketDecoder turns a raw device byte stream into decoded packets and builds acknowledgements
+type PacketDecoder interface {
+	AddData(data []byte) ([]*protocol.DecodedPacket, error)
+	GenerateResponse(serialNumber uint16, protocolNumber byte) []byte
+}
+
+// DecoderFactory creates a fresh decoder for each accepted connection
+type DecoderFactory func() PacketDecoder
+
+// ListenerConfig describes a single TCP port and the protocol spoken on it
+type ListenerConfig struct {
+	Port       string
+	Protocol   string
+	NewDecoder DecoderFactory
+}
+
+// decoderFactories maps protocol names to their decoder constructors
+var decoderFactories = map[string]DecoderFactory{
+	"gt06": newGT06Decoder,
+}
+
+// newGT06Decoder creates a GT06 decoder configured from the environment
+func newGT06Decoder() PacketDecoder {
+	return services.NewConfiguredGT06Decoder()
+}
+
+// NewGT06ListenerConfig returns a listener configuration speaking GT06 on the given port
+func NewGT06ListenerConfig(port string) ListenerConfig {
+	return ListenerConfig{
+		Port:       port,
+		Protocol:   "gt06",
+		NewDecoder: decoderFactories["gt06"],
+	}
+}
+
+// RegisterDecoderFactory makes a protocol decoder available to ParseListenerConfigs
+func RegisterDecoderFactory(name string, factory DecoderFactory) {
+	decoderFactories[strings.ToLower(name)] = factory
+}
+
+// ParseListenerConfigs parses a listener spec such as "5000:gt06,5001:gt06".
+// The protocol part is optional and defaults to gt06.
+func ParseListenerConfigs(spec string) ([]ListenerConfig, error) {
+	var listeners []ListenerConfig
+	seenPorts := make(map[string]bool)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		port, protocolName := entry, "gt06"
+		if idx := strings.Index(entry, ":"); idx >= 0 {
+			port = strings.TrimSpace(entry[:idx])
+			protocolName = strings.ToLower(strings.TrimSpace(entry[idx+1:]))
+		}
+
+		if port == "" {
+			return nil, fmt.Errorf("listener %q has no port", entry)
+		}
+		if seenPorts[port] {
+			return nil, fmt.Errorf("port %s configured more than once", port)
+		}
+
+		factory, ok := decoderFactories[protocolName]
+		if !ok {
+			return nil, fmt.Errorf("unknown protocol %q for port %s", protocolName, port)
+		}
+
+		seenPorts[port] = true
+		listeners = append(listeners, ListenerConfig{
+			Port:       port,
+			Protocol:   protocolName,
+			NewDecoder: factory,
+		})
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no listeners configured")
+	}
+
+	return listeners, nil
+}
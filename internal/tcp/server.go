@@ -1,7 +1,9 @@
 package tcp
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"luna_iot_server/config"
 	"luna_iot_server/internal/db"
@@ -11,9 +13,12 @@ import (
 	"luna_iot_server/internal/protocol"
 	"luna_iot_server/internal/services"
 	"luna_iot_server/pkg/colors"
-	"math"
+	"luna_iot_server/pkg/lru"
 	"net"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,70 +32,111 @@ type DeviceConnection struct {
 
 // Server represents the TCP server for IoT devices
 type Server struct {
-	port              string
-	listener          net.Listener
+	listenerConfigs   []ListenerConfig
+	listeners         []net.Listener
 	controlController *controllers.ControlController
-	// Track device connections with timestamps
-	deviceConnections map[string]*DeviceConnection
+	// Track device connections with timestamps, least recently seen evicted first
+	deviceConnections *lru.Cache[string, *DeviceConnection]
 	connectionMutex   sync.RWMutex
 	timeoutTicker     *time.Ticker
-	// Vehicle notification service
-	vehicleNotificationService *services.VehicleNotificationService
-	// GPS processing configuration
-	enableGPSSmoothing  bool
-	enableGPSValidation bool
+	// Every accepted connection, including ones that have not logged in yet
+	openConnections map[net.Conn]struct{}
+	openConnMutex   sync.Mutex
+	connWaitGroup   sync.WaitGroup
+	// Connection limit; nil when unlimited
+	connectionSlots     chan struct{}
+	maxConnections      int
+	rejectedConnections uint64
+	// Closed by Stop to signal the accept loops and background workers to exit
+	quit     chan struct{}
+	stopOnce sync.Once
+	// GPS validation, filtering, saving and broadcasting, shared with injected fixes
+	ingestion *services.IngestionService
+	// Status packets keep their coordinates above this speed (MOVING_SPEED_KMH)
+	movingSpeedKmh int
+	// Treatment of devices missing from the devices table (UNREGISTERED_DEVICE_POLICY)
+	unregisteredDevicePolicy string
+	// Sweep of stale vehicle notification states (VEHICLE_STATE_CLEANUP_INTERVAL, VEHICLE_STATE_MAX_AGE)
+	stateCleanupInterval time.Duration
+	stateMaxAge          time.Duration
 }
 
 // NewServer creates a new TCP server instance
 func NewServer(port string) *Server {
-	return &Server{
-		port:                       port,
-		controlController:          controllers.NewControlController(),
-		deviceConnections:          make(map[string]*DeviceConnection),
-		timeoutTicker:              time.NewTicker(5 * time.Minute), // Check every 5 minutes
-		vehicleNotificationService: services.NewVehicleNotificationService(),
-		enableGPSSmoothing:         true, // Enable GPS smoothing by default
-		enableGPSValidation:        true, // Enable GPS validation by default
-	}
+	return NewServerWithListeners([]ListenerConfig{NewGT06ListenerConfig(port)}, controllers.NewControlController())
 }
 
 // NewServerWithController creates a new TCP server instance with a shared control controller
 func NewServerWithController(port string, sharedController *controllers.ControlController) *Server {
-	return &Server{
-		port:                       port,
-		controlController:          sharedController,
-		deviceConnections:          make(map[string]*DeviceConnection),
-		timeoutTicker:              time.NewTicker(5 * time.Minute), // Check every 5 minutes
-		vehicleNotificationService: services.NewVehicleNotificationService(),
-		enableGPSSmoothing:         true, // Enable GPS smoothing by default
-		enableGPSValidation:        true, // Enable GPS validation by default
-	}
+	return NewServerWithListeners([]ListenerConfig{NewGT06ListenerConfig(port)}, sharedController)
 }
 
-// Start starts the TCP server
+// NewServerWithListeners creates a TCP server that accepts devices on several ports,
+// each with its own protocol decoder, sharing one control controller and notification service
+func NewServerWithListeners(listenerConfigs []ListenerConfig, sharedController *controllers.ControlController) *Server {
+	tcpConfig := config.GetTCPConfig()
+
+	var connectionSlots chan struct{}
+	if tcpConfig.MaxConnections > 0 {
+		connectionSlots = make(chan struct{}, tcpConfig.MaxConnections)
+	}
+
+	return &Server{
+		listenerConfigs:          listenerConfigs,
+		controlController:        sharedController,
+		deviceConnections:        lru.New[string, *DeviceConnection](tcpConfig.DeviceStateCapacity),
+		timeoutTicker:            time.NewTicker(5 * time.Minute), // Check every 5 minutes
+		openConnections:          make(map[net.Conn]struct{}),
+		quit:                     make(chan struct{}),
+		connectionSlots:          connectionSlots,
+		maxConnections:           tcpConfig.MaxConnections,
+		ingestion:                services.GetIngestionService(),
+		movingSpeedKmh:           tcpConfig.MovingSpeedKmh,
+		unregisteredDevicePolicy: tcpConfig.UnregisteredDevicePolicy,
+		stateCleanupInterval:     tcpConfig.VehicleStateCleanupInterval,
+		stateMaxAge:              tcpConfig.VehicleStateMaxAge,
+	}
+}
+
+// Start binds every configured listener and serves device connections until they are closed
 func (s *Server) Start() error {
-	listener, err := net.Listen("tcp", ":"+s.port)
-	if err != nil {
-		return fmt.Errorf("failed to start TCP server: %v", err)
+	if len(s.listenerConfigs) == 0 {
+		return fmt.Errorf("failed to start TCP server: no listeners configured")
 	}
 
-	s.listener = listener
-	defer listener.Close()
+	// Bind all ports up front so a misconfigured port fails the whole server
+	for _, listenerConfig := range s.listenerConfigs {
+		listener, err := net.Listen("tcp", ":"+listenerConfig.Port)
+		if err != nil {
+			for _, bound := range s.listeners {
+				bound.Close()
+			}
+			return fmt.Errorf("failed to start TCP server on port %s: %v", listenerConfig.Port, err)
+		}
+		s.listeners = append(s.listeners, listener)
+		colors.PrintServer("📡", "%s TCP Server is running on port %s", strings.ToUpper(listenerConfig.Protocol), listenerConfig.Port)
+	}
 
-	colors.PrintServer("📡", "GT06 TCP Server is running on port %s", s.port)
 	colors.PrintConnection("📶", "Waiting for IoT device connections...")
+	if s.maxConnections > 0 {
+		colors.PrintInfo("Maximum simultaneous device connections: %d", s.maxConnections)
+	}
+
+	// Expose connection usage on the HTTP health endpoint
+	http.SetTCPConnectionStatsProvider(s.ConnectionStats)
 	colors.PrintData("💾", "Database connectivity enabled - GPS data will be saved")
 	colors.PrintControl("Oil/Electricity control system enabled - Ready for commands")
 
 	// Show GPS processing features
-	if s.enableGPSValidation {
+	enableValidation, enableSmoothing, smoothingWeight := s.ingestion.GPSProcessing()
+	if enableValidation {
 		colors.PrintInfo("📍 GPS Validation: Enabled (Nepal region, accuracy, erratic detection)")
 	} else {
 		colors.PrintWarning("📍 GPS Validation: Disabled")
 	}
 
-	if s.enableGPSSmoothing {
-		colors.PrintInfo("📍 GPS Smoothing: Enabled (reduces zigzag patterns)")
+	if enableSmoothing {
+		colors.PrintInfo("📍 GPS Smoothing: Enabled (reduces zigzag patterns, new point weight %.2f)", smoothingWeight)
 	} else {
 		colors.PrintWarning("📍 GPS Smoothing: Disabled")
 	}
@@ -101,41 +147,222 @@ func (s *Server) Start() error {
 	// Start periodic cleanup of vehicle notification states
 	go s.cleanupVehicleNotificationStates()
 
+	// Run one accept loop per listener
+	var wg sync.WaitGroup
+	for i, listener := range s.listeners {
+		wg.Add(1)
+		go func(listener net.Listener, listenerConfig ListenerConfig) {
+			defer wg.Done()
+			defer listener.Close()
+			s.acceptConnections(listener, listenerConfig)
+		}(listener, s.listenerConfigs[i])
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// acceptConnections accepts device connections on a single listener
+func (s *Server) acceptConnections(listener net.Listener, listenerConfig ListenerConfig) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			colors.PrintError("Error accepting TCP connection: %v", err)
+			select {
+			case <-s.quit:
+				colors.PrintInfo("Stopped accepting connections on port %s", listenerConfig.Port)
+				return
+			default:
+			}
+			colors.PrintError("Error accepting TCP connection on port %s: %v", listenerConfig.Port, err)
+			continue
+		}
+
+		if !s.acquireConnectionSlot() {
+			rejected := atomic.AddUint64(&s.rejectedConnections, 1)
+			colors.PrintWarning("Connection limit (%d) reached, rejecting %s on port %s (rejected so far: %d)",
+				s.maxConnections, conn.RemoteAddr(), listenerConfig.Port, rejected)
+			conn.Close()
 			continue
 		}
 
-		// Handle each connection in a separate goroutine
-		go s.handleConnection(conn)
+		if !s.trackConnection(conn) {
+			s.releaseConnectionSlot()
+			conn.Close()
+			return
+		}
+
+		// Handle each connection in a separate goroutine with its own decoder
+		go func() {
+			defer s.connWaitGroup.Done()
+			defer s.releaseConnectionSlot()
+			defer s.untrackConnection(conn)
+			s.handleConnection(conn, listenerConfig.NewDecoder())
+		}()
+	}
+}
+
+// acquireConnectionSlot reserves room for a new connection, returning false when the limit is reached
+func (s *Server) acquireConnectionSlot() bool {
+	if s.connectionSlots == nil {
+		return true
+	}
+
+	select {
+	case s.connectionSlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseConnectionSlot frees the slot held by a closed connection
+func (s *Server) releaseConnectionSlot() {
+	if s.connectionSlots != nil {
+		<-s.connectionSlots
+	}
+}
+
+// ConnectionStats returns the current and maximum number of device connections and
+// how many vehicle notification states are held in memory
+func (s *Server) ConnectionStats() http.TCPConnectionStats {
+	s.openConnMutex.Lock()
+	current := len(s.openConnections)
+	s.openConnMutex.Unlock()
+
+	stats := http.TCPConnectionStats{
+		Current:  current,
+		Max:      s.maxConnections,
+		Rejected: atomic.LoadUint64(&s.rejectedConnections),
+	}
+	if notifications := s.ingestion.VehicleNotifications(); notifications != nil {
+		stats.VehicleStates = notifications.TrackedStateCount()
+	}
+	return stats
+}
+
+// trackConnection records an accepted connection so Stop can close it.
+// It returns false once the server is shutting down.
+func (s *Server) trackConnection(conn net.Conn) bool {
+	s.openConnMutex.Lock()
+	defer s.openConnMutex.Unlock()
+
+	select {
+	case <-s.quit:
+		return false
+	default:
+	}
+
+	s.openConnections[conn] = struct{}{}
+	s.connWaitGroup.Add(1)
+	return true
+}
+
+// untrackConnection forgets a connection after its handler returns
+func (s *Server) untrackConnection(conn net.Conn) {
+	s.openConnMutex.Lock()
+	delete(s.openConnections, conn)
+	s.openConnMutex.Unlock()
+}
+
+// Stop shuts the server down: it closes the listeners so the accept loops return,
+// stops the background tickers, closes open device connections and waits for their
+// handlers to finish saving any packet they were processing, or for ctx to expire.
+func (s *Server) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		colors.PrintInfo("Stopping TCP server...")
+
+		s.openConnMutex.Lock()
+		close(s.quit)
+		s.openConnMutex.Unlock()
+
+		for _, listener := range s.listeners {
+			listener.Close()
+		}
+
+		s.timeoutTicker.Stop()
+
+		s.openConnMutex.Lock()
+		for conn := range s.openConnections {
+			conn.Close()
+		}
+		s.openConnMutex.Unlock()
+	})
+
+	// GPS data is written synchronously by each connection handler, so waiting
+	// for the handlers is what flushes in-flight packets to the database
+	done := make(chan struct{})
+	go func() {
+		s.connWaitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		colors.PrintSuccess("TCP server stopped, all device connections closed")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for device connections to close: %v", ctx.Err())
 	}
 }
 
-// ConfigureGPSProcessing sets GPS processing options
-func (s *Server) ConfigureGPSProcessing(enableValidation, enableSmoothing bool) {
-	s.enableGPSValidation = enableValidation
-	s.enableGPSSmoothing = enableSmoothing
-	colors.PrintInfo("📍 GPS Processing configured: Validation=%v, Smoothing=%v", enableValidation, enableSmoothing)
+// ConfigureGPSProcessing sets GPS processing options.
+// smoothingWeight is the share given to the new fix and must be in (0,1].
+func (s *Server) ConfigureGPSProcessing(enableValidation, enableSmoothing bool, smoothingWeight float64) error {
+	return s.ingestion.ConfigureGPSProcessing(enableValidation, enableSmoothing, smoothingWeight)
+}
+
+// SetMinSatellites sets the minimum satellite count a GPS fix needs to be accepted.
+// Fixes the device reports as not positioned need one satellite more than this.
+func (s *Server) SetMinSatellites(minSatellites int) {
+	s.ingestion.SetMinSatellites(minSatellites)
 }
 
 // isDeviceRegistered checks if a device with given IMEI exists in the database
 func (s *Server) isDeviceRegistered(imei string) bool {
-	var device models.Device
-	err := db.GetDB().Where("imei = ?", imei).First(&device).Error
-	return err == nil
+	return services.IsDeviceRegistered(imei)
+}
+
+// ErrDecoderPanic reports that a protocol decoder panicked on the data it was given
+var ErrDecoderPanic = errors.New("decoder panicked")
+
+// DecodeSafely feeds data to the decoder, turning a panic on malformed input into an
+// ErrDecoderPanic error so a bad packet can't escape the connection handler
+func DecodeSafely(decoder PacketDecoder, data []byte) (packets []*protocol.DecodedPacket, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			packets = nil
+			err = fmt.Errorf("%w: %v", ErrDecoderPanic, recovered)
+		}
+	}()
+	return decoder.AddData(data)
 }
 
 // handleConnection handles incoming IoT device connections
-func (s *Server) handleConnection(conn net.Conn) {
+func (s *Server) handleConnection(conn net.Conn, decoder PacketDecoder) {
 	defer conn.Close()
 
-	colors.PrintConnection("📱", "New IoT Device connected: %s", conn.RemoteAddr())
+	colors.PrintConnection("📱", "New IoT Device connected: %s (port %s)", conn.RemoteAddr(), conn.LocalAddr())
 
-	// Create GT06 decoder for this connection
-	decoder := protocol.NewGT06Decoder()
 	deviceIMEI := ""
+	// Offset from the login packet, for devices that report GPS time in local time
+	var deviceTimezone *int16
+	// Whether the device's packets are processed and acknowledged, see LoginResponse
+	serving := true
+
+	// Once the device is gone, commands must not be written to this connection any more
+	defer func() {
+		if deviceIMEI != "" {
+			s.controlController.UnregisterConnectionIfCurrent(deviceIMEI, conn)
+		}
+	}()
+
+	// A panic while handling one device's data drops only that connection, not the listener
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			colors.PrintError("Recovered from panic handling connection %s (IMEI %q): %v\n%s",
+				conn.RemoteAddr(), deviceIMEI, recovered, debug.Stack())
+		}
+	}()
 
 	// Set connection timeout
 	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
@@ -158,8 +385,14 @@ func (s *Server) handleConnection(conn net.Conn) {
 			// Log raw data received
 			colors.PrintData("📦", "Raw data from %s: %X", conn.RemoteAddr(), buffer[:n])
 
-			// Process data through GT06 decoder
-			packets, err := decoder.AddData(buffer[:n])
+			// Process data through the listener's protocol decoder
+			packets, err := DecodeSafely(decoder, buffer[:n])
+			if errors.Is(err, ErrDecoderPanic) {
+				// The decoder's buffered state can't be trusted after a panic, so drop the device
+				colors.PrintError("Dropping connection %s (IMEI %q) after %v on data %X",
+					conn.RemoteAddr(), deviceIMEI, err, buffer[:n])
+				break
+			}
 			if err != nil {
 				colors.PrintError("Error decoding data from %s: %v", conn.RemoteAddr(), err)
 				continue
@@ -190,20 +423,49 @@ func (s *Server) handleConnection(conn net.Conn) {
 					continue
 				}
 
+				if deviceTimezone != nil {
+					packet.ApplyTimezone(*deviceTimezone)
+				}
+
+				// An unregistered device the policy does not serve only gets its logins looked at
+				if !serving && packet.ProtocolName != "LOGIN" {
+					continue
+				}
+
 				// Handle different packet types
 				switch packet.ProtocolName {
 				case "LOGIN":
-					deviceIMEI = s.handleLoginPacket(packet, conn)
+					var keepOpen bool
+					deviceIMEI, serving, keepOpen = s.handleLoginPacket(packet, conn)
+					deviceTimezone = packet.TimezoneOffset
+					if !keepOpen {
+						colors.PrintWarning("🚫 Closing connection %s: device %s is not registered (policy %s)",
+							conn.RemoteAddr(), deviceIMEI, s.unregisteredDevicePolicy)
+						return
+					}
 				case "GPS_LBS", "GPS_LBS_STATUS", "GPS_LBS_DATA", "GPS_LBS_STATUS_A0":
 					s.handleGPSPacket(packet, conn, deviceIMEI)
 				case "STATUS_INFO":
 					s.handleStatusPacket(packet, conn, deviceIMEI)
 				case "ALARM_DATA":
 					s.handleAlarmPacket(packet, conn)
+				case "ALARM_GPS_LBS_STATUS":
+					// Carries a full fix, so it is stored like a GPS packet as well
+					s.handleAlarmPacket(packet, conn)
+					s.handleGPSPacket(packet, conn, deviceIMEI)
+				case "INFO_TRANSMISSION":
+					s.handleInfoTransmissionPacket(packet, conn, deviceIMEI)
+				case "STRING_INFO", "STRING_INFO_EXTENDED":
+					s.handleCommandReply(packet, deviceIMEI)
+				}
+
+				// Copy to admin debug sessions watching this device; a single atomic load when none are open
+				if http.PacketDebug.HasSubscribers(deviceIMEI) {
+					http.PacketDebug.Publish(deviceIMEI, conn.RemoteAddr().String(), packet)
 				}
 
 				// Send response if required
-				if packet.NeedsResponse {
+				if packet.NeedsResponse && serving {
 					s.sendResponse(packet, conn, decoder)
 				}
 			}
@@ -211,178 +473,62 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 }
 
-// handleLoginPacket processes login packets and returns the device IMEI
-func (s *Server) handleLoginPacket(packet *protocol.DecodedPacket, conn net.Conn) string {
-	deviceIMEI := packet.TerminalID
+// handleLoginPacket processes login packets and returns the device IMEI, and whether the
+// device is served and its connection kept open under the unregistered device policy
+func (s *Server) handleLoginPacket(packet *protocol.DecodedPacket, conn net.Conn) (deviceIMEI string, serving, keepOpen bool) {
+	deviceIMEI = packet.TerminalID
 	colors.PrintConnection("🔐", "Device login: %s from %s", deviceIMEI, conn.RemoteAddr())
-
-	// Register connection with control controller
-	s.controlController.RegisterConnection(deviceIMEI, conn)
-
-	// Update device activity
-	s.updateDeviceActivity(deviceIMEI, conn)
+	if packet.TimezoneOffset != nil {
+		colors.PrintInfo("Device %s timezone offset: %+d min, language: %s", deviceIMEI, *packet.TimezoneOffset, packet.Language)
+	}
 
 	// Check if device is registered in database
-	if s.isDeviceRegistered(deviceIMEI) {
+	registered := s.isDeviceRegistered(deviceIMEI)
+	if registered {
 		colors.PrintSuccess("✅ Device %s is registered in database", deviceIMEI)
 	} else {
-		colors.PrintWarning("⚠️ Device %s is not registered in database", deviceIMEI)
-	}
-
-	return deviceIMEI
-}
-
-// handleGPSPacket processes GPS packets
-func (s *Server) handleGPSPacket(packet *protocol.DecodedPacket, conn net.Conn, deviceIMEI string) {
-	// Update device activity
-	s.updateDeviceActivity(deviceIMEI, conn)
-
-	// Check if we should filter out location data based on ignition and speed
-	shouldFilterLocation := false
-	var speed int
-
-	// Extract speed if available
-	if packet.Speed != nil {
-		speed = int(*packet.Speed)
-	}
-
-	// Filter conditions: ignition OFF or speed < 5
-	if packet.Ignition == "OFF" {
-		shouldFilterLocation = true
-		colors.PrintWarning("🚫 Filtering location data: Ignition is OFF")
-	} else if speed < 5 {
-		shouldFilterLocation = true
-		colors.PrintWarning("🚫 Filtering location data: Speed (%d km/h) is less than 5", speed)
-	}
-
-	// If filtering location, save only status data without coordinates
-	if shouldFilterLocation {
-		colors.PrintInfo("📍 Saving status data only (no GPS coordinates) for device %s", deviceIMEI)
-
-		if deviceIMEI != "" && s.isDeviceRegistered(deviceIMEI) {
-			// Build GPS data without location information
-			gpsData := s.buildFilteredGPSData(packet, deviceIMEI)
-
-			// STEP 1: Check and send vehicle notifications FIRST (before saving to database)
-			var notificationError error
-			if s.vehicleNotificationService != nil {
-				colors.PrintInfo("🔔 Checking notifications BEFORE saving to database")
-				notificationError = s.vehicleNotificationService.CheckAndSendVehicleNotifications(&gpsData)
-				if notificationError != nil {
-					colors.PrintError("❌ Notification check failed: %v - STILL saving to database", notificationError)
-				} else {
-					colors.PrintSuccess("✅ Notification check completed successfully")
-				}
-			}
-
-			// STEP 2: Save filtered data to database
-			if err := db.GetDB().Create(&gpsData).Error; err != nil {
-				colors.PrintError("Error saving filtered GPS data: %v", err)
-			} else {
-				colors.PrintSuccess("✅ Filtered GPS data (status only) saved for device %s", deviceIMEI)
-
-				// STEP 3: Broadcast status update only (no location)
-				if http.WSHub != nil {
-					go http.WSHub.BroadcastStatusUpdate(&gpsData, "", "")
-				}
-			}
-		}
-		return
-	}
-
-	// Validate GPS data exists (only when not filtering)
-	if packet.Latitude == nil || packet.Longitude == nil {
-		colors.PrintWarning("⚠️ Skipping GPS: Missing coordinates (Lat=%v, Lng=%v)", packet.Latitude, packet.Longitude)
-		return
-	}
-
-	lat := *packet.Latitude
-	lng := *packet.Longitude
-
-	// FIXED: Enhanced coordinate range validation for Nepal region
-	// Nepal coordinates: Lat: 26.3478° to 30.4465°, Lng: 80.0586° to 88.2014°
-	// Made range more lenient to accept valid GPS data
-	if s.enableGPSValidation && (lat < 25.0 || lat > 31.5 || lng < 79.0 || lng > 89.5) {
-		colors.PrintWarning("📍 Invalid GPS coordinates (outside Nepal region): Lat=%.12f, Lng=%.12f", lat, lng)
-		return
-	}
-
-	// FIXED: Less strict GPS accuracy validation - accept any data with satellites >= 1
-	if s.enableGPSValidation && packet.Satellites != nil && int(*packet.Satellites) < 1 {
-		colors.PrintWarning("📍 Poor GPS signal: Only %d satellites (min: 1)", *packet.Satellites)
-		return
+		colors.PrintWarning("⚠️ Device %s is not registered in database (policy %s)", deviceIMEI, s.unregisteredDevicePolicy)
 	}
 
-	// FIXED: Much more lenient GPS positioning check - accept if satellites >= 2 even if not positioned
-	if s.enableGPSValidation && packet.GPSPositioned != nil && !*packet.GPSPositioned {
-		// Only reject if we also have very poor satellite signal
-		if packet.Satellites == nil || *packet.Satellites < 2 {
-			colors.PrintWarning("📍 GPS not positioned properly and very poor satellite signal")
-			return
-		}
-		// If we have decent satellite signal (>=2), accept the GPS data even if not positioned
-		colors.PrintInfo("⚠️ GPS not positioned but decent satellite signal (%d satellites) - accepting", *packet.Satellites)
+	serving, keepOpen = LoginResponse(s.unregisteredDevicePolicy, registered)
+	if !serving {
+		return deviceIMEI, serving, keepOpen
 	}
 
-	colors.PrintData("🌍", "Processing GPS: Lat=%.12f, Lng=%.12f, Speed=%v km/h, Ignition=%s, Satellites=%v",
-		lat, lng, packet.Speed, packet.Ignition, packet.Satellites)
+	// Register connection with control controller
+	s.controlController.RegisterConnection(deviceIMEI, conn)
 
-	// GPS accepted with full location data
-	colors.PrintInfo("✅ GPS accepted with location data: Ignition=%s, Speed=%d km/h", packet.Ignition, speed)
+	// Update device activity
+	s.updateDeviceActivity(deviceIMEI, conn)
 
-	// FIXED: Improved duplicate coordinates check with much larger threshold
-	if s.isDuplicateCoordinates(deviceIMEI, lat, lng) {
-		colors.PrintWarning("🚫 GPS rejected: Duplicate coordinates")
-		return
-	}
+	return deviceIMEI, serving, keepOpen
+}
 
-	// FIXED: More lenient erratic GPS check
-	if s.enableGPSValidation && s.isErraticGPS(deviceIMEI, lat, lng) {
-		colors.PrintWarning("🚫 GPS rejected: Erratic GPS coordinates")
-		return
+// LoginResponse decides, after a device logs in, whether its packets are processed and
+// acknowledged and whether its connection stays open. Registered devices are always
+// served; unregistered ones follow the policy, with unknown policies treated as accept.
+func LoginResponse(policy string, registered bool) (serving, keepOpen bool) {
+	if registered {
+		return true, true
 	}
-
-	// FIXED: Less aggressive GPS smoothing to reduce zigzag lines
-	var smoothedLat, smoothedLng float64
-	if s.enableGPSSmoothing {
-		smoothedLat, smoothedLng = s.smoothGPSCoordinates(deviceIMEI, lat, lng)
-	} else {
-		smoothedLat, smoothedLng = lat, lng
+	switch policy {
+	case config.UnregisteredDevicePolicyIgnore:
+		return false, true
+	case config.UnregisteredDevicePolicyReject:
+		return false, false
+	default:
+		return true, true
 	}
+}
 
-	// Save GPS data and broadcast to WebSocket clients
-	if deviceIMEI != "" && s.isDeviceRegistered(deviceIMEI) {
-		gpsData := s.buildGPSData(packet, deviceIMEI)
-
-		// Apply smoothed coordinates to the GPS data
-		gpsData.Latitude = &smoothedLat
-		gpsData.Longitude = &smoothedLng
-
-		// STEP 1: Check and send vehicle notifications FIRST (before saving to database)
-		var notificationError error
-		if s.vehicleNotificationService != nil {
-			colors.PrintInfo("🔔 Checking notifications BEFORE saving to database")
-			notificationError = s.vehicleNotificationService.CheckAndSendVehicleNotifications(&gpsData)
-			if notificationError != nil {
-				colors.PrintError("❌ Notification check failed: %v - STILL saving to database", notificationError)
-				// CHANGED: Don't block database save due to notification failures
-			} else {
-				colors.PrintSuccess("✅ Notification check completed successfully")
-			}
-		}
-
-		// STEP 2: Always save to database (don't block on notification failures)
-		if err := db.GetDB().Create(&gpsData).Error; err != nil {
-			colors.PrintError("Error saving GPS data: %v", err)
-		} else {
-			colors.PrintSuccess("✅ GPS data saved for device %s (Original: %.12f,%.12f -> Smoothed: %.12f,%.12f)",
-				deviceIMEI, lat, lng, smoothedLat, smoothedLng)
+// handleGPSPacket processes GPS packets
+func (s *Server) handleGPSPacket(packet *protocol.DecodedPacket, conn net.Conn, deviceIMEI string) {
+	// Update device activity
+	s.updateDeviceActivity(deviceIMEI, conn)
 
-			// STEP 3: Broadcast the new full GPS data object over WebSocket
-			if http.WSHub != nil {
-				go http.WSHub.BroadcastFullGPSUpdate(&gpsData)
-			}
-		}
+	// Validation, filtering, saving and broadcasting do not depend on the connection
+	if err := s.ingestion.ProcessGPS(packet, deviceIMEI); err != nil {
+		colors.PrintError("Error ingesting GPS data from %s: %v", deviceIMEI, err)
 	}
 }
 
@@ -403,107 +549,6 @@ func (s *Server) shouldAcceptGPSBasedOnIgnition(imei string, packet *protocol.De
 	return true
 }
 
-// isDuplicateCoordinates checks if the coordinates are duplicate (within larger threshold)
-func (s *Server) isDuplicateCoordinates(imei string, lat, lng float64) bool {
-	// Get the latest GPS data for this device
-	var latestGPS models.GPSData
-	err := db.GetDB().Where("imei = ? AND latitude IS NOT NULL AND longitude IS NOT NULL",
-		imei).Order("timestamp DESC").First(&latestGPS).Error
-
-	if err != nil {
-		// No previous GPS data, not a duplicate
-		return false
-	}
-
-	// Calculate distance between current and latest coordinates
-	distance := s.calculateDistance(lat, lng, *latestGPS.Latitude, *latestGPS.Longitude)
-
-	// FIXED: Much more lenient duplicate threshold - only reject if distance is less than 1 meter
-	// This allows vehicles to be tracked even when parked or moving slowly
-	if distance < 0.001 { // 1 meter threshold
-		colors.PrintDebug("📍 Duplicate coordinates detected: Distance=%.6f km (threshold: 0.001 km)", distance)
-		return true
-	}
-
-	return false
-}
-
-// calculateDistance calculates the distance between two coordinates using Haversine formula
-func (s *Server) calculateDistance(lat1, lng1, lat2, lng2 float64) float64 {
-	const R = 6371 // Earth's radius in kilometers
-
-	// Convert to radians
-	lat1Rad := lat1 * math.Pi / 180
-	lat2Rad := lat2 * math.Pi / 180
-	deltaLat := (lat2 - lat1) * math.Pi / 180
-	deltaLng := (lng2 - lng1) * math.Pi / 180
-
-	// Haversine formula
-	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
-		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
-			math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	return R * c
-}
-
-// isErraticGPS checks if GPS coordinates are too erratic (sudden extremely large jumps)
-func (s *Server) isErraticGPS(imei string, lat, lng float64) bool {
-	// Get the last 3 GPS points for this device
-	var recentGPS []models.GPSData
-	err := db.GetDB().Where("imei = ? AND latitude IS NOT NULL AND longitude IS NOT NULL",
-		imei).Order("timestamp DESC").Limit(3).Find(&recentGPS).Error
-
-	if err != nil || len(recentGPS) < 2 {
-		// Not enough data to determine if erratic
-		return false
-	}
-
-	// Calculate distance to the most recent point
-	latestPoint := recentGPS[0]
-	distance := s.calculateDistance(lat, lng, *latestPoint.Latitude, *latestPoint.Longitude)
-
-	// FIXED: Much more lenient erratic GPS threshold - only reject if jump is more than 50km
-	// This prevents false positives when vehicles travel long distances
-	if distance > 50.0 {
-		colors.PrintWarning("📍 Erratic GPS detected: Jump of %.3f km (threshold: 50.000 km)", distance)
-		return true
-	}
-
-	// REMOVED: Sharp angle detection that was causing false positives
-	// Real vehicles can make sharp turns and this was rejecting valid GPS data
-
-	return false
-}
-
-// smoothGPSCoordinates applies minimal smoothing to reduce noise without creating zigzag patterns
-func (s *Server) smoothGPSCoordinates(imei string, lat, lng float64) (float64, float64) {
-	// Get the last GPS point for this device
-	var recentGPS []models.GPSData
-	err := db.GetDB().Where("imei = ? AND latitude IS NOT NULL AND longitude IS NOT NULL",
-		imei).Order("timestamp DESC").Limit(1).Find(&recentGPS).Error
-
-	if err != nil || len(recentGPS) < 1 {
-		// Not enough data for smoothing, return original coordinates
-		return lat, lng
-	}
-
-	// FIXED: Much less aggressive smoothing to preserve route accuracy
-	prevLat := *recentGPS[0].Latitude
-	prevLng := *recentGPS[0].Longitude
-
-	// Apply minimal smoothing with 95% weight for new point, only 5% for previous
-	// This maintains route accuracy while reducing minor GPS noise
-	weight := 0.95
-	smoothedLat := weight*lat + (1-weight)*prevLat
-	smoothedLng := weight*lng + (1-weight)*prevLng
-
-	colors.PrintDebug("📍 GPS smoothing: Original(%.12f,%.12f) -> Smoothed(%.12f,%.12f)",
-		lat, lng, smoothedLat, smoothedLng)
-
-	return smoothedLat, smoothedLng
-}
-
 // handleStatusPacket processes status packets
 func (s *Server) handleStatusPacket(packet *protocol.DecodedPacket, conn net.Conn, deviceIMEI string) {
 	// Update device activity
@@ -512,85 +557,49 @@ func (s *Server) handleStatusPacket(packet *protocol.DecodedPacket, conn net.Con
 	colors.PrintData("📊", "Status info from %s: Ignition=%s, Voltage=%v, GSM Signal=%v",
 		conn.RemoteAddr(), packet.Ignition, packet.Voltage, packet.GSMSignal)
 
+	// Confirm pending oil/electricity commands before the duplicate filter can drop the packet
+	if deviceIMEI != "" && packet.OilElectricity != "" {
+		services.ConfirmControlCommands(deviceIMEI, packet.OilElectricity, time.Now())
+	}
+
 	// Validate for duplicate status data
 	if s.isDuplicateStatusData(deviceIMEI, packet) {
 		return
 	}
 
-	// Check if we should filter out location data based on ignition and speed
+	// Status rows carry no movement for a parked vehicle, or for one reporting a speed below the
+	// moving threshold; status packets usually report no speed, which says nothing either way
 	shouldFilterLocation := false
-	var speed int
-
-	// Extract speed if available
-	if packet.Speed != nil {
-		speed = int(*packet.Speed)
-	}
-
-	// Filter conditions: ignition OFF or speed < 5
 	if packet.Ignition == "OFF" {
 		shouldFilterLocation = true
 		colors.PrintWarning("🚫 Filtering location data in status packet: Ignition is OFF")
-	} else if speed < 5 {
+	} else if packet.Speed != nil && !config.IsMovingSpeed(int(*packet.Speed), s.movingSpeedKmh) {
 		shouldFilterLocation = true
-		colors.PrintWarning("🚫 Filtering location data in status packet: Speed (%d km/h) is less than 5", speed)
+		colors.PrintWarning("🚫 Filtering location data in status packet: Speed (%d km/h) is below %d", *packet.Speed, s.movingSpeedKmh)
 	}
 
-	// Save status data to database and broadcast to WebSocket clients
-	if deviceIMEI != "" && s.isDeviceRegistered(deviceIMEI) {
-		var statusData models.GPSData
-
-		if shouldFilterLocation {
-			// Build filtered status data without location information
-			statusData = s.buildFilteredGPSData(packet, deviceIMEI)
-			colors.PrintInfo("📍 Building filtered status data (no location) for device %s", deviceIMEI)
-		} else {
-			// Get the latest GPS data for this device to preserve location
-			var latestGPS models.GPSData
-			hasLatestGPS := false
-			if err := db.GetDB().Where("imei = ? AND latitude IS NOT NULL AND longitude IS NOT NULL",
-				deviceIMEI).Order("timestamp DESC").First(&latestGPS).Error; err == nil {
-				hasLatestGPS = true
-			}
-
-			statusData = s.buildStatusData(packet, deviceIMEI)
-
-			// Preserve latest GPS coordinates if status packet doesn't have them
-			if !hasLatestGPS && packet.Latitude == nil && packet.Longitude == nil {
-				if hasLatestGPS {
-					statusData.Latitude = latestGPS.Latitude
-					statusData.Longitude = latestGPS.Longitude
-					statusData.Speed = latestGPS.Speed
-					statusData.Course = latestGPS.Course
-				}
-			}
-		}
+	if deviceIMEI == "" {
+		return
+	}
 
-		// STEP 1: Check and send vehicle notifications FIRST (before saving to database)
-		var notificationError error
-		if s.vehicleNotificationService != nil {
-			colors.PrintInfo("🔔 Checking status notifications BEFORE saving to database")
-			notificationError = s.vehicleNotificationService.CheckAndSendVehicleNotifications(&statusData)
-			if notificationError != nil {
-				colors.PrintError("❌ Status notification check failed: %v - NOT saving to database", notificationError)
-				return // Don't save to database if notification check fails
-			}
-			colors.PrintSuccess("✅ Status notification check completed successfully")
-		}
+	var statusData models.GPSData
+	if shouldFilterLocation {
+		// Build filtered status data without location information
+		statusData = s.buildFilteredGPSData(packet, deviceIMEI)
+		colors.PrintInfo("📍 Building filtered status data (no movement) for device %s", deviceIMEI)
+	} else {
+		statusData = s.buildStatusData(packet, deviceIMEI)
+	}
 
-		// STEP 2: Save to database only if notification check succeeded
-		if err := db.GetDB().Create(&statusData).Error; err != nil {
-			colors.PrintError("Error saving status data: %v", err)
+	// Save at the last known location and broadcast to WebSocket clients
+	result, err := s.ingestion.IngestStatus(&statusData, shouldFilterLocation)
+	if err != nil {
+		colors.PrintError("Error saving status data: %v", err)
+	} else if result.Saved {
+		if shouldFilterLocation {
+			colors.PrintSuccess("✅ Filtered status data (no movement) saved for device %s", deviceIMEI)
 		} else {
-			if shouldFilterLocation {
-				colors.PrintSuccess("✅ Filtered status data (no location) saved for device %s", deviceIMEI)
-			} else {
-				colors.PrintSuccess("✅ Status data saved for device %s", deviceIMEI)
-			}
-
-			// Broadcast status update to WebSocket clients
-			if http.WSHub != nil {
-				go http.WSHub.BroadcastStatusUpdate(&statusData, "", "")
-			}
+			colors.PrintSuccess("✅ Status data saved for device %s", deviceIMEI)
 		}
 	}
 }
@@ -600,88 +609,39 @@ func (s *Server) handleAlarmPacket(packet *protocol.DecodedPacket, conn net.Conn
 	colors.PrintWarning("🚨 Alarm data received from %s: %+v", conn.RemoteAddr(), packet)
 }
 
-// sendResponse sends a response to the device
-func (s *Server) sendResponse(packet *protocol.DecodedPacket, conn net.Conn, decoder *protocol.GT06Decoder) {
-	response := decoder.GenerateResponse(uint16(packet.SerialNumber), packet.Protocol)
-	conn.Write(response)
-	colors.PrintData("📤", "Response sent to device: %X", response)
-}
-
-// buildGPSData creates a GPSData model from a decoded packet
-func (s *Server) buildGPSData(packet *protocol.DecodedPacket, deviceIMEI string) models.GPSData {
-	// Use GPS time from device if available, otherwise use packet timestamp
-	timestamp := packet.Timestamp
-	if packet.GPSTime != nil {
-		timestamp = *packet.GPSTime
-	}
-
-	gpsData := models.GPSData{
-		IMEI:         deviceIMEI,
-		Timestamp:    timestamp, // Use device GPS time
-		ProtocolName: packet.ProtocolName,
-		RawPacket:    packet.Raw,
-	}
-
-	// GPS location data with enhanced precision
-	if packet.Latitude != nil {
-		gpsData.Latitude = packet.Latitude
-	}
-	if packet.Longitude != nil {
-		gpsData.Longitude = packet.Longitude
-	}
-	if packet.Speed != nil {
-		speed := int(*packet.Speed)
-		gpsData.Speed = &speed
-	}
-	if packet.Course != nil {
-		course := int(*packet.Course)
-		gpsData.Course = &course
-	}
-	if packet.Altitude != nil {
-		gpsData.Altitude = packet.Altitude
-	}
-	if packet.Satellites != nil {
-		satellites := int(*packet.Satellites)
-		gpsData.Satellites = &satellites
-	}
+// handleInfoTransmissionPacket processes extended information transmission packets
+func (s *Server) handleInfoTransmissionPacket(packet *protocol.DecodedPacket, conn net.Conn, deviceIMEI string) {
+	s.updateDeviceActivity(deviceIMEI, conn)
 
-	// GPS status
-	if packet.GPSRealTime != nil {
-		gpsData.GPSRealTime = packet.GPSRealTime
+	switch {
+	case packet.ExternalVoltage != nil:
+		colors.PrintData("🔋", "External power voltage from %s: %.2fV", deviceIMEI, *packet.ExternalVoltage)
+	case packet.ICCID != "":
+		colors.PrintData("📇", "SIM info from %s: IMSI=%s, ICCID=%s", deviceIMEI, packet.IMSI, packet.ICCID)
+	case packet.DoorStatus != "":
+		colors.PrintData("🚪", "Door status from %s: %s", deviceIMEI, packet.DoorStatus)
+	default:
+		colors.PrintData("ℹ️", "Information packet (%s) from %s: %s", packet.InfoTypeName, deviceIMEI, packet.InfoContent)
 	}
-	if packet.GPSPositioned != nil {
-		gpsData.GPSPositioned = packet.GPSPositioned
-	}
-
-	// Device status
-	gpsData.Ignition = packet.Ignition
-	gpsData.Charger = packet.Charger
-	gpsData.GPSTracking = packet.GPSTracking
-	gpsData.OilElectricity = packet.OilElectricity
-	gpsData.DeviceStatus = packet.DeviceStatus
+}
 
-	// LBS data (cell tower information)
-	if packet.MCC != nil {
-		mcc := int(*packet.MCC)
-		gpsData.MCC = &mcc
-	}
-	if packet.MNC != nil {
-		mnc := int(*packet.MNC)
-		gpsData.MNC = &mnc
-	}
-	if packet.LAC != nil {
-		lac := int(*packet.LAC)
-		gpsData.LAC = &lac
-	}
-	if packet.CellID != nil {
-		cellID := int(*packet.CellID)
-		gpsData.CellID = &cellID
+// handleCommandReply hands the device's answer to a server command to the request waiting for it
+func (s *Server) handleCommandReply(packet *protocol.DecodedPacket, deviceIMEI string) {
+	if s.controlController.DeliverCommandReply(deviceIMEI, packet) {
+		colors.PrintControl("Command reply from device %s (serial %d): %s", deviceIMEI, packet.SerialNumber, packet.CommandReply)
+		return
 	}
+	colors.PrintWarning("Unmatched command reply from device %s: %q", deviceIMEI, packet.CommandReply)
+}
 
-	return gpsData
+// sendResponse sends a response to the device
+func (s *Server) sendResponse(packet *protocol.DecodedPacket, conn net.Conn, decoder PacketDecoder) {
+	response := decoder.GenerateResponse(packet.SerialNumber, packet.Protocol)
+	conn.Write(response)
+	colors.PrintData("📤", "Response sent to device: %X", response)
 }
 
-// buildFilteredGPSData creates a GPSData model without location information (ignition OFF or speed < 5)
+// buildFilteredGPSData creates a GPSData model without location information (ignition OFF or not moving)
 func (s *Server) buildFilteredGPSData(packet *protocol.DecodedPacket, deviceIMEI string) models.GPSData {
 	// Use GPS time from device if available, otherwise use packet timestamp
 	timestamp := packet.Timestamp
@@ -692,6 +652,7 @@ func (s *Server) buildFilteredGPSData(packet *protocol.DecodedPacket, deviceIMEI
 	gpsData := models.GPSData{
 		IMEI:         deviceIMEI,
 		Timestamp:    timestamp,
+		DeviceTime:   packet.DeviceTime,
 		ProtocolName: packet.ProtocolName,
 		RawPacket:    packet.Raw,
 	}
@@ -773,6 +734,7 @@ func (s *Server) buildStatusData(packet *protocol.DecodedPacket, deviceIMEI stri
 	statusData := models.GPSData{
 		IMEI:         deviceIMEI,
 		Timestamp:    timestamp, // Use device GPS time
+		DeviceTime:   packet.DeviceTime,
 		ProtocolName: packet.ProtocolName,
 		RawPacket:    packet.Raw,
 	}
@@ -836,8 +798,13 @@ func (s *Server) monitorDeviceTimeouts() {
 	colors.PrintInfo("⏰ Starting device timeout monitor...")
 
 	// FIXED: More frequent monitoring for better responsiveness
-	for range time.Tick(30 * time.Second) { // Check every 30 seconds instead of 5 minutes
-		s.checkDevicesForInactiveStatus()
+	for {
+		select {
+		case <-s.timeoutTicker.C:
+			s.checkDevicesForInactiveStatus()
+		case <-s.quit:
+			return
+		}
 	}
 }
 
@@ -983,18 +950,21 @@ func (s *Server) updateDeviceActivity(imei string, conn net.Conn) {
 	s.connectionMutex.Lock()
 	defer s.connectionMutex.Unlock()
 
-	if deviceConn, exists := s.deviceConnections[imei]; exists {
+	if deviceConn, exists := s.deviceConnections.Get(imei); exists {
 		deviceConn.LastActivity = config.GetCurrentTime()
 		deviceConn.IsActive = true
 		colors.PrintConnection("📱", "Updated device activity for IMEI %s", imei)
 	} else {
-		s.deviceConnections[imei] = &DeviceConnection{
+		evicted := s.deviceConnections.Set(imei, &DeviceConnection{
 			Conn:         conn,
 			LastActivity: config.GetCurrentTime(),
 			IMEI:         imei,
 			IsActive:     true,
-		}
+		})
 		colors.PrintConnection("📱", "Registered new device connection for IMEI %s", imei)
+		if evicted {
+			colors.PrintWarning("Device state capacity (%d) reached, evicted the least recently seen device", s.deviceConnections.Capacity())
+		}
 	}
 }
 
@@ -1003,7 +973,7 @@ func (s *Server) removeDeviceConnection(imei string) {
 	s.connectionMutex.Lock()
 	defer s.connectionMutex.Unlock()
 
-	if deviceConn, exists := s.deviceConnections[imei]; exists {
+	if deviceConn, exists := s.deviceConnections.Peek(imei); exists {
 		deviceConn.IsActive = false
 		colors.PrintConnection("📱", "Device %s marked as inactive", imei)
 	} else {
@@ -1013,15 +983,20 @@ func (s *Server) removeDeviceConnection(imei string) {
 
 // cleanupVehicleNotificationStates periodically cleans up old vehicle notification states
 func (s *Server) cleanupVehicleNotificationStates() {
-	colors.PrintInfo("🧹 Starting vehicle notification state cleanup...")
+	colors.PrintInfo("🧹 Starting vehicle notification state cleanup (every %s, max age %s)...",
+		s.stateCleanupInterval, s.stateMaxAge)
 
-	// Run cleanup every 6 hours
-	ticker := time.NewTicker(6 * time.Hour)
+	ticker := time.NewTicker(s.stateCleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if s.vehicleNotificationService != nil {
-			s.vehicleNotificationService.CleanupOldVehicleStates()
+	for {
+		select {
+		case <-ticker.C:
+			if notifications := s.ingestion.VehicleNotifications(); notifications != nil {
+				notifications.CleanupOldVehicleStates(s.stateMaxAge)
+			}
+		case <-s.quit:
+			return
 		}
 	}
 }
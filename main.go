@@ -1,17 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
+	"time"
 
 	"luna_iot_server/config"
 	"luna_iot_server/internal/db"
 	"luna_iot_server/internal/http"
 	"luna_iot_server/internal/http/controllers"
+	"luna_iot_server/internal/services"
 	"luna_iot_server/internal/tcp"
 	"luna_iot_server/pkg/colors"
 
@@ -54,6 +56,9 @@ func main() {
 		tcpPort = "5000"
 	}
 
+	// Optional multi-port setup, e.g. TCP_LISTENERS=5000:gt06,5001:gt06
+	tcpListeners := os.Getenv("TCP_LISTENERS")
+
 	httpPort := os.Getenv("HTTP_PORT")
 	if httpPort == "" {
 		httpPort = "8080"
@@ -65,22 +70,42 @@ func main() {
 
 	// Print server startup information
 	colors.PrintHeader("LUNA IOT SERVER INITIALIZATION")
-	colors.PrintServer("📡", "TCP Server configured for port %s (IoT Device Connections)", tcpPort)
+	if tcpListeners != "" {
+		colors.PrintServer("📡", "TCP Server configured for listeners %s (IoT Device Connections)", tcpListeners)
+	} else {
+		colors.PrintServer("📡", "TCP Server configured for port %s (IoT Device Connections)", tcpPort)
+	}
 	colors.PrintServer("🌐", "HTTP Server configured for port %s (REST API Access)", httpPort)
 	colors.PrintSuccess("Database connection established successfully")
 	colors.PrintControl("Oil & Electricity control system enabled")
 	colors.PrintInfo("Firebase removed - notifications will be simulated")
 	colors.PrintInfo("Server timezone: %s (UTC+%d)", config.GetTimezoneString(), config.GetTimezoneOffset())
 
-	// Create a wait group to manage both servers
-	var wg sync.WaitGroup
+	// Create the TCP server, either on a single GT06 port or on every configured listener
+	var tcpServer *tcp.Server
+	if tcpListeners != "" {
+		listenerConfigs, err := tcp.ParseListenerConfigs(tcpListeners)
+		if err != nil {
+			colors.PrintError("Invalid TCP_LISTENERS configuration: %v", err)
+			log.Fatalf("Invalid TCP_LISTENERS configuration: %v", err)
+		}
+		tcpServer = tcp.NewServerWithListeners(listenerConfigs, sharedControlController)
+	} else {
+		tcpServer = tcp.NewServerWithController(tcpPort, sharedControlController)
+	}
+
+	// Purge GPS history past its retention period once a day, off-peak
+	retentionService := services.NewGPSRetentionService()
+	retentionService.Start()
+
+	// Remind vehicle users when a scheduled service is due
+	maintenanceReminderService := services.NewMaintenanceReminderService()
+	maintenanceReminderService.Start()
+
 	errorChan := make(chan error, 2)
 
 	// Start TCP Server in a goroutine
-	wg.Add(1)
 	go func() {
-		defer wg.Done()
-		tcpServer := tcp.NewServerWithController(tcpPort, sharedControlController)
 		colors.PrintInfo("Starting TCP Server for IoT device connections...")
 		if err := tcpServer.Start(); err != nil {
 			errorChan <- fmt.Errorf("TCP server error: %v", err)
@@ -88,9 +113,7 @@ func main() {
 	}()
 
 	// Start HTTP Server in a goroutine
-	wg.Add(1)
 	go func() {
-		defer wg.Done()
 		httpServer := http.NewServerWithController(httpPort, sharedControlController)
 		colors.PrintInfo("Starting HTTP Server for REST API...")
 
@@ -103,15 +126,23 @@ func main() {
 		colors.PrintSubHeader("User-Based Client API Endpoints")
 		colors.PrintEndpoint("GET", "/api/v1/my-vehicles", "Get user's vehicles")
 		colors.PrintEndpoint("GET", "/api/v1/my-tracking", "Get user's vehicles tracking")
+		colors.PrintEndpoint("POST", "/api/v1/my-tracking/latest", "Get latest data for selected vehicles")
+		colors.PrintEndpoint("GET", "/api/v1/my-tracking/nearest", "Get vehicles nearest to a point")
+		colors.PrintEndpoint("GET", "/api/v1/my-tracking/clusters", "Get clustered vehicles for a map view")
 		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei", "Get specific vehicle tracking")
 		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei/location", "Get vehicle location")
 		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei/status", "Get vehicle status")
+		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei/online", "Get vehicle online status")
+		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei/live-snapshot", "Get vehicle detail view snapshot")
 		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei/history", "Get vehicle history")
 		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei/route", "Get vehicle route")
+		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei/timeline", "Get vehicle playback timeline")
+		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei/eta", "Estimate vehicle arrival time")
 		colors.PrintEndpoint("GET", "/api/v1/my-tracking/:imei/reports", "Get vehicle reports")
 		colors.PrintEndpoint("POST", "/api/v1/my-control/:imei/cut-oil", "Cut oil & electricity")
 		colors.PrintEndpoint("POST", "/api/v1/my-control/:imei/connect-oil", "Connect oil & electricity")
 		colors.PrintEndpoint("POST", "/api/v1/my-control/:imei/get-location", "Request device location")
+		colors.PrintEndpoint("GET", "/api/v1/my-control/:imei/availability", "Check control command availability")
 
 		if err := httpServer.Start(); err != nil {
 			errorChan <- fmt.Errorf("HTTP server error: %v", err)
@@ -132,7 +163,15 @@ func main() {
 		colors.PrintInfo("Shutting down Luna IoT Server...")
 	}
 
-	// Wait for both servers to finish
-	wg.Wait()
+	retentionService.Stop()
+	maintenanceReminderService.Stop()
+
+	// Stop the TCP server so device connections close cleanly
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := tcpServer.Stop(ctx); err != nil {
+		colors.PrintWarning("TCP server did not stop cleanly: %v", err)
+	}
+
 	colors.PrintSuccess("Luna IoT Server shutdown complete")
 }
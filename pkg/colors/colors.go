@@ -185,3 +185,47 @@ func PrintStats(label string, value interface{}) {
 		Cyan, label, Reset,
 		BrightWhite, value, Reset)
 }
+
+// RequestLogger prints messages tagged with the ID of the HTTP request that emitted them,
+// so every line logged while serving one request can be found by that ID
+type RequestLogger struct {
+	RequestID string
+}
+
+// ForRequest returns a logger tagging messages with requestID; an empty ID adds no tag
+func ForRequest(requestID string) RequestLogger {
+	return RequestLogger{RequestID: requestID}
+}
+
+// tag prefixes the format with the request ID
+func (l RequestLogger) tag(format string) string {
+	if l.RequestID == "" {
+		return format
+	}
+	return "[req " + l.RequestID + "] " + format
+}
+
+// PrintInfo prints an informational message tagged with the request ID
+func (l RequestLogger) PrintInfo(format string, args ...interface{}) {
+	PrintInfo(l.tag(format), args...)
+}
+
+// PrintSuccess prints a success message tagged with the request ID
+func (l RequestLogger) PrintSuccess(format string, args ...interface{}) {
+	PrintSuccess(l.tag(format), args...)
+}
+
+// PrintWarning prints a warning tagged with the request ID
+func (l RequestLogger) PrintWarning(format string, args ...interface{}) {
+	PrintWarning(l.tag(format), args...)
+}
+
+// PrintError prints an error tagged with the request ID
+func (l RequestLogger) PrintError(format string, args ...interface{}) {
+	PrintError(l.tag(format), args...)
+}
+
+// PrintControl prints a control message tagged with the request ID
+func (l RequestLogger) PrintControl(format string, args ...interface{}) {
+	PrintControl(l.tag(format), args...)
+}
@@ -0,0 +1,109 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrExpired          = errors.New("token expired")
+	ErrMissingSecret    = errors.New("signing secret is empty")
+)
+
+// header is fixed: only HMAC-SHA256 tokens are issued or accepted
+var encodedHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims carries the identity embedded in an access token
+type Claims struct {
+	UserID    uint   `json:"sub"`
+	SessionID string `json:"sid,omitempty"`
+	Role      int    `json:"role"`
+	Name      string `json:"name,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Email     string `json:"email,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// NewClaims returns claims issued now and expiring after ttl
+func NewClaims(userID uint, role int, ttl time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		UserID:    userID,
+		Role:      role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+}
+
+// Sign encodes the claims and signs them with HMAC-SHA256
+func Sign(claims Claims, secret string) (string, error) {
+	if secret == "" {
+		return "", ErrMissingSecret
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodedHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + signature(signingInput, secret), nil
+}
+
+// Parse verifies the token signature and expiry and returns its claims
+func Parse(token, secret string) (*Claims, error) {
+	if secret == "" {
+		return nil, ErrMissingSecret
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	if parts[0] != encodedHeader {
+		return nil, ErrMalformed
+	}
+
+	expected := signature(parts[0]+"."+parts[1], secret)
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, ErrInvalidSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	if claims.UserID == 0 {
+		return nil, ErrMalformed
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+
+	return &claims, nil
+}
+
+// LooksLikeJWT reports whether token has the three dot-separated segments of a JWT.
+// Legacy tokens are plain hex strings and never contain a dot.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func signature(signingInput, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
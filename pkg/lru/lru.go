@@ -0,0 +1,120 @@
+package lru
+
+import "container/list"
+
+// Cache is a size-bounded map that evicts the least recently used entry when full.
+// It is not safe for concurrent use; callers guard it with their own mutex.
+type Cache[K comparable, V any] struct {
+	capacity int
+	items    map[K]*list.Element
+	order    *list.List // Front is the most recently used
+	evicted  uint64
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New creates a cache holding at most capacity entries; capacity below 1 is treated as 1
+func New[K comparable, V any](capacity int) *Cache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Cache[K, V]{
+		capacity: capacity,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value for key and marks it as recently used
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	if element, exists := c.items[key]; exists {
+		c.order.MoveToFront(element)
+		return element.Value.(*entry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Peek returns the value for key without changing how recently it was used
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	if element, exists := c.items[key]; exists {
+		return element.Value.(*entry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set stores the value and marks it as recently used, evicting the least
+// recently used entry when the cache is full. It reports whether an entry was evicted.
+func (c *Cache[K, V]) Set(key K, value V) bool {
+	if element, exists := c.items[key]; exists {
+		element.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return false
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value})
+	if c.order.Len() <= c.capacity {
+		return false
+	}
+
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	delete(c.items, oldest.Value.(*entry[K, V]).key)
+	c.evicted++
+	return true
+}
+
+// Delete removes key and reports whether it was present
+func (c *Cache[K, V]) Delete(key K) bool {
+	element, exists := c.items[key]
+	if !exists {
+		return false
+	}
+	c.order.Remove(element)
+	delete(c.items, key)
+	return true
+}
+
+// RemoveFunc removes every entry for which remove returns true and returns how many were removed
+func (c *Cache[K, V]) RemoveFunc(remove func(key K, value V) bool) int {
+	removed := 0
+	for element := c.order.Back(); element != nil; {
+		previous := element.Prev()
+		item := element.Value.(*entry[K, V])
+		if remove(item.key, item.value) {
+			c.order.Remove(element)
+			delete(c.items, item.key)
+			removed++
+		}
+		element = previous
+	}
+	return removed
+}
+
+// Keys returns the keys from least to most recently used
+func (c *Cache[K, V]) Keys() []K {
+	keys := make([]K, 0, c.order.Len())
+	for element := c.order.Back(); element != nil; element = element.Prev() {
+		keys = append(keys, element.Value.(*entry[K, V]).key)
+	}
+	return keys
+}
+
+// Len returns the number of entries
+func (c *Cache[K, V]) Len() int {
+	return c.order.Len()
+}
+
+// Capacity returns the most entries the cache holds
+func (c *Cache[K, V]) Capacity() int {
+	return c.capacity
+}
+
+// Evicted returns how many entries have been evicted to make room
+func (c *Cache[K, V]) Evicted() uint64 {
+	return c.evicted
+}
@@ -1,6 +1,9 @@
 package utils
 
-import "math"
+import (
+	"math"
+	"time"
+)
 
 const earthRadiusKm = 6371 // Radius of the Earth in kilometers
 
@@ -21,3 +24,140 @@ func CalculateDistance(lat1, lng1, lat2, lng2 float64) float64 {
 
 	return earthRadiusKm * c
 }
+
+// ElevationStats summarises altitude changes along a track, in meters.
+type ElevationStats struct {
+	Gain int  // Cumulative climb
+	Loss int  // Cumulative descent
+	Min  *int // nil when no point has an altitude
+	Max  *int
+}
+
+// CalculateElevationStats sums climb and descent between consecutive points.
+// Points without an altitude are skipped, so a gap compares the altitudes on either side of it.
+func CalculateElevationStats(altitudes []*int) ElevationStats {
+	var stats ElevationStats
+	var previous *int
+
+	for _, altitude := range altitudes {
+		if altitude == nil {
+			continue
+		}
+
+		current := *altitude
+		if stats.Min == nil || current < *stats.Min {
+			stats.Min = &current
+		}
+		if stats.Max == nil || current > *stats.Max {
+			stats.Max = &current
+		}
+
+		if previous != nil {
+			if delta := current - *previous; delta > 0 {
+				stats.Gain += delta
+			} else {
+				stats.Loss -= delta
+			}
+		}
+		previous = &current
+	}
+
+	return stats
+}
+
+// SmoothCoordinate blends a new coordinate with the previous one.
+// weight is the share given to the new value, so 1 returns current unchanged.
+func SmoothCoordinate(weight, current, previous float64) float64 {
+	return weight*current + (1-weight)*previous
+}
+
+// ImpliedSpeedKmh returns the speed needed to cover the distance between two fixes in the
+// time between them. ok is false when the fixes are too close or too far apart in time for
+// the figure to be meaningful.
+func ImpliedSpeedKmh(lat1, lng1 float64, t1 time.Time, lat2, lng2 float64, t2 time.Time) (speed float64, ok bool) {
+	elapsed := t2.Sub(t1)
+	if elapsed < 5*time.Second || elapsed > 5*time.Minute {
+		return 0, false
+	}
+
+	return CalculateDistance(lat1, lng1, lat2, lng2) / elapsed.Hours(), true
+}
+
+// SpeedsDisagree reports whether a reported speed is clearly inconsistent with the implied one:
+// the vehicle must be moving and the gap must exceed both 15 km/h and half the implied speed.
+func SpeedsDisagree(reported int, implied float64) bool {
+	if implied < 10 {
+		return false
+	}
+	gap := math.Abs(implied - float64(reported))
+	return gap > 15 && gap > implied/2
+}
+
+// Point is a latitude/longitude pair in degrees.
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// SimplifyPath reduces a track with the Douglas-Peucker algorithm and returns the indexes of
+// the points to keep, in order. A point is dropped when it lies within toleranceMeters of the
+// line between the points kept on either side of it. The first and last points are always kept.
+func SimplifyPath(points []Point, toleranceMeters float64) []int {
+	if len(points) <= 2 {
+		kept := make([]int, len(points))
+		for i := range points {
+			kept[i] = i
+		}
+		return kept
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// Work through segments with a stack so long tracks cannot exhaust the call stack
+	segments := [][2]int{{0, len(points) - 1}}
+	for len(segments) > 0 {
+		segment := segments[len(segments)-1]
+		segments = segments[:len(segments)-1]
+		first, last := segment[0], segment[1]
+
+		farthest, maxDistance := -1, 0.0
+		for i := first + 1; i < last; i++ {
+			if distance := distanceToSegmentMeters(points[i], points[first], points[last]); distance > maxDistance {
+				farthest, maxDistance = i, distance
+			}
+		}
+
+		if farthest != -1 && maxDistance > toleranceMeters {
+			keep[farthest] = true
+			segments = append(segments, [2]int{first, farthest}, [2]int{farthest, last})
+		}
+	}
+
+	kept := make([]int, 0, len(points))
+	for i, k := range keep {
+		if k {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// distanceToSegmentMeters returns the distance from p to the segment a-b. The points are
+// projected onto a flat plane around a, which is accurate at the scale of a route segment.
+func distanceToSegmentMeters(p, a, b Point) float64 {
+	metersPerDegree := earthRadiusKm * 1000 * math.Pi / 180
+	lngScale := math.Cos(a.Lat * math.Pi / 180)
+
+	px, py := (p.Lng-a.Lng)*lngScale*metersPerDegree, (p.Lat-a.Lat)*metersPerDegree
+	bx, by := (b.Lng-a.Lng)*lngScale*metersPerDegree, (b.Lat-a.Lat)*metersPerDegree
+
+	lengthSquared := bx*bx + by*by
+	if lengthSquared == 0 {
+		return math.Hypot(px, py)
+	}
+
+	// Clamp the projection to the segment so points beyond an end are measured to that end
+	t := math.Max(0, math.Min(1, (px*bx+py*by)/lengthSquared))
+	return math.Hypot(px-t*bx, py-t*by)
+}